@@ -0,0 +1,250 @@
+package api
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/hardware"
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/metrics"
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/puller"
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/statistics"
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/internal/audit"
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/internal/lifecycle"
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/internal/querylog"
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/internal/slo"
+)
+
+type CompactionResponseData struct {
+	CompactedTombstones int                    `json:"compactedTombstones"`
+	Indexes             []*hardware.IndexStats `json:"indexes"`
+}
+
+func handleTombstones(response http.ResponseWriter, request *http.Request) {
+	switch request.Method {
+	case "GET":
+		responseBytes, err := json.Marshal(hardware.Tombstones())
+		if err != nil {
+			response.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		response.WriteHeader(http.StatusOK)
+		response.Write(responseBytes)
+	case "POST":
+		dataBytes, err := io.ReadAll(request.Body)
+		if err != nil {
+			response.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		var tombstone hardware.Tombstone
+		if err := json.Unmarshal(dataBytes, &tombstone); err != nil {
+			response.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		if err := hardware.AddTombstone(&tombstone); err != nil {
+			response.WriteHeader(errorStatus(err, http.StatusBadRequest))
+			response.Write([]byte(err.Error()))
+			return
+		}
+
+		responseBytes, err := json.Marshal(tombstone)
+		if err != nil {
+			response.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		response.WriteHeader(http.StatusCreated)
+		response.Write(responseBytes)
+	default:
+		response.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// handleLocks lists the locked time ranges, or locks one more on behalf of
+// the client asking, and keeps the locking in the access audit.
+func handleLocks(response http.ResponseWriter, request *http.Request) {
+	switch request.Method {
+	case "GET":
+		responseBytes, err := json.Marshal(hardware.Locks())
+		if err != nil {
+			response.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		response.WriteHeader(http.StatusOK)
+		response.Write(responseBytes)
+	case "POST":
+		dataBytes, err := io.ReadAll(request.Body)
+		if err != nil {
+			response.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		var lock hardware.Lock
+		if err := json.Unmarshal(dataBytes, &lock); err != nil {
+			response.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		lock.LockedBy = audit.ClientOf(request)
+
+		if err := hardware.AddLock(&lock); err != nil {
+			response.WriteHeader(errorStatus(err, http.StatusBadRequest))
+			response.Write([]byte(err.Error()))
+			return
+		}
+		audit.Record(&audit.Entry{Time: lock.CreatedAt.UTC(), Client: lock.LockedBy, Method: request.Method, Route: "/api/admin/locks", HardwareIds: []string{lock.HardwareId}, From: &lock.From, To: &lock.To, Status: http.StatusCreated})
+
+		responseBytes, err := json.Marshal(lock)
+		if err != nil {
+			response.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		response.WriteHeader(http.StatusCreated)
+		response.Write(responseBytes)
+	default:
+		response.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func handleCompaction(response http.ResponseWriter, request *http.Request) {
+	if request.Method != "POST" {
+		response.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	compactedTombstones, err := hardware.CompactTombstones()
+	if err != nil {
+		response.WriteHeader(http.StatusInternalServerError)
+		response.Write([]byte(err.Error()))
+		return
+	}
+
+	responseBytes, err := json.Marshal(CompactionResponseData{CompactedTombstones: compactedTombstones, Indexes: hardware.IndexStatistics()})
+	if err != nil {
+		response.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	response.WriteHeader(http.StatusOK)
+	response.Write(responseBytes)
+}
+
+type MetricsSummaryResponseData struct {
+	Counters                  map[string]int64 `json:"counters"`
+	IndexHitRatio             *float64         `json:"indexHitRatio"`
+	AverageBracketSearchSteps *float64         `json:"averageBracketSearchSteps"`
+}
+
+func handleMetricsSummary(response http.ResponseWriter, request *http.Request) {
+	if request.Method != "GET" {
+		response.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	counters := metrics.Counters()
+	indexLookups := counters["hardware_index_hits_total"] + counters["hardware_index_builds_total"]
+	responseBytes, err := json.Marshal(MetricsSummaryResponseData{
+		Counters:                  counters,
+		IndexHitRatio:             statistics.Divide(float64(counters["hardware_index_hits_total"]), float64(indexLookups)).Value,
+		AverageBracketSearchSteps: statistics.Divide(float64(counters["hardware_bracket_search_steps_total"]), float64(counters["hardware_brackets_total"])).Value,
+	})
+	if err != nil {
+		response.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	response.WriteHeader(http.StatusOK)
+	response.Write(responseBytes)
+}
+
+func handlePullers(response http.ResponseWriter, request *http.Request) {
+	if request.Method != "GET" {
+		response.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	responseBytes, err := json.Marshal(puller.Statuses())
+	if err != nil {
+		response.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	response.WriteHeader(http.StatusOK)
+	response.Write(responseBytes)
+}
+
+func handleIndexStatistics(response http.ResponseWriter, request *http.Request) {
+	if request.Method != "GET" {
+		response.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	responseBytes, err := json.Marshal(hardware.IndexStatistics())
+	if err != nil {
+		response.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	response.WriteHeader(http.StatusOK)
+	response.Write(responseBytes)
+}
+
+func handleDrainStatus(response http.ResponseWriter, request *http.Request) {
+	if request.Method != "GET" {
+		response.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	responseBytes, err := json.Marshal(lifecycle.Status())
+	if err != nil {
+		response.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	response.WriteHeader(http.StatusOK)
+	response.Write(responseBytes)
+}
+
+// handleSLOStatus reports, per latency objective and window, how many requests
+// met it and how fast the error budget burns.
+func handleSLOStatus(response http.ResponseWriter, request *http.Request) {
+	if request.Method != "GET" {
+		response.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	responseBytes, err := json.Marshal(slo.Statuses())
+	if err != nil {
+		response.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	response.WriteHeader(http.StatusOK)
+	response.Write(responseBytes)
+}
+
+func handleQueryLog(response http.ResponseWriter, request *http.Request) {
+	if request.Method != "GET" {
+		response.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	top, err := queryInt(request.URL.Query(), "top", 10, 1, 1000)
+	if err != nil {
+		response.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	responseBytes, err := json.Marshal(querylog.Summarize(top))
+	if err != nil {
+		response.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	response.WriteHeader(http.StatusOK)
+	response.Write(responseBytes)
+}
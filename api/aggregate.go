@@ -0,0 +1,69 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/config"
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/hardware"
+)
+
+type AggregateResponseData struct {
+	Id       string             `json:"id"`
+	From     time.Time          `json:"from"`
+	To       time.Time          `json:"to"`
+	Interval config.Duration    `json:"interval"`
+	Buckets  []*hardware.Bucket `json:"buckets"`
+}
+
+// handleAggregate downsamples the raw samples of a hardware into buckets of
+// the requested interval, aligned to the plant's time zone.
+func handleAggregate(response http.ResponseWriter, request *http.Request, hardwareId string) {
+	if request.Method != "GET" {
+		response.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	revision := hardware.Revision()
+	if !hardware.HasSamples(hardwareId) {
+		response.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	query := request.URL.Query()
+	from, err := time.Parse(time.RFC3339, query.Get("from"))
+	if err != nil {
+		response.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	to, err := time.Parse(time.RFC3339, query.Get("to"))
+	if err != nil || !to.After(from) {
+		response.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	interval, err := time.ParseDuration(query.Get("interval"))
+	if err != nil {
+		response.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	buckets, err := hardware.AggregateRange(hardwareId, from, to, interval, config.Current.Location(), config.Current.Tabulation.MaxCount)
+	if err != nil {
+		response.WriteHeader(errorStatus(err, http.StatusBadRequest))
+		response.Write([]byte(err.Error()))
+		return
+	}
+
+	responseBytes, err := json.Marshal(AggregateResponseData{Id: hardwareId, From: from, To: to, Interval: config.Duration{Duration: interval}, Buckets: buckets})
+	if err != nil {
+		response.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if setCacheHeaders(response, request, nil, revision, to) {
+		response.WriteHeader(http.StatusNotModified)
+		return
+	}
+	response.WriteHeader(http.StatusOK)
+	response.Write(responseBytes)
+}
@@ -0,0 +1,169 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/alerts"
+)
+
+type AlertsResponseData struct {
+	Alerts []*alerts.Alert `json:"alerts"`
+}
+
+// handleAlerts lists the alerts raised by the rules, active ones first, then
+// resolved ones, each newest first. They can be narrowed by state and hardware.
+func handleAlerts(response http.ResponseWriter, request *http.Request) {
+	if request.Method != "GET" {
+		response.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := request.URL.Query()
+	state, hardwareId := query.Get("state"), query.Get("id")
+	if state != "" && state != alerts.StateFiring && state != alerts.StateResolved {
+		response.WriteHeader(http.StatusBadRequest)
+		response.Write([]byte(fmt.Sprintf(`unknown alert state "%s"`, state)))
+		return
+	}
+	limit, err := queryInt(query, "limit", 100, 1, 10000)
+	if err != nil {
+		response.WriteHeader(http.StatusBadRequest)
+		response.Write([]byte(err.Error()))
+		return
+	}
+
+	responseData := AlertsResponseData{Alerts: make([]*alerts.Alert, 0)}
+	for _, alert := range alerts.Alerts() {
+		if len(responseData.Alerts) == limit {
+			break
+		}
+		if (state == "" || alert.State == state) && (hardwareId == "" || alert.HardwareId == hardwareId) {
+			responseData.Alerts = append(responseData.Alerts, alert)
+		}
+	}
+
+	responseBytes, err := json.Marshal(responseData)
+	if err != nil {
+		response.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	response.WriteHeader(http.StatusOK)
+	response.Write(responseBytes)
+}
+
+type AlertScheduleResponseData struct {
+	Evaluations []*alerts.Evaluation `json:"evaluations"`
+}
+
+// handleAlertSchedule lists when each rule is evaluated, the scheduled ones
+// first in the order they are next due. It can be narrowed by hardware.
+func handleAlertSchedule(response http.ResponseWriter, request *http.Request) {
+	if request.Method != "GET" {
+		response.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	hardwareId := request.URL.Query().Get("id")
+	responseData := AlertScheduleResponseData{Evaluations: make([]*alerts.Evaluation, 0)}
+	for _, evaluation := range alerts.Schedule() {
+		if hardwareId == "" || evaluation.HardwareId == hardwareId {
+			responseData.Evaluations = append(responseData.Evaluations, evaluation)
+		}
+	}
+
+	responseBytes, err := json.Marshal(responseData)
+	if err != nil {
+		response.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	response.WriteHeader(http.StatusOK)
+	response.Write(responseBytes)
+}
+
+type AlertRulePreviewRequestData struct {
+	Rule alerts.Rule `json:"rule"`
+	From time.Time   `json:"from"`
+	To   time.Time   `json:"to"`
+}
+
+type AlertRulePreviewResponseData struct {
+	Rule    alerts.Rule      `json:"rule"`
+	Firings []*alerts.Firing `json:"firings"`
+
+	// Notifications are what the firings would have sent after throttling.
+	Notifications []*alerts.Notification `json:"notifications"`
+}
+
+func handleAlertRulePreview(response http.ResponseWriter, request *http.Request) {
+	if request.Method != "POST" {
+		response.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	dataBytes, err := io.ReadAll(request.Body)
+	if err != nil {
+		response.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	var requestData AlertRulePreviewRequestData
+	if err := json.Unmarshal(dataBytes, &requestData); err != nil {
+		response.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	firings, err := requestData.Rule.Preview(requestData.From, requestData.To)
+	if err != nil {
+		response.WriteHeader(errorStatus(err, http.StatusBadRequest))
+		return
+	}
+
+	responseBytes, err := json.Marshal(AlertRulePreviewResponseData{Rule: requestData.Rule, Firings: firings, Notifications: requestData.Rule.SimulateNotifications(firings)})
+	if err != nil {
+		response.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	response.WriteHeader(http.StatusOK)
+	response.Write(responseBytes)
+}
+
+func handleAlertRulesYAML(response http.ResponseWriter, request *http.Request) {
+	switch request.Method {
+	case "GET":
+		var rulesYAML bytes.Buffer
+		if err := alerts.ExportYAML(&rulesYAML); err != nil {
+			response.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		response.Header().Set("Content-Type", "application/yaml")
+		response.Header().Set("Content-Disposition", `attachment; filename="alert_rules.yaml"`)
+		response.WriteHeader(http.StatusOK)
+		response.Write(rulesYAML.Bytes())
+	case "PUT":
+		importedRules, err := alerts.ImportYAML(request.Body)
+		if err != nil {
+			response.WriteHeader(http.StatusBadRequest)
+			response.Write([]byte(err.Error()))
+			return
+		}
+
+		if err := alerts.ReplaceRules(importedRules); err != nil {
+			response.WriteHeader(http.StatusBadRequest)
+			response.Write([]byte(err.Error()))
+			return
+		}
+
+		response.WriteHeader(http.StatusNoContent)
+	default:
+		response.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,296 @@
+// Package alerts defines threshold rules over hardware metrics, previews
+// when they would have fired, evaluates them as samples arrive, and throttles
+// the resulting notifications, sent through webhooks and whatever other
+// transports are configured.
+package alerts
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/anomaly"
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/config"
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/hardware"
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/health"
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/statistics"
+)
+
+const (
+	ComparisonAbove = "above"
+	ComparisonBelow = "below"
+
+	// Rate comparisons judge how fast a metric changes, in units per hour,
+	// rather than its level.
+	ComparisonRateAbove = "rate_above"
+	ComparisonRateBelow = "rate_below"
+)
+
+type Rule struct {
+	Id         string `json:"id"`
+	HardwareId string `json:"hardwareId"`
+
+	// Metric may also be "anomalyScore", judging the machine anomaly score
+	// of the hardware instead of one of its channels.
+	Metric     string  `json:"metric"`
+	Comparison string  `json:"comparison"`
+	Threshold  float64 `json:"threshold"`
+
+	// ISO10816, such as "II/C", takes the threshold from the lower edge of a
+	// zone of a machine class in ISO 10816-1 instead of from Threshold.
+	ISO10816 string `json:"iso10816,omitempty"`
+
+	// NotifyInterval is the least time between two notifications of the rule.
+	NotifyInterval config.Duration `json:"notifyInterval"`
+
+	// EvaluationInterval, when set, evaluates the rule on that schedule
+	// rather than as readings arrive, overriding the interval configured for
+	// its metric.
+	EvaluationInterval config.Duration `json:"evaluationInterval"`
+}
+
+// EffectiveThreshold is the threshold the rule judges values against.
+func (rule *Rule) EffectiveThreshold() float64 {
+	if rule.ISO10816 != "" {
+		if threshold, err := health.ISO10816Threshold(rule.ISO10816); err == nil {
+			return threshold
+		}
+	}
+	return rule.Threshold
+}
+
+// EffectiveEvaluationInterval is how often the rule is evaluated, or 0 when
+// it is evaluated as readings arrive.
+func (rule *Rule) EffectiveEvaluationInterval() time.Duration {
+	if rule.EvaluationInterval.Duration > 0 {
+		return rule.EvaluationInterval.Duration
+	}
+	return config.Current.Alerting.EvaluationIntervals[rule.Metric].Duration
+}
+
+func (rule *Rule) IsRate() bool {
+	return rule.Comparison == ComparisonRateAbove || rule.Comparison == ComparisonRateBelow
+}
+
+// IsAnomaly reports whether the rule judges the machine anomaly score.
+func (rule *Rule) IsAnomaly() bool {
+	return rule.Metric == anomaly.MetricScore
+}
+
+func (rule *Rule) Validate() error {
+	if !hardware.HasSamples(rule.HardwareId) {
+		return fmt.Errorf(`%w "%s"`, hardware.ErrUnknownHardware, rule.HardwareId)
+	}
+	if !hardware.IsMetric(rule.Metric) && !rule.IsAnomaly() {
+		return fmt.Errorf(`%w "%s"`, hardware.ErrUnknownMetric, rule.Metric)
+	}
+	if rule.IsAnomaly() && rule.IsRate() {
+		return fmt.Errorf(`anomaly scores are judged by level, not rate`)
+	}
+	switch rule.Comparison {
+	case ComparisonAbove, ComparisonBelow, ComparisonRateAbove, ComparisonRateBelow:
+	default:
+		return fmt.Errorf(`unknown comparison "%s"`, rule.Comparison)
+	}
+	if rule.ISO10816 != "" {
+		if _, err := health.ISO10816Threshold(rule.ISO10816); err != nil {
+			return err
+		}
+		if rule.Comparison != ComparisonAbove || !strings.HasPrefix(rule.Metric, "rmsVelocity") {
+			return fmt.Errorf(`ISO 10816 zones only apply above a RMS velocity`)
+		}
+	}
+	if rule.NotifyInterval.Duration < 0 {
+		return fmt.Errorf(`negative notification interval %s`, rule.NotifyInterval)
+	}
+	if rule.EvaluationInterval.Duration < 0 {
+		return fmt.Errorf(`negative evaluation interval %s`, rule.EvaluationInterval)
+	}
+	if schedulerTick := config.Current.Alerting.SchedulerTick; rule.EvaluationInterval.Duration > 0 && rule.EvaluationInterval.Duration < schedulerTick.Duration {
+		return fmt.Errorf(`evaluation interval %s is shorter than the scheduler tick of %s`, rule.EvaluationInterval, schedulerTick)
+	}
+	return nil
+}
+
+func (rule *Rule) Violates(value float64) bool {
+	switch rule.Comparison {
+	case ComparisonAbove, ComparisonRateAbove:
+		return value > rule.EffectiveThreshold()
+	case ComparisonBelow, ComparisonRateBelow:
+		return value < rule.EffectiveThreshold()
+	default:
+		return false
+	}
+}
+
+// isWorse reports whether value violates the rule further than worstValue.
+func (rule *Rule) isWorse(value float64, worstValue float64) bool {
+	switch rule.Comparison {
+	case ComparisonAbove, ComparisonRateAbove:
+		return value > worstValue
+	default:
+		return value < worstValue
+	}
+}
+
+// evaluator judges the samples of a rule's hardware one after the other,
+// carrying along what compensation and rates need from earlier samples.
+type evaluator struct {
+	rule *Rule
+
+	// scorer keeps the channel baselines of anomaly rules
+	scorer *anomaly.Scorer
+
+	// Channels are sampled at their own instants, so values are compensated
+	// with the last temperature seen
+	temperature *float64
+
+	previousValue *float64
+	previousTime  time.Time
+}
+
+// next returns the value the rule judges a sample by, or false when the
+// sample has nothing to judge.
+func (evaluator *evaluator) next(sample *hardware.Sample) (float64, bool) {
+	if evaluator.rule.IsAnomaly() {
+		if evaluator.scorer == nil {
+			evaluator.scorer = anomaly.NewScorer(evaluator.rule.HardwareId)
+		}
+		score, isScored := evaluator.scorer.Next(sample)
+		if !isScored {
+			return 0, false
+		}
+		return score.Score, true
+	}
+
+	if temperature, _ := sample.ValueByMetric("temperature"); temperature != nil && statistics.IsFinite(*temperature) {
+		evaluator.temperature = temperature
+	}
+
+	rawValue, _ := sample.ValueByMetric(evaluator.rule.Metric)
+	if rawValue == nil || !statistics.IsFinite(*rawValue) {
+		return 0, false
+	}
+	value := Compensate(evaluator.rule.HardwareId, evaluator.rule.Metric, *rawValue, evaluator.temperature)
+	if !evaluator.rule.IsRate() {
+		return value, true
+	}
+
+	previousValue, previousTime := evaluator.previousValue, evaluator.previousTime
+	evaluator.previousValue, evaluator.previousTime = &value, sample.Time
+	if previousValue == nil || !sample.Time.After(previousTime) {
+		return 0, false
+	}
+	return (value - *previousValue) / sample.Time.Sub(previousTime).Hours(), true
+}
+
+// Firing is a run of consecutive samples violating a rule. WorstValue is
+// temperature compensated when the metric has a compensation model, and a
+// rate for rate rules.
+type Firing struct {
+	From        time.Time `json:"from"`
+	To          time.Time `json:"to"`
+	WorstValue  float64   `json:"worstValue"`
+	SampleCount int       `json:"sampleCount"`
+}
+
+func (rule *Rule) Preview(from time.Time, to time.Time) ([]*Firing, error) {
+	if err := rule.Validate(); err != nil {
+		return nil, err
+	}
+
+	// Anomaly rules need the baselines filled before the window
+	samplesFrom := from
+	if rule.IsAnomaly() {
+		samplesFrom = from.Add(-config.Current.Anomaly.Warmup.Duration)
+	}
+	samples, err := hardware.SamplesBetween(rule.HardwareId, samplesFrom, to)
+	if err != nil {
+		return nil, err
+	}
+
+	firings := make([]*Firing, 0)
+	var currentFiring *Firing
+	ruleEvaluator := &evaluator{rule: rule}
+	for _, sample := range samples {
+		value, hasValue := ruleEvaluator.next(sample)
+		if !hasValue || sample.Time.Before(from) {
+			continue
+		}
+
+		if rule.Violates(value) {
+			if currentFiring == nil {
+				currentFiring = &Firing{From: sample.Time, WorstValue: value}
+				firings = append(firings, currentFiring)
+			}
+			currentFiring.To = sample.Time
+			currentFiring.SampleCount++
+			if rule.isWorse(value, currentFiring.WorstValue) {
+				currentFiring.WorstValue = value
+			}
+		} else {
+			currentFiring = nil
+		}
+	}
+	return firings, nil
+}
+
+var (
+	rulesMutex sync.RWMutex
+	rules      []*Rule = make([]*Rule, 0)
+)
+
+func Rules() []*Rule {
+	rulesMutex.RLock()
+	defer rulesMutex.RUnlock()
+
+	return append([]*Rule(nil), rules...)
+}
+
+func ReplaceRules(replacementRules []*Rule) error {
+	ruleIds := make(map[string]bool, len(replacementRules))
+	for _, rule := range replacementRules {
+		if err := rule.Validate(); err != nil {
+			return fmt.Errorf(`invalid rule "%s": %w`, rule.Id, err)
+		}
+		if ruleIds[rule.Id] {
+			return fmt.Errorf(`rule id "%s" is used more than once`, rule.Id)
+		}
+		ruleIds[rule.Id] = true
+	}
+
+	rulesMutex.Lock()
+	rules = append([]*Rule(nil), replacementRules...)
+	rulesMutex.Unlock()
+
+	resynchronize()
+	return nil
+}
+
+// ActiveRules returns the rules of a hardware that its latest values violate,
+// after temperature compensation. Rate and anomaly rules cannot be judged by
+// one value, so they are active while the alert engine has them firing.
+func ActiveRules(hardwareId string, latestValues map[string]float64) []*Rule {
+	var temperature *float64
+	if latestTemperature, hasTemperature := latestValues["temperature"]; hasTemperature {
+		temperature = &latestTemperature
+	}
+
+	activeRules := make([]*Rule, 0)
+	for _, rule := range Rules() {
+		if rule.HardwareId != hardwareId {
+			continue
+		}
+		if rule.IsRate() || rule.IsAnomaly() {
+			if isFiring(rule.Id) {
+				activeRules = append(activeRules, rule)
+			}
+			continue
+		}
+		if value, hasValue := latestValues[rule.Metric]; hasValue && rule.Violates(Compensate(hardwareId, rule.Metric, value, temperature)) {
+			activeRules = append(activeRules, rule)
+		}
+	}
+	return activeRules
+}
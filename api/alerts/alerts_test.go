@@ -0,0 +1,137 @@
+package alerts_test
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/alerts"
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/config"
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/hardware"
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/internal/fixtures"
+)
+
+func TestMain(m *testing.M) {
+	fixtures.Main(m.Run)
+}
+
+func TestPreview(t *testing.T) {
+	rule := &alerts.Rule{Id: "test", HardwareId: fixtures.HardwareId, Metric: "temperature", Comparison: alerts.ComparisonAbove, Threshold: 69.5}
+	firings, err := rule.Preview(fixtures.Minute(0), fixtures.Minute(59))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(firings) != 1 {
+		t.Fatalf(`expected 1 firing, got %d`, len(firings))
+	}
+	if !firings[0].From.Equal(fixtures.Minute(50)) || !firings[0].To.Equal(fixtures.Minute(59)) || firings[0].SampleCount != 10 {
+		t.Errorf(`unexpected firing from %s to %s over %d samples`, firings[0].From, firings[0].To, firings[0].SampleCount)
+	}
+	if math.Abs(firings[0].WorstValue-79) > 1e-6 {
+		t.Errorf(`expected a worst value of 79, got %g`, firings[0].WorstValue)
+	}
+}
+
+func TestCheckNotifiers(t *testing.T) {
+	// A transport of a site's own builds alongside the built-in ones
+	alerts.RegisterNotifier("test", func(settings config.Notifier) (alerts.Notifier, error) {
+		return nil, nil
+	})
+	problems := alerts.CheckNotifiers(config.Alerting{Notifiers: []config.Notifier{
+		{Kind: "test"},
+		{Kind: config.NotifierMQTT, URL: "mqtt://localhost", Topic: "plant/alerts"},
+		{Name: "unknown", Kind: "test_unknown"},
+		{Name: "mail without recipients", Kind: config.NotifierEmail, URL: "smtp://localhost", From: "alerts@localhost"},
+	}})
+	if len(problems) != 2 || !strings.Contains(problems[0].Error(), "unknown") || !strings.Contains(problems[1].Error(), "mail without recipients") {
+		t.Errorf(`expected the unknown kind and the mail without recipients to be refused, got %v`, problems)
+	}
+}
+
+// TestSchedule ingests a reading past the end of the fixtures, so it runs last.
+func TestSchedule(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	alerts.Start(ctx, config.Current.Alerting)
+
+	configuredRules := alerts.Rules()
+	defer alerts.ReplaceRules(configuredRules)
+	if err := alerts.ReplaceRules([]*alerts.Rule{{Id: "test.hasty", HardwareId: fixtures.HardwareId, Metric: "temperature", Comparison: alerts.ComparisonAbove, EvaluationInterval: config.Duration{Duration: time.Millisecond}}}); err == nil {
+		t.Errorf(`expected an evaluation interval below the scheduler tick to be refused`)
+	}
+
+	scheduledRules := make([]*alerts.Rule, 0)
+	for ruleIndex := 0; ruleIndex < 4; ruleIndex++ {
+		scheduledRules = append(scheduledRules, &alerts.Rule{Id: fmt.Sprintf("test.scheduled.%d", ruleIndex), HardwareId: fixtures.HardwareId, Metric: "temperature", Comparison: alerts.ComparisonAbove, Threshold: 1000, EvaluationInterval: config.Duration{Duration: time.Hour}})
+	}
+	now := time.Now()
+	if err := alerts.ReplaceRules(scheduledRules); err != nil {
+		t.Fatal(err)
+	}
+	slots := make(map[time.Time]bool)
+	for _, evaluation := range alerts.Schedule() {
+		if evaluation.NextAt == nil || !evaluation.NextAt.After(now) || evaluation.NextAt.After(now.Add(time.Hour)) {
+			t.Errorf(`rule "%s" is next evaluated at %v, not within the hour`, evaluation.RuleId, evaluation.NextAt)
+			continue
+		}
+		slots[*evaluation.NextAt] = true
+	}
+	if len(slots) < 2 {
+		t.Errorf(`4 rules sharing an interval were not staggered`)
+	}
+
+	description, err := hardware.Describe(fixtures.HardwareId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := hardware.AddSample(&hardware.Reading{HardwareId: fixtures.HardwareId, Time: description.Last.Add(time.Minute), Values: map[string]float64{"temperature": 2000}}); err != nil {
+		t.Fatal(err)
+	}
+	isFiring := func() bool {
+		for _, alert := range alerts.Alerts() {
+			if alert.RuleId == "test.scheduled.0" && alert.State == alerts.StateFiring {
+				return true
+			}
+		}
+		return false
+	}
+	if isFiring() || !alerts.Schedule()[0].Pending {
+		t.Fatalf(`expected the reading to wait for the schedule`)
+	}
+	alerts.EvaluatePending()
+	if !isFiring() {
+		t.Errorf(`expected the scheduled rule to fire once evaluated`)
+	}
+}
+
+// TestLiveRules ingests a reading past the end of the fixtures too, after
+// TestSchedule.
+func TestLiveRules(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	alerts.Start(ctx, config.Current.Alerting)
+
+	configuredRules := alerts.Rules()
+	defer alerts.ReplaceRules(configuredRules)
+	if err := alerts.ReplaceRules([]*alerts.Rule{{Id: "test.live", HardwareId: fixtures.HardwareId, Metric: "temperature", Comparison: alerts.ComparisonAbove, Threshold: 3000}}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Evaluated off the ingesting goroutine, but before the alerts are read
+	description, err := hardware.Describe(fixtures.HardwareId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := hardware.AddSample(&hardware.Reading{HardwareId: fixtures.HardwareId, Time: description.Last.Add(time.Minute), Values: map[string]float64{"temperature": 4000}}); err != nil {
+		t.Fatal(err)
+	}
+	for _, alert := range alerts.Alerts() {
+		if alert.RuleId == "test.live" && alert.State == alerts.StateFiring && alert.WorstValue == 4000 {
+			return
+		}
+	}
+	t.Errorf(`expected the live rule to fire on the reading, got %v`, alerts.Alerts())
+}
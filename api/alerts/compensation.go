@@ -0,0 +1,16 @@
+package alerts
+
+import (
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/config"
+)
+
+// Compensate adjusts a metric value for the temperature it was measured at,
+// using the configured linear model of the hardware and metric. Values without
+// a model or a temperature are returned unchanged.
+func Compensate(hardwareId string, metric string, value float64, temperature *float64) float64 {
+	compensation, hasCompensation := config.Current.CompensationFor(hardwareId, metric)
+	if !hasCompensation || temperature == nil {
+		return value
+	}
+	return value - compensation.Coefficient*(*temperature-compensation.ReferenceTemperature)
+}
@@ -0,0 +1,124 @@
+package alerts
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/smtp"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/config"
+)
+
+// emailNotifier mails notifications through an SMTP server, over TLS from
+// the start with smtps://, or upgraded with STARTTLS when smtp:// offers it.
+type emailNotifier struct {
+	address    string
+	host       string
+	isTLS      bool
+	username   string
+	password   string
+	from       string
+	recipients []string
+}
+
+func newEmailNotifier(settings config.Notifier) (Notifier, error) {
+	serverURL, err := url.Parse(settings.URL)
+	if err != nil || (serverURL.Scheme != "smtp" && serverURL.Scheme != "smtps") || serverURL.Hostname() == "" {
+		return nil, fmt.Errorf(`mail server must be an smtp or smtps URL, got "%s"`, settings.URL)
+	}
+	if settings.From == "" || len(settings.To) == 0 {
+		return nil, fmt.Errorf(`mail needs a sender and recipients`)
+	}
+
+	notifier := &emailNotifier{host: serverURL.Hostname(), isTLS: serverURL.Scheme == "smtps", username: settings.Username, password: settings.Password, from: settings.From, recipients: settings.To}
+	port := serverURL.Port()
+	if port == "" {
+		port = "25"
+		if notifier.isTLS {
+			port = "465"
+		}
+	}
+	notifier.address = net.JoinHostPort(notifier.host, port)
+	return notifier, nil
+}
+
+// headerText keeps line breaks out of a header.
+func headerText(text string) string {
+	return strings.NewReplacer("\r", " ", "\n", " ").Replace(text)
+}
+
+func (notifier *emailNotifier) message(notification *Notification) []byte {
+	var message bytes.Buffer
+	fmt.Fprintf(&message, "From: %s\r\n", headerText(notifier.from))
+	fmt.Fprintf(&message, "To: %s\r\n", headerText(strings.Join(notifier.recipients, ", ")))
+	fmt.Fprintf(&message, "Subject: %s\r\n", headerText(notificationText(notification)))
+	fmt.Fprintf(&message, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	message.WriteString("MIME-Version: 1.0\r\n")
+	message.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	fmt.Fprintf(&message, "Rule:     %s\r\n", notification.RuleId)
+	fmt.Fprintf(&message, "State:    %s\r\n", notification.State)
+	fmt.Fprintf(&message, "Hardware: %s\r\n", notification.HardwareId)
+	fmt.Fprintf(&message, "Metric:   %s\r\n", notification.Metric)
+	fmt.Fprintf(&message, "Value:    %g\r\n", notification.Value)
+	fmt.Fprintf(&message, "Time:     %s\r\n", notification.Time.UTC().Format(time.RFC3339))
+	if notification.Suppressed > 0 {
+		fmt.Fprintf(&message, "\r\n%d changes of state were held back before this one.\r\n", notification.Suppressed)
+	}
+	return message.Bytes()
+}
+
+func (notifier *emailNotifier) Send(ctx context.Context, notification *Notification) error {
+	var dialer net.Dialer
+	connection, err := dialer.DialContext(ctx, "tcp", notifier.address)
+	if err != nil {
+		return err
+	}
+	defer connection.Close()
+	if deadline, hasDeadline := ctx.Deadline(); hasDeadline {
+		connection.SetDeadline(deadline)
+	}
+	if notifier.isTLS {
+		connection = tls.Client(connection, &tls.Config{ServerName: notifier.host})
+	}
+
+	client, err := smtp.NewClient(connection, notifier.host)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+	if hasStartTLS, _ := client.Extension("STARTTLS"); hasStartTLS && !notifier.isTLS {
+		if err := client.StartTLS(&tls.Config{ServerName: notifier.host}); err != nil {
+			return err
+		}
+	}
+	if notifier.username != "" {
+		if err := client.Auth(smtp.PlainAuth("", notifier.username, notifier.password, notifier.host)); err != nil {
+			return err
+		}
+	}
+
+	if err := client.Mail(notifier.from); err != nil {
+		return err
+	}
+	for _, recipient := range notifier.recipients {
+		if err := client.Rcpt(recipient); err != nil {
+			return fmt.Errorf(`recipient %s: %w`, recipient, err)
+		}
+	}
+	dataWriter, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := dataWriter.Write(notifier.message(notification)); err != nil {
+		return err
+	}
+	if err := dataWriter.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
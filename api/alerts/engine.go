@@ -0,0 +1,342 @@
+package alerts
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/config"
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/hardware"
+)
+
+// Alert is one stretch of time a rule was violated, from its first violating
+// sample to the sample that resolved it, if any yet.
+type Alert struct {
+	Id          string     `json:"id"`
+	RuleId      string     `json:"ruleId"`
+	HardwareId  string     `json:"hardwareId"`
+	Metric      string     `json:"metric"`
+	Comparison  string     `json:"comparison"`
+	Threshold   float64    `json:"threshold"`
+	State       string     `json:"state"`
+	From        time.Time  `json:"from"`
+	To          time.Time  `json:"to"`
+	ResolvedAt  *time.Time `json:"resolvedAt,omitempty"`
+	WorstValue  float64    `json:"worstValue"`
+	SampleCount int        `json:"sampleCount"`
+}
+
+type ruleState struct {
+	rule           Rule
+	evaluator      *evaluator
+	evaluatedUntil time.Time
+	active         *Alert
+
+	// A rule evaluated every interval waits for nextEvaluation, and is only
+	// evaluated then if readings arrived since, as marked by pending.
+	interval       time.Duration
+	nextEvaluation time.Time
+	lastEvaluation *time.Time
+	pending        bool
+}
+
+var (
+	engineMutex   sync.Mutex
+	ruleStates    map[string]*ruleState = make(map[string]*ruleState)
+	history       []*Alert              = make([]*Alert, 0)
+	throttle                            = NewThrottle()
+	engineStarted bool
+
+	// queuedChanges holds, per hardware, the span of the readings merged into
+	// the working set since the engine last evaluated them, and changesQueued
+	// wakes the engine goroutine to evaluate them.
+	queuedChangesMutex sync.Mutex
+	queuedChanges      = make(map[string][2]time.Time)
+	changesQueued      = make(chan struct{}, 1)
+)
+
+// evaluate runs a rule over samples past what it has already seen. With
+// live set, every change of state is offered as a notification; otherwise,
+// as when catching up on history, only the state reached at the end is.
+func (state *ruleState) evaluate(samples []*hardware.Sample, live bool) {
+	rule := &state.rule
+	for _, sample := range samples {
+		if !sample.Time.After(state.evaluatedUntil) {
+			continue
+		}
+		state.evaluatedUntil = sample.Time
+
+		value, hasValue := state.evaluator.next(sample)
+		if !hasValue {
+			continue
+		}
+
+		if rule.Violates(value) {
+			if state.active == nil {
+				state.active = &Alert{
+					Id:         fmt.Sprintf("%s-%d", rule.Id, sample.Time.UnixMilli()),
+					RuleId:     rule.Id,
+					HardwareId: rule.HardwareId,
+					Metric:     rule.Metric,
+					Comparison: rule.Comparison,
+					Threshold:  rule.EffectiveThreshold(),
+					State:      StateFiring,
+					From:       sample.Time,
+					WorstValue: value,
+				}
+				if live {
+					offer(rule, StateFiring, value, sample.Time)
+				}
+			}
+			state.active.To = sample.Time
+			state.active.SampleCount++
+			if rule.isWorse(value, state.active.WorstValue) {
+				state.active.WorstValue = value
+			}
+		} else if state.active != nil {
+			resolvedAt := sample.Time
+			state.active.State, state.active.ResolvedAt = StateResolved, &resolvedAt
+			record(state.active)
+			state.active = nil
+			if live {
+				offer(rule, StateResolved, value, sample.Time)
+			}
+		}
+	}
+
+	// Offered again so a change the throttle held back goes out once it may
+	if state.active != nil {
+		offer(rule, StateFiring, state.active.WorstValue, state.active.To)
+	} else {
+		offer(rule, StateResolved, 0, state.evaluatedUntil)
+	}
+}
+
+func record(alert *Alert) {
+	history = append(history, alert)
+	if historyLimit := config.Current.Alerting.HistoryLimit; len(history) > historyLimit {
+		history = append([]*Alert(nil), history[len(history)-historyLimit:]...)
+	}
+}
+
+func offer(rule *Rule, state string, value float64, at time.Time) {
+	notification := &Notification{RuleId: rule.Id, HardwareId: rule.HardwareId, Metric: rule.Metric, State: state, Value: value, Time: at}
+	if throttle.Allow(rule, notification, time.Now()) {
+		deliver(notification)
+	}
+}
+
+// lookbackStart is where a rule without state starts evaluating.
+func lookbackStart(hardwareId string) time.Time {
+	lookback := config.Current.Alerting.Lookback.Duration
+	if lookback <= 0 {
+		return time.Time{}
+	}
+
+	latestValues, err := hardware.LatestValues(hardwareId)
+	if err != nil {
+		return time.Time{}
+	}
+	var latestTime time.Time
+	for _, latestValue := range latestValues {
+		if latestValue.Time.After(latestTime) {
+			latestTime = latestValue.Time
+		}
+	}
+	return latestTime.Add(-lookback)
+}
+
+// synchronize brings the rule states in line with the current rules: states
+// of changed or removed rules are dropped, resolving their active alerts, and
+// new rules catch up on the samples already held.
+func synchronize() {
+	currentRules := Rules()
+	currentRuleIds := make(map[string]bool, len(currentRules))
+	for _, rule := range currentRules {
+		currentRuleIds[rule.Id] = true
+	}
+
+	now := time.Now()
+	for ruleId, state := range ruleStates {
+		if currentRuleIds[ruleId] {
+			continue
+		}
+		if state.active != nil {
+			state.active.State, state.active.ResolvedAt = StateResolved, &now
+			record(state.active)
+		}
+		delete(ruleStates, ruleId)
+	}
+
+	for _, rule := range currentRules {
+		if state, hasState := ruleStates[rule.Id]; hasState {
+			if state.rule == *rule {
+				state.reschedule(now)
+				continue
+			}
+			if state.active != nil {
+				state.active.State, state.active.ResolvedAt = StateResolved, &now
+				record(state.active)
+			}
+		}
+
+		state := &ruleState{rule: *rule, evaluatedUntil: lookbackStart(rule.HardwareId).Add(-time.Millisecond)}
+		state.evaluator = &evaluator{rule: &state.rule}
+		state.reschedule(now)
+		ruleStates[rule.Id] = state
+
+		samples, err := hardware.SamplesBetween(rule.HardwareId, state.evaluatedUntil, endOfTime)
+		if err != nil {
+			continue
+		}
+		state.evaluate(samples, false)
+	}
+	throttle.Forget(currentRules)
+}
+
+// endOfTime bounds queries for every sample from some point on.
+var endOfTime = time.Date(9999, time.December, 31, 0, 0, 0, 0, time.UTC)
+
+// queueChange hands a change of the working set to the engine goroutine. It
+// runs on the ingesting goroutine, so it only merges the span into those
+// queued, and never waits on evaluation.
+func queueChange(hardwareId string, from time.Time, to time.Time) {
+	queuedChangesMutex.Lock()
+	if span, hasSpan := queuedChanges[hardwareId]; hasSpan {
+		if span[0].Before(from) {
+			from = span[0]
+		}
+		if span[1].After(to) {
+			to = span[1]
+		}
+	}
+	queuedChanges[hardwareId] = [2]time.Time{from, to}
+	queuedChangesMutex.Unlock()
+
+	select {
+	case changesQueued <- struct{}{}:
+	default:
+	}
+}
+
+// evaluateQueuedChanges evaluates the changes queued so far. What reads the
+// state of the engine runs it first, so it sees every reading ingested
+// before it. The caller holds engineMutex.
+func evaluateQueuedChanges() {
+	queuedChangesMutex.Lock()
+	changes := queuedChanges
+	queuedChanges = make(map[string][2]time.Time)
+	queuedChangesMutex.Unlock()
+
+	for hardwareId, span := range changes {
+		evaluateChange(hardwareId, span[0], span[1])
+	}
+}
+
+// runChanges evaluates changes as they are queued, until ctx is done.
+func runChanges(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-changesQueued:
+			engineMutex.Lock()
+			evaluateQueuedChanges()
+			engineMutex.Unlock()
+		}
+	}
+}
+
+// evaluateChange evaluates the rules of a hardware over readings merged into
+// the working set between from and to. The caller holds engineMutex.
+func evaluateChange(hardwareId string, from time.Time, to time.Time) {
+	for _, state := range ruleStates {
+		if state.rule.HardwareId != hardwareId || !to.After(state.evaluatedUntil) {
+			continue
+		}
+		if state.interval > 0 {
+			state.pending = true
+			continue
+		}
+		// Readings older than what a rule has seen came too late to judge
+		evaluateFrom := from
+		if !evaluateFrom.After(state.evaluatedUntil) {
+			evaluateFrom = state.evaluatedUntil.Add(time.Millisecond)
+		}
+		samples, err := hardware.SamplesBetween(hardwareId, evaluateFrom, to)
+		if err != nil {
+			continue
+		}
+		state.evaluate(samples, true)
+	}
+}
+
+// Start evaluates the rules over the samples already held, then keeps doing
+// so as readings are ingested, or on their schedule, and sends notifications
+// through the configured webhooks and notifiers until ctx is done. Notifiers
+// that cannot be built are logged and left out.
+func Start(ctx context.Context, settings config.Alerting) {
+	engineMutex.Lock()
+	defer engineMutex.Unlock()
+
+	if !engineStarted {
+		engineStarted = true
+		hardware.OnChange(queueChange)
+		notifiers, problems := buildNotifiers(settings)
+		for _, problem := range problems {
+			log.Printf("%v, not sending through it\n", problem)
+		}
+		go sendNotifications(ctx, notifiers, settings.SendTimeout.Duration)
+		go runChanges(ctx)
+		go runSchedule(ctx, settings.SchedulerTick.Duration)
+	}
+	synchronize()
+}
+
+// Alerts returns the active alerts followed by the resolved ones, each newest
+// first.
+func Alerts() []*Alert {
+	engineMutex.Lock()
+	defer engineMutex.Unlock()
+
+	evaluateQueuedChanges()
+
+	activeAlerts := make([]*Alert, 0)
+	for _, state := range ruleStates {
+		if state.active != nil {
+			activeAlert := *state.active
+			activeAlerts = append(activeAlerts, &activeAlert)
+		}
+	}
+	sort.Slice(activeAlerts, func(leftIndex, rightIndex int) bool {
+		return activeAlerts[leftIndex].From.After(activeAlerts[rightIndex].From)
+	})
+
+	allAlerts := activeAlerts
+	for historyIndex := len(history) - 1; historyIndex >= 0; historyIndex-- {
+		allAlerts = append(allAlerts, history[historyIndex])
+	}
+	return allAlerts
+}
+
+// resynchronize catches the engine up on replaced rules, once it is running.
+func resynchronize() {
+	engineMutex.Lock()
+	defer engineMutex.Unlock()
+
+	if engineStarted {
+		synchronize()
+	}
+}
+
+func isFiring(ruleId string) bool {
+	engineMutex.Lock()
+	defer engineMutex.Unlock()
+
+	evaluateQueuedChanges()
+	state, hasState := ruleStates[ruleId]
+	return hasState && state.active != nil
+}
@@ -0,0 +1,197 @@
+package alerts
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/config"
+)
+
+// MQTT 3.1.1 control packet types, as the high nibble of their first byte.
+const (
+	mqttConnect    = 1
+	mqttConnAck    = 2
+	mqttPublish    = 3
+	mqttPubAck     = 4
+	mqttDisconnect = 14
+)
+
+// mqttKeepAlive is the keep-alive announced to the broker, in seconds. The
+// connection lasts one message, so it never needs to ping.
+const mqttKeepAlive = 60
+
+// mqttNotifier publishes notifications as JSON on a topic of an MQTT broker,
+// over a connection of its own each, at least once: QoS 1, waiting for the
+// broker to acknowledge. The options may set a "clientId", and "retain" to
+// "true" to have the broker keep the last notification for new subscribers.
+type mqttNotifier struct {
+	address  string
+	host     string
+	isTLS    bool
+	username string
+	password string
+	topic    string
+	clientId string
+	isRetain bool
+}
+
+func newMQTTNotifier(settings config.Notifier) (Notifier, error) {
+	brokerURL, err := url.Parse(settings.URL)
+	if err != nil || (brokerURL.Scheme != "mqtt" && brokerURL.Scheme != "mqtts") || brokerURL.Hostname() == "" {
+		return nil, fmt.Errorf(`broker must be an mqtt or mqtts URL, got "%s"`, settings.URL)
+	}
+	if settings.Topic == "" {
+		return nil, fmt.Errorf(`a topic is required`)
+	}
+
+	notifier := &mqttNotifier{host: brokerURL.Hostname(), isTLS: brokerURL.Scheme == "mqtts", username: settings.Username, password: settings.Password, topic: settings.Topic, clientId: settings.Options["clientId"], isRetain: settings.Options["retain"] == "true"}
+	port := brokerURL.Port()
+	if port == "" {
+		port = "1883"
+		if notifier.isTLS {
+			port = "8883"
+		}
+	}
+	notifier.address = net.JoinHostPort(notifier.host, port)
+	if notifier.clientId == "" {
+		suffix := make([]byte, 4)
+		rand.Read(suffix)
+		notifier.clientId = "kcf-alerts-" + hex.EncodeToString(suffix)
+	}
+	return notifier, nil
+}
+
+func appendMQTTString(packet []byte, text string) []byte {
+	packet = binary.BigEndian.AppendUint16(packet, uint16(len(text)))
+	return append(packet, text...)
+}
+
+// writeMQTTPacket frames a packet body behind its first byte and remaining
+// length.
+func writeMQTTPacket(writer io.Writer, firstByte byte, body []byte) error {
+	packet := []byte{firstByte}
+	for remaining := len(body); ; {
+		encoded := byte(remaining % 128)
+		remaining /= 128
+		if remaining > 0 {
+			encoded |= 128
+		}
+		packet = append(packet, encoded)
+		if remaining == 0 {
+			break
+		}
+	}
+	_, err := writer.Write(append(packet, body...))
+	return err
+}
+
+// readMQTTPacket reads the next packet, returning its type and body.
+func readMQTTPacket(reader *bufio.Reader) (byte, []byte, error) {
+	firstByte, err := reader.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+	remaining, multiplier := 0, 1
+	for lengthIndex := 0; ; lengthIndex++ {
+		encoded, err := reader.ReadByte()
+		if err != nil {
+			return 0, nil, err
+		}
+		if lengthIndex == 4 {
+			return 0, nil, errors.New(`malformed packet length`)
+		}
+		remaining += int(encoded&127) * multiplier
+		multiplier *= 128
+		if encoded&128 == 0 {
+			break
+		}
+	}
+	body := make([]byte, remaining)
+	if _, err := io.ReadFull(reader, body); err != nil {
+		return 0, nil, err
+	}
+	return firstByte >> 4, body, nil
+}
+
+func (notifier *mqttNotifier) Send(ctx context.Context, notification *Notification) error {
+	payload, err := json.Marshal(notification)
+	if err != nil {
+		return err
+	}
+
+	var dialer net.Dialer
+	connection, err := dialer.DialContext(ctx, "tcp", notifier.address)
+	if err != nil {
+		return err
+	}
+	defer connection.Close()
+	if deadline, hasDeadline := ctx.Deadline(); hasDeadline {
+		connection.SetDeadline(deadline)
+	}
+	if notifier.isTLS {
+		connection = tls.Client(connection, &tls.Config{ServerName: notifier.host})
+	}
+	reader := bufio.NewReader(connection)
+
+	connectFlags := byte(0x02) // clean session
+	connect := appendMQTTString(nil, "MQTT")
+	if notifier.username != "" {
+		connectFlags |= 0x80
+		if notifier.password != "" {
+			connectFlags |= 0x40
+		}
+	}
+	connect = append(connect, 4, connectFlags)
+	connect = binary.BigEndian.AppendUint16(connect, mqttKeepAlive)
+	connect = appendMQTTString(connect, notifier.clientId)
+	if notifier.username != "" {
+		connect = appendMQTTString(connect, notifier.username)
+		if notifier.password != "" {
+			connect = appendMQTTString(connect, notifier.password)
+		}
+	}
+	if err := writeMQTTPacket(connection, mqttConnect<<4, connect); err != nil {
+		return err
+	}
+	packetType, body, err := readMQTTPacket(reader)
+	if err != nil {
+		return fmt.Errorf(`no acknowledgement of the connection: %w`, err)
+	}
+	if packetType != mqttConnAck || len(body) != 2 {
+		return fmt.Errorf(`expected a connection acknowledgement, got packet type %d`, packetType)
+	}
+	if body[1] != 0 {
+		return fmt.Errorf(`broker refused the connection with return code %d`, body[1])
+	}
+
+	const packetId = 1
+	publishFlags := byte(0x02) // QoS 1
+	if notifier.isRetain {
+		publishFlags |= 0x01
+	}
+	publish := appendMQTTString(nil, notifier.topic)
+	publish = binary.BigEndian.AppendUint16(publish, packetId)
+	if err := writeMQTTPacket(connection, mqttPublish<<4|publishFlags, append(publish, payload...)); err != nil {
+		return err
+	}
+	for {
+		packetType, body, err := readMQTTPacket(reader)
+		if err != nil {
+			return fmt.Errorf(`no acknowledgement of the message: %w`, err)
+		}
+		if packetType == mqttPubAck && len(body) == 2 && binary.BigEndian.Uint16(body) == packetId {
+			break
+		}
+	}
+	return writeMQTTPacket(connection, mqttDisconnect<<4, nil)
+}
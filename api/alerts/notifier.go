@@ -0,0 +1,186 @@
+package alerts
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/config"
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/metrics"
+)
+
+const notificationBacklog = 256
+
+// Notifier sends alert notifications through one transport.
+type Notifier interface {
+	Send(ctx context.Context, notification *Notification) error
+}
+
+// NotifierFactory builds a notifier from its configured settings.
+type NotifierFactory func(settings config.Notifier) (Notifier, error)
+
+var (
+	notifierFactoriesMutex sync.Mutex
+	notifierFactories      = map[string]NotifierFactory{
+		config.NotifierWebhook: newWebhookNotifier,
+		config.NotifierEmail:   newEmailNotifier,
+		config.NotifierSMS:     newSMSNotifier,
+		config.NotifierMQTT:    newMQTTNotifier,
+	}
+
+	pendingNotifications = make(chan *Notification, notificationBacklog)
+
+	// undelivered counts notifications queued but not yet sent through every
+	// notifier
+	undelivered sync.WaitGroup
+
+	notificationDroppedCounter = metrics.NewCounter("alert_notifications_dropped_total")
+	webhookDroppedCounter      = metrics.NewCounter("alert_webhooks_dropped_total")
+)
+
+// RegisterNotifier makes a kind of notifier configurable in
+// alerting.notifiers, so a site adds a transport of its own without
+// touching how alerts are evaluated. It replaces any factory of the kind.
+func RegisterNotifier(kind string, factory NotifierFactory) {
+	notifierFactoriesMutex.Lock()
+	defer notifierFactoriesMutex.Unlock()
+
+	notifierFactories[kind] = factory
+}
+
+// NotifierKinds lists the kinds of notifiers that can be configured.
+func NotifierKinds() []string {
+	notifierFactoriesMutex.Lock()
+	defer notifierFactoriesMutex.Unlock()
+
+	kinds := make([]string, 0, len(notifierFactories))
+	for kind := range notifierFactories {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+	return kinds
+}
+
+// configuredNotifier is a notifier built from the configuration, with what
+// to call it in logs and metrics.
+type configuredNotifier struct {
+	Notifier
+	name string
+	kind string
+}
+
+// buildNotifiers builds the webhooks, then the notifiers, of settings,
+// leaving out those that cannot be built alongside why.
+func buildNotifiers(settings config.Alerting) ([]*configuredNotifier, []error) {
+	notifiers := make([]*configuredNotifier, 0, len(settings.Webhooks)+len(settings.Notifiers))
+	problems := make([]error, 0)
+	for _, webhook := range settings.Webhooks {
+		notifiers = append(notifiers, &configuredNotifier{Notifier: &webhookNotifier{url: webhook.URL, headers: webhook.Headers}, name: webhook.URL, kind: config.NotifierWebhook})
+	}
+
+	notifierFactoriesMutex.Lock()
+	defer notifierFactoriesMutex.Unlock()
+	for notifierIndex, notifierSettings := range settings.Notifiers {
+		name := notifierSettings.Name
+		if name == "" {
+			name = fmt.Sprintf("%s #%d", notifierSettings.Kind, notifierIndex+1)
+		}
+		factory, isKnown := notifierFactories[notifierSettings.Kind]
+		if !isKnown {
+			problems = append(problems, fmt.Errorf(`alert notifier %s: unknown kind "%s"`, name, notifierSettings.Kind))
+			continue
+		}
+		notifier, err := factory(notifierSettings)
+		if err != nil {
+			problems = append(problems, fmt.Errorf(`alert notifier %s: %w`, name, err))
+			continue
+		}
+		notifiers = append(notifiers, &configuredNotifier{Notifier: notifier, name: name, kind: notifierSettings.Kind})
+	}
+	return notifiers, problems
+}
+
+// CheckNotifiers builds the notifiers of settings without sending anything,
+// and returns why those that cannot be built cannot.
+func CheckNotifiers(settings config.Alerting) []error {
+	_, problems := buildNotifiers(settings)
+	return problems
+}
+
+// notificationText words a notification for people, as the subject of a
+// mail or the whole of a text message.
+func notificationText(notification *Notification) string {
+	text := fmt.Sprintf("Alert %s %s: %s of %s is %g at %s", notification.RuleId, notification.State, notification.Metric, notification.HardwareId, notification.Value, notification.Time.UTC().Format(time.RFC3339))
+	if notification.Suppressed > 0 {
+		text += fmt.Sprintf(" (%d changes held back before it)", notification.Suppressed)
+	}
+	return text
+}
+
+// deliver queues a notification for the notifiers without waiting on them,
+// so a slow receiver never holds up evaluation.
+func deliver(notification *Notification) {
+	undelivered.Add(1)
+	select {
+	case pendingNotifications <- notification:
+	default:
+		undelivered.Done()
+		notificationDroppedCounter.Inc()
+		webhookDroppedCounter.Inc()
+	}
+}
+
+func sendNotifications(ctx context.Context, notifiers []*configuredNotifier, timeout time.Duration) {
+	for {
+		var notification *Notification
+		select {
+		case <-ctx.Done():
+			return
+		case notification = <-pendingNotifications:
+		}
+
+		send(ctx, notifiers, timeout, notification)
+		undelivered.Done()
+	}
+}
+
+// send hands a notification to every notifier in turn, each given timeout,
+// so one that hangs does not keep it from the others for long.
+func send(ctx context.Context, notifiers []*configuredNotifier, timeout time.Duration, notification *Notification) {
+	for _, notifier := range notifiers {
+		sendCtx, cancel := context.WithTimeout(ctx, timeout)
+		err := notifier.Send(sendCtx, notification)
+		cancel()
+		if err != nil {
+			metrics.NewCounter(`alert_notifications_failed_total{kind="` + notifier.kind + `"}`).Inc()
+			if notifier.kind == config.NotifierWebhook {
+				webhookFailedCounter.Inc()
+			}
+			log.Printf("alert notifier %s: %v\n", notifier.name, err)
+			continue
+		}
+		metrics.NewCounter(`alert_notifications_sent_total{kind="` + notifier.kind + `"}`).Inc()
+		if notifier.kind == config.NotifierWebhook {
+			webhookSentCounter.Inc()
+		}
+	}
+}
+
+// Drain waits until every queued notification has gone out, or ctx is done.
+func Drain(ctx context.Context) error {
+	drained := make(chan struct{})
+	go func() {
+		undelivered.Wait()
+		close(drained)
+	}()
+
+	select {
+	case <-drained:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf(`%d alert notifications left unsent: %w`, len(pendingNotifications), ctx.Err())
+	}
+}
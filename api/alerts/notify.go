@@ -0,0 +1,130 @@
+package alerts
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	StateFiring   = "firing"
+	StateResolved = "resolved"
+)
+
+type Notification struct {
+	RuleId     string    `json:"ruleId"`
+	HardwareId string    `json:"hardwareId"`
+	Metric     string    `json:"metric"`
+	State      string    `json:"state"`
+	Value      float64   `json:"value"`
+	Time       time.Time `json:"time"`
+
+	// Suppressed counts the notifications of the rule held back since the
+	// previous one was sent.
+	Suppressed int `json:"suppressed,omitempty"`
+}
+
+type sentNotification struct {
+	state      string
+	sentAt     time.Time
+	suppressed int
+}
+
+// Throttle sits between rule evaluation and whatever sends notifications. It
+// drops repeats of the state last sent for a rule, and holds back state
+// changes that come sooner than the rule's NotifyInterval, so that a flapping
+// sensor produces one message per interval instead of one per sample.
+// Evaluation is expected to keep offering the current state, so a held back
+// change goes out once the interval has passed.
+type Throttle struct {
+	mutex sync.Mutex
+	sent  map[string]*sentNotification
+}
+
+func NewThrottle() *Throttle {
+	return &Throttle{sent: make(map[string]*sentNotification)}
+}
+
+// Allow reports whether the notification should be sent now, filling in how
+// many were suppressed before it when it should.
+func (throttle *Throttle) Allow(rule *Rule, notification *Notification, now time.Time) bool {
+	throttle.mutex.Lock()
+	defer throttle.mutex.Unlock()
+
+	lastSent, hasSent := throttle.sent[rule.Id]
+	if !hasSent {
+		// Nothing was ever sent, so an initial resolution is not news either
+		if notification.State == StateResolved {
+			return false
+		}
+		throttle.sent[rule.Id] = &sentNotification{state: notification.State, sentAt: now}
+		return true
+	}
+
+	if notification.State == lastSent.state {
+		return false
+	}
+	if rule.NotifyInterval.Duration > 0 && now.Sub(lastSent.sentAt) < rule.NotifyInterval.Duration {
+		lastSent.suppressed++
+		return false
+	}
+
+	notification.Suppressed = lastSent.suppressed
+	throttle.sent[rule.Id] = &sentNotification{state: notification.State, sentAt: now}
+	return true
+}
+
+// Forget drops what was sent for rules that no longer exist.
+func (throttle *Throttle) Forget(currentRules []*Rule) {
+	throttle.mutex.Lock()
+	defer throttle.mutex.Unlock()
+
+	currentRuleIds := make(map[string]bool, len(currentRules))
+	for _, rule := range currentRules {
+		currentRuleIds[rule.Id] = true
+	}
+	for ruleId := range throttle.sent {
+		if !currentRuleIds[ruleId] {
+			delete(throttle.sent, ruleId)
+		}
+	}
+}
+
+// SimulateNotifications replays the firings of a preview through a fresh
+// throttle, showing which notifications the rule would actually have sent.
+func (rule *Rule) SimulateNotifications(firings []*Firing) []*Notification {
+	throttle := NewThrottle()
+	notifications := make([]*Notification, 0)
+	offer := func(state string, value float64, at time.Time) {
+		notification := &Notification{RuleId: rule.Id, HardwareId: rule.HardwareId, Metric: rule.Metric, State: state, Value: value, Time: at}
+		if throttle.Allow(rule, notification, at) {
+			notifications = append(notifications, notification)
+		}
+	}
+
+	// A change held back by the interval goes out once the interval has passed,
+	// provided the state still holds by then
+	currentState, currentValue := StateResolved, 0.0
+	catchUp := func(until time.Time) {
+		if len(notifications) == 0 {
+			return
+		}
+		lastNotification := notifications[len(notifications)-1]
+		if retryAt := lastNotification.Time.Add(rule.NotifyInterval.Duration); lastNotification.State != currentState && retryAt.Before(until) {
+			offer(currentState, currentValue, retryAt)
+		}
+	}
+
+	for _, firing := range firings {
+		catchUp(firing.From)
+		currentState, currentValue = StateFiring, firing.WorstValue
+		offer(currentState, currentValue, firing.From)
+
+		catchUp(firing.To)
+		currentState = StateResolved
+		offer(currentState, currentValue, firing.To)
+	}
+	if len(firings) > 0 {
+		catchUp(firings[len(firings)-1].To.Add(rule.NotifyInterval.Duration + 1))
+	}
+	return notifications
+}
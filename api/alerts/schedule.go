@@ -0,0 +1,167 @@
+package alerts
+
+import (
+	"context"
+	"hash/fnv"
+	"sort"
+	"time"
+
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/config"
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/hardware"
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/metrics"
+)
+
+// Evaluation is when a rule is evaluated: as readings arrive, with no
+// interval, or else every interval, last and next at the times given.
+type Evaluation struct {
+	RuleId     string          `json:"ruleId"`
+	HardwareId string          `json:"hardwareId"`
+	Metric     string          `json:"metric"`
+	Interval   config.Duration `json:"interval"`
+	LastAt     *time.Time      `json:"lastAt,omitempty"`
+	NextAt     *time.Time      `json:"nextAt,omitempty"`
+	Pending    bool            `json:"pending"`
+}
+
+var (
+	scheduledEvaluationCounter = metrics.NewCounter("alert_scheduled_evaluations_total")
+	skippedEvaluationCounter   = metrics.NewCounter("alert_scheduled_evaluations_skipped_total")
+)
+
+// evaluationSlot is the first time after after that a rule evaluated every
+// interval is due. Each rule is offset within its interval by a hash of its
+// id, so rules sharing an interval are spread across it rather than all
+// evaluated on the same tick, and keep their slots across restarts.
+func evaluationSlot(ruleId string, interval time.Duration, after time.Time) time.Time {
+	hash := fnv.New64a()
+	hash.Write([]byte(ruleId))
+	offset := time.Duration(hash.Sum64() % uint64(interval))
+
+	slot := after.Truncate(interval).Add(offset)
+	if !slot.After(after) {
+		slot = slot.Add(interval)
+	}
+	return slot
+}
+
+// reschedule picks up the evaluation interval of the rule, which may have
+// changed with the configuration. The caller holds engineMutex.
+func (state *ruleState) reschedule(now time.Time) {
+	interval := state.rule.EffectiveEvaluationInterval()
+	if interval == state.interval && (interval == 0 || !state.nextEvaluation.IsZero()) {
+		return
+	}
+	state.interval = interval
+	if interval > 0 {
+		state.nextEvaluation = evaluationSlot(state.rule.Id, interval, now)
+		return
+	}
+	// Readings held back for the schedule are not seen again as they arrive
+	state.nextEvaluation = time.Time{}
+	if state.pending {
+		state.evaluatePending(now)
+	}
+}
+
+// evaluatePending evaluates the readings that arrived since a scheduled
+// rule was last evaluated. The caller holds engineMutex.
+func (state *ruleState) evaluatePending(now time.Time) {
+	state.pending = false
+	state.lastEvaluation = &now
+	scheduledEvaluationCounter.Inc()
+
+	samples, err := hardware.SamplesBetween(state.rule.HardwareId, state.evaluatedUntil.Add(time.Millisecond), endOfTime)
+	if err != nil {
+		return
+	}
+	state.evaluate(samples, true)
+}
+
+// evaluateDue evaluates the scheduled rules whose slot has come, skipping
+// those no readings arrived for.
+func evaluateDue(now time.Time) {
+	engineMutex.Lock()
+	defer engineMutex.Unlock()
+
+	evaluateQueuedChanges()
+
+	for _, state := range ruleStates {
+		if state.interval <= 0 || now.Before(state.nextEvaluation) {
+			continue
+		}
+		state.nextEvaluation = evaluationSlot(state.rule.Id, state.interval, now)
+		if !state.pending {
+			skippedEvaluationCounter.Inc()
+			continue
+		}
+		state.evaluatePending(now)
+	}
+}
+
+func runSchedule(ctx context.Context, tick time.Duration) {
+	if tick <= 0 {
+		tick = config.Default().Alerting.SchedulerTick.Duration
+	}
+	ticker := time.NewTicker(tick)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			evaluateDue(now)
+		}
+	}
+}
+
+// EvaluatePending evaluates every scheduled rule readings arrived for right
+// away, without waiting for its slot, which stays as it was.
+func EvaluatePending() {
+	engineMutex.Lock()
+	defer engineMutex.Unlock()
+
+	evaluateQueuedChanges()
+
+	now := time.Now()
+	for _, state := range ruleStates {
+		if state.interval > 0 && state.pending {
+			state.evaluatePending(now)
+		}
+	}
+}
+
+// Schedule returns when each rule is evaluated, the scheduled ones first in
+// the order they are next due, then those evaluated as readings arrive.
+func Schedule() []*Evaluation {
+	engineMutex.Lock()
+	defer engineMutex.Unlock()
+
+	evaluateQueuedChanges()
+
+	evaluations := make([]*Evaluation, 0, len(ruleStates))
+	for _, state := range ruleStates {
+		evaluation := &Evaluation{RuleId: state.rule.Id, HardwareId: state.rule.HardwareId, Metric: state.rule.Metric, Interval: config.Duration{Duration: state.interval}, Pending: state.pending}
+		if state.lastEvaluation != nil {
+			lastAt := *state.lastEvaluation
+			evaluation.LastAt = &lastAt
+		}
+		if state.interval > 0 {
+			nextAt := state.nextEvaluation
+			evaluation.NextAt = &nextAt
+		}
+		evaluations = append(evaluations, evaluation)
+	}
+	sort.Slice(evaluations, func(leftIndex, rightIndex int) bool {
+		left, right := evaluations[leftIndex], evaluations[rightIndex]
+		switch {
+		case (left.NextAt == nil) != (right.NextAt == nil):
+			return left.NextAt != nil
+		case left.NextAt != nil && !left.NextAt.Equal(*right.NextAt):
+			return left.NextAt.Before(*right.NextAt)
+		default:
+			return left.RuleId < right.RuleId
+		}
+	})
+	return evaluations
+}
@@ -0,0 +1,81 @@
+package alerts
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/config"
+)
+
+// smsNotifier asks an HTTP gateway to text each number, one request per
+// number. Gateways differ in what they expect, so the options name the
+// fields of the number and the message, "to" and "message" by default, and
+// whether they are posted as "json", the default, or as a "form".
+type smsNotifier struct {
+	url          string
+	headers      map[string]string
+	numbers      []string
+	toField      string
+	messageField string
+	isForm       bool
+}
+
+func newSMSNotifier(settings config.Notifier) (Notifier, error) {
+	notifier := &smsNotifier{url: settings.URL, headers: settings.Headers, numbers: settings.To, toField: "to", messageField: "message"}
+	if settings.URL == "" || len(settings.To) == 0 {
+		return nil, fmt.Errorf(`an SMS gateway needs a url and numbers to text`)
+	}
+	if toField := settings.Options["toField"]; toField != "" {
+		notifier.toField = toField
+	}
+	if messageField := settings.Options["messageField"]; messageField != "" {
+		notifier.messageField = messageField
+	}
+	switch format := settings.Options["format"]; format {
+	case "", "json":
+	case "form":
+		notifier.isForm = true
+	default:
+		return nil, fmt.Errorf(`unknown SMS gateway format "%s", must be "json" or "form"`, format)
+	}
+	return notifier, nil
+}
+
+func (notifier *smsNotifier) Send(ctx context.Context, notification *Notification) error {
+	message := notificationText(notification)
+	failures := make([]string, 0)
+	for _, number := range notifier.numbers {
+		if err := notifier.text(ctx, number, message); err != nil {
+			failures = append(failures, fmt.Sprintf(`%s: %v`, number, err))
+		}
+	}
+	if len(failures) > 0 {
+		return fmt.Errorf(`unable to text %s`, strings.Join(failures, "; "))
+	}
+	return nil
+}
+
+func (notifier *smsNotifier) text(ctx context.Context, number string, message string) error {
+	if !notifier.isForm {
+		bodyBytes, err := json.Marshal(map[string]string{notifier.toField: number, notifier.messageField: message})
+		if err != nil {
+			return err
+		}
+		return postJSON(ctx, notifier.url, notifier.headers, bodyBytes)
+	}
+
+	form := url.Values{notifier.toField: {number}, notifier.messageField: {message}}
+	request, err := http.NewRequestWithContext(ctx, "POST", notifier.url, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	for name, value := range notifier.headers {
+		request.Header.Set(name, value)
+	}
+	return doRequest(request)
+}
@@ -0,0 +1,65 @@
+package alerts
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/config"
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/metrics"
+)
+
+var (
+	webhookClient = &http.Client{}
+
+	webhookSentCounter   = metrics.NewCounter("alert_webhooks_sent_total")
+	webhookFailedCounter = metrics.NewCounter("alert_webhooks_failed_total")
+)
+
+// webhookNotifier posts notifications as JSON.
+type webhookNotifier struct {
+	url     string
+	headers map[string]string
+}
+
+func newWebhookNotifier(settings config.Notifier) (Notifier, error) {
+	if settings.URL == "" {
+		return nil, fmt.Errorf(`a webhook needs a url`)
+	}
+	return &webhookNotifier{url: settings.URL, headers: settings.Headers}, nil
+}
+
+func (notifier *webhookNotifier) Send(ctx context.Context, notification *Notification) error {
+	notificationBytes, err := json.Marshal(notification)
+	if err != nil {
+		return err
+	}
+	return postJSON(ctx, notifier.url, notifier.headers, notificationBytes)
+}
+
+func postJSON(ctx context.Context, url string, headers map[string]string, bodyBytes []byte) error {
+	request, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(bodyBytes))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	for name, value := range headers {
+		request.Header.Set(name, value)
+	}
+	return doRequest(request)
+}
+
+func doRequest(request *http.Request) error {
+	response, err := webhookClient.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		return fmt.Errorf(`%s answered %s`, request.URL.Host, response.Status)
+	}
+	return nil
+}
@@ -0,0 +1,134 @@
+package alerts
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The rule documents are a deliberately small YAML subset: a top-level "rules"
+// key holding a list of flat mappings with scalar values.
+
+func ExportYAML(writer io.Writer) error {
+	bufferedWriter := bufio.NewWriter(writer)
+	fmt.Fprintln(bufferedWriter, "rules:")
+	for _, rule := range Rules() {
+		fmt.Fprintf(bufferedWriter, "  - id: %s\n", strconv.Quote(rule.Id))
+		fmt.Fprintf(bufferedWriter, "    hardwareId: %s\n", strconv.Quote(rule.HardwareId))
+		fmt.Fprintf(bufferedWriter, "    metric: %s\n", strconv.Quote(rule.Metric))
+		fmt.Fprintf(bufferedWriter, "    comparison: %s\n", strconv.Quote(rule.Comparison))
+		fmt.Fprintf(bufferedWriter, "    threshold: %s\n", strconv.FormatFloat(rule.Threshold, 'g', -1, 64))
+		if rule.ISO10816 != "" {
+			fmt.Fprintf(bufferedWriter, "    iso10816: %s\n", strconv.Quote(rule.ISO10816))
+		}
+		if rule.NotifyInterval.Duration > 0 {
+			fmt.Fprintf(bufferedWriter, "    notifyInterval: %s\n", strconv.Quote(rule.NotifyInterval.String()))
+		}
+		if rule.EvaluationInterval.Duration > 0 {
+			fmt.Fprintf(bufferedWriter, "    evaluationInterval: %s\n", strconv.Quote(rule.EvaluationInterval.String()))
+		}
+	}
+	return bufferedWriter.Flush()
+}
+
+func parseYAMLScalar(text string) (string, error) {
+	text = strings.TrimSpace(text)
+	switch {
+	case strings.HasPrefix(text, `"`):
+		return strconv.Unquote(text)
+	case strings.HasPrefix(text, `'`) && strings.HasSuffix(text, `'`) && len(text) >= 2:
+		return strings.ReplaceAll(text[1:len(text)-1], `''`, `'`), nil
+	default:
+		if commentIndex := strings.Index(text, " #"); commentIndex >= 0 {
+			text = strings.TrimSpace(text[:commentIndex])
+		}
+		return text, nil
+	}
+}
+
+func ImportYAML(reader io.Reader) ([]*Rule, error) {
+	importedRules := make([]*Rule, 0)
+	var currentRule *Rule
+	inRules := false
+
+	scanner := bufio.NewScanner(reader)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := scanner.Text()
+		trimmedLine := strings.TrimSpace(line)
+		if trimmedLine == "" || strings.HasPrefix(trimmedLine, "#") || trimmedLine == "---" {
+			continue
+		}
+
+		if !strings.HasPrefix(line, " ") && !strings.HasPrefix(line, "-") {
+			inRules = strings.TrimSpace(strings.TrimSuffix(trimmedLine, ":")) == "rules" && strings.HasSuffix(trimmedLine, ":")
+			if !inRules {
+				return nil, fmt.Errorf(`line %d: unknown section "%s"`, lineNumber, trimmedLine)
+			}
+			continue
+		}
+		if !inRules {
+			return nil, fmt.Errorf(`line %d: rule outside of "rules" section`, lineNumber)
+		}
+
+		if strings.HasPrefix(trimmedLine, "- ") || trimmedLine == "-" {
+			currentRule = &Rule{}
+			importedRules = append(importedRules, currentRule)
+			trimmedLine = strings.TrimSpace(strings.TrimPrefix(trimmedLine, "-"))
+			if trimmedLine == "" {
+				continue
+			}
+		}
+		if currentRule == nil {
+			return nil, fmt.Errorf(`line %d: expected a "-" list item`, lineNumber)
+		}
+
+		key, rawValue, hasSeparator := strings.Cut(trimmedLine, ":")
+		if !hasSeparator {
+			return nil, fmt.Errorf(`line %d: expected "key: value"`, lineNumber)
+		}
+		value, err := parseYAMLScalar(rawValue)
+		if err != nil {
+			return nil, fmt.Errorf(`line %d: %w`, lineNumber, err)
+		}
+
+		switch strings.TrimSpace(key) {
+		case "id":
+			currentRule.Id = value
+		case "hardwareId":
+			currentRule.HardwareId = value
+		case "metric":
+			currentRule.Metric = value
+		case "comparison":
+			currentRule.Comparison = value
+		case "threshold":
+			threshold, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return nil, fmt.Errorf(`line %d: cannot convert threshold "%s": %w`, lineNumber, value, err)
+			}
+			currentRule.Threshold = threshold
+		case "iso10816":
+			currentRule.ISO10816 = value
+		case "notifyInterval":
+			notifyInterval, err := time.ParseDuration(value)
+			if err != nil {
+				return nil, fmt.Errorf(`line %d: cannot convert notification interval "%s": %w`, lineNumber, value, err)
+			}
+			currentRule.NotifyInterval.Duration = notifyInterval
+		case "evaluationInterval":
+			evaluationInterval, err := time.ParseDuration(value)
+			if err != nil {
+				return nil, fmt.Errorf(`line %d: cannot convert evaluation interval "%s": %w`, lineNumber, value, err)
+			}
+			currentRule.EvaluationInterval.Duration = evaluationInterval
+		default:
+			return nil, fmt.Errorf(`line %d: unknown rule field "%s"`, lineNumber, strings.TrimSpace(key))
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return importedRules, nil
+}
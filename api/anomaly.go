@@ -0,0 +1,100 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/anomaly"
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/config"
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/hardware"
+)
+
+// anomalyWindow is how far back from the latest sample anomalies are scored
+// when no window is asked for.
+const anomalyWindow = 6 * time.Hour
+
+// AnomalyPoint is the machine score at one sample, without the channels.
+type AnomalyPoint struct {
+	Time      time.Time `json:"time"`
+	Score     float64   `json:"score"`
+	Anomalous bool      `json:"anomalous"`
+	Votes     int       `json:"votes"`
+}
+
+type AnomalyResponseData struct {
+	Id               string          `json:"id"`
+	From             time.Time       `json:"from"`
+	To               time.Time       `json:"to"`
+	Voting           string          `json:"voting"`
+	ChannelThreshold float64         `json:"channelThreshold"`
+	Latest           *anomaly.Score  `json:"latest"`
+	Points           []*AnomalyPoint `json:"points"`
+}
+
+// handleAnomaly scores a window of a hardware, by default the last hours up
+// to its latest sample, returning the machine score at each sample and the
+// channels behind the last one.
+func handleAnomaly(response http.ResponseWriter, request *http.Request, hardwareId string) {
+	if request.Method != "GET" {
+		response.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if !hardware.HasSamples(hardwareId) {
+		response.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	query := request.URL.Query()
+	var from, to time.Time
+	if query.Get("from") != "" || query.Get("to") != "" {
+		var err error
+		if from, err = time.Parse(time.RFC3339, query.Get("from")); err != nil {
+			response.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if to, err = time.Parse(time.RFC3339, query.Get("to")); err != nil || !to.After(from) {
+			response.WriteHeader(http.StatusBadRequest)
+			return
+		}
+	} else {
+		latestValues, err := hardware.LatestValues(hardwareId)
+		if err != nil {
+			response.WriteHeader(errorStatus(err, http.StatusInternalServerError))
+			return
+		}
+		for _, latestValue := range latestValues {
+			if latestValue.Time.After(to) {
+				to = latestValue.Time
+			}
+		}
+		if to.IsZero() {
+			response.WriteHeader(errorStatus(hardware.ErrNoData, http.StatusInternalServerError))
+			return
+		}
+		from = to.Add(-anomalyWindow)
+	}
+
+	scores, err := anomaly.Between(hardwareId, from, to)
+	if err != nil {
+		response.WriteHeader(errorStatus(err, http.StatusInternalServerError))
+		return
+	}
+
+	responseData := &AnomalyResponseData{Id: hardwareId, From: from, To: to, Voting: config.Current.Anomaly.Voting, ChannelThreshold: config.Current.Anomaly.ChannelThreshold, Points: make([]*AnomalyPoint, 0, len(scores))}
+	for _, score := range scores {
+		responseData.Points = append(responseData.Points, &AnomalyPoint{Time: score.Time, Score: score.Score, Anomalous: score.Anomalous, Votes: score.Votes})
+	}
+	if len(scores) > 0 {
+		responseData.Latest = scores[len(scores)-1]
+	}
+
+	responseBytes, err := json.Marshal(responseData)
+	if err != nil {
+		response.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	response.WriteHeader(http.StatusOK)
+	response.Write(responseBytes)
+}
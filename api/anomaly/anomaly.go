@@ -0,0 +1,187 @@
+// Package anomaly scores how far each channel of a hardware strays from its
+// own recent readings, and combines the channels by weight and vote into one
+// machine score that alert rules can judge like a metric.
+package anomaly
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/config"
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/hardware"
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/statistics"
+)
+
+// MetricScore is what alert rules name the machine score as their metric.
+const MetricScore = "anomalyScore"
+
+const (
+	// The median absolute deviation of normal readings, times madScale,
+	// estimates their standard deviation. Without any deviation, the mean
+	// absolute deviation, times meanDeviationScale, stands in.
+	madScale           = 1.4826
+	meanDeviationScale = 1.2533
+)
+
+// ChannelScore is how far the latest reading of a channel lies from the
+// median of its baseline, in robust standard deviations, up to the cap.
+type ChannelScore struct {
+	Metric string    `json:"metric"`
+	Time   time.Time `json:"time"`
+	Value  float64   `json:"value"`
+	Median float64   `json:"median"`
+	Score  float64   `json:"score"`
+	Weight float64   `json:"weight"`
+	Votes  bool      `json:"votes"`
+}
+
+// Score is the machine score at a sample, from the latest score of each
+// channel. Mean is their weighted mean, which Score keeps only once the vote
+// carries, and Votes the number of channels voting anomalous.
+type Score struct {
+	Time      time.Time       `json:"time"`
+	Score     float64         `json:"score"`
+	Mean      float64         `json:"mean"`
+	Anomalous bool            `json:"anomalous"`
+	Votes     int             `json:"votes"`
+	Channels  []*ChannelScore `json:"channels,omitempty"`
+}
+
+// Scorer scores the samples of one hardware one after the other, keeping the
+// baseline of each channel as it goes.
+type Scorer struct {
+	settings  config.Anomaly
+	weights   map[string]float64
+	baselines map[string][]float64
+	latest    map[string]*ChannelScore
+}
+
+// NewScorer starts scoring a hardware with the weights configured for it.
+func NewScorer(hardwareId string) *Scorer {
+	scorer := &Scorer{settings: config.Current.Anomaly, weights: make(map[string]float64), baselines: make(map[string][]float64), latest: make(map[string]*ChannelScore)}
+	for _, metric := range hardware.Metrics() {
+		if weight := config.Current.WeightOf(hardwareId, metric); weight > 0 {
+			scorer.weights[metric] = weight
+		}
+	}
+	return scorer
+}
+
+// robustScore is how many robust standard deviations value lies from the
+// median of baseline.
+func robustScore(baseline []float64, value float64) (float64, float64) {
+	sorted := append([]float64(nil), baseline...)
+	sort.Float64s(sorted)
+	median := medianOf(sorted)
+
+	deviations := make([]float64, len(sorted))
+	meanDeviation := 0.0
+	for valueIndex, baselineValue := range sorted {
+		deviations[valueIndex] = math.Abs(baselineValue - median)
+		meanDeviation += deviations[valueIndex] / float64(len(sorted))
+	}
+	sort.Float64s(deviations)
+
+	scale := madScale * medianOf(deviations)
+	if scale == 0 {
+		scale = meanDeviationScale * meanDeviation
+	}
+	distance := math.Abs(value - median)
+	switch {
+	case distance == 0:
+		return 0, median
+	case scale == 0:
+		return math.Inf(1), median
+	}
+	return distance / scale, median
+}
+
+func medianOf(sorted []float64) float64 {
+	middle := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return (sorted[middle-1] + sorted[middle]) / 2
+	}
+	return sorted[middle]
+}
+
+// Next scores the channels a sample holds readings of, then the machine. It
+// returns false when the sample gave no channel a new score, such as while
+// their baselines fill.
+func (scorer *Scorer) Next(sample *hardware.Sample) (*Score, bool) {
+	isScored := false
+	for metric, weight := range scorer.weights {
+		value, _ := sample.ValueByMetric(metric)
+		if value == nil || !statistics.IsFinite(*value) {
+			continue
+		}
+
+		baseline := scorer.baselines[metric]
+		if len(baseline) >= scorer.settings.MinimumBaseline {
+			score, median := robustScore(baseline, *value)
+			score = math.Min(score, scorer.settings.ScoreCap)
+			scorer.latest[metric] = &ChannelScore{Metric: metric, Time: sample.Time, Value: *value, Median: median, Score: score, Weight: weight, Votes: score >= scorer.settings.ChannelThreshold}
+			isScored = true
+		}
+		if len(baseline) >= scorer.settings.BaselineSamples {
+			baseline = baseline[1:]
+		}
+		scorer.baselines[metric] = append(baseline, *value)
+	}
+	if !isScored {
+		return nil, false
+	}
+	return scorer.combine(sample.Time), true
+}
+
+// combine weighs and votes the latest score of each channel.
+func (scorer *Scorer) combine(at time.Time) *Score {
+	machineScore := &Score{Time: at, Channels: make([]*ChannelScore, 0, len(scorer.latest))}
+	totalWeight, votingWeight := 0.0, 0.0
+	for _, channelScore := range scorer.latest {
+		machineScore.Channels = append(machineScore.Channels, channelScore)
+		totalWeight += channelScore.Weight
+		machineScore.Mean += channelScore.Weight * channelScore.Score
+		if channelScore.Votes {
+			votingWeight += channelScore.Weight
+			machineScore.Votes++
+		}
+	}
+	machineScore.Mean /= totalWeight
+	sort.Slice(machineScore.Channels, func(leftIndex, rightIndex int) bool {
+		return machineScore.Channels[leftIndex].Metric < machineScore.Channels[rightIndex].Metric
+	})
+
+	switch scorer.settings.Voting {
+	case config.VotingMajority:
+		machineScore.Anomalous = 2*votingWeight > totalWeight
+	case config.VotingQuorum:
+		machineScore.Anomalous = machineScore.Votes >= scorer.settings.Quorum
+	default:
+		machineScore.Anomalous = machineScore.Mean >= scorer.settings.ChannelThreshold
+		machineScore.Score = machineScore.Mean
+		return machineScore
+	}
+	if machineScore.Anomalous {
+		machineScore.Score = machineScore.Mean
+	}
+	return machineScore
+}
+
+// Between scores the samples of a hardware from from to to, after warming
+// the baselines up over those before.
+func Between(hardwareId string, from time.Time, to time.Time) ([]*Score, error) {
+	samples, err := hardware.SamplesBetween(hardwareId, from.Add(-config.Current.Anomaly.Warmup.Duration), to)
+	if err != nil {
+		return nil, err
+	}
+
+	scorer := NewScorer(hardwareId)
+	scores := make([]*Score, 0)
+	for _, sample := range samples {
+		if score, isScored := scorer.Next(sample); isScored && !sample.Time.Before(from) {
+			scores = append(scores, score)
+		}
+	}
+	return scores, nil
+}
@@ -0,0 +1,41 @@
+package anomaly
+
+import (
+	"testing"
+	"time"
+
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/config"
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/hardware"
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/internal/fixtures"
+)
+
+func TestMain(m *testing.M) {
+	fixtures.Main(m.Run)
+}
+
+func TestQuorumVoting(t *testing.T) {
+	// A single flaky channel should not outvote the quorum of two
+	previousAnomaly := config.Current.Anomaly
+	defer func() { config.Current.Anomaly = previousAnomaly }()
+	config.Current.Anomaly = config.Default().Anomaly
+	config.Current.Anomaly.Voting = config.VotingQuorum
+
+	scorer := NewScorer(fixtures.HardwareId)
+	sampleAt := func(second int, temperature float64, velocity float64) *hardware.Sample {
+		sample := &hardware.Sample{Time: time.Unix(int64(second), 0)}
+		sample.SetValueByMetric("temperature", &temperature)
+		sample.SetValueByMetric("rmsVelocityX", &velocity)
+		return sample
+	}
+	for second := 0; second < config.Current.Anomaly.MinimumBaseline; second++ {
+		if _, isScored := scorer.Next(sampleAt(second, 40+float64(second%3), 1+float64(second%2)/10)); isScored {
+			t.Fatalf(`scored before the baseline filled`)
+		}
+	}
+	if score, _ := scorer.Next(sampleAt(100, 41, 9)); score == nil || score.Anomalous || score.Votes != 1 || score.Score != 0 {
+		t.Errorf(`expected one channel alone to be outvoted, got %+v`, score)
+	}
+	if score, _ := scorer.Next(sampleAt(101, 90, 9)); score == nil || !score.Anomalous || score.Votes != 2 || score.Score < config.Current.Anomaly.ChannelThreshold {
+		t.Errorf(`expected two channels together to carry the vote, got %+v`, score)
+	}
+}
@@ -0,0 +1,71 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/hardware"
+)
+
+type ArrivalLagResponseData struct {
+	Hardware []*hardware.ArrivalLag `json:"hardware"`
+}
+
+// handleArrivalLag serves how long after their sensor timestamps the live
+// readings of a hardware arrived, per window of arrival time, as a heatmap.
+func handleArrivalLag(response http.ResponseWriter, request *http.Request, hardwareId string) {
+	if request.Method != "GET" {
+		response.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if !hardware.HasSamples(hardwareId) {
+		response.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	responseBytes, err := json.Marshal(hardware.ArrivalLagOf(hardwareId, true))
+	if err != nil {
+		response.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	response.WriteHeader(http.StatusOK)
+	response.Write(responseBytes)
+}
+
+// handleFleetArrivalLag lists the lag distribution of every hardware live
+// readings arrived for, the most lagging at the 90th percentile first, so
+// gateways that buffer or lose connectivity stand out.
+func handleFleetArrivalLag(response http.ResponseWriter, request *http.Request) {
+	if request.Method != "GET" {
+		response.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	limit, err := queryInt(request.URL.Query(), "limit", 100, 1, 10000)
+	if err != nil {
+		response.WriteHeader(http.StatusBadRequest)
+		response.Write([]byte(err.Error()))
+		return
+	}
+
+	responseData := ArrivalLagResponseData{Hardware: make([]*hardware.ArrivalLag, 0)}
+	for _, hardwareId := range hardware.ArrivalLagHardwareIds() {
+		responseData.Hardware = append(responseData.Hardware, hardware.ArrivalLagOf(hardwareId, false))
+	}
+	sort.SliceStable(responseData.Hardware, func(leftIndex, rightIndex int) bool {
+		return responseData.Hardware[leftIndex].P90Seconds > responseData.Hardware[rightIndex].P90Seconds
+	})
+	if len(responseData.Hardware) > limit {
+		responseData.Hardware = responseData.Hardware[:limit]
+	}
+
+	responseBytes, err := json.Marshal(responseData)
+	if err != nil {
+		response.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	response.WriteHeader(http.StatusOK)
+	response.Write(responseBytes)
+}
@@ -0,0 +1,101 @@
+package api
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/config"
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/internal/audit"
+)
+
+func formatOptionalTime(at *time.Time) string {
+	if at == nil {
+		return ""
+	}
+	return at.UTC().Format(time.RFC3339)
+}
+
+// handleAuditReport reports who accessed which hardware over which window,
+// between the optional from and to, for one client and one hardware when
+// given. JSON sums the accesses up per client and hardware alongside the
+// entries; CSV lists the entries for compliance records, and is refused
+// rather than served without saying when the audit file was tampered with.
+func handleAuditReport(response http.ResponseWriter, request *http.Request) {
+	if request.Method != "GET" {
+		response.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if config.Current.Audit.Path == "" {
+		response.WriteHeader(http.StatusNotFound)
+		response.Write([]byte(`auditing is off; set audit.path to turn it on`))
+		return
+	}
+
+	query := request.URL.Query()
+	filter := audit.Filter{Client: query.Get("client"), HardwareId: query.Get("hardwareId")}
+	for name, bound := range map[string]*time.Time{"from": &filter.From, "to": &filter.To} {
+		if query.Get(name) == "" {
+			continue
+		}
+		parsed, err := time.Parse(time.RFC3339, query.Get(name))
+		if err != nil {
+			response.WriteHeader(http.StatusBadRequest)
+			response.Write([]byte(fmt.Sprintf(`%s must be an RFC 3339 time, got "%s"`, name, query.Get(name))))
+			return
+		}
+		*bound = parsed
+	}
+
+	report, err := audit.BuildReport(filter)
+	if err != nil {
+		response.WriteHeader(http.StatusInternalServerError)
+		response.Write([]byte(err.Error()))
+		return
+	}
+
+	switch format := query.Get("format"); format {
+	case "", "json":
+		responseBytes, err := json.Marshal(report)
+		if err != nil {
+			response.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		response.WriteHeader(http.StatusOK)
+		response.Write(responseBytes)
+	case "csv":
+		if !report.Intact {
+			response.WriteHeader(http.StatusConflict)
+			response.Write([]byte(`the audit log was tampered with: ` + strings.Join(report.Problems, "; ")))
+			return
+		}
+		response.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		response.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="audit_%s.csv"`, time.Now().UTC().Format("20060102T150405Z")))
+		response.WriteHeader(http.StatusOK)
+
+		writer := csv.NewWriter(response)
+		writer.Write([]string{"time", "client", "method", "route", "hardware", "from", "to", "status", "hash"})
+		for _, entry := range report.Entries {
+			writer.Write([]string{
+				entry.Time.UTC().Format(time.RFC3339Nano),
+				entry.Client,
+				entry.Method,
+				entry.Route,
+				strings.Join(entry.HardwareIds, " "),
+				formatOptionalTime(entry.From),
+				formatOptionalTime(entry.To),
+				strconv.Itoa(entry.Status),
+				entry.Hash,
+			})
+		}
+		writer.Flush()
+	default:
+		response.WriteHeader(http.StatusBadRequest)
+		response.Write([]byte(fmt.Sprintf(`unknown report format "%s", must be "json" or "csv"`, format)))
+	}
+}
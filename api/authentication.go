@@ -0,0 +1,75 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/config"
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/internal/auth"
+)
+
+// requiredRole is the role a request needs: admin for the admin routes,
+// operator for those that change samples, alert rules or the ordering of
+// hardware, viewer for the rest.
+func requiredRole(request *http.Request) string {
+	path := request.URL.Path
+	switch {
+	case strings.HasPrefix(path, "/api/admin/"):
+		return config.RoleAdmin
+	case path == "/api/ingest",
+		path == "/api/alerts/rules.yaml" && request.Method != "GET",
+		strings.HasPrefix(path, "/api/hardware/") && strings.HasSuffix(path, "/samples"),
+		strings.HasPrefix(path, "/api/hardware/") && strings.HasSuffix(path, "/ordering") && request.Method != "GET":
+		return config.RoleOperator
+	default:
+		return config.RoleViewer
+	}
+}
+
+// challenge asks clients without credentials to send some.
+func challenge(response http.ResponseWriter, err error) {
+	if config.Current.Authentication.OIDC.Issuer != "" {
+		if errors.Is(err, auth.ErrInvalidToken) {
+			response.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+		} else {
+			response.Header().Set("WWW-Authenticate", `Bearer`)
+		}
+	}
+	response.WriteHeader(http.StatusUnauthorized)
+}
+
+// refuseAuthentication answers a request whose credentials were refused.
+func refuseAuthentication(response http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, auth.ErrIssuerUnavailable):
+		response.WriteHeader(http.StatusServiceUnavailable)
+	case errors.Is(err, auth.ErrReadOnlyRoute), errors.Is(err, auth.ErrSignedRoute):
+		response.WriteHeader(http.StatusForbidden)
+	case errors.Is(err, auth.ErrSignedBodyTooLarge):
+		response.WriteHeader(http.StatusRequestEntityTooLarge)
+	default:
+		challenge(response, err)
+	}
+	response.Write([]byte(err.Error()))
+}
+
+// authorize lets a request through when the identity it was made with is
+// granted the role it needs, answering it otherwise: anonymous requests with
+// a challenge, the others with a 403.
+func authorize(response http.ResponseWriter, request *http.Request) bool {
+	role := requiredRole(request)
+	identity := auth.IdentityOf(request)
+	if auth.Allows(identity, role) {
+		return true
+	}
+	if identity == nil {
+		challenge(response, nil)
+		response.Write([]byte(fmt.Sprintf(`authentication required for role "%s"`, role)))
+		return false
+	}
+	response.WriteHeader(http.StatusForbidden)
+	response.Write([]byte(fmt.Sprintf(`role "%s" required`, role)))
+	return false
+}
@@ -0,0 +1,203 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/config"
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/metrics"
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/internal/audit"
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/internal/querylog"
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/internal/usage"
+)
+
+// BatchRequestItem is one sub-request, such as a tabulation, an aggregate or
+// a panel of statistics. A body given as a JSON string is sent as that
+// string, so CSV can be ingested too; any other body is sent as JSON.
+type BatchRequestItem struct {
+	Id          string          `json:"id,omitempty"`
+	Method      string          `json:"method"`
+	Path        string          `json:"path"`
+	ContentType string          `json:"contentType,omitempty"`
+	Body        json.RawMessage `json:"body,omitempty"`
+}
+
+// BatchResponseItem is the response to the sub-request at the same position.
+// A body that is not JSON is given as a string.
+type BatchResponseItem struct {
+	Id     string          `json:"id,omitempty"`
+	Status int             `json:"status"`
+	Body   json.RawMessage `json:"body,omitempty"`
+}
+
+// batchResponseWriter keeps what a handler writes for one sub-request.
+type batchResponseWriter struct {
+	header     http.Header
+	statusCode int
+	body       bytes.Buffer
+}
+
+func (writer *batchResponseWriter) Header() http.Header {
+	return writer.header
+}
+
+func (writer *batchResponseWriter) WriteHeader(statusCode int) {
+	if writer.statusCode == 0 {
+		writer.statusCode = statusCode
+	}
+}
+
+func (writer *batchResponseWriter) Write(data []byte) (int, error) {
+	if writer.statusCode == 0 {
+		writer.statusCode = http.StatusOK
+	}
+	return writer.body.Write(data)
+}
+
+// subRequest builds the request a batch item stands for, carrying the
+// headers of the batch, such as the API key, along.
+func (item *BatchRequestItem) subRequest(batchRequest *http.Request) (*http.Request, error) {
+	if item.Method == "" {
+		item.Method = "GET"
+	}
+	path, err := url.Parse(item.Path)
+	if err != nil || !strings.HasPrefix(path.Path, "/api/") || path.Host != "" {
+		return nil, fmt.Errorf(`path "%s" is not an API path`, item.Path)
+	}
+	switch {
+	case path.Path == "/api/batch":
+		return nil, fmt.Errorf(`batches cannot be nested`)
+	case strings.HasPrefix(path.Path, "/api/hardware/") && strings.HasSuffix(path.Path, "/stream"):
+		return nil, fmt.Errorf(`streams cannot be batched`)
+	}
+
+	var body []byte
+	var bodyString string
+	if len(item.Body) > 0 {
+		if err := json.Unmarshal(item.Body, &bodyString); err == nil {
+			body = []byte(bodyString)
+		} else {
+			body = item.Body
+			if item.ContentType == "" {
+				item.ContentType = "application/json"
+			}
+		}
+	}
+
+	subRequest, err := http.NewRequestWithContext(batchRequest.Context(), item.Method, path.RequestURI(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	subRequest.RemoteAddr = batchRequest.RemoteAddr
+	subRequest.Header = batchRequest.Header.Clone()
+	subRequest.Header.Del("Content-Length")
+	subRequest.Header.Del("Content-Type")
+	if item.ContentType != "" {
+		subRequest.Header.Set("Content-Type", item.ContentType)
+	}
+	return subRequest, nil
+}
+
+// serveBatchItem routes one sub-request as if it came in by itself, turning a
+// panic into a 500 for that item alone.
+func serveBatchItem(subRequest *http.Request) *BatchResponseItem {
+	writer := &batchResponseWriter{header: make(http.Header)}
+	capturingBody := &querylog.CapturingReadCloser{ReadCloser: subRequest.Body}
+	subRequest.Body = capturingBody
+	started := time.Now()
+	routeName := "panic"
+	func() {
+		recoveringWriter := &recoveringResponseWriter{ResponseWriter: writer}
+		defer recoverPanic(recoveringWriter, subRequest, usage.ClientOf(subRequest))
+		routeName = route(recoveringWriter, subRequest)
+		metrics.NewCounter(`api_batched_requests_total{route="` + routeName + `"}`).Inc()
+	}()
+
+	responseItem := &BatchResponseItem{Status: writer.statusCode}
+	if responseItem.Status == 0 {
+		responseItem.Status = http.StatusOK
+	}
+	audit.Record(audit.EntryOf(subRequest, capturingBody.Captured.Bytes(), routeName, responseItem.Status, started))
+	switch responseBody := writer.body.Bytes(); {
+	case len(responseBody) == 0:
+	case json.Valid(responseBody):
+		responseItem.Body = responseBody
+	default:
+		responseItem.Body, _ = json.Marshal(string(responseBody))
+	}
+	return responseItem
+}
+
+// handleBatch runs an array of sub-requests concurrently and answers with
+// their responses in the same order, saving dashboards a round trip per
+// query. The batch succeeds as a whole even when some sub-requests fail.
+func handleBatch(response http.ResponseWriter, request *http.Request) {
+	if request.Method != "POST" {
+		response.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	dataBytes, err := io.ReadAll(request.Body)
+	if err != nil {
+		response.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	var requestItems []*BatchRequestItem
+	if err := json.Unmarshal(dataBytes, &requestItems); err != nil {
+		response.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if maxRequests := config.Current.Batch.MaxRequests; len(requestItems) > maxRequests {
+		response.WriteHeader(http.StatusRequestEntityTooLarge)
+		response.Write([]byte(fmt.Sprintf(`batch of %d requests exceeds the maximum of %d`, len(requestItems), maxRequests)))
+		return
+	}
+
+	subRequests := make([]*http.Request, len(requestItems))
+	for itemIndex, requestItem := range requestItems {
+		if requestItem == nil {
+			response.WriteHeader(http.StatusBadRequest)
+			response.Write([]byte(fmt.Sprintf(`request %d: missing`, itemIndex)))
+			return
+		}
+		if subRequests[itemIndex], err = requestItem.subRequest(request); err != nil {
+			response.WriteHeader(http.StatusBadRequest)
+			response.Write([]byte(fmt.Sprintf(`request %d: %v`, itemIndex, err)))
+			return
+		}
+	}
+
+	responseItems := make([]*BatchResponseItem, len(requestItems))
+	slots := make(chan struct{}, config.Current.Batch.Concurrency)
+	var workers sync.WaitGroup
+	for itemIndex := range requestItems {
+		workers.Add(1)
+		slots <- struct{}{}
+		go func(itemIndex int) {
+			defer func() {
+				<-slots
+				workers.Done()
+			}()
+			responseItems[itemIndex] = serveBatchItem(subRequests[itemIndex])
+			responseItems[itemIndex].Id = requestItems[itemIndex].Id
+		}(itemIndex)
+	}
+	workers.Wait()
+
+	responseBytes, err := json.Marshal(responseItems)
+	if err != nil {
+		response.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	response.WriteHeader(http.StatusOK)
+	response.Write(responseBytes)
+}
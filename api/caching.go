@@ -0,0 +1,55 @@
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/config"
+)
+
+// setCacheHeaders lets clients keep responses for windows well in the past
+// for a long time, and windows touching "now" only briefly. Backfilled,
+// deleted and refreshed samples still change past windows, so responses are
+// only kept by the caller and carry an ETag of the revision of the samples
+// they were rendered from, taken before rendering, to revalidate with. It
+// reports whether the request's If-None-Match already names that ETag, in
+// which case the caller answers 304 Not Modified instead of the response.
+func setCacheHeaders(response http.ResponseWriter, request *http.Request, body []byte, revision int64, to time.Time) bool {
+	caching := config.Current.Caching
+	if !caching.Enabled {
+		return false
+	}
+
+	maxAge := caching.LiveMaxAge.Duration
+	now := time.Now()
+	if to.Before(now.Add(-caching.LiveWindow.Duration)) {
+		maxAge = caching.HistoricalMaxAge.Duration
+	}
+	eTag := revisionETag(request, body, revision)
+	response.Header().Set("Cache-Control", fmt.Sprintf("private, max-age=%d", int64(maxAge.Seconds())))
+	response.Header().Set("Expires", now.Add(maxAge).UTC().Format(http.TimeFormat))
+	response.Header().Set("ETag", eTag)
+	response.Header().Add("Vary", "Authorization, X-API-Key")
+
+	for _, candidate := range strings.Split(request.Header.Get("If-None-Match"), ",") {
+		if candidate = strings.TrimSpace(candidate); candidate == eTag || candidate == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+// responseEpoch tells responses of this process apart from those of earlier
+// ones, whose revisions counted from the same start over other data.
+var responseEpoch = time.Now().UnixNano()
+
+// revisionETag identifies the response to a request rendered from the given
+// revision of the samples, and the body of the request, if it has one.
+func revisionETag(request *http.Request, body []byte, revision int64) string {
+	hash := sha256.Sum256([]byte(fmt.Sprintf("%d\n%d\n%s\n%s\n%s\n%s", responseEpoch, revision, request.Method, request.URL.Path, request.URL.Query().Encode(), body)))
+	return `"` + hex.EncodeToString(hash[:12]) + `"`
+}
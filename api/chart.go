@@ -0,0 +1,129 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/chart"
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/config"
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/hardware"
+)
+
+func parseChart(request *http.Request) (*chart.Chart, error) {
+	query := request.URL.Query()
+
+	hardwareId := query.Get("id")
+	if !hardware.HasSamples(hardwareId) {
+		return nil, fmt.Errorf(`%w "%s"`, hardware.ErrUnknownHardware, hardwareId)
+	}
+
+	from, err := time.Parse(time.RFC3339, query.Get("from"))
+	if err != nil {
+		return nil, fmt.Errorf(`cannot parse from "%s": %w`, query.Get("from"), err)
+	}
+	to, err := time.Parse(time.RFC3339, query.Get("to"))
+	if err != nil {
+		return nil, fmt.Errorf(`cannot parse to "%s": %w`, query.Get("to"), err)
+	}
+
+	newChart := &chart.Chart{Title: hardwareId, Width: 800, Height: 400, From: from, To: to}
+	if width, err := strconv.Atoi(query.Get("width")); err == nil && width > 100 && width <= 4000 {
+		newChart.Width = width
+	}
+	if height, err := strconv.Atoi(query.Get("height")); err == nil && height > 100 && height <= 4000 {
+		newChart.Height = height
+	}
+
+	count := 200
+	if query.Get("count") != "" {
+		if count, err = strconv.Atoi(query.Get("count")); err != nil {
+			return nil, fmt.Errorf(`cannot parse count "%s": %w`, query.Get("count"), err)
+		}
+	}
+	if maxCount := config.Current.Tabulation.MaxCount; maxCount > 0 && count > maxCount {
+		return nil, fmt.Errorf(`count %d exceeds the maximum of %d`, count, maxCount)
+	}
+	step, validStep := gridStep(from, to, count)
+	if !validStep {
+		return nil, fmt.Errorf(`invalid window or count`)
+	}
+
+	metrics := hardware.Metrics()
+	if query.Get("metrics") != "" {
+		metrics = strings.Split(query.Get("metrics"), ",")
+	}
+	for _, metric := range metrics {
+		if !hardware.IsMetric(metric) {
+			return nil, fmt.Errorf(`%w "%s"`, hardware.ErrUnknownMetric, metric)
+		}
+		newChart.Series = append(newChart.Series, &chart.Series{Name: metric})
+
+		if limits, hasLimits := hardware.LimitsFor(hardwareId, metric); hasLimits {
+			if limits.Warning != nil {
+				newChart.Lines = append(newChart.Lines, &chart.Line{Label: metric + " warning", Value: *limits.Warning, Color: chart.WarningColor})
+			}
+			if limits.Critical != nil {
+				newChart.Lines = append(newChart.Lines, &chart.Line{Label: metric + " critical", Value: *limits.Critical, Color: chart.CriticalColor})
+			}
+		}
+	}
+
+	for timestamp := from; timestamp.Before(to); timestamp = timestamp.Add(step) {
+		sample, err := hardware.InterpolateSample(hardwareId, timestamp)
+		if err != nil {
+			continue
+		}
+		for _, series := range newChart.Series {
+			if value, _ := sample.ValueByMetric(series.Name); value != nil {
+				series.Times = append(series.Times, timestamp)
+				series.Values = append(series.Values, *value)
+			}
+		}
+	}
+
+	for _, annotation := range query["annotation"] {
+		annotationTime, annotationLabel, _ := strings.Cut(annotation, "|")
+		at, err := time.Parse(time.RFC3339, annotationTime)
+		if err != nil {
+			return nil, fmt.Errorf(`cannot parse annotation time "%s": %w`, annotationTime, err)
+		}
+		newChart.Annotations = append(newChart.Annotations, &chart.Annotation{Label: annotationLabel, Time: at})
+	}
+
+	return newChart, nil
+}
+
+func handleChart(response http.ResponseWriter, request *http.Request) {
+	if request.Method != "GET" {
+		response.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	revision := hardware.Revision()
+
+	requestedChart, err := parseChart(request)
+	if err != nil {
+		response.WriteHeader(errorStatus(err, http.StatusBadRequest))
+		response.Write([]byte(err.Error()))
+		return
+	}
+
+	if setCacheHeaders(response, request, nil, revision, requestedChart.To) {
+		response.WriteHeader(http.StatusNotModified)
+		return
+	}
+	switch request.URL.Query().Get("format") {
+	case "", "svg":
+		response.Header().Set("Content-Type", "image/svg+xml")
+		response.WriteHeader(http.StatusOK)
+		requestedChart.RenderSVG(response)
+	case "png":
+		response.Header().Set("Content-Type", "image/png")
+		response.WriteHeader(http.StatusOK)
+		requestedChart.RenderPNG(response)
+	default:
+		response.WriteHeader(http.StatusBadRequest)
+	}
+}
@@ -0,0 +1,183 @@
+// Package chart renders time series as SVG or PNG line charts.
+package chart
+
+import (
+	"bufio"
+	"fmt"
+	"html"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"math"
+	"time"
+)
+
+type Series struct {
+	Name   string
+	Times  []time.Time
+	Values []float64
+}
+
+type Line struct {
+	Label string
+	Value float64
+	Color color.RGBA
+}
+
+type Annotation struct {
+	Label string
+	Time  time.Time
+}
+
+type Chart struct {
+	Title       string
+	Width       int
+	Height      int
+	From        time.Time
+	To          time.Time
+	Series      []*Series
+	Lines       []*Line
+	Annotations []*Annotation
+}
+
+const margin = 40
+
+var (
+	palette = []color.RGBA{
+		{R: 0x1f, G: 0x77, B: 0xb4, A: 0xff},
+		{R: 0x2c, G: 0xa0, B: 0x2c, A: 0xff},
+		{R: 0x94, G: 0x67, B: 0xbd, A: 0xff},
+		{R: 0x8c, G: 0x56, B: 0x4b, A: 0xff},
+		{R: 0x17, G: 0xbe, B: 0xcf, A: 0xff},
+	}
+	WarningColor    = color.RGBA{R: 0xff, G: 0x7f, B: 0x0e, A: 0xff}
+	CriticalColor   = color.RGBA{R: 0xd6, G: 0x27, B: 0x28, A: 0xff}
+	annotationColor = color.RGBA{R: 0x7f, G: 0x7f, B: 0x7f, A: 0xff}
+)
+
+func hexColor(rgba color.RGBA) string {
+	return fmt.Sprintf("#%02x%02x%02x", rgba.R, rgba.G, rgba.B)
+}
+
+// valueRange spans every series and limit line, so limits are always visible.
+func (chart *Chart) valueRange() (float64, float64) {
+	minimum, maximum := math.Inf(1), math.Inf(-1)
+	for _, series := range chart.Series {
+		for _, value := range series.Values {
+			minimum, maximum = math.Min(minimum, value), math.Max(maximum, value)
+		}
+	}
+	for _, line := range chart.Lines {
+		minimum, maximum = math.Min(minimum, line.Value), math.Max(maximum, line.Value)
+	}
+	if math.IsInf(minimum, 0) || math.IsInf(maximum, 0) {
+		return 0, 1
+	}
+	if minimum == maximum {
+		return minimum - 1, maximum + 1
+	}
+	padding := 0.05 * (maximum - minimum)
+	return minimum - padding, maximum + padding
+}
+
+func (chart *Chart) x(at time.Time) float64 {
+	span := chart.To.Sub(chart.From)
+	if span <= 0 {
+		return margin
+	}
+	return margin + float64(at.Sub(chart.From))/float64(span)*float64(chart.Width-2*margin)
+}
+
+func (chart *Chart) y(value float64, minimum float64, maximum float64) float64 {
+	return float64(chart.Height-margin) - (value-minimum)/(maximum-minimum)*float64(chart.Height-2*margin)
+}
+
+func (chart *Chart) RenderSVG(writer io.Writer) error {
+	minimum, maximum := chart.valueRange()
+	bufferedWriter := bufio.NewWriter(writer)
+
+	fmt.Fprintf(bufferedWriter, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" font-family="sans-serif" font-size="11">`+"\n", chart.Width, chart.Height, chart.Width, chart.Height)
+	fmt.Fprintf(bufferedWriter, `<rect width="%d" height="%d" fill="white"/>`+"\n", chart.Width, chart.Height)
+	fmt.Fprintf(bufferedWriter, `<text x="%d" y="%d" font-size="14">%s</text>`+"\n", margin, margin/2+5, html.EscapeString(chart.Title))
+	fmt.Fprintf(bufferedWriter, `<rect x="%d" y="%d" width="%d" height="%d" fill="none" stroke="#cccccc"/>`+"\n", margin, margin, chart.Width-2*margin, chart.Height-2*margin)
+	fmt.Fprintf(bufferedWriter, `<text x="%d" y="%d">%s</text>`+"\n", margin, chart.Height-margin/2+5, chart.From.UTC().Format(time.RFC3339))
+	fmt.Fprintf(bufferedWriter, `<text x="%d" y="%d" text-anchor="end">%s</text>`+"\n", chart.Width-margin, chart.Height-margin/2+5, chart.To.UTC().Format(time.RFC3339))
+	fmt.Fprintf(bufferedWriter, `<text x="%d" y="%.1f" text-anchor="end">%.3g</text>`+"\n", margin-4, chart.y(maximum, minimum, maximum)+4, maximum)
+	fmt.Fprintf(bufferedWriter, `<text x="%d" y="%.1f" text-anchor="end">%.3g</text>`+"\n", margin-4, chart.y(minimum, minimum, maximum), minimum)
+
+	for _, line := range chart.Lines {
+		lineY := chart.y(line.Value, minimum, maximum)
+		fmt.Fprintf(bufferedWriter, `<line x1="%d" y1="%.1f" x2="%d" y2="%.1f" stroke="%s" stroke-dasharray="6 4"/>`+"\n", margin, lineY, chart.Width-margin, lineY, hexColor(line.Color))
+		fmt.Fprintf(bufferedWriter, `<text x="%d" y="%.1f" text-anchor="end" fill="%s">%s</text>`+"\n", chart.Width-margin-4, lineY-4, hexColor(line.Color), html.EscapeString(line.Label))
+	}
+
+	for _, annotation := range chart.Annotations {
+		annotationX := chart.x(annotation.Time)
+		fmt.Fprintf(bufferedWriter, `<line x1="%.1f" y1="%d" x2="%.1f" y2="%d" stroke="%s"/>`+"\n", annotationX, margin, annotationX, chart.Height-margin, hexColor(annotationColor))
+		fmt.Fprintf(bufferedWriter, `<text x="%.1f" y="%d" fill="%s">%s</text>`+"\n", annotationX+3, margin+12, hexColor(annotationColor), html.EscapeString(annotation.Label))
+	}
+
+	for seriesIndex, series := range chart.Series {
+		seriesColor := hexColor(palette[seriesIndex%len(palette)])
+		fmt.Fprintf(bufferedWriter, `<polyline fill="none" stroke="%s" stroke-width="1.5" points="`, seriesColor)
+		for pointIndex := range series.Values {
+			fmt.Fprintf(bufferedWriter, "%.1f,%.1f ", chart.x(series.Times[pointIndex]), chart.y(series.Values[pointIndex], minimum, maximum))
+		}
+		fmt.Fprintln(bufferedWriter, `"/>`)
+		fmt.Fprintf(bufferedWriter, `<text x="%d" y="%d" fill="%s">%s</text>`+"\n", margin+8, margin+14*(seriesIndex+2), seriesColor, html.EscapeString(series.Name))
+	}
+
+	fmt.Fprintln(bufferedWriter, `</svg>`)
+	return bufferedWriter.Flush()
+}
+
+func drawLine(canvas *image.RGBA, fromX float64, fromY float64, toX float64, toY float64, lineColor color.RGBA, dashed bool) {
+	steps := int(math.Max(math.Abs(toX-fromX), math.Abs(toY-fromY))) + 1
+	for step := 0; step <= steps; step++ {
+		if dashed && (step/6)%2 == 1 {
+			continue
+		}
+		fraction := float64(step) / float64(steps)
+		canvas.SetRGBA(int(fromX+fraction*(toX-fromX)), int(fromY+fraction*(toY-fromY)), lineColor)
+	}
+}
+
+// RenderPNG draws the same chart without text, since the standard library has
+// no font rendering; labels are only available in the SVG.
+func (chart *Chart) RenderPNG(writer io.Writer) error {
+	minimum, maximum := chart.valueRange()
+	canvas := image.NewRGBA(image.Rect(0, 0, chart.Width, chart.Height))
+	for pixel := 0; pixel < len(canvas.Pix); pixel++ {
+		canvas.Pix[pixel] = 0xff
+	}
+
+	frameColor := color.RGBA{R: 0xcc, G: 0xcc, B: 0xcc, A: 0xff}
+	left, top, right, bottom := float64(margin), float64(margin), float64(chart.Width-margin), float64(chart.Height-margin)
+	drawLine(canvas, left, top, right, top, frameColor, false)
+	drawLine(canvas, left, bottom, right, bottom, frameColor, false)
+	drawLine(canvas, left, top, left, bottom, frameColor, false)
+	drawLine(canvas, right, top, right, bottom, frameColor, false)
+
+	for _, line := range chart.Lines {
+		lineY := chart.y(line.Value, minimum, maximum)
+		drawLine(canvas, left, lineY, right, lineY, line.Color, true)
+	}
+
+	for _, annotation := range chart.Annotations {
+		annotationX := chart.x(annotation.Time)
+		drawLine(canvas, annotationX, top, annotationX, bottom, annotationColor, false)
+	}
+
+	for seriesIndex, series := range chart.Series {
+		seriesColor := palette[seriesIndex%len(palette)]
+		for pointIndex := 1; pointIndex < len(series.Values); pointIndex++ {
+			drawLine(canvas,
+				chart.x(series.Times[pointIndex-1]), chart.y(series.Values[pointIndex-1], minimum, maximum),
+				chart.x(series.Times[pointIndex]), chart.y(series.Values[pointIndex], minimum, maximum),
+				seriesColor, false)
+		}
+	}
+
+	return png.Encode(writer, canvas)
+}
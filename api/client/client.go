@@ -0,0 +1,148 @@
+// Package client calls the HTTP API of a running server, decoding responses
+// into the types the api package serves them from.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api"
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/hardware"
+)
+
+// Client calls the API served at BaseURL, such as "http://plant:8080".
+type Client struct {
+	BaseURL string
+
+	// APIKey is sent in the X-API-Key header when set.
+	APIKey string
+
+	// HTTPClient defaults to http.DefaultClient.
+	HTTPClient *http.Client
+}
+
+func New(baseURL string, apiKey string) *Client {
+	return &Client{BaseURL: strings.TrimSuffix(baseURL, "/"), APIKey: apiKey}
+}
+
+// StatusError is a response other than 200 OK, with the message the server
+// wrote in its body, if any.
+type StatusError struct {
+	StatusCode int
+	Message    string
+}
+
+func (err *StatusError) Error() string {
+	if err.Message == "" {
+		return fmt.Sprintf(`server answered %d %s`, err.StatusCode, http.StatusText(err.StatusCode))
+	}
+	return fmt.Sprintf(`server answered %d %s: %s`, err.StatusCode, http.StatusText(err.StatusCode), err.Message)
+}
+
+// Hardware lists the hardware with samples, with the profile and asset of each.
+func (client *Client) Hardware(ctx context.Context) ([]*api.HardwareDescriptionResponseData, error) {
+	var responseData []*api.HardwareDescriptionResponseData
+	if err := client.do(ctx, "GET", "/api/hardware", "", nil, &responseData); err != nil {
+		return nil, err
+	}
+	return responseData, nil
+}
+
+// Describe describes one hardware.
+func (client *Client) Describe(ctx context.Context, hardwareId string) (*api.HardwareDescriptionResponseData, error) {
+	var responseData api.HardwareDescriptionResponseData
+	if err := client.do(ctx, "GET", "/api/hardware/"+url.PathEscape(hardwareId), "", nil, &responseData); err != nil {
+		return nil, err
+	}
+	return &responseData, nil
+}
+
+// Tabulate interpolates the samples of a hardware as requestData asks. The
+// response is always enveloped, so count adjustments and warnings come back
+// with the samples, which stay keyed by their display time.
+func (client *Client) Tabulate(ctx context.Context, requestData api.TabulatedHardwareRequestData) (*api.TabulatedHardwareResponseData, error) {
+	requestData.Envelope = true
+	requestBytes, err := json.Marshal(requestData)
+	if err != nil {
+		return nil, err
+	}
+	var responseData api.TabulatedHardwareResponseData
+	if err := client.do(ctx, "POST", "/api/tabulated_hardware", "application/json", requestBytes, &responseData); err != nil {
+		return nil, err
+	}
+	return &responseData, nil
+}
+
+// Aggregate downsamples the samples of a hardware between from and to into
+// buckets of interval.
+func (client *Client) Aggregate(ctx context.Context, hardwareId string, from time.Time, to time.Time, interval time.Duration) (*api.AggregateResponseData, error) {
+	query := url.Values{}
+	query.Set("from", from.Format(time.RFC3339Nano))
+	query.Set("to", to.Format(time.RFC3339Nano))
+	query.Set("interval", interval.String())
+	var responseData api.AggregateResponseData
+	if err := client.do(ctx, "GET", "/api/hardware/"+url.PathEscape(hardwareId)+"/aggregate?"+query.Encode(), "", nil, &responseData); err != nil {
+		return nil, err
+	}
+	return &responseData, nil
+}
+
+// AddSamples sends live readings of a hardware, written to its sample files
+// as well when persist is set.
+func (client *Client) AddSamples(ctx context.Context, hardwareId string, readings []*hardware.Reading, persist bool) (*api.IngestResponseData, error) {
+	requestBytes, err := json.Marshal(readings)
+	if err != nil {
+		return nil, err
+	}
+	path := "/api/hardware/" + url.PathEscape(hardwareId) + "/samples?persist=" + strconv.FormatBool(persist)
+	var responseData api.IngestResponseData
+	if err := client.do(ctx, "POST", path, "application/json", requestBytes, &responseData); err != nil {
+		return nil, err
+	}
+	return &responseData, nil
+}
+
+// do sends a request and decodes a 200 OK response into responseData.
+func (client *Client) do(ctx context.Context, method string, path string, contentType string, requestBytes []byte, responseData any) error {
+	var body io.Reader
+	if requestBytes != nil {
+		body = bytes.NewReader(requestBytes)
+	}
+	request, err := http.NewRequestWithContext(ctx, method, client.BaseURL+path, body)
+	if err != nil {
+		return err
+	}
+	if contentType != "" {
+		request.Header.Set("Content-Type", contentType)
+	}
+	if client.APIKey != "" {
+		request.Header.Set("X-API-Key", client.APIKey)
+	}
+
+	httpClient := client.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	response, err := httpClient.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	responseBytes, err := io.ReadAll(response.Body)
+	if err != nil {
+		return err
+	}
+	if response.StatusCode != http.StatusOK {
+		return &StatusError{StatusCode: response.StatusCode, Message: strings.TrimSpace(string(responseBytes))}
+	}
+	return json.Unmarshal(responseBytes, responseData)
+}
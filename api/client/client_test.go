@@ -0,0 +1,69 @@
+package client_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api"
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/client"
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/hardware"
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/internal/fixtures"
+)
+
+func TestMain(m *testing.M) {
+	fixtures.Main(m.Run)
+}
+
+func TestClient(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(api.Handle))
+	defer server.Close()
+	kcfClient := client.New(server.URL, "")
+	ctx := context.Background()
+
+	descriptions, err := kcfClient.Hardware(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(descriptions) != 1 || descriptions[0].Id != fixtures.HardwareId || descriptions[0].Samples != fixtures.Minutes {
+		t.Fatalf(`expected one hardware "%s" with %d samples`, fixtures.HardwareId, fixtures.Minutes)
+	}
+
+	var statusErr *client.StatusError
+	if _, err := kcfClient.Describe(ctx, "unknown"); !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusNotFound {
+		t.Errorf(`expected describing unknown hardware to fail with 404, got %v`, err)
+	}
+
+	tabulation, err := kcfClient.Tabulate(ctx, api.TabulatedHardwareRequestData{Id: fixtures.HardwareId, From: fixtures.Minute(10), To: fixtures.Minute(20), Count: 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tabulation.Samples) != 5 {
+		t.Fatalf(`expected 5 samples, got %d`, len(tabulation.Samples))
+	}
+	for at, sample := range tabulation.Samples {
+		if value, _ := sample.ValueByMetric("rmsVelocityX"); value == nil || *value != 1.5 {
+			t.Errorf(`expected rmsVelocityX of 1.5 at %s`, at)
+		}
+	}
+
+	aggregation, err := kcfClient.Aggregate(ctx, fixtures.HardwareId, fixtures.Minute(0), fixtures.Minute(30), 10*time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(aggregation.Buckets) != 3 || aggregation.Interval.Duration != 10*time.Minute {
+		t.Errorf(`expected 3 buckets of 10 minutes, got %d of %s`, len(aggregation.Buckets), aggregation.Interval.Duration)
+	}
+
+	readings := []*hardware.Reading{{Time: fixtures.Minute(fixtures.Minutes), Values: map[string]float64{"temperature": 20 + fixtures.Minutes}}}
+	ingestion, err := kcfClient.AddSamples(ctx, fixtures.HardwareId, readings, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ingestion.RowsAccepted != 1 || ingestion.RowsRejected != 0 {
+		t.Errorf(`expected the reading to be accepted, got %d accepted and %d rejected: %v`, ingestion.RowsAccepted, ingestion.RowsRejected, ingestion.Errors)
+	}
+}
@@ -0,0 +1,131 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/config"
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/hardware"
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/statistics"
+)
+
+const (
+	maxClockOffsetBuckets = 20000
+	maxClockOffsetLags    = 1000
+)
+
+type ClockOffsetResponseData struct {
+	Id          string               `json:"id"`
+	Reference   string               `json:"reference"`
+	Metric      string               `json:"metric"`
+	From        time.Time            `json:"from"`
+	To          time.Time            `json:"to"`
+	Correlation statistics.Statistic `json:"correlation"`
+
+	// Offset is what should be added to the hardware's timestamps, on top of
+	// ConfiguredOffset, to line it up with the reference. SuggestedOffset is
+	// the clock offset to configure for that.
+	Offset           config.Duration `json:"offset"`
+	ConfiguredOffset config.Duration `json:"configuredOffset"`
+	SuggestedOffset  config.Duration `json:"suggestedOffset"`
+}
+
+// handleClockOffset estimates how far the clock of a hardware is off from a
+// reference hardware, by finding the shift at which a metric both observe,
+// such as the ambient part of their temperature, lines up best.
+func handleClockOffset(response http.ResponseWriter, request *http.Request, hardwareId string) {
+	if request.Method != "GET" {
+		response.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if !hardware.HasSamples(hardwareId) {
+		response.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	query := request.URL.Query()
+	referenceId, metric := query.Get("reference"), query.Get("metric")
+	if referenceId == "" || referenceId == hardwareId || !hardware.IsMetric(metric) {
+		response.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if !hardware.HasSamples(referenceId) {
+		response.WriteHeader(http.StatusNotFound)
+		return
+	}
+	from, err := time.Parse(time.RFC3339, query.Get("from"))
+	if err != nil {
+		response.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	to, err := time.Parse(time.RFC3339, query.Get("to"))
+	if err != nil || !to.After(from) {
+		response.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	resolution, maxOffset := time.Minute, time.Hour
+	if query.Get("resolution") != "" {
+		if resolution, err = time.ParseDuration(query.Get("resolution")); err != nil || resolution <= 0 {
+			response.WriteHeader(http.StatusBadRequest)
+			return
+		}
+	}
+	if query.Get("maxOffset") != "" {
+		if maxOffset, err = time.ParseDuration(query.Get("maxOffset")); err != nil || maxOffset < 0 {
+			response.WriteHeader(http.StatusBadRequest)
+			return
+		}
+	}
+	buckets, maxLag := int(to.Sub(from)/resolution), int(maxOffset/resolution)
+	if buckets < 4 || buckets > maxClockOffsetBuckets || maxLag > maxClockOffsetLags || maxLag > buckets/2 {
+		response.WriteHeader(http.StatusBadRequest)
+		response.Write([]byte(fmt.Sprintf(`%d buckets with up to %d lags of %s either way is out of bounds`, buckets, maxLag, resolution)))
+		return
+	}
+	// Rounded down to whole buckets, so every bucket is resolution wide
+	to = from.Add(time.Duration(buckets) * resolution)
+
+	reference, err := bucketMeans(referenceId, metric, from, to, buckets)
+	if err != nil {
+		response.WriteHeader(errorStatus(err, http.StatusInternalServerError))
+		return
+	}
+	observed, err := bucketMeans(hardwareId, metric, from, to, buckets)
+	if err != nil {
+		response.WriteHeader(errorStatus(err, http.StatusInternalServerError))
+		return
+	}
+
+	correlation, lag := statistics.NormalizedCrossCorrelation(reference, observed, maxLag, buckets/2)
+	if correlation.Value == nil {
+		response.WriteHeader(http.StatusUnprocessableEntity)
+		response.Write([]byte(fmt.Sprintf(`"%s" and "%s" do not overlap enough to compare: %s`, hardwareId, referenceId, correlation.Reason)))
+		return
+	}
+
+	// A pattern showing up later on the hardware means its clock runs ahead
+	offset := -time.Duration(lag) * resolution
+	configuredOffset := config.Current.ClockOffsets[hardwareId].Duration
+	responseData := ClockOffsetResponseData{
+		Id:               hardwareId,
+		Reference:        referenceId,
+		Metric:           metric,
+		From:             from,
+		To:               to,
+		Correlation:      correlation,
+		Offset:           config.Duration{Duration: offset},
+		ConfiguredOffset: config.Duration{Duration: configuredOffset},
+		SuggestedOffset:  config.Duration{Duration: configuredOffset + offset},
+	}
+	responseBytes, err := json.Marshal(responseData)
+	if err != nil {
+		response.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	response.WriteHeader(http.StatusOK)
+	response.Write(responseBytes)
+}
@@ -0,0 +1,230 @@
+// Package cmms enriches hardware with what the maintenance system knows of
+// it, looked up on first access and kept for a while, so listings carry the
+// asset context maintainers work with without a copy to keep in sync.
+package cmms
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/config"
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/metrics"
+)
+
+// ErrUnknownAsset is a hardware the maintenance system does not know of.
+var ErrUnknownAsset = errors.New(`unknown to the CMMS`)
+
+// maxResponseBytes bounds the asset records read.
+const maxResponseBytes = 1 << 20
+
+// Asset is what the maintenance system knows of a hardware.
+type Asset struct {
+	Name        string    `json:"name,omitempty"`
+	Criticality string    `json:"criticality,omitempty"`
+	FetchedAt   time.Time `json:"fetchedAt"`
+}
+
+// entry is the lookup of one hardware: its outcome until expiresAt, and
+// fetched while a lookup is under way, closed once it is done.
+type entry struct {
+	isLookedUp bool
+	asset      *Asset
+	err        error
+	expiresAt  time.Time
+	fetched    chan struct{}
+}
+
+var (
+	lookupCounter        = metrics.NewCounter("cmms_lookups_total")
+	lookupFailureCounter = metrics.NewCounter("cmms_lookup_failures_total")
+
+	client = &http.Client{}
+
+	entriesMutex sync.Mutex
+	entries      map[string]*entry = make(map[string]*entry)
+
+	slotsMutex sync.Mutex
+	// slots bound the lookups under way, sized to the configured concurrency
+	slots chan struct{}
+)
+
+// Enabled reports whether a CMMS is configured.
+func Enabled() bool {
+	return config.Current.CMMS.URL != ""
+}
+
+// Lookup returns the asset a hardware is in the maintenance system, looking
+// it up when it never was. One that expired is returned as it was while it is
+// looked up again in the background, and concurrent callers share a lookup.
+// It returns nil without an error when no CMMS is configured.
+func Lookup(ctx context.Context, hardwareId string) (*Asset, error) {
+	if !Enabled() {
+		return nil, nil
+	}
+
+	entriesMutex.Lock()
+	lookup, isKnown := entries[hardwareId]
+	if !isKnown {
+		lookup = &entry{}
+		entries[hardwareId] = lookup
+	}
+	if lookup.isLookedUp && time.Now().Before(lookup.expiresAt) {
+		entriesMutex.Unlock()
+		return lookup.asset, lookup.err
+	}
+	if lookup.fetched == nil {
+		lookup.fetched = make(chan struct{})
+		go refresh(hardwareId, lookup)
+	}
+	if lookup.isLookedUp {
+		entriesMutex.Unlock()
+		return lookup.asset, lookup.err
+	}
+	fetched := lookup.fetched
+	entriesMutex.Unlock()
+
+	select {
+	case <-fetched:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	entriesMutex.Lock()
+	defer entriesMutex.Unlock()
+	return lookup.asset, lookup.err
+}
+
+// LookupAll looks up several hardware at once, leaving out those that fail.
+func LookupAll(ctx context.Context, hardwareIds []string) map[string]*Asset {
+	assets := make(map[string]*Asset)
+	if !Enabled() {
+		return assets
+	}
+
+	var (
+		assetsMutex sync.Mutex
+		looking     sync.WaitGroup
+	)
+	for _, hardwareId := range hardwareIds {
+		looking.Add(1)
+		go func(hardwareId string) {
+			defer looking.Done()
+			asset, err := Lookup(ctx, hardwareId)
+			if err != nil || asset == nil {
+				return
+			}
+			assetsMutex.Lock()
+			assets[hardwareId] = asset
+			assetsMutex.Unlock()
+		}(hardwareId)
+	}
+	looking.Wait()
+	return assets
+}
+
+// refresh looks a hardware up, outside of any one request so that callers
+// giving up do not fail the others, and keeps what an earlier lookup found
+// when this one fails.
+func refresh(hardwareId string, lookup *entry) {
+	settings := config.Current.CMMS
+	release := acquireSlot(settings.Concurrency)
+	ctx, cancel := context.WithTimeout(context.Background(), settings.Timeout.Duration)
+	asset, err := fetch(ctx, settings, hardwareId)
+	cancel()
+	release()
+
+	lookupCounter.Inc()
+	entriesMutex.Lock()
+	defer entriesMutex.Unlock()
+	now := time.Now()
+	switch {
+	case err == nil, errors.Is(err, ErrUnknownAsset):
+		lookup.asset, lookup.err = asset, err
+		lookup.expiresAt = now.Add(settings.TTL.Duration)
+	case lookup.isLookedUp && lookup.err == nil:
+		lookupFailureCounter.Inc()
+		lookup.expiresAt = now.Add(settings.FailureTTL.Duration)
+	default:
+		lookupFailureCounter.Inc()
+		lookup.asset, lookup.err = nil, err
+		lookup.expiresAt = now.Add(settings.FailureTTL.Duration)
+	}
+	lookup.isLookedUp = true
+	close(lookup.fetched)
+	lookup.fetched = nil
+}
+
+func acquireSlot(concurrency int) func() {
+	slotsMutex.Lock()
+	if slots == nil || cap(slots) != concurrency {
+		slots = make(chan struct{}, concurrency)
+	}
+	acquired := slots
+	slotsMutex.Unlock()
+
+	acquired <- struct{}{}
+	return func() { <-acquired }
+}
+
+func fetch(ctx context.Context, settings config.CMMS, hardwareId string) (*Asset, error) {
+	request, err := http.NewRequestWithContext(ctx, "GET", strings.ReplaceAll(settings.URL, "{hardwareId}", url.PathEscape(hardwareId)), nil)
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Accept", "application/json")
+	for name, value := range settings.Headers {
+		request.Header.Set(name, value)
+	}
+
+	response, err := client.Do(request)
+	if err != nil {
+		return nil, fmt.Errorf(`unable to look up hardware "%s" in the CMMS: %w`, hardwareId, err)
+	}
+	defer response.Body.Close()
+	if response.StatusCode == http.StatusNotFound {
+		return nil, fmt.Errorf(`hardware "%s" is %w`, hardwareId, ErrUnknownAsset)
+	} else if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf(`unable to look up hardware "%s" in the CMMS: status %s`, hardwareId, response.Status)
+	}
+
+	var record map[string]interface{}
+	if err := json.NewDecoder(io.LimitReader(response.Body, maxResponseBytes)).Decode(&record); err != nil {
+		return nil, fmt.Errorf(`unable to parse the CMMS record of hardware "%s": %w`, hardwareId, err)
+	}
+	return &Asset{
+		Name:        fieldOf(record, settings.NameField),
+		Criticality: fieldOf(record, settings.CriticalityField),
+		FetchedAt:   time.Now(),
+	}, nil
+}
+
+// fieldOf reads a field of a record as text, following dots into nested
+// objects, or "" when it is missing.
+func fieldOf(record map[string]interface{}, field string) string {
+	if field == "" {
+		return ""
+	}
+	var value interface{} = record
+	for _, name := range strings.Split(field, ".") {
+		object, isObject := value.(map[string]interface{})
+		if !isObject {
+			return ""
+		}
+		value = object[name]
+	}
+	switch value := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return value
+	default:
+		return fmt.Sprint(value)
+	}
+}
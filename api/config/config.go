@@ -0,0 +1,793 @@
+// Package config is the server configuration, loaded from a JSON file and
+// exposed through Current.
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/csvparse"
+)
+
+type Duration struct {
+	time.Duration
+}
+
+func (duration Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(duration.String())
+}
+
+func (duration *Duration) UnmarshalJSON(data []byte) error {
+	var text string
+	if err := json.Unmarshal(data, &text); err != nil {
+		return fmt.Errorf(`duration must be a string such as "5m": %w`, err)
+	}
+
+	parsed, err := time.ParseDuration(text)
+	if err != nil {
+		return err
+	}
+	duration.Duration = parsed
+	return nil
+}
+
+type Caching struct {
+	Enabled          bool     `json:"enabled"`
+	HistoricalMaxAge Duration `json:"historicalMaxAge"`
+	LiveMaxAge       Duration `json:"liveMaxAge"`
+	LiveWindow       Duration `json:"liveWindow"`
+}
+
+// Ingestion governs readings arriving after startup. Persist appends them to
+// the sample files as well, unless a request says otherwise. CSV is the
+// dialect of ingested and pulled CSV, which ingestion requests may override;
+// the sample files are always read in the default one. JSON bodies over
+// MaxJSONBytes are refused, as they are read whole.
+type Ingestion struct {
+	MaxFutureSkew    Duration         `json:"maxFutureSkew"`
+	ServerTimestamps bool             `json:"serverTimestamps"`
+	Persist          bool             `json:"persist"`
+	MaxJSONBytes     int64            `json:"maxJSONBytes"`
+	CSV              csvparse.Options `json:"csv"`
+	Workbooks        Workbooks        `json:"workbooks"`
+	ArrivalLag       ArrivalLag       `json:"arrivalLag"`
+}
+
+// ArrivalLag is how long after their sensor timestamps live readings arrive
+// is kept, counted per hardware over the last Windows windows of Window each.
+type ArrivalLag struct {
+	Window  Duration `json:"window"`
+	Windows int      `json:"windows"`
+}
+
+// Workbooks maps the sheets of ingested XLSX workbooks onto metrics. A sheet
+// that Sheets maps to a metric holds that one channel, as a timestamp column
+// and a value column; one it maps to "" is skipped. Any other sheet is wide:
+// a timestamp column, an optional hardwareId column, and a column per
+// channel, headed the way Config.Columns describes. Timestamps are date cells
+// in the plant's time zone, Unix milliseconds or RFC 3339 text. Workbooks
+// over MaxBytes are refused, as they are read whole, as are those with a part
+// inflating past MaxPartBytes or a sheet of more than MaxRows rows.
+type Workbooks struct {
+	TimestampColumn string            `json:"timestampColumn"`
+	Sheets          map[string]string `json:"sheets"`
+	MaxBytes        int64             `json:"maxBytes"`
+	MaxPartBytes    int64             `json:"maxPartBytes"`
+	MaxRows         int               `json:"maxRows"`
+}
+
+// Streaming paces the sample streams. Samples are batched into one event per
+// EmitInterval unless a client asks otherwise, a comment is sent every
+// KeepAlive to hold idle connections open, and a client more than Buffer
+// samples behind loses the excess.
+type Streaming struct {
+	EmitInterval Duration `json:"emitInterval"`
+	KeepAlive    Duration `json:"keepAlive"`
+	Buffer       int      `json:"buffer"`
+}
+
+// Interpolation bounds how far, in nominal sample intervals, interpolation may
+// look for bracketing samples. Zero means unbounded.
+type Interpolation struct {
+	MaxLookbackIntervals  float64 `json:"maxLookbackIntervals"`
+	MaxLookaheadIntervals float64 `json:"maxLookaheadIntervals"`
+}
+
+// Tabulation caps how many points a tabulation may interpolate. Requests for
+// more are clamped to MaxCount, or to the number of raw samples in the window
+// if that is lower. Zero disables the cap.
+type Tabulation struct {
+	MaxCount int `json:"maxCount"`
+}
+
+// Batch runs at most MaxRequests sub-requests per batch, Concurrency of them
+// at once.
+type Batch struct {
+	MaxRequests int `json:"maxRequests"`
+	Concurrency int `json:"concurrency"`
+}
+
+// SLO is a latency objective for one route, named as the request metrics
+// label it: Objective, a fraction, of its requests answered within Threshold
+// without a server error, judged over each of Windows.
+type SLO struct {
+	Name      string     `json:"name"`
+	Route     string     `json:"route"`
+	Threshold Duration   `json:"threshold"`
+	Objective float64    `json:"objective"`
+	Windows   []Duration `json:"windows"`
+}
+
+// Bound names a metric whose readings should never exceed those of another,
+// such as the RMS and peak velocity of the same axis.
+type Bound struct {
+	Metric string `json:"metric"`
+	AtMost string `json:"atMost"`
+}
+
+// Consistency cross-checks related channels. A reading is held against the
+// largest reading of its bound within Window either side of it, and flagged
+// when it exceeds it by more than Tolerance, a fraction of the bound. A
+// configured list of bounds replaces the default one as a whole.
+type Consistency struct {
+	Bounds    []Bound  `json:"bounds"`
+	Window    Duration `json:"window"`
+	Tolerance float64  `json:"tolerance"`
+}
+
+// Puller fetches sample exports from a remote historian. CSV sources are
+// attributed to HardwareId; JSON sources may name their own hardware.
+type Puller struct {
+	Name       string            `json:"name"`
+	URL        string            `json:"url"`
+	Interval   Duration          `json:"interval"`
+	Headers    map[string]string `json:"headers"`
+	Format     string            `json:"format"`
+	HardwareId string            `json:"hardwareId"`
+}
+
+// CMMS looks up what the maintenance system knows of a hardware, its asset
+// name and criticality, from URL with "{hardwareId}" replaced by the escaped
+// id, sending Headers. The JSON object answered holds them under NameField
+// and CriticalityField, which may be dotted to reach into nested objects.
+// Lookups happen on first access and are kept for TTL, or FailureTTL when
+// they fail, at most Concurrency at a time and each within Timeout. An empty
+// URL disables it.
+type CMMS struct {
+	URL              string            `json:"url"`
+	Headers          map[string]string `json:"headers"`
+	NameField        string            `json:"nameField"`
+	CriticalityField string            `json:"criticalityField"`
+	TTL              Duration          `json:"ttl"`
+	FailureTTL       Duration          `json:"failureTtl"`
+	Timeout          Duration          `json:"timeout"`
+	Concurrency      int               `json:"concurrency"`
+}
+
+// Webhook receives alert notifications as JSON POST requests.
+type Webhook struct {
+	URL     string            `json:"url"`
+	Headers map[string]string `json:"headers"`
+}
+
+const (
+	NotifierWebhook = "webhook"
+	NotifierEmail   = "email"
+	NotifierSMS     = "sms"
+	NotifierMQTT    = "mqtt"
+)
+
+// Notifier is a transport alert notifications are sent through, of a Kind
+// the alerts package knows. URL is where they go: a webhook or SMS gateway,
+// an smtp:// or smtps:// mail server, or an mqtt:// or mqtts:// broker. Mail
+// goes From to the addresses in To, text messages to the numbers in To, and
+// MQTT messages are published on Topic. Options hold the settings of
+// transports a site adds, and the finer ones of the built-in transports.
+type Notifier struct {
+	Name     string            `json:"name"`
+	Kind     string            `json:"kind"`
+	URL      string            `json:"url"`
+	Headers  map[string]string `json:"headers"`
+	Username string            `json:"username"`
+	Password string            `json:"password"`
+	From     string            `json:"from"`
+	To       []string          `json:"to"`
+	Topic    string            `json:"topic"`
+	Options  map[string]string `json:"options"`
+}
+
+// Alerting evaluates alert rules as samples arrive. Rules added later first
+// look back Lookback from the newest sample, or over everything held when it
+// is zero. The last HistoryLimit resolved alerts are kept. Notifications go
+// to every webhook in Webhooks and every transport in Notifiers, each given
+// SendTimeout. Rules on a metric listed in EvaluationIntervals, or with an
+// evaluation interval of their own, are evaluated on that schedule instead,
+// checked every SchedulerTick, trading detection latency for less work on
+// large fleets.
+type Alerting struct {
+	Lookback     Duration   `json:"lookback"`
+	HistoryLimit int        `json:"historyLimit"`
+	Webhooks     []Webhook  `json:"webhooks"`
+	Notifiers    []Notifier `json:"notifiers"`
+	SendTimeout  Duration   `json:"sendTimeout"`
+
+	// EvaluationIntervals are keyed by metric, or "anomalyScore".
+	EvaluationIntervals map[string]Duration `json:"evaluationIntervals"`
+	SchedulerTick       Duration            `json:"schedulerTick"`
+}
+
+const (
+	VotingWeighted = "weighted"
+	VotingMajority = "majority"
+	VotingQuorum   = "quorum"
+)
+
+// Anomaly scores each channel of a hardware by how many robust standard
+// deviations its latest reading lies from the median of its previous
+// BaselineSamples readings, once it has at least MinimumBaseline of them,
+// and combines the channels into one machine score. Channels are weighted by
+// Weights, keyed by metric and overridden per hardware by HardwareWeights;
+// metrics not listed weigh 1, and a weight of 0 leaves a channel out. Each
+// channel adds at most ScoreCap to the weighted mean, bounding how far one
+// flaky channel can lift it. A channel votes anomalous at ChannelThreshold.
+// With "weighted" Voting the machine score is the weighted mean, anomalous
+// once it reaches ChannelThreshold. With "majority" voting
+// the machine is anomalous once channels holding more than half the weight
+// vote so, and with "quorum" once at least Quorum channels do; until then
+// its score is 0. Series are scored from Warmup before the window asked for,
+// to fill the baselines.
+type Anomaly struct {
+	Weights          map[string]float64            `json:"weights"`
+	HardwareWeights  map[string]map[string]float64 `json:"hardwareWeights"`
+	Voting           string                        `json:"voting"`
+	Quorum           int                           `json:"quorum"`
+	ChannelThreshold float64                       `json:"channelThreshold"`
+	ScoreCap         float64                       `json:"scoreCap"`
+	BaselineSamples  int                           `json:"baselineSamples"`
+	MinimumBaseline  int                           `json:"minimumBaseline"`
+	Warmup           Duration                      `json:"warmup"`
+}
+
+// AccessLog writes one line per request in Common or Combined Log Format to
+// Path, rotating it once it reaches MaxSize bytes. An empty Path disables it.
+type AccessLog struct {
+	Path       string `json:"path"`
+	Format     string `json:"format"`
+	MaxSize    int64  `json:"maxSize"`
+	MaxBackups int    `json:"maxBackups"`
+}
+
+const (
+	EmptyHardwareRegister = "register"
+	EmptyHardwareIgnore   = "ignore"
+	EmptyHardwareNotReady = "not_ready"
+)
+
+const (
+	StorageMemory = "memory"
+	StorageFile   = "file"
+	StorageSQLite = "sqlite"
+)
+
+// Storage selects where samples are kept beyond the in-memory working set:
+// in a store held in memory and seeded from the CSV tree ("memory"), in an
+// append-only sample log at Path ("file"), or in a SQLite database at Path
+// ("sqlite"). Replicas may share either file. With one, a non-zero
+// MemoryRetention keeps only that much recent history in memory and reads
+// older samples back from the file on demand, through Breaker.
+type Storage struct {
+	Backend         string   `json:"backend"`
+	Path            string   `json:"path"`
+	MemoryRetention Duration `json:"memoryRetention"`
+	Breaker         Breaker  `json:"breaker"`
+	Journal         Journal  `json:"journal"`
+}
+
+// IsPersistent reports whether samples are kept in the file at Path.
+func (storage *Storage) IsPersistent() bool {
+	return storage.Backend == StorageFile || storage.Backend == StorageSQLite
+}
+
+// Breaker stops reading from a storage backend that is down or slow. A read
+// taking longer than ReadTimeout is given up on, and after FailureThreshold
+// reads in a row fail, reads fail fast for OpenFor before one is let through
+// to probe whether the backend has recovered.
+type Breaker struct {
+	FailureThreshold int      `json:"failureThreshold"`
+	ReadTimeout      Duration `json:"readTimeout"`
+	OpenFor          Duration `json:"openFor"`
+}
+
+// Journal keeps the last MaxChanges values that ingestion or a refresh from
+// the storage backend overwrote or added, so queries can be answered as of an
+// earlier time. As-of queries reach back as far as the oldest change kept,
+// and no further than the last load or compaction, neither of which is
+// journaled. The journal is held in memory only, so after a restart queries
+// reach back no further than the start.
+type Journal struct {
+	MaxChanges int `json:"maxChanges"`
+}
+
+// Invalidation links replicas sharing a storage backend through a Redis
+// pub/sub Channel at Address, so readings ingested on one replica are
+// reloaded by the others. An empty Address disables it.
+type Invalidation struct {
+	Address  string `json:"address"`
+	Password string `json:"password"`
+	Channel  string `json:"channel"`
+}
+
+// Loading decides what happens to hardware directories without a single
+// parsable row: registered and listed as having no data, ignored altogether,
+// or registered and also holding readiness down until data arrives.
+type Loading struct {
+	EmptyHardware string `json:"emptyHardware"`
+}
+
+// QueryLog keeps the last MaxEntries queries for review, persisting them as
+// JSON lines to Path when it is set. Path is rotated like the access log once
+// it would grow past MaxSize bytes, keeping MaxBackups older files.
+type QueryLog struct {
+	Path       string `json:"path"`
+	MaxEntries int    `json:"maxEntries"`
+	MaxSize    int64  `json:"maxSize"`
+	MaxBackups int    `json:"maxBackups"`
+}
+
+// Audit records, for regulated sites, which client accessed which hardware
+// over which window, chaining each access onto Path. An empty Path disables
+// it.
+type Audit struct {
+	Path string `json:"path"`
+}
+
+// Preferences keeps what clients store per API key, persisted to Path when it
+// is set and bounded to MaxBytes of JSON per key.
+type Preferences struct {
+	Path     string `json:"path"`
+	MaxBytes int    `json:"maxBytes"`
+}
+
+const (
+	RoleViewer   = "viewer"
+	RoleOperator = "operator"
+	RoleAdmin    = "admin"
+)
+
+// Roles lists every role a request may be granted.
+var Roles = []string{RoleViewer, RoleOperator, RoleAdmin}
+
+// Authentication identifies who makes a request and grants it roles: viewer
+// to read, operator to ingest samples and replace alert rules, admin for the
+// admin routes. Requests without credentials get AnonymousRoles, which may
+// only grant viewer once APIKeys, OIDC or SignedRequests are configured. Left
+// unset, it is every role, as before requests were authenticated, until one
+// of those is configured, and then viewer. When APIKeys is set only those keys
+// are accepted, each with its roles; otherwise any key identifies its client
+// and gets the anonymous roles.
+type Authentication struct {
+	AnonymousRoles []string            `json:"anonymousRoles"`
+	APIKeys        map[string][]string `json:"apiKeys"`
+	OIDC           OIDC                `json:"oidc"`
+	ReadOnlyTokens ReadOnlyTokens      `json:"readOnlyTokens"`
+	SignedRequests SignedRequests      `json:"signedRequests"`
+}
+
+// HasProviders reports whether any provider that vouches for operators or
+// admins is configured.
+func (authentication Authentication) HasProviders() bool {
+	return len(authentication.APIKeys) > 0 || authentication.OIDC.Issuer != "" || len(authentication.SignedRequests.Gateways) > 0
+}
+
+// Anonymous returns the roles granted to requests without credentials.
+func (authentication Authentication) Anonymous() []string {
+	switch {
+	case authentication.AnonymousRoles != nil:
+		return authentication.AnonymousRoles
+	case authentication.HasProviders():
+		return []string{RoleViewer}
+	default:
+		return Roles
+	}
+}
+
+// ReadOnlyTokens let static pages, such as demos opened from file://, read
+// the routes matching Routes with a token in their URL rather than headers
+// they cannot send. Tokens are signed with Secret, last at most MaxLifetime
+// and only ever grant viewer, on GET. Responses to them allow any origin.
+// Tokens are refused while Secret is empty.
+type ReadOnlyTokens struct {
+	Secret      string   `json:"secret"`
+	Routes      []string `json:"routes"`
+	MaxLifetime Duration `json:"maxLifetime"`
+}
+
+// SignedRequests let gateways that cannot do TLS client authentication
+// ingest with requests signed by HMAC-SHA256, keyed by a secret Gateways
+// shares with each gateway by its id. Signatures are only accepted on the
+// ingestion routes, stamped within MaxClockSkew of the server's clock and
+// once each, over bodies of at most MaxBodyBytes, and grant operator.
+// Signed requests are refused while Gateways is empty.
+type SignedRequests struct {
+	Gateways     map[string]string `json:"gateways"`
+	MaxClockSkew Duration          `json:"maxClockSkew"`
+	MaxBodyBytes int64             `json:"maxBodyBytes"`
+}
+
+// OIDC accepts bearer tokens that Issuer signed for Audience, with the keys
+// its discovery document points to, which are fetched again after
+// KeysRefresh or when a token names one not seen yet. Every valid token gets
+// DefaultRoles, plus the roles GroupRoles maps the groups listed in its
+// GroupsClaim to. Leeway allows for clocks that disagree with the issuer's.
+// Bearer tokens are refused while Issuer is empty.
+type OIDC struct {
+	Issuer       string              `json:"issuer"`
+	Audience     string              `json:"audience"`
+	GroupsClaim  string              `json:"groupsClaim"`
+	GroupRoles   map[string][]string `json:"groupRoles"`
+	DefaultRoles []string            `json:"defaultRoles"`
+	KeysRefresh  Duration            `json:"keysRefresh"`
+	Leeway       Duration            `json:"leeway"`
+}
+
+// Encryption lists the metadata fields encrypted at rest, each named by its
+// record and JSON field, e.g. "tombstone.reason". Every value of a field
+// holding a map, such as "profile.metadata", is encrypted.
+type Encryption struct {
+	Fields []string `json:"fields"`
+}
+
+// Metric registers one channel of the sample tree: the File of timestamped
+// values a hardware directory may hold, served under Key in Unit, which is one
+// of the units package's or empty for values without one. Name is the label
+// shown to people.
+type Metric struct {
+	Key  string `json:"key"`
+	Name string `json:"name"`
+	File string `json:"file"`
+	Unit string `json:"unit,omitempty"`
+}
+
+// Channel is the display metadata of one metric. Precision is the number of
+// decimals values are shown with.
+type Channel struct {
+	Precision *int `json:"precision,omitempty"`
+}
+
+type Limits struct {
+	Warning  *float64 `json:"warning,omitempty"`
+	Critical *float64 `json:"critical,omitempty"`
+}
+
+// Compensation is a linear temperature model of one vibration metric: the
+// value is lowered by Coefficient for every degree the machine runs above
+// ReferenceTemperature, and raised below it, before alert rules judge it.
+type Compensation struct {
+	ReferenceTemperature float64 `json:"referenceTemperature"`
+	Coefficient          float64 `json:"coefficient"`
+}
+
+type Config struct {
+	// TimeZone is the plant-local IANA zone used for calendar bucketing.
+	TimeZone string `json:"timeZone"`
+
+	Caching       Caching       `json:"caching"`
+	Storage       Storage       `json:"storage"`
+	Invalidation  Invalidation  `json:"invalidation"`
+	Loading       Loading       `json:"loading"`
+	Ingestion     Ingestion     `json:"ingestion"`
+	Streaming     Streaming     `json:"streaming"`
+	Interpolation Interpolation `json:"interpolation"`
+	Tabulation    Tabulation    `json:"tabulation"`
+	Consistency   Consistency   `json:"consistency"`
+	Batch         Batch         `json:"batch"`
+
+	// SLOs are tracked in the order listed. A configured list replaces the
+	// default one as a whole.
+	SLOs []SLO `json:"slos"`
+
+	Pullers        []Puller       `json:"pullers"`
+	CMMS           CMMS           `json:"cmms"`
+	Anomaly        Anomaly        `json:"anomaly"`
+	Alerting       Alerting       `json:"alerting"`
+	AccessLog      AccessLog      `json:"accessLog"`
+	QueryLog       QueryLog       `json:"queryLog"`
+	Audit          Audit          `json:"audit"`
+	Preferences    Preferences    `json:"preferences"`
+	Authentication Authentication `json:"authentication"`
+	Encryption     Encryption     `json:"encryption"`
+
+	// Metrics is the registry of channels, in the order responses list them.
+	// A configured registry replaces the default one as a whole.
+	Metrics []Metric `json:"metrics"`
+
+	// Migrations evolve the registry, in ascending order of version.
+	Migrations []Migration `json:"migrations"`
+
+	// Channels are keyed by metric.
+	Channels map[string]Channel `json:"channels"`
+
+	// Limits are keyed by metric, and HardwareLimits override them per hardware.
+	Limits         map[string]Limits            `json:"limits"`
+	HardwareLimits map[string]map[string]Limits `json:"hardwareLimits"`
+
+	// Compensation is keyed by metric, and HardwareCompensation overrides it
+	// per hardware.
+	Compensation         map[string]Compensation            `json:"compensation"`
+	HardwareCompensation map[string]map[string]Compensation `json:"hardwareCompensation"`
+
+	// ClockOffsets are keyed by hardware, and added to the timestamps it
+	// reports to correct a clock that runs a constant amount off.
+	ClockOffsets map[string]Duration `json:"clockOffsets"`
+
+	// SourceUnits are keyed by hardware, then metric, and name the unit its
+	// sample files are in, for files whose names do not say.
+	SourceUnits map[string]map[string]string `json:"sourceUnits"`
+
+	// Columns map the headings of wide CSV files and workbook sheets onto
+	// metric keys, or onto "" for columns to skip. Headings not mapped may be
+	// a metric's key, name or file name without its extension.
+	Columns map[string]string `json:"columns"`
+
+	// Tags are keyed by hardware, and group machines, such as by line or
+	// area, in fleet aggregates.
+	Tags map[string][]string `json:"tags"`
+}
+
+func (config *Config) LimitsFor(hardwareId string, metric string) (Limits, bool) {
+	if hardwareLimits, hasHardwareLimits := config.HardwareLimits[hardwareId]; hasHardwareLimits {
+		if limits, hasLimits := hardwareLimits[metric]; hasLimits {
+			return limits, true
+		}
+	}
+	limits, hasLimits := config.Limits[metric]
+	return limits, hasLimits
+}
+
+// WeightOf is the weight the anomaly score of a hardware gives a metric.
+func (config *Config) WeightOf(hardwareId string, metric string) float64 {
+	if hardwareWeights, hasHardwareWeights := config.Anomaly.HardwareWeights[hardwareId]; hasHardwareWeights {
+		if weight, hasWeight := hardwareWeights[metric]; hasWeight {
+			return weight
+		}
+	}
+	if weight, hasWeight := config.Anomaly.Weights[metric]; hasWeight {
+		return weight
+	}
+	return 1
+}
+
+func (config *Config) CompensationFor(hardwareId string, metric string) (Compensation, bool) {
+	if hardwareCompensation, hasHardwareCompensation := config.HardwareCompensation[hardwareId]; hasHardwareCompensation {
+		if compensation, hasCompensation := hardwareCompensation[metric]; hasCompensation {
+			return compensation, true
+		}
+	}
+	compensation, hasCompensation := config.Compensation[metric]
+	return compensation, hasCompensation
+}
+
+// MetricFor looks a metric of the registry up by key.
+func (config *Config) MetricFor(key string) (Metric, bool) {
+	for _, metric := range config.Metrics {
+		if metric.Key == key {
+			return metric, true
+		}
+	}
+	return Metric{}, false
+}
+
+func (config *Config) PrecisionOf(metric string) (int, bool) {
+	channel, hasChannel := config.Channels[metric]
+	if !hasChannel || channel.Precision == nil {
+		return 0, false
+	}
+	return *channel.Precision, true
+}
+
+func precision(decimals int) *int {
+	return &decimals
+}
+
+func (config *Config) Location() *time.Location {
+	location, err := time.LoadLocation(config.TimeZone)
+	if err != nil {
+		return time.UTC
+	}
+	return location
+}
+
+// CSVOptions is the dialect of ingested CSV, reading timestamps without a
+// time zone in the plant's.
+func (config *Config) CSVOptions() csvparse.Options {
+	options := config.Ingestion.CSV
+	options.Location = config.Location()
+	return options
+}
+
+func Default() *Config {
+	return &Config{
+		TimeZone: "UTC",
+		Caching: Caching{
+			Enabled:          true,
+			HistoricalMaxAge: Duration{24 * time.Hour},
+			LiveMaxAge:       Duration{10 * time.Second},
+			LiveWindow:       Duration{time.Hour},
+		},
+		Storage: Storage{
+			Backend: StorageMemory,
+			Breaker: Breaker{
+				FailureThreshold: 3,
+				ReadTimeout:      Duration{5 * time.Second},
+				OpenFor:          Duration{30 * time.Second},
+			},
+			Journal: Journal{
+				MaxChanges: 200000,
+			},
+		},
+		Invalidation: Invalidation{
+			Channel: "kcf:invalidation",
+		},
+		CMMS: CMMS{
+			NameField:        "name",
+			CriticalityField: "criticality",
+			TTL:              Duration{time.Hour},
+			FailureTTL:       Duration{time.Minute},
+			Timeout:          Duration{5 * time.Second},
+			Concurrency:      8,
+		},
+		Loading: Loading{
+			EmptyHardware: EmptyHardwareRegister,
+		},
+		Ingestion: Ingestion{
+			MaxFutureSkew: Duration{5 * time.Minute},
+			MaxJSONBytes:  16 << 20,
+			Workbooks: Workbooks{
+				TimestampColumn: "timestamp",
+				MaxBytes:        64 << 20,
+				MaxPartBytes:    256 << 20,
+				MaxRows:         1 << 20,
+			},
+			ArrivalLag: ArrivalLag{
+				Window:  Duration{time.Hour},
+				Windows: 48,
+			},
+		},
+		Streaming: Streaming{
+			EmitInterval: Duration{time.Second},
+			KeepAlive:    Duration{15 * time.Second},
+			Buffer:       1024,
+		},
+		Interpolation: Interpolation{
+			MaxLookbackIntervals:  3,
+			MaxLookaheadIntervals: 3,
+		},
+		Tabulation: Tabulation{
+			MaxCount: 10000,
+		},
+		Batch: Batch{
+			MaxRequests: 50,
+			Concurrency: 8,
+		},
+		SLOs: []SLO{
+			{Name: "tabulation", Route: "/api/tabulated_hardware", Threshold: Duration{200 * time.Millisecond}, Objective: 0.95, Windows: []Duration{{5 * time.Minute}, {time.Hour}}},
+		},
+		Consistency: Consistency{
+			Bounds: []Bound{
+				{Metric: "rmsVelocityX", AtMost: "peakVelocityX"},
+				{Metric: "rmsAccelerationX", AtMost: "peakAccelerationX"},
+				{Metric: "rmsVelocityY", AtMost: "peakVelocityY"},
+				{Metric: "rmsAccelerationY", AtMost: "peakAccelerationY"},
+			},
+			Window: Duration{30 * time.Second},
+		},
+		Anomaly: Anomaly{
+			Voting:           VotingQuorum,
+			Quorum:           2,
+			ChannelThreshold: 3.5,
+			ScoreCap:         10,
+			BaselineSamples:  120,
+			MinimumBaseline:  20,
+			Warmup:           Duration{24 * time.Hour},
+		},
+		Alerting: Alerting{
+			HistoryLimit:  1000,
+			SendTimeout:   Duration{10 * time.Second},
+			SchedulerTick: Duration{time.Second},
+		},
+		AccessLog: AccessLog{
+			Format:     "combined",
+			MaxSize:    10 << 20,
+			MaxBackups: 5,
+		},
+		QueryLog: QueryLog{
+			MaxEntries: 10000,
+			MaxSize:    10 << 20,
+			MaxBackups: 5,
+		},
+		Preferences: Preferences{
+			Path:     "preferences.json",
+			MaxBytes: 16 << 10,
+		},
+		Authentication: Authentication{
+			OIDC: OIDC{
+				GroupsClaim:  "groups",
+				DefaultRoles: []string{RoleViewer},
+				KeysRefresh:  Duration{time.Hour},
+				Leeway:       Duration{time.Minute},
+			},
+			ReadOnlyTokens: ReadOnlyTokens{
+				Routes:      []string{"/api/overview", "/api/hardware", "/api/dictionary", "/api/hardware/*/sparkline", "/api/hardware/*/panel"},
+				MaxLifetime: Duration{7 * 24 * time.Hour},
+			},
+			SignedRequests: SignedRequests{
+				MaxClockSkew: Duration{5 * time.Minute},
+				MaxBodyBytes: 16 << 20,
+			},
+		},
+		Metrics: []Metric{
+			{Key: "temperature", Name: "Temperature", File: "temperature.csv", Unit: "c"},
+			{Key: "peakVelocityX", Name: "Peak velocity X", File: "peak_velocity_x.csv", Unit: "mms"},
+			{Key: "rmsVelocityX", Name: "RMS velocity X", File: "rms_velocity_x.csv", Unit: "mms"},
+			{Key: "peakAccelerationX", Name: "Peak acceleration X", File: "peak_acceleration_x.csv", Unit: "g"},
+			{Key: "rmsAccelerationX", Name: "RMS acceleration X", File: "rms_acceleration_x.csv", Unit: "g"},
+			{Key: "peakVelocityY", Name: "Peak velocity Y", File: "peak_velocity_y.csv", Unit: "mms"},
+			{Key: "rmsVelocityY", Name: "RMS velocity Y", File: "rms_velocity_y.csv", Unit: "mms"},
+			{Key: "peakAccelerationY", Name: "Peak acceleration Y", File: "peak_acceleration_y.csv", Unit: "g"},
+			{Key: "rmsAccelerationY", Name: "RMS acceleration Y", File: "rms_acceleration_y.csv", Unit: "g"},
+		},
+		Channels: map[string]Channel{
+			"temperature":       {Precision: precision(1)},
+			"peakVelocityX":     {Precision: precision(3)},
+			"rmsVelocityX":      {Precision: precision(3)},
+			"peakAccelerationX": {Precision: precision(3)},
+			"rmsAccelerationX":  {Precision: precision(3)},
+			"peakVelocityY":     {Precision: precision(3)},
+			"rmsVelocityY":      {Precision: precision(3)},
+			"peakAccelerationY": {Precision: precision(3)},
+			"rmsAccelerationY":  {Precision: precision(3)},
+		},
+	}
+}
+
+var Current *Config = Default()
+
+func Load(configPath string) error {
+	configBytes, err := os.ReadFile(configPath)
+	if err != nil {
+		return fmt.Errorf(`unable to read config file "%s": %w`, configPath, err)
+	}
+
+	// Decoded into the default registry, a configured one would inherit
+	// whatever its entries leave out from the default metric in their place
+	loadedConfig := Default()
+	loadedConfig.Metrics, loadedConfig.Consistency.Bounds, loadedConfig.SLOs = nil, nil, nil
+	if err := decodeStrictly(configBytes, loadedConfig); err != nil {
+		return fmt.Errorf(`unable to parse config file "%s": %w`, configPath, err)
+	}
+	if loadedConfig.Metrics == nil {
+		loadedConfig.Metrics = Default().Metrics
+	}
+	if loadedConfig.SLOs == nil {
+		loadedConfig.SLOs = Default().SLOs
+	}
+	if loadedConfig.Consistency.Bounds == nil {
+		// Only the default bounds the registry has both metrics of apply
+		loadedConfig.Consistency.Bounds = make([]Bound, 0)
+		for _, bound := range Default().Consistency.Bounds {
+			_, hasMetric := loadedConfig.MetricFor(bound.Metric)
+			_, hasBound := loadedConfig.MetricFor(bound.AtMost)
+			if hasMetric && hasBound {
+				loadedConfig.Consistency.Bounds = append(loadedConfig.Consistency.Bounds, bound)
+			}
+		}
+	}
+	if err := loadedConfig.Validate(); err != nil {
+		return fmt.Errorf(`invalid config file "%s": %w`, configPath, err)
+	}
+
+	Current = loadedConfig
+	return nil
+}
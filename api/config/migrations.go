@@ -0,0 +1,96 @@
+package config
+
+import "time"
+
+// Migration evolves the channel registry to Version, so data stored under
+// earlier registries loads as it is rather than being rewritten or wiped.
+// Former channels are named as they were stored: by metric key in a
+// sample log, by file name, such as "vibration.csv", in a sample tree. A
+// migration may name what an earlier one migrated to, and channels the
+// registry still has are never migrated.
+type Migration struct {
+	Version int `json:"version"`
+
+	// Renames map former channels onto the metric now holding their values.
+	Renames map[string]string `json:"renames,omitempty"`
+
+	// Splits map former channels onto metrics that each take their values.
+	Splits map[string][]string `json:"splits,omitempty"`
+
+	// Units are keyed by metric, naming the unit its values stamped before
+	// Effective were stored in.
+	Units     map[string]string `json:"units,omitempty"`
+	Effective time.Time         `json:"effective,omitempty"`
+}
+
+// RegistryVersion is the version the migrations bring the registry to, 0
+// without any.
+func (config *Config) RegistryVersion() int {
+	if len(config.Migrations) == 0 {
+		return 0
+	}
+	return config.Migrations[len(config.Migrations)-1].Version
+}
+
+// replacements are the channels a migration moves, onto what they move to.
+func (migration *Migration) replacements() map[string][]string {
+	replacements := make(map[string][]string, len(migration.Renames)+len(migration.Splits))
+	for former, metricKey := range migration.Renames {
+		replacements[former] = []string{metricKey}
+	}
+	for former, metricKeys := range migration.Splits {
+		replacements[former] = metricKeys
+	}
+	return replacements
+}
+
+// migrateFrom follows channels through the migrations from index on.
+func (config *Config) migrateFrom(index int, channels []string) []string {
+	for ; index < len(config.Migrations); index++ {
+		replacements := config.Migrations[index].replacements()
+		migrated := make([]string, 0, len(channels))
+		for _, channel := range channels {
+			if replacement, isReplaced := replacements[channel]; isReplaced {
+				migrated = append(migrated, replacement...)
+			} else {
+				migrated = append(migrated, channel)
+			}
+		}
+		channels = migrated
+	}
+	return channels
+}
+
+// MigratedChannels maps every former channel onto the metrics of the
+// current registry its values now belong to.
+func (config *Config) MigratedChannels() map[string][]string {
+	migratedChannels := make(map[string][]string)
+	for migrationIndex := range config.Migrations {
+		for former := range config.Migrations[migrationIndex].replacements() {
+			migratedChannels[former] = config.migrateFrom(migrationIndex, []string{former})
+		}
+	}
+	return migratedChannels
+}
+
+// UnitMigration is a unit a metric of the current registry was stored in
+// before some instant.
+type UnitMigration struct {
+	Metric string
+	Unit   string
+	Before time.Time
+}
+
+// UnitMigrations lists the unit changes of the migrations, the earliest
+// first, with their metrics followed through later renames and splits.
+func (config *Config) UnitMigrations() []UnitMigration {
+	unitMigrations := make([]UnitMigration, 0)
+	for migrationIndex, migration := range config.Migrations {
+		for metricKey, unit := range migration.Units {
+			for _, migratedKey := range config.migrateFrom(migrationIndex+1, []string{metricKey}) {
+				unitMigrations = append(unitMigrations, UnitMigration{Metric: migratedKey, Unit: unit, Before: migration.Effective})
+			}
+		}
+	}
+	return unitMigrations
+}
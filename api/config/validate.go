@@ -0,0 +1,588 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/url"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/units"
+)
+
+var metricKeyPattern = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_]*$`)
+
+// position turns a byte offset into the 1-based line and column an editor
+// shows.
+func position(data []byte, offset int64) (int, int) {
+	if offset > int64(len(data)) {
+		offset = int64(len(data))
+	}
+	before := data[:offset]
+	line := bytes.Count(before, []byte("\n")) + 1
+	column := len(before) - bytes.LastIndexByte(before, '\n')
+	return line, column
+}
+
+// decodeStrictly decodes data into config, rejecting unknown keys and
+// reporting where in data decoding stopped.
+func decodeStrictly(data []byte, config *Config) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+
+	err := decoder.Decode(config)
+	if err == nil {
+		if decoder.More() {
+			line, column := position(data, decoder.InputOffset())
+			return fmt.Errorf(`line %d, column %d: unexpected data after the configuration`, line, column)
+		}
+		return nil
+	}
+
+	offset := decoder.InputOffset()
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &syntaxErr):
+		offset = syntaxErr.Offset
+	case errors.As(err, &typeErr):
+		offset = typeErr.Offset
+		err = fmt.Errorf(`"%s" must be %s, not %s`, typeErr.Field, typeErr.Type, typeErr.Value)
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		offset = int64(len(data))
+	case strings.HasPrefix(err.Error(), `json: unknown field "`):
+		// The decoder only notices unknown keys once it has read the whole
+		// object, so point at the key itself instead
+		unknownKey := strings.TrimPrefix(err.Error(), `json: unknown field `)
+		if keyPattern, compileErr := regexp.Compile(regexp.QuoteMeta(unknownKey) + `\s*:`); compileErr == nil {
+			if locations := keyPattern.FindAllIndex(data[:offset], -1); len(locations) > 0 {
+				offset = int64(locations[len(locations)-1][0]) + 1
+			}
+		}
+	}
+	line, column := position(data, offset)
+	return fmt.Errorf(`line %d, column %d: %s`, line, column, strings.TrimPrefix(err.Error(), "json: "))
+}
+
+// Validate checks the values that decoding alone cannot, collecting every
+// problem so they can all be fixed in one go.
+func (config *Config) Validate() error {
+	problems := make([]string, 0)
+	problem := func(format string, arguments ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, arguments...))
+	}
+
+	if _, err := time.LoadLocation(config.TimeZone); err != nil {
+		problem(`timeZone: unknown time zone "%s"`, config.TimeZone)
+	}
+
+	for name, duration := range map[string]Duration{
+		"caching.historicalMaxAge": config.Caching.HistoricalMaxAge,
+		"caching.liveMaxAge":       config.Caching.LiveMaxAge,
+		"caching.liveWindow":       config.Caching.LiveWindow,
+		"ingestion.maxFutureSkew":  config.Ingestion.MaxFutureSkew,
+		"storage.memoryRetention":  config.Storage.MemoryRetention,
+		"streaming.emitInterval":   config.Streaming.EmitInterval,
+		"streaming.keepAlive":      config.Streaming.KeepAlive,
+		"alerting.lookback":        config.Alerting.Lookback,
+		"anomaly.warmup":           config.Anomaly.Warmup,
+	} {
+		if duration.Duration < 0 {
+			problem(`%s: must not be negative, got %s`, name, duration)
+		}
+	}
+
+	switch config.Storage.Backend {
+	case StorageMemory:
+	case StorageFile:
+		if config.Storage.Path == "" {
+			problem(`storage.path: the "%s" backend needs the path of its sample log`, StorageFile)
+		}
+	case StorageSQLite:
+		if config.Storage.Path == "" {
+			problem(`storage.path: the "%s" backend needs the path of its database`, StorageSQLite)
+		}
+	default:
+		problem(`storage.backend: must be "%s", "%s" or "%s", got "%s"`, StorageMemory, StorageFile, StorageSQLite, config.Storage.Backend)
+	}
+	if config.Storage.MemoryRetention.Duration > 0 && !config.Storage.IsPersistent() {
+		problem(`storage.memoryRetention: needs the "%s" or "%s" backend to fall back to`, StorageFile, StorageSQLite)
+	}
+	if config.Storage.Breaker.FailureThreshold < 1 {
+		problem(`storage.breaker.failureThreshold: must be at least 1, got %d`, config.Storage.Breaker.FailureThreshold)
+	}
+	if config.Storage.Breaker.ReadTimeout.Duration <= 0 {
+		problem(`storage.breaker.readTimeout: must be positive, got %v`, config.Storage.Breaker.ReadTimeout.Duration)
+	}
+	if config.Storage.Breaker.OpenFor.Duration <= 0 {
+		problem(`storage.breaker.openFor: must be positive, got %v`, config.Storage.Breaker.OpenFor.Duration)
+	}
+	if config.Storage.Journal.MaxChanges < 0 {
+		problem(`storage.journal.maxChanges: must not be negative, got %d`, config.Storage.Journal.MaxChanges)
+	}
+
+	if config.Invalidation.Address != "" {
+		if !config.Storage.IsPersistent() {
+			problem(`invalidation: needs the "%s" or "%s" storage backend to reload from`, StorageFile, StorageSQLite)
+		}
+		if config.Invalidation.Channel == "" {
+			problem(`invalidation.channel: is required`)
+		}
+	}
+
+	switch config.Loading.EmptyHardware {
+	case EmptyHardwareRegister, EmptyHardwareIgnore, EmptyHardwareNotReady:
+	default:
+		problem(`loading.emptyHardware: must be "%s", "%s" or "%s", got "%s"`, EmptyHardwareRegister, EmptyHardwareIgnore, EmptyHardwareNotReady, config.Loading.EmptyHardware)
+	}
+
+	if config.Streaming.Buffer < 1 {
+		problem(`streaming.buffer: must be positive, got %d`, config.Streaming.Buffer)
+	}
+
+	if config.Interpolation.MaxLookbackIntervals < 0 || config.Interpolation.MaxLookaheadIntervals < 0 {
+		problem(`interpolation: interval bounds must not be negative`)
+	}
+	if config.Tabulation.MaxCount < 0 {
+		problem(`tabulation.maxCount: must not be negative, got %d`, config.Tabulation.MaxCount)
+	}
+
+	if config.Batch.MaxRequests < 1 || config.Batch.Concurrency < 1 {
+		problem(`batch: maxRequests and concurrency must be positive, got %d and %d`, config.Batch.MaxRequests, config.Batch.Concurrency)
+	}
+
+	sloNames := make(map[string]bool)
+	for sloIndex, slo := range config.SLOs {
+		field := fmt.Sprintf(`slos[%d]`, sloIndex)
+		switch {
+		case slo.Name == "":
+			problem(`%s.name: is required`, field)
+		case sloNames[slo.Name]:
+			problem(`%s.name: "%s" is used more than once`, field, slo.Name)
+		}
+		sloNames[slo.Name] = true
+		if slo.Route == "" {
+			problem(`%s.route: is required`, field)
+		}
+		if slo.Threshold.Duration <= 0 {
+			problem(`%s.threshold: must be positive, got %s`, field, slo.Threshold.Duration)
+		}
+		if slo.Objective <= 0 || slo.Objective >= 1 {
+			problem(`%s.objective: must be between 0 and 1, got %g`, field, slo.Objective)
+		}
+		if len(slo.Windows) == 0 {
+			problem(`%s.windows: at least one is required`, field)
+		}
+		for _, window := range slo.Windows {
+			if window.Duration < time.Minute || window.Duration > 7*24*time.Hour || window.Duration%time.Minute != 0 {
+				problem(`%s.windows: %s must be whole minutes, from 1m to 168h`, field, window.Duration)
+			}
+		}
+	}
+
+	pullerNames := make(map[string]bool)
+	for pullerIndex, puller := range config.Pullers {
+		field := fmt.Sprintf(`pullers[%d]`, pullerIndex)
+		switch {
+		case puller.Name == "":
+			problem(`%s.name: is required`, field)
+		case pullerNames[puller.Name]:
+			problem(`%s.name: "%s" is used by another puller`, field, puller.Name)
+		}
+		pullerNames[puller.Name] = true
+		if puller.URL == "" {
+			problem(`%s.url: is required`, field)
+		}
+		if puller.Interval.Duration <= 0 {
+			problem(`%s.interval: is required and must be positive`, field)
+		}
+		switch puller.Format {
+		case "csv":
+			if puller.HardwareId == "" {
+				problem(`%s.hardwareId: is required for CSV sources`, field)
+			}
+		case "json":
+		default:
+			problem(`%s.format: must be "csv" or "json", got "%s"`, field, puller.Format)
+		}
+	}
+
+	if cmms := config.CMMS; cmms.URL != "" {
+		if parsedURL, err := url.Parse(strings.ReplaceAll(cmms.URL, "{hardwareId}", "id")); err != nil || (parsedURL.Scheme != "http" && parsedURL.Scheme != "https") || parsedURL.Host == "" {
+			problem(`cmms.url: must be an http or https URL, got "%s"`, cmms.URL)
+		} else if !strings.Contains(cmms.URL, "{hardwareId}") {
+			problem(`cmms.url: must place the hardware with {hardwareId}, got "%s"`, cmms.URL)
+		}
+		if cmms.NameField == "" && cmms.CriticalityField == "" {
+			problem(`cmms: nameField or criticalityField is required`)
+		}
+		if cmms.TTL.Duration <= 0 || cmms.FailureTTL.Duration <= 0 || cmms.Timeout.Duration <= 0 {
+			problem(`cmms: ttl, failureTtl and timeout must be positive, got %v, %v and %v`, cmms.TTL.Duration, cmms.FailureTTL.Duration, cmms.Timeout.Duration)
+		}
+		if cmms.Concurrency < 1 {
+			problem(`cmms.concurrency: must be at least 1, got %d`, cmms.Concurrency)
+		}
+	}
+
+	if config.Alerting.HistoryLimit < 0 {
+		problem(`alerting.historyLimit: must not be negative, got %d`, config.Alerting.HistoryLimit)
+	}
+	for webhookIndex, webhook := range config.Alerting.Webhooks {
+		if parsedURL, err := url.Parse(webhook.URL); err != nil || (parsedURL.Scheme != "http" && parsedURL.Scheme != "https") {
+			problem(`alerting.webhooks[%d].url: must be an http or https URL, got "%s"`, webhookIndex, webhook.URL)
+		}
+	}
+	if config.Alerting.SendTimeout.Duration <= 0 {
+		problem(`alerting.sendTimeout: must be positive, got %v`, config.Alerting.SendTimeout.Duration)
+	}
+	if config.Alerting.SchedulerTick.Duration <= 0 {
+		problem(`alerting.schedulerTick: must be positive, got %v`, config.Alerting.SchedulerTick.Duration)
+	}
+	for metric, interval := range config.Alerting.EvaluationIntervals {
+		if interval.Duration < config.Alerting.SchedulerTick.Duration {
+			problem(`alerting.evaluationIntervals.%s: must be at least the scheduler tick of %v, got %v`, metric, config.Alerting.SchedulerTick.Duration, interval.Duration)
+		}
+	}
+	notifierNames := make(map[string]bool)
+	for notifierIndex, notifier := range config.Alerting.Notifiers {
+		field := fmt.Sprintf(`alerting.notifiers[%d]`, notifierIndex)
+		if notifier.Name != "" {
+			if notifierNames[notifier.Name] {
+				problem(`%s.name: "%s" is already taken`, field, notifier.Name)
+			}
+			notifierNames[notifier.Name] = true
+		}
+		// Kinds a site registered are checked as the alerts package builds them
+		schemes := map[string][]string{
+			NotifierWebhook: {"http", "https"},
+			NotifierSMS:     {"http", "https"},
+			NotifierEmail:   {"smtp", "smtps"},
+			NotifierMQTT:    {"mqtt", "mqtts"},
+		}[notifier.Kind]
+		switch {
+		case notifier.Kind == "":
+			problem(`%s.kind: is required`, field)
+			continue
+		case schemes == nil:
+			continue
+		}
+		if parsedURL, err := url.Parse(notifier.URL); err != nil || parsedURL.Host == "" || (parsedURL.Scheme != schemes[0] && parsedURL.Scheme != schemes[1]) {
+			problem(`%s.url: must be a %s or %s URL, got "%s"`, field, schemes[0], schemes[1], notifier.URL)
+		}
+		if (notifier.Kind == NotifierEmail || notifier.Kind == NotifierSMS) && len(notifier.To) == 0 {
+			problem(`%s.to: a %s notifier needs at least one recipient`, field, notifier.Kind)
+		}
+		if notifier.Kind == NotifierEmail && notifier.From == "" {
+			problem(`%s.from: an email notifier needs a sender`, field)
+		}
+		if notifier.Kind == NotifierMQTT && (notifier.Topic == "" || strings.ContainsAny(notifier.Topic, "+#")) {
+			problem(`%s.topic: an mqtt notifier needs a topic without wildcards, got "%s"`, field, notifier.Topic)
+		}
+	}
+
+	if config.AccessLog.Path != "" {
+		if config.AccessLog.Format != "common" && config.AccessLog.Format != "combined" {
+			problem(`accessLog.format: must be "common" or "combined", got "%s"`, config.AccessLog.Format)
+		}
+		if config.AccessLog.MaxSize < 0 || config.AccessLog.MaxBackups < 0 {
+			problem(`accessLog: maxSize and maxBackups must not be negative`)
+		}
+	}
+
+	if config.QueryLog.MaxEntries < 0 {
+		problem(`queryLog.maxEntries: must not be negative, got %d`, config.QueryLog.MaxEntries)
+	}
+	if config.QueryLog.MaxSize < 0 || config.QueryLog.MaxBackups < 0 {
+		problem(`queryLog: maxSize and maxBackups must not be negative`)
+	}
+
+	if config.Preferences.MaxBytes < 1 {
+		problem(`preferences.maxBytes: must be positive, got %d`, config.Preferences.MaxBytes)
+	}
+
+	checkRoles := func(field string, roles []string) {
+		for _, role := range roles {
+			if role != RoleViewer && role != RoleOperator && role != RoleAdmin {
+				problem(`%s: unknown role "%s", must be one of %s`, field, role, strings.Join(Roles, ", "))
+			}
+		}
+	}
+	checkRoles(`authentication.anonymousRoles`, config.Authentication.AnonymousRoles)
+	// Otherwise leaving credentials out would get past the providers
+	if config.Authentication.HasProviders() {
+		for _, role := range config.Authentication.AnonymousRoles {
+			if role == RoleOperator || role == RoleAdmin {
+				problem(`authentication.anonymousRoles: must not grant "%s" once apiKeys, oidc or signedRequests are configured`, role)
+			}
+		}
+	}
+	for apiKey, roles := range config.Authentication.APIKeys {
+		if apiKey == "" {
+			problem(`authentication.apiKeys: keys must not be empty`)
+		}
+		// Keys are secrets, so problems do not name them
+		checkRoles(`authentication.apiKeys`, roles)
+	}
+	if oidc := config.Authentication.OIDC; oidc.Issuer != "" {
+		if parsedURL, err := url.Parse(oidc.Issuer); err != nil || (parsedURL.Scheme != "http" && parsedURL.Scheme != "https") || parsedURL.Host == "" {
+			problem(`authentication.oidc.issuer: must be an http or https URL, got "%s"`, oidc.Issuer)
+		}
+		if oidc.Audience == "" {
+			problem(`authentication.oidc.audience: is required with an issuer`)
+		}
+		if oidc.KeysRefresh.Duration <= 0 || oidc.Leeway.Duration < 0 {
+			problem(`authentication.oidc: keysRefresh must be positive and leeway not negative, got %v and %v`, oidc.KeysRefresh.Duration, oidc.Leeway.Duration)
+		}
+		checkRoles(`authentication.oidc.defaultRoles`, oidc.DefaultRoles)
+		for group, roles := range oidc.GroupRoles {
+			checkRoles(fmt.Sprintf(`authentication.oidc.groupRoles["%s"]`, group), roles)
+		}
+	}
+	readOnlyTokens := config.Authentication.ReadOnlyTokens
+	for _, route := range readOnlyTokens.Routes {
+		if _, err := path.Match(route, ""); err != nil || !strings.HasPrefix(route, "/api/") {
+			problem(`authentication.readOnlyTokens.routes: "%s" must be an API path, with * for any one segment`, route)
+		}
+	}
+	if readOnlyTokens.Secret != "" && readOnlyTokens.MaxLifetime.Duration <= 0 {
+		problem(`authentication.readOnlyTokens.maxLifetime: must be positive, got %v`, readOnlyTokens.MaxLifetime.Duration)
+	}
+	signedRequests := config.Authentication.SignedRequests
+	for gatewayId, secret := range signedRequests.Gateways {
+		if gatewayId == "" {
+			problem(`authentication.signedRequests.gateways: gateway ids must not be empty`)
+		} else if len(secret) < 16 {
+			// Secrets are secrets, so problems only name the gateway
+			problem(`authentication.signedRequests.gateways["%s"]: secret must be at least 16 bytes`, gatewayId)
+		}
+	}
+	if len(signedRequests.Gateways) > 0 && (signedRequests.MaxClockSkew.Duration <= 0 || signedRequests.MaxBodyBytes <= 0) {
+		problem(`authentication.signedRequests: maxClockSkew and maxBodyBytes must be positive, got %v and %d`, signedRequests.MaxClockSkew.Duration, signedRequests.MaxBodyBytes)
+	}
+
+	for _, field := range config.Encryption.Fields {
+		if record, name, hasSeparator := strings.Cut(field, "."); !hasSeparator || record == "" || name == "" {
+			problem(`encryption.fields: "%s" must name a record and field, e.g. "tombstone.reason"`, field)
+		}
+	}
+
+	for metric, channel := range config.Channels {
+		if channel.Precision != nil && (*channel.Precision < 0 || *channel.Precision > 15) {
+			problem(`channels.%s.precision: must be between 0 and 15, got %d`, metric, *channel.Precision)
+		}
+	}
+
+	validateLimits := func(field string, limits Limits) {
+		if limits.Warning != nil && limits.Critical != nil && *limits.Warning > *limits.Critical {
+			problem(`%s: warning %g is above critical %g`, field, *limits.Warning, *limits.Critical)
+		}
+	}
+	for metric, limits := range config.Limits {
+		validateLimits("limits."+metric, limits)
+	}
+	for hardwareId, hardwareLimits := range config.HardwareLimits {
+		for metric, limits := range hardwareLimits {
+			validateLimits("hardwareLimits."+hardwareId+"."+metric, limits)
+		}
+	}
+
+	// Compensating temperature for itself would always cancel out
+	if _, hasCompensation := config.Compensation["temperature"]; hasCompensation {
+		problem(`compensation.temperature: temperature cannot be compensated for itself`)
+	}
+	for hardwareId, hardwareCompensation := range config.HardwareCompensation {
+		if _, hasCompensation := hardwareCompensation["temperature"]; hasCompensation {
+			problem(`hardwareCompensation.%s.temperature: temperature cannot be compensated for itself`, hardwareId)
+		}
+	}
+
+	if len(config.Metrics) == 0 {
+		problem(`metrics: at least one metric must be registered`)
+	}
+	metricKeys, metricFiles := make(map[string]bool), make(map[string]bool)
+	for metricIndex, metric := range config.Metrics {
+		field := fmt.Sprintf(`metrics[%d]`, metricIndex)
+		switch {
+		case !metricKeyPattern.MatchString(metric.Key):
+			problem(`%s.key: must be letters, digits and underscores, starting with a letter, got "%s"`, field, metric.Key)
+		case metricKeys[metric.Key]:
+			problem(`%s.key: "%s" is used by another metric`, field, metric.Key)
+		}
+		metricKeys[metric.Key] = true
+		switch {
+		case !strings.HasSuffix(metric.File, ".csv") || path.Base(metric.File) != metric.File || strings.Contains(metric.File, `\`):
+			problem(`%s.file: must be a file name ending in .csv, got "%s"`, field, metric.File)
+		case metricFiles[metric.File]:
+			problem(`%s.file: "%s" is read by another metric`, field, metric.File)
+		}
+		metricFiles[metric.File] = true
+		if _, isKnown := units.Lookup(metric.Unit); metric.Unit != "" && !isKnown {
+			problem(`%s.unit: unknown unit "%s", must be one of %s`, field, metric.Unit, strings.Join(units.Names(), ", "))
+		}
+	}
+
+	var lastEffective time.Time
+	for migrationIndex, migration := range config.Migrations {
+		field := fmt.Sprintf(`migrations[%d]`, migrationIndex)
+		if migrationIndex == 0 && migration.Version < 1 {
+			problem(`%s.version: must be at least 1, got %d`, field, migration.Version)
+		} else if migrationIndex > 0 && migration.Version <= config.Migrations[migrationIndex-1].Version {
+			problem(`%s.version: must be above the version before it, got %d`, field, migration.Version)
+		}
+		for former, metricKeys := range migration.Splits {
+			if len(metricKeys) < 2 {
+				problem(`%s.splits["%s"]: must split into at least two metrics`, field, former)
+			}
+		}
+		for former := range migration.replacements() {
+			if _, isMetric := config.MetricFor(former); isMetric || metricFiles[former] {
+				problem(`%s: "%s" is still registered, so cannot be migrated`, field, former)
+			}
+		}
+		if len(migration.Units) > 0 {
+			if migration.Effective.IsZero() {
+				problem(`%s.effective: is required to change units`, field)
+			} else if migration.Effective.Before(lastEffective) {
+				problem(`%s.effective: must not precede that of an earlier migration`, field)
+			}
+			lastEffective = migration.Effective
+		}
+	}
+	for former, metricKeys := range config.MigratedChannels() {
+		for _, metricKey := range metricKeys {
+			if _, isMetric := config.MetricFor(metricKey); !isMetric {
+				problem(`migrations: "%s" migrates to "%s", which is not a registered metric`, former, metricKey)
+			}
+		}
+	}
+	for _, unitMigration := range config.UnitMigrations() {
+		metric, isMetric := config.MetricFor(unitMigration.Metric)
+		if !isMetric {
+			problem(`migrations: units of "%s", which is not a registered metric, cannot change`, unitMigration.Metric)
+		} else if _, err := units.Converter(unitMigration.Unit, metric.Unit); err != nil {
+			problem(`migrations: values of "%s" stored in %s: %v`, unitMigration.Metric, unitMigration.Unit, err)
+		}
+	}
+
+	for boundIndex, bound := range config.Consistency.Bounds {
+		field := fmt.Sprintf(`consistency.bounds[%d]`, boundIndex)
+		for _, metricKey := range []string{bound.Metric, bound.AtMost} {
+			if _, isMetric := config.MetricFor(metricKey); !isMetric {
+				problem(`%s: "%s" is not a registered metric`, field, metricKey)
+			}
+		}
+		if bound.Metric == bound.AtMost {
+			problem(`%s: "%s" cannot bound itself`, field, bound.Metric)
+		}
+	}
+	validateWeights := func(field string, weights map[string]float64) {
+		for metricKey, weight := range weights {
+			if _, isMetric := config.MetricFor(metricKey); !isMetric {
+				problem(`%s.%s: not a registered metric`, field, metricKey)
+			}
+			if !(weight >= 0) || math.IsInf(weight, 1) {
+				problem(`%s.%s: must be a finite weight of at least 0, got %g`, field, metricKey, weight)
+			}
+		}
+	}
+	validateWeights("anomaly.weights", config.Anomaly.Weights)
+	for hardwareId, hardwareWeights := range config.Anomaly.HardwareWeights {
+		validateWeights("anomaly.hardwareWeights."+hardwareId, hardwareWeights)
+	}
+	switch config.Anomaly.Voting {
+	case VotingWeighted, VotingMajority:
+	case VotingQuorum:
+		if config.Anomaly.Quorum < 1 {
+			problem(`anomaly.quorum: must be at least 1, got %d`, config.Anomaly.Quorum)
+		}
+	default:
+		problem(`anomaly.voting: must be "%s", "%s" or "%s", got "%s"`, VotingWeighted, VotingMajority, VotingQuorum, config.Anomaly.Voting)
+	}
+	if !(config.Anomaly.ChannelThreshold > 0) {
+		problem(`anomaly.channelThreshold: must be positive, got %g`, config.Anomaly.ChannelThreshold)
+	}
+	if !(config.Anomaly.ScoreCap >= config.Anomaly.ChannelThreshold) {
+		problem(`anomaly.scoreCap: must be at least the channel threshold %g, got %g`, config.Anomaly.ChannelThreshold, config.Anomaly.ScoreCap)
+	}
+	if config.Anomaly.MinimumBaseline < 3 || config.Anomaly.BaselineSamples < config.Anomaly.MinimumBaseline {
+		problem(`anomaly: the minimum baseline must be at least 3 and at most the %d baseline samples, got %d`, config.Anomaly.BaselineSamples, config.Anomaly.MinimumBaseline)
+	}
+
+	if config.Consistency.Window.Duration < 0 {
+		problem(`consistency.window: must not be negative, got %s`, config.Consistency.Window.Duration)
+	}
+	if config.Consistency.Tolerance < 0 {
+		problem(`consistency.tolerance: must not be negative, got %g`, config.Consistency.Tolerance)
+	}
+
+	for hardwareId, hardwareUnits := range config.SourceUnits {
+		for metricKey, unit := range hardwareUnits {
+			if _, isKnown := units.Lookup(unit); !isKnown {
+				problem(`sourceUnits.%s.%s: unknown unit "%s", must be one of %s`, hardwareId, metricKey, unit, strings.Join(units.Names(), ", "))
+			}
+			if metric, isMetric := config.MetricFor(metricKey); !isMetric {
+				problem(`sourceUnits.%s.%s: not a registered metric`, hardwareId, metricKey)
+			} else if metric.Unit == "" {
+				problem(`sourceUnits.%s.%s: the metric has no unit to convert to`, hardwareId, metricKey)
+			}
+		}
+	}
+
+	if err := config.Ingestion.CSV.Validate(); err != nil {
+		problem(`ingestion.csv: %v`, err)
+	}
+
+	if config.Ingestion.MaxJSONBytes < 1 {
+		problem(`ingestion.maxJSONBytes: must be positive, got %d`, config.Ingestion.MaxJSONBytes)
+	}
+
+	if arrivalLag := config.Ingestion.ArrivalLag; arrivalLag.Window.Duration <= 0 || arrivalLag.Windows < 1 {
+		problem(`ingestion.arrivalLag: needs a positive window and number of windows, got %s and %d`, arrivalLag.Window, arrivalLag.Windows)
+	}
+
+	workbooks := config.Ingestion.Workbooks
+	if workbooks.TimestampColumn == "" {
+		problem(`ingestion.workbooks.timestampColumn: is required`)
+	}
+	if workbooks.MaxBytes < 1 {
+		problem(`ingestion.workbooks.maxBytes: must be positive, got %d`, workbooks.MaxBytes)
+	}
+	if workbooks.MaxPartBytes < 1 {
+		problem(`ingestion.workbooks.maxPartBytes: must be positive, got %d`, workbooks.MaxPartBytes)
+	}
+	if workbooks.MaxRows < 1 {
+		problem(`ingestion.workbooks.maxRows: must be positive, got %d`, workbooks.MaxRows)
+	}
+	for field, mapping := range map[string]map[string]string{"columns": config.Columns, "ingestion.workbooks.sheets": workbooks.Sheets} {
+		for heading, metricKey := range mapping {
+			if _, isMetric := config.MetricFor(metricKey); metricKey != "" && !isMetric {
+				problem(`%s["%s"]: "%s" is not a registered metric`, field, heading, metricKey)
+			}
+		}
+	}
+
+	for hardwareId, tags := range config.Tags {
+		seenTags := make(map[string]bool, len(tags))
+		for _, tag := range tags {
+			if strings.TrimSpace(tag) == "" {
+				problem(`tags.%s: tags must not be blank`, hardwareId)
+			} else if seenTags[tag] {
+				problem(`tags.%s: tag "%s" is listed more than once`, hardwareId, tag)
+			}
+			seenTags[tag] = true
+		}
+	}
+
+	if len(problems) > 0 {
+		sort.Strings(problems)
+		return fmt.Errorf("%d problem(s):\n  %s", len(problems), strings.Join(problems, "\n  "))
+	}
+	return nil
+}
@@ -0,0 +1,325 @@
+package api_test
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api"
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/config"
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/hardware"
+)
+
+// The fixture tree holds two hardware over the first hour of 2022-07-01 UTC:
+// contract_fan, sampled every minute with a temperature ramping from 20 to 79,
+// and contract_pump, sampled every 90 seconds with a ten-minute gap.
+const (
+	fixtureFrom = "2022-07-01T00:10:00Z"
+	fixtureTo   = "2022-07-01T00:40:00Z"
+	window      = "from=" + fixtureFrom + "&to=" + fixtureTo
+)
+
+// recordedHeaders are the response headers that are part of the contract.
+var recordedHeaders = []string{"Content-Type", "Content-Disposition", "Cache-Control"}
+
+// contractCase is one request of the contract. Events, for event streams
+// that never end, is how many events are recorded before hanging up.
+// Volatile matches what changes from run to run, like durations and dates;
+// its first group is recorded as "…" wherever it matches.
+type contractCase struct {
+	name     string
+	method   string
+	path     string
+	headers  map[string]string
+	body     string
+	events   int
+	volatile *regexp.Regexp
+}
+
+func tabulation(count int, extraFields string) string {
+	return fmt.Sprintf(`{"id":"contract_fan","from":"%s","to":"%s","count":%d%s}`, fixtureFrom, fixtureTo, count, extraFields)
+}
+
+var apiKey = map[string]string{"X-API-Key": "contract"}
+
+// cases run in order against one server, so those that change the store come
+// last. Administrative writes that persist beside the fixture tree, such as
+// compaction, tombstones and locks, are left out.
+var cases = []contractCase{
+	{name: "hardware_list", method: "GET", path: "/api/hardware"},
+	{name: "hardware_description", method: "GET", path: "/api/hardware/contract_pump"},
+	{name: "hardware_description_unknown", method: "GET", path: "/api/hardware/unknown"},
+	{name: "dictionary", method: "GET", path: "/api/dictionary"},
+	{name: "tabulated", method: "POST", path: "/api/tabulated_hardware", body: tabulation(7, ``)},
+	{name: "tabulated_envelope", method: "POST", path: "/api/tabulated_hardware", body: tabulation(7, `,"envelope":true,"includeLimits":true,"banded":true`)},
+	{name: "tabulated_rounded", method: "POST", path: "/api/tabulated_hardware", body: tabulation(7, `,"rounded":true`)},
+	{name: "tabulated_cubic", method: "POST", path: "/api/tabulated_hardware", body: tabulation(7, `,"method":"cubic"`)},
+	{name: "tabulated_nearest", method: "POST", path: "/api/tabulated_hardware", body: tabulation(7, `,"method":"nearest"`)},
+	{name: "tabulated_confidence", method: "POST", path: "/api/tabulated_hardware", body: tabulation(7, `,"confidence":true`)},
+	{name: "tabulated_aligned", method: "POST", path: "/api/tabulated_hardware", body: tabulation(7, `,"alignTo":"contract_pump"`)},
+	{name: "tabulated_unknown_method", method: "POST", path: "/api/tabulated_hardware", body: tabulation(7, `,"method":"unknown"`)},
+	{name: "tabulated_unknown_hardware", method: "POST", path: "/api/tabulated_hardware", body: `{"id":"unknown","from":"` + fixtureFrom + `","to":"` + fixtureTo + `","count":7}`},
+	{name: "joined", method: "POST", path: "/api/joined_hardware", body: `{"left":{"id":"contract_fan","metrics":["temperature"]},"right":{"id":"contract_pump","metrics":["temperature","rmsVelocityX"]},"from":"` + fixtureFrom + `","to":"` + fixtureTo + `","count":7}`},
+	{name: "joined_clamped", method: "POST", path: "/api/joined_hardware", body: `{"left":{"id":"contract_fan","metrics":["temperature"]},"right":{"id":"contract_pump","metrics":["temperature"]},"from":"` + fixtureFrom + `","to":"` + fixtureTo + `","count":1099511627776}`},
+	{name: "cumulative", method: "POST", path: "/api/cumulative_hardware", body: `{"id":"contract_fan","from":"2022-07-01T00:00:00Z","to":"2022-07-01T00:59:00Z","thresholds":{"temperature":69.5},"timeUnit":"seconds"}`},
+	{name: "sample_count", method: "GET", path: "/api/sample_count?id=contract_pump&" + window},
+	{name: "overview", method: "GET", path: "/api/overview"},
+	{name: "diagnostics", method: "GET", path: "/api/diagnostics?id=contract_pump"},
+	{name: "similar", method: "GET", path: "/api/similar?id=contract_fan&metric=temperature&" + window + "&buckets=12"},
+	{name: "chart", method: "GET", path: "/api/chart?id=contract_fan&" + window + "&count=12&metrics=temperature"},
+	{name: "chart_count_too_large", method: "GET", path: "/api/chart?id=contract_fan&" + window + "&count=1000000000&metrics=temperature"},
+	{name: "aggregate", method: "GET", path: "/api/hardware/contract_fan/aggregate?" + window + "&interval=10m"},
+	{name: "clock_offset", method: "GET", path: "/api/hardware/contract_pump/clock_offset?reference=contract_fan&metric=temperature&" + window + "&resolution=3m&maxOffset=6m"},
+	{name: "export_csv", method: "GET", path: "/api/hardware/contract_pump/export?" + window},
+	{name: "export_tabulated_csv", method: "GET", path: "/api/hardware/contract_fan/export?" + window + "&mode=tabulated&count=7&metrics=temperature,peakVelocityX"},
+	{name: "export_xlsx", method: "GET", path: "/api/hardware/contract_fan/export?" + window + "&format=xlsx"},
+	{name: "quality", method: "GET", path: "/api/hardware/contract_fan/quality?" + window},
+	{name: "panel", method: "GET", path: "/api/hardware/contract_fan/panel?" + window + "&count=7"},
+	{name: "severity_timeline", method: "GET", path: "/api/hardware/contract_pump/severity-timeline?from=2022-07-01T00:00:00Z&to=2022-07-01T01:00:00Z"},
+	{name: "severity_timeline_iso10816", method: "GET", path: "/api/hardware/contract_pump/severity-timeline?from=2022-07-01T00:00:00Z&to=2022-07-01T01:00:00Z&scale=iso10816&class=I"},
+	{name: "severity_timeline_unknown_class", method: "GET", path: "/api/hardware/contract_pump/severity-timeline?" + window + "&scale=iso10816&class=V"},
+	{name: "ordering", method: "GET", path: "/api/hardware/contract_fan/ordering"},
+	{name: "fleet_aggregate", method: "GET", path: "/api/fleet/aggregate?metrics=temperature,rmsVelocityX"},
+	{name: "fleet_aggregate_iso10816", method: "GET", path: "/api/fleet/aggregate?class=II&metrics=rmsVelocityX"},
+	{name: "sparkline", method: "GET", path: "/api/hardware/contract_fan/sparkline?channel=temperature&points=6"},
+	{name: "alerts", method: "GET", path: "/api/alerts"},
+	{name: "alert_rules_yaml", method: "GET", path: "/api/alerts/rules.yaml"},
+	{name: "alert_schedule", method: "GET", path: "/api/alerts/schedule"},
+	{name: "alert_preview", method: "POST", path: "/api/alerts/preview", body: `{"rule":{"id":"contract","hardwareId":"contract_fan","metric":"temperature","comparison":"above","threshold":69.5,"notifyInterval":"5m"},"from":"2022-07-01T00:00:00Z","to":"2022-07-01T00:59:00Z"}`},
+	{name: "batch", method: "POST", path: "/api/batch", body: `[{"id":"tabulated","method":"POST","path":"/api/tabulated_hardware","body":` + tabulation(7, ``) + `},{"id":"aggregate","path":"/api/hardware/contract_fan/aggregate?` + window + `&interval=15m"},{"id":"panel","path":"/api/hardware/contract_fan/panel?` + window + `&count=3"},{"id":"unknown","path":"/api/hardware/unknown"},{"id":"method","method":"POST","path":"/api/tabulated_hardware","body":` + tabulation(7, `,"method":"unknown"`) + `}]`},
+	{name: "batch_nested", method: "POST", path: "/api/batch", body: `[{"method":"POST","path":"/api/batch","body":[]}]`},
+	{name: "anomaly", method: "GET", path: "/api/hardware/contract_fan/anomaly?" + window},
+	{name: "arrival_lag", method: "GET", path: "/api/hardware/contract_pump/arrival_lag"},
+	{name: "fleet_arrival_lag", method: "GET", path: "/api/fleet/arrival_lag"},
+	{name: "stream_resumed", method: "GET", path: "/api/hardware/contract_fan/stream?metrics=temperature", headers: map[string]string{"Last-Event-ID": "0"}, events: 2},
+	{name: "ready", method: "GET", path: "/api/ready"},
+	{name: "admin_tombstones", method: "GET", path: "/api/admin/tombstones"},
+	{name: "admin_metrics", method: "GET", path: "/api/admin/metrics", volatile: regexp.MustCompile(`_duration_microseconds_total[^:]*": (\d+)`)},
+	{name: "admin_pullers", method: "GET", path: "/api/admin/pullers"},
+	{name: "admin_indexes", method: "GET", path: "/api/admin/indexes"},
+	{name: "admin_queries", method: "GET", path: "/api/admin/queries?top=3", volatile: regexp.MustCompile(`(?s)"(?:slowest|mostFrequent)": (\[.*?\n  \])`)},
+	{name: "admin_locks", method: "GET", path: "/api/admin/locks"},
+	{name: "admin_drain", method: "GET", path: "/api/admin/drain"},
+	{name: "admin_slo", method: "GET", path: "/api/admin/slo"},
+	{name: "admin_audit", method: "GET", path: "/api/admin/audit"},
+	{name: "admin_onboard_dry_run", method: "POST", path: "/api/admin/onboard?dryRun=true", body: `{"defaults":{"tags":["line-3"],"limits":{"temperature":{"warning":60,"critical":70}}},"hardware":[{"id":"contract_fan","name":"Fan"},{"id":"contract_press"}]}`},
+	{name: "admin_read_only_tokens_unconfigured", method: "POST", path: "/api/admin/read_only_tokens", body: `{"subject":"demo"}`},
+	{name: "usage", method: "GET", path: "/api/usage", volatile: regexp.MustCompile(`"(?:day|bytesOut)": ("[^"]*"|\d+)`)},
+	{name: "metrics", method: "GET", path: "/metrics", volatile: regexp.MustCompile(`(?m)^api_request_duration_(?:seconds_bucket|seconds_sum|microseconds_total)\S* (\S+)$`)},
+	{name: "query_page", method: "GET", path: "/query"},
+	{name: "preferences_unauthorized", method: "GET", path: "/api/preferences"},
+	{name: "preferences_replace", method: "PUT", path: "/api/preferences", headers: apiKey, body: `{"favorite": "contract_fan", "window": {"hours": 1}}`},
+	{name: "preference_set", method: "PUT", path: "/api/preferences/units", headers: apiKey, body: `"metric"`},
+	{name: "preferences", method: "GET", path: "/api/preferences", headers: apiKey},
+	{name: "ingest", method: "POST", path: "/api/ingest?hardwareId=contract_pump&persist=false", headers: map[string]string{"Content-Type": "text/csv"}, body: "timestamp,temperature\n1656637200000,41.5\n"},
+	{name: "samples", method: "POST", path: "/api/hardware/contract_fan/samples?persist=false", headers: map[string]string{"Content-Type": "application/json"}, body: `[{"time":"2022-07-01T01:00:00Z","values":{"temperature":80,"rmsVelocityX":1.5}}]`},
+	{name: "hardware_description_after_ingest", method: "GET", path: "/api/hardware/contract_pump"},
+	{name: "samples_inconsistent", method: "POST", path: "/api/hardware/contract_fan/samples?persist=false", headers: map[string]string{"Content-Type": "application/json"}, body: `{"time":"2022-07-01T01:02:00Z","values":{"rmsVelocityX":4,"peakVelocityX":3}}`},
+	{name: "quality_after_ingest", method: "GET", path: "/api/hardware/contract_fan/quality?from=2022-07-01T00:50:00Z&to=2022-07-01T01:05:00Z"},
+	{name: "tabulated_envelope_after_ingest", method: "POST", path: "/api/tabulated_hardware", body: `{"id":"contract_fan","from":"2022-07-01T00:50:00Z","to":"2022-07-01T01:02:00Z","count":3,"envelope":true}`},
+}
+
+// record renders a response the way its golden file holds it: the status and
+// contract headers, then the body. JSON bodies are indented so diffs point at
+// a field, and binary bodies are reduced to their length and digest.
+func record(response *http.Response, bodyBytes []byte) string {
+	var recorded strings.Builder
+	fmt.Fprintf(&recorded, "%d %s\n", response.StatusCode, http.StatusText(response.StatusCode))
+	for _, header := range recordedHeaders {
+		if value := response.Header.Get(header); value != "" {
+			fmt.Fprintf(&recorded, "%s: %s\n", header, value)
+		}
+	}
+	recorded.WriteString("\n")
+
+	var indentedBody bytes.Buffer
+	switch {
+	case len(bodyBytes) == 0:
+	case json.Indent(&indentedBody, bodyBytes, "", "  ") == nil:
+		recorded.Write(indentedBody.Bytes())
+		recorded.WriteString("\n")
+	case utf8.Valid(bodyBytes):
+		recorded.Write(bodyBytes)
+		if !bytes.HasSuffix(bodyBytes, []byte("\n")) {
+			recorded.WriteString("\n")
+		}
+	default:
+		fmt.Fprintf(&recorded, "%d bytes, sha256 %x\n", len(bodyBytes), sha256.Sum256(bodyBytes))
+	}
+	return recorded.String()
+}
+
+// readEvents reads the first count events of an event stream, each ending
+// with a blank line.
+func readEvents(body io.Reader, count int) ([]byte, error) {
+	var events bytes.Buffer
+	reader := bufio.NewReader(body)
+	for count > 0 {
+		line, err := reader.ReadString('\n')
+		events.WriteString(line)
+		if err != nil {
+			return nil, err
+		}
+		if line == "\n" {
+			count--
+		}
+	}
+	return events.Bytes(), nil
+}
+
+// firstDifference describes the first line where a response strays from its
+// golden file.
+func firstDifference(expected string, actual string) string {
+	expectedLines, actualLines := strings.Split(expected, "\n"), strings.Split(actual, "\n")
+	for lineIndex := 0; lineIndex < len(expectedLines) || lineIndex < len(actualLines); lineIndex++ {
+		var expectedLine, actualLine string
+		if lineIndex < len(expectedLines) {
+			expectedLine = expectedLines[lineIndex]
+		}
+		if lineIndex < len(actualLines) {
+			actualLine = actualLines[lineIndex]
+		}
+		if expectedLine != actualLine {
+			return fmt.Sprintf("line %d: expected %q, got %q", lineIndex+1, expectedLine, actualLine)
+		}
+	}
+	return "responses differ"
+}
+
+func run(client *http.Client, serverURL string, contract contractCase) (string, error) {
+	request, err := http.NewRequest(contract.method, serverURL+contract.path, strings.NewReader(contract.body))
+	if err != nil {
+		return "", err
+	}
+	for header, value := range contract.headers {
+		request.Header.Set(header, value)
+	}
+	response, err := client.Do(request)
+	if err != nil {
+		return "", err
+	}
+	defer response.Body.Close()
+
+	var bodyBytes []byte
+	if contract.events > 0 {
+		bodyBytes, err = readEvents(response.Body, contract.events)
+	} else {
+		bodyBytes, err = io.ReadAll(response.Body)
+	}
+	if err != nil {
+		return "", err
+	}
+	recorded := record(response, bodyBytes)
+	if contract.volatile != nil {
+		recorded = mask(recorded, contract.volatile)
+	}
+	return recorded, nil
+}
+
+// mask replaces the first group of every match of volatile in recorded.
+func mask(recorded string, volatile *regexp.Regexp) string {
+	var masked strings.Builder
+	last := 0
+	for _, match := range volatile.FindAllStringSubmatchIndex(recorded, -1) {
+		masked.WriteString(recorded[last:match[2]])
+		masked.WriteString("…")
+		last = match[3]
+	}
+	masked.WriteString(recorded[last:])
+	return masked.String()
+}
+
+var update = flag.Bool("update", false, "rewrite the golden files from the current responses")
+
+// goldenPath is the directory holding one golden response per case.
+var goldenPath = filepath.Join("testdata", "contract", "golden")
+
+// loadContractFixtures configures the handlers the way the golden files were
+// recorded and loads the fixture tree.
+func loadContractFixtures() error {
+	// Preferences stay in memory, so running the cases leaves nothing behind
+	config.Current.Preferences.Path = ""
+	// Tags put both machines on one line and the pump alone on another
+	config.Current.Tags = map[string][]string{"contract_fan": {"line-1"}, "contract_pump": {"line-1", "line-2"}}
+	return hardware.PopulateSamplesFrom(filepath.Join("testdata", "contract", "fixtures"))
+}
+
+// TestContract runs the cases against the fixture tree and compares each
+// response with its golden file, or rewrites the golden files with -update.
+func TestContract(t *testing.T) {
+	if err := loadContractFixtures(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Served like engine.Register serves the API
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/", api.Handle)
+	mux.HandleFunc("/metrics", api.HandleMetrics)
+	mux.HandleFunc("/query", api.HandleQueryPage)
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	client := server.Client()
+
+	covered := make(map[string]bool, len(cases))
+	for _, contract := range cases {
+		goldenFile := filepath.Join(goldenPath, contract.name+".golden")
+		covered[filepath.Base(goldenFile)] = true
+
+		actual, err := run(client, server.URL, contract)
+		if err != nil {
+			t.Errorf(`%s: %v`, contract.name, err)
+			continue
+		}
+		actual = contract.method + " " + contract.path + "\n" + actual
+
+		if *update {
+			if err := os.WriteFile(goldenFile, []byte(actual), 0644); err != nil {
+				t.Errorf(`%s: %v`, contract.name, err)
+			}
+			continue
+		}
+
+		expectedBytes, err := os.ReadFile(goldenFile)
+		if err != nil {
+			t.Errorf(`%s: %v`, contract.name, err)
+		} else if expected := string(expectedBytes); expected != actual {
+			t.Errorf(`%s: %s`, contract.name, firstDifference(expected, actual))
+		}
+	}
+
+	// A golden file no case produces would otherwise go stale unnoticed
+	goldenFiles, _ := filepath.Glob(filepath.Join(goldenPath, "*.golden"))
+	for _, goldenFile := range goldenFiles {
+		if !covered[filepath.Base(goldenFile)] {
+			t.Errorf(`%s: no case produces this golden file`, filepath.Base(goldenFile))
+		}
+	}
+}
+
+func BenchmarkTabulatedHardware(b *testing.B) {
+	if err := loadContractFixtures(); err != nil {
+		b.Fatal(err)
+	}
+	body := tabulation(60, ``)
+	b.ResetTimer()
+	for iteration := 0; iteration < b.N; iteration++ {
+		request := httptest.NewRequest("POST", "/api/tabulated_hardware", strings.NewReader(body))
+		response := httptest.NewRecorder()
+		api.Handle(response, request)
+		if response.Code != http.StatusOK {
+			b.Fatalf(`tabulation answered %d: %s`, response.Code, response.Body)
+		}
+	}
+}
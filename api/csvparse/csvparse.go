@@ -0,0 +1,354 @@
+// Package csvparse reads the CSV files readings arrive in, in whichever
+// dialect the plant's tools export: the delimiter, decimal and thousands
+// separators, timestamp format and quoting are options rather than
+// assumptions. Numbers are held to plain decimal notation, so a mistaken
+// option is refused rather than read as some other value.
+package csvparse
+
+import (
+	"bufio"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	TimestampUnixMilliseconds = "unixMilliseconds"
+	TimestampUnixSeconds      = "unixSeconds"
+	TimestampRFC3339          = "rfc3339"
+
+	// QuotingStrict follows RFC 4180, QuotingLazy lets quotes appear within
+	// unquoted fields, and QuotingNone reads quotes as any other character.
+	QuotingStrict = "strict"
+	QuotingLazy   = "lazy"
+	QuotingNone   = "none"
+)
+
+// MaxRecordBytes bounds a record, so a file without line breaks is refused
+// rather than read whole.
+const MaxRecordBytes = 1 << 20
+
+var (
+	ErrInvalidOptions = errors.New(`invalid CSV options`)
+	ErrInvalidNumber  = errors.New(`invalid number`)
+)
+
+// Options describe a CSV dialect. Each is a single character, or for
+// TimestampFormat one of the Timestamp constants or a Go time layout, such
+// as "02.01.2006 15:04:05". Empty options are those of the sample files:
+// commas, decimal points, no thousands separator, Unix milliseconds and
+// strict quoting.
+type Options struct {
+	Delimiter          string `json:"delimiter"`
+	DecimalSeparator   string `json:"decimalSeparator"`
+	ThousandsSeparator string `json:"thousandsSeparator"`
+	TimestampFormat    string `json:"timestampFormat"`
+	Quoting            string `json:"quoting"`
+
+	// Location is the time zone of layouts without one, UTC if nil.
+	Location *time.Location `json:"-"`
+}
+
+// runeOf reads an option that is a single character, or fallback if empty.
+func runeOf(name string, option string, fallback rune) (rune, error) {
+	if option == "" {
+		return fallback, nil
+	}
+	character, size := utf8.DecodeRuneInString(option)
+	if character == utf8.RuneError || size != len(option) {
+		return 0, fmt.Errorf(`%w: %s "%s" must be a single character`, ErrInvalidOptions, name, option)
+	}
+	return character, nil
+}
+
+// dialect is a validated Options.
+type dialect struct {
+	delimiter rune
+	decimal   rune
+	thousands rune
+	timestamp string
+	quoting   string
+	location  *time.Location
+}
+
+func (options Options) dialect() (*dialect, error) {
+	var parsed dialect
+	var err error
+	if parsed.delimiter, err = runeOf("delimiter", options.Delimiter, ','); err != nil {
+		return nil, err
+	}
+	if parsed.decimal, err = runeOf("decimalSeparator", options.DecimalSeparator, '.'); err != nil {
+		return nil, err
+	}
+	if parsed.thousands, err = runeOf("thousandsSeparator", options.ThousandsSeparator, 0); err != nil {
+		return nil, err
+	}
+
+	for _, separator := range []rune{parsed.delimiter, parsed.decimal, parsed.thousands} {
+		if separator == '\r' || separator == '\n' || separator == '"' || (separator >= '0' && separator <= '9') || separator == '-' || separator == '+' || separator == 'e' || separator == 'E' {
+			return nil, fmt.Errorf(`%w: %q cannot separate anything`, ErrInvalidOptions, separator)
+		}
+	}
+	if parsed.delimiter == parsed.decimal || parsed.delimiter == parsed.thousands || parsed.decimal == parsed.thousands {
+		return nil, fmt.Errorf(`%w: the delimiter, decimal and thousands separators must differ`, ErrInvalidOptions)
+	}
+
+	parsed.timestamp = options.TimestampFormat
+	switch parsed.timestamp {
+	case "":
+		parsed.timestamp = TimestampUnixMilliseconds
+	case TimestampUnixMilliseconds, TimestampUnixSeconds, TimestampRFC3339:
+	default:
+		if !strings.Contains(parsed.timestamp, "2006") && !strings.Contains(parsed.timestamp, "06") {
+			return nil, fmt.Errorf(`%w: timestamp format "%s" is neither %s, %s, %s nor a layout with a year`, ErrInvalidOptions, parsed.timestamp, TimestampUnixMilliseconds, TimestampUnixSeconds, TimestampRFC3339)
+		}
+	}
+
+	parsed.quoting = options.Quoting
+	switch parsed.quoting {
+	case "":
+		parsed.quoting = QuotingStrict
+	case QuotingStrict, QuotingLazy, QuotingNone:
+	default:
+		return nil, fmt.Errorf(`%w: quoting "%s" is neither %s, %s nor %s`, ErrInvalidOptions, parsed.quoting, QuotingStrict, QuotingLazy, QuotingNone)
+	}
+
+	parsed.location = options.Location
+	if parsed.location == nil {
+		parsed.location = time.UTC
+	}
+	return &parsed, nil
+}
+
+// Validate reports what is wrong with options, if anything.
+func (options Options) Validate() error {
+	_, err := options.dialect()
+	return err
+}
+
+// ParseError reports a record that could not be read; reading can carry on
+// past it.
+type ParseError struct {
+	Line int
+	Err  error
+}
+
+func (parseError *ParseError) Error() string {
+	return fmt.Sprintf(`line %d: %v`, parseError.Line, parseError.Err)
+}
+
+func (parseError *ParseError) Unwrap() error {
+	return parseError.Err
+}
+
+// Reader reads records, their fields trimmed of surrounding space, and
+// parses the numbers and timestamps in them.
+type Reader struct {
+	dialect *dialect
+	line    int
+
+	csvReader *csv.Reader
+	scanner   *bufio.Scanner
+}
+
+func NewReader(reader io.Reader, options Options) (*Reader, error) {
+	parsed, err := options.dialect()
+	if err != nil {
+		return nil, err
+	}
+	// Records past the limit are refused by the scanner, or else by the
+	// limited reader starving the CSV reader of the rest of the stream
+	csvParser := &Reader{dialect: parsed}
+	if parsed.quoting == QuotingNone {
+		csvParser.scanner = bufio.NewScanner(reader)
+		csvParser.scanner.Buffer(make([]byte, 0, 64<<10), MaxRecordBytes)
+		return csvParser, nil
+	}
+	csvParser.csvReader = csv.NewReader(&recordLimitReader{reader: bufio.NewReader(reader)})
+	csvParser.csvReader.Comma = parsed.delimiter
+	csvParser.csvReader.LazyQuotes = parsed.quoting == QuotingLazy
+	csvParser.csvReader.FieldsPerRecord = -1
+	csvParser.csvReader.ReuseRecord = true
+	return csvParser, nil
+}
+
+// recordLimitReader fails reads once MaxRecordBytes have gone by without a
+// line break.
+type recordLimitReader struct {
+	reader    *bufio.Reader
+	sinceLine int
+}
+
+func (limitReader *recordLimitReader) Read(buffer []byte) (int, error) {
+	if limitReader.sinceLine >= MaxRecordBytes {
+		return 0, fmt.Errorf(`record exceeds %d bytes`, MaxRecordBytes)
+	}
+	if len(buffer) > MaxRecordBytes-limitReader.sinceLine {
+		buffer = buffer[:MaxRecordBytes-limitReader.sinceLine]
+	}
+	count, err := limitReader.reader.Read(buffer)
+	for _, character := range buffer[:count] {
+		if character == '\n' {
+			limitReader.sinceLine = 0
+		} else {
+			limitReader.sinceLine++
+		}
+	}
+	return count, err
+}
+
+// Read returns the next record, io.EOF when done, a *ParseError for a record
+// that should be skipped, or any other error when the stream itself is
+// broken. The record is only valid until the next call.
+func (csvParser *Reader) Read() ([]string, error) {
+	var record []string
+	if csvParser.scanner != nil {
+		for record == nil {
+			if !csvParser.scanner.Scan() {
+				if err := csvParser.scanner.Err(); err != nil {
+					return nil, err
+				}
+				return nil, io.EOF
+			}
+			csvParser.line++
+			if line := strings.TrimSuffix(csvParser.scanner.Text(), "\r"); line != "" {
+				record = strings.Split(line, string(csvParser.dialect.delimiter))
+			}
+		}
+	} else {
+		var err error
+		record, err = csvParser.csvReader.Read()
+		if err != nil {
+			var parseErr *csv.ParseError
+			if errors.As(err, &parseErr) {
+				csvParser.line = parseErr.Line
+				return nil, &ParseError{Line: parseErr.Line, Err: parseErr.Err}
+			}
+			return nil, err
+		}
+		csvParser.line, _ = csvParser.csvReader.FieldPos(0)
+	}
+
+	for field := range record {
+		record[field] = strings.TrimSpace(record[field])
+	}
+	return record, nil
+}
+
+// Line is the line the last record read started on.
+func (csvParser *Reader) Line() int {
+	return csvParser.line
+}
+
+// ParseNumber reads a number in plain decimal notation, with the dialect's
+// separators and an optional exponent, e.g. "-1.234,5" or "2,5e-3" with
+// decimal commas. Thousands separators must group digits by three. Anything
+// else, such as "NaN", "0x1p3" or a number too large for a float64, is
+// refused.
+func (csvParser *Reader) ParseNumber(field string) (float64, error) {
+	refuse := func() (float64, error) {
+		return 0, fmt.Errorf(`%w "%s"`, ErrInvalidNumber, field)
+	}
+
+	var normalized strings.Builder
+	remaining := field
+	if strings.HasPrefix(remaining, "-") || strings.HasPrefix(remaining, "+") {
+		normalized.WriteByte(remaining[0])
+		remaining = remaining[1:]
+	}
+
+	// Integer digits, in groups when a thousands separator is used
+	integerDigits, groupDigits, groups := 0, 0, 0
+	for remaining != "" {
+		character, size := utf8.DecodeRuneInString(remaining)
+		if character >= '0' && character <= '9' {
+			normalized.WriteRune(character)
+			integerDigits++
+			groupDigits++
+		} else if character == csvParser.dialect.thousands && csvParser.dialect.thousands != 0 {
+			if groupDigits == 0 || groupDigits > 3 || (groups > 0 && groupDigits != 3) {
+				return refuse()
+			}
+			groups++
+			groupDigits = 0
+		} else {
+			break
+		}
+		remaining = remaining[size:]
+	}
+	if groups > 0 && groupDigits != 3 {
+		return refuse()
+	}
+
+	fractionDigits := 0
+	if character, size := utf8.DecodeRuneInString(remaining); remaining != "" && character == csvParser.dialect.decimal {
+		normalized.WriteByte('.')
+		remaining = remaining[size:]
+		for remaining != "" && remaining[0] >= '0' && remaining[0] <= '9' {
+			normalized.WriteByte(remaining[0])
+			remaining = remaining[1:]
+			fractionDigits++
+		}
+	}
+	if integerDigits == 0 && fractionDigits == 0 {
+		return refuse()
+	}
+
+	if remaining != "" && (remaining[0] == 'e' || remaining[0] == 'E') {
+		normalized.WriteByte('e')
+		remaining = remaining[1:]
+		if strings.HasPrefix(remaining, "-") || strings.HasPrefix(remaining, "+") {
+			normalized.WriteByte(remaining[0])
+			remaining = remaining[1:]
+		}
+		exponentDigits := 0
+		for remaining != "" && remaining[0] >= '0' && remaining[0] <= '9' {
+			normalized.WriteByte(remaining[0])
+			remaining = remaining[1:]
+			exponentDigits++
+		}
+		if exponentDigits == 0 {
+			return refuse()
+		}
+	}
+	if remaining != "" {
+		return refuse()
+	}
+
+	number, err := strconv.ParseFloat(normalized.String(), 64)
+	if err != nil || math.IsInf(number, 0) {
+		return refuse()
+	}
+	return number, nil
+}
+
+// ParseTimestamp reads a timestamp in the dialect's format.
+func (csvParser *Reader) ParseTimestamp(field string) (time.Time, error) {
+	switch csvParser.dialect.timestamp {
+	case TimestampUnixMilliseconds:
+		milliseconds, err := strconv.ParseInt(field, 10, 64)
+		if err != nil {
+			return time.Time{}, err
+		}
+		return time.UnixMilli(milliseconds), nil
+	case TimestampUnixSeconds:
+		seconds, err := csvParser.ParseNumber(field)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if math.Abs(seconds) > math.MaxInt64/1e3 {
+			return time.Time{}, fmt.Errorf(`%s seconds is out of range`, field)
+		}
+		return time.UnixMilli(int64(math.Round(seconds * 1000))), nil
+	case TimestampRFC3339:
+		return time.Parse(time.RFC3339Nano, field)
+	default:
+		return time.ParseInLocation(csvParser.dialect.timestamp, field, csvParser.dialect.location)
+	}
+}
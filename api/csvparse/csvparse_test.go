@@ -0,0 +1,238 @@
+package csvparse
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// dialects are the ones the sample files and the plants' tools export in;
+// fuzz inputs pick one by index.
+var dialects = []Options{
+	{},
+	{Delimiter: ";", DecimalSeparator: ",", ThousandsSeparator: "."},
+	{Delimiter: ";", DecimalSeparator: ",", ThousandsSeparator: "\u202f"},
+	{ThousandsSeparator: "'"},
+	{Delimiter: ";", DecimalSeparator: ",", TimestampFormat: "02.01.2006 15:04:05", Location: time.FixedZone("CEST", 2*60*60)},
+	{Quoting: QuotingNone, TimestampFormat: TimestampUnixSeconds},
+	{Quoting: QuotingLazy, TimestampFormat: TimestampRFC3339},
+	{Delimiter: "\t", DecimalSeparator: ","},
+}
+
+func readerFor(t *testing.T, data io.Reader, dialectIndex uint8) *Reader {
+	csvParser, err := NewReader(data, dialects[int(dialectIndex)%len(dialects)])
+	if err != nil {
+		t.Fatalf(`dialect %d: %v`, dialectIndex, err)
+	}
+	return csvParser
+}
+
+func TestParseNumber(t *testing.T) {
+	for _, dialect := range []struct {
+		options  Options
+		accepted map[string]float64
+		refused  []string
+	}{
+		{Options{}, map[string]float64{"1.5": 1.5, "-0.25": -0.25, ".5": 0.5, "2e3": 2000, "+7": 7}, []string{"1,5", "NaN", "Inf", "0x1p3", "1_000", "1e", "1e999", "", "-", "."}},
+		{Options{Delimiter: ";", DecimalSeparator: ",", ThousandsSeparator: "."}, map[string]float64{"1.234,5": 1234.5, "-0,25": -0.25, "12,5e-1": 1.25, "999": 999}, []string{"1.5", "12.34,5", "1.2345,6", "1,2,3"}},
+		{Options{Delimiter: ";", DecimalSeparator: ",", ThousandsSeparator: "\u202f"}, map[string]float64{"1\u202f234\u202f567,5": 1234567.5}, []string{"1 234,5", "1\u202f23,5"}},
+		{Options{ThousandsSeparator: "'"}, map[string]float64{"1'234.5": 1234.5}, []string{"1'2345.0", "'123"}},
+	} {
+		csvParser, err := NewReader(strings.NewReader(""), dialect.options)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for field, expected := range dialect.accepted {
+			if number, err := csvParser.ParseNumber(field); err != nil {
+				t.Errorf(`%+v refused %q: %v`, dialect.options, field, err)
+			} else if math.Abs(number-expected) > 1e-6 {
+				t.Errorf(`%+v read %q as %g, not %g`, dialect.options, field, number, expected)
+			}
+		}
+		for _, field := range dialect.refused {
+			if number, err := csvParser.ParseNumber(field); err == nil {
+				t.Errorf(`%+v read %q as %g`, dialect.options, field, number)
+			}
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	if err := (Options{Delimiter: ","}).Validate(); err != nil {
+		t.Error(err)
+	}
+	for _, options := range []Options{{Delimiter: ";", DecimalSeparator: ";"}, {DecimalSeparator: "1"}, {Delimiter: "ab"}, {TimestampFormat: "15:04"}, {Quoting: "sometimes"}} {
+		if err := options.Validate(); !errors.Is(err, ErrInvalidOptions) {
+			t.Errorf(`%+v gave %v, not ErrInvalidOptions`, options, err)
+		}
+	}
+}
+
+func TestQuotingNone(t *testing.T) {
+	csvParser, err := NewReader(strings.NewReader("timestamp,temperature\n1656633600,\"20\n"), Options{Quoting: QuotingNone, TimestampFormat: TimestampUnixSeconds})
+	if err != nil {
+		t.Fatal(err)
+	}
+	csvParser.Read()
+	record, err := csvParser.Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(record) != 2 || record[1] != `"20` {
+		t.Fatalf(`read %q`, record)
+	}
+	if number, err := csvParser.ParseNumber(record[1]); err == nil {
+		t.Errorf(`unquoted "20 was read as %g`, number)
+	}
+}
+
+func TestRecordLimit(t *testing.T) {
+	endless := strings.NewReader("timestamp,temperature\n" + strings.Repeat("1", MaxRecordBytes+1))
+	for _, quoting := range []string{QuotingStrict, QuotingNone} {
+		endless.Seek(0, io.SeekStart)
+		csvParser, err := NewReader(endless, Options{Quoting: quoting})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := csvParser.Read(); err != nil {
+			t.Fatal(err)
+		}
+		if record, err := csvParser.Read(); err == nil || errors.Is(err, io.EOF) {
+			t.Errorf(`%s quoting read a record of %d bytes as %d fields (%v)`, quoting, MaxRecordBytes+1, len(record), err)
+		}
+	}
+}
+
+func FuzzParseNumber(f *testing.F) {
+	for _, field := range []string{"1.5", "-0.25", ".5", "2e3", "+7", "1,5", "NaN", "Inf", "0x1p3", "1_000", "1e", "1e999", "", "-", "."} {
+		f.Add(field, uint8(0))
+	}
+	for _, field := range []string{"1.234,5", "-0,25", "12,5e-1", "999", "1.5", "12.34,5", "1.2345,6", "1,2,3"} {
+		f.Add(field, uint8(1))
+	}
+	for _, field := range []string{"1\u202f234\u202f567,5", "1 234,5", "1\u202f23,5"} {
+		f.Add(field, uint8(2))
+	}
+	for _, field := range []string{"1'234.5", "1'2345.0", "'123"} {
+		f.Add(field, uint8(3))
+	}
+
+	f.Fuzz(func(t *testing.T, field string, dialectIndex uint8) {
+		csvParser := readerFor(t, strings.NewReader(""), dialectIndex)
+		number, err := csvParser.ParseNumber(field)
+		if err != nil {
+			if !errors.Is(err, ErrInvalidNumber) {
+				t.Fatalf(`%q refused with %v, not ErrInvalidNumber`, field, err)
+			}
+			return
+		}
+		if math.IsNaN(number) || math.IsInf(number, 0) {
+			t.Fatalf(`%q read as %g`, field, number)
+		}
+
+		// Plain decimal notation in the default dialect is what ParseFloat reads
+		if int(dialectIndex)%len(dialects) == 0 {
+			if expected, err := strconv.ParseFloat(field, 64); err != nil || expected != number {
+				t.Fatalf(`%q read as %g, ParseFloat reads %g (%v)`, field, number, expected, err)
+			}
+		}
+	})
+}
+
+func FuzzParseTimestamp(f *testing.F) {
+	for dialectIndex, fields := range [][]string{
+		{"1656633600000", "-1", "9223372036854775807", "1656633600000.5", ""},
+		{"1656633600000", "1.656.633.600.000"},
+		{},
+		{},
+		{"01.07.2022 02:00:00", "31.02.2022 00:00:00", "1.7.2022 2:00:00"},
+		{"1656633600", "1656633600.25", "1e300", "-1e18"},
+		{"2022-07-01T00:00:00Z", "2022-07-01T02:00:00+02:00", "2022-07-01T00:00:00.123456789Z", "2022-07-01"},
+	} {
+		for _, field := range fields {
+			f.Add(field, uint8(dialectIndex))
+		}
+	}
+
+	f.Fuzz(func(t *testing.T, field string, dialectIndex uint8) {
+		csvParser := readerFor(t, strings.NewReader(""), dialectIndex)
+		timestamp, err := csvParser.ParseTimestamp(field)
+		if err != nil {
+			return
+		}
+
+		// Whatever is read comes back the same when written in the format
+		switch format := csvParser.dialect.timestamp; format {
+		case TimestampUnixMilliseconds:
+			if milliseconds, err := strconv.ParseInt(field, 10, 64); err != nil || milliseconds != timestamp.UnixMilli() {
+				t.Fatalf(`%q read as %d milliseconds`, field, timestamp.UnixMilli())
+			}
+		case TimestampUnixSeconds:
+			seconds, err := csvParser.ParseNumber(field)
+			if err != nil || math.Round(seconds*1000) != float64(timestamp.UnixMilli()) {
+				t.Fatalf(`%q read as %d milliseconds`, field, timestamp.UnixMilli())
+			}
+		case TimestampRFC3339:
+			if reparsed, err := time.Parse(time.RFC3339Nano, timestamp.Format(time.RFC3339Nano)); err != nil || !reparsed.Equal(timestamp) {
+				t.Fatalf(`%q read as %s, which reads back as %s (%v)`, field, timestamp, reparsed, err)
+			}
+		default:
+			location := csvParser.dialect.location
+			if reparsed, err := time.ParseInLocation(format, timestamp.In(location).Format(format), location); err != nil || !reparsed.Equal(timestamp) {
+				t.Fatalf(`%q read as %s, which reads back as %s (%v)`, field, timestamp, reparsed, err)
+			}
+		}
+	})
+}
+
+func FuzzReader(f *testing.F) {
+	for dialectIndex, data := range []string{
+		"timestamp,temperature\n1656633600000,20.5\n1656633660000, 21 \n",
+		"timestamp;temperature\n1656633600000;1.234,5\n",
+		"timestamp;temperature\n1656633600000;1\u202f234,5\n",
+		"timestamp,temperature\n1656633600000,1'234.5\n",
+		"timestamp;temperature\n\"01.07.2022 02:00:00\";\"20,5\"\n01.07.2022 02:01:00; 21 \n",
+		"timestamp,temperature\n1656633600,\"20\n",
+		"timestamp,temperature\r\n2022-07-01T00:00:00Z,a\"b\r\n\"unterminated\n",
+		"timestamp\ttemperature\n1656633600000\t20,5\n\n\n",
+	} {
+		f.Add([]byte(data), uint8(dialectIndex))
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte, dialectIndex uint8) {
+		csvParser := readerFor(t, bytes.NewReader(data), dialectIndex)
+
+		// Every record, or error, takes at least one line of the input
+		maxRecords := bytes.Count(data, []byte("\n")) + 1
+		for records := 0; ; records++ {
+			if records > maxRecords {
+				t.Fatalf(`more than %d records read from %d lines`, maxRecords, maxRecords)
+			}
+			record, err := csvParser.Read()
+			if errors.Is(err, io.EOF) {
+				return
+			}
+			var parseErr *ParseError
+			if errors.As(err, &parseErr) {
+				continue
+			} else if err != nil {
+				return
+			}
+			if csvParser.Line() < 1 || csvParser.Line() > maxRecords {
+				t.Fatalf(`record read from line %d of %d`, csvParser.Line(), maxRecords)
+			}
+			for _, field := range record {
+				if field != strings.TrimSpace(field) {
+					t.Fatalf(`field %q was not trimmed`, field)
+				}
+				csvParser.ParseNumber(field)
+				csvParser.ParseTimestamp(field)
+			}
+		}
+	})
+}
@@ -0,0 +1,105 @@
+package api
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/hardware"
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/statistics"
+)
+
+type CumulativeHardwareRequestData struct {
+	Id         string             `json:"id"`
+	From       time.Time          `json:"from"`
+	To         time.Time          `json:"to"`
+	Thresholds map[string]float64 `json:"thresholds"`
+	TimeUnit   string             `json:"timeUnit"`
+}
+
+type CumulativeMetric struct {
+	Threshold    float64              `json:"threshold"`
+	Exposure     statistics.Statistic `json:"exposure"`
+	ExposureUnit string               `json:"exposureUnit"`
+	SecondsAbove float64              `json:"secondsAbove"`
+	SampleCount  int                  `json:"sampleCount"`
+}
+
+func handleCumulativeHardware(response http.ResponseWriter, request *http.Request) {
+	if request.Method != "POST" {
+		response.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	revision := hardware.Revision()
+
+	dataBytes, err := io.ReadAll(request.Body)
+	if err != nil {
+		response.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	var requestData CumulativeHardwareRequestData
+	if err := json.Unmarshal(dataBytes, &requestData); err != nil {
+		response.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	var unit time.Duration
+	switch requestData.TimeUnit {
+	case "", "hours":
+		requestData.TimeUnit, unit = "hours", time.Hour
+	case "seconds":
+		unit = time.Second
+	default:
+		response.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	for metric := range requestData.Thresholds {
+		if !hardware.IsMetric(metric) {
+			response.WriteHeader(http.StatusBadRequest)
+			return
+		}
+	}
+
+	samples, err := hardware.SamplesBetween(requestData.Id, requestData.From, requestData.To)
+	if err != nil {
+		response.WriteHeader(errorStatus(err, http.StatusBadRequest))
+		return
+	}
+
+	cumulativeMetrics := make(map[string]*CumulativeMetric)
+	for metric, threshold := range requestData.Thresholds {
+		times := make([]time.Time, 0, len(samples))
+		values := make([]float64, 0, len(samples))
+		for _, sample := range samples {
+			if value, _ := sample.ValueByMetric(metric); value != nil && statistics.IsFinite(*value) {
+				times = append(times, sample.Time)
+				values = append(values, *value)
+			}
+		}
+
+		exposure, durationAbove := statistics.Exposure(times, values, threshold, unit)
+		cumulativeMetrics[metric] = &CumulativeMetric{
+			Threshold:    threshold,
+			Exposure:     exposure,
+			ExposureUnit: requestData.TimeUnit,
+			SecondsAbove: durationAbove.Seconds(),
+			SampleCount:  len(values),
+		}
+	}
+
+	responseBytes, err := json.Marshal(cumulativeMetrics)
+	if err != nil {
+		response.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if setCacheHeaders(response, request, dataBytes, revision, requestData.To) {
+		response.WriteHeader(http.StatusNotModified)
+		return
+	}
+	response.WriteHeader(http.StatusOK)
+	response.Write(responseBytes)
+}
@@ -0,0 +1,36 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/diagnostics"
+)
+
+type DiagnosticsResponseData struct {
+	Id       string                 `json:"id"`
+	Findings []*diagnostics.Finding `json:"findings"`
+}
+
+func handleDiagnostics(response http.ResponseWriter, request *http.Request) {
+	if request.Method != "GET" {
+		response.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	hardwareId := request.URL.Query().Get("id")
+	findings, err := diagnostics.Diagnose(hardwareId)
+	if err != nil {
+		response.WriteHeader(errorStatus(err, http.StatusInternalServerError))
+		return
+	}
+
+	responseBytes, err := json.Marshal(DiagnosticsResponseData{Id: hardwareId, Findings: findings})
+	if err != nil {
+		response.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	response.WriteHeader(http.StatusOK)
+	response.Write(responseBytes)
+}
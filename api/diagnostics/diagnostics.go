@@ -0,0 +1,205 @@
+// Package diagnostics turns recent metric trends into ranked maintenance
+// findings using rules of thumb from vibration analysis.
+package diagnostics
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/hardware"
+)
+
+const (
+	// The recent window is judged against the baseline window right before it.
+	recentWindow   = 6 * time.Hour
+	baselineWindow = 7 * 24 * time.Hour
+
+	FaultUnbalance    = "unbalance"
+	FaultMisalignment = "misalignment"
+	FaultLooseness    = "looseness"
+	FaultBearingWear  = "bearing_wear"
+	FaultOverheating  = "overheating"
+)
+
+type Finding struct {
+	Fault      string    `json:"fault"`
+	Confidence float64   `json:"confidence"`
+	Evidence   []string  `json:"evidence"`
+	Suggestion string    `json:"suggestion"`
+	RecentFrom time.Time `json:"recentFrom"`
+	RecentTo   time.Time `json:"recentTo"`
+}
+
+// features holds per-metric means of the recent and baseline windows.
+type features struct {
+	recent   map[string]float64
+	baseline map[string]float64
+}
+
+func meansOf(samples []*hardware.Sample) map[string]float64 {
+	sums := make(map[string]float64)
+	counts := make(map[string]int)
+	for _, sample := range samples {
+		for _, metric := range hardware.Metrics() {
+			if value, _ := sample.ValueByMetric(metric); value != nil {
+				sums[metric] += *value
+				counts[metric]++
+			}
+		}
+	}
+
+	means := make(map[string]float64)
+	for metric, sum := range sums {
+		means[metric] = sum / float64(counts[metric])
+	}
+	return means
+}
+
+// growth is how many times larger the recent mean of a metric is than its
+// baseline mean, or 1 when either is missing.
+func (features *features) growth(metric string) float64 {
+	recent, hasRecent := features.recent[metric]
+	baseline, hasBaseline := features.baseline[metric]
+	if !hasRecent || !hasBaseline || baseline == 0 {
+		return 1
+	}
+	return recent / baseline
+}
+
+func (features *features) ratio(numeratorMetric string, denominatorMetric string) float64 {
+	numerator, hasNumerator := features.recent[numeratorMetric]
+	denominator, hasDenominator := features.recent[denominatorMetric]
+	if !hasNumerator || !hasDenominator || denominator == 0 {
+		return 0
+	}
+	return numerator / denominator
+}
+
+// ramp maps a measure onto a 0-1 confidence, reaching 0 at low and 1 at high.
+func ramp(value float64, low float64, high float64) float64 {
+	return math.Max(0, math.Min(1, (value-low)/(high-low)))
+}
+
+// imbalance is how lopsided a ratio is in either direction, 0 when balanced.
+func imbalance(ratio float64) float64 {
+	if ratio <= 0 {
+		return 0
+	}
+	return math.Abs(math.Log(ratio))
+}
+
+func describe(measure string, growth float64) string {
+	return fmt.Sprintf(`%s at %.2fx baseline`, measure, growth)
+}
+
+func describeRatio(measure string, ratio float64) string {
+	return fmt.Sprintf(`%s of %.2f`, measure, ratio)
+}
+
+type heuristic func(features *features) (float64, []string, string)
+
+// heuristics encode rules of thumb from vibration analysis. Without spectra,
+// overall RMS velocity stands in for the 1x running speed component.
+var heuristics = map[string]heuristic{
+	FaultUnbalance: func(features *features) (float64, []string, string) {
+		velocityGrowth := math.Max(features.growth("rmsVelocityX"), features.growth("rmsVelocityY"))
+		axisRatio := features.ratio("rmsVelocityX", "rmsVelocityY")
+		temperatureGrowth := features.growth("temperature")
+		confidence := ramp(velocityGrowth, 1.2, 2) * (1 - ramp(imbalance(axisRatio), 0.3, 0.7)) * (1 - ramp(temperatureGrowth, 1.05, 1.2))
+		return confidence, []string{
+			describe("RMS velocity", velocityGrowth),
+			describeRatio("X/Y RMS velocity", axisRatio),
+			describe("temperature", temperatureGrowth),
+		}, "Check the rotor for buildup or missing balance weights and schedule a trim balance."
+	},
+	FaultMisalignment: func(features *features) (float64, []string, string) {
+		axisRatio := features.ratio("rmsVelocityX", "rmsVelocityY")
+		velocityGrowth := math.Max(features.growth("rmsVelocityX"), features.growth("rmsVelocityY"))
+		confidence := ramp(imbalance(axisRatio), 0.5, 1.1) * ramp(velocityGrowth, 1, 1.5)
+		return confidence, []string{
+			describeRatio("X/Y RMS velocity", axisRatio),
+			describe("RMS velocity", velocityGrowth),
+		}, "Verify shaft and coupling alignment and check for soft foot."
+	},
+	FaultLooseness: func(features *features) (float64, []string, string) {
+		crestFactor := math.Max(features.ratio("peakVelocityX", "rmsVelocityX"), features.ratio("peakVelocityY", "rmsVelocityY"))
+		confidence := ramp(crestFactor, 3, 5)
+		return confidence, []string{
+			describeRatio("velocity crest factor", crestFactor),
+		}, "Inspect mounting bolts, base and bearing housings for looseness."
+	},
+	FaultBearingWear: func(features *features) (float64, []string, string) {
+		crestFactor := math.Max(features.ratio("peakAccelerationX", "rmsAccelerationX"), features.ratio("peakAccelerationY", "rmsAccelerationY"))
+		accelerationGrowth := math.Max(features.growth("rmsAccelerationX"), features.growth("rmsAccelerationY"))
+		confidence := math.Max(ramp(crestFactor, 3.5, 6), ramp(accelerationGrowth, 1.3, 2.5)) * (0.5 + 0.5*ramp(features.growth("temperature"), 1, 1.15))
+		return confidence, []string{
+			describeRatio("acceleration crest factor", crestFactor),
+			describe("RMS acceleration", accelerationGrowth),
+		}, "Check bearing lubrication and plan a bearing inspection."
+	},
+	FaultOverheating: func(features *features) (float64, []string, string) {
+		temperatureGrowth := features.growth("temperature")
+		confidence := ramp(temperatureGrowth, 1.1, 1.4)
+		return confidence, []string{
+			describe("temperature", temperatureGrowth),
+		}, "Check cooling airflow, lubrication and load on the motor."
+	},
+}
+
+// minimumConfidence keeps marginal findings out of the results.
+const minimumConfidence = 0.2
+
+// Diagnose applies every heuristic to the last hours of a hardware's samples
+// and returns the findings ranked by confidence.
+func Diagnose(hardwareId string) ([]*Finding, error) {
+	latestValues, err := hardware.LatestValues(hardwareId)
+	if err != nil {
+		return nil, err
+	}
+
+	var latestTime time.Time
+	for _, latestValue := range latestValues {
+		if latestValue.Time.After(latestTime) {
+			latestTime = latestValue.Time
+		}
+	}
+	if latestTime.IsZero() {
+		return nil, hardware.ErrNoData
+	}
+
+	recentFrom := latestTime.Add(-recentWindow)
+	recentSamples, err := hardware.SamplesBetween(hardwareId, recentFrom, latestTime)
+	if err != nil {
+		return nil, err
+	}
+	baselineSamples, err := hardware.SamplesBetween(hardwareId, recentFrom.Add(-baselineWindow), recentFrom)
+	if err != nil {
+		return nil, err
+	}
+	sampleFeatures := &features{recent: meansOf(recentSamples), baseline: meansOf(baselineSamples)}
+
+	findings := make([]*Finding, 0)
+	for fault, heuristic := range heuristics {
+		confidence, evidence, suggestion := heuristic(sampleFeatures)
+		if math.IsNaN(confidence) || confidence < minimumConfidence {
+			continue
+		}
+		findings = append(findings, &Finding{
+			Fault:      fault,
+			Confidence: math.Round(confidence*100) / 100,
+			Evidence:   evidence,
+			Suggestion: suggestion,
+			RecentFrom: recentFrom,
+			RecentTo:   latestTime,
+		})
+	}
+	sort.Slice(findings, func(leftIndex, rightIndex int) bool {
+		if findings[leftIndex].Confidence != findings[rightIndex].Confidence {
+			return findings[leftIndex].Confidence > findings[rightIndex].Confidence
+		}
+		return findings[leftIndex].Fault < findings[rightIndex].Fault
+	})
+	return findings, nil
+}
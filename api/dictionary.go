@@ -0,0 +1,52 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/config"
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/hardware"
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/units"
+)
+
+type ChannelDescription struct {
+	Metric    string         `json:"metric"`
+	Name      string         `json:"name"`
+	Precision *int           `json:"precision"`
+	Unit      *units.Unit    `json:"unit,omitempty"`
+	Limits    *config.Limits `json:"limits,omitempty"`
+}
+
+func handleDictionary(response http.ResponseWriter, request *http.Request) {
+	if request.Method != "GET" {
+		response.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	channelDescriptions := make([]*ChannelDescription, 0)
+	for _, metric := range hardware.Metrics() {
+		channelDescription := &ChannelDescription{Metric: metric}
+		channelDescription.Name, _ = hardware.NameOf(metric)
+		if unitName, hasUnit := hardware.UnitOf(metric); hasUnit {
+			if unit, isKnown := units.Lookup(unitName); isKnown {
+				channelDescription.Unit = &unit
+			}
+		}
+		if decimals, hasPrecision := config.Current.PrecisionOf(metric); hasPrecision {
+			channelDescription.Precision = &decimals
+		}
+		if limits, hasLimits := hardware.LimitsFor(request.URL.Query().Get("id"), metric); hasLimits {
+			channelDescription.Limits = &limits
+		}
+		channelDescriptions = append(channelDescriptions, channelDescription)
+	}
+
+	responseBytes, err := json.Marshal(channelDescriptions)
+	if err != nil {
+		response.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	response.WriteHeader(http.StatusOK)
+	response.Write(responseBytes)
+}
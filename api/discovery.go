@@ -0,0 +1,90 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/cmms"
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/hardware"
+)
+
+// HardwareProfileResponseData is the profile a hardware was commissioned
+// with, and the defect orders of its bearing when it has one.
+type HardwareProfileResponseData struct {
+	*hardware.Profile
+	DefectOrders *hardware.DefectOrders `json:"defectOrders,omitempty"`
+}
+
+// HardwareDescriptionResponseData is a hardware's description alongside
+// its profile, and what the CMMS knows of it, when one is configured and
+// knows it.
+type HardwareDescriptionResponseData struct {
+	*hardware.Description
+	Profile *HardwareProfileResponseData `json:"profile,omitempty"`
+	Asset   *cmms.Asset                  `json:"asset,omitempty"`
+}
+
+func profileResponseOf(hardwareId string) *HardwareProfileResponseData {
+	profile := hardware.ProfileOf(hardwareId)
+	if profile == nil {
+		return nil
+	}
+	responseData := &HardwareProfileResponseData{Profile: profile}
+	if profile.Bearing != nil {
+		defectOrders := profile.Bearing.DefectOrders()
+		responseData.DefectOrders = &defectOrders
+	}
+	return responseData
+}
+
+// handleHardwareList lets a client discover which hardware exists, what each
+// reports and over what time range, instead of guessing IDs.
+func handleHardwareList(response http.ResponseWriter, request *http.Request) {
+	if request.Method != "GET" {
+		response.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	descriptions := hardware.ListHardware()
+	hardwareIds := make([]string, 0, len(descriptions))
+	for _, description := range descriptions {
+		hardwareIds = append(hardwareIds, description.Id)
+	}
+	assets := cmms.LookupAll(request.Context(), hardwareIds)
+	responseData := make([]HardwareDescriptionResponseData, 0, len(descriptions))
+	for _, description := range descriptions {
+		responseData = append(responseData, HardwareDescriptionResponseData{Description: description, Profile: profileResponseOf(description.Id), Asset: assets[description.Id]})
+	}
+
+	responseBytes, err := json.Marshal(responseData)
+	if err != nil {
+		response.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	response.WriteHeader(http.StatusOK)
+	response.Write(responseBytes)
+}
+
+func handleHardwareDescription(response http.ResponseWriter, request *http.Request, hardwareId string) {
+	if request.Method != "GET" {
+		response.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	description, err := hardware.Describe(hardwareId)
+	if err != nil {
+		response.WriteHeader(errorStatus(err, http.StatusInternalServerError))
+		return
+	}
+	// The description stands without the asset when the CMMS cannot be reached
+	asset, _ := cmms.Lookup(request.Context(), hardwareId)
+	responseBytes, err := json.Marshal(HardwareDescriptionResponseData{Description: description, Profile: profileResponseOf(hardwareId), Asset: asset})
+	if err != nil {
+		response.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	response.WriteHeader(http.StatusOK)
+	response.Write(responseBytes)
+}
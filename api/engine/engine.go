@@ -0,0 +1,99 @@
+// Package engine runs the sample store, the alert engine, invalidation and
+// the pullers inside a service of its own, the way cmd/server does, and
+// serves the HTTP API from that service's mux. It is configured through
+// config.Current, which is loaded or set before Start, so one engine runs per
+// process.
+package engine
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api"
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/alerts"
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/config"
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/hardware"
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/puller"
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/internal/accesslog"
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/internal/invalidation"
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/internal/lifecycle"
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/internal/querylog"
+)
+
+// Engine is a started engine. Shutdown stops it.
+type Engine struct {
+	cancel context.CancelFunc
+}
+
+// Start opens the configured store, loads the sample tree at samplesPath
+// into it, and starts evaluating alerts, following other replicas and
+// pulling from remote sources until ctx is done or the engine is shut down.
+func Start(ctx context.Context, samplesPath string) (*Engine, error) {
+	store, err := hardware.OpenStore()
+	if err != nil {
+		return nil, err
+	}
+	if err := hardware.UseStore(store); err != nil {
+		return nil, err
+	}
+	if err := hardware.PopulateSamplesFrom(samplesPath); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	engine := &Engine{cancel: cancel}
+
+	// Hooks run in reverse: requests and pullers stop before anything they
+	// write to is flushed and closed
+	lifecycle.OnShutdown("storage", func(ctx context.Context) error {
+		return hardware.Close()
+	})
+	lifecycle.OnShutdown("access log", func(ctx context.Context) error {
+		return accesslog.Close()
+	})
+	lifecycle.OnShutdown("query log", func(ctx context.Context) error {
+		return querylog.Close()
+	})
+	alerts.Start(ctx, config.Current.Alerting)
+	lifecycle.OnShutdown("alert webhooks", alerts.Drain)
+	if err := invalidation.Start(ctx, config.Current.Invalidation); err != nil {
+		cancel()
+		return nil, err
+	}
+	if err := puller.Start(ctx, config.Current.Pullers); err != nil {
+		cancel()
+		return nil, err
+	}
+	lifecycle.OnShutdown("pullers", func(ctx context.Context) error {
+		cancel()
+		return puller.Wait(ctx)
+	})
+	return engine, nil
+}
+
+// Register serves the HTTP API from mux: /api/, the Prometheus metrics at
+// /metrics and the query page at /query.
+func (engine *Engine) Register(mux *http.ServeMux) {
+	mux.HandleFunc("/api/", api.Handle)
+	mux.HandleFunc("/metrics", api.HandleMetrics)
+	mux.HandleFunc("/query", api.HandleQueryPage)
+}
+
+// OnShutdown runs hook when the engine shuts down, before the engine's own
+// hooks, so a server serving the API can stop taking requests first.
+func (engine *Engine) OnShutdown(name string, hook func(ctx context.Context) error) {
+	lifecycle.OnShutdown(name, hook)
+}
+
+// Drain makes readiness fail while requests are still served, so load
+// balancers stop routing to the service before it shuts down.
+func (engine *Engine) Drain() {
+	lifecycle.BeginDrain()
+}
+
+// Shutdown stops the pullers and alert notifications, flushes what they and
+// ingestion wrote and closes the store, giving up when ctx is done.
+func (engine *Engine) Shutdown(ctx context.Context) error {
+	defer engine.cancel()
+	return lifecycle.Shutdown(ctx)
+}
@@ -0,0 +1,30 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/hardware"
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/timeseries"
+)
+
+// errorStatus maps the hardware package's errors onto HTTP statuses, falling
+// back to the caller's choice for anything else.
+func errorStatus(err error, fallback int) int {
+	switch {
+	case errors.Is(err, hardware.ErrUnknownHardware), errors.Is(err, hardware.ErrNoData):
+		return http.StatusNotFound
+	case errors.Is(err, hardware.ErrUnknownMetric), errors.Is(err, timeseries.ErrUnknownMethod), errors.Is(err, timeseries.ErrUnknownDensity), errors.Is(err, errBucketsTooNarrow):
+		return http.StatusBadRequest
+	case errors.Is(err, hardware.ErrOutOfRange):
+		return http.StatusUnprocessableEntity
+	case errors.Is(err, hardware.ErrLocked):
+		return http.StatusConflict
+	case errors.Is(err, hardware.ErrStoreUnavailable):
+		return http.StatusServiceUnavailable
+	case errors.Is(err, hardware.ErrSnapshotUnavailable):
+		return http.StatusGone
+	default:
+		return fallback
+	}
+}
@@ -0,0 +1,329 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/config"
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/export"
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/hardware"
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/timeseries"
+)
+
+const (
+	ExportRaw       = "raw"
+	ExportTabulated = "tabulated"
+)
+
+// exportFilename names a download after its hardware and window, such as
+// fan_1_20220701T000000Z_20220702T000000Z.csv.
+func exportFilename(hardwareId string, from time.Time, to time.Time, format string) string {
+	const layout = "20060102T150405Z"
+	return fmt.Sprintf("%s_%s_%s.%s", hardwareId, from.UTC().Format(layout), to.UTC().Format(layout), format)
+}
+
+// handleExport downloads a window of a hardware as a wide table, either its
+// raw samples or samples interpolated like a tabulation, on an even grid or
+// placed adaptively by density, and optionally as of an earlier time.
+// Rows stream out as they are produced, so an error midway truncates the
+// download rather than changing its status. A download that dropped resumes
+// with a Range of one span of bytes, under If-Range with the ETag it was
+// sent, so long as the samples of the window did not change in between. The
+// ETag follows the journal of the process, so a download resumed against
+// another replica starts over.
+func handleExport(response http.ResponseWriter, request *http.Request, hardwareId string) {
+	if request.Method != "GET" {
+		response.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if !hardware.HasSamples(hardwareId) {
+		response.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	query := request.URL.Query()
+	from, err := time.Parse(time.RFC3339, query.Get("from"))
+	if err != nil {
+		response.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	to, err := time.Parse(time.RFC3339, query.Get("to"))
+	if err != nil || !to.After(from) {
+		response.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	format := query.Get("format")
+	if format == "" {
+		format = export.FormatCSV
+	}
+	if format != export.FormatCSV && format != export.FormatXLSX {
+		response.WriteHeader(http.StatusBadRequest)
+		response.Write([]byte(fmt.Sprintf(`unknown export format "%s"`, format)))
+		return
+	}
+
+	metrics := hardware.Metrics()
+	if query.Get("metrics") != "" {
+		metrics = strings.Split(query.Get("metrics"), ",")
+	}
+	for _, metric := range metrics {
+		if !hardware.IsMetric(metric) {
+			response.WriteHeader(http.StatusBadRequest)
+			response.Write([]byte(fmt.Sprintf(`%v "%s"`, hardware.ErrUnknownMetric, metric)))
+			return
+		}
+	}
+
+	// An asOf exports the samples as they were at that time
+	requestData := TabulatedHardwareRequestData{Id: hardwareId, From: from, To: to, Method: query.Get("method"), Density: query.Get("density")}
+	if query.Get("asOf") != "" {
+		asOf, err := time.Parse(time.RFC3339Nano, query.Get("asOf"))
+		if err != nil {
+			response.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		requestData.AsOf = &asOf
+	}
+	source, err := tabulationSourceOf(&requestData)
+	if err != nil {
+		response.WriteHeader(errorStatus(err, http.StatusInternalServerError))
+		response.Write([]byte(err.Error()))
+		return
+	}
+
+	// Interpolated samples are only worked out as their rows are written
+	var rowTimes []time.Time
+	var rowSample func(rowIndex int) (*hardware.Sample, error)
+	// neighbors is how far past the window rows read samples
+	var neighbors int
+	switch mode := query.Get("mode"); mode {
+	case "", ExportRaw:
+		rawSamples, err := source.SamplesBetween(from, to)
+		if err != nil {
+			response.WriteHeader(errorStatus(err, http.StatusInternalServerError))
+			return
+		}
+		for len(rawSamples) > 0 && !rawSamples[len(rawSamples)-1].Time.Before(to) {
+			rawSamples = rawSamples[:len(rawSamples)-1]
+		}
+		for _, rawSample := range rawSamples {
+			rowTimes = append(rowTimes, rawSample.Time)
+		}
+		rowSample = func(rowIndex int) (*hardware.Sample, error) {
+			return rawSamples[rowIndex], nil
+		}
+	case ExportTabulated:
+		if requestData.Count, err = strconv.Atoi(query.Get("count")); err != nil {
+			response.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		interpolator, err := timeseries.InterpolatorFor(requestData.Method)
+		if err != nil {
+			response.WriteHeader(errorStatus(err, http.StatusBadRequest))
+			response.Write([]byte(err.Error()))
+			return
+		}
+		if err := timeseries.CheckDensity(requestData.Density); err != nil {
+			response.WriteHeader(errorStatus(err, http.StatusBadRequest))
+			response.Write([]byte(err.Error()))
+			return
+		}
+		neighbors = interpolator.Neighbors()
+		requestedCount := requestData.Count
+		if requestData.Count, _, err = clampCount(&requestData, source); err != nil {
+			response.WriteHeader(errorStatus(err, http.StatusInternalServerError))
+			return
+		}
+		if rowTimes, err = tabulationTimestamps(&requestData, source); err != nil {
+			response.WriteHeader(errorStatus(err, http.StatusBadRequest))
+			return
+		}
+		if requestData.Count != requestedCount {
+			response.Header().Set("X-Count-Adjusted", fmt.Sprintf("%d -> %d", requestedCount, requestData.Count))
+		}
+		rowSample = func(rowIndex int) (*hardware.Sample, error) {
+			return source.InterpolateSampleWith(rowTimes[rowIndex], interpolator)
+		}
+	default:
+		response.WriteHeader(http.StatusBadRequest)
+		response.Write([]byte(fmt.Sprintf(`unknown export mode "%s"`, mode)))
+		return
+	}
+
+	response.Header().Set("Content-Type", export.ContentType(format))
+	response.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, exportFilename(hardwareId, from, to, format)))
+	response.Header().Set("Accept-Ranges", "bytes")
+	sequence := hardware.WindowSequence(hardwareId, from, to, neighbors)
+	if setCacheHeaders(response, request, nil, sequence, to) {
+		response.WriteHeader(http.StatusNotModified)
+		return
+	}
+	eTag := revisionETag(request, nil, sequence)
+	response.Header().Set("ETag", eTag)
+	isUnchanged := func() bool {
+		return hardware.WindowSequence(hardwareId, from, to, neighbors) == sequence
+	}
+
+	writeRows := func(output io.Writer) error {
+		writer, err := export.NewWriter(format, output, metrics, config.Current.Location())
+		if err != nil {
+			return err
+		}
+		values := make([]*float64, len(metrics))
+		for rowIndex := range rowTimes {
+			sample, err := rowSample(rowIndex)
+			if errors.Is(err, hardware.ErrOutOfRange) {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			for metricIndex, metric := range metrics {
+				values[metricIndex], _ = sample.ValueByMetric(metric)
+			}
+			if err := writer.WriteRow(sample.Time, values); err != nil {
+				return err
+			}
+		}
+		return writer.Close()
+	}
+
+	rangeHeader := request.Header.Get("Range")
+	if ifRange := request.Header.Get("If-Range"); ifRange != "" && ifRange != eTag {
+		rangeHeader = ""
+	}
+	if rangeHeader == "" {
+		response.WriteHeader(http.StatusOK)
+		if err := writeRows(response); err != nil {
+			log.Printf("export of hardware \"%s\": %v\n", hardwareId, err)
+		}
+		return
+	}
+
+	// A resumed download is rendered twice rather than held in memory: once
+	// to learn its length, to range over, and once to send the part asked for
+	lengthCounter := &exportPart{first: -1}
+	if err := writeRows(lengthCounter); err != nil {
+		log.Printf("export of hardware \"%s\": %v\n", hardwareId, err)
+		response.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	length := lengthCounter.written
+	// Samples that changed meanwhile make it other than what the ETag names,
+	// so the part asked for would not continue what was sent
+	if !isUnchanged() {
+		response.Header().Del("ETag")
+		response.WriteHeader(http.StatusOK)
+		if err := writeRows(response); err != nil {
+			log.Printf("export of hardware \"%s\": %v\n", hardwareId, err)
+		}
+		return
+	}
+	first, last, err := parseByteRange(rangeHeader, length)
+	if err != nil {
+		response.Header().Set("Content-Range", fmt.Sprintf("bytes */%d", length))
+		response.WriteHeader(http.StatusRequestedRangeNotSatisfiable)
+		response.Write([]byte(err.Error()))
+		return
+	}
+	response.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", first, last, length))
+	response.Header().Set("Content-Length", strconv.FormatInt(last-first+1, 10))
+	response.WriteHeader(http.StatusPartialContent)
+
+	part := &exportPart{output: response, first: first, last: last}
+	if err := writeRows(part); err != nil {
+		log.Printf("export of hardware \"%s\": %v\n", hardwareId, err)
+		return
+	}
+	// The last byte is held back until the part is known to continue what was
+	// sent; without it, the response falls short of its length and the
+	// client sees the download drop again rather than take other bytes
+	if !isUnchanged() {
+		log.Printf("export of hardware \"%s\": samples changed while a part was sent\n", hardwareId)
+		return
+	}
+	response.Write([]byte{part.lastByte})
+}
+
+// exportPart passes on the bytes of an export from first to last, but the
+// last, which it keeps, and counts every byte written to it. With a negative
+// first, it only counts them.
+type exportPart struct {
+	output      io.Writer
+	first, last int64
+	written     int64
+	lastByte    byte
+}
+
+func (part *exportPart) Write(data []byte) (int, error) {
+	start := part.written
+	part.written += int64(len(data))
+	if part.first < 0 {
+		return len(data), nil
+	}
+
+	from, to := part.first-start, part.last-start
+	if from < 0 {
+		from = 0
+	}
+	if to >= 0 && to < int64(len(data)) {
+		part.lastByte = data[to]
+	} else if to > int64(len(data)) {
+		to = int64(len(data))
+	}
+	if from < to {
+		if _, err := part.output.Write(data[from:to]); err != nil {
+			return 0, err
+		}
+	}
+	return len(data), nil
+}
+
+// parseByteRange reads a Range header asking for one range of a body of
+// length bytes, returning its first and last byte. Several ranges are not
+// supported.
+func parseByteRange(rangeHeader string, length int64) (int64, int64, error) {
+	spec := strings.TrimPrefix(rangeHeader, "bytes=")
+	firstPart, lastPart, hasDash := strings.Cut(spec, "-")
+	if spec == rangeHeader || !hasDash || strings.Contains(spec, ",") {
+		return 0, 0, fmt.Errorf(`unsupported range "%s", only one byte range is`, rangeHeader)
+	}
+
+	var first, last int64
+	var err error
+	if firstPart == "" {
+		// A suffix range asks for the last bytes
+		suffixLength, err := strconv.ParseInt(lastPart, 10, 64)
+		if err != nil || suffixLength <= 0 {
+			return 0, 0, fmt.Errorf(`malformed range "%s"`, rangeHeader)
+		}
+		if suffixLength > length {
+			suffixLength = length
+		}
+		first, last = length-suffixLength, length-1
+	} else {
+		if first, err = strconv.ParseInt(firstPart, 10, 64); err != nil || first < 0 {
+			return 0, 0, fmt.Errorf(`malformed range "%s"`, rangeHeader)
+		}
+		last = length - 1
+		if lastPart != "" {
+			if last, err = strconv.ParseInt(lastPart, 10, 64); err != nil || last < first {
+				return 0, 0, fmt.Errorf(`malformed range "%s"`, rangeHeader)
+			}
+			if last >= length {
+				last = length - 1
+			}
+		}
+	}
+	if first >= length {
+		return 0, 0, fmt.Errorf(`range "%s" starts past the %d bytes of the export`, rangeHeader, length)
+	}
+	return first, last, nil
+}
@@ -0,0 +1,37 @@
+package export
+
+import (
+	"encoding/csv"
+	"io"
+	"strconv"
+	"time"
+)
+
+type csvWriter struct {
+	csvWriter *csv.Writer
+	record    []string
+}
+
+func newCSVWriter(output io.Writer, columns []string) (*csvWriter, error) {
+	writer := &csvWriter{csvWriter: csv.NewWriter(output), record: make([]string, len(columns)+1)}
+	if err := writer.csvWriter.Write(append([]string{"timestamp"}, columns...)); err != nil {
+		return nil, err
+	}
+	return writer, nil
+}
+
+func (writer *csvWriter) WriteRow(at time.Time, values []*float64) error {
+	writer.record[0] = strconv.FormatInt(at.UnixMilli(), 10)
+	for valueIndex, value := range values {
+		writer.record[valueIndex+1] = ""
+		if value != nil {
+			writer.record[valueIndex+1] = strconv.FormatFloat(*value, 'f', -1, 64)
+		}
+	}
+	return writer.csvWriter.Write(writer.record)
+}
+
+func (writer *csvWriter) Close() error {
+	writer.csvWriter.Flush()
+	return writer.csvWriter.Error()
+}
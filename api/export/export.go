@@ -0,0 +1,49 @@
+// Package export writes wide tables of samples, one row per point in time
+// and one column per metric, as CSV or XLSX.
+package export
+
+import (
+	"fmt"
+	"io"
+	"time"
+)
+
+const (
+	FormatCSV  = "csv"
+	FormatXLSX = "xlsx"
+)
+
+// Writer streams rows out as they are written, so a table never has to be
+// held in memory whole.
+type Writer interface {
+	// WriteRow writes the values at one time, in the order of the columns the
+	// writer was made with. A nil value leaves its cell empty.
+	WriteRow(at time.Time, values []*float64) error
+
+	// Close finishes the table; nothing written is complete without it.
+	Close() error
+}
+
+// NewWriter starts a table of the given metric columns, preceded by a time
+// column. CSV times are Unix milliseconds, as /api/ingest takes them back;
+// XLSX times are dates on the wall clock of location, as spreadsheets have no
+// time zones.
+func NewWriter(format string, output io.Writer, columns []string, location *time.Location) (Writer, error) {
+	switch format {
+	case FormatCSV:
+		return newCSVWriter(output, columns)
+	case FormatXLSX:
+		return newXLSXWriter(output, columns, location)
+	default:
+		return nil, fmt.Errorf(`unknown export format "%s"`, format)
+	}
+}
+
+func ContentType(format string) string {
+	switch format {
+	case FormatXLSX:
+		return "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+	default:
+		return "text/csv; charset=utf-8"
+	}
+}
@@ -0,0 +1,123 @@
+package export
+
+import (
+	"archive/zip"
+	"bufio"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"time"
+)
+
+// maxXLSXRows is as many rows as a worksheet holds, the header included.
+const maxXLSXRows = 1048576
+
+var ErrTooManyRows = errors.New("too many rows for a worksheet")
+
+// The fixed parts of a workbook with a single worksheet. The second cell
+// style formats dates.
+var xlsxParts = []struct {
+	name    string
+	content string
+}{
+	{"[Content_Types].xml", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types"><Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/><Default Extension="xml" ContentType="application/xml"/><Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/><Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/><Override PartName="/xl/styles.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.styles+xml"/></Types>`},
+	{"_rels/.rels", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/></Relationships>`},
+	{"xl/workbook.xml", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheets><sheet name="Samples" sheetId="1" r:id="rId1"/></sheets></workbook>`},
+	{"xl/_rels/workbook.xml.rels", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/><Relationship Id="rId2" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="styles.xml"/></Relationships>`},
+	{"xl/styles.xml", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<styleSheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><numFmts count="1"><numFmt numFmtId="164" formatCode="yyyy-mm-dd hh:mm:ss.000"/></numFmts><fonts count="1"><font><sz val="11"/><name val="Calibri"/></font></fonts><fills count="2"><fill><patternFill patternType="none"/></fill><fill><patternFill patternType="gray125"/></fill></fills><borders count="1"><border><left/><right/><top/><bottom/><diagonal/></border></borders><cellStyleXfs count="1"><xf numFmtId="0" fontId="0" fillId="0" borderId="0"/></cellStyleXfs><cellXfs count="2"><xf numFmtId="0" fontId="0" fillId="0" borderId="0" xfId="0"/><xf numFmtId="164" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/></cellXfs><cellStyles count="1"><cellStyle name="Normal" xfId="0" builtinId="0"/></cellStyles></styleSheet>`},
+}
+
+type xlsxWriter struct {
+	archive       *zip.Writer
+	sheet         *bufio.Writer
+	location      *time.Location
+	columnLetters []string
+	rows          int
+}
+
+func newXLSXWriter(output io.Writer, columns []string, location *time.Location) (*xlsxWriter, error) {
+	archive := zip.NewWriter(output)
+	for _, part := range xlsxParts {
+		partWriter, err := archive.Create(part.name)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := io.WriteString(partWriter, part.content); err != nil {
+			return nil, err
+		}
+	}
+
+	// The worksheet is the last part, so its rows can stream straight into it
+	sheetWriter, err := archive.Create("xl/worksheets/sheet1.xml")
+	if err != nil {
+		return nil, err
+	}
+	writer := &xlsxWriter{archive: archive, sheet: bufio.NewWriter(sheetWriter), location: location}
+	for columnIndex := 0; columnIndex <= len(columns); columnIndex++ {
+		writer.columnLetters = append(writer.columnLetters, columnLetter(columnIndex))
+	}
+
+	writer.sheet.WriteString(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` + "\n")
+	writer.sheet.WriteString(`<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetViews><sheetView workbookViewId="0"><pane ySplit="1" topLeftCell="A2" activePane="bottomLeft" state="frozen"/></sheetView></sheetViews><cols><col min="1" max="1" width="24" customWidth="1"/></cols><sheetData>`)
+	writer.rows++
+	fmt.Fprintf(writer.sheet, `<row r="1">`)
+	for columnIndex, column := range append([]string{"time"}, columns...) {
+		fmt.Fprintf(writer.sheet, `<c r="%s1" t="inlineStr"><is><t>`, writer.columnLetters[columnIndex])
+		xml.EscapeText(writer.sheet, []byte(column))
+		writer.sheet.WriteString(`</t></is></c>`)
+	}
+	writer.sheet.WriteString(`</row>`)
+	return writer, nil
+}
+
+// columnLetter names a zero-based column the way spreadsheets do: A to Z,
+// then AA onwards.
+func columnLetter(columnIndex int) string {
+	letters := ""
+	for columnIndex++; columnIndex > 0; columnIndex = (columnIndex - 1) / 26 {
+		letters = string(rune('A'+(columnIndex-1)%26)) + letters
+	}
+	return letters
+}
+
+// serialDate is a time as spreadsheets count it: days since December 30,
+// 1899 on the wall clock, with the time of day as the fraction.
+func serialDate(at time.Time, location *time.Location) float64 {
+	_, offset := at.In(location).Zone()
+	wallMilliseconds := at.UnixMilli() + int64(offset)*1000
+	return float64(wallMilliseconds)/float64(24*time.Hour/time.Millisecond) + 25569
+}
+
+func (writer *xlsxWriter) WriteRow(at time.Time, values []*float64) error {
+	if writer.rows == maxXLSXRows {
+		return fmt.Errorf(`%w: at most %d rows fit`, ErrTooManyRows, maxXLSXRows-1)
+	}
+	writer.rows++
+
+	row := strconv.Itoa(writer.rows)
+	fmt.Fprintf(writer.sheet, `<row r="%s"><c r="A%s" s="1"><v>%s</v></c>`, row, row, strconv.FormatFloat(serialDate(at, writer.location), 'f', -1, 64))
+	for valueIndex, value := range values {
+		if value == nil || math.IsNaN(*value) || math.IsInf(*value, 0) {
+			continue
+		}
+		fmt.Fprintf(writer.sheet, `<c r="%s%s"><v>%s</v></c>`, writer.columnLetters[valueIndex+1], row, strconv.FormatFloat(*value, 'g', -1, 64))
+	}
+	_, err := writer.sheet.WriteString(`</row>`)
+	return err
+}
+
+func (writer *xlsxWriter) Close() error {
+	writer.sheet.WriteString(`</sheetData></worksheet>`)
+	if err := writer.sheet.Flush(); err != nil {
+		return err
+	}
+	return writer.archive.Close()
+}
@@ -0,0 +1,86 @@
+package api_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api"
+)
+
+func TestRangedExport(t *testing.T) {
+	if err := loadContractFixtures(); err != nil {
+		t.Fatal(err)
+	}
+	exportPath := "/api/hardware/contract_pump/export?" + window
+
+	full := httptest.NewRecorder()
+	api.Handle(full, httptest.NewRequest("GET", exportPath, nil))
+	if full.Code != http.StatusOK {
+		t.Fatalf(`export answered %d`, full.Code)
+	}
+	body := full.Body.Bytes()
+
+	for _, ranged := range []struct {
+		header string
+		part   []byte
+	}{
+		{"bytes=10-19", body[10:20]},
+		{"bytes=-7", body[len(body)-7:]},
+		{"bytes=20-", body[20:]},
+		{"bytes=0-0", body[:1]},
+	} {
+		request := httptest.NewRequest("GET", exportPath, nil)
+		request.Header.Set("Range", ranged.header)
+		request.Header.Set("If-Range", full.Header().Get("ETag"))
+		response := httptest.NewRecorder()
+		api.Handle(response, request)
+		if response.Code != http.StatusPartialContent || response.Body.String() != string(ranged.part) {
+			t.Errorf(`%s answered %d with %q, not %q`, ranged.header, response.Code, response.Body.String(), ranged.part)
+		}
+	}
+
+	request := httptest.NewRequest("GET", exportPath, nil)
+	request.Header.Set("Range", "bytes=100000-")
+	response := httptest.NewRecorder()
+	api.Handle(response, request)
+	if response.Code != http.StatusRequestedRangeNotSatisfiable {
+		t.Errorf(`a range past the end answered %d`, response.Code)
+	}
+}
+
+func TestExportETagFollowsItsWindow(t *testing.T) {
+	if err := loadContractFixtures(); err != nil {
+		t.Fatal(err)
+	}
+	exportPath := "/api/hardware/contract_pump/export?" + window
+
+	eTag := func() string {
+		response := httptest.NewRecorder()
+		api.Handle(response, httptest.NewRequest("GET", exportPath, nil))
+		return response.Header().Get("ETag")
+	}
+	ingest := func(hardwareId string, csv string) {
+		request := httptest.NewRequest("POST", "/api/ingest?hardwareId="+hardwareId+"&persist=false", strings.NewReader("timestamp,temperature\n"+csv))
+		request.Header.Set("Content-Type", "text/csv")
+		response := httptest.NewRecorder()
+		api.Handle(response, request)
+		if response.Code != http.StatusOK {
+			t.Fatalf(`ingest answered %d: %s`, response.Code, response.Body)
+		}
+	}
+
+	first := eTag()
+	// Readings of another hardware, or of this one long after the window,
+	// leave the export as it was
+	ingest("contract_fan", "1656634500000,99\n")
+	ingest("contract_pump", "1656640800000,99\n")
+	if unchanged := eTag(); unchanged != first {
+		t.Errorf(`expected the ETag kept after readings outside the window, got "%s" and "%s"`, first, unchanged)
+	}
+	ingest("contract_pump", "1656634500000,99\n")
+	if changed := eTag(); changed == first {
+		t.Errorf(`expected a new ETag after a reading in the window`)
+	}
+}
@@ -0,0 +1,312 @@
+// Package faults lays synthetic fault signatures over the readings of a
+// hardware and checks that the monitoring pipeline catches each of them:
+// level and rate faults through the alert engine, dropouts through the
+// confidence of the values interpolated across them.
+package faults
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"time"
+
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/alerts"
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/config"
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/hardware"
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/timeseries"
+)
+
+const (
+	// KindStep holds the metric Magnitude above its baseline.
+	KindStep = "step"
+	// KindRamp climbs to Magnitude above the baseline, evenly over Duration.
+	KindRamp = "ramp"
+	// KindSpike lifts a single reading Magnitude above the baseline.
+	KindSpike = "spike"
+	// KindDropout leaves readings out.
+	KindDropout = "dropout"
+)
+
+// DropoutConfidence is the interpolation confidence the middle of a dropout
+// must fall below for it to count as caught.
+const DropoutConfidence = 0.5
+
+// Fault is a signature Duration readings long. Spikes are always one reading
+// long, and Magnitude does not apply to dropouts.
+type Fault struct {
+	Kind      string  `json:"kind"`
+	Duration  int     `json:"duration"`
+	Magnitude float64 `json:"magnitude"`
+}
+
+func (fault *Fault) Validate() error {
+	switch fault.Kind {
+	case KindStep, KindRamp, KindDropout:
+		if fault.Duration < 1 {
+			return fmt.Errorf(`a %s lasts at least one reading`, fault.Kind)
+		}
+	case KindSpike:
+		if fault.Duration != 1 {
+			return fmt.Errorf(`a spike is one reading long`)
+		}
+	default:
+		return fmt.Errorf(`unknown fault "%s"`, fault.Kind)
+	}
+	if fault.Kind != KindDropout && fault.Magnitude <= 0 {
+		return fmt.Errorf(`a %s needs a positive magnitude`, fault.Kind)
+	}
+	return nil
+}
+
+// valueAt is the offset from the baseline of the step-th reading of the
+// fault, or false for a reading left out.
+func (fault *Fault) valueAt(step int) (float64, bool) {
+	switch fault.Kind {
+	case KindRamp:
+		return fault.Magnitude * float64(step+1) / float64(fault.Duration), true
+	case KindDropout:
+		return 0, false
+	default:
+		return fault.Magnitude, true
+	}
+}
+
+// Drill feeds a metric of a hardware its latest value, with uniform noise of
+// amplitude Noise, every Interval, laying the faults one after the other with
+// Quiet readings around each. Interval defaults to the average interval of
+// the metric, which confidence in interpolated values is judged against. The
+// readings are ingested like any others and stay in the store, so drills are
+// for a copy of the samples, not a live server.
+type Drill struct {
+	HardwareId string
+	Metric     string
+	Interval   time.Duration
+	Quiet      int
+	Noise      float64
+	Faults     []*Fault
+}
+
+func (drill *Drill) Validate() error {
+	if !hardware.HasSamples(drill.HardwareId) {
+		return fmt.Errorf(`%w "%s"`, hardware.ErrUnknownHardware, drill.HardwareId)
+	}
+	if !hardware.IsMetric(drill.Metric) {
+		return fmt.Errorf(`%w "%s"`, hardware.ErrUnknownMetric, drill.Metric)
+	}
+	if drill.Interval < 0 {
+		return fmt.Errorf(`negative interval %s`, drill.Interval)
+	}
+	if drill.Quiet < 1 {
+		return fmt.Errorf(`faults need at least one quiet reading around them`)
+	}
+	if drill.Noise < 0 {
+		return fmt.Errorf(`negative noise %g`, drill.Noise)
+	}
+	if len(drill.Faults) == 0 {
+		return fmt.Errorf(`no faults to inject`)
+	}
+	for _, fault := range drill.Faults {
+		if err := fault.Validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Detection tells whether the fault injected from From to To was caught.
+type Detection struct {
+	Fault  *Fault    `json:"fault"`
+	From   time.Time `json:"from"`
+	To     time.Time `json:"to"`
+	Caught bool      `json:"caught"`
+	Detail string    `json:"detail"`
+}
+
+// Report is the outcome of a drill. FalseAlarms are the alerts the drill's
+// rules raised outside of every fault.
+type Report struct {
+	Baseline    float64         `json:"baseline"`
+	Interval    time.Duration   `json:"interval"`
+	Start       time.Time       `json:"start"`
+	Detections  []*Detection    `json:"detections"`
+	FalseAlarms []*alerts.Alert `json:"falseAlarms"`
+}
+
+// Passed reports whether every fault was caught without a false alarm.
+func (report *Report) Passed() bool {
+	for _, detection := range report.Detections {
+		if !detection.Caught {
+			return false
+		}
+	}
+	return len(report.FalseAlarms) == 0
+}
+
+// Drill rules are added to the configured ones for the length of a drill
+const (
+	levelRuleId = "fault-drill-level"
+	rateRuleId  = "fault-drill-rate"
+)
+
+// rules returns a rule for the level faults, firing above half the smallest
+// of their magnitudes, and one for ramps, firing above half the slope of the
+// gentlest of them.
+func (drill *Drill) rules(baseline float64, interval time.Duration) []*alerts.Rule {
+	var levelMagnitude, rampSlope float64
+	for _, fault := range drill.Faults {
+		if fault.Kind == KindDropout {
+			continue
+		}
+		if levelMagnitude == 0 || fault.Magnitude < levelMagnitude {
+			levelMagnitude = fault.Magnitude
+		}
+		if slope := fault.Magnitude / float64(fault.Duration) / interval.Hours(); fault.Kind == KindRamp && (rampSlope == 0 || slope < rampSlope) {
+			rampSlope = slope
+		}
+	}
+
+	drillRules := make([]*alerts.Rule, 0, 2)
+	if levelMagnitude > 0 {
+		drillRules = append(drillRules, &alerts.Rule{Id: levelRuleId, HardwareId: drill.HardwareId, Metric: drill.Metric, Comparison: alerts.ComparisonAbove, Threshold: baseline + levelMagnitude/2})
+	}
+	if rampSlope > 0 {
+		drillRules = append(drillRules, &alerts.Rule{Id: rateRuleId, HardwareId: drill.HardwareId, Metric: drill.Metric, Comparison: alerts.ComparisonRateAbove, Threshold: rampSlope / 2})
+	}
+	return drillRules
+}
+
+// Run injects the faults just past the newest sample of the hardware, feeding
+// them to the alert engine as they arrive, and reports which were caught.
+// The configured rules are restored afterwards.
+func (drill *Drill) Run(ctx context.Context, random *rand.Rand) (*Report, error) {
+	if err := drill.Validate(); err != nil {
+		return nil, err
+	}
+	description, err := hardware.Describe(drill.HardwareId)
+	if err != nil {
+		return nil, err
+	}
+	metricDescription, hasMetric := description.Metrics[drill.Metric]
+	if !hasMetric {
+		return nil, fmt.Errorf(`hardware "%s" has no %s to set a baseline`, drill.HardwareId, drill.Metric)
+	}
+	interval := drill.Interval
+	if interval == 0 {
+		if metricDescription.Samples < 2 {
+			return nil, fmt.Errorf(`hardware "%s" has too few samples of %s to tell their interval`, drill.HardwareId, drill.Metric)
+		}
+		interval = metricDescription.Last.Sub(metricDescription.First) / time.Duration(metricDescription.Samples-1)
+	}
+	// Samples are held to the millisecond
+	interval = interval.Truncate(time.Millisecond)
+	if interval <= 0 {
+		return nil, fmt.Errorf(`interval %s is under a millisecond`, drill.Interval)
+	}
+	report := &Report{Baseline: metricDescription.Latest, Interval: interval, Start: description.Last.Add(interval), Detections: make([]*Detection, 0, len(drill.Faults)), FalseAlarms: make([]*alerts.Alert, 0)}
+
+	alerts.Start(ctx, config.Current.Alerting)
+	configuredRules := alerts.Rules()
+	if err := alerts.ReplaceRules(append(append([]*alerts.Rule(nil), configuredRules...), drill.rules(report.Baseline, interval)...)); err != nil {
+		return nil, err
+	}
+	defer alerts.ReplaceRules(configuredRules)
+
+	readingTime := report.Start
+	ingest := func(offset float64) error {
+		value := report.Baseline + offset + drill.Noise*(2*random.Float64()-1)
+		reading := &hardware.Reading{HardwareId: drill.HardwareId, Time: readingTime, Values: map[string]float64{drill.Metric: value}}
+		readingTime = readingTime.Add(interval)
+		return hardware.AddSample(reading)
+	}
+	quiet := func() error {
+		for step := 0; step < drill.Quiet; step++ {
+			if err := ingest(0); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if err := quiet(); err != nil {
+		return nil, err
+	}
+	for _, fault := range drill.Faults {
+		detection := &Detection{Fault: fault, From: readingTime, To: readingTime.Add(time.Duration(fault.Duration-1) * interval)}
+		report.Detections = append(report.Detections, detection)
+		for step := 0; step < fault.Duration; step++ {
+			if offset, hasReading := fault.valueAt(step); !hasReading {
+				readingTime = readingTime.Add(interval)
+			} else if err := ingest(offset); err != nil {
+				return nil, err
+			}
+		}
+		if err := quiet(); err != nil {
+			return nil, err
+		}
+	}
+
+	// The drill rules may be scheduled, by the interval configured for the metric
+	alerts.EvaluatePending()
+	drillAlerts := make([]*alerts.Alert, 0)
+	for _, alert := range alerts.Alerts() {
+		if (alert.RuleId == levelRuleId || alert.RuleId == rateRuleId) && !alert.From.Before(report.Start) {
+			drillAlerts = append(drillAlerts, alert)
+		}
+	}
+	for _, detection := range report.Detections {
+		if err := drill.judge(detection, drillAlerts); err != nil {
+			return nil, err
+		}
+	}
+	for _, alert := range drillAlerts {
+		isDuringFault := false
+		for _, detection := range report.Detections {
+			if !alert.From.Before(detection.From) && !alert.From.After(detection.To) {
+				isDuringFault = true
+			}
+		}
+		if !isDuringFault {
+			report.FalseAlarms = append(report.FalseAlarms, alert)
+		}
+	}
+	return report, nil
+}
+
+// judge tells whether a fault was caught: a level fault by the level rule
+// firing on its first reading, a ramp by the rate rule doing so, and a
+// dropout by a low confidence in the value interpolated in its middle, or by
+// there being none, when the gap is past the interpolation limits.
+func (drill *Drill) judge(detection *Detection, drillAlerts []*alerts.Alert) error {
+	if detection.Fault.Kind == KindDropout {
+		interpolator, err := timeseries.InterpolatorFor("")
+		if err != nil {
+			return err
+		}
+		middle := detection.From.Add(detection.To.Sub(detection.From) / 2)
+		_, confidences, err := hardware.InterpolateSampleWithConfidence(drill.HardwareId, middle, interpolator)
+		if err != nil {
+			return err
+		}
+		confidence, hasConfidence := confidences[drill.Metric]
+		detection.Caught = !hasConfidence || confidence < DropoutConfidence
+		if hasConfidence {
+			detection.Detail = fmt.Sprintf("confidence %.3f", confidence)
+		} else {
+			detection.Detail = "no interpolated value"
+		}
+		return nil
+	}
+
+	ruleId := levelRuleId
+	if detection.Fault.Kind == KindRamp {
+		ruleId = rateRuleId
+	}
+	detection.Detail = fmt.Sprintf("no %s alert", ruleId)
+	for _, alert := range drillAlerts {
+		if alert.RuleId == ruleId && alert.From.Equal(detection.From) {
+			detection.Caught = true
+			detection.Detail = fmt.Sprintf("%s alert, worst %g", ruleId, alert.WorstValue)
+		}
+	}
+	return nil
+}
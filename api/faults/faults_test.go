@@ -0,0 +1,42 @@
+package faults_test
+
+import (
+	"context"
+	"math/rand"
+	"testing"
+
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/alerts"
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/faults"
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/internal/fixtures"
+)
+
+func TestMain(m *testing.M) {
+	fixtures.Main(m.Run)
+}
+
+func TestDrill(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	drill := &faults.Drill{HardwareId: fixtures.HardwareId, Metric: "temperature", Quiet: 3, Noise: 0.1, Faults: []*faults.Fault{
+		{Kind: faults.KindStep, Duration: 5, Magnitude: 10},
+		{Kind: faults.KindRamp, Duration: 5, Magnitude: 10},
+		{Kind: faults.KindSpike, Duration: 1, Magnitude: 10},
+		{Kind: faults.KindDropout, Duration: 3},
+	}}
+	report, err := drill.Run(ctx, rand.New(rand.NewSource(1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, detection := range report.Detections {
+		if !detection.Caught {
+			t.Errorf(`%s from %s missed: %s`, detection.Fault.Kind, detection.From, detection.Detail)
+		}
+	}
+	if len(report.FalseAlarms) > 0 {
+		t.Errorf(`%d false alarms, the first from %s`, len(report.FalseAlarms), report.FalseAlarms[0].From)
+	}
+	if len(alerts.Rules()) != 0 {
+		t.Errorf(`the drill left %d rules behind`, len(alerts.Rules()))
+	}
+}
@@ -0,0 +1,153 @@
+// Package fieldcrypt encrypts configured metadata fields at rest with AES-GCM.
+package fieldcrypt
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/config"
+)
+
+// encryptedPrefix marks a field value as encrypted, so stores written before
+// encryption was configured stay readable.
+const encryptedPrefix = "enc:v1:"
+
+var ErrNoKey = errors.New("no metadata encryption key")
+
+// KeyProvider returns the AES key, 16, 24 or 32 bytes long. By default it is
+// read base64-encoded from KCF_METADATA_KEY; deployments with a key management
+// service replace it with a function fetching the key from there.
+var KeyProvider func() ([]byte, error) = func() ([]byte, error) {
+	encodedKey := os.Getenv("KCF_METADATA_KEY")
+	if encodedKey == "" {
+		return nil, ErrNoKey
+	}
+	key, err := base64.StdEncoding.DecodeString(encodedKey)
+	if err != nil {
+		return nil, fmt.Errorf(`cannot decode KCF_METADATA_KEY: %w`, err)
+	}
+	return key, nil
+}
+
+func newAEAD() (cipher.AEAD, error) {
+	key, err := KeyProvider()
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf(`invalid metadata encryption key: %w`, err)
+	}
+	return cipher.NewGCM(block)
+}
+
+func IsEncrypted(value string) bool {
+	return strings.HasPrefix(value, encryptedPrefix)
+}
+
+// Encrypt seals a value with AES-GCM under a fresh random nonce. The field
+// name is bound as additional data, so a ciphertext cannot be moved into
+// another field unnoticed.
+func Encrypt(field string, plaintext string) (string, error) {
+	aead, err := newAEAD()
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := aead.Seal(nonce, nonce, []byte(plaintext), []byte(field))
+	return encryptedPrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt opens a value sealed by Encrypt and returns any other value as is.
+func Decrypt(field string, value string) (string, error) {
+	if !IsEncrypted(value) {
+		return value, nil
+	}
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(value, encryptedPrefix))
+	if err != nil {
+		return "", fmt.Errorf(`malformed encrypted field "%s": %w`, field, err)
+	}
+	aead, err := newAEAD()
+	if err != nil {
+		return "", err
+	}
+	if len(sealed) < aead.NonceSize() {
+		return "", fmt.Errorf(`malformed encrypted field "%s"`, field)
+	}
+	plaintext, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], []byte(field))
+	if err != nil {
+		return "", fmt.Errorf(`cannot decrypt field "%s": %w`, field, err)
+	}
+	return string(plaintext), nil
+}
+
+// stringFields visits the string fields of the struct value points to, and
+// the values of its string map fields, under their names as configured, i.e.
+// record and JSON name joined by a dot, replacing each with what visit
+// returns. Map values are sealed under their key too, so they cannot be moved
+// to another key unnoticed, and maps are replaced rather than changed, as
+// copies of a record share them.
+func stringFields(record string, value interface{}, visit func(field string, sealedAs string, fieldValue string) (string, error)) error {
+	structValue := reflect.ValueOf(value).Elem()
+	structType := structValue.Type()
+	stringMapType := reflect.TypeOf(map[string]string(nil))
+	for fieldIndex := 0; fieldIndex < structType.NumField(); fieldIndex++ {
+		jsonName, _, _ := strings.Cut(structType.Field(fieldIndex).Tag.Get("json"), ",")
+		if jsonName == "" || jsonName == "-" {
+			continue
+		}
+		field, fieldValue := record+"."+jsonName, structValue.Field(fieldIndex)
+		switch {
+		case fieldValue.Kind() == reflect.String:
+			visited, err := visit(field, field, fieldValue.String())
+			if err != nil {
+				return err
+			}
+			fieldValue.SetString(visited)
+		case fieldValue.Type() == stringMapType && !fieldValue.IsNil():
+			visitedMap := make(map[string]string, fieldValue.Len())
+			for key, mapValue := range fieldValue.Interface().(map[string]string) {
+				visited, err := visit(field, field+"."+key, mapValue)
+				if err != nil {
+					return err
+				}
+				visitedMap[key] = visited
+			}
+			fieldValue.Set(reflect.ValueOf(visitedMap))
+		}
+	}
+	return nil
+}
+
+// EncryptFields encrypts, in place, the string and string map fields of a
+// struct configured as sensitive in config.Current.Encryption.Fields.
+func EncryptFields(record string, value interface{}) error {
+	sensitiveFields := make(map[string]bool)
+	for _, field := range config.Current.Encryption.Fields {
+		sensitiveFields[field] = true
+	}
+	return stringFields(record, value, func(field string, sealedAs string, fieldValue string) (string, error) {
+		if !sensitiveFields[field] || fieldValue == "" || IsEncrypted(fieldValue) {
+			return fieldValue, nil
+		}
+		return Encrypt(sealedAs, fieldValue)
+	})
+}
+
+// DecryptFields decrypts, in place, every encrypted string and string map
+// field of a struct, whether or not it is still configured as sensitive.
+func DecryptFields(record string, value interface{}) error {
+	return stringFields(record, value, func(field string, sealedAs string, fieldValue string) (string, error) {
+		return Decrypt(sealedAs, fieldValue)
+	})
+}
@@ -0,0 +1,120 @@
+package fieldcrypt
+
+import (
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/config"
+)
+
+var testKey = base64.StdEncoding.EncodeToString([]byte("0123456789abcdef0123456789abcdef"))
+
+type record struct {
+	Name     string            `json:"name"`
+	Location string            `json:"location,omitempty"`
+	Metadata map[string]string `json:"metadata,omitempty"`
+	Count    int               `json:"count"`
+}
+
+func TestRoundTrip(t *testing.T) {
+	t.Setenv("KCF_METADATA_KEY", testKey)
+
+	sealed, err := Encrypt("lock.reason", "replacing bearing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !IsEncrypted(sealed) || strings.Contains(sealed, "bearing") {
+		t.Errorf(`expected the value sealed, got "%s"`, sealed)
+	}
+	if resealed, _ := Encrypt("lock.reason", "replacing bearing"); resealed == sealed {
+		t.Errorf(`expected a fresh nonce for every encryption`)
+	}
+	if opened, err := Decrypt("lock.reason", sealed); err != nil || opened != "replacing bearing" {
+		t.Errorf(`expected the value back, got "%s" and %v`, opened, err)
+	}
+	if opened, err := Decrypt("lock.reason", "written before encryption"); err != nil || opened != "written before encryption" {
+		t.Errorf(`expected a plain value as is, got "%s" and %v`, opened, err)
+	}
+}
+
+func TestFieldMismatch(t *testing.T) {
+	t.Setenv("KCF_METADATA_KEY", testKey)
+
+	sealed, err := Encrypt("profile.location", "Hall 3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opened, err := Decrypt("profile.name", sealed); err == nil {
+		t.Errorf(`a location opened as a name gave "%s"`, opened)
+	}
+
+	otherKey := base64.StdEncoding.EncodeToString([]byte("fedcba9876543210fedcba9876543210"))
+	t.Setenv("KCF_METADATA_KEY", otherKey)
+	if opened, err := Decrypt("profile.location", sealed); err == nil {
+		t.Errorf(`another key opened the location as "%s"`, opened)
+	}
+}
+
+func TestKeys(t *testing.T) {
+	t.Setenv("KCF_METADATA_KEY", "")
+	if _, err := Encrypt("lock.reason", "maintenance"); !errors.Is(err, ErrNoKey) {
+		t.Errorf(`expected ErrNoKey without a key, got %v`, err)
+	}
+	for what, encodedKey := range map[string]string{
+		"a key that is not base64": "not base64!",
+		"a five-byte key":          base64.StdEncoding.EncodeToString([]byte("short")),
+		"a 17-byte key":            base64.StdEncoding.EncodeToString([]byte("0123456789abcdef0")),
+	} {
+		t.Setenv("KCF_METADATA_KEY", encodedKey)
+		if _, err := Encrypt("lock.reason", "maintenance"); err == nil || errors.Is(err, ErrNoKey) {
+			t.Errorf(`%s gave %v`, what, err)
+		}
+	}
+
+	t.Setenv("KCF_METADATA_KEY", testKey)
+	for what, value := range map[string]string{
+		"a value that is not base64": encryptedPrefix + "not base64!",
+		"a value shorter than nonce": encryptedPrefix + base64.StdEncoding.EncodeToString([]byte("short")),
+	} {
+		if opened, err := Decrypt("lock.reason", value); err == nil || !strings.Contains(err.Error(), "malformed") {
+			t.Errorf(`%s gave "%s" and %v`, what, opened, err)
+		}
+	}
+}
+
+func TestFields(t *testing.T) {
+	t.Setenv("KCF_METADATA_KEY", testKey)
+	previousEncryption := config.Current.Encryption
+	defer func() { config.Current.Encryption = previousEncryption }()
+	config.Current.Encryption.Fields = []string{"profile.location", "profile.metadata"}
+
+	metadata := map[string]string{"customer": "Acme Mills", "contract": "ACME-7"}
+	value := &record{Name: "Cooling fan", Location: "Hall 3", Metadata: metadata, Count: 2}
+	if err := EncryptFields("profile", value); err != nil {
+		t.Fatal(err)
+	}
+	if value.Name != "Cooling fan" || !IsEncrypted(value.Location) || !IsEncrypted(value.Metadata["customer"]) || !IsEncrypted(value.Metadata["contract"]) {
+		t.Errorf(`expected only the location and metadata encrypted, got %+v`, value)
+	}
+	if metadata["customer"] != "Acme Mills" {
+		t.Errorf(`encrypting changed the map shared with the original: %v`, metadata)
+	}
+
+	// A metadata value moved to another key no longer opens
+	moved := *value
+	moved.Metadata = map[string]string{"customer": value.Metadata["contract"]}
+	if err := DecryptFields("profile", &moved); err == nil {
+		t.Errorf(`a metadata value moved to another key opened as %v`, moved.Metadata)
+	}
+
+	// Fields no longer configured still decrypt
+	config.Current.Encryption.Fields = nil
+	if err := DecryptFields("profile", value); err != nil {
+		t.Fatal(err)
+	}
+	if value.Location != "Hall 3" || value.Metadata["customer"] != "Acme Mills" || value.Metadata["contract"] != "ACME-7" {
+		t.Errorf(`expected the record back decrypted, got %+v`, value)
+	}
+}
@@ -0,0 +1,163 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/hardware"
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/health"
+)
+
+// FleetGroup sums up a group of machines, the whole fleet or those of a tag,
+// by their latest readings.
+type FleetGroup struct {
+	HardwareCount int `json:"hardwareCount"`
+
+	// States count machines by health state, those without data as no_data.
+	States map[string]int `json:"states"`
+
+	// Zones count machines by the ISO 10816 zone of their largest RMS
+	// velocity, when a machine class was given.
+	Zones map[string]int `json:"zones,omitempty"`
+
+	// Metrics aggregate the latest value of each machine, so Count is how
+	// many machines have one.
+	Metrics map[string]*WindowAggregate `json:"metrics"`
+
+	latestValues map[string][]float64
+}
+
+type FleetAggregateResponseData struct {
+	Class string                 `json:"class,omitempty"`
+	Fleet *FleetGroup            `json:"fleet"`
+	Tags  map[string]*FleetGroup `json:"tags"`
+}
+
+func newFleetGroup(withZones bool) *FleetGroup {
+	group := &FleetGroup{States: make(map[string]int), latestValues: make(map[string][]float64)}
+	if withZones {
+		group.Zones = make(map[string]int)
+	}
+	return group
+}
+
+// add counts one machine in the group.
+func (group *FleetGroup) add(state string, zone string, values map[string]float64) {
+	group.HardwareCount++
+	group.States[state]++
+	if group.Zones != nil {
+		group.Zones[zone]++
+	}
+	for metric, value := range values {
+		group.latestValues[metric] = append(group.latestValues[metric], value)
+	}
+}
+
+func (group *FleetGroup) aggregate(metrics []string) {
+	group.Metrics = make(map[string]*WindowAggregate, len(metrics))
+	for _, metric := range metrics {
+		group.Metrics[metric] = aggregateOf(group.latestValues[metric])
+	}
+}
+
+// handleFleetAggregate sums up every hardware by its latest readings, as a
+// whole and per configured tag, for an executive summary: how many machines
+// are in each health state, or ISO 10816 zone given a machine class, and how
+// their latest values of each metric spread.
+func handleFleetAggregate(response http.ResponseWriter, request *http.Request) {
+	if request.Method != "GET" {
+		response.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := request.URL.Query()
+	metrics := hardware.Metrics()
+	if query.Get("metrics") != "" {
+		metrics = strings.Split(query.Get("metrics"), ",")
+		for _, metric := range metrics {
+			if !hardware.IsMetric(metric) {
+				response.WriteHeader(http.StatusBadRequest)
+				response.Write([]byte(fmt.Sprintf(`%v "%s"`, hardware.ErrUnknownMetric, metric)))
+				return
+			}
+		}
+	}
+
+	responseData := &FleetAggregateResponseData{Class: query.Get("class"), Tags: make(map[string]*FleetGroup)}
+	var zoneJudge severityJudge
+	velocityMetrics := make([]string, 0)
+	if responseData.Class != "" {
+		if _, err := health.ISO10816Zone(responseData.Class, 0); err != nil {
+			response.WriteHeader(http.StatusBadRequest)
+			response.Write([]byte(err.Error()))
+			return
+		}
+		for _, metric := range hardware.Metrics() {
+			if strings.HasPrefix(metric, "rmsVelocity") {
+				velocityMetrics = append(velocityMetrics, metric)
+			}
+		}
+		var err error
+		if zoneJudge, err = iso10816Judge(responseData.Class, velocityMetrics); err != nil {
+			response.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+	}
+	responseData.Fleet = newFleetGroup(zoneJudge != nil)
+
+	hardwareIds := hardware.HardwareIds()
+	sort.Strings(hardwareIds)
+	for _, hardwareId := range hardwareIds {
+		latestValues, err := hardware.LatestValues(hardwareId)
+		if err != nil {
+			response.WriteHeader(errorStatus(err, http.StatusInternalServerError))
+			return
+		}
+		values := make(map[string]float64, len(latestValues))
+		for metric, latestValue := range latestValues {
+			values[metric] = latestValue.Value
+		}
+
+		state := hardwareStatusNoData
+		if hardware.HasData(hardwareId) {
+			_, state = health.Score(hardwareId, values)
+		}
+		zone := ""
+		if zoneJudge != nil {
+			velocities := make(map[string]float64, len(velocityMetrics))
+			for _, metric := range velocityMetrics {
+				if value, hasValue := values[metric]; hasValue {
+					velocities[metric] = value
+				}
+			}
+			zone = zoneJudge(velocities)
+		}
+
+		responseData.Fleet.add(state, zone, values)
+		for _, tag := range hardware.TagsOf(hardwareId) {
+			group, hasGroup := responseData.Tags[tag]
+			if !hasGroup {
+				group = newFleetGroup(zoneJudge != nil)
+				responseData.Tags[tag] = group
+			}
+			group.add(state, zone, values)
+		}
+	}
+
+	responseData.Fleet.aggregate(metrics)
+	for _, group := range responseData.Tags {
+		group.aggregate(metrics)
+	}
+
+	responseBytes, err := json.Marshal(responseData)
+	if err != nil {
+		response.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	response.WriteHeader(http.StatusOK)
+	response.Write(responseBytes)
+}
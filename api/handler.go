@@ -1,12 +1,27 @@
+// Package api is the HTTP API over the engine packages; Handle serves every
+// /api route and is what cmd/server mounts.
 package api
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/config"
 	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/hardware"
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/metrics"
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/timeseries"
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/internal/accesslog"
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/internal/audit"
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/internal/auth"
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/internal/querylog"
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/internal/slo"
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/internal/usage"
 )
 
 type TabulatedHardwareRequestData struct {
@@ -14,51 +29,556 @@ type TabulatedHardwareRequestData struct {
 	From  time.Time `json:"from"`
 	To    time.Time `json:"to"`
 	Count int       `json:"count"`
+
+	// Snapshot is the token returned in the X-Snapshot-Token header of a
+	// previous response. When set, only points after that response are sent,
+	// and those the hardware changed around since.
+	Snapshot string `json:"snapshot,omitempty"`
+
+	// IncludeLimits wraps the samples in an envelope alongside the configured
+	// warning/critical limits of each metric.
+	IncludeLimits bool `json:"includeLimits,omitempty"`
+
+	// AlignTo names another hardware whose real sample timestamps replace the
+	// evenly spaced grid, so paired machines compare without interpolating
+	// both sides. Count is ignored, and timestamps outside the range of this
+	// hardware are skipped.
+	AlignTo string `json:"alignTo,omitempty"`
+
+	// Rounded rounds every value to its channel's display precision.
+	Rounded bool `json:"rounded,omitempty"`
+
+	// Envelope wraps the samples in TabulatedHardwareResponseData even
+	// without IncludeLimits, so any count adjustment is visible in the body.
+	Envelope bool `json:"envelope,omitempty"`
+
+	// Banded adds, per point, the minimum and maximum of the raw samples from
+	// that point up to the next one, for charts that shade the spread. It
+	// implies Envelope.
+	Banded bool `json:"banded,omitempty"`
+
+	// Confidence adds, per point, how far to trust each interpolated value,
+	// from 0 to 1, so charts can gray out those bridging long gaps. It implies
+	// Envelope.
+	Confidence bool `json:"confidence,omitempty"`
+
+	// Method names how values are interpolated between samples: "linear"
+	// (the default), "nearest" or "cubic".
+	Method string `json:"method,omitempty"`
+
+	// Density names how the points are placed in the window: "uniform" (the
+	// default) evenly, or "adaptive", more of them where the samples vary and
+	// fewer where they are flat, still within Count. It is ignored with
+	// AlignTo.
+	Density string `json:"density,omitempty"`
+
+	// AsOf answers the request as it would have been answered at that time,
+	// before the readings ingested and the tombstones created since. It
+	// cannot be combined with Snapshot, AlignTo or Banded.
+	AsOf *time.Time `json:"asOf,omitempty"`
+}
+
+// tabulationSource is what a tabulation reads the samples of its hardware
+// from: the working set, or a snapshot of it as of an earlier time.
+type tabulationSource interface {
+	CountRawSamples(from time.Time, to time.Time) (int, error)
+	SamplesBetween(from time.Time, to time.Time) ([]*hardware.Sample, error)
+	InterpolateSampleWith(at time.Time, interpolator timeseries.Interpolator) (*hardware.Sample, error)
+	InterpolateSampleWithConfidence(at time.Time, interpolator timeseries.Interpolator) (*hardware.Sample, map[string]float64, error)
+}
+
+// workingSet is the tabulationSource of a hardware as it is now.
+type workingSet string
+
+func (hardwareId workingSet) CountRawSamples(from time.Time, to time.Time) (int, error) {
+	return hardware.CountRawSamples(string(hardwareId), from, to)
+}
+
+func (hardwareId workingSet) SamplesBetween(from time.Time, to time.Time) ([]*hardware.Sample, error) {
+	return hardware.SamplesBetween(string(hardwareId), from, to)
+}
+
+func (hardwareId workingSet) InterpolateSampleWith(at time.Time, interpolator timeseries.Interpolator) (*hardware.Sample, error) {
+	return hardware.InterpolateSampleWith(string(hardwareId), at, interpolator)
+}
+
+func (hardwareId workingSet) InterpolateSampleWithConfidence(at time.Time, interpolator timeseries.Interpolator) (*hardware.Sample, map[string]float64, error) {
+	return hardware.InterpolateSampleWithConfidence(string(hardwareId), at, interpolator)
+}
+
+// tabulationSourceOf is the snapshot a request asks for with AsOf, or else
+// the working set.
+func tabulationSourceOf(requestData *TabulatedHardwareRequestData) (tabulationSource, error) {
+	if requestData.AsOf == nil {
+		return workingSet(requestData.Id), nil
+	}
+	return hardware.SnapshotAt(requestData.Id, *requestData.AsOf, requestData.From)
+}
+
+type TabulatedHardwareResponseData struct {
+	Samples map[string]*hardware.Sample `json:"samples"`
+	Limits  map[string]config.Limits    `json:"limits,omitempty"`
+
+	// Bands are keyed like Samples, then by metric.
+	Bands map[string]map[string]*hardware.Band `json:"bands,omitempty"`
+
+	// Confidences are keyed like Samples, then by metric.
+	Confidences map[string]map[string]float64 `json:"confidences,omitempty"`
+
+	// RequestedCount and Count differ when the request asked for more points
+	// than there are raw samples in the window, or than the configured cap.
+	RequestedCount int      `json:"requestedCount,omitempty"`
+	Count          int      `json:"count,omitempty"`
+	Warnings       []string `json:"warnings,omitempty"`
+}
+
+func gridStep(from time.Time, to time.Time, count int) (time.Duration, bool) {
+	if count <= 0 {
+		return 0, false
+	}
+	step := time.Duration(to.Sub(from).Abs().Nanoseconds() / int64(count))
+	return step, step > 0
+}
+
+// clampCount keeps a tabulation from fabricating more points than there are
+// raw samples in its window, or than the configured cap, and explains why.
+func clampCount(requestData *TabulatedHardwareRequestData, source tabulationSource) (int, []string, error) {
+	count, warnings := requestData.Count, make([]string, 0)
+
+	rawCount, err := source.CountRawSamples(requestData.From, requestData.To)
+	if err != nil {
+		return 0, nil, err
+	}
+	if rawCount > 0 && count > rawCount {
+		warnings = append(warnings, fmt.Sprintf(`count %d clamped to the %d raw samples in the window`, count, rawCount))
+		count = rawCount
+	}
+
+	if maxCount := config.Current.Tabulation.MaxCount; maxCount > 0 && count > maxCount {
+		warnings = append(warnings, fmt.Sprintf(`count %d clamped to the maximum of %d`, count, maxCount))
+		count = maxCount
+	}
+	return count, warnings, nil
+}
+
+// adaptiveTimestamps places the points of a tabulation by how much the raw
+// samples of each metric vary across the window.
+func adaptiveTimestamps(requestData *TabulatedHardwareRequestData, source tabulationSource) ([]time.Time, error) {
+	rawSamples, err := source.SamplesBetween(requestData.From, requestData.To)
+	if err != nil {
+		return nil, err
+	}
+
+	series := make([]timeseries.Series, 0)
+	for _, metric := range hardware.Metrics() {
+		points := &timeseries.Points{}
+		for _, rawSample := range rawSamples {
+			if value, _ := rawSample.ValueByMetric(metric); value != nil {
+				points.Times = append(points.Times, rawSample.Time.UnixMilli())
+				points.Values = append(points.Values, *value)
+			}
+		}
+		series = append(series, points)
+	}
+
+	timestamps := make([]time.Time, 0, requestData.Count)
+	for _, at := range timeseries.AdaptiveTimes(requestData.From.UnixMilli(), requestData.To.UnixMilli(), requestData.Count, series) {
+		timestamps = append(timestamps, time.UnixMilli(at).In(requestData.From.Location()))
+	}
+	return timestamps, nil
+}
+
+// tabulationTimestamps lists the timestamps a tabulation is interpolated at,
+// either on the even grid, placed adaptively, or at the real samples of the
+// aligned hardware.
+func tabulationTimestamps(requestData *TabulatedHardwareRequestData, source tabulationSource) ([]time.Time, error) {
+	timestamps := make([]time.Time, 0)
+	if requestData.AlignTo != "" {
+		alignedSamples, err := hardware.SamplesBetween(requestData.AlignTo, requestData.From, requestData.To)
+		if err != nil {
+			return nil, err
+		}
+		for _, alignedSample := range alignedSamples {
+			if alignedSample.Time.Before(requestData.To) {
+				timestamps = append(timestamps, alignedSample.Time)
+			}
+		}
+		return timestamps, nil
+	}
+
+	step, validStep := gridStep(requestData.From, requestData.To, requestData.Count)
+	if !validStep {
+		return nil, fmt.Errorf(`invalid count %d`, requestData.Count)
+	}
+	if requestData.Density == timeseries.DensityAdaptive {
+		return adaptiveTimestamps(requestData, source)
+	}
+	for timestamp := requestData.From; timestamp.Before(requestData.To); timestamp = timestamp.Add(step) {
+		timestamps = append(timestamps, timestamp)
+	}
+	return timestamps, nil
+}
+
+// formatSnapshotToken pairs the journal sequence a response was taken at with
+// the last point it held.
+func formatSnapshotToken(sequence int64, lastTimestamp time.Time) string {
+	return fmt.Sprintf("%d-%d", sequence, lastTimestamp.UnixMilli())
+}
+
+func parseSnapshotToken(token string) (int64, time.Time, error) {
+	sequencePart, timestampPart, hasSeparator := strings.Cut(token, "-")
+	if !hasSeparator {
+		return 0, time.Time{}, fmt.Errorf(`malformed snapshot token "%s"`, token)
+	}
+
+	sequence, err := strconv.ParseInt(sequencePart, 10, 64)
+	if err != nil {
+		return 0, time.Time{}, fmt.Errorf(`malformed snapshot token "%s": %w`, token, err)
+	}
+
+	timestamp, err := strconv.ParseInt(timestampPart, 10, 64)
+	if err != nil {
+		return 0, time.Time{}, fmt.Errorf(`malformed snapshot token "%s": %w`, token, err)
+	}
+
+	return sequence, time.UnixMilli(timestamp), nil
 }
 
 func Handle(response http.ResponseWriter, request *http.Request) {
-	switch request.URL.Path {
-	case "/api/tabulated_hardware":
-		if request.Method == "POST" {
-			dataBytes, err := io.ReadAll(request.Body)
+	// Captured before anything may refuse the request, so refusals are logged
+	// too, with what went out on the wire
+	started := time.Now()
+	wireResponse := &usage.MeteredResponseWriter{ResponseWriter: response}
+	loggedResponse := &recoveringResponseWriter{ResponseWriter: wireResponse}
+	defer func() {
+		accesslog.Log(accesslog.EntryOf(request, started, loggedResponse.statusCode, wireResponse.BytesWritten))
+	}()
+
+	response, flushReadOnlyResponse, isAllowed := allowReadOnlyClients(loggedResponse, request)
+	if !isAllowed {
+		return
+	}
+	defer flushReadOnlyResponse()
+
+	identity, err := auth.Authenticate(request)
+	if err != nil {
+		refuseAuthentication(response, err)
+		return
+	}
+	request = request.WithContext(auth.WithIdentity(request.Context(), identity))
+
+	client := usage.ClientOf(request)
+	if usage.ExceedsQuota(client) {
+		response.WriteHeader(http.StatusTooManyRequests)
+		return
+	}
+
+	capturingRequestBody := &querylog.CapturingReadCloser{ReadCloser: request.Body}
+	meteredRequestBody := &usage.MeteredReadCloser{ReadCloser: capturingRequestBody}
+	request.Body = meteredRequestBody
+	meteredResponse := &usage.MeteredResponseWriter{ResponseWriter: response}
+	defer func() {
+		usage.Record(client, meteredRequestBody.BytesRead, meteredResponse.BytesWritten)
+	}()
+
+	recoveringResponse := &recoveringResponseWriter{ResponseWriter: meteredResponse}
+	routeName := "panic"
+	// Deferred ahead of the recovery, so a request that panicked is observed
+	// too, once it has been answered with a 500
+	defer func() {
+		statusCode := recoveringResponse.statusCode
+		if statusCode == 0 {
+			statusCode = http.StatusOK
+		}
+		querylog.Record(querylog.EntryOf(request, capturingRequestBody.Captured.Bytes(), routeName, statusCode, started))
+		// Batches are audited by their items
+		if routeName != "/api/batch" {
+			audit.Record(audit.EntryOf(request, capturingRequestBody.Captured.Bytes(), routeName, statusCode, started))
+		}
+		metrics.NewCounter(`api_requests_total{route="` + routeName + `"}`).Inc()
+		metrics.NewCounter(`api_request_duration_microseconds_total{route="` + routeName + `"}`).Add(time.Since(started).Microseconds())
+		metrics.NewHistogram(`api_request_duration_seconds{route="`+routeName+`"}`, metrics.LatencyBuckets).Observe(time.Since(started).Seconds())
+		slo.Observe(routeName, statusCode, time.Since(started), started)
+	}()
+	defer recoverPanic(recoveringResponse, request, client)
+
+	routeName = route(recoveringResponse, request)
+}
+
+func handleTabulatedHardware(response http.ResponseWriter, request *http.Request) {
+	if request.Method == "POST" {
+		dataBytes, err := io.ReadAll(request.Body)
+		if err != nil {
+			response.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		var requestData TabulatedHardwareRequestData
+		if err := json.Unmarshal(dataBytes, &requestData); err != nil {
+			response.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		if !hardware.HasSamples(requestData.Id) {
+			response.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		interpolator, err := timeseries.InterpolatorFor(requestData.Method)
+		if err != nil {
+			response.WriteHeader(errorStatus(err, http.StatusBadRequest))
+			response.Write([]byte(err.Error()))
+			return
+		}
+		if err := timeseries.CheckDensity(requestData.Density); err != nil {
+			response.WriteHeader(errorStatus(err, http.StatusBadRequest))
+			response.Write([]byte(err.Error()))
+			return
+		}
+
+		if requestData.AsOf != nil && (requestData.Snapshot != "" || requestData.AlignTo != "" || requestData.Banded) {
+			response.WriteHeader(http.StatusBadRequest)
+			response.Write([]byte(`asOf cannot be combined with snapshot, alignTo or banded`))
+			return
+		}
+		source, err := tabulationSourceOf(&requestData)
+		if err != nil {
+			response.WriteHeader(errorStatus(err, http.StatusInternalServerError))
+			response.Write([]byte(err.Error()))
+			return
+		}
+
+		requestedCount, warnings := requestData.Count, []string(nil)
+		if requestData.AlignTo == "" {
+			clampedCount, clampWarnings, err := clampCount(&requestData, source)
 			if err != nil {
-				response.WriteHeader(http.StatusInternalServerError)
+				response.WriteHeader(errorStatus(err, http.StatusInternalServerError))
 				return
 			}
+			requestData.Count, warnings = clampedCount, clampWarnings
+		}
 
-			var requestData TabulatedHardwareRequestData
-			if err := json.Unmarshal(dataBytes, &requestData); err != nil {
-				response.WriteHeader(http.StatusInternalServerError)
+		timestamps, err := tabulationTimestamps(&requestData, source)
+		if err != nil {
+			response.WriteHeader(errorStatus(err, http.StatusBadRequest))
+			return
+		}
+
+		revision := hardware.Revision()
+		// Points a snapshot holds are sent again only where this hardware
+		// changed since, alongside those past its last
+		sequence := hardware.JournalSequence()
+		var lastTimestamp time.Time
+		var changedSpans [][2]time.Time
+		if requestData.Snapshot != "" {
+			snapshotSequence, snapshotTimestamp, err := parseSnapshotToken(requestData.Snapshot)
+			if err != nil {
+				response.WriteHeader(http.StatusBadRequest)
 				return
 			}
+			spans, latestSequence, isComplete := hardware.ChangesSince(requestData.Id, snapshotSequence, interpolator.Neighbors())
+			if isComplete {
+				lastTimestamp, changedSpans = snapshotTimestamp, spans
+			}
+			sequence = latestSequence
+		}
+		isChanged := func(timestamp time.Time) bool {
+			for _, span := range changedSpans {
+				if !timestamp.Before(span[0]) && !timestamp.After(span[1]) {
+					return true
+				}
+			}
+			return false
+		}
 
-			if !hardware.HasSamples(requestData.Id) {
-				response.WriteHeader(http.StatusInternalServerError)
+		tabulatedHardware := make(map[string]*hardware.Sample)
+		tabulatedConfidences := make(map[string]map[string]float64)
+		bandTimestamps := make([]time.Time, 0)
+		for _, timestamp := range timestamps {
+			// Compared to the millisecond, as tokens hold them
+			if timestamp.UnixMilli() <= lastTimestamp.UnixMilli() && !isChanged(timestamp) {
+				continue
+			}
+
+			var sample *hardware.Sample
+			var confidences map[string]float64
+			if requestData.Confidence {
+				sample, confidences, err = source.InterpolateSampleWithConfidence(timestamp, interpolator)
+			} else {
+				sample, err = source.InterpolateSampleWith(timestamp, interpolator)
+			}
+			if requestData.AlignTo != "" && errors.Is(err, hardware.ErrOutOfRange) {
+				continue
+			}
+			if err != nil {
+				response.WriteHeader(errorStatus(err, http.StatusInternalServerError))
 				return
 			}
+			if requestData.Rounded {
+				sample = sample.Rounded()
+			}
+			tabulatedHardware[timestamp.Format("January _2, 2006 _3:04:05.999PM")] = sample
+			if confidences != nil {
+				tabulatedConfidences[timestamp.Format("January _2, 2006 _3:04:05.999PM")] = confidences
+			}
+			bandTimestamps = append(bandTimestamps, timestamp)
+			if timestamp.After(lastTimestamp) {
+				lastTimestamp = timestamp
+			}
+		}
 
-			tabulatedHardware := make(map[string]*hardware.Sample)
-			for timestamp := requestData.From; timestamp.Before(requestData.To); timestamp.Add(time.Duration(requestData.To.Sub(requestData.From).Abs().Nanoseconds() / int64(requestData.Count))) {
-				sample, err := hardware.InterpolateSample(requestData.Id, timestamp)
+		var responseData interface{} = tabulatedHardware
+		if requestData.IncludeLimits || requestData.Envelope || requestData.Banded || requestData.Confidence {
+			envelope := TabulatedHardwareResponseData{Samples: tabulatedHardware, Warnings: warnings}
+			if requestData.Confidence {
+				envelope.Confidences = tabulatedConfidences
+			}
+			if requestData.Banded {
+				bands, err := hardware.BandsAt(requestData.Id, bandTimestamps, requestData.To)
 				if err != nil {
-					response.WriteHeader(http.StatusInternalServerError)
+					response.WriteHeader(errorStatus(err, http.StatusInternalServerError))
 					return
 				}
-				tabulatedHardware[timestamp.Format("January _2, 2006 _3:04:05.999PM")] = sample
+				envelope.Bands = make(map[string]map[string]*hardware.Band, len(bands))
+				for bandIndex, band := range bands {
+					envelope.Bands[bandTimestamps[bandIndex].Format("January _2, 2006 _3:04:05.999PM")] = band
+				}
 			}
-
-			tabulatedHardwareBytes, err := json.Marshal(tabulatedHardware)
-			if err != nil {
-				response.WriteHeader(http.StatusInternalServerError)
-				return
+			if requestData.AlignTo == "" {
+				envelope.RequestedCount, envelope.Count = requestedCount, requestData.Count
+			}
+			if requestData.IncludeLimits {
+				envelope.Limits = make(map[string]config.Limits)
+				for _, metric := range hardware.Metrics() {
+					if metricLimits, hasLimits := hardware.LimitsFor(requestData.Id, metric); hasLimits {
+						envelope.Limits[metric] = metricLimits
+					}
+				}
 			}
+			// Consistency is checked on the samples as they are now
+			if requestData.AsOf == nil {
+				checks, _, err := hardware.CheckConsistency(requestData.Id, requestData.From, requestData.To)
+				if err != nil {
+					response.WriteHeader(errorStatus(err, http.StatusInternalServerError))
+					return
+				}
+				for _, check := range checks {
+					if check.Inconsistent > 0 {
+						envelope.Warnings = append(envelope.Warnings, fmt.Sprintf(`%d of %d %s readings in the window exceed %s`, check.Inconsistent, check.Checked, check.Metric, check.AtMost))
+					}
+				}
+			}
+			responseData = envelope
+		}
+		if requestData.Count != requestedCount {
+			response.Header().Set("X-Count-Adjusted", fmt.Sprintf("%d -> %d", requestedCount, requestData.Count))
+		}
 
-			response.WriteHeader(http.StatusOK)
-			response.Write(tabulatedHardwareBytes)
+		tabulatedHardwareBytes, err := json.Marshal(responseData)
+		if err != nil {
+			response.WriteHeader(http.StatusInternalServerError)
 			return
 		}
+
+		if requestData.AsOf != nil {
+			response.Header().Set("X-As-Of", requestData.AsOf.UTC().Format(time.RFC3339Nano))
+		} else {
+			response.Header().Set("X-Snapshot-Token", formatSnapshotToken(sequence, lastTimestamp))
+		}
+		if setCacheHeaders(response, request, dataBytes, revision, requestData.To) {
+			response.WriteHeader(http.StatusNotModified)
+			return
+		}
+		response.WriteHeader(http.StatusOK)
+		response.Write(tabulatedHardwareBytes)
+		return
+	}
+}
+
+func route(response http.ResponseWriter, request *http.Request) string {
+	if !authorize(response, request) {
+		return "unauthorized"
+	}
+
+	switch request.URL.Path {
+	case "/api/tabulated_hardware":
+		handleTabulatedHardware(response, request)
+	case "/api/ingest":
+		handleIngest(response, request)
+	case "/api/joined_hardware":
+		handleJoinedHardware(response, request)
+	case "/api/cumulative_hardware":
+		handleCumulativeHardware(response, request)
+	case "/api/overview":
+		handleOverview(response, request)
+	case "/api/sample_count":
+		handleSampleCount(response, request)
+	case "/api/dictionary":
+		handleDictionary(response, request)
+	case "/api/diagnostics":
+		handleDiagnostics(response, request)
+	case "/api/similar":
+		handleSimilarity(response, request)
+	case "/api/chart":
+		handleChart(response, request)
+	case "/api/admin/tombstones":
+		handleTombstones(response, request)
+	case "/api/admin/metrics":
+		handleMetricsSummary(response, request)
+	case "/api/admin/pullers":
+		handlePullers(response, request)
+	case "/api/admin/indexes":
+		handleIndexStatistics(response, request)
+	case "/api/admin/queries":
+		handleQueryLog(response, request)
+	case "/api/admin/locks":
+		handleLocks(response, request)
+	case "/api/admin/onboard":
+		handleOnboarding(response, request)
+	case "/api/admin/compact":
+		handleCompaction(response, request)
+	case "/api/admin/drain":
+		handleDrainStatus(response, request)
+	case "/api/admin/slo":
+		handleSLOStatus(response, request)
+	case "/api/admin/read_only_tokens":
+		handleReadOnlyTokens(response, request)
+	case "/api/admin/audit":
+		handleAuditReport(response, request)
+	case "/api/ready":
+		handleReadiness(response, request)
+	case "/api/usage":
+		handleUsage(response, request)
+	case "/api/alerts":
+		handleAlerts(response, request)
+	case "/api/alerts/rules.yaml":
+		handleAlertRulesYAML(response, request)
+	case "/api/alerts/preview":
+		handleAlertRulePreview(response, request)
+	case "/api/alerts/schedule":
+		handleAlertSchedule(response, request)
+	case "/api/hardware":
+		handleHardwareList(response, request)
+	case "/api/preferences":
+		handlePreferences(response, request)
+	case "/api/batch":
+		handleBatch(response, request)
+	case "/api/fleet/aggregate":
+		handleFleetAggregate(response, request)
+	case "/api/fleet/arrival_lag":
+		handleFleetArrivalLag(response, request)
 	default:
+		if strings.HasPrefix(request.URL.Path, "/api/hardware/") {
+			if routeName, routed := routeHardwareResource(response, request); routed {
+				return routeName
+			}
+		}
+		if name := strings.TrimPrefix(request.URL.Path, "/api/preferences/"); name != request.URL.Path && name != "" {
+			handlePreference(response, request, name)
+			return "/api/preferences/{name}"
+		}
 		response.Write([]byte("Welcome!"))
+		return "other"
 	}
-
+	return request.URL.Path
 }
@@ -0,0 +1,201 @@
+package api_test
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api"
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/config"
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/metrics"
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/internal/accesslog"
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/internal/querylog"
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/internal/usage"
+)
+
+func TestRefusalsAreAccessLogged(t *testing.T) {
+	previousAccessLog, previousAuthentication, previousQuota := config.Current.AccessLog, config.Current.Authentication, usage.DailyRequestQuota
+	defer func() {
+		config.Current.AccessLog, config.Current.Authentication, usage.DailyRequestQuota = previousAccessLog, previousAuthentication, previousQuota
+		accesslog.Close()
+	}()
+	logPath := filepath.Join(t.TempDir(), "access.log")
+	config.Current.AccessLog = config.AccessLog{Path: logPath, Format: accesslog.FormatCommon}
+	config.Current.Authentication.APIKeys = map[string][]string{"test": {"admin"}}
+	usage.DailyRequestQuota = 1
+
+	for _, refusal := range []struct {
+		apiKey string
+		status int
+	}{
+		{"unknown", http.StatusUnauthorized},
+		{"test", http.StatusOK},
+		{"test", http.StatusTooManyRequests},
+	} {
+		request := httptest.NewRequest("GET", "/api/dictionary", nil)
+		request.Header.Set("X-API-Key", refusal.apiKey)
+		response := httptest.NewRecorder()
+		api.Handle(response, request)
+		if response.Code != refusal.status {
+			t.Fatalf(`expected %d with key "%s", got %d`, refusal.status, refusal.apiKey, response.Code)
+		}
+	}
+
+	logBytes, err := os.ReadFile(logPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(logBytes)), "\n")
+	if len(lines) != 3 {
+		t.Fatalf(`expected 3 access log lines, got %q`, lines)
+	}
+	for lineIndex, status := range []string{" 401 ", " 200 ", " 429 "} {
+		if !strings.Contains(lines[lineIndex], status) {
+			t.Errorf(`expected line %d to log%s, got %q`, lineIndex+1, status, lines[lineIndex])
+		}
+	}
+}
+
+func TestCachedResponsesRevalidate(t *testing.T) {
+	if err := loadContractFixtures(); err != nil {
+		t.Fatal(err)
+	}
+
+	count := func(ifNoneMatch string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest("GET", "/api/sample_count?id=contract_pump&"+window, nil)
+		if ifNoneMatch != "" {
+			request.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		response := httptest.NewRecorder()
+		api.Handle(response, request)
+		return response
+	}
+
+	first := count("")
+	eTag := first.Header().Get("ETag")
+	if first.Code != http.StatusOK || eTag == "" {
+		t.Fatalf(`expected 200 with an ETag, got %d and "%s"`, first.Code, eTag)
+	}
+	if cacheControl := first.Header().Get("Cache-Control"); !strings.HasPrefix(cacheControl, "private") {
+		t.Errorf(`expected a private Cache-Control, got "%s"`, cacheControl)
+	}
+	if revalidated := count(eTag); revalidated.Code != http.StatusNotModified {
+		t.Fatalf(`expected 304 revalidating an unchanged window, got %d`, revalidated.Code)
+	}
+
+	// A backfilled reading changes a window long past
+	ingest := httptest.NewRequest("POST", "/api/ingest?hardwareId=contract_pump&persist=false", strings.NewReader("timestamp,temperature\n1656634830000,40\n"))
+	ingest.Header.Set("Content-Type", "text/csv")
+	ingested := httptest.NewRecorder()
+	api.Handle(ingested, ingest)
+	if ingested.Code != http.StatusOK {
+		t.Fatalf(`ingest answered %d: %s`, ingested.Code, ingested.Body)
+	}
+	if revalidated := count(eTag); revalidated.Code != http.StatusOK || revalidated.Header().Get("ETag") == eTag {
+		t.Errorf(`expected 200 with a new ETag after a backfill, got %d and "%s"`, revalidated.Code, revalidated.Header().Get("ETag"))
+	}
+}
+
+func TestSnapshotTokensFollowTheirHardware(t *testing.T) {
+	if err := loadContractFixtures(); err != nil {
+		t.Fatal(err)
+	}
+
+	// tabulate returns the points of contract_fan sent after a snapshot, and
+	// the token for the next
+	tabulate := func(snapshot string) (map[string]map[string]*float64, string) {
+		body := tabulation(7, `,"snapshot":"`+snapshot+`"`)
+		response := httptest.NewRecorder()
+		api.Handle(response, httptest.NewRequest("POST", "/api/tabulated_hardware", strings.NewReader(body)))
+		if response.Code != http.StatusOK {
+			t.Fatalf(`tabulation answered %d: %s`, response.Code, response.Body)
+		}
+		var points map[string]map[string]*float64
+		if err := json.Unmarshal(response.Body.Bytes(), &points); err != nil {
+			t.Fatal(err)
+		}
+		return points, response.Header().Get("X-Snapshot-Token")
+	}
+	ingest := func(hardwareId string, csv string) {
+		request := httptest.NewRequest("POST", "/api/ingest?hardwareId="+hardwareId+"&persist=false", strings.NewReader("timestamp,temperature\n"+csv))
+		request.Header.Set("Content-Type", "text/csv")
+		response := httptest.NewRecorder()
+		api.Handle(response, request)
+		if response.Code != http.StatusOK {
+			t.Fatalf(`ingest answered %d: %s`, response.Code, response.Body)
+		}
+	}
+
+	points, token := tabulate("")
+	if len(points) != 8 {
+		t.Fatalf(`expected 8 points, got %d`, len(points))
+	}
+
+	// Readings of another hardware leave the snapshot as it was
+	ingest("contract_pump", "1656634500000,99\n")
+	if points, token = tabulate(token); len(points) != 0 {
+		t.Errorf(`expected no points sent again after another hardware changed, got %d`, len(points))
+	}
+
+	// A backfilled temperature at minute 22 is sent again with the point
+	// between minutes 22 and 23 alone
+	ingest("contract_fan", "1656634920000,100\n")
+	points, _ = tabulate(token)
+	changedPoint, isSent := points["July  1, 2022 _12:22:51.428AM"]
+	if len(points) != 1 || !isSent {
+		t.Fatalf(`expected the point after minute 22 alone sent again, got %v`, points)
+	}
+	if temperature := changedPoint["temperature"]; temperature == nil || *temperature < 50 {
+		t.Errorf(`expected the backfilled temperature in the point sent again, got %v`, temperature)
+	}
+}
+
+// panickingBody panics as a handler reads it, standing in for a handler bug.
+type panickingBody struct{}
+
+func (panickingBody) Read([]byte) (int, error) {
+	panic("handler bug")
+}
+
+func TestRequestsAreObserved(t *testing.T) {
+	previousQueryLog := config.Current.QueryLog
+	defer func() {
+		config.Current.QueryLog = previousQueryLog
+		querylog.Close()
+	}()
+	logPath := filepath.Join(t.TempDir(), "queries.log")
+	config.Current.QueryLog = config.QueryLog{Path: logPath}
+
+	counters := metrics.Counters()
+	api.Handle(httptest.NewRecorder(), httptest.NewRequest("GET", "/api/dictionary", nil))
+	panicked := httptest.NewRecorder()
+	api.Handle(panicked, httptest.NewRequest("POST", "/api/ingest", io.NopCloser(panickingBody{})))
+	if panicked.Code != http.StatusInternalServerError {
+		t.Fatalf(`expected 500 for a panic, got %d`, panicked.Code)
+	}
+	if observed := metrics.Counters()[`api_requests_total{route="panic"}`] - counters[`api_requests_total{route="panic"}`]; observed != 1 {
+		t.Errorf(`expected the panic counted once, got %d`, observed)
+	}
+
+	querylog.Close()
+	logBytes, err := os.ReadFile(logPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var entries []querylog.Entry
+	for _, line := range strings.Split(strings.TrimSpace(string(logBytes)), "\n") {
+		var entry querylog.Entry
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatal(err)
+		}
+		entries = append(entries, entry)
+	}
+	if len(entries) != 2 || entries[0].Route != "/api/dictionary" || entries[0].Status != http.StatusOK || entries[1].Route != "panic" || entries[1].Status != http.StatusInternalServerError {
+		t.Errorf(`expected the dictionary logged as 200 and the panic as 500, got %+v`, entries)
+	}
+}
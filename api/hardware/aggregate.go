@@ -0,0 +1,205 @@
+package hardware
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/statistics"
+)
+
+// MetricAggregate summarizes the raw values of one metric within a bucket.
+type MetricAggregate struct {
+	Count          int     `json:"count"`
+	Minimum        float64 `json:"minimum"`
+	Maximum        float64 `json:"maximum"`
+	Mean           float64 `json:"mean"`
+	RootMeanSquare float64 `json:"rms"`
+}
+
+// Bucket holds the aggregates of the metrics with at least one value from
+// Start up to, but excluding, End.
+type Bucket struct {
+	Start   time.Time                   `json:"start"`
+	End     time.Time                   `json:"end"`
+	Metrics map[string]*MetricAggregate `json:"metrics"`
+}
+
+type metricAccumulator struct {
+	count        int
+	minimum      float64
+	maximum      float64
+	sum          float64
+	sumOfSquares float64
+}
+
+func (accumulator *metricAccumulator) add(value float64) {
+	if accumulator.count == 0 {
+		accumulator.minimum, accumulator.maximum = value, value
+	}
+	accumulator.count++
+	accumulator.minimum = math.Min(accumulator.minimum, value)
+	accumulator.maximum = math.Max(accumulator.maximum, value)
+	accumulator.sum += value
+	accumulator.sumOfSquares += value * value
+}
+
+func (accumulator *metricAccumulator) aggregate() *MetricAggregate {
+	count := float64(accumulator.count)
+	return &MetricAggregate{
+		Count:          accumulator.count,
+		Minimum:        accumulator.minimum,
+		Maximum:        accumulator.maximum,
+		Mean:           accumulator.sum / count,
+		RootMeanSquare: math.Sqrt(accumulator.sumOfSquares / count),
+	}
+}
+
+// accumulate adds the finite values of a sample to the accumulators of their
+// metrics.
+func accumulate(accumulators map[string]*metricAccumulator, metrics []string, sample *Sample) {
+	for _, metric := range metrics {
+		value, _ := sample.ValueByMetric(metric)
+		if value == nil || !statistics.IsFinite(*value) {
+			continue
+		}
+		accumulator, hasAccumulator := accumulators[metric]
+		if !hasAccumulator {
+			accumulator = &metricAccumulator{}
+			accumulators[metric] = accumulator
+		}
+		accumulator.add(*value)
+	}
+}
+
+// AggregateRange buckets the raw samples between from and to into buckets of
+// width, aligned to location's wall clock like statistics.BucketStart, and
+// summarizes every metric per bucket. Buckets without samples are included
+// with no metrics, so gaps stay visible. At most maxBuckets are produced,
+// unless it is zero.
+func AggregateRange(hardwareId string, from time.Time, to time.Time, width time.Duration, location *time.Location, maxBuckets int) ([]*Bucket, error) {
+	if err := statistics.ValidateBucketWidth(width); err != nil {
+		return nil, err
+	}
+	if !to.After(from) {
+		return nil, fmt.Errorf(`range from %s to %s is empty`, from, to)
+	}
+
+	buckets := make([]*Bucket, 0)
+	for start := statistics.BucketStart(from, width, location); start.Before(to); {
+		if maxBuckets > 0 && len(buckets) == maxBuckets {
+			return nil, fmt.Errorf(`more than %d buckets of %s between %s and %s`, maxBuckets, width, from, to)
+		}
+		end := statistics.NextBucketStart(start, width, location)
+		buckets = append(buckets, &Bucket{Start: start, End: end, Metrics: make(map[string]*MetricAggregate)})
+		start = end
+	}
+
+	if !isRollupWidth(width) {
+		if err := aggregateRaw(hardwareId, buckets, from, to); err != nil {
+			return nil, err
+		}
+		return buckets, nil
+	}
+
+	// Whole buckets come from rollups; only those the range cuts into, at
+	// either end, are summed from raw samples
+	for _, bucket := range buckets {
+		var err error
+		if bucket.Start.Before(from) || bucket.End.After(to) {
+			err = aggregateRaw(hardwareId, []*Bucket{bucket}, from, to)
+		} else {
+			err = rolledUpBucket(hardwareId, bucket, width, location)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return buckets, nil
+}
+
+// aggregateRaw fills consecutive buckets from the raw samples between from
+// and to, excluding to.
+func aggregateRaw(hardwareId string, buckets []*Bucket, from time.Time, to time.Time) error {
+	if buckets[0].Start.After(from) {
+		from = buckets[0].Start
+	}
+	if end := buckets[len(buckets)-1].End; end.Before(to) {
+		to = end
+	}
+	samples, err := SamplesBetween(hardwareId, from, to)
+	if err != nil {
+		return err
+	}
+
+	metrics := Metrics()
+	accumulators := make(map[string]*metricAccumulator)
+	bucketIndex := 0
+	flush := func() {
+		for metric, accumulator := range accumulators {
+			buckets[bucketIndex].Metrics[metric] = accumulator.aggregate()
+		}
+		accumulators = make(map[string]*metricAccumulator)
+	}
+
+	// Samples come sorted, so buckets are filled one after the other
+	for _, sample := range samples {
+		if !sample.Time.Before(to) {
+			break
+		}
+		for !sample.Time.Before(buckets[bucketIndex].End) {
+			flush()
+			bucketIndex++
+		}
+
+		accumulate(accumulators, metrics, sample)
+	}
+	flush()
+	return nil
+}
+
+// Band is the spread of the raw values of one metric around a tabulated
+// point.
+type Band struct {
+	Count   int     `json:"count"`
+	Minimum float64 `json:"minimum"`
+	Maximum float64 `json:"maximum"`
+}
+
+// BandsAt returns, for each of the ascending points, the band of every metric
+// over the raw samples from that point up to the next one, or up to end for
+// the last point. Metrics without raw values near a point have no band.
+func BandsAt(hardwareId string, points []time.Time, end time.Time) ([]map[string]*Band, error) {
+	bands := make([]map[string]*Band, len(points))
+	if len(points) == 0 {
+		return bands, nil
+	}
+
+	samples, err := SamplesBetween(hardwareId, points[0], end)
+	if err != nil {
+		return nil, err
+	}
+
+	metrics := Metrics()
+	sampleIndex := 0
+	for pointIndex, point := range points {
+		pointEnd := end
+		if pointIndex+1 < len(points) {
+			pointEnd = points[pointIndex+1]
+		}
+
+		accumulators := make(map[string]*metricAccumulator)
+		for ; sampleIndex < len(samples) && samples[sampleIndex].Time.Before(pointEnd); sampleIndex++ {
+			if samples[sampleIndex].Time.Before(point) {
+				continue
+			}
+			accumulate(accumulators, metrics, samples[sampleIndex])
+		}
+
+		bands[pointIndex] = make(map[string]*Band, len(accumulators))
+		for metric, accumulator := range accumulators {
+			bands[pointIndex][metric] = &Band{Count: accumulator.count, Minimum: accumulator.minimum, Maximum: accumulator.maximum}
+		}
+	}
+	return bands, nil
+}
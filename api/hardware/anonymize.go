@@ -0,0 +1,92 @@
+package hardware
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/csv"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+func anonymizationDigest(key string, purpose string, subject string) []byte {
+	mac := hmac.New(sha256.New, []byte(key))
+	mac.Write([]byte(purpose + "\x00" + subject))
+	return mac.Sum(nil)
+}
+
+func AnonymizedHardwareId(key string, hardwareId string) string {
+	return "machine_" + hex.EncodeToString(anonymizationDigest(key, "hardware", hardwareId)[:4])
+}
+
+// AnonymizedTimeShift moves every timestamp by the same whole number of weeks
+// (up to three years back), preserving time of day and weekly patterns.
+func AnonymizedTimeShift(key string) time.Duration {
+	weeks := binary.BigEndian.Uint32(anonymizationDigest(key, "time", "")) % 156
+	return -time.Duration(weeks) * 7 * 24 * time.Hour
+}
+
+// AnonymizedScale is a per-file factor between 0.8 and 1.2, shared by every
+// hardware so that machines remain comparable with each other.
+func AnonymizedScale(key string, sampleDataName string) float64 {
+	fraction := float64(binary.BigEndian.Uint32(anonymizationDigest(key, "scale", sampleDataName))) / float64(^uint32(0))
+	return 0.8 + 0.4*fraction
+}
+
+// AnonymizeSamples writes a copy of the sample tree into destinationPath with
+// hardware IDs renamed, timestamps shifted and values scaled, all derived
+// deterministically from key.
+func AnonymizeSamples(destinationPath string, key string) error {
+	if key == "" {
+		return fmt.Errorf(`anonymization key must not be empty`)
+	}
+
+	timeShift := AnonymizedTimeShift(key).Milliseconds()
+	return filepath.WalkDir(samplesPath, func(sampleFilePath string, directoryEntry fs.DirEntry, pathErr error) error {
+		if pathErr != nil {
+			return pathErr
+		}
+		if directoryEntry.IsDir() {
+			return nil
+		}
+
+		samplePath, sampleDataName := filepath.Split(sampleFilePath)
+		hardwareId := filepath.Base(samplePath)
+
+		sampleTimestamps, sampleDataValues, readErr := readSampleDataFile(sampleFilePath)
+		if readErr != nil {
+			return readErr
+		}
+
+		anonymizedPath := filepath.Join(destinationPath, AnonymizedHardwareId(key, hardwareId))
+		if err := os.MkdirAll(anonymizedPath, 0755); err != nil {
+			return fmt.Errorf(`unable to create directory "%s": %w`, anonymizedPath, err)
+		}
+
+		anonymizedFilePath := filepath.Join(anonymizedPath, sampleDataName)
+		anonymizedFile, err := os.Create(anonymizedFilePath)
+		if err != nil {
+			return fmt.Errorf(`unable to create file "%s": %w`, anonymizedFilePath, err)
+		}
+		defer anonymizedFile.Close()
+
+		scale := AnonymizedScale(key, sampleDataName)
+		anonymizedWriter := csv.NewWriter(anonymizedFile)
+		for sampleIndex, sampleTimestamp := range sampleTimestamps {
+			anonymizedWriter.Write([]string{
+				strconv.FormatInt(sampleTimestamp+timeShift, 10),
+				strconv.FormatFloat(sampleDataValues[sampleIndex]*scale, 'g', -1, 64),
+			})
+		}
+		anonymizedWriter.Flush()
+		if err := anonymizedWriter.Error(); err != nil {
+			return fmt.Errorf(`unable to write file "%s": %w`, anonymizedFilePath, err)
+		}
+		return anonymizedFile.Close()
+	})
+}
@@ -0,0 +1,151 @@
+package hardware
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/config"
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/metrics"
+)
+
+// ArrivalLagBounds are the upper bounds, in seconds, of the buckets the lag
+// of live readings behind their sensor timestamps is counted in. A last
+// bucket counts what lags further.
+var ArrivalLagBounds = []float64{1, 5, 15, 60, 300, 900, 3600, 21600, 86400}
+
+// ArrivalLagWindow counts the readings that arrived from Start on, over one
+// configured window, per lag bucket.
+type ArrivalLagWindow struct {
+	Start      time.Time `json:"start"`
+	Counts     []int64   `json:"counts"`
+	MaxSeconds float64   `json:"maxSeconds"`
+}
+
+// ArrivalLag is the distribution of the lag of a hardware's live readings
+// over the windows kept, oldest first: a heatmap of arrival time against
+// lag. Percentiles are the upper bound of the bucket they fall in, or the
+// largest lag seen when that is the last bucket.
+type ArrivalLag struct {
+	HardwareId    string              `json:"hardwareId"`
+	BoundsSeconds []float64           `json:"boundsSeconds"`
+	Windows       []*ArrivalLagWindow `json:"windows,omitempty"`
+	Counts        []int64             `json:"counts"`
+	Count         int64               `json:"count"`
+	MedianSeconds float64             `json:"medianSeconds"`
+	P90Seconds    float64             `json:"p90Seconds"`
+	P99Seconds    float64             `json:"p99Seconds"`
+	MaxSeconds    float64             `json:"maxSeconds"`
+}
+
+var (
+	arrivalLagHistogram = metrics.NewHistogram("hardware_arrival_lag_seconds", ArrivalLagBounds)
+
+	arrivalLagMutex sync.Mutex
+	// arrivalLags are keyed by hardware, holding its windows oldest first
+	arrivalLags map[string][]*ArrivalLagWindow = make(map[string][]*ArrivalLagWindow)
+)
+
+// recordArrivalLag counts a reading of a hardware arriving at arrivalTime,
+// lag after its sensor timestamp. Readings stamped ahead of their arrival
+// count as arriving without lag; clock skew covers them.
+func recordArrivalLag(hardwareId string, lag time.Duration, arrivalTime time.Time) {
+	lagSeconds := lag.Seconds()
+	if lagSeconds < 0 {
+		lagSeconds = 0
+	}
+	arrivalLagHistogram.Observe(lagSeconds)
+
+	windowStart := arrivalTime.Truncate(config.Current.Ingestion.ArrivalLag.Window.Duration)
+
+	arrivalLagMutex.Lock()
+	defer arrivalLagMutex.Unlock()
+
+	windows := arrivalLags[hardwareId]
+	var window *ArrivalLagWindow
+	if windowCount := len(windows); windowCount > 0 && !windows[windowCount-1].Start.Before(windowStart) {
+		// Arrivals are stamped by the server, so only ever fall in the last window
+		window = windows[windowCount-1]
+	} else {
+		window = &ArrivalLagWindow{Start: windowStart, Counts: make([]int64, len(ArrivalLagBounds)+1)}
+		windows = append(windows, window)
+		oldestStart := oldestArrivalLagWindow(arrivalTime)
+		for len(windows) > 0 && windows[0].Start.Before(oldestStart) {
+			windows = windows[1:]
+		}
+		arrivalLags[hardwareId] = windows
+	}
+	window.Counts[sort.SearchFloat64s(ArrivalLagBounds, lagSeconds)]++
+	if lagSeconds > window.MaxSeconds {
+		window.MaxSeconds = lagSeconds
+	}
+}
+
+// oldestArrivalLagWindow is the start of the oldest window kept at now.
+func oldestArrivalLagWindow(now time.Time) time.Time {
+	settings := config.Current.Ingestion.ArrivalLag
+	return now.Truncate(settings.Window.Duration).Add(-time.Duration(settings.Windows-1) * settings.Window.Duration)
+}
+
+// ArrivalLagOf returns the lag distribution of a hardware's live readings,
+// empty if none arrived, with the windows it is made of if withWindows is
+// set.
+func ArrivalLagOf(hardwareId string, withWindows bool) *ArrivalLag {
+	arrivalLagMutex.Lock()
+	defer arrivalLagMutex.Unlock()
+
+	arrivalLag := &ArrivalLag{HardwareId: hardwareId, BoundsSeconds: ArrivalLagBounds, Counts: make([]int64, len(ArrivalLagBounds)+1)}
+	oldestStart := oldestArrivalLagWindow(time.Now())
+	for _, window := range arrivalLags[hardwareId] {
+		if window.Start.Before(oldestStart) {
+			continue
+		}
+		if withWindows {
+			windowCopy := *window
+			windowCopy.Counts = append([]int64(nil), window.Counts...)
+			arrivalLag.Windows = append(arrivalLag.Windows, &windowCopy)
+		}
+		for bucketIndex, count := range window.Counts {
+			arrivalLag.Counts[bucketIndex] += count
+			arrivalLag.Count += count
+		}
+		if window.MaxSeconds > arrivalLag.MaxSeconds {
+			arrivalLag.MaxSeconds = window.MaxSeconds
+		}
+	}
+	arrivalLag.MedianSeconds = arrivalLag.percentile(0.5)
+	arrivalLag.P90Seconds = arrivalLag.percentile(0.9)
+	arrivalLag.P99Seconds = arrivalLag.percentile(0.99)
+	return arrivalLag
+}
+
+func (arrivalLag *ArrivalLag) percentile(fraction float64) float64 {
+	var cumulativeCount int64
+	for bucketIndex, count := range arrivalLag.Counts {
+		cumulativeCount += count
+		if float64(cumulativeCount) >= fraction*float64(arrivalLag.Count) {
+			if bucketIndex == len(ArrivalLagBounds) || ArrivalLagBounds[bucketIndex] > arrivalLag.MaxSeconds {
+				return arrivalLag.MaxSeconds
+			}
+			return ArrivalLagBounds[bucketIndex]
+		}
+	}
+	return arrivalLag.MaxSeconds
+}
+
+// ArrivalLagHardwareIds lists the hardware live readings arrived for, within
+// the windows kept.
+func ArrivalLagHardwareIds() []string {
+	arrivalLagMutex.Lock()
+	defer arrivalLagMutex.Unlock()
+
+	oldestStart := oldestArrivalLagWindow(time.Now())
+	hardwareIds := make([]string, 0, len(arrivalLags))
+	for hardwareId, windows := range arrivalLags {
+		if !windows[len(windows)-1].Start.Before(oldestStart) {
+			hardwareIds = append(hardwareIds, hardwareId)
+		}
+	}
+	sort.Strings(hardwareIds)
+	return hardwareIds
+}
@@ -0,0 +1,151 @@
+package hardware
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/config"
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/metrics"
+)
+
+const (
+	BreakerClosed   = "closed"
+	BreakerOpen     = "open"
+	BreakerHalfOpen = "half_open"
+)
+
+// BreakerStatus is how reads from the storage backend currently fare.
+// RetryAt is when an open breaker next lets a read through.
+type BreakerStatus struct {
+	State      string     `json:"state"`
+	Failures   int        `json:"failures"`
+	LastError  string     `json:"lastError,omitempty"`
+	OpenedAt   *time.Time `json:"openedAt,omitempty"`
+	RetryAt    *time.Time `json:"retryAt,omitempty"`
+	Rejections int64      `json:"rejections"`
+}
+
+var (
+	breakerMutex sync.Mutex
+	breaker      = BreakerStatus{State: BreakerClosed}
+	// isProbing is set while the one read a half-open breaker lets through
+	// is under way, so that the others keep failing fast.
+	isProbing bool
+
+	breakerOpenCounter      = metrics.NewCounter("hardware_store_breaker_opens_total")
+	breakerRejectionCounter = metrics.NewCounter("hardware_store_breaker_rejections_total")
+	breakerTimeoutCounter   = metrics.NewCounter("hardware_store_read_timeouts_total")
+)
+
+func init() {
+	metrics.NewGaugeFunc("hardware_store_breaker_open", func() float64 {
+		if StoreStatus().State == BreakerClosed {
+			return 0
+		}
+		return 1
+	})
+}
+
+// HasStore reports whether samples are kept in a storage backend.
+func HasStore() bool {
+	return backend != nil
+}
+
+// StoreStatus reports on the breaker around reads from the storage backend.
+func StoreStatus() BreakerStatus {
+	breakerMutex.Lock()
+	defer breakerMutex.Unlock()
+
+	status := breaker
+	if status.State == BreakerOpen && !time.Now().Before(*status.RetryAt) {
+		status.State = BreakerHalfOpen
+	}
+	if status.State == BreakerClosed {
+		status.OpenedAt, status.RetryAt = nil, nil
+	}
+	return status
+}
+
+// allowRead decides whether a read may reach the backend, and whether it is
+// the probe of a half-open breaker.
+func allowRead(now time.Time) (bool, bool) {
+	breakerMutex.Lock()
+	defer breakerMutex.Unlock()
+
+	if breaker.State == BreakerClosed {
+		return true, false
+	}
+	if now.Before(*breaker.RetryAt) || isProbing {
+		breaker.Rejections++
+		breakerRejectionCounter.Inc()
+		return false, false
+	}
+	breaker.State, isProbing = BreakerHalfOpen, true
+	return true, true
+}
+
+// recordRead closes the breaker after a read that worked, and opens it once
+// enough have failed in a row, or the probe has.
+func recordRead(err error, isProbe bool, now time.Time) {
+	breakerMutex.Lock()
+	defer breakerMutex.Unlock()
+
+	settings := config.Current.Storage.Breaker
+	if isProbe {
+		isProbing = false
+	}
+	if err == nil {
+		breaker.State, breaker.Failures, breaker.LastError = BreakerClosed, 0, ""
+		return
+	}
+
+	breaker.Failures++
+	breaker.LastError = err.Error()
+	if isProbe || (breaker.State == BreakerClosed && breaker.Failures >= settings.FailureThreshold) {
+		if breaker.State == BreakerClosed {
+			breaker.OpenedAt = &now
+		}
+		retryAt := now.Add(settings.OpenFor.Duration)
+		breaker.State, breaker.RetryAt = BreakerOpen, &retryAt
+		breakerOpenCounter.Inc()
+	}
+}
+
+// loadFromStore reads a range of a hardware from the backend through the
+// breaker. A read taking longer than the timeout is left to finish on its
+// own and counts as failed. Failures are ErrStoreUnavailable, whether the
+// backend failed the read or the breaker refused it.
+func loadFromStore(hardwareId string, from time.Time, to time.Time) ([]*Sample, error) {
+	isAllowed, isProbe := allowRead(time.Now())
+	if !isAllowed {
+		return nil, ErrStoreUnavailable
+	}
+
+	type loaded struct {
+		samples []*Sample
+		err     error
+	}
+	store := backend
+	loadedChannel := make(chan loaded, 1)
+	go func() {
+		samples, err := store.LoadRange(hardwareId, from, to)
+		loadedChannel <- loaded{samples, err}
+	}()
+
+	timeout := time.NewTimer(config.Current.Storage.Breaker.ReadTimeout.Duration)
+	defer timeout.Stop()
+	select {
+	case result := <-loadedChannel:
+		recordRead(result.err, isProbe, time.Now())
+		if result.err != nil {
+			return nil, fmt.Errorf(`%w: %v`, ErrStoreUnavailable, result.err)
+		}
+		return result.samples, nil
+	case <-timeout.C:
+		breakerTimeoutCounter.Inc()
+		err := fmt.Errorf(`reading hardware "%s" took longer than %s`, hardwareId, config.Current.Storage.Breaker.ReadTimeout)
+		recordRead(err, isProbe, time.Now())
+		return nil, fmt.Errorf(`%w: %v`, ErrStoreUnavailable, err)
+	}
+}
@@ -0,0 +1,90 @@
+package hardware
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// Subscription receives copies of the samples of one hardware as they are
+// ingested or reloaded. A subscriber that falls more than its buffer behind
+// loses samples rather than holding up ingestion; Dropped counts them.
+type Subscription struct {
+	HardwareId string
+	Samples    <-chan *BroadcastSample
+
+	samples chan *BroadcastSample
+	dropped int64
+}
+
+// BroadcastSample is a sample handed to subscribers, with the journal
+// sequence of the working set once it was ingested. Samples are handed over
+// in the order of their sequences, so a subscriber that saw one can resume
+// after its sequence with ChangedSamplesSince.
+type BroadcastSample struct {
+	*Sample
+	Sequence int64
+}
+
+var (
+	subscriptionsMutex sync.Mutex
+	subscriptions      map[string]map[*Subscription]struct{} = make(map[string]map[*Subscription]struct{})
+)
+
+func Subscribe(hardwareId string, buffer int) *Subscription {
+	samples := make(chan *BroadcastSample, buffer)
+	subscription := &Subscription{HardwareId: hardwareId, Samples: samples, samples: samples}
+
+	subscriptionsMutex.Lock()
+	defer subscriptionsMutex.Unlock()
+
+	if _, hasSubscriptions := subscriptions[hardwareId]; !hasSubscriptions {
+		subscriptions[hardwareId] = make(map[*Subscription]struct{})
+	}
+	subscriptions[hardwareId][subscription] = struct{}{}
+	return subscription
+}
+
+// Close stops the subscription. Samples already buffered can still be read.
+func (subscription *Subscription) Close() {
+	subscriptionsMutex.Lock()
+	defer subscriptionsMutex.Unlock()
+
+	delete(subscriptions[subscription.HardwareId], subscription)
+	if len(subscriptions[subscription.HardwareId]) == 0 {
+		delete(subscriptions, subscription.HardwareId)
+	}
+}
+
+func (subscription *Subscription) Dropped() int64 {
+	return atomic.LoadInt64(&subscription.dropped)
+}
+
+func SubscriberCount() int {
+	subscriptionsMutex.Lock()
+	defer subscriptionsMutex.Unlock()
+
+	var count int
+	for _, hardwareSubscriptions := range subscriptions {
+		count += len(hardwareSubscriptions)
+	}
+	return count
+}
+
+// broadcast hands the samples to every subscriber of a hardware. Later
+// readings replace samples in the working set rather than change them, so
+// subscribers can share them. The caller holds storeMutex for writing, so
+// samples are handed over in the order they were journaled in.
+func broadcast(hardwareId string, samples []*Sample) {
+	subscriptionsMutex.Lock()
+	defer subscriptionsMutex.Unlock()
+
+	for subscription := range subscriptions[hardwareId] {
+		for _, sample := range samples {
+			select {
+			case subscription.samples <- &BroadcastSample{Sample: sample, Sequence: journalSequence}:
+			default:
+				atomic.AddInt64(&subscription.dropped, 1)
+			}
+		}
+	}
+}
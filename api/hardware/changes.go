@@ -0,0 +1,93 @@
+package hardware
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrNoStore is returned when an operation needs the storage backend but
+// samples are only kept in memory.
+var ErrNoStore = errors.New(`no storage backend`)
+
+// ChangeHook is told about every batch of readings merged into the working
+// set, by ingestion or a refresh, once per hardware, with the span of time
+// the readings cover.
+type ChangeHook func(hardwareId string, from time.Time, to time.Time)
+
+var changeHooks []ChangeHook
+
+// OnChange registers a hook to run after readings are added. Hooks run on the
+// ingesting goroutine, so they must not block.
+func OnChange(hook ChangeHook) {
+	changeHooks = append(changeHooks, hook)
+}
+
+func notifyChanges(spans map[string][2]int64) {
+	for hardwareId, span := range spans {
+		for _, hook := range changeHooks {
+			hook(hardwareId, time.UnixMilli(span[0]), time.UnixMilli(span[1]))
+		}
+	}
+}
+
+// Refresh replaces the working set of a hardware between from and to with
+// what the backend holds, picking up readings another replica stored there.
+// Expired history is left in the backend. The values replaced are journaled,
+// so the hardware can still be taken back to before the refresh.
+func Refresh(hardwareId string, from time.Time, to time.Time) error {
+	if backend == nil {
+		return ErrNoStore
+	}
+	storeMutex.RLock()
+	if horizon, hasHorizon := memoryHorizons[hardwareId]; hasHorizon && from.UnixMilli() < horizon {
+		from = time.UnixMilli(horizon)
+	}
+	storeMutex.RUnlock()
+	if from.After(to) {
+		return nil
+	}
+
+	samples, err := loadFromStore(hardwareId, from, to)
+	if err != nil {
+		return err
+	}
+
+	storeMutex.Lock()
+	if _, hardwareExists := hardware[hardwareId]; !hardwareExists {
+		hardware[hardwareId] = make(map[int64]*Sample)
+	}
+	fromTimestamp, toTimestamp := from.UnixMilli(), to.UnixMilli()
+	spans := make(map[string][2]int64)
+	replacedSamples := make(map[int64]*Sample)
+	for timestamp, sample := range hardware[hardwareId] {
+		if timestamp >= fromTimestamp && timestamp <= toTimestamp {
+			replacedSamples[timestamp] = sample
+			delete(hardware[hardwareId], timestamp)
+		}
+	}
+	for _, sample := range samples {
+		timestamp := sample.Time.UnixMilli()
+		hardware[hardwareId][timestamp] = sample
+		if timestamp > latestTimestamps[hardwareId] {
+			latestTimestamps[hardwareId] = timestamp
+		}
+		if span, hasSpan := spans[hardwareId]; !hasSpan {
+			spans[hardwareId] = [2]int64{timestamp, timestamp}
+		} else if timestamp < span[0] {
+			spans[hardwareId] = [2]int64{timestamp, span[1]}
+		} else if timestamp > span[1] {
+			spans[hardwareId] = [2]int64{span[0], timestamp}
+		}
+	}
+	journalReplacement(hardwareId, replacedSamples, samples, time.Now())
+
+	invalidateIndex(hardwareId)
+	invalidateRollups(hardwareId)
+	republishLatest(hardwareId)
+	revision++
+	broadcast(hardwareId, samples)
+	storeMutex.Unlock()
+
+	notifyChanges(spans)
+	return nil
+}
@@ -0,0 +1,101 @@
+package hardware_test
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/hardware"
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/internal/fixtures"
+)
+
+func TestRefreshIsJournaled(t *testing.T) {
+	// The backend holds another value at minute 5 and nothing at minute 6
+	store := hardware.NewMemoryStore()
+	if err := store.Put([]*hardware.Reading{{HardwareId: fixtures.HardwareId, Time: fixtures.Minute(5), Values: map[string]float64{"temperature": 999, "rmsVelocityX": 1.5}}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := hardware.UseStore(store); err != nil {
+		t.Fatal(err)
+	}
+	defer hardware.UseStore(nil)
+
+	asOf := time.Now()
+	if err := hardware.Refresh(fixtures.HardwareId, fixtures.Minute(5), fixtures.Minute(6)); err != nil {
+		t.Fatal(err)
+	}
+	if samples, _ := hardware.SamplesBetween(fixtures.HardwareId, fixtures.Minute(5), fixtures.Minute(6)); len(samples) != 1 {
+		t.Fatalf(`expected the refresh to leave 1 sample, got %d`, len(samples))
+	}
+
+	snapshot, err := hardware.SnapshotAt(fixtures.HardwareId, asOf, fixtures.Minute(0))
+	if err != nil {
+		t.Fatalf(`expected the working set to be taken back to before the refresh, got %v`, err)
+	}
+	samples, _ := snapshot.SamplesBetween(fixtures.Minute(5), fixtures.Minute(6))
+	if len(samples) != 2 {
+		t.Fatalf(`expected 2 samples before the refresh, got %d`, len(samples))
+	}
+	for minute, sample := range samples {
+		if temperature, _ := sample.ValueByMetric("temperature"); temperature == nil || *temperature != float64(25+minute) {
+			t.Errorf(`expected a temperature of %d at minute %d before the refresh, got %v`, 25+minute, 5+minute, temperature)
+		}
+	}
+}
+
+func TestRefreshFromReplica(t *testing.T) {
+	logPath := filepath.Join(t.TempDir(), "samples.log")
+	store, err := hardware.NewFileStore(logPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := hardware.UseStore(store); err != nil {
+		t.Fatal(err)
+	}
+	defer hardware.UseStore(nil)
+	replica, err := hardware.NewFileStore(logPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer replica.Close()
+
+	// Another replica overwrites minute 10, then this one reloads the span it
+	// was told about, the way invalidation does
+	if err := replica.Put([]*hardware.Reading{{HardwareId: fixtures.HardwareId, Time: fixtures.Minute(10), Values: map[string]float64{"temperature": 31, "rmsVelocityX": 1.5}}}); err != nil {
+		t.Fatal(err)
+	}
+	// Hooks are told about it like about ingested readings; they cannot be
+	// taken off again, so this one only records the first change after it
+	var changedSpan []time.Time
+	hardware.OnChange(func(hardwareId string, from time.Time, to time.Time) {
+		if changedSpan == nil && hardwareId == fixtures.HardwareId {
+			changedSpan = []time.Time{from, to}
+		}
+	})
+	asOf := time.Now()
+	if err := hardware.Refresh(fixtures.HardwareId, fixtures.Minute(10), fixtures.Minute(10)); err != nil {
+		t.Fatal(err)
+	}
+	if len(changedSpan) != 2 || !changedSpan[0].Equal(fixtures.Minute(10)) || !changedSpan[1].Equal(fixtures.Minute(10)) {
+		t.Errorf(`expected change hooks told about minute 10, got %v`, changedSpan)
+	}
+	samples, _ := hardware.SamplesBetween(fixtures.HardwareId, fixtures.Minute(10), fixtures.Minute(10))
+	if len(samples) != 1 {
+		t.Fatalf(`expected 1 sample after the refresh, got %d`, len(samples))
+	}
+	if temperature, _ := samples[0].ValueByMetric("temperature"); temperature == nil || *temperature != 31 {
+		t.Fatalf(`expected the replica's temperature of 31 after the refresh, got %v`, temperature)
+	}
+
+	snapshot, err := hardware.SnapshotAt(fixtures.HardwareId, asOf, fixtures.Minute(0))
+	if err != nil {
+		t.Fatalf(`expected the working set to be taken back to before the refresh, got %v`, err)
+	}
+	samples, _ = snapshot.SamplesBetween(fixtures.Minute(10), fixtures.Minute(10))
+	if len(samples) != 1 {
+		t.Fatalf(`expected 1 sample before the refresh, got %d`, len(samples))
+	}
+	if temperature, _ := samples[0].ValueByMetric("temperature"); temperature == nil || *temperature != 30 {
+		t.Errorf(`expected a temperature of 30 before the refresh, got %v`, temperature)
+	}
+}
@@ -0,0 +1,25 @@
+package hardware
+
+import (
+	"time"
+
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/config"
+)
+
+// The sample files keep the time each hardware reported, while everything in
+// memory, in the storage backend and served is on the corrected clock.
+
+func clockOffset(hardwareId string) time.Duration {
+	return config.Current.ClockOffsets[hardwareId].Duration
+}
+
+// CorrectedTime moves a time a hardware reported by its configured clock
+// offset.
+func CorrectedTime(hardwareId string, reported time.Time) time.Time {
+	return reported.Add(clockOffset(hardwareId))
+}
+
+// reportedTime undoes CorrectedTime.
+func reportedTime(hardwareId string, corrected time.Time) time.Time {
+	return corrected.Add(-clockOffset(hardwareId))
+}
@@ -0,0 +1,143 @@
+package hardware
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/config"
+)
+
+// column is one metric of the registry the store was loaded with.
+type column struct {
+	metric   string
+	name     string
+	dataFile string
+	unit     string
+
+	// jsonKey is metric encoded as a JSON string, ready for MarshalJSON.
+	jsonKey []byte
+}
+
+var (
+	// columns lists the metrics in registry order; column indexes throughout
+	// the store, samples included, refer to it.
+	columns           []column
+	columnsByMetric   map[string]int
+	columnsByDataFile map[string]int
+)
+
+func init() {
+	useRegistry(config.Current.Metrics)
+}
+
+// useRegistry lays the columns out after a metric registry. Samples hold their
+// values by column index, so it only happens while nothing is loaded.
+func useRegistry(registry []config.Metric) {
+	columns = make([]column, 0, len(registry))
+	columnsByMetric = make(map[string]int, len(registry))
+	columnsByDataFile = make(map[string]int, len(registry))
+	for _, metric := range registry {
+		columnsByMetric[metric.Key] = len(columns)
+		columnsByDataFile[metric.File] = len(columns)
+		jsonKey, _ := json.Marshal(metric.Key)
+		columns = append(columns, column{metric: metric.Key, name: metric.Name, dataFile: metric.File, unit: metric.Unit, jsonKey: jsonKey})
+	}
+}
+
+// MetricOfHeading resolves the heading of a column of a wide CSV file or
+// workbook sheet to a metric: as config.Columns maps it, else by the key,
+// name or file name of a metric, returning "" for columns to skip and false
+// for headings of no metric.
+func MetricOfHeading(heading string) (string, bool) {
+	heading = strings.TrimSpace(heading)
+	if metric, isMapped := config.Current.Columns[heading]; isMapped {
+		return metric, true
+	}
+	if _, isMetric := columnsByMetric[heading]; isMetric {
+		return heading, true
+	}
+	for _, column := range columns {
+		if strings.EqualFold(heading, column.name) || strings.EqualFold(heading, strings.TrimSuffix(column.dataFile, filepath.Ext(column.dataFile))) {
+			return column.metric, true
+		}
+	}
+	return "", false
+}
+
+// valueOf returns the value of a column, or nil when the sample has none.
+func (sample *Sample) valueOf(columnIndex int) *float64 {
+	if columnIndex >= len(sample.values) {
+		return nil
+	}
+	return sample.values[columnIndex]
+}
+
+func (sample *Sample) setValue(columnIndex int, value *float64) {
+	if columnIndex >= len(sample.values) {
+		values := make([]*float64, len(columns))
+		copy(values, sample.values)
+		sample.values = values
+	}
+	sample.values[columnIndex] = value
+}
+
+// clone copies a sample, so the copy can be changed while queries still hold
+// the original.
+func (sample *Sample) clone() *Sample {
+	return &Sample{Time: sample.Time, values: append([]*float64(nil), sample.values...)}
+}
+
+// MarshalJSON writes every metric of the registry under its key, in registry
+// order, with null for those without a value. Tabulations marshal thousands
+// of samples, so values are formatted directly, the way encoding/json would.
+func (sample Sample) MarshalJSON() ([]byte, error) {
+	buffer := make([]byte, 0, 24*len(columns))
+	buffer = append(buffer, '{')
+	for columnIndex, column := range columns {
+		if columnIndex > 0 {
+			buffer = append(buffer, ',')
+		}
+		buffer = append(buffer, column.jsonKey...)
+		buffer = append(buffer, ':')
+
+		value := sample.valueOf(columnIndex)
+		if value == nil {
+			buffer = append(buffer, "null"...)
+			continue
+		}
+		if math.IsNaN(*value) || math.IsInf(*value, 0) {
+			return nil, fmt.Errorf(`metric "%s" has unsupported value %g`, column.metric, *value)
+		}
+		format := byte('f')
+		if absolute := math.Abs(*value); absolute != 0 && (absolute < 1e-6 || absolute >= 1e21) {
+			format = 'e'
+		}
+		buffer = strconv.AppendFloat(buffer, *value, format, -1, 64)
+		// Exponents are written like e-7, not e-07
+		if valueLength := len(buffer); format == 'e' && buffer[valueLength-4] == 'e' && buffer[valueLength-3] == '-' && buffer[valueLength-2] == '0' {
+			buffer[valueLength-2] = buffer[valueLength-1]
+			buffer = buffer[:valueLength-1]
+		}
+	}
+	return append(buffer, '}'), nil
+}
+
+// UnmarshalJSON reads what MarshalJSON writes, for clients of the API. Keys of
+// no metric of the registry are ignored; Time is left alone, as tabulations
+// carry it in the key of each sample.
+func (sample *Sample) UnmarshalJSON(data []byte) error {
+	var values map[string]*float64
+	if err := json.Unmarshal(data, &values); err != nil {
+		return err
+	}
+	for metric, value := range values {
+		if columnIndex, hasColumn := columnsByMetric[metric]; hasColumn {
+			sample.setValue(columnIndex, value)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,114 @@
+package hardware
+
+import (
+	"sort"
+	"time"
+
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/config"
+)
+
+// Inconsistency is a reading that exceeds the largest reading of its bound
+// around it, such as an RMS velocity above the peak velocity of its axis.
+type Inconsistency struct {
+	Time       time.Time `json:"time"`
+	Metric     string    `json:"metric"`
+	Value      float64   `json:"value"`
+	AtMost     string    `json:"atMost"`
+	BoundValue float64   `json:"boundValue"`
+}
+
+// ConsistencyCheck sums up one configured bound over a window. Readings
+// without a reading of their bound near enough are not checked.
+type ConsistencyCheck struct {
+	Metric       string `json:"metric"`
+	AtMost       string `json:"atMost"`
+	Checked      int    `json:"checked"`
+	Inconsistent int    `json:"inconsistent"`
+}
+
+// CheckConsistency holds the readings of a hardware between from and to
+// against their bounds, as config.Consistency describes, and returns a
+// summary per bound alongside every inconsistent reading, in time order.
+func CheckConsistency(hardwareId string, from time.Time, to time.Time) ([]*ConsistencyCheck, []*Inconsistency, error) {
+	consistency := config.Current.Consistency
+	if err := ensureLoaded(hardwareId, from.Add(-consistency.Window.Duration)); err != nil {
+		return nil, nil, err
+	}
+	storeMutex.RLock()
+	defer storeMutex.RUnlock()
+
+	if !hasSamples(hardwareId) {
+		return nil, nil, unknownHardwareError(hardwareId)
+	}
+
+	index := indexOf(hardwareId)
+	distance := consistency.Window.Duration.Milliseconds()
+	fromTimestamp, toTimestamp := from.UnixMilli(), to.UnixMilli()
+	checks := make([]*ConsistencyCheck, 0, len(consistency.Bounds))
+	inconsistencies := make([]*Inconsistency, 0)
+	for _, bound := range consistency.Bounds {
+		check := &ConsistencyCheck{Metric: bound.Metric, AtMost: bound.AtMost}
+		checks = append(checks, check)
+		columnIndex, isColumn := columnsByMetric[bound.Metric]
+		boundColumnIndex, isBoundColumn := columnsByMetric[bound.AtMost]
+		if !isColumn || !isBoundColumn {
+			continue
+		}
+		column, boundColumn := index.columns[columnIndex], index.columns[boundColumnIndex]
+
+		firstIndex := sort.Search(len(column.timestamps), func(timestampIndex int) bool { return column.timestamps[timestampIndex] >= fromTimestamp })
+		window := newMaximumWindow(boundColumn, distance)
+		for timestampIndex := firstIndex; timestampIndex < len(column.timestamps) && column.timestamps[timestampIndex] <= toTimestamp; timestampIndex++ {
+			timestamp := column.timestamps[timestampIndex]
+			boundValue, hasBoundValue := window.maximumAround(timestamp)
+			if !hasBoundValue {
+				continue
+			}
+			check.Checked++
+
+			value := column.values[timestampIndex]
+			if value > boundValue+consistency.Tolerance*boundValue {
+				check.Inconsistent++
+				inconsistencies = append(inconsistencies, &Inconsistency{Time: time.UnixMilli(timestamp), Metric: bound.Metric, Value: value, AtMost: bound.AtMost, BoundValue: boundValue})
+			}
+		}
+	}
+
+	sort.SliceStable(inconsistencies, func(leftIndex, rightIndex int) bool {
+		return inconsistencies[leftIndex].Time.Before(inconsistencies[rightIndex].Time)
+	})
+	return checks, inconsistencies, nil
+}
+
+// maximumWindow slides over a column, answering the largest value within a
+// distance of timestamps visited in increasing order.
+type maximumWindow struct {
+	column   metricColumn
+	distance int64
+
+	nextIndex int
+	// candidates are indexes into column, with decreasing values
+	candidates []int
+}
+
+func newMaximumWindow(column metricColumn, distance int64) *maximumWindow {
+	return &maximumWindow{column: column, distance: distance, candidates: make([]int, 0)}
+}
+
+func (window *maximumWindow) maximumAround(timestamp int64) (float64, bool) {
+	for window.nextIndex < len(window.column.timestamps) && window.column.timestamps[window.nextIndex] <= timestamp+window.distance {
+		value := window.column.values[window.nextIndex]
+		for len(window.candidates) > 0 && window.column.values[window.candidates[len(window.candidates)-1]] <= value {
+			window.candidates = window.candidates[:len(window.candidates)-1]
+		}
+		window.candidates = append(window.candidates, window.nextIndex)
+		window.nextIndex++
+	}
+	for len(window.candidates) > 0 && window.column.timestamps[window.candidates[0]] < timestamp-window.distance {
+		window.candidates = window.candidates[1:]
+	}
+	if len(window.candidates) == 0 {
+		return 0, false
+	}
+	return window.column.values[window.candidates[0]], true
+}
@@ -0,0 +1,81 @@
+package hardware
+
+import (
+	"time"
+)
+
+// MetricDescription summarizes the values one metric of a hardware has.
+type MetricDescription struct {
+	Samples int       `json:"samples"`
+	First   time.Time `json:"first"`
+	Last    time.Time `json:"last"`
+	Latest  float64   `json:"latest"`
+}
+
+// Description tells a client what a hardware reports and over what time
+// range, as far as the samples currently held go. Metrics without any value
+// are left out. Pinned and Position are the hardware's Ordering.
+type Description struct {
+	Id       string                        `json:"id"`
+	Pinned   bool                          `json:"pinned,omitempty"`
+	Position int                           `json:"position,omitempty"`
+	Samples  int                           `json:"samples"`
+	First    *time.Time                    `json:"first,omitempty"`
+	Last     *time.Time                    `json:"last,omitempty"`
+	Metrics  map[string]*MetricDescription `json:"metrics"`
+}
+
+func Describe(hardwareId string) (*Description, error) {
+	storeMutex.RLock()
+	defer storeMutex.RUnlock()
+
+	return describe(hardwareId)
+}
+
+func describe(hardwareId string) (*Description, error) {
+	if !hasSamples(hardwareId) {
+		return nil, unknownHardwareError(hardwareId)
+	}
+
+	index := indexOf(hardwareId)
+	ordering := OrderingOf(hardwareId)
+	description := &Description{Id: hardwareId, Pinned: ordering.Pinned, Position: ordering.Position, Samples: len(index.timestamps), Metrics: make(map[string]*MetricDescription)}
+	if sampleCount := len(index.timestamps); sampleCount > 0 {
+		first, last := time.UnixMilli(index.timestamps[0]), time.UnixMilli(index.timestamps[sampleCount-1])
+		description.First, description.Last = &first, &last
+	}
+
+	for columnIndex, column := range index.columns {
+		if len(column.timestamps) == 0 {
+			continue
+		}
+		description.Metrics[columns[columnIndex].metric] = &MetricDescription{
+			Samples: len(column.timestamps),
+			First:   time.UnixMilli(column.timestamps[0]),
+			Last:    time.UnixMilli(column.timestamps[len(column.timestamps)-1]),
+			Latest:  column.values[len(column.values)-1],
+		}
+	}
+	return description, nil
+}
+
+// ListHardware describes every hardware, in listing order.
+func ListHardware() []*Description {
+	storeMutex.RLock()
+	defer storeMutex.RUnlock()
+
+	hardwareIds := make([]string, 0, len(hardware))
+	for hardwareId := range hardware {
+		hardwareIds = append(hardwareIds, hardwareId)
+	}
+	SortHardwareIds(hardwareIds)
+	descriptions := make([]*Description, 0, len(hardwareIds))
+	for _, hardwareId := range hardwareIds {
+		description, err := describe(hardwareId)
+		if err != nil {
+			continue
+		}
+		descriptions = append(descriptions, description)
+	}
+	return descriptions
+}
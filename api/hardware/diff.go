@@ -0,0 +1,125 @@
+package hardware
+
+import (
+	"fmt"
+	"io/fs"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// ChannelDiff counts how one sample file of a hardware differs between two
+// sample trees. A value is changed when it differs by more than the tolerance.
+type ChannelDiff struct {
+	HardwareId     string  `json:"hardwareId"`
+	SampleDataName string  `json:"sampleDataName"`
+	Added          int     `json:"added"`
+	Removed        int     `json:"removed"`
+	Changed        int     `json:"changed"`
+	Unchanged      int     `json:"unchanged"`
+	MaxDifference  float64 `json:"maxDifference"`
+}
+
+func (channelDiff *ChannelDiff) IsEmpty() bool {
+	return channelDiff.Added == 0 && channelDiff.Removed == 0 && channelDiff.Changed == 0
+}
+
+func readSampleTree(sampleTreePath string) (map[string]map[string]map[int64]float64, error) {
+	if _, err := os.Stat(sampleTreePath); err != nil {
+		return nil, fmt.Errorf(`unable to read sample tree "%s": %w`, sampleTreePath, err)
+	}
+
+	sampleTree := make(map[string]map[string]map[int64]float64)
+	walkErr := filepath.WalkDir(sampleTreePath, func(sampleFilePath string, directoryEntry fs.DirEntry, pathErr error) error {
+		if pathErr != nil {
+			return pathErr
+		}
+		if directoryEntry.IsDir() {
+			return nil
+		}
+
+		samplePath, sampleDataName := filepath.Split(sampleFilePath)
+		hardwareId := filepath.Base(samplePath)
+		sampleTimestamps, sampleDataValues, readErr := readSampleDataFile(sampleFilePath)
+		if readErr != nil {
+			return readErr
+		}
+
+		if _, hardwareExists := sampleTree[hardwareId]; !hardwareExists {
+			sampleTree[hardwareId] = make(map[string]map[int64]float64)
+		}
+		values := make(map[int64]float64, len(sampleTimestamps))
+		for sampleIndex, sampleTimestamp := range sampleTimestamps {
+			values[sampleTimestamp] = sampleDataValues[sampleIndex]
+		}
+		sampleTree[hardwareId][sampleDataName] = values
+		return nil
+	})
+	return sampleTree, walkErr
+}
+
+// DiffSampleTrees compares every sample file of two sample trees, such as two
+// releases of the challenge dataset, and reports the differing channels.
+func DiffSampleTrees(oldTreePath string, newTreePath string, tolerance float64) ([]*ChannelDiff, error) {
+	oldTree, err := readSampleTree(oldTreePath)
+	if err != nil {
+		return nil, err
+	}
+	newTree, err := readSampleTree(newTreePath)
+	if err != nil {
+		return nil, err
+	}
+
+	channelDiffs := make(map[[2]string]*ChannelDiff)
+	channelDiffOf := func(hardwareId string, sampleDataName string) *ChannelDiff {
+		key := [2]string{hardwareId, sampleDataName}
+		if _, hasChannelDiff := channelDiffs[key]; !hasChannelDiff {
+			channelDiffs[key] = &ChannelDiff{HardwareId: hardwareId, SampleDataName: sampleDataName}
+		}
+		return channelDiffs[key]
+	}
+
+	for hardwareId, oldChannels := range oldTree {
+		for sampleDataName, oldValues := range oldChannels {
+			channelDiff := channelDiffOf(hardwareId, sampleDataName)
+			newValues := newTree[hardwareId][sampleDataName]
+			for sampleTimestamp, oldValue := range oldValues {
+				newValue, hasNewValue := newValues[sampleTimestamp]
+				switch difference := math.Abs(newValue - oldValue); {
+				case !hasNewValue:
+					channelDiff.Removed++
+				case difference > tolerance || math.IsNaN(difference):
+					channelDiff.Changed++
+					channelDiff.MaxDifference = math.Max(channelDiff.MaxDifference, difference)
+				default:
+					channelDiff.Unchanged++
+				}
+			}
+		}
+	}
+	for hardwareId, newChannels := range newTree {
+		for sampleDataName, newValues := range newChannels {
+			channelDiff := channelDiffOf(hardwareId, sampleDataName)
+			oldValues := oldTree[hardwareId][sampleDataName]
+			for sampleTimestamp := range newValues {
+				if _, hasOldValue := oldValues[sampleTimestamp]; !hasOldValue {
+					channelDiff.Added++
+				}
+			}
+		}
+	}
+
+	sortedChannelDiffs := make([]*ChannelDiff, 0, len(channelDiffs))
+	for _, channelDiff := range channelDiffs {
+		sortedChannelDiffs = append(sortedChannelDiffs, channelDiff)
+	}
+	sort.Slice(sortedChannelDiffs, func(leftIndex, rightIndex int) bool {
+		left, right := sortedChannelDiffs[leftIndex], sortedChannelDiffs[rightIndex]
+		if left.HardwareId != right.HardwareId {
+			return left.HardwareId < right.HardwareId
+		}
+		return left.SampleDataName < right.SampleDataName
+	})
+	return sortedChannelDiffs, nil
+}
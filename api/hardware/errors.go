@@ -0,0 +1,26 @@
+package hardware
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	ErrUnknownHardware = errors.New("unknown hardware")
+	ErrUnknownMetric   = errors.New("unknown metric")
+	ErrOutOfRange      = errors.New("outside of interpolable range")
+	ErrNoData          = errors.New("no data")
+	ErrLocked          = errors.New("locked")
+
+	// ErrStoreUnavailable is returned instead of reading from a storage
+	// backend the breaker has given up on for now.
+	ErrStoreUnavailable = errors.New("storage backend unavailable")
+
+	// ErrSnapshotUnavailable is returned for a time further back than the
+	// journal of value changes reaches.
+	ErrSnapshotUnavailable = errors.New("snapshot unavailable")
+)
+
+func unknownHardwareError(hardwareId string) error {
+	return fmt.Errorf(`%w "%s"`, ErrUnknownHardware, hardwareId)
+}
@@ -0,0 +1,358 @@
+package hardware
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// fileStore keeps samples in an append-only log file of JSON records, one
+// per line. Like sqliteStore, it keeps samples across restarts, reads ranges
+// back without holding all of them in memory, and may be shared by
+// replicas, without taking cgo.
+//
+// Only where each record of a hardware starts is held in memory, indexed by
+// the hour its timestamp falls in, and removals in full; samples are read
+// back from the log when loaded, from the hours of the range only, so the
+// store costs the working set little beyond what the memory retention keeps.
+//
+// Every write is a single append, which the file system does not interleave
+// with appends of other processes, so replicas may share one log: each
+// catches up on what the others appended before it reads.
+type fileStore struct {
+	mutex sync.Mutex
+	file  *os.File
+
+	// replayedUntil is how far the log has been read; records past it were
+	// appended since, by this process or another.
+	replayedUntil int64
+	// puts are the spans of the put records of each hardware, by hour, in
+	// the order they were appended.
+	puts            map[string]map[int64][]fileStoreRecordSpan
+	removals        map[string][]*fileStoreRemoval
+	registered      map[string]bool
+	registryVersion int
+}
+
+// fileStoreRecordSpan is where a record is in the log.
+type fileStoreRecordSpan struct {
+	offset int64
+	length int
+}
+
+// fileStoreRemoval is a remove record and where it is in the log, which
+// takes away only values put before it.
+type fileStoreRemoval struct {
+	offset int64
+	metric string
+	from   int64
+	to     int64
+}
+
+// fileStoreIndexWidth is the width, in milliseconds, of the hours put
+// records are indexed by.
+const fileStoreIndexWidth = int64(time.Hour / time.Millisecond)
+
+// fileStoreHourOf is the hour a timestamp falls in, counted from the epoch.
+func fileStoreHourOf(timestamp int64) int64 {
+	hour := timestamp / fileStoreIndexWidth
+	if timestamp%fileStoreIndexWidth < 0 {
+		hour--
+	}
+	return hour
+}
+
+const (
+	fileStoreOperationPut      = "put"
+	fileStoreOperationRemove   = "remove"
+	fileStoreOperationRegister = "register"
+	fileStoreOperationRegistry = "registry"
+)
+
+// fileStoreRecord is one line of the log: the values of a reading, values of
+// a metric removed over a range, a hardware registered, or the registry
+// version the samples were loaded under.
+type fileStoreRecord struct {
+	Operation  string             `json:"op"`
+	HardwareId string             `json:"hardwareId,omitempty"`
+	Timestamp  int64              `json:"timestamp,omitempty"`
+	Values     map[string]float64 `json:"values,omitempty"`
+	Metric     string             `json:"metric,omitempty"`
+	From       int64              `json:"from,omitempty"`
+	To         int64              `json:"to,omitempty"`
+	Version    int                `json:"version,omitempty"`
+}
+
+// NewFileStore opens the sample log at path, creating it and its directory
+// if need be, and reads through it once to find the records of each
+// hardware.
+func NewFileStore(path string) (Store, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf(`unable to create sample log directory: %w`, err)
+	}
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, fmt.Errorf(`unable to open sample log: %w`, err)
+	}
+
+	store := &fileStore{file: file, puts: make(map[string]map[int64][]fileStoreRecordSpan), removals: make(map[string][]*fileStoreRemoval), registered: make(map[string]bool)}
+	if err := store.catchUp(); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return store, nil
+}
+
+// catchUp reads the records appended since the log was last read. A last
+// line without its newline is still being appended and is left for the next
+// time. The caller holds the store mutex.
+func (store *fileStore) catchUp() error {
+	info, err := store.file.Stat()
+	if err != nil {
+		return fmt.Errorf(`unable to read sample log: %w`, err)
+	}
+	if info.Size() <= store.replayedUntil {
+		return nil
+	}
+
+	reader := bufio.NewReader(io.NewSectionReader(store.file, store.replayedUntil, info.Size()-store.replayedUntil))
+	for {
+		line, err := reader.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf(`unable to read sample log: %w`, err)
+		}
+
+		span := fileStoreRecordSpan{offset: store.replayedUntil, length: len(line)}
+		var record fileStoreRecord
+		if err := json.Unmarshal(line, &record); err != nil {
+			return fmt.Errorf(`unable to parse sample log record at byte %d: %w`, span.offset, err)
+		}
+		switch record.Operation {
+		case fileStoreOperationPut:
+			hours, hasHours := store.puts[record.HardwareId]
+			if !hasHours {
+				hours = make(map[int64][]fileStoreRecordSpan)
+				store.puts[record.HardwareId] = hours
+			}
+			hour := fileStoreHourOf(record.Timestamp)
+			hours[hour] = append(hours[hour], span)
+		case fileStoreOperationRemove:
+			store.removals[record.HardwareId] = append(store.removals[record.HardwareId], &fileStoreRemoval{offset: span.offset, metric: record.Metric, from: record.From, to: record.To})
+		case fileStoreOperationRegister:
+			store.registered[record.HardwareId] = true
+		case fileStoreOperationRegistry:
+			if record.Version > store.registryVersion {
+				store.registryVersion = record.Version
+			}
+		default:
+			return fmt.Errorf(`unknown operation "%s" in sample log record at byte %d`, record.Operation, span.offset)
+		}
+		store.replayedUntil += int64(len(line))
+	}
+}
+
+// append writes records to the end of the log in one write, syncs it and
+// reads them back in, with whatever other processes appended before them.
+// The caller holds the store mutex.
+func (store *fileStore) append(records []*fileStoreRecord) error {
+	var buffer bytes.Buffer
+	encoder := json.NewEncoder(&buffer)
+	for _, record := range records {
+		if err := encoder.Encode(record); err != nil {
+			return err
+		}
+	}
+	if buffer.Len() == 0 {
+		return nil
+	}
+	if _, err := store.file.Write(buffer.Bytes()); err != nil {
+		return fmt.Errorf(`unable to append to sample log: %w`, err)
+	}
+	if err := store.file.Sync(); err != nil {
+		return fmt.Errorf(`unable to sync sample log: %w`, err)
+	}
+	return store.catchUp()
+}
+
+func (store *fileStore) ListHardware() ([]string, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	if err := store.catchUp(); err != nil {
+		return nil, err
+	}
+	hasRecords := make(map[string]bool, len(store.puts))
+	for hardwareId := range store.puts {
+		hasRecords[hardwareId] = true
+	}
+	for hardwareId := range store.removals {
+		hasRecords[hardwareId] = true
+	}
+	for hardwareId := range store.registered {
+		hasRecords[hardwareId] = true
+	}
+	hardwareIds := make([]string, 0, len(hasRecords))
+	for hardwareId := range hasRecords {
+		hardwareIds = append(hardwareIds, hardwareId)
+	}
+	sort.Strings(hardwareIds)
+	return hardwareIds, nil
+}
+
+func (store *fileStore) Register(hardwareId string) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	if store.registered[hardwareId] {
+		return nil
+	}
+	return store.append([]*fileStoreRecord{{Operation: fileStoreOperationRegister, HardwareId: hardwareId}})
+}
+
+// LoadRange replays the records of a hardware in the range in the order they
+// were appended, so a removal only takes away the values put before it. Only
+// the put records of the hours the range covers are read from the log.
+// Values are migrated from the channel they were stored under as they are
+// read.
+func (store *fileStore) LoadRange(hardwareId string, from time.Time, to time.Time) ([]*Sample, error) {
+	fromTimestamp, toTimestamp := from.UnixMilli(), to.UnixMilli()
+
+	store.mutex.Lock()
+	if err := store.catchUp(); err != nil {
+		store.mutex.Unlock()
+		return nil, err
+	}
+	spans := make([]fileStoreRecordSpan, 0)
+	hours := store.puts[hardwareId]
+	firstHour, lastHour := fileStoreHourOf(fromTimestamp), fileStoreHourOf(toTimestamp)
+	if lastHour-firstHour < int64(len(hours)) {
+		for hour := firstHour; hour <= lastHour; hour++ {
+			spans = append(spans, hours[hour]...)
+		}
+	} else {
+		// A range wider than the hours held is quicker to filter them by
+		for hour, hourSpans := range hours {
+			if hour >= firstHour && hour <= lastHour {
+				spans = append(spans, hourSpans...)
+			}
+		}
+	}
+	removals := make([]*fileStoreRemoval, 0)
+	for _, removal := range store.removals[hardwareId] {
+		if removal.from <= toTimestamp && removal.to >= fromTimestamp {
+			removals = append(removals, removal)
+		}
+	}
+	store.mutex.Unlock()
+	sort.Slice(spans, func(leftIndex, rightIndex int) bool { return spans[leftIndex].offset < spans[rightIndex].offset })
+
+	valuesByTimestamp := make(map[int64]map[string]float64)
+	remove := func(removal *fileStoreRemoval) {
+		for timestamp, values := range valuesByTimestamp {
+			if timestamp >= removal.from && timestamp <= removal.to {
+				delete(values, removal.metric)
+			}
+		}
+	}
+	for _, span := range spans {
+		for len(removals) > 0 && removals[0].offset < span.offset {
+			remove(removals[0])
+			removals = removals[1:]
+		}
+
+		line := make([]byte, span.length)
+		if _, err := store.file.ReadAt(line, span.offset); err != nil {
+			return nil, fmt.Errorf(`unable to read sample log record at byte %d: %w`, span.offset, err)
+		}
+		var record fileStoreRecord
+		if err := json.Unmarshal(line, &record); err != nil {
+			return nil, fmt.Errorf(`unable to parse sample log record at byte %d: %w`, span.offset, err)
+		}
+		if record.Timestamp < fromTimestamp || record.Timestamp > toTimestamp {
+			continue
+		}
+		values, hasValues := valuesByTimestamp[record.Timestamp]
+		if !hasValues {
+			values = make(map[string]float64)
+			valuesByTimestamp[record.Timestamp] = values
+		}
+		for channel, value := range record.Values {
+			for _, metric := range storedMetrics(channel) {
+				values[metric] = migrateStoredValue(metric, record.Timestamp, value)
+			}
+		}
+	}
+	for _, removal := range removals {
+		remove(removal)
+	}
+
+	samples := make([]*Sample, 0, len(valuesByTimestamp))
+	for timestamp, values := range valuesByTimestamp {
+		if len(values) == 0 {
+			continue
+		}
+		sample := &Sample{Time: time.UnixMilli(timestamp)}
+		for metric, value := range values {
+			value := value
+			sample.SetValueByMetric(metric, &value)
+		}
+		samples = append(samples, sample)
+	}
+	sort.Slice(samples, func(leftIndex, rightIndex int) bool { return samples[leftIndex].Time.Before(samples[rightIndex].Time) })
+	return samples, nil
+}
+
+func (store *fileStore) Put(readings []*Reading) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	records := make([]*fileStoreRecord, 0, len(readings))
+	for _, reading := range readings {
+		if len(reading.Values) == 0 {
+			continue
+		}
+		records = append(records, &fileStoreRecord{Operation: fileStoreOperationPut, HardwareId: reading.HardwareId, Timestamp: reading.Time.UnixMilli(), Values: reading.Values})
+	}
+	return store.append(records)
+}
+
+func (store *fileStore) Remove(hardwareId string, metric string, from time.Time, to time.Time) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	return store.append([]*fileStoreRecord{{Operation: fileStoreOperationRemove, HardwareId: hardwareId, Metric: metric, From: from.UnixMilli(), To: to.UnixMilli()}})
+}
+
+func (store *fileStore) RegistryVersion() (int, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	if err := store.catchUp(); err != nil {
+		return 0, err
+	}
+	return store.registryVersion, nil
+}
+
+func (store *fileStore) SetRegistryVersion(version int) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	return store.append([]*fileStoreRecord{{Operation: fileStoreOperationRegistry, Version: version}})
+}
+
+func (store *fileStore) Close() error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	return store.file.Close()
+}
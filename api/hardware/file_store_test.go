@@ -0,0 +1,103 @@
+package hardware_test
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/hardware"
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/internal/fixtures"
+)
+
+func TestFileStore(t *testing.T) {
+	logPath := filepath.Join(t.TempDir(), "samples.log")
+	store, err := hardware.NewFileStore(logPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	replica, err := hardware.NewFileStore(logPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer replica.Close()
+
+	readings := []*hardware.Reading{
+		{HardwareId: fixtures.HardwareId, Time: fixtures.Minute(0), Values: map[string]float64{"temperature": 20, "rms_velocity": 1.5}},
+		{HardwareId: fixtures.HardwareId, Time: fixtures.Minute(1), Values: map[string]float64{"temperature": 21, "rms_velocity": 1.5}},
+	}
+	if err := store.Put(readings); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Remove(fixtures.HardwareId, "temperature", fixtures.Minute(1), fixtures.Minute(1)); err != nil {
+		t.Fatal(err)
+	}
+	if err := replica.Put([]*hardware.Reading{{HardwareId: fixtures.HardwareId, Time: fixtures.Minute(1), Values: map[string]float64{"temperature": 25}}}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Each sees what the other appended, removals only taking away what came before
+	samples, err := store.LoadRange(fixtures.HardwareId, fixtures.Minute(0), fixtures.Minute(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(samples) != 2 {
+		t.Fatalf(`expected 2 samples from the log, got %d`, len(samples))
+	}
+	if temperature, _ := samples[1].ValueByMetric("temperature"); temperature == nil || *temperature != 25 {
+		t.Errorf(`expected the replica's temperature of 25 after the removal, got %v`, temperature)
+	}
+	if hardwareIds, err := replica.ListHardware(); err != nil || len(hardwareIds) != 1 || hardwareIds[0] != fixtures.HardwareId {
+		t.Errorf(`expected the replica to list %s, got %v (%v)`, fixtures.HardwareId, hardwareIds, err)
+	}
+
+	reopened, err := hardware.NewFileStore(logPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reopened.Close()
+	if reopenedSamples, err := reopened.LoadRange(fixtures.HardwareId, fixtures.Minute(0), fixtures.Minute(1)); err != nil || len(reopenedSamples) != 2 {
+		t.Errorf(`expected 2 samples after reopening the log, got %d (%v)`, len(reopenedSamples), err)
+	}
+}
+
+func TestFileStoreRanges(t *testing.T) {
+	store, err := hardware.NewFileStore(filepath.Join(t.TempDir(), "samples.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	// A reading every 20 minutes over two days, put out of order
+	readings := make([]*hardware.Reading, 0)
+	for minutes := 48 * 60; minutes >= 0; minutes -= 20 {
+		readings = append(readings, &hardware.Reading{HardwareId: fixtures.HardwareId, Time: fixtures.Minute(float64(minutes)), Values: map[string]float64{"temperature": float64(minutes)}})
+	}
+	if err := store.Put(readings); err != nil {
+		t.Fatal(err)
+	}
+	// Removed across an hour boundary, then put again in part
+	if err := store.Remove(fixtures.HardwareId, "temperature", fixtures.Minute(50), fixtures.Minute(70)); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Put([]*hardware.Reading{{HardwareId: fixtures.HardwareId, Time: fixtures.Minute(60), Values: map[string]float64{"temperature": -1}}}); err != nil {
+		t.Fatal(err)
+	}
+
+	samples, err := store.LoadRange(fixtures.HardwareId, fixtures.Minute(40), fixtures.Minute(100))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []float64{40, -1, 80, 100}
+	if len(samples) != len(expected) {
+		t.Fatalf(`expected %d samples between minutes 40 and 100, got %d`, len(expected), len(samples))
+	}
+	for sampleIndex, sample := range samples {
+		if temperature, _ := sample.ValueByMetric("temperature"); temperature == nil || *temperature != expected[sampleIndex] {
+			t.Errorf(`expected temperature %g at %s, got %v`, expected[sampleIndex], sample.Time, temperature)
+		}
+	}
+	if all, err := store.LoadRange(fixtures.HardwareId, time.UnixMilli(0), time.UnixMilli(1<<62)); err != nil || len(all) != 48*3+1 {
+		t.Errorf(`expected every sample over the widest range, got %d (%v)`, len(all), err)
+	}
+}
@@ -0,0 +1,110 @@
+package hardware
+
+import (
+	"math"
+	"strings"
+	"unicode"
+
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/metrics"
+)
+
+// latestGaugePrefix starts the name of every gauge of a latest reading.
+const latestGaugePrefix = "kcf_"
+
+var (
+	loadedSampleCounter    = metrics.NewCounter("hardware_samples_loaded_total")
+	ingestedReadingCounter = metrics.NewCounter("hardware_readings_ingested_total")
+)
+
+func init() {
+	metrics.NewGaugeFunc("hardware_samples", func() float64 { return float64(SampleCount()) })
+}
+
+// latestGauge exports the newest value of one metric of one hardware.
+type latestGauge struct {
+	gauge     *metrics.Gauge
+	timestamp int64
+}
+
+// latestGauges are keyed by hardware, then indexed by column.
+var latestGauges = make(map[string][]*latestGauge)
+
+// latestGaugeName names the gauge of a metric after its key in snake case,
+// with a trailing axis moved to a label, so rmsVelocityX of hardware "fan" is
+// kcf_rms_velocity{hardware="fan",axis="x"}.
+func latestGaugeName(hardwareId string, columnIndex int) string {
+	metric := columns[columnIndex].metric
+	labels := []string{"hardware", hardwareId}
+	if metricLength := len(metric); metricLength > 1 && strings.ContainsRune("XYZ", rune(metric[metricLength-1])) && unicode.IsLower(rune(metric[metricLength-2])) {
+		labels = append(labels, "axis", strings.ToLower(metric[metricLength-1:]))
+		metric = metric[:metricLength-1]
+	}
+
+	var family strings.Builder
+	family.WriteString(latestGaugePrefix)
+	for characterIndex, character := range metric {
+		if unicode.IsUpper(character) && characterIndex > 0 && !unicode.IsUpper(rune(metric[characterIndex-1])) {
+			family.WriteRune('_')
+		}
+		family.WriteRune(unicode.ToLower(character))
+	}
+	return family.String() + metrics.Labels(labels...)
+}
+
+// observeLatest moves the gauges of a hardware to the values of a sample
+// newer than those they hold. The store must be locked.
+func observeLatest(hardwareId string, sample *Sample) {
+	if sample = withoutTombstoned(hardwareId, sample); sample == nil {
+		return
+	}
+	hardwareGauges, hasGauges := latestGauges[hardwareId]
+	if !hasGauges {
+		hardwareGauges = make([]*latestGauge, len(columns))
+		latestGauges[hardwareId] = hardwareGauges
+	}
+
+	timestamp := sample.Time.UnixMilli()
+	for columnIndex, value := range sample.values {
+		if value == nil {
+			continue
+		}
+		latest := hardwareGauges[columnIndex]
+		if latest == nil {
+			latest = &latestGauge{gauge: metrics.NewGauge(latestGaugeName(hardwareId, columnIndex)), timestamp: math.MinInt64}
+			hardwareGauges[columnIndex] = latest
+		}
+		if timestamp >= latest.timestamp {
+			latest.timestamp = timestamp
+			latest.gauge.Set(*value)
+		}
+	}
+}
+
+// republishLatest works the gauges of a hardware out again from its samples,
+// after some may have been removed. The store must be locked.
+func republishLatest(hardwareId string) {
+	if hardwareGauges, hasGauges := latestGauges[hardwareId]; hasGauges {
+		gaugeNames := make(map[string]bool, len(hardwareGauges))
+		for columnIndex, latest := range hardwareGauges {
+			if latest != nil {
+				gaugeNames[latestGaugeName(hardwareId, columnIndex)] = true
+			}
+		}
+		metrics.RemoveGauges(func(name string) bool { return gaugeNames[name] })
+		delete(latestGauges, hardwareId)
+	}
+	for _, sample := range hardware[hardwareId] {
+		observeLatest(hardwareId, sample)
+	}
+}
+
+// republishAllLatest replaces every gauge of a latest reading, after the
+// store was loaded. The store must be locked.
+func republishAllLatest() {
+	metrics.RemoveGauges(func(name string) bool { return strings.HasPrefix(name, latestGaugePrefix) })
+	latestGauges = make(map[string][]*latestGauge)
+	for hardwareId, samples := range hardware {
+		loadedSampleCounter.Add(int64(len(samples)))
+		republishLatest(hardwareId)
+	}
+}
@@ -1,53 +1,114 @@
+// Package hardware is the sample store: it loads the per-hardware CSV sample
+// tree, accepts new readings, and answers range, count and interpolation
+// queries through lazily built per-hardware indexes.
 package hardware
 
 import (
-	"encoding/csv"
 	"fmt"
 	"io"
 	"io/fs"
+	"log"
 	"math"
 	"os"
 	"path/filepath"
-	"reflect"
 	"sort"
-	"strconv"
+	"sync"
 	"time"
-	"unsafe"
+
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/config"
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/csvparse"
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/metrics"
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/statistics"
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/timeseries"
 )
 
+// Sample holds what one hardware reported at one instant: a value, or nil,
+// for each metric of the registry, config.Metrics.
 type Sample struct {
-	Time              time.Time `json:"-"`
-	Temperature       *float64  `file:"temperature.csv" json:"temperature"`
-	PeakVelocityX     *float64  `file:"peak_velocity_x.csv" json:"peakVelocityX"`
-	RMSVelocityX      *float64  `file:"rms_velocity_x.csv" json:"rmsVelocityX"`
-	PeakAccelerationX *float64  `file:"peak_acceleration_x.csv" json:"peakAccelerationX"`
-	RMSAccelerationX  *float64  `file:"rms_acceleration_x.csv" json:"rmsAccelerationX"`
-	PeakVelocityY     *float64  `file:"peak_velocity_y.csv" json:"peakVelocityY"`
-	RMSVelocityY      *float64  `file:"rms_velocity_y.csv" json:"rmsVelocityY"`
-	PeakAccelerationY *float64  `file:"peak_acceleration_y.csv" json:"peakAccelerationY"`
-	RMSAccelerationY  *float64  `file:"rms_acceleration_y.csv" json:"rmsAccelerationY"`
+	Time   time.Time
+	values []*float64
 }
 
-func (sample *Sample) SetValueByDataFile(targetFileName string, value interface{}) bool {
-	sampleType := reflect.TypeOf(sample).Elem()
-	sampleValue := reflect.ValueOf(sample).Elem()
+func (sample *Sample) SetValueByDataFile(targetFileName string, value *float64) bool {
+	columnIndex, hasColumn := columnsByDataFile[targetFileName]
+	if hasColumn {
+		sample.setValue(columnIndex, value)
+	}
+	return hasColumn
+}
 
-	for fieldIndex := 0; fieldIndex < sampleType.NumField(); fieldIndex++ {
-		if fileName, hasFileTag := sampleType.Field(fieldIndex).Tag.Lookup("file"); hasFileTag && fileName == targetFileName {
-			sampleValue.Field(fieldIndex).Set(reflect.ValueOf(value))
-			return true
+func (sample *Sample) ValueByMetric(targetMetric string) (*float64, bool) {
+	columnIndex, hasColumn := columnsByMetric[targetMetric]
+	if !hasColumn {
+		return nil, false
+	}
+	return sample.valueOf(columnIndex), true
+}
+
+// Rounded copies the sample with every value rounded to the display precision
+// configured for its metric; metrics without one are left as they are.
+func (sample *Sample) Rounded() *Sample {
+	roundedSample := &Sample{Time: sample.Time}
+	for columnIndex, column := range columns {
+		value := sample.valueOf(columnIndex)
+		if value == nil {
+			continue
+		}
+
+		rounded := *value
+		if decimals, hasPrecision := config.Current.PrecisionOf(column.metric); hasPrecision {
+			scale := math.Pow(10, float64(decimals))
+			rounded = math.Round(rounded*scale) / scale
 		}
+		roundedSample.setValue(columnIndex, &rounded)
 	}
-	return false
+	return roundedSample
+}
+
+func Metrics() []string {
+	metrics := make([]string, 0, len(columns))
+	for _, column := range columns {
+		metrics = append(metrics, column.metric)
+	}
+	return metrics
+}
+
+func IsMetric(metric string) bool {
+	_, isMetric := columnsByMetric[metric]
+	return isMetric
+}
+
+// NameOf returns the label the registry gives a metric.
+func NameOf(metric string) (string, bool) {
+	columnIndex, hasColumn := columnsByMetric[metric]
+	if !hasColumn {
+		return "", false
+	}
+	return columns[columnIndex].name, true
 }
 
 var (
-	hardware    map[string]map[int64]*Sample
-	samplesPath string       = filepath.Join("api", "hardware", "samples")
-	sampleType  reflect.Type = reflect.TypeOf((*Sample)(nil)).Elem()
+	// storeMutex guards the working set, hardware, and what is kept alongside
+	// it. Queries hold it for reading; loading, ingestion, expiry and refreshes
+	// hold it for writing. Samples are replaced rather than changed once in
+	// the working set, so queries may hand them out after unlocking.
+	storeMutex sync.RWMutex
+	hardware   map[string]map[int64]*Sample
+	revision   int64
+
+	unavailableMetrics map[string]map[string]string
+
+	interpolationCounter            = metrics.NewCounter("hardware_interpolations_total")
+	rawScanCounter                  = metrics.NewCounter("hardware_raw_scans_total")
+	bracketCounter                  = metrics.NewCounter("hardware_brackets_total")
+	bracketSearchStepCounter        = metrics.NewCounter("hardware_bracket_search_steps_total")
+	samplesPath              string = filepath.Join("api", "hardware", "samples")
 )
 
 func SampleCount() int {
+	storeMutex.RLock()
+	defer storeMutex.RUnlock()
+
 	var count int
 	for hardwareId := range hardware {
 		count += len(hardware[hardwareId])
@@ -55,145 +116,407 @@ func SampleCount() int {
 	return count
 }
 
-func PopulateSamples() {
+func Revision() int64 {
+	storeMutex.RLock()
+	defer storeMutex.RUnlock()
+
+	return revision
+}
+
+func UnavailableMetrics(hardwareId string) map[string]string {
+	storeMutex.RLock()
+	defer storeMutex.RUnlock()
+
+	if _, hasUnavailableMetrics := unavailableMetrics[hardwareId]; !hasUnavailableMetrics {
+		return nil
+	}
+	metricReasons := make(map[string]string, len(unavailableMetrics[hardwareId]))
+	for metric, reason := range unavailableMetrics[hardwareId] {
+		metricReasons[metric] = reason
+	}
+	return metricReasons
+}
+
+func markUnavailable(hardwareId string, sampleDataName string, reason error) {
+	if _, hasUnavailableMetrics := unavailableMetrics[hardwareId]; !hasUnavailableMetrics {
+		unavailableMetrics[hardwareId] = make(map[string]string)
+	}
+
+	metric := sampleDataName
+	if columnIndex, hasColumn := columnsByDataFile[sampleDataName]; hasColumn {
+		metric = columns[columnIndex].metric
+	}
+	unavailableMetrics[hardwareId][metric] = reason.Error()
+
+	log.Printf("hardware %s: channel %s unavailable: %v", hardwareId, metric, reason)
+}
+
+func readSampleDataFile(sampleFilePath string) ([]int64, []float64, error) {
+	// Open data sampleDataFile and prepare for CSV reading
+	sampleDataFile, openErr := os.Open(sampleFilePath)
+	if openErr != nil {
+		return nil, nil, fmt.Errorf(`unable to open file %s: %w`, sampleFilePath, openErr)
+	}
+	defer sampleDataFile.Close()
+	sampleDataReader, parserErr := csvparse.NewReader(sampleDataFile, csvparse.Options{})
+	if parserErr != nil {
+		return nil, nil, parserErr
+	}
+
+	// Read each CSV row into memory
+	sampleTimestamps := make([]int64, 0)
+	sampleDataValues := make([]float64, 0)
+	for {
+		sampleData, readErr := sampleDataReader.Read()
+		if readErr != nil {
+			if readErr == io.EOF {
+				break
+			} else {
+				return nil, nil, fmt.Errorf(`unable to read hardware data file "%s": %w`, sampleFilePath, readErr)
+			}
+		}
+		if len(sampleData) < 2 {
+			return nil, nil, fmt.Errorf(`line %d of hardware data file "%s" has no value`, sampleDataReader.Line(), sampleFilePath)
+		}
+
+		if timestamp, convertErr := sampleDataReader.ParseTimestamp(sampleData[0]); convertErr == nil {
+			sampleTimestamps = append(sampleTimestamps, timestamp.UnixMilli())
+		} else {
+			return nil, nil, fmt.Errorf(`cannot convert timestamp "%s" in hardware data file "%s": %w`, sampleData[0], sampleFilePath, convertErr)
+		}
+
+		if value, convertErr := sampleDataReader.ParseNumber(sampleData[1]); convertErr == nil {
+			sampleDataValues = append(sampleDataValues, value)
+		} else {
+			return nil, nil, fmt.Errorf(`cannot convert value in hardware data file "%s": %w`, sampleFilePath, convertErr)
+		}
+	}
+	return sampleTimestamps, sampleDataValues, nil
+}
+
+func PopulateSamples() error {
+	return PopulateSamplesFrom(samplesPath)
+}
+
+func PopulateSamplesFrom(sampleTreePath string) error {
+	storeMutex.Lock()
+	defer storeMutex.Unlock()
+
+	useRegistry(config.Current.Metrics)
+	useMigrations()
 	hardware = make(map[string]map[int64]*Sample)
+	unavailableMetrics = make(map[string]map[string]string)
+	invalidateIndexes()
+	invalidateAllRollups()
+	latestTimestamps = make(map[string]int64)
+	wideSampleFiles = make(map[string][]string)
+	outOfOrderSamples = make(map[string]int64)
+	memoryHorizons = make(map[string]int64)
+	resetJournal(time.Now())
+	revision++
+
+	loadedSamplesPath = sampleTreePath
+	if err := loadTombstones(); err != nil {
+		return err
+	}
+	if err := loadLocks(); err != nil {
+		return err
+	}
+	if err := loadOrderings(); err != nil {
+		return err
+	}
+	if err := loadProfiles(); err != nil {
+		return err
+	}
+	if err := checkRegistryVersion(); err != nil {
+		return err
+	}
+
+	if backend != nil {
+		if err := populateFromBackend(sampleTreePath); err != nil {
+			return err
+		}
+	} else if err := populateFromSampleTree(sampleTreePath); err != nil {
+		return err
+	}
+
+	for hardwareId, samples := range hardware {
+		if len(samples) > 0 {
+			continue
+		}
+		switch config.Current.Loading.EmptyHardware {
+		case config.EmptyHardwareIgnore:
+			delete(hardware, hardwareId)
+		default:
+			log.Printf("hardware \"%s\" is registered but has no data\n", hardwareId)
+		}
+	}
+
+	republishAllLatest()
+	expireSamples(time.Now())
+	prewarmIndexes()
+	return nil
+}
+
+func populateFromSampleTree(sampleTreePath string) error {
+	if sampleWalkErr := filepath.WalkDir(sampleTreePath, func(sampleFilePath string, directoryEntry fs.DirEntry, pathErr error) error {
+		if pathErr != nil {
+			return pathErr
+		}
+
+		// Hardware directories are registered even before any file is read,
+		// so one without a single parsable row still shows up as such
+		if directoryEntry.IsDir() && filepath.Dir(filepath.Clean(sampleFilePath)) == filepath.Clean(sampleTreePath) {
+			if _, hardwareExists := hardware[directoryEntry.Name()]; !hardwareExists {
+				hardware[directoryEntry.Name()] = make(map[int64]*Sample)
+			}
+		}
 
-	if sampleWalkErr := filepath.WalkDir(samplesPath, func(sampleFilePath string, directoryEntry fs.DirEntry, pathErr error) error {
 		if !directoryEntry.IsDir() {
-			samplePath, sampleDataName := filepath.Split(sampleFilePath)
+			samplePath, fileName := filepath.Split(sampleFilePath)
 			hardwareId := filepath.Base(samplePath)
+			sampleDataName, fileUnit := sourceUnit(hardwareId, fileName)
 
-			// Open data sampleDataFile and prepare for CSV reading
-			sampleDataFile, openErr := os.Open(sampleFilePath)
-			if openErr != nil {
-				return fmt.Errorf(`unable to open file %s: %w`, sampleFilePath, openErr)
+			_, hardwareExists := hardware[hardwareId]
+			if !hardwareExists {
+				hardware[hardwareId] = make(map[int64]*Sample)
 			}
-			defer sampleDataFile.Close()
-			sampleDataReader := csv.NewReader(sampleDataFile)
-
-			// Read each CSV row into memory
-			for {
-				sampleData, readErr := sampleDataReader.Read()
-				if readErr != nil {
-					if readErr == io.EOF {
-						break
-					} else {
-						return fmt.Errorf(`unable to read hardware data file "%s": %w`, sampleFilePath, readErr)
-					}
-				}
 
-				var sampleTimestamp int64
-				if timestamp, convertErr := strconv.ParseInt(sampleData[0], 10, 64); convertErr == nil {
-					sampleTimestamp = timestamp
-				} else {
-					return fmt.Errorf(`cannot convert timestamp "%s" in hardware data file "%s": %w`, sampleData[0], sampleFilePath, convertErr)
-				}
-
-				var sampleDataValue float64
-				if value, convertErr := strconv.ParseFloat(sampleData[1], 64); convertErr == nil {
-					sampleDataValue = value
-				} else {
-					return fmt.Errorf(`cannot convert value "%s" in hardware data file "%s": %w`, sampleData[1], sampleFilePath, convertErr)
+			// Files no metric registers, nor did before a migration, may be
+			// anything, so they are left alone unless their header shows them to
+			// be wide, a column per channel
+			var metricKeys []string
+			if columnIndex, hasColumn := columnsByDataFile[sampleDataName]; hasColumn {
+				metricKeys = []string{columns[columnIndex].metric}
+			} else if metricKeys = migratedChannels[sampleDataName]; len(metricKeys) == 0 {
+				if isWideSampleFile(sampleFilePath) {
+					loadWideSampleFile(hardwareId, sampleFilePath)
+					return nil
 				}
+				log.Printf("hardware %s: skipping %s, which no registered metric reads", hardwareId, sampleFilePath)
+				return nil
+			}
 
-				_, hardwareExists := hardware[hardwareId]
-				if !hardwareExists {
-					hardware[hardwareId] = make(map[int64]*Sample)
-				}
+			// A corrupt file only takes its own channel down, never the whole hardware
+			sampleTimestamps, sampleDataValues, readErr := readSampleDataFile(sampleFilePath)
+			if readErr != nil {
+				markUnavailable(hardwareId, sampleDataName, readErr)
+				return nil
+			}
+			if convertErr := convertToMetricUnit(sampleDataName, fileUnit, sampleDataValues); convertErr != nil {
+				markUnavailable(hardwareId, sampleDataName, fmt.Errorf(`hardware data file "%s": %w`, sampleFilePath, convertErr))
+				return nil
+			}
 
+			offsetMilliseconds := clockOffset(hardwareId).Milliseconds()
+			for sampleIndex, sampleTimestamp := range sampleTimestamps {
+				sampleTimestamp += offsetMilliseconds
 				sample, sampleExists := hardware[hardwareId][sampleTimestamp]
 				if !sampleExists {
-					sample = &Sample{}
-					sample.Time = time.UnixMilli(sampleTimestamp)
+					sample = &Sample{Time: time.UnixMilli(sampleTimestamp)}
 					hardware[hardwareId][sampleTimestamp] = sample
 				}
+				if sampleTimestamp > latestTimestamps[hardwareId] {
+					latestTimestamps[hardwareId] = sampleTimestamp
+				}
 
-				success := sample.SetValueByDataFile(sampleDataName, &sampleDataValue)
-				if !success {
-					return fmt.Errorf(`hardware schema does not support file "%s"`, sampleFilePath)
+				// Files whose unit is known were converted already
+				storedValue := sampleDataValues[sampleIndex]
+				for metricIndex, metricKey := range metricKeys {
+					value := &sampleDataValues[sampleIndex]
+					if metricIndex > 0 {
+						value = new(float64)
+					}
+					*value = storedValue
+					if fileUnit == "" {
+						*value = migrateStoredValue(metricKey, sampleTimestamp, storedValue)
+					}
+					sample.SetValueByMetric(metricKey, value)
 				}
 			}
 		}
 		return nil
 	}); sampleWalkErr != nil {
-		panic(fmt.Errorf(`unable to populate hardware data: %w`, sampleWalkErr))
+		return fmt.Errorf(`unable to populate hardware data: %w`, sampleWalkErr)
+	}
+	return nil
+}
+
+func HardwareIds() []string {
+	storeMutex.RLock()
+	defer storeMutex.RUnlock()
+
+	hardwareIds := make([]string, 0, len(hardware))
+	for hardwareId := range hardware {
+		hardwareIds = append(hardwareIds, hardwareId)
 	}
+	return hardwareIds
 }
 
 func HasSamples(hardwareId string) bool {
+	storeMutex.RLock()
+	defer storeMutex.RUnlock()
+
+	return hasSamples(hardwareId)
+}
+
+func hasSamples(hardwareId string) bool {
 	_, hasHardware := hardware[hardwareId]
 	return hasHardware
 }
 
-func InterpolateSample(hardwareId string, at time.Time) (*Sample, error) {
-	if !HasSamples(hardwareId) {
-		return nil, fmt.Errorf(`no hardware data for "%s"`, hardwareId)
+// HasData reports whether a registered hardware has at least one sample.
+func HasData(hardwareId string) bool {
+	storeMutex.RLock()
+	defer storeMutex.RUnlock()
+
+	return len(hardware[hardwareId]) > 0
+}
+
+func HardwareWithoutData() []string {
+	storeMutex.RLock()
+	defer storeMutex.RUnlock()
+
+	hardwareIds := make([]string, 0)
+	for hardwareId, samples := range hardware {
+		if len(samples) == 0 {
+			hardwareIds = append(hardwareIds, hardwareId)
+		}
+	}
+	sort.Strings(hardwareIds)
+	return hardwareIds
+}
+
+func SamplesBetween(hardwareId string, from time.Time, to time.Time) ([]*Sample, error) {
+	if err := ensureLoaded(hardwareId, from); err != nil {
+		return nil, err
 	}
+	storeMutex.RLock()
+	defer storeMutex.RUnlock()
 
-	sampleCount := len(hardware[hardwareId])
+	if !hasSamples(hardwareId) {
+		return nil, unknownHardwareError(hardwareId)
+	}
 
-	atTimestamp := at.UnixMilli()
+	fromTimestamp, toTimestamp := from.UnixMilli(), to.UnixMilli()
+	rawScanCounter.Inc()
 
-	timestamps := make([]int64, 0, sampleCount)
-	for timestamp := range hardware[hardwareId] {
-		timestamps = append(timestamps, timestamp)
+	// The index already has the timestamps in order, so a range is two
+	// binary searches away
+	timestamps := indexOf(hardwareId).timestamps
+	firstIndex := sort.Search(len(timestamps), func(timestampIndex int) bool { return timestamps[timestampIndex] >= fromTimestamp })
+	lastIndex := sort.Search(len(timestamps), func(timestampIndex int) bool { return timestamps[timestampIndex] > toTimestamp })
+	if lastIndex < firstIndex {
+		lastIndex = firstIndex
 	}
-	sort.Slice(timestamps, func(leftIndex, rightIndex int) bool { return timestamps[leftIndex] < timestamps[rightIndex] })
 
-	var averageInterval int64
-	{
-		var sumOfIntervals float64
-		for index := 0; index < sampleCount-1; index++ {
-			sumOfIntervals += float64(timestamps[index+1]) - float64(timestamps[index])
+	samples := make([]*Sample, 0, lastIndex-firstIndex)
+	checkTombstones := hasTombstones(hardwareId)
+	for _, timestamp := range timestamps[firstIndex:lastIndex] {
+		sample := hardware[hardwareId][timestamp]
+		if checkTombstones {
+			if sample = withoutTombstoned(hardwareId, sample); sample == nil {
+				continue
+			}
 		}
-		averageInterval = int64(sumOfIntervals / float64(sampleCount))
+		samples = append(samples, sample)
+	}
+	return samples, nil
+}
+
+// InterpolateSample estimates every metric of a hardware at an instant with
+// linear interpolation.
+func InterpolateSample(hardwareId string, at time.Time) (*Sample, error) {
+	linearInterpolator, _ := timeseries.InterpolatorFor(timeseries.MethodLinear)
+	return InterpolateSampleWith(hardwareId, at, linearInterpolator)
+}
+
+// InterpolateSampleWith estimates every metric of a hardware at an instant
+// with interpolator, from the samples of that metric around it.
+func InterpolateSampleWith(hardwareId string, at time.Time, interpolator timeseries.Interpolator) (*Sample, error) {
+	if err := ensureLoaded(hardwareId, at.Add(-backendLoadMargin)); err != nil {
+		return nil, err
+	}
+	storeMutex.RLock()
+	defer storeMutex.RUnlock()
+
+	return interpolateSample(hardwareId, at, interpolator, nil)
+}
+
+// InterpolateSampleWithConfidence is InterpolateSampleWith that also scores,
+// per metric it estimates, how far to trust the value: 1 when a sample falls
+// on the instant or its bracketing samples are at most the nominal interval
+// of the metric apart, shrinking in proportion as the gap between them grows.
+func InterpolateSampleWithConfidence(hardwareId string, at time.Time, interpolator timeseries.Interpolator) (*Sample, map[string]float64, error) {
+	if err := ensureLoaded(hardwareId, at.Add(-backendLoadMargin)); err != nil {
+		return nil, nil, err
+	}
+	storeMutex.RLock()
+	defer storeMutex.RUnlock()
+
+	confidences := make(map[string]float64)
+	interpolatedSample, err := interpolateSample(hardwareId, at, interpolator, confidences)
+	if err != nil {
+		return nil, nil, err
+	}
+	return interpolatedSample, confidences, nil
+}
+
+// interpolateSample fills confidences, unless nil, with the confidence of
+// every value it estimates.
+func interpolateSample(hardwareId string, at time.Time, interpolator timeseries.Interpolator, confidences map[string]float64) (*Sample, error) {
+	if !hasSamples(hardwareId) {
+		return nil, unknownHardwareError(hardwareId)
+	}
+	return interpolateIndex(indexOf(hardwareId), hardwareId, at, interpolator, confidences)
+}
+
+// interpolateIndex is interpolateSample over an index that is not
+// necessarily the one of the working set.
+func interpolateIndex(index *sampleIndex, hardwareId string, at time.Time, interpolator timeseries.Interpolator, confidences map[string]float64) (*Sample, error) {
+	interpolationCounter.Inc()
+	timestamps := index.timestamps
+	sampleCount := len(timestamps)
+	averageInterval := index.averageInterval
+
+	atTimestamp := at.UnixMilli()
+
+	if sampleCount == 0 {
+		return nil, fmt.Errorf(`%w for hardware "%s"`, ErrNoData, hardwareId)
 	}
 	if atTimestamp < timestamps[0]+averageInterval || atTimestamp > timestamps[sampleCount-1]-averageInterval {
-		return nil, fmt.Errorf(`no interpolable hardware samples within timestamp %s`, at)
-	}
-
-	atSampleIndex := sort.Search(sampleCount, func(index int) bool { return timestamps[index] >= atTimestamp })
-
-	interpolatedSample := reflect.New(sampleType)
-	interpolatedSample.Elem().FieldByName("Time").Set(reflect.ValueOf(at))
-
-	for fieldIndex := 0; fieldIndex < sampleType.NumField(); fieldIndex++ {
-		if _, hasFileTag := sampleType.Field(fieldIndex).Tag.Lookup("file"); hasFileTag {
-			var leftSample reflect.Value
-			var leftTimestamp int64
-			{
-				leftSampleIndex := atSampleIndex
-				for {
-					leftTimestamp = timestamps[leftSampleIndex]
-					leftSample = reflect.ValueOf(hardware[hardwareId][leftTimestamp]).Elem()
-					leftSampleIndex--
-					if !leftSample.Field(fieldIndex).IsNil() || leftSampleIndex <= 0 {
-						break
-					}
-				}
-			}
+		return nil, fmt.Errorf(`%w: no hardware samples around %s`, ErrOutOfRange, at)
+	}
 
-			var rightSample reflect.Value
-			var rightTimestamp int64
-			{
-				rightSampleIndex := atSampleIndex
-				for {
-					rightTimestamp = timestamps[rightSampleIndex]
-					rightSample = reflect.ValueOf(hardware[hardwareId][rightTimestamp]).Elem()
-					rightSampleIndex++
-					if !rightSample.Field(fieldIndex).IsNil() || rightSampleIndex >= sampleCount-1 {
-						break
-					}
-				}
-			}
+	// Never bridge outages longer than the configured number of nominal intervals
+	maxLookback := config.Current.Interpolation.MaxLookbackIntervals * float64(averageInterval)
+	maxLookahead := config.Current.Interpolation.MaxLookaheadIntervals * float64(averageInterval)
+
+	interpolatedSample := &Sample{Time: at}
+	for columnIndex := range index.columns {
+		column := &index.columns[columnIndex]
+		// Bracket only among samples that have this metric, so sparse channels
+		// are a binary search rather than a walk over empty samples
+		bracket, searchSteps, isBracketed := timeseries.Locate(column, atTimestamp)
+		bracketCounter.Inc()
+		bracketSearchStepCounter.Add(searchSteps)
+		if !isBracketed {
+			continue
+		}
+
+		leftTimestamp := column.timestamps[bracket.Left]
+		rightTimestamp := column.timestamps[bracket.Right]
+		if maxLookback > 0 && float64(atTimestamp-leftTimestamp) > maxLookback {
+			continue
+		}
+		if maxLookahead > 0 && float64(rightTimestamp-atTimestamp) > maxLookahead {
+			continue
+		}
 
-			leftSampleValue := leftSample.Field(fieldIndex).Elem().Float()
-			rightSampleValue := rightSample.Field(fieldIndex).Elem().Float()
-			timestampInterval := float64(atTimestamp) / (float64(leftTimestamp) + float64(rightTimestamp))
-			interval := 0.5 * (1.0 - math.Cos(math.Pi*timestampInterval))
-			atSampleValue := leftSampleValue*(1.0-interval) + rightSampleValue*interval
-			interpolatedSample.Elem().Field(fieldIndex).Set(reflect.ValueOf(&atSampleValue))
+		interpolatedSample.setValue(columnIndex, statistics.Finite(timeseries.Interpolate(column, bracket, atTimestamp, interpolator)))
+		if confidences != nil && interpolatedSample.valueOf(columnIndex) != nil {
+			confidences[columns[columnIndex].metric] = timeseries.Confidence(column, bracket)
 		}
 	}
-	return (*Sample)(unsafe.Pointer(interpolatedSample.Pointer())), nil
+	return interpolatedSample, nil
 }
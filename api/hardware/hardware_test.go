@@ -0,0 +1,129 @@
+package hardware_test
+
+import (
+	"errors"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/config"
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/hardware"
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/timeseries"
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/internal/fixtures"
+)
+
+func TestMain(m *testing.M) {
+	fixtures.Main(m.Run)
+}
+
+func TestInterpolateSample(t *testing.T) {
+	for _, method := range timeseries.Methods() {
+		interpolator, err := timeseries.InterpolatorFor(method)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, minutes := range []float64{30, 30.5, 42.25} {
+			sample, err := hardware.InterpolateSampleWith(fixtures.HardwareId, fixtures.Minute(minutes), interpolator)
+			if err != nil {
+				t.Fatal(err)
+			}
+			temperature, _ := sample.ValueByMetric("temperature")
+			rmsVelocityX, _ := sample.ValueByMetric("rmsVelocityX")
+			if temperature == nil || rmsVelocityX == nil {
+				t.Errorf(`missing %s interpolated values at minute %g`, method, minutes)
+				continue
+			}
+			// Between samples, any interpolation method must stay within the bracket
+			if minutes == math.Trunc(minutes) {
+				if math.Abs(*temperature-(20+minutes)) > 1e-6 {
+					t.Errorf(`%s temperature at minute %g is %g, not %g`, method, minutes, *temperature, 20+minutes)
+				}
+			} else if *temperature < 20+math.Floor(minutes) || *temperature > 20+math.Ceil(minutes) {
+				t.Errorf(`%s temperature at minute %g is %g, outside its bracketing samples`, method, minutes, *temperature)
+			}
+			if math.Abs(*rmsVelocityX-1.5) > 1e-6 {
+				t.Errorf(`%s RMS velocity at minute %g is %g, not 1.5`, method, minutes, *rmsVelocityX)
+			}
+		}
+	}
+}
+
+// downStore is a storage backend that is down, counting the reads tried.
+type downStore struct {
+	hardware.Store
+	reads int
+}
+
+func (store *downStore) LoadRange(hardwareId string, from time.Time, to time.Time) ([]*hardware.Sample, error) {
+	store.reads++
+	return nil, errors.New(`connection refused`)
+}
+
+func TestStorageBreaker(t *testing.T) {
+	previousStorage := config.Current.Storage
+	defer func() { config.Current.Storage = previousStorage }()
+	config.Current.Storage.Breaker.FailureThreshold = 2
+	config.Current.Storage.Breaker.OpenFor = config.Duration{Duration: time.Hour}
+
+	store := &downStore{Store: hardware.NewMemoryStore()}
+	if err := hardware.UseStore(store); err != nil {
+		t.Fatal(err)
+	}
+	defer hardware.UseStore(nil)
+	for attempt := 0; attempt < 4; attempt++ {
+		if err := hardware.Refresh(fixtures.HardwareId, fixtures.Start, fixtures.Minute(60)); !errors.Is(err, hardware.ErrStoreUnavailable) {
+			t.Fatalf(`attempt %d: expected the store to be unavailable, got %v`, attempt, err)
+		}
+	}
+	if store.reads != 2 || hardware.StoreStatus().State != hardware.BreakerOpen {
+		t.Errorf(`expected the breaker to open after 2 reads, got %d reads and %+v`, store.reads, hardware.StoreStatus())
+	}
+}
+
+func TestSnapshotAt(t *testing.T) {
+	// Backfills the last minutes only, which the other tests do not look at
+	asOf := time.Now()
+	if err := hardware.AddSamples([]*hardware.Reading{
+		{HardwareId: fixtures.HardwareId, Time: fixtures.Minute(55), Values: map[string]float64{"temperature": 500}},
+		{HardwareId: fixtures.HardwareId, Time: fixtures.Minute(55.5), Values: map[string]float64{"temperature": 500}},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	snapshot, err := hardware.SnapshotAt(fixtures.HardwareId, asOf, fixtures.Minute(45))
+	if err != nil {
+		t.Fatal(err)
+	}
+	linearInterpolator, _ := timeseries.InterpolatorFor(timeseries.MethodLinear)
+	sample, err := snapshot.InterpolateSampleWith(fixtures.Minute(55), linearInterpolator)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if temperature, _ := sample.ValueByMetric("temperature"); temperature == nil || math.Abs(*temperature-75) > 1e-6 {
+		t.Errorf(`expected a temperature of 75 as of before the backfill, got %v`, temperature)
+	}
+	if rawCount, _ := snapshot.CountRawSamples(fixtures.Minute(55), fixtures.Minute(56)); rawCount != 1 {
+		t.Errorf(`expected the snapshot to leave out the backfilled sample, got %d samples`, rawCount)
+	}
+
+	if _, err := hardware.SnapshotAt(fixtures.HardwareId, hardware.JournalFloor().Add(-time.Second), fixtures.Minute(45)); !errors.Is(err, hardware.ErrSnapshotUnavailable) {
+		t.Errorf(`expected a snapshot before the journal to be unavailable, got %v`, err)
+	}
+}
+
+func BenchmarkInterpolateSample(b *testing.B) {
+	interpolator, _ := timeseries.InterpolatorFor(timeseries.MethodLinear)
+	for iteration := 0; iteration < b.N; iteration++ {
+		if _, err := hardware.InterpolateSampleWith(fixtures.HardwareId, fixtures.Minute(float64(iteration%56)+1.5), interpolator); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkSamplesBetween(b *testing.B) {
+	for iteration := 0; iteration < b.N; iteration++ {
+		if _, err := hardware.SamplesBetween(fixtures.HardwareId, fixtures.Minute(10), fixtures.Minute(40)); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,331 @@
+package hardware
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/metrics"
+)
+
+type sampleIndex struct {
+	timestamps      []int64
+	averageInterval int64
+
+	// columns holds, per column, the timestamps where that metric actually
+	// has a value alongside the values themselves, so queries never go back
+	// to the samples.
+	columns []metricColumn
+}
+
+type metricColumn struct {
+	timestamps []int64
+	values     []float64
+}
+
+// metricColumn is a timeseries.Series, for interpolation.
+func (column *metricColumn) Len() int {
+	return len(column.timestamps)
+}
+
+func (column *metricColumn) Time(index int) int64 {
+	return column.timestamps[index]
+}
+
+func (column *metricColumn) Value(index int) float64 {
+	return column.values[index]
+}
+
+type lazySampleIndex struct {
+	once  sync.Once
+	index *sampleIndex
+}
+
+type IndexStats struct {
+	HardwareId         string `json:"hardwareId"`
+	Samples            int    `json:"samples"`
+	Indexed            bool   `json:"indexed"`
+	OutOfOrderSamples  int64  `json:"outOfOrderSamples"`
+	Tombstones         int    `json:"tombstones"`
+	UnavailableMetrics int    `json:"unavailableMetrics"`
+}
+
+var (
+	// Samples ingested behind a hardware's newest timestamp since the last
+	// compaction; each one forces a full re-sort on the next index build.
+	latestTimestamps  map[string]int64
+	outOfOrderSamples map[string]int64
+
+	indexHitCounter   = metrics.NewCounter("hardware_index_hits_total")
+	indexBuildCounter = metrics.NewCounter("hardware_index_builds_total")
+
+	indexExtensionCounter = metrics.NewCounter("hardware_index_extensions_total")
+
+	indexesMutex sync.Mutex
+	indexes      map[string]*lazySampleIndex = make(map[string]*lazySampleIndex)
+)
+
+func buildSampleIndex(hardwareId string, samples map[int64]*Sample) *sampleIndex {
+	return buildSampleIndexOf(hardwareId, samples, hasTombstones(hardwareId))
+}
+
+// buildSampleIndexOf indexes samples, leaving tombstoned values out only when
+// checkTombstones is set.
+func buildSampleIndexOf(hardwareId string, samples map[int64]*Sample, checkTombstones bool) *sampleIndex {
+	index := &sampleIndex{timestamps: make([]int64, 0, len(samples))}
+
+	for timestamp := range samples {
+		index.timestamps = append(index.timestamps, timestamp)
+	}
+	sort.Slice(index.timestamps, func(leftIndex, rightIndex int) bool {
+		return index.timestamps[leftIndex] < index.timestamps[rightIndex]
+	})
+
+	index.columns = make([]metricColumn, len(columns))
+	for _, timestamp := range index.timestamps {
+		index.addValues(hardwareId, samples[timestamp], checkTombstones)
+	}
+	index.updateAverageInterval()
+	return index
+}
+
+// addValues appends the values of a sample newer than any indexed to the
+// columns, leaving out tombstoned ones.
+func (index *sampleIndex) addValues(hardwareId string, sample *Sample, checkTombstones bool) {
+	timestamp := sample.Time.UnixMilli()
+	for columnIndex, column := range columns {
+		value := sample.valueOf(columnIndex)
+		if value == nil || checkTombstones && isTombstoned(hardwareId, column.metric, timestamp) {
+			continue
+		}
+		index.columns[columnIndex].timestamps = append(index.columns[columnIndex].timestamps, timestamp)
+		index.columns[columnIndex].values = append(index.columns[columnIndex].values, *value)
+	}
+}
+
+func (index *sampleIndex) updateAverageInterval() {
+	if sampleCount := len(index.timestamps); sampleCount > 0 {
+		index.averageInterval = int64(float64(index.timestamps[sampleCount-1]-index.timestamps[0]) / float64(sampleCount))
+	}
+}
+
+func indexOf(hardwareId string) *sampleIndex {
+	indexesMutex.Lock()
+	lazyIndex, hasIndex := indexes[hardwareId]
+	if !hasIndex {
+		lazyIndex = &lazySampleIndex{}
+		indexes[hardwareId] = lazyIndex
+	}
+	samples := hardware[hardwareId]
+	indexesMutex.Unlock()
+
+	indexHitCounter.Inc()
+	lazyIndex.once.Do(func() {
+		indexHitCounter.Add(-1)
+		indexBuildCounter.Inc()
+		index := buildSampleIndex(hardwareId, samples)
+
+		// Published under the lock so IndexStatistics can peek without building
+		indexesMutex.Lock()
+		lazyIndex.index = index
+		indexesMutex.Unlock()
+	})
+	return lazyIndex.index
+}
+
+// extendIndex appends samples, in time order and all newer than what a built
+// index holds, to that index, so readings ingested in order do not cost a
+// rebuild. It reports whether it could; if not, the index must be
+// invalidated instead. The caller holds storeMutex for writing, so no query
+// is using the index meanwhile.
+func extendIndex(hardwareId string, samples []*Sample) bool {
+	indexesMutex.Lock()
+	defer indexesMutex.Unlock()
+
+	lazyIndex, hasIndex := indexes[hardwareId]
+	if !hasIndex || lazyIndex.index == nil {
+		return false
+	}
+	index := lazyIndex.index
+	latestTimestamp := int64(math.MinInt64)
+	if sampleCount := len(index.timestamps); sampleCount > 0 {
+		latestTimestamp = index.timestamps[sampleCount-1]
+	}
+	for _, sample := range samples {
+		if sample.Time.UnixMilli() <= latestTimestamp {
+			return false
+		}
+		latestTimestamp = sample.Time.UnixMilli()
+	}
+
+	checkTombstones := hasTombstones(hardwareId)
+	for _, sample := range samples {
+		index.timestamps = append(index.timestamps, sample.Time.UnixMilli())
+		index.addValues(hardwareId, sample, checkTombstones)
+	}
+	index.updateAverageInterval()
+	indexExtensionCounter.Inc()
+	return true
+}
+
+func invalidateIndex(hardwareId string) {
+	indexesMutex.Lock()
+	defer indexesMutex.Unlock()
+
+	delete(indexes, hardwareId)
+}
+
+func invalidateIndexes() {
+	indexesMutex.Lock()
+	defer indexesMutex.Unlock()
+
+	indexes = make(map[string]*lazySampleIndex)
+}
+
+// prewarmIndexes builds every hardware's index in the background, so the first
+// request for a hardware does not pay for it.
+func prewarmIndexes() {
+	for hardwareId := range hardware {
+		go func(hardwareId string) {
+			storeMutex.RLock()
+			defer storeMutex.RUnlock()
+
+			if _, hardwareExists := hardware[hardwareId]; hardwareExists {
+				indexOf(hardwareId)
+			}
+		}(hardwareId)
+	}
+}
+
+// CountSamples returns how many raw values each metric has within the window,
+// without touching the samples themselves.
+func CountSamples(hardwareId string, from time.Time, to time.Time) (map[string]int, error) {
+	if err := ensureLoaded(hardwareId, from); err != nil {
+		return nil, err
+	}
+	storeMutex.RLock()
+	defer storeMutex.RUnlock()
+
+	if !hasSamples(hardwareId) {
+		return nil, unknownHardwareError(hardwareId)
+	}
+
+	fromTimestamp, toTimestamp := from.UnixMilli(), to.UnixMilli()
+	index := indexOf(hardwareId)
+
+	counts := make(map[string]int)
+	for columnIndex, column := range index.columns {
+		metricTimestamps := column.timestamps
+		firstIndex := sort.Search(len(metricTimestamps), func(timestampIndex int) bool { return metricTimestamps[timestampIndex] >= fromTimestamp })
+		lastIndex := sort.Search(len(metricTimestamps), func(timestampIndex int) bool { return metricTimestamps[timestampIndex] > toTimestamp })
+		counts[columns[columnIndex].metric] = lastIndex - firstIndex
+	}
+	return counts, nil
+}
+
+// CountRawSamples counts the distinct sample timestamps from from up to, but
+// excluding, to, leaving out those SamplesBetween leaves out for tombstones.
+func CountRawSamples(hardwareId string, from time.Time, to time.Time) (int, error) {
+	if err := ensureLoaded(hardwareId, from); err != nil {
+		return 0, err
+	}
+	storeMutex.RLock()
+	defer storeMutex.RUnlock()
+
+	if !hasSamples(hardwareId) {
+		return 0, unknownHardwareError(hardwareId)
+	}
+
+	fromTimestamp, toTimestamp := from.UnixMilli(), to.UnixMilli()
+	timestamps := indexOf(hardwareId).timestamps
+	firstIndex := sort.Search(len(timestamps), func(timestampIndex int) bool { return timestamps[timestampIndex] >= fromTimestamp })
+	lastIndex := sort.Search(len(timestamps), func(timestampIndex int) bool { return timestamps[timestampIndex] >= toTimestamp })
+	if lastIndex < firstIndex || !hasTombstones(hardwareId) {
+		return lastIndex - firstIndex, nil
+	}
+
+	var count int
+	for _, timestamp := range timestamps[firstIndex:lastIndex] {
+		if withoutTombstoned(hardwareId, hardware[hardwareId][timestamp]) != nil {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// AverageInterval is the mean time between the samples of a hardware, the
+// unit interpolation measures how far it may reach in.
+func AverageInterval(hardwareId string) (time.Duration, error) {
+	storeMutex.RLock()
+	defer storeMutex.RUnlock()
+
+	if !hasSamples(hardwareId) {
+		return 0, unknownHardwareError(hardwareId)
+	}
+	return time.Duration(indexOf(hardwareId).averageInterval) * time.Millisecond, nil
+}
+
+type LatestValue struct {
+	Time  time.Time `json:"time"`
+	Value float64   `json:"value"`
+}
+
+func LatestValues(hardwareId string) (map[string]*LatestValue, error) {
+	storeMutex.RLock()
+	defer storeMutex.RUnlock()
+
+	if !hasSamples(hardwareId) {
+		return nil, unknownHardwareError(hardwareId)
+	}
+
+	index := indexOf(hardwareId)
+	latestValues := make(map[string]*LatestValue)
+	for columnIndex, column := range index.columns {
+		if len(column.timestamps) == 0 {
+			continue
+		}
+		latestValues[columns[columnIndex].metric] = &LatestValue{
+			Time:  time.UnixMilli(column.timestamps[len(column.timestamps)-1]),
+			Value: column.values[len(column.values)-1],
+		}
+	}
+	return latestValues, nil
+}
+
+func IndexStatistics() []*IndexStats {
+	tombstoneCounts := make(map[string]int)
+	for _, tombstone := range Tombstones() {
+		tombstoneCounts[tombstone.HardwareId]++
+	}
+
+	storeMutex.RLock()
+	defer storeMutex.RUnlock()
+	indexesMutex.Lock()
+	defer indexesMutex.Unlock()
+
+	allStatistics := make([]*IndexStats, 0, len(hardware))
+	for hardwareId, samples := range hardware {
+		lazyIndex, hasIndex := indexes[hardwareId]
+		allStatistics = append(allStatistics, &IndexStats{
+			HardwareId:         hardwareId,
+			Samples:            len(samples),
+			Indexed:            hasIndex && lazyIndex.index != nil,
+			OutOfOrderSamples:  outOfOrderSamples[hardwareId],
+			Tombstones:         tombstoneCounts[hardwareId],
+			UnavailableMetrics: len(unavailableMetrics[hardwareId]),
+		})
+	}
+	sort.Slice(allStatistics, func(leftIndex, rightIndex int) bool {
+		return allStatistics[leftIndex].HardwareId < allStatistics[rightIndex].HardwareId
+	})
+	return allStatistics
+}
+
+func rebuildIndexes() {
+	invalidateIndexes()
+	for hardwareId := range hardware {
+		indexOf(hardwareId)
+	}
+	outOfOrderSamples = make(map[string]int64)
+}
@@ -0,0 +1,163 @@
+package hardware
+
+import (
+	"fmt"
+	"time"
+)
+
+// Reading is a set of metric values, keyed like the JSON of Sample, that one
+// hardware reported at one point in time.
+type Reading struct {
+	HardwareId string             `json:"hardwareId"`
+	Time       time.Time          `json:"time"`
+	Values     map[string]float64 `json:"values"`
+}
+
+func (sample *Sample) SetValueByMetric(targetMetric string, value *float64) bool {
+	columnIndex, hasColumn := columnsByMetric[targetMetric]
+	if hasColumn {
+		sample.setValue(columnIndex, value)
+	}
+	return hasColumn
+}
+
+func AddSample(reading *Reading) error {
+	return AddSamples([]*Reading{reading})
+}
+
+// AddSamples merges readings into the in-memory store. Every reading is
+// checked before any is applied, so a bad batch, or one reaching into a
+// lock, changes nothing.
+func AddSamples(readings []*Reading) error {
+	return addSamples(readings, false)
+}
+
+// AddAndPersistSamples is AddSamples that also appends the readings to the
+// sample files. They are written before they are merged, so readings that
+// could not be persisted are never served.
+func AddAndPersistSamples(readings []*Reading) error {
+	return addSamples(readings, true)
+}
+
+// ValidateReading checks a reading the way AddSamples does before taking a
+// batch, so callers ingesting in batches can reject bad readings one by one
+// instead of failing a whole batch over them.
+func ValidateReading(reading *Reading) error {
+	if reading.HardwareId == "" {
+		return fmt.Errorf(`reading at %s has no hardware`, reading.Time)
+	}
+	if err := ValidateHardwareId(reading.HardwareId); err != nil {
+		return err
+	}
+	for metric := range reading.Values {
+		if !IsMetric(metric) {
+			return fmt.Errorf(`%w "%s"`, ErrUnknownMetric, metric)
+		}
+	}
+	return nil
+}
+
+func addSamples(readings []*Reading, persist bool) error {
+	for _, reading := range readings {
+		if err := ValidateReading(reading); err != nil {
+			return err
+		}
+	}
+	ingestingMutex.RLock()
+	defer ingestingMutex.RUnlock()
+	if err := checkUnlocked(readings); err != nil {
+		return err
+	}
+
+	if backend != nil {
+		if err := backend.Put(readings); err != nil {
+			return fmt.Errorf(`unable to store readings: %w`, err)
+		}
+	}
+	if persist {
+		if err := PersistReadings(readings); err != nil {
+			return err
+		}
+	}
+
+	storeMutex.Lock()
+	if hardware == nil {
+		hardware = make(map[string]map[int64]*Sample)
+	}
+	if latestTimestamps == nil {
+		latestTimestamps = make(map[string]int64)
+		outOfOrderSamples = make(map[string]int64)
+	}
+
+	// The span of time each hardware's readings cover, as first and last timestamp
+	now := time.Now()
+	touchedSpans := make(map[string][2]int64)
+	touchedSamples := make(map[string][]*Sample)
+	isTouched := make(map[*Sample]bool)
+	for _, reading := range readings {
+		if _, hardwareExists := hardware[reading.HardwareId]; !hardwareExists {
+			hardware[reading.HardwareId] = make(map[int64]*Sample)
+		}
+
+		timestamp := reading.Time.UnixMilli()
+		if timestamp < latestTimestamps[reading.HardwareId] {
+			outOfOrderSamples[reading.HardwareId]++
+		} else {
+			latestTimestamps[reading.HardwareId] = timestamp
+		}
+
+		// Copied rather than changed in place, as queries may still hold it
+		sample, sampleExists := hardware[reading.HardwareId][timestamp]
+		if !sampleExists {
+			sample = &Sample{Time: time.UnixMilli(timestamp)}
+			hardware[reading.HardwareId][timestamp] = sample
+		} else if !isTouched[sample] {
+			sample = sample.clone()
+			hardware[reading.HardwareId][timestamp] = sample
+		}
+
+		for metric, value := range reading.Values {
+			value := value
+			previousValue, _ := sample.ValueByMetric(metric)
+			sample.SetValueByMetric(metric, &value)
+			journalChange(valueChange{at: now, hardwareId: reading.HardwareId, timestamp: timestamp, columnIndex: columnsByMetric[metric], previous: previousValue})
+			if !isTombstoned(reading.HardwareId, metric, timestamp) {
+				// Past the memory horizon, the stored value it may replace is not at hand
+				horizon, hasHorizon := memoryHorizons[reading.HardwareId]
+				updateRollups(reading.HardwareId, metric, timestamp, value, previousValue != nil || (hasHorizon && timestamp < horizon))
+			}
+		}
+		if !isTouched[sample] {
+			isTouched[sample] = true
+			touchedSamples[reading.HardwareId] = append(touchedSamples[reading.HardwareId], sample)
+		}
+		if span, hasSpan := touchedSpans[reading.HardwareId]; !hasSpan {
+			touchedSpans[reading.HardwareId] = [2]int64{timestamp, timestamp}
+		} else if timestamp < span[0] {
+			touchedSpans[reading.HardwareId] = [2]int64{timestamp, span[1]}
+		} else if timestamp > span[1] {
+			touchedSpans[reading.HardwareId] = [2]int64{span[0], timestamp}
+		}
+	}
+
+	for hardwareId := range touchedSpans {
+		if !extendIndex(hardwareId, touchedSamples[hardwareId]) {
+			invalidateIndex(hardwareId)
+		}
+		for _, sample := range touchedSamples[hardwareId] {
+			observeLatest(hardwareId, sample)
+		}
+	}
+	ingestedReadingCounter.Add(int64(len(readings)))
+	if len(touchedSpans) > 0 {
+		revision++
+	}
+	for hardwareId := range touchedSpans {
+		broadcast(hardwareId, touchedSamples[hardwareId])
+	}
+	storeMutex.Unlock()
+
+	expireSamplesIfDue()
+	notifyChanges(touchedSpans)
+	return nil
+}
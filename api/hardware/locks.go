@@ -0,0 +1,211 @@
+package hardware
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/fieldcrypt"
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/metrics"
+)
+
+// Lock keeps a time range of a hardware as it was when a report citing it
+// was published: readings falling in it are refused, and so are tombstones
+// reaching into it. Locks are never lifted. Values tombstoned before the lock
+// were already hidden from the report, so compacting them changes nothing it
+// cited.
+type Lock struct {
+	Id         int64     `json:"id"`
+	HardwareId string    `json:"hardwareId"`
+	From       time.Time `json:"from"`
+	To         time.Time `json:"to"`
+	Report     string    `json:"report,omitempty"`
+	Reason     string    `json:"reason,omitempty"`
+	LockedBy   string    `json:"lockedBy,omitempty"`
+	CreatedAt  time.Time `json:"createdAt"`
+
+	// Refusals counts the readings refused for falling in the lock, the last
+	// of them at LastRefusedAt.
+	Refusals      int64      `json:"refusals"`
+	LastRefusedAt *time.Time `json:"lastRefusedAt,omitempty"`
+}
+
+var (
+	locksMutex sync.RWMutex
+	locks      []*Lock = make([]*Lock, 0)
+	nextLockId int64   = 1
+
+	// ingestingMutex is held for reading by writers from checking a batch or
+	// a tombstone against the locks until it is applied, and for writing
+	// while a lock is added, so nothing checked before a lock lands in it
+	// after.
+	ingestingMutex sync.RWMutex
+
+	lockedReadingCounter = metrics.NewCounter("hardware_locked_readings_refused_total")
+)
+
+func locksPath() string {
+	return filepath.Join(filepath.Dir(filepath.Clean(loadedSamplesPath)), "locks.json")
+}
+
+func (lock *Lock) overlaps(hardwareId string, from int64, to int64) bool {
+	return lock.HardwareId == hardwareId && from <= lock.To.UnixMilli() && to >= lock.From.UnixMilli()
+}
+
+func lockedError(lock *Lock, hardwareId string, timestamp int64) error {
+	return fmt.Errorf(`%w: hardware "%s" at %s falls in lock %d from %s until %s`, ErrLocked, hardwareId, time.UnixMilli(timestamp).UTC().Format(time.RFC3339Nano), lock.Id, lock.From.UTC().Format(time.RFC3339), lock.To.UTC().Format(time.RFC3339))
+}
+
+// lockOverlapping returns the first lock over any of the range of a hardware
+// from from until to, in Unix milliseconds, or nil. It expects locksMutex to
+// be held.
+func lockOverlapping(hardwareId string, from int64, to int64) *Lock {
+	for _, lock := range locks {
+		if lock.overlaps(hardwareId, from, to) {
+			return lock
+		}
+	}
+	return nil
+}
+
+func Locks() []*Lock {
+	locksMutex.RLock()
+	defer locksMutex.RUnlock()
+
+	listedLocks := make([]*Lock, 0, len(locks))
+	for _, lock := range locks {
+		listedLock := *lock
+		listedLocks = append(listedLocks, &listedLock)
+	}
+	return listedLocks
+}
+
+// WithoutLocked splits the readings falling in a lock off the others, counts
+// them against their lock, and returns the others alongside why each one was
+// refused.
+func WithoutLocked(readings []*Reading) ([]*Reading, []error) {
+	locksMutex.Lock()
+	defer locksMutex.Unlock()
+
+	if len(locks) == 0 {
+		return readings, nil
+	}
+	unlockedReadings := make([]*Reading, 0, len(readings))
+	refusals := make([]error, 0)
+	for _, reading := range readings {
+		timestamp := reading.Time.UnixMilli()
+		if lock := lockOverlapping(reading.HardwareId, timestamp, timestamp); lock != nil {
+			refusedAt := time.Now()
+			lock.Refusals++
+			lock.LastRefusedAt = &refusedAt
+			refusals = append(refusals, lockedError(lock, reading.HardwareId, timestamp))
+			continue
+		}
+		unlockedReadings = append(unlockedReadings, reading)
+	}
+	if len(refusals) > 0 {
+		lockedReadingCounter.Add(int64(len(refusals)))
+		if err := saveLocks(); err != nil {
+			refusals = append(refusals, err)
+		}
+	}
+	return unlockedReadings, refusals
+}
+
+// checkUnlocked refuses readings of which any falls in a lock, for writers
+// that take or leave a batch whole. They hold ingestingMutex for reading
+// until the batch is merged.
+func checkUnlocked(readings []*Reading) error {
+	locksMutex.RLock()
+	defer locksMutex.RUnlock()
+
+	for _, reading := range readings {
+		timestamp := reading.Time.UnixMilli()
+		if lock := lockOverlapping(reading.HardwareId, timestamp, timestamp); lock != nil {
+			lockedReadingCounter.Inc()
+			return lockedError(lock, reading.HardwareId, timestamp)
+		}
+	}
+	return nil
+}
+
+func saveLocks() error {
+	persistedLocks := make([]*Lock, 0, len(locks))
+	for _, lock := range locks {
+		persistedLock := *lock
+		if err := fieldcrypt.EncryptFields("lock", &persistedLock); err != nil {
+			return fmt.Errorf(`unable to encrypt lock %d: %w`, lock.Id, err)
+		}
+		persistedLocks = append(persistedLocks, &persistedLock)
+	}
+
+	locksBytes, err := json.MarshalIndent(persistedLocks, "", "\t")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(locksPath(), locksBytes, 0644); err != nil {
+		return fmt.Errorf(`unable to save locks: %w`, err)
+	}
+	return nil
+}
+
+func loadLocks() error {
+	locksMutex.Lock()
+	defer locksMutex.Unlock()
+
+	locks = make([]*Lock, 0)
+	locksBytes, err := os.ReadFile(locksPath())
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf(`unable to load locks: %w`, err)
+	}
+
+	if err := json.Unmarshal(locksBytes, &locks); err != nil {
+		return fmt.Errorf(`unable to parse locks: %w`, err)
+	}
+	for _, lock := range locks {
+		if err := fieldcrypt.DecryptFields("lock", lock); err != nil {
+			return fmt.Errorf(`unable to decrypt lock %d: %w`, lock.Id, err)
+		}
+		if lock.Id >= nextLockId {
+			nextLockId = lock.Id + 1
+		}
+	}
+	return nil
+}
+
+// AddLock locks a time range of a hardware for good.
+func AddLock(lock *Lock) error {
+	if !HasSamples(lock.HardwareId) {
+		return unknownHardwareError(lock.HardwareId)
+	}
+	if lock.From.IsZero() || lock.To.IsZero() {
+		return fmt.Errorf(`lock needs both a from and a to`)
+	}
+	if lock.To.Before(lock.From) {
+		return fmt.Errorf(`lock ends at %s before it starts at %s`, lock.To, lock.From)
+	}
+
+	ingestingMutex.Lock()
+	defer ingestingMutex.Unlock()
+	locksMutex.Lock()
+	defer locksMutex.Unlock()
+
+	lock.Id = nextLockId
+	lock.CreatedAt = time.Now()
+	lock.Refusals, lock.LastRefusedAt = 0, nil
+	nextLockId++
+	storedLock := *lock
+	locks = append(locks, &storedLock)
+	if err := saveLocks(); err != nil {
+		locks = locks[:len(locks)-1]
+		nextLockId--
+		return err
+	}
+	return nil
+}
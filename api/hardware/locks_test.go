@@ -0,0 +1,110 @@
+package hardware_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/hardware"
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/internal/fixtures"
+)
+
+func TestLocks(t *testing.T) {
+	// Locks are never lifted, so the other tests get the fixtures back without
+	// the lock by removing its file and reloading
+	defer reloadFixtures(t)
+	defer os.Remove(filepath.Join(fixtures.Directory, "locks.json"))
+
+	for what, lock := range map[string]*hardware.Lock{
+		"a lock of unknown hardware":     {HardwareId: "unknown", From: fixtures.Minute(24), To: fixtures.Minute(26)},
+		"a lock without an end":          {HardwareId: fixtures.HardwareId, From: fixtures.Minute(24)},
+		"a lock ending before it starts": {HardwareId: fixtures.HardwareId, From: fixtures.Minute(26), To: fixtures.Minute(24)},
+	} {
+		if err := hardware.AddLock(lock); err == nil {
+			t.Errorf(`%s was added`, what)
+		}
+	}
+
+	if err := hardware.AddLock(&hardware.Lock{HardwareId: fixtures.HardwareId, From: fixtures.Minute(24), To: fixtures.Minute(26), Report: "July availability"}); err != nil {
+		t.Fatal(err)
+	}
+
+	readings := []*hardware.Reading{
+		{HardwareId: fixtures.HardwareId, Time: fixtures.Minute(23.5), Values: map[string]float64{"temperature": 43.5}},
+		{HardwareId: fixtures.HardwareId, Time: fixtures.Minute(25.5), Values: map[string]float64{"temperature": 45.5}},
+	}
+	unlockedReadings, refusals := hardware.WithoutLocked(readings)
+	if len(unlockedReadings) != 1 || unlockedReadings[0] != readings[0] || len(refusals) != 1 || !errors.Is(refusals[0], hardware.ErrLocked) {
+		t.Errorf(`expected the reading at minute 25.5 refused alone, got %v and %v`, unlockedReadings, refusals)
+	}
+	if err := hardware.AddSamples(readings); !errors.Is(err, hardware.ErrLocked) {
+		t.Errorf(`expected a batch reaching into the lock refused, got %v`, err)
+	}
+	if samples, _ := hardware.SamplesBetween(fixtures.HardwareId, fixtures.Minute(23), fixtures.Minute(24)); len(samples) != 2 {
+		t.Errorf(`expected the refused batch left out whole, got %d samples`, len(samples))
+	}
+	if err := hardware.AddTombstone(&hardware.Tombstone{HardwareId: fixtures.HardwareId, From: fixtures.Minute(26), To: fixtures.Minute(28)}); !errors.Is(err, hardware.ErrLocked) {
+		t.Errorf(`expected a tombstone reaching into the lock refused, got %v`, err)
+	}
+
+	// Locks and their refusals outlive a reload
+	if err := hardware.PopulateSamplesFrom(filepath.Join(fixtures.Directory, "samples")); err != nil {
+		t.Fatal(err)
+	}
+	locks := hardware.Locks()
+	if len(locks) != 1 || locks[0].Report != "July availability" || locks[0].Refusals != 1 || locks[0].LastRefusedAt == nil {
+		t.Errorf(`expected the lock back with its refusal, got %+v`, locks)
+	}
+}
+
+// blockingStore holds every batch put to it until released, telling when one
+// arrives.
+type blockingStore struct {
+	hardware.Store
+	putting  chan struct{}
+	released chan struct{}
+}
+
+func (store *blockingStore) Put(readings []*hardware.Reading) error {
+	store.putting <- struct{}{}
+	<-store.released
+	return store.Store.Put(readings)
+}
+
+func TestLockWhileIngesting(t *testing.T) {
+	defer reloadFixtures(t)
+	defer os.Remove(filepath.Join(fixtures.Directory, "locks.json"))
+	store := &blockingStore{Store: hardware.NewMemoryStore(), putting: make(chan struct{}), released: make(chan struct{})}
+	if err := hardware.UseStore(store); err != nil {
+		t.Fatal(err)
+	}
+	defer hardware.UseStore(nil)
+
+	// A lock is added while a batch checked against the locks is being stored
+	ingested := make(chan error)
+	go func() {
+		ingested <- hardware.AddSamples([]*hardware.Reading{{HardwareId: fixtures.HardwareId, Time: fixtures.Minute(40.5), Values: map[string]float64{"temperature": 60}}})
+	}()
+	<-store.putting
+	lockedSampleCounts := make(chan int)
+	go func() {
+		if err := hardware.AddLock(&hardware.Lock{HardwareId: fixtures.HardwareId, From: fixtures.Minute(40), To: fixtures.Minute(50)}); err != nil {
+			t.Error(err)
+		}
+		samples, _ := hardware.SamplesBetween(fixtures.HardwareId, fixtures.Minute(40), fixtures.Minute(41))
+		lockedSampleCounts <- len(samples)
+	}()
+	time.Sleep(10 * time.Millisecond)
+	close(store.released)
+	if err := <-ingested; err != nil {
+		t.Fatal(err)
+	}
+
+	// The batch is merged before the lock is in place, never after
+	lockedSampleCount := <-lockedSampleCounts
+	if samples, _ := hardware.SamplesBetween(fixtures.HardwareId, fixtures.Minute(40), fixtures.Minute(41)); len(samples) != lockedSampleCount {
+		t.Errorf(`expected the %d samples held once the lock was added kept as they were, got %d`, lockedSampleCount, len(samples))
+	}
+}
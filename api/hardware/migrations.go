@@ -0,0 +1,123 @@
+package hardware
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/config"
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/units"
+)
+
+type unitMigration struct {
+	before  int64
+	convert func(float64) float64
+}
+
+var (
+	// migratedChannels map former channels onto the metrics they migrated to
+	migratedChannels map[string][]string = make(map[string][]string)
+	// unitMigrations are keyed by metric, the earliest first
+	unitMigrations map[string][]unitMigration = make(map[string][]unitMigration)
+)
+
+// useMigrations resolves the configured registry migrations, alongside
+// useRegistry.
+func useMigrations() {
+	migratedChannels = config.Current.MigratedChannels()
+	unitMigrations = make(map[string][]unitMigration)
+	for _, configured := range config.Current.UnitMigrations() {
+		columnIndex, hasColumn := columnsByMetric[configured.Metric]
+		if !hasColumn {
+			continue
+		}
+		convert, err := units.Converter(configured.Unit, columns[columnIndex].unit)
+		if err != nil {
+			continue
+		}
+		unitMigrations[configured.Metric] = append(unitMigrations[configured.Metric], unitMigration{before: configured.Before.UnixMilli(), convert: convert})
+	}
+}
+
+// storedMetrics are the metrics values stored under a channel belong to:
+// the channel itself if registered, else those it migrated to, if any.
+func storedMetrics(channel string) []string {
+	if _, isMetric := columnsByMetric[channel]; isMetric {
+		return []string{channel}
+	}
+	return migratedChannels[channel]
+}
+
+// migrateStoredValue converts a value of a metric stamped at timestamp out of
+// the unit it was stored in then, if a migration has since changed it.
+func migrateStoredValue(metric string, timestamp int64, value float64) float64 {
+	for _, migration := range unitMigrations[metric] {
+		if timestamp < migration.before {
+			return migration.convert(value)
+		}
+	}
+	return value
+}
+
+// registryVersioned is a Store that records the registry version its data
+// was last loaded under.
+type registryVersioned interface {
+	RegistryVersion() (int, error)
+	SetRegistryVersion(version int) error
+}
+
+type registryVersionFile struct {
+	Version int `json:"version"`
+}
+
+func registryVersionPath() string {
+	return filepath.Join(filepath.Dir(filepath.Clean(loadedSamplesPath)), "registry.json")
+}
+
+// checkRegistryVersion refuses data last loaded under a newer registry,
+// whose channels the configured one may not know, and records the
+// configured version on data loaded under an older one. The data itself is
+// never rewritten; migrations apply as it is read.
+func checkRegistryVersion() error {
+	configuredVersion := config.Current.RegistryVersion()
+
+	var storedVersion int
+	versioned, isVersioned := backend.(registryVersioned)
+	if isVersioned {
+		var err error
+		if storedVersion, err = versioned.RegistryVersion(); err != nil {
+			return fmt.Errorf(`unable to read the stored registry version: %w`, err)
+		}
+	} else {
+		versionBytes, err := os.ReadFile(registryVersionPath())
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf(`unable to read the stored registry version: %w`, err)
+		} else if err == nil {
+			var versionFile registryVersionFile
+			if err := json.Unmarshal(versionBytes, &versionFile); err != nil {
+				return fmt.Errorf(`unable to parse the stored registry version: %w`, err)
+			}
+			storedVersion = versionFile.Version
+		}
+	}
+
+	if storedVersion > configuredVersion {
+		return fmt.Errorf(`samples were last loaded under channel registry version %d, newer than the configured %d`, storedVersion, configuredVersion)
+	}
+	if storedVersion == configuredVersion {
+		return nil
+	}
+	if isVersioned {
+		return versioned.SetRegistryVersion(configuredVersion)
+	}
+	versionBytes, err := json.MarshalIndent(registryVersionFile{Version: configuredVersion}, "", "\t")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(registryVersionPath(), versionBytes, 0644); err != nil {
+		return fmt.Errorf(`unable to record the registry version: %w`, err)
+	}
+	return nil
+}
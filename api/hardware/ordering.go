@@ -0,0 +1,100 @@
+package hardware
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// Ordering places a hardware in listings: pinned hardware comes first, then
+// hardware of lower Position, then hardware by ID.
+type Ordering struct {
+	Pinned   bool `json:"pinned"`
+	Position int  `json:"position"`
+}
+
+var (
+	orderingsMutex sync.RWMutex
+	// orderings are keyed by hardware, leaving out those ordered by ID alone
+	orderings = make(map[string]Ordering)
+)
+
+func orderingsPath() string {
+	return filepath.Join(filepath.Dir(filepath.Clean(loadedSamplesPath)), "ordering.json")
+}
+
+func saveOrderings() error {
+	orderingsBytes, err := json.MarshalIndent(orderings, "", "\t")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(orderingsPath(), orderingsBytes, 0644); err != nil {
+		return fmt.Errorf(`unable to save ordering: %w`, err)
+	}
+	return nil
+}
+
+func loadOrderings() error {
+	orderingsMutex.Lock()
+	defer orderingsMutex.Unlock()
+
+	orderings = make(map[string]Ordering)
+	orderingsBytes, err := os.ReadFile(orderingsPath())
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf(`unable to load ordering: %w`, err)
+	}
+
+	if err := json.Unmarshal(orderingsBytes, &orderings); err != nil {
+		return fmt.Errorf(`unable to parse ordering: %w`, err)
+	}
+	return nil
+}
+
+func OrderingOf(hardwareId string) Ordering {
+	orderingsMutex.RLock()
+	defer orderingsMutex.RUnlock()
+
+	return orderings[hardwareId]
+}
+
+// SetOrdering places a hardware in listings for every client, the zero
+// ordering putting it back among the rest by ID.
+func SetOrdering(hardwareId string, ordering Ordering) error {
+	if !HasSamples(hardwareId) {
+		return unknownHardwareError(hardwareId)
+	}
+
+	orderingsMutex.Lock()
+	defer orderingsMutex.Unlock()
+
+	if ordering == (Ordering{}) {
+		delete(orderings, hardwareId)
+	} else {
+		orderings[hardwareId] = ordering
+	}
+	return saveOrderings()
+}
+
+// SortHardwareIds puts hardware IDs in listing order.
+func SortHardwareIds(hardwareIds []string) {
+	orderingsMutex.RLock()
+	defer orderingsMutex.RUnlock()
+
+	sort.Slice(hardwareIds, func(leftIndex, rightIndex int) bool {
+		left, right := orderings[hardwareIds[leftIndex]], orderings[hardwareIds[rightIndex]]
+		switch {
+		case left.Pinned != right.Pinned:
+			return left.Pinned
+		case left.Position != right.Position:
+			return left.Position < right.Position
+		default:
+			return hardwareIds[leftIndex] < hardwareIds[rightIndex]
+		}
+	})
+}
@@ -0,0 +1,77 @@
+package hardware
+
+import (
+	"encoding/csv"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+var persistMutex sync.Mutex
+
+// PersistReadings appends readings to the sample files of the loaded sample
+// tree, so that they survive a restart. Files are created as needed; rows
+// are appended in time order per file but may precede rows already there.
+// Times are written as the hardware reported them, before clock correction.
+// Files are only ever written within the sample tree.
+func PersistReadings(readings []*Reading) error {
+	if loadedSamplesPath == "" {
+		return fmt.Errorf(`no sample tree is loaded to persist readings into`)
+	}
+	for _, reading := range readings {
+		if err := ValidateHardwareId(reading.HardwareId); err != nil {
+			return err
+		}
+	}
+
+	sortedReadings := append([]*Reading(nil), readings...)
+	sort.SliceStable(sortedReadings, func(leftIndex, rightIndex int) bool {
+		return sortedReadings[leftIndex].Time.Before(sortedReadings[rightIndex].Time)
+	})
+
+	rows := make(map[string][][]string)
+	for _, reading := range sortedReadings {
+		for metric, value := range reading.Values {
+			if columnIndex, hasColumn := columnsByMetric[metric]; hasColumn {
+				sampleFilePath := filepath.Join(loadedSamplesPath, reading.HardwareId, persistedDataName(reading.HardwareId, columnIndex))
+				if !isWithinSampleTree(sampleFilePath) {
+					return fmt.Errorf(`unable to persist readings: "%s" is outside of the sample tree`, sampleFilePath)
+				}
+				rows[sampleFilePath] = append(rows[sampleFilePath], []string{strconv.FormatInt(reportedTime(reading.HardwareId, reading.Time).UnixMilli(), 10), strconv.FormatFloat(value, 'f', -1, 64)})
+			}
+		}
+	}
+
+	persistMutex.Lock()
+	defer persistMutex.Unlock()
+
+	for sampleFilePath, fileRows := range rows {
+		if err := os.MkdirAll(filepath.Dir(sampleFilePath), 0755); err != nil {
+			return fmt.Errorf(`unable to persist readings: %w`, err)
+		}
+		sampleFile, err := os.OpenFile(sampleFilePath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return fmt.Errorf(`unable to persist readings: %w`, err)
+		}
+		sampleWriter := csv.NewWriter(sampleFile)
+		sampleWriter.WriteAll(fileRows)
+		closeErr := sampleFile.Close()
+		if err := sampleWriter.Error(); err != nil {
+			return fmt.Errorf(`unable to persist readings to "%s": %w`, sampleFilePath, err)
+		}
+		if closeErr != nil {
+			return fmt.Errorf(`unable to persist readings to "%s": %w`, sampleFilePath, closeErr)
+		}
+	}
+	return nil
+}
+
+// isWithinSampleTree reports whether a path lies inside the loaded sample tree.
+func isWithinSampleTree(path string) bool {
+	relativePath, err := filepath.Rel(filepath.Clean(loadedSamplesPath), filepath.Clean(path))
+	return err == nil && relativePath != ".." && !strings.HasPrefix(relativePath, ".."+string(filepath.Separator)) && !filepath.IsAbs(relativePath)
+}
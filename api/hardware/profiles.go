@@ -0,0 +1,255 @@
+package hardware
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/config"
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/fieldcrypt"
+)
+
+// hardwareIdPattern is what a hardware registered ahead of its data may be
+// called, as it names its directory of the sample tree.
+var hardwareIdPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]{0,127}$`)
+
+// BearingGeometry is the rolling element bearing a machine runs on, its
+// diameters in millimeters and its contact angle in degrees.
+type BearingGeometry struct {
+	Balls         int     `json:"balls"`
+	BallDiameter  float64 `json:"ballDiameter"`
+	PitchDiameter float64 `json:"pitchDiameter"`
+	ContactAngle  float64 `json:"contactAngle"`
+}
+
+// DefectOrders are the frequencies bearing defects show up at, as multiples
+// of the shaft speed: the ball pass frequencies of the outer and inner race,
+// the ball spin frequency and the fundamental train frequency.
+type DefectOrders struct {
+	BPFO float64 `json:"bpfo"`
+	BPFI float64 `json:"bpfi"`
+	BSF  float64 `json:"bsf"`
+	FTF  float64 `json:"ftf"`
+}
+
+func (geometry *BearingGeometry) Validate() error {
+	switch {
+	case geometry.Balls < 3:
+		return fmt.Errorf(`a bearing has at least 3 balls, got %d`, geometry.Balls)
+	case !(geometry.BallDiameter > 0) || !(geometry.PitchDiameter > geometry.BallDiameter):
+		return fmt.Errorf(`ball diameter must be positive and below the pitch diameter, got %g and %g`, geometry.BallDiameter, geometry.PitchDiameter)
+	case geometry.ContactAngle < 0 || geometry.ContactAngle >= 90:
+		return fmt.Errorf(`contact angle must be from 0 up to 90 degrees, got %g`, geometry.ContactAngle)
+	}
+	return nil
+}
+
+func (geometry *BearingGeometry) DefectOrders() DefectOrders {
+	ratio := geometry.BallDiameter / geometry.PitchDiameter * math.Cos(geometry.ContactAngle*math.Pi/180)
+	balls := float64(geometry.Balls)
+	return DefectOrders{
+		BPFO: balls / 2 * (1 - ratio),
+		BPFI: balls / 2 * (1 + ratio),
+		BSF:  geometry.PitchDiameter / (2 * geometry.BallDiameter) * (1 - ratio*ratio),
+		FTF:  (1 - ratio) / 2,
+	}
+}
+
+// Profile is what commissioning records of a hardware beyond its samples.
+// Its Tags add to those configured, and its Limits apply to metrics the
+// configuration sets no limits for on the hardware itself.
+type Profile struct {
+	Name     string                   `json:"name,omitempty"`
+	Location string                   `json:"location,omitempty"`
+	Metadata map[string]string        `json:"metadata,omitempty"`
+	Tags     []string                 `json:"tags,omitempty"`
+	Bearing  *BearingGeometry         `json:"bearing,omitempty"`
+	Limits   map[string]config.Limits `json:"limits,omitempty"`
+}
+
+var (
+	profilesMutex sync.RWMutex
+	profiles      = make(map[string]*Profile)
+)
+
+func profilesPath() string {
+	return filepath.Join(filepath.Dir(filepath.Clean(loadedSamplesPath)), "profiles.json")
+}
+
+func saveProfiles() error {
+	persistedProfiles := make(map[string]*Profile, len(profiles))
+	for hardwareId, profile := range profiles {
+		persistedProfile := *profile
+		if err := fieldcrypt.EncryptFields("profile", &persistedProfile); err != nil {
+			return fmt.Errorf(`unable to encrypt profile of "%s": %w`, hardwareId, err)
+		}
+		persistedProfiles[hardwareId] = &persistedProfile
+	}
+
+	profilesBytes, err := json.MarshalIndent(persistedProfiles, "", "\t")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(profilesPath(), profilesBytes, 0644); err != nil {
+		return fmt.Errorf(`unable to save profiles: %w`, err)
+	}
+	return nil
+}
+
+func loadProfiles() error {
+	profilesMutex.Lock()
+	defer profilesMutex.Unlock()
+
+	profiles = make(map[string]*Profile)
+	profilesBytes, err := os.ReadFile(profilesPath())
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf(`unable to load profiles: %w`, err)
+	}
+
+	if err := json.Unmarshal(profilesBytes, &profiles); err != nil {
+		return fmt.Errorf(`unable to parse profiles: %w`, err)
+	}
+	for hardwareId, profile := range profiles {
+		if err := fieldcrypt.DecryptFields("profile", profile); err != nil {
+			return fmt.Errorf(`unable to decrypt profile of "%s": %w`, hardwareId, err)
+		}
+	}
+	return nil
+}
+
+// ProfileOf returns the profile of a hardware, or nil when it has none.
+func ProfileOf(hardwareId string) *Profile {
+	profilesMutex.RLock()
+	defer profilesMutex.RUnlock()
+
+	return profiles[hardwareId]
+}
+
+// ValidateProfile checks a profile before it is set, so a batch of them can
+// be checked as a whole first.
+func ValidateProfile(profile *Profile) error {
+	if profile.Bearing != nil {
+		if err := profile.Bearing.Validate(); err != nil {
+			return fmt.Errorf(`bearing: %w`, err)
+		}
+	}
+	for metric, limits := range profile.Limits {
+		if !IsMetric(metric) {
+			return fmt.Errorf(`limits: %w "%s"`, ErrUnknownMetric, metric)
+		}
+		if limits.Warning != nil && limits.Critical != nil && *limits.Critical < *limits.Warning {
+			return fmt.Errorf(`limits: critical %g of %s is below its warning %g`, *limits.Critical, metric, *limits.Warning)
+		}
+	}
+	return nil
+}
+
+// SetProfile replaces the profile of a registered hardware.
+func SetProfile(hardwareId string, profile *Profile) error {
+	if !HasSamples(hardwareId) {
+		return unknownHardwareError(hardwareId)
+	}
+	if err := ValidateProfile(profile); err != nil {
+		return err
+	}
+
+	profilesMutex.Lock()
+	defer profilesMutex.Unlock()
+
+	previousProfile, hadProfile := profiles[hardwareId]
+	profiles[hardwareId] = profile
+	if err := saveProfiles(); err != nil {
+		if hadProfile {
+			profiles[hardwareId] = previousProfile
+		} else {
+			delete(profiles, hardwareId)
+		}
+		return err
+	}
+	return nil
+}
+
+// LimitsFor looks up the limits of a metric of a hardware: those configured
+// for the hardware, then those of its profile, then those configured for
+// every hardware.
+func LimitsFor(hardwareId string, metric string) (config.Limits, bool) {
+	if hardwareLimits, hasHardwareLimits := config.Current.HardwareLimits[hardwareId]; hasHardwareLimits {
+		if limits, hasLimits := hardwareLimits[metric]; hasLimits {
+			return limits, true
+		}
+	}
+	if profile := ProfileOf(hardwareId); profile != nil {
+		if limits, hasLimits := profile.Limits[metric]; hasLimits {
+			return limits, true
+		}
+	}
+	return config.Current.LimitsFor(hardwareId, metric)
+}
+
+// TagsOf lists the tags of a hardware, configured or from its profile.
+func TagsOf(hardwareId string) []string {
+	tags := append([]string(nil), config.Current.Tags[hardwareId]...)
+	if profile := ProfileOf(hardwareId); profile != nil {
+		for _, tag := range profile.Tags {
+			isTagged := false
+			for _, existingTag := range tags {
+				isTagged = isTagged || existingTag == tag
+			}
+			if !isTagged {
+				tags = append(tags, tag)
+			}
+		}
+	}
+	return tags
+}
+
+// registrar is a store that can hold a hardware before it has samples.
+type registrar interface {
+	Register(hardwareId string) error
+}
+
+// ValidateHardwareId checks that a hardware may be registered under an ID.
+func ValidateHardwareId(hardwareId string) error {
+	if !hardwareIdPattern.MatchString(hardwareId) {
+		return fmt.Errorf(`hardware id "%s" must be letters, digits, "_", "." or "-", starting with a letter or digit`, hardwareId)
+	}
+	return nil
+}
+
+// Register makes a hardware known ahead of its first reading: it gets its
+// directory in the sample tree, a row in the store when the store keeps
+// them, and shows up empty until readings arrive. It reports whether the
+// hardware is new.
+func Register(hardwareId string) (bool, error) {
+	if err := ValidateHardwareId(hardwareId); err != nil {
+		return false, err
+	}
+	if loadedSamplesPath == "" {
+		return false, fmt.Errorf(`no sample tree is loaded to register hardware into`)
+	}
+
+	storeMutex.Lock()
+	defer storeMutex.Unlock()
+
+	if err := os.MkdirAll(filepath.Join(loadedSamplesPath, hardwareId), 0755); err != nil {
+		return false, fmt.Errorf(`unable to register hardware "%s": %w`, hardwareId, err)
+	}
+	if store, isRegistrar := backend.(registrar); isRegistrar {
+		if err := store.Register(hardwareId); err != nil {
+			return false, fmt.Errorf(`unable to register hardware "%s" in the store: %w`, hardwareId, err)
+		}
+	}
+	if hasSamples(hardwareId) {
+		return false, nil
+	}
+	hardware[hardwareId] = make(map[int64]*Sample)
+	revision++
+	return true, nil
+}
@@ -0,0 +1,68 @@
+package hardware_test
+
+import (
+	"encoding/base64"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/config"
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/hardware"
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/internal/fixtures"
+)
+
+func TestDefectOrders(t *testing.T) {
+	// A 6205 deep groove ball bearing, with its published defect orders
+	geometry := &hardware.BearingGeometry{Balls: 9, BallDiameter: 7.94, PitchDiameter: 38.5}
+	if err := geometry.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	orders := geometry.DefectOrders()
+	if math.Abs(orders.BPFO-3.57) > 0.01 || math.Abs(orders.BPFI-5.43) > 0.01 || math.Abs(orders.FTF-0.397) > 0.001 {
+		t.Errorf(`unexpected defect orders %+v`, orders)
+	}
+}
+
+func TestValidateProfile(t *testing.T) {
+	warning, critical := 7.1, 4.5
+	if err := hardware.ValidateProfile(&hardware.Profile{Limits: map[string]config.Limits{"temperature": {Warning: &warning, Critical: &critical}}}); err == nil {
+		t.Errorf(`expected a critical limit below its warning to be refused`)
+	}
+	if err := hardware.ValidateHardwareId("../escape"); err == nil {
+		t.Errorf(`expected a hardware id leaving the sample tree to be refused`)
+	}
+}
+
+func TestProfilesEncryptedAtRest(t *testing.T) {
+	t.Setenv("KCF_METADATA_KEY", base64.StdEncoding.EncodeToString([]byte("0123456789abcdef0123456789abcdef")))
+	previousEncryption := config.Current.Encryption
+	defer func() { config.Current.Encryption = previousEncryption }()
+	config.Current.Encryption.Fields = []string{"profile.location", "profile.metadata"}
+	// Later reloads have no key to open the profiles with
+	defer os.Remove(filepath.Join(fixtures.Directory, "profiles.json"))
+
+	profile := &hardware.Profile{Name: "Cooling fan", Location: "Hall 3, bay 12", Metadata: map[string]string{"customer": "Acme Mills"}}
+	if err := hardware.SetProfile(fixtures.HardwareId, profile); err != nil {
+		t.Fatal(err)
+	}
+	if profile.Metadata["customer"] != "Acme Mills" {
+		t.Errorf(`saving encrypted the profile held in memory: %v`, profile.Metadata)
+	}
+	profilesBytes, err := os.ReadFile(filepath.Join(fixtures.Directory, "profiles.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if persisted := string(profilesBytes); strings.Contains(persisted, "Hall 3") || strings.Contains(persisted, "Acme") || !strings.Contains(persisted, "Cooling fan") {
+		t.Errorf(`expected only the location and metadata encrypted, got %s`, persisted)
+	}
+
+	if err := hardware.PopulateSamplesFrom(filepath.Join(fixtures.Directory, "samples")); err != nil {
+		t.Fatal(err)
+	}
+	reloaded := hardware.ProfileOf(fixtures.HardwareId)
+	if reloaded == nil || reloaded.Location != profile.Location || reloaded.Metadata["customer"] != "Acme Mills" {
+		t.Errorf(`expected the profile back decrypted, got %+v`, reloaded)
+	}
+}
@@ -0,0 +1,124 @@
+package hardware
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/config"
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/metrics"
+)
+
+const (
+	// expiryInterval is the least time between two sweeps of expired samples.
+	expiryInterval = time.Minute
+
+	// backendLoadMargin is loaded before the instant being interpolated, so it
+	// has samples to bracket it with.
+	backendLoadMargin = time.Hour
+)
+
+var (
+	// memoryHorizons holds, per hardware, the timestamp from which every stored
+	// sample is also in memory. Hardware without one is held entirely.
+	memoryHorizons map[string]int64 = make(map[string]int64)
+	lastExpiry     time.Time
+
+	expiredSampleCounter = metrics.NewCounter("hardware_expired_samples_total")
+	backendLoadCounter   = metrics.NewCounter("hardware_backend_loads_total")
+)
+
+// memoryRetention is how much recent history is kept in memory, or 0 when
+// every sample is.
+func memoryRetention() time.Duration {
+	if backend == nil {
+		return 0
+	}
+	return config.Current.Storage.MemoryRetention.Duration
+}
+
+// expireSamples drops the samples older than the memory retention from the
+// working set. They stay in the backend, which queries fall back to. Rollups
+// over them are kept, so aggregates of expired history are still answered
+// while the backend is unavailable.
+func expireSamples(now time.Time) {
+	retention := memoryRetention()
+	if retention <= 0 {
+		return
+	}
+	lastExpiry = now
+
+	horizon := now.Add(-retention).UnixMilli()
+	for hardwareId, samples := range hardware {
+		var expiredCount int64
+		for timestamp := range samples {
+			if timestamp < horizon {
+				delete(samples, timestamp)
+				expiredCount++
+			}
+		}
+		if currentHorizon, hasHorizon := memoryHorizons[hardwareId]; !hasHorizon || currentHorizon < horizon {
+			memoryHorizons[hardwareId] = horizon
+		}
+		if expiredCount > 0 {
+			expiredSampleCounter.Add(expiredCount)
+			invalidateIndex(hardwareId)
+		}
+	}
+}
+
+// expireSamplesIfDue sweeps expired samples at most once per expiryInterval,
+// so frequent ingestion does not rescan the working set every time.
+func expireSamplesIfDue() {
+	storeMutex.Lock()
+	defer storeMutex.Unlock()
+
+	if now := time.Now(); now.Sub(lastExpiry) >= expiryInterval {
+		expireSamples(now)
+	}
+}
+
+// ensureLoaded reads the samples of a hardware from from onwards back from
+// the backend if they have expired, so that queries reaching past the memory
+// retention see the same data as recent ones. They stay until the next sweep.
+func ensureLoaded(hardwareId string, from time.Time) error {
+	fromTimestamp := from.UnixMilli()
+	isLoaded := func() bool {
+		horizon, hasHorizon := memoryHorizons[hardwareId]
+		return backend == nil || !hasHorizon || fromTimestamp >= horizon
+	}
+
+	storeMutex.RLock()
+	loaded := isLoaded()
+	storeMutex.RUnlock()
+	if loaded {
+		return nil
+	}
+
+	// Checked again, as another query may have loaded it in the meantime
+	storeMutex.Lock()
+	defer storeMutex.Unlock()
+
+	if isLoaded() {
+		return nil
+	}
+	horizon := memoryHorizons[hardwareId]
+
+	backendLoadCounter.Inc()
+	samples, err := loadFromStore(hardwareId, from, time.UnixMilli(horizon-1))
+	if err != nil {
+		return fmt.Errorf(`unable to load hardware "%s" from storage: %w`, hardwareId, err)
+	}
+
+	if _, hardwareExists := hardware[hardwareId]; !hardwareExists {
+		hardware[hardwareId] = make(map[int64]*Sample)
+	}
+	for _, sample := range samples {
+		timestamp := sample.Time.UnixMilli()
+		if _, sampleExists := hardware[hardwareId][timestamp]; !sampleExists {
+			hardware[hardwareId][timestamp] = sample
+		}
+	}
+	memoryHorizons[hardwareId] = fromTimestamp
+	invalidateIndex(hardwareId)
+	return nil
+}
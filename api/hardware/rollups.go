@@ -0,0 +1,143 @@
+package hardware
+
+import (
+	"sync"
+	"time"
+
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/metrics"
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/statistics"
+)
+
+// rollupWidths are the bucket widths whose aggregates are kept between
+// queries, so live dashboards over hours and days do not rescan raw samples.
+var rollupWidths = []time.Duration{time.Hour, 24 * time.Hour}
+
+type rollupKey struct {
+	location string
+	width    time.Duration
+	start    int64
+}
+
+// rollup holds the accumulators of every metric over one bucket, and its end.
+type rollup struct {
+	end          int64
+	accumulators map[string]*metricAccumulator
+}
+
+var (
+	rollupHitCounter    = metrics.NewCounter("hardware_rollup_hits_total")
+	rollupBuildCounter  = metrics.NewCounter("hardware_rollup_builds_total")
+	rollupUpdateCounter = metrics.NewCounter("hardware_rollup_updates_total")
+
+	rollupsMutex sync.Mutex
+	// rollups are keyed by hardware. Buckets are only added by queries;
+	// ingestion keeps those already there up to date.
+	rollups = make(map[string]map[rollupKey]*rollup)
+	// rollupGenerations count the changes to each hardware's rollups, so a
+	// bucket built from samples read before a change is not kept.
+	rollupGenerations = make(map[string]int64)
+)
+
+func isRollupWidth(width time.Duration) bool {
+	for _, rollupWidth := range rollupWidths {
+		if width == rollupWidth {
+			return true
+		}
+	}
+	return false
+}
+
+// invalidateRollups forgets the buckets of a hardware, for changes other
+// than new values arriving.
+func invalidateRollups(hardwareId string) {
+	rollupsMutex.Lock()
+	defer rollupsMutex.Unlock()
+
+	delete(rollups, hardwareId)
+	rollupGenerations[hardwareId]++
+}
+
+func invalidateAllRollups() {
+	rollupsMutex.Lock()
+	defer rollupsMutex.Unlock()
+
+	rollups = make(map[string]map[rollupKey]*rollup)
+	for hardwareId := range rollupGenerations {
+		rollupGenerations[hardwareId]++
+	}
+}
+
+// updateRollups folds a value ingested at a timestamp into the buckets kept
+// around it. A value that replaces another, which an accumulator cannot take
+// back out, drops them instead.
+func updateRollups(hardwareId string, metric string, timestamp int64, value float64, replaces bool) {
+	rollupsMutex.Lock()
+	defer rollupsMutex.Unlock()
+
+	rollupGenerations[hardwareId]++
+	for key, bucket := range rollups[hardwareId] {
+		if timestamp < key.start || timestamp >= bucket.end {
+			continue
+		}
+		if replaces {
+			delete(rollups[hardwareId], key)
+			continue
+		}
+		if !statistics.IsFinite(value) {
+			continue
+		}
+		accumulator, hasAccumulator := bucket.accumulators[metric]
+		if !hasAccumulator {
+			accumulator = &metricAccumulator{}
+			bucket.accumulators[metric] = accumulator
+		}
+		accumulator.add(value)
+		rollupUpdateCounter.Inc()
+	}
+}
+
+// rolledUpBucket returns the aggregates of a whole bucket, from the kept
+// rollup or, failing that, from the raw samples, keeping the result.
+func rolledUpBucket(hardwareId string, bucket *Bucket, width time.Duration, location *time.Location) error {
+	key := rollupKey{location: location.String(), width: width, start: bucket.Start.UnixMilli()}
+
+	rollupsMutex.Lock()
+	kept, isKept := rollups[hardwareId][key]
+	if isKept {
+		for metric, accumulator := range kept.accumulators {
+			bucket.Metrics[metric] = accumulator.aggregate()
+		}
+	}
+	generation := rollupGenerations[hardwareId]
+	rollupsMutex.Unlock()
+	if isKept {
+		rollupHitCounter.Inc()
+		return nil
+	}
+
+	samples, err := SamplesBetween(hardwareId, bucket.Start, bucket.End)
+	if err != nil {
+		return err
+	}
+	built := &rollup{end: bucket.End.UnixMilli(), accumulators: make(map[string]*metricAccumulator)}
+	metrics := Metrics()
+	for _, sample := range samples {
+		if sample.Time.Before(bucket.End) {
+			accumulate(built.accumulators, metrics, sample)
+		}
+	}
+	for metric, accumulator := range built.accumulators {
+		bucket.Metrics[metric] = accumulator.aggregate()
+	}
+	rollupBuildCounter.Inc()
+
+	rollupsMutex.Lock()
+	defer rollupsMutex.Unlock()
+	if rollupGenerations[hardwareId] == generation {
+		if _, hasRollups := rollups[hardwareId]; !hasRollups {
+			rollups[hardwareId] = make(map[rollupKey]*rollup)
+		}
+		rollups[hardwareId][key] = built
+	}
+	return nil
+}
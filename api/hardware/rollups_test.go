@@ -0,0 +1,70 @@
+package hardware_test
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/hardware"
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/metrics"
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/internal/fixtures"
+)
+
+func TestRollups(t *testing.T) {
+	defer reloadFixtures(t)
+
+	// Half-hour buckets are never rolled up, so they sum the raw samples
+	rawBuckets, err := hardware.AggregateRange(fixtures.HardwareId, fixtures.Start, fixtures.Minute(60), 30*time.Minute, time.UTC, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := hardware.MetricAggregate{Minimum: math.Inf(1), Maximum: math.Inf(-1)}
+	for _, bucket := range rawBuckets {
+		temperature := bucket.Metrics["temperature"]
+		expected.Count += temperature.Count
+		expected.Minimum = math.Min(expected.Minimum, temperature.Minimum)
+		expected.Maximum = math.Max(expected.Maximum, temperature.Maximum)
+	}
+
+	// aggregate returns the temperature over the fixtures' hour, and how many
+	// rollups were built and used doing so
+	aggregate := func() (temperature *hardware.MetricAggregate, builds int64, hits int64) {
+		counters := metrics.Counters()
+		buckets, err := hardware.AggregateRange(fixtures.HardwareId, fixtures.Start, fixtures.Minute(60), time.Hour, time.UTC, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(buckets) != 1 {
+			t.Fatalf(`expected one hourly bucket, got %d`, len(buckets))
+		}
+		after := metrics.Counters()
+		return buckets[0].Metrics["temperature"], after["hardware_rollup_builds_total"] - counters["hardware_rollup_builds_total"], after["hardware_rollup_hits_total"] - counters["hardware_rollup_hits_total"]
+	}
+	expectAggregate := func(when string, expected hardware.MetricAggregate, expectedBuilds int64, expectedHits int64) {
+		temperature, builds, hits := aggregate()
+		if temperature == nil || temperature.Count != expected.Count || temperature.Minimum != expected.Minimum || temperature.Maximum != expected.Maximum {
+			t.Errorf(`%s: expected %d temperatures from %g to %g, got %+v`, when, expected.Count, expected.Minimum, expected.Maximum, temperature)
+		}
+		if builds != expectedBuilds || hits != expectedHits {
+			t.Errorf(`%s: expected %d rollups built and %d used, got %d and %d`, when, expectedBuilds, expectedHits, builds, hits)
+		}
+	}
+
+	expectAggregate("first query", expected, 1, 0)
+	expectAggregate("second query", expected, 0, 1)
+
+	// A new value is folded into the rollup kept
+	if err := hardware.AddSamples([]*hardware.Reading{{HardwareId: fixtures.HardwareId, Time: fixtures.Minute(59.5), Values: map[string]float64{"temperature": 200}}}); err != nil {
+		t.Fatal(err)
+	}
+	expected.Count++
+	expected.Maximum = 200
+	expectAggregate("after a new value", expected, 0, 1)
+
+	// A replaced value cannot be taken back out, so the rollup is built again
+	if err := hardware.AddSamples([]*hardware.Reading{{HardwareId: fixtures.HardwareId, Time: fixtures.Minute(59.5), Values: map[string]float64{"temperature": -200}}}); err != nil {
+		t.Fatal(err)
+	}
+	expected.Minimum, expected.Maximum = -200, rawBuckets[1].Metrics["temperature"].Maximum
+	expectAggregate("after a replaced value", expected, 1, 0)
+}
@@ -0,0 +1,79 @@
+package hardware
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ClockSkewPolicy guards live ingestion against gateways with bad clocks,
+// either by rejecting samples too far in the future or by ignoring the
+// gateway clock entirely and stamping samples on arrival. Skew is judged
+// after the configured clock offset of the hardware is applied, and so is
+// the arrival lag it records. Backfill is set for history being uploaded,
+// which lags by however old it is, so no arrival lag is recorded for it.
+type ClockSkewPolicy struct {
+	MaxFutureSkew    time.Duration
+	ServerTimestamps bool
+	Backfill         bool
+}
+
+type ClockSkewStatistics struct {
+	Count       int64   `json:"count"`
+	Rejected    int64   `json:"rejected"`
+	MinSeconds  float64 `json:"minSeconds"`
+	MaxSeconds  float64 `json:"maxSeconds"`
+	MeanSeconds float64 `json:"meanSeconds"`
+}
+
+var (
+	clockSkewMutex      sync.Mutex
+	clockSkewStatistics map[string]*ClockSkewStatistics = make(map[string]*ClockSkewStatistics)
+)
+
+func (policy ClockSkewPolicy) Apply(hardwareId string, sampleTime time.Time, arrivalTime time.Time) (time.Time, error) {
+	sampleTime = CorrectedTime(hardwareId, sampleTime)
+	skew := sampleTime.Sub(arrivalTime)
+	rejected := !policy.ServerTimestamps && policy.MaxFutureSkew > 0 && skew > policy.MaxFutureSkew
+
+	clockSkewMutex.Lock()
+	statistics, hasStatistics := clockSkewStatistics[hardwareId]
+	if !hasStatistics {
+		statistics = &ClockSkewStatistics{MinSeconds: skew.Seconds(), MaxSeconds: skew.Seconds()}
+		clockSkewStatistics[hardwareId] = statistics
+	}
+	statistics.Count++
+	if skew.Seconds() < statistics.MinSeconds {
+		statistics.MinSeconds = skew.Seconds()
+	}
+	if skew.Seconds() > statistics.MaxSeconds {
+		statistics.MaxSeconds = skew.Seconds()
+	}
+	statistics.MeanSeconds += (skew.Seconds() - statistics.MeanSeconds) / float64(statistics.Count)
+	if rejected {
+		statistics.Rejected++
+	}
+	clockSkewMutex.Unlock()
+	if !policy.Backfill {
+		recordArrivalLag(hardwareId, -skew, arrivalTime)
+	}
+
+	if rejected {
+		return time.Time{}, fmt.Errorf(`sample at %s is %s ahead of server time`, sampleTime, skew)
+	}
+	if policy.ServerTimestamps {
+		return arrivalTime, nil
+	}
+	return sampleTime, nil
+}
+
+func ClockSkew(hardwareId string) (ClockSkewStatistics, bool) {
+	clockSkewMutex.Lock()
+	defer clockSkewMutex.Unlock()
+
+	statistics, hasStatistics := clockSkewStatistics[hardwareId]
+	if !hasStatistics {
+		return ClockSkewStatistics{}, false
+	}
+	return *statistics, true
+}
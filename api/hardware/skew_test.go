@@ -0,0 +1,26 @@
+package hardware_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/hardware"
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/internal/fixtures"
+)
+
+func TestBackfillRecordsNoArrivalLag(t *testing.T) {
+	arrivalTime := time.Now()
+	if _, err := (hardware.ClockSkewPolicy{Backfill: true}).Apply(fixtures.HardwareId, fixtures.Minute(0), arrivalTime); err != nil {
+		t.Fatal(err)
+	}
+	if count := hardware.ArrivalLagOf(fixtures.HardwareId, false).Count; count != 0 {
+		t.Fatalf(`expected a backfilled reading to record no arrival lag, got %d`, count)
+	}
+
+	if _, err := (hardware.ClockSkewPolicy{}).Apply(fixtures.HardwareId, arrivalTime.Add(-2*time.Second), arrivalTime); err != nil {
+		t.Fatal(err)
+	}
+	if lag := hardware.ArrivalLagOf(fixtures.HardwareId, false); lag.Count != 1 || lag.MaxSeconds != 2 {
+		t.Errorf(`expected a live reading to record 2 seconds of arrival lag, got %d readings up to %g seconds`, lag.Count, lag.MaxSeconds)
+	}
+}
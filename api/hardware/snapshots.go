@@ -0,0 +1,370 @@
+package hardware
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/config"
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/metrics"
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/timeseries"
+)
+
+// valueChange is one value ingestion set, with the value it replaced, or nil
+// when there was none.
+type valueChange struct {
+	sequence    int64
+	at          time.Time
+	hardwareId  string
+	timestamp   int64
+	columnIndex int
+	previous    *float64
+}
+
+var (
+	// journal holds the latest value changes, oldest first, and journalFloor
+	// the earliest time the working set can be taken back to with them. It
+	// is not persisted, so the floor starts over with every load.
+	journal      []valueChange
+	journalFloor time.Time
+
+	// journalSequence numbers the changes journaled, and journalFloorSequence
+	// is the one the journal was last reset at. forgottenSequences holds, per
+	// hardware, the latest sequence since then of a change the journal does
+	// not hold: trimmed from it, or never recorded, as tombstones are not.
+	journalSequence      int64
+	journalFloorSequence int64
+	forgottenSequences   = make(map[string]int64)
+
+	journaledChangeCounter = metrics.NewCounter("hardware_journaled_changes_total")
+	snapshotCounter        = metrics.NewCounter("hardware_snapshots_total")
+)
+
+func init() {
+	metrics.NewGaugeFunc("hardware_journal_changes", func() float64 {
+		storeMutex.RLock()
+		defer storeMutex.RUnlock()
+
+		return float64(len(journal))
+	})
+}
+
+// journalChange records a change of the working set. The journal is trimmed
+// a quarter beyond its limit at a time, so trimming is not paid for on every
+// change. The caller holds storeMutex for writing.
+func journalChange(change valueChange) {
+	journalSequence++
+	change.sequence = journalSequence
+	journal = append(journal, change)
+	journaledChangeCounter.Inc()
+
+	maxChanges := config.Current.Storage.Journal.MaxChanges
+	if len(journal) <= maxChanges+maxChanges/4 {
+		return
+	}
+	trimmedCount := len(journal) - maxChanges
+	for _, trimmedChange := range journal[:trimmedCount] {
+		forgottenSequences[trimmedChange.hardwareId] = trimmedChange.sequence
+	}
+	journalFloor = journal[trimmedCount-1].at
+	journal = append([]valueChange(nil), journal[trimmedCount:]...)
+}
+
+// journalReplacement records the changes from replacedSamples, which a range
+// of the working set of a hardware held, to samples, which it holds now:
+// every value that differs, including those of samples dropped or added. The
+// caller holds storeMutex for writing.
+func journalReplacement(hardwareId string, replacedSamples map[int64]*Sample, samples []*Sample, now time.Time) {
+	journalSample := func(timestamp int64, previousSample *Sample, sample *Sample) {
+		for columnIndex := range columns {
+			var previous, value *float64
+			if previousSample != nil {
+				previous = previousSample.valueOf(columnIndex)
+			}
+			if sample != nil {
+				value = sample.valueOf(columnIndex)
+			}
+			if previous == nil && value == nil || previous != nil && value != nil && *previous == *value {
+				continue
+			}
+			journalChange(valueChange{at: now, hardwareId: hardwareId, timestamp: timestamp, columnIndex: columnIndex, previous: previous})
+		}
+	}
+
+	isKept := make(map[int64]bool, len(samples))
+	for _, sample := range samples {
+		timestamp := sample.Time.UnixMilli()
+		isKept[timestamp] = true
+		journalSample(timestamp, replacedSamples[timestamp], sample)
+	}
+	for timestamp, replacedSample := range replacedSamples {
+		if !isKept[timestamp] {
+			journalSample(timestamp, replacedSample, nil)
+		}
+	}
+}
+
+// resetJournal forgets every change, for when the working set changed in a
+// way the journal cannot undo. The caller holds storeMutex for writing.
+func resetJournal(now time.Time) {
+	journal = nil
+	journalFloor = now
+	journalSequence++
+	journalFloorSequence = journalSequence
+	forgottenSequences = make(map[string]int64)
+}
+
+// markUnjournaled records that a hardware changed in a way the journal does
+// not record, so changes since earlier sequences can no longer be told. The
+// caller holds storeMutex for writing.
+func markUnjournaled(hardwareId string) {
+	journalSequence++
+	forgottenSequences[hardwareId] = journalSequence
+}
+
+// forgottenSequence is the latest sequence of a change of a hardware the
+// journal does not hold. The caller holds storeMutex.
+func forgottenSequence(hardwareId string) int64 {
+	if forgottenSequences[hardwareId] > journalFloorSequence {
+		return forgottenSequences[hardwareId]
+	}
+	return journalFloorSequence
+}
+
+// changeSpan is the span of time over which interpolating with the given
+// number of neighbors may read a changed value: between the values
+// bracketing it, whether it was added, replaced or taken out, widened by the
+// neighbors either side. The caller holds storeMutex.
+func changeSpan(index *sampleIndex, change valueChange, neighbors int) (int64, int64) {
+	metricTimestamps := index.columns[change.columnIndex].timestamps
+	beforeIndex := sort.Search(len(metricTimestamps), func(timestampIndex int) bool { return metricTimestamps[timestampIndex] >= change.timestamp }) - 1
+	afterIndex := sort.Search(len(metricTimestamps), func(timestampIndex int) bool { return metricTimestamps[timestampIndex] > change.timestamp })
+	fromTimestamp, toTimestamp := int64(math.MinInt64), int64(math.MaxInt64)
+	if beforeIndex-neighbors >= 0 {
+		fromTimestamp = metricTimestamps[beforeIndex-neighbors]
+	}
+	if afterIndex+neighbors < len(metricTimestamps) {
+		toTimestamp = metricTimestamps[afterIndex+neighbors]
+	}
+	return fromTimestamp, toTimestamp
+}
+
+// JournalSequence is the sequence of the latest change of the working set.
+func JournalSequence() int64 {
+	storeMutex.RLock()
+	defer storeMutex.RUnlock()
+
+	return journalSequence
+}
+
+// ChangesSince returns the spans of time over which interpolating the working
+// set of a hardware may give other values than it did as of a journal
+// sequence: around every value changed since, as far as the given number of
+// neighbors past the values bracketing it. It returns the latest sequence
+// alongside, and reports false when the journal no longer reaches back to
+// the sequence asked for, or the hardware changed since in a way the journal
+// does not record.
+func ChangesSince(hardwareId string, sequence int64, neighbors int) ([][2]time.Time, int64, bool) {
+	storeMutex.RLock()
+	defer storeMutex.RUnlock()
+
+	if sequence < forgottenSequence(hardwareId) || sequence > journalSequence {
+		return nil, journalSequence, false
+	}
+
+	spans := make([][2]time.Time, 0)
+	var index *sampleIndex
+	for changeIndex := len(journal) - 1; changeIndex >= 0 && journal[changeIndex].sequence > sequence; changeIndex-- {
+		change := journal[changeIndex]
+		if change.hardwareId != hardwareId {
+			continue
+		}
+		if index == nil {
+			index = indexOf(hardwareId)
+		}
+		fromTimestamp, toTimestamp := changeSpan(index, change, neighbors)
+		spans = append(spans, [2]time.Time{time.UnixMilli(fromTimestamp), time.UnixMilli(toTimestamp)})
+	}
+	return spans, journalSequence, true
+}
+
+// ChangedSamplesSince returns the samples of a hardware holding a value
+// changed since a journal sequence, in time order however far back their
+// time, and the latest sequence alongside. Samples taken out since are left
+// out. Like ChangesSince, it reports false when the changes since the
+// sequence can no longer be told.
+func ChangedSamplesSince(hardwareId string, sequence int64) ([]*Sample, int64, bool) {
+	storeMutex.RLock()
+	defer storeMutex.RUnlock()
+
+	if sequence < forgottenSequence(hardwareId) || sequence > journalSequence {
+		return nil, journalSequence, false
+	}
+
+	isChanged := make(map[int64]bool)
+	samples := make([]*Sample, 0)
+	checkTombstones := hasTombstones(hardwareId)
+	for changeIndex := len(journal) - 1; changeIndex >= 0 && journal[changeIndex].sequence > sequence; changeIndex-- {
+		change := journal[changeIndex]
+		if change.hardwareId != hardwareId || isChanged[change.timestamp] {
+			continue
+		}
+		isChanged[change.timestamp] = true
+		sample, sampleExists := hardware[hardwareId][change.timestamp]
+		if !sampleExists {
+			continue
+		}
+		if checkTombstones {
+			if sample = withoutTombstoned(hardwareId, sample); sample == nil {
+				continue
+			}
+		}
+		samples = append(samples, sample)
+	}
+	sort.Slice(samples, func(leftIndex, rightIndex int) bool { return samples[leftIndex].Time.Before(samples[rightIndex].Time) })
+	return samples, journalSequence, true
+}
+
+// WindowSequence is the sequence of the latest change that may have changed
+// interpolating the working set of a hardware between from and to with the
+// given number of neighbors, or of the latest the journal does not hold if
+// that is later. It grows whenever what the window holds changes, and only
+// then while the journal holds the changes of the hardware.
+func WindowSequence(hardwareId string, from time.Time, to time.Time, neighbors int) int64 {
+	storeMutex.RLock()
+	defer storeMutex.RUnlock()
+
+	sequence := forgottenSequence(hardwareId)
+	fromTimestamp, toTimestamp := from.UnixMilli(), to.UnixMilli()
+	var index *sampleIndex
+	for changeIndex := len(journal) - 1; changeIndex >= 0 && journal[changeIndex].sequence > sequence; changeIndex-- {
+		change := journal[changeIndex]
+		if change.hardwareId != hardwareId {
+			continue
+		}
+		if index == nil {
+			index = indexOf(hardwareId)
+		}
+		if changeFrom, changeTo := changeSpan(index, change, neighbors); changeFrom <= toTimestamp && changeTo >= fromTimestamp {
+			return change.sequence
+		}
+	}
+	return sequence
+}
+
+// JournalFloor is the earliest time queries can be answered as of.
+func JournalFloor() time.Time {
+	storeMutex.RLock()
+	defer storeMutex.RUnlock()
+
+	return journalFloor
+}
+
+// Snapshot is the working set of a hardware as it was at an earlier time,
+// before the value changes journaled since and without the tombstones created
+// since. Like the working set, it only reaches as far back as was loaded when
+// it was taken.
+type Snapshot struct {
+	HardwareId string
+	AsOf       time.Time
+
+	samples map[int64]*Sample
+	index   *sampleIndex
+}
+
+// SnapshotAt takes the working set of a hardware back to asOf, first loading
+// it from from onwards, with a margin to interpolate from with. The whole of
+// it is taken, so that interpolation sees the same spacing of samples as in
+// the working set.
+func SnapshotAt(hardwareId string, asOf time.Time, from time.Time) (*Snapshot, error) {
+	if err := ensureLoaded(hardwareId, from.Add(-backendLoadMargin)); err != nil {
+		return nil, err
+	}
+	storeMutex.RLock()
+	defer storeMutex.RUnlock()
+
+	if !hasSamples(hardwareId) {
+		return nil, unknownHardwareError(hardwareId)
+	}
+	if asOf.Before(journalFloor) {
+		return nil, fmt.Errorf(`%w: hardware "%s" can be taken back no earlier than %s`, ErrSnapshotUnavailable, hardwareId, journalFloor.UTC().Format(time.RFC3339Nano))
+	}
+	snapshotCounter.Inc()
+
+	samples := make(map[int64]*Sample, len(hardware[hardwareId]))
+	for timestamp, sample := range hardware[hardwareId] {
+		samples[timestamp] = sample
+	}
+
+	// Undone newest first, each on a copy, as queries may still hold the sample
+	isCopied := make(map[int64]bool)
+	for changeIndex := len(journal) - 1; changeIndex >= 0 && journal[changeIndex].at.After(asOf); changeIndex-- {
+		change := journal[changeIndex]
+		if change.hardwareId != hardwareId {
+			continue
+		}
+		sample, sampleExists := samples[change.timestamp]
+		switch {
+		case !sampleExists:
+			sample = &Sample{Time: time.UnixMilli(change.timestamp)}
+		case !isCopied[change.timestamp]:
+			sample = sample.clone()
+		}
+		isCopied[change.timestamp] = true
+		sample.setValue(change.columnIndex, change.previous)
+		samples[change.timestamp] = sample
+	}
+
+	for timestamp, sample := range samples {
+		if visibleSample := withoutTombstonedAsOf(hardwareId, sample, asOf); visibleSample == nil {
+			delete(samples, timestamp)
+		} else {
+			samples[timestamp] = visibleSample
+		}
+	}
+
+	return &Snapshot{HardwareId: hardwareId, AsOf: asOf, samples: samples, index: buildSampleIndexOf(hardwareId, samples, false)}, nil
+}
+
+// CountRawSamples is CountRawSamples over the snapshot.
+func (snapshot *Snapshot) CountRawSamples(from time.Time, to time.Time) (int, error) {
+	fromTimestamp, toTimestamp := from.UnixMilli(), to.UnixMilli()
+	timestamps := snapshot.index.timestamps
+	firstIndex := sort.Search(len(timestamps), func(timestampIndex int) bool { return timestamps[timestampIndex] >= fromTimestamp })
+	lastIndex := sort.Search(len(timestamps), func(timestampIndex int) bool { return timestamps[timestampIndex] >= toTimestamp })
+	return lastIndex - firstIndex, nil
+}
+
+// SamplesBetween is SamplesBetween over the snapshot.
+func (snapshot *Snapshot) SamplesBetween(from time.Time, to time.Time) ([]*Sample, error) {
+	fromTimestamp, toTimestamp := from.UnixMilli(), to.UnixMilli()
+	timestamps := snapshot.index.timestamps
+	firstIndex := sort.Search(len(timestamps), func(timestampIndex int) bool { return timestamps[timestampIndex] >= fromTimestamp })
+	lastIndex := sort.Search(len(timestamps), func(timestampIndex int) bool { return timestamps[timestampIndex] > toTimestamp })
+	if lastIndex < firstIndex {
+		lastIndex = firstIndex
+	}
+
+	samples := make([]*Sample, 0, lastIndex-firstIndex)
+	for _, timestamp := range timestamps[firstIndex:lastIndex] {
+		samples = append(samples, snapshot.samples[timestamp])
+	}
+	return samples, nil
+}
+
+// InterpolateSampleWith is InterpolateSampleWith over the snapshot.
+func (snapshot *Snapshot) InterpolateSampleWith(at time.Time, interpolator timeseries.Interpolator) (*Sample, error) {
+	return interpolateIndex(snapshot.index, snapshot.HardwareId, at, interpolator, nil)
+}
+
+// InterpolateSampleWithConfidence is InterpolateSampleWithConfidence over the
+// snapshot.
+func (snapshot *Snapshot) InterpolateSampleWithConfidence(at time.Time, interpolator timeseries.Interpolator) (*Sample, map[string]float64, error) {
+	confidences := make(map[string]float64)
+	interpolatedSample, err := interpolateIndex(snapshot.index, snapshot.HardwareId, at, interpolator, confidences)
+	if err != nil {
+		return nil, nil, err
+	}
+	return interpolatedSample, confidences, nil
+}
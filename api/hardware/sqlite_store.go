@@ -0,0 +1,196 @@
+package hardware
+
+import (
+	"database/sql"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+
+	// Registers the "sqlite3" driver, which takes cgo
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// sqliteSchema keeps one row per value, under the channel it was put as, so
+// values are migrated as they are read like those of the sample log. The
+// registry version is the database's user_version.
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS hardware (
+	id TEXT PRIMARY KEY
+);
+CREATE TABLE IF NOT EXISTS samples (
+	hardware_id TEXT NOT NULL,
+	timestamp INTEGER NOT NULL,
+	channel TEXT NOT NULL,
+	value REAL NOT NULL,
+	PRIMARY KEY (hardware_id, timestamp, channel)
+) WITHOUT ROWID;
+`
+
+// sqliteStore keeps samples in a SQLite database, which replicas may share:
+// the database serializes their writes, and each reads what the others
+// committed. Ranges are read back through the primary key, so the store
+// costs the working set nothing beyond what the memory retention keeps.
+type sqliteStore struct {
+	database *sql.DB
+}
+
+// NewSQLiteStore opens the database at path, creating it, its directory and
+// its tables if need be.
+func NewSQLiteStore(path string) (Store, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf(`unable to create sample database directory: %w`, err)
+	}
+	// Writes of other replicas are waited for rather than failed on, and the
+	// write-ahead log lets reads go on while one commits
+	options := url.Values{"_busy_timeout": {"5000"}, "_journal_mode": {"WAL"}}
+	database, err := sql.Open("sqlite3", "file:"+path+"?"+options.Encode())
+	if err != nil {
+		return nil, fmt.Errorf(`unable to open sample database: %w`, err)
+	}
+	if _, err := database.Exec(sqliteSchema); err != nil {
+		database.Close()
+		return nil, fmt.Errorf(`unable to create sample database tables: %w`, err)
+	}
+	return &sqliteStore{database: database}, nil
+}
+
+func (store *sqliteStore) ListHardware() ([]string, error) {
+	rows, err := store.database.Query(`SELECT id FROM hardware ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	hardwareIds := make([]string, 0)
+	for rows.Next() {
+		var hardwareId string
+		if err := rows.Scan(&hardwareId); err != nil {
+			return nil, err
+		}
+		hardwareIds = append(hardwareIds, hardwareId)
+	}
+	return hardwareIds, rows.Err()
+}
+
+func (store *sqliteStore) Register(hardwareId string) error {
+	_, err := store.database.Exec(`INSERT OR IGNORE INTO hardware (id) VALUES (?)`, hardwareId)
+	return err
+}
+
+// LoadRange reads the values of a hardware in the range, migrating them from
+// the channel they were stored under.
+func (store *sqliteStore) LoadRange(hardwareId string, from time.Time, to time.Time) ([]*Sample, error) {
+	rows, err := store.database.Query(`SELECT timestamp, channel, value FROM samples WHERE hardware_id = ? AND timestamp BETWEEN ? AND ? ORDER BY timestamp`, hardwareId, from.UnixMilli(), to.UnixMilli())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	samples := make([]*Sample, 0)
+	var sample *Sample
+	for rows.Next() {
+		var timestamp int64
+		var channel string
+		var value float64
+		if err := rows.Scan(&timestamp, &channel, &value); err != nil {
+			return nil, err
+		}
+		metrics := storedMetrics(channel)
+		if len(metrics) == 0 {
+			continue
+		}
+		if sample == nil || sample.Time.UnixMilli() != timestamp {
+			sample = &Sample{Time: time.UnixMilli(timestamp)}
+			samples = append(samples, sample)
+		}
+		for _, metric := range metrics {
+			migratedValue := migrateStoredValue(metric, timestamp, value)
+			sample.SetValueByMetric(metric, &migratedValue)
+		}
+	}
+	return samples, rows.Err()
+}
+
+// Put writes readings in one transaction, replacing the values they set.
+func (store *sqliteStore) Put(readings []*Reading) error {
+	transaction, err := store.database.Begin()
+	if err != nil {
+		return err
+	}
+	defer transaction.Rollback()
+
+	registerStatement, err := transaction.Prepare(`INSERT OR IGNORE INTO hardware (id) VALUES (?)`)
+	if err != nil {
+		return err
+	}
+	defer registerStatement.Close()
+	putStatement, err := transaction.Prepare(`INSERT OR REPLACE INTO samples (hardware_id, timestamp, channel, value) VALUES (?, ?, ?, ?)`)
+	if err != nil {
+		return err
+	}
+	defer putStatement.Close()
+
+	isRegistered := make(map[string]bool)
+	for _, reading := range readings {
+		if len(reading.Values) == 0 {
+			continue
+		}
+		if !isRegistered[reading.HardwareId] {
+			if _, err := registerStatement.Exec(reading.HardwareId); err != nil {
+				return err
+			}
+			isRegistered[reading.HardwareId] = true
+		}
+		for channel, value := range reading.Values {
+			if _, err := putStatement.Exec(reading.HardwareId, reading.Time.UnixMilli(), channel, value); err != nil {
+				return err
+			}
+		}
+	}
+	return transaction.Commit()
+}
+
+// Remove deletes the values of a metric over a range, along with those of
+// the channels migrated to it. A former channel split across several
+// metrics loses its values for all of them.
+func (store *sqliteStore) Remove(hardwareId string, metric string, from time.Time, to time.Time) error {
+	channels := []string{metric}
+	for channel, metrics := range migratedChannels {
+		for _, migratedMetric := range metrics {
+			if migratedMetric == metric {
+				channels = append(channels, channel)
+				break
+			}
+		}
+	}
+
+	transaction, err := store.database.Begin()
+	if err != nil {
+		return err
+	}
+	defer transaction.Rollback()
+
+	for _, channel := range channels {
+		if _, err := transaction.Exec(`DELETE FROM samples WHERE hardware_id = ? AND channel = ? AND timestamp BETWEEN ? AND ?`, hardwareId, channel, from.UnixMilli(), to.UnixMilli()); err != nil {
+			return err
+		}
+	}
+	return transaction.Commit()
+}
+
+func (store *sqliteStore) RegistryVersion() (int, error) {
+	var version int
+	err := store.database.QueryRow(`PRAGMA user_version`).Scan(&version)
+	return version, err
+}
+
+func (store *sqliteStore) SetRegistryVersion(version int) error {
+	_, err := store.database.Exec(fmt.Sprintf(`PRAGMA user_version = %d`, version))
+	return err
+}
+
+func (store *sqliteStore) Close() error {
+	return store.database.Close()
+}
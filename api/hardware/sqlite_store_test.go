@@ -0,0 +1,94 @@
+package hardware_test
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/hardware"
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/internal/fixtures"
+)
+
+func TestSQLiteStore(t *testing.T) {
+	databasePath := filepath.Join(t.TempDir(), "samples.db")
+	store, err := hardware.NewSQLiteStore(databasePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	replica, err := hardware.NewSQLiteStore(databasePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer replica.Close()
+
+	readings := []*hardware.Reading{
+		{HardwareId: fixtures.HardwareId, Time: fixtures.Minute(0), Values: map[string]float64{"temperature": 20, "rmsVelocityX": 1.5}},
+		{HardwareId: fixtures.HardwareId, Time: fixtures.Minute(1), Values: map[string]float64{"temperature": 21, "rmsVelocityX": 1.5}},
+		{HardwareId: fixtures.HardwareId, Time: fixtures.Minute(2), Values: map[string]float64{"temperature": 22}},
+	}
+	if err := store.Put(readings); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Remove(fixtures.HardwareId, "temperature", fixtures.Minute(1), fixtures.Minute(2)); err != nil {
+		t.Fatal(err)
+	}
+	if err := replica.Put([]*hardware.Reading{{HardwareId: fixtures.HardwareId, Time: fixtures.Minute(1), Values: map[string]float64{"temperature": 25}}}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Each sees what the other committed, removals only taking away what came
+	// before, and a sample left without values is gone
+	samples, err := store.LoadRange(fixtures.HardwareId, fixtures.Minute(0), fixtures.Minute(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(samples) != 2 {
+		t.Fatalf(`expected 2 samples from the database, got %d`, len(samples))
+	}
+	if temperature, _ := samples[1].ValueByMetric("temperature"); temperature == nil || *temperature != 25 {
+		t.Errorf(`expected the replica's temperature of 25 after the removal, got %v`, temperature)
+	}
+	if rmsVelocityX, _ := samples[1].ValueByMetric("rmsVelocityX"); rmsVelocityX == nil || *rmsVelocityX != 1.5 {
+		t.Errorf(`expected the RMS velocity kept through the temperature's removal, got %v`, rmsVelocityX)
+	}
+	if hardwareIds, err := replica.ListHardware(); err != nil || len(hardwareIds) != 1 || hardwareIds[0] != fixtures.HardwareId {
+		t.Errorf(`expected the replica to list %s, got %v (%v)`, fixtures.HardwareId, hardwareIds, err)
+	}
+
+	reopened, err := hardware.NewSQLiteStore(databasePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reopened.Close()
+	if reopenedSamples, err := reopened.LoadRange(fixtures.HardwareId, time.UnixMilli(0), time.UnixMilli(1<<62)); err != nil || len(reopenedSamples) != 2 {
+		t.Errorf(`expected 2 samples after reopening the database, got %d (%v)`, len(reopenedSamples), err)
+	}
+}
+
+func TestSQLiteStoreBackend(t *testing.T) {
+	defer reloadFixtures(t)
+	store, err := hardware.NewSQLiteStore(filepath.Join(t.TempDir(), "samples.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := hardware.UseStore(store); err != nil {
+		t.Fatal(err)
+	}
+	defer hardware.UseStore(nil)
+
+	// An empty database is seeded from the sample tree, then loaded from
+	// instead of it
+	if err := hardware.PopulateSamplesFrom(filepath.Join(fixtures.Directory, "samples")); err != nil {
+		t.Fatal(err)
+	}
+	if err := hardware.AddSamples([]*hardware.Reading{{HardwareId: fixtures.HardwareId, Time: fixtures.Minute(60), Values: map[string]float64{"temperature": 80}}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := hardware.PopulateSamplesFrom(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	if rawCount, err := hardware.CountRawSamples(fixtures.HardwareId, fixtures.Start, fixtures.Minute(61)); err != nil || rawCount != fixtures.Minutes+1 {
+		t.Errorf(`expected the fixtures and the reading put loaded from the database, got %d samples (%v)`, rawCount, err)
+	}
+}
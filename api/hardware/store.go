@@ -0,0 +1,214 @@
+package hardware
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/config"
+)
+
+// Store is where samples live beyond the working set that queries run on.
+// The working set is loaded from the configured store at startup instead of
+// from the CSV tree, and readings are written through to it as they arrive.
+type Store interface {
+	ListHardware() ([]string, error)
+	LoadRange(hardwareId string, from time.Time, to time.Time) ([]*Sample, error)
+	Put(readings []*Reading) error
+	Remove(hardwareId string, metric string, from time.Time, to time.Time) error
+	Close() error
+}
+
+// memoryStore keeps everything in maps, exactly like the working set does.
+// It is the "memory" backend: seeded from the CSV tree on every start, it
+// holds nothing the sample tree does not, once ingested readings are
+// persisted there.
+type memoryStore struct {
+	mutex   sync.RWMutex
+	samples map[string]map[int64]*Sample
+}
+
+func NewMemoryStore() Store {
+	return &memoryStore{samples: make(map[string]map[int64]*Sample)}
+}
+
+func (store *memoryStore) ListHardware() ([]string, error) {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	hardwareIds := make([]string, 0, len(store.samples))
+	for hardwareId := range store.samples {
+		hardwareIds = append(hardwareIds, hardwareId)
+	}
+	sort.Strings(hardwareIds)
+	return hardwareIds, nil
+}
+
+func (store *memoryStore) LoadRange(hardwareId string, from time.Time, to time.Time) ([]*Sample, error) {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	fromTimestamp, toTimestamp := from.UnixMilli(), to.UnixMilli()
+	samples := make([]*Sample, 0)
+	for timestamp, sample := range store.samples[hardwareId] {
+		if timestamp >= fromTimestamp && timestamp <= toTimestamp {
+			samples = append(samples, sample.clone())
+		}
+	}
+	sort.Slice(samples, func(leftIndex, rightIndex int) bool { return samples[leftIndex].Time.Before(samples[rightIndex].Time) })
+	return samples, nil
+}
+
+func (store *memoryStore) Put(readings []*Reading) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	for _, reading := range readings {
+		if _, hardwareExists := store.samples[reading.HardwareId]; !hardwareExists {
+			store.samples[reading.HardwareId] = make(map[int64]*Sample)
+		}
+		timestamp := reading.Time.UnixMilli()
+		sample, sampleExists := store.samples[reading.HardwareId][timestamp]
+		if !sampleExists {
+			sample = &Sample{Time: time.UnixMilli(timestamp)}
+			store.samples[reading.HardwareId][timestamp] = sample
+		}
+		for metric, value := range reading.Values {
+			value := value
+			sample.SetValueByMetric(metric, &value)
+		}
+	}
+	return nil
+}
+
+func (store *memoryStore) Remove(hardwareId string, metric string, from time.Time, to time.Time) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	fromTimestamp, toTimestamp := from.UnixMilli(), to.UnixMilli()
+	for timestamp, sample := range store.samples[hardwareId] {
+		if timestamp >= fromTimestamp && timestamp <= toTimestamp {
+			sample.SetValueByMetric(metric, nil)
+		}
+	}
+	return nil
+}
+
+func (store *memoryStore) Close() error {
+	return nil
+}
+
+var backend Store
+
+// OpenStore opens the store configured in config.Current.Storage.
+func OpenStore() (Store, error) {
+	storage := config.Current.Storage
+	switch storage.Backend {
+	case "", config.StorageMemory:
+		return NewMemoryStore(), nil
+	case config.StorageFile:
+		return NewFileStore(storage.Path)
+	case config.StorageSQLite:
+		return NewSQLiteStore(storage.Path)
+	default:
+		return nil, fmt.Errorf(`unknown storage backend "%s"`, storage.Backend)
+	}
+}
+
+// UseStore makes store the backend samples are loaded from and written to.
+// The previous backend, if any, is closed.
+func UseStore(store Store) error {
+	if backend != nil {
+		if err := backend.Close(); err != nil {
+			return err
+		}
+	}
+	backend = store
+	return nil
+}
+
+// StoredHardwareIds lists the hardware the backend holds, which takes in
+// hardware other replicas added that this one has not seen yet.
+func StoredHardwareIds() ([]string, error) {
+	if backend == nil {
+		return nil, ErrNoStore
+	}
+	return backend.ListHardware()
+}
+
+// Close waits for queries loading from the backend and for readings being
+// persisted to the sample files, then closes the storage backend, so nothing
+// written is lost on exit.
+func Close() error {
+	storeMutex.Lock()
+	defer storeMutex.Unlock()
+	persistMutex.Lock()
+	defer persistMutex.Unlock()
+
+	return UseStore(nil)
+}
+
+// readingsOf turns samples back into readings, one per sample.
+func readingsOf(hardwareId string, samples map[int64]*Sample) []*Reading {
+	readings := make([]*Reading, 0, len(samples))
+	for _, sample := range samples {
+		reading := &Reading{HardwareId: hardwareId, Time: sample.Time, Values: make(map[string]float64)}
+		for _, metric := range Metrics() {
+			if value, _ := sample.ValueByMetric(metric); value != nil {
+				reading.Values[metric] = *value
+			}
+		}
+		readings = append(readings, reading)
+	}
+	return readings
+}
+
+// populateFromBackend fills the working set from the backend. A backend that
+// is still empty is seeded from the CSV tree first, so switching a deployment
+// over to a store only reads the CSV files once.
+func populateFromBackend(sampleTreePath string) error {
+	hardwareIds, err := backend.ListHardware()
+	if err != nil {
+		return fmt.Errorf(`unable to list stored hardware: %w`, err)
+	}
+
+	if len(hardwareIds) == 0 {
+		if err := populateFromSampleTree(sampleTreePath); err != nil {
+			return err
+		}
+		for hardwareId, samples := range hardware {
+			if store, isRegistrar := backend.(registrar); isRegistrar && len(samples) == 0 {
+				if err := store.Register(hardwareId); err != nil {
+					return fmt.Errorf(`unable to seed store with hardware "%s": %w`, hardwareId, err)
+				}
+				continue
+			}
+			if err := backend.Put(readingsOf(hardwareId, samples)); err != nil {
+				return fmt.Errorf(`unable to seed store with hardware "%s": %w`, hardwareId, err)
+			}
+		}
+		return nil
+	}
+
+	// Only the retained history is loaded; the rest is read back on demand
+	from := time.UnixMilli(0)
+	if retention := memoryRetention(); retention > 0 {
+		from = time.Now().Add(-retention)
+	}
+	for _, hardwareId := range hardwareIds {
+		samples, err := backend.LoadRange(hardwareId, from, time.UnixMilli(1<<62))
+		if err != nil {
+			return fmt.Errorf(`unable to load stored hardware "%s": %w`, hardwareId, err)
+		}
+		hardware[hardwareId] = make(map[int64]*Sample, len(samples))
+		for _, sample := range samples {
+			timestamp := sample.Time.UnixMilli()
+			hardware[hardwareId][timestamp] = sample
+			if timestamp > latestTimestamps[hardwareId] {
+				latestTimestamps[hardwareId] = timestamp
+			}
+		}
+	}
+	return nil
+}
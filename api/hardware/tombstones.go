@@ -0,0 +1,315 @@
+package hardware
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/fieldcrypt"
+)
+
+// Tombstone hides a time range of bad data from every query until compaction
+// removes it from the sample files for good. No metrics means all of them.
+type Tombstone struct {
+	Id         int64     `json:"id"`
+	HardwareId string    `json:"hardwareId"`
+	From       time.Time `json:"from"`
+	To         time.Time `json:"to"`
+	Metrics    []string  `json:"metrics,omitempty"`
+	Reason     string    `json:"reason,omitempty"`
+	CreatedAt  time.Time `json:"createdAt"`
+}
+
+var (
+	tombstonesMutex sync.RWMutex
+	tombstones      []*Tombstone = make([]*Tombstone, 0)
+	nextTombstoneId int64        = 1
+
+	loadedSamplesPath string
+)
+
+func tombstonesPath() string {
+	return filepath.Join(filepath.Dir(filepath.Clean(loadedSamplesPath)), "tombstones.json")
+}
+
+func (tombstone *Tombstone) covers(hardwareId string, metric string, timestamp int64) bool {
+	if tombstone.HardwareId != hardwareId || timestamp < tombstone.From.UnixMilli() || timestamp > tombstone.To.UnixMilli() {
+		return false
+	}
+	if len(tombstone.Metrics) == 0 {
+		return true
+	}
+	for _, tombstonedMetric := range tombstone.Metrics {
+		if tombstonedMetric == metric {
+			return true
+		}
+	}
+	return false
+}
+
+func isTombstoned(hardwareId string, metric string, timestamp int64) bool {
+	return isTombstonedAsOf(hardwareId, metric, timestamp, time.Time{})
+}
+
+// isTombstonedAsOf only counts the tombstones created by asOf, or every one
+// when asOf is zero.
+func isTombstonedAsOf(hardwareId string, metric string, timestamp int64, asOf time.Time) bool {
+	tombstonesMutex.RLock()
+	defer tombstonesMutex.RUnlock()
+
+	for _, tombstone := range tombstones {
+		if !asOf.IsZero() && tombstone.CreatedAt.After(asOf) {
+			continue
+		}
+		if tombstone.covers(hardwareId, metric, timestamp) {
+			return true
+		}
+	}
+	return false
+}
+
+func hasTombstones(hardwareId string) bool {
+	tombstonesMutex.RLock()
+	defer tombstonesMutex.RUnlock()
+
+	for _, tombstone := range tombstones {
+		if tombstone.HardwareId == hardwareId {
+			return true
+		}
+	}
+	return false
+}
+
+// withoutTombstoned returns the sample itself, a copy with tombstoned metrics
+// cleared, or nil when nothing is left of it.
+func withoutTombstoned(hardwareId string, sample *Sample) *Sample {
+	return withoutTombstonedAsOf(hardwareId, sample, time.Time{})
+}
+
+// withoutTombstonedAsOf is withoutTombstoned with the tombstones created by
+// asOf only.
+func withoutTombstonedAsOf(hardwareId string, sample *Sample, asOf time.Time) *Sample {
+	timestamp := sample.Time.UnixMilli()
+	var visibleSample *Sample
+	hasValues := false
+	for columnIndex, column := range columns {
+		if sample.valueOf(columnIndex) == nil {
+			continue
+		}
+		if isTombstonedAsOf(hardwareId, column.metric, timestamp, asOf) {
+			if visibleSample == nil {
+				visibleSample = sample.clone()
+			}
+			visibleSample.setValue(columnIndex, nil)
+		} else {
+			hasValues = true
+		}
+	}
+
+	switch {
+	case !hasValues:
+		return nil
+	case visibleSample != nil:
+		return visibleSample
+	default:
+		return sample
+	}
+}
+
+func Tombstones() []*Tombstone {
+	tombstonesMutex.RLock()
+	defer tombstonesMutex.RUnlock()
+
+	return append([]*Tombstone(nil), tombstones...)
+}
+
+func saveTombstones() error {
+	persistedTombstones := make([]*Tombstone, 0, len(tombstones))
+	for _, tombstone := range tombstones {
+		persistedTombstone := *tombstone
+		if err := fieldcrypt.EncryptFields("tombstone", &persistedTombstone); err != nil {
+			return fmt.Errorf(`unable to encrypt tombstone %d: %w`, tombstone.Id, err)
+		}
+		persistedTombstones = append(persistedTombstones, &persistedTombstone)
+	}
+
+	tombstonesBytes, err := json.MarshalIndent(persistedTombstones, "", "\t")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(tombstonesPath(), tombstonesBytes, 0644); err != nil {
+		return fmt.Errorf(`unable to save tombstones: %w`, err)
+	}
+	return nil
+}
+
+func loadTombstones() error {
+	tombstonesMutex.Lock()
+	defer tombstonesMutex.Unlock()
+
+	tombstones = make([]*Tombstone, 0)
+	tombstonesBytes, err := os.ReadFile(tombstonesPath())
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf(`unable to load tombstones: %w`, err)
+	}
+
+	if err := json.Unmarshal(tombstonesBytes, &tombstones); err != nil {
+		return fmt.Errorf(`unable to parse tombstones: %w`, err)
+	}
+	for _, tombstone := range tombstones {
+		if err := fieldcrypt.DecryptFields("tombstone", tombstone); err != nil {
+			return fmt.Errorf(`unable to decrypt tombstone %d: %w`, tombstone.Id, err)
+		}
+		if tombstone.Id >= nextTombstoneId {
+			nextTombstoneId = tombstone.Id + 1
+		}
+	}
+	return nil
+}
+
+func AddTombstone(tombstone *Tombstone) error {
+	if !HasSamples(tombstone.HardwareId) {
+		return unknownHardwareError(tombstone.HardwareId)
+	}
+	for _, metric := range tombstone.Metrics {
+		if !IsMetric(metric) {
+			return fmt.Errorf(`%w "%s"`, ErrUnknownMetric, metric)
+		}
+	}
+	if tombstone.To.Before(tombstone.From) {
+		return fmt.Errorf(`tombstone ends at %s before it starts at %s`, tombstone.To, tombstone.From)
+	}
+	ingestingMutex.RLock()
+	defer ingestingMutex.RUnlock()
+	locksMutex.RLock()
+	lock := lockOverlapping(tombstone.HardwareId, tombstone.From.UnixMilli(), tombstone.To.UnixMilli())
+	locksMutex.RUnlock()
+	if lock != nil {
+		return fmt.Errorf(`%w: tombstone reaches into lock %d of hardware "%s" from %s until %s`, ErrLocked, lock.Id, lock.HardwareId, lock.From.UTC().Format(time.RFC3339), lock.To.UTC().Format(time.RFC3339))
+	}
+
+	tombstonesMutex.Lock()
+	tombstone.Id = nextTombstoneId
+	tombstone.CreatedAt = time.Now()
+	nextTombstoneId++
+	tombstones = append(tombstones, tombstone)
+	saveErr := saveTombstones()
+	tombstonesMutex.Unlock()
+
+	storeMutex.Lock()
+	invalidateIndex(tombstone.HardwareId)
+	invalidateRollups(tombstone.HardwareId)
+	republishLatest(tombstone.HardwareId)
+	markUnjournaled(tombstone.HardwareId)
+	revision++
+	storeMutex.Unlock()
+	return saveErr
+}
+
+func compactSampleDataFile(hardwareId string, sampleDataName string, metric string) error {
+	sampleFilePath := filepath.Join(loadedSamplesPath, hardwareId, sampleDataName)
+	sampleTimestamps, sampleDataValues, err := readSampleDataFile(sampleFilePath)
+	if err != nil {
+		return err
+	}
+
+	compactedFilePath := sampleFilePath + ".compacting"
+	compactedFile, err := os.Create(compactedFilePath)
+	if err != nil {
+		return fmt.Errorf(`unable to create file "%s": %w`, compactedFilePath, err)
+	}
+	defer compactedFile.Close()
+
+	// Files hold times as reported, tombstones corrected ones
+	offsetMilliseconds := clockOffset(hardwareId).Milliseconds()
+	compactedWriter := csv.NewWriter(compactedFile)
+	for sampleIndex, sampleTimestamp := range sampleTimestamps {
+		if isTombstoned(hardwareId, metric, sampleTimestamp+offsetMilliseconds) {
+			continue
+		}
+		compactedWriter.Write([]string{strconv.FormatInt(sampleTimestamp, 10), strconv.FormatFloat(sampleDataValues[sampleIndex], 'f', -1, 64)})
+	}
+	compactedWriter.Flush()
+	if err := compactedWriter.Error(); err != nil {
+		return fmt.Errorf(`unable to write file "%s": %w`, compactedFilePath, err)
+	}
+	if err := compactedFile.Close(); err != nil {
+		return err
+	}
+	return os.Rename(compactedFilePath, sampleFilePath)
+}
+
+// CompactTombstones physically removes tombstoned values from the sample files
+// and from memory, forgets the tombstones it compacted and rebuilds every
+// index.
+func CompactTombstones() (int, error) {
+	storeMutex.Lock()
+	defer storeMutex.Unlock()
+
+	compactedTombstones := Tombstones()
+	for _, tombstone := range compactedTombstones {
+		for _, column := range columns {
+			if !tombstone.covers(tombstone.HardwareId, column.metric, tombstone.From.UnixMilli()) {
+				continue
+			}
+			if _, isUnavailable := unavailableMetrics[tombstone.HardwareId][column.metric]; isUnavailable {
+				continue
+			}
+			if err := compactSampleDataFile(tombstone.HardwareId, column.dataFile, column.metric); err != nil && !errors.Is(err, os.ErrNotExist) {
+				return 0, err
+			}
+			if backend != nil {
+				if err := backend.Remove(tombstone.HardwareId, column.metric, tombstone.From, tombstone.To); err != nil {
+					return 0, fmt.Errorf(`unable to remove tombstoned values from store: %w`, err)
+				}
+			}
+		}
+
+		for _, fileName := range wideSampleFiles[tombstone.HardwareId] {
+			if err := compactWideSampleFile(tombstone.HardwareId, fileName); err != nil && !errors.Is(err, os.ErrNotExist) {
+				return 0, err
+			}
+		}
+
+		for timestamp, sample := range hardware[tombstone.HardwareId] {
+			if visibleSample := withoutTombstoned(tombstone.HardwareId, sample); visibleSample == nil {
+				delete(hardware[tombstone.HardwareId], timestamp)
+			} else {
+				hardware[tombstone.HardwareId][timestamp] = visibleSample
+			}
+		}
+	}
+
+	// Tombstones added meanwhile are kept, for the next compaction to remove
+	isCompacted := make(map[int64]bool, len(compactedTombstones))
+	for _, tombstone := range compactedTombstones {
+		isCompacted[tombstone.Id] = true
+	}
+	tombstonesMutex.Lock()
+	remainingTombstones := make([]*Tombstone, 0)
+	for _, tombstone := range tombstones {
+		if !isCompacted[tombstone.Id] {
+			remainingTombstones = append(remainingTombstones, tombstone)
+		}
+	}
+	tombstones = remainingTombstones
+	saveErr := saveTombstones()
+	tombstonesMutex.Unlock()
+
+	rebuildIndexes()
+	invalidateAllRollups()
+	for _, tombstone := range compactedTombstones {
+		republishLatest(tombstone.HardwareId)
+	}
+	resetJournal(time.Now())
+	revision++
+	return len(compactedTombstones), saveErr
+}
@@ -0,0 +1,95 @@
+package hardware_test
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/hardware"
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/internal/fixtures"
+)
+
+// reloadFixtures writes the sample tree again and loads it, for tests that
+// change the sample files to leave them as the other tests expect.
+func reloadFixtures(t *testing.T) {
+	samplesPath := filepath.Join(fixtures.Directory, "samples")
+	if err := fixtures.Write(samplesPath); err != nil {
+		t.Fatal(err)
+	}
+	if err := hardware.PopulateSamplesFrom(samplesPath); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTombstones(t *testing.T) {
+	defer reloadFixtures(t)
+
+	for what, tombstone := range map[string]*hardware.Tombstone{
+		"a tombstone of unknown hardware":     {HardwareId: "unknown", From: fixtures.Minute(15), To: fixtures.Minute(16)},
+		"a tombstone of an unknown metric":    {HardwareId: fixtures.HardwareId, From: fixtures.Minute(15), To: fixtures.Minute(16), Metrics: []string{"unknown"}},
+		"a tombstone ending before it starts": {HardwareId: fixtures.HardwareId, From: fixtures.Minute(16), To: fixtures.Minute(15)},
+	} {
+		if err := hardware.AddTombstone(tombstone); err == nil {
+			t.Errorf(`%s was added`, what)
+		}
+	}
+
+	// Temperatures from minute 15 to 17, and everything at minutes 20 and 21
+	if err := hardware.AddTombstone(&hardware.Tombstone{HardwareId: fixtures.HardwareId, From: fixtures.Minute(15), To: fixtures.Minute(17), Metrics: []string{"temperature"}, Reason: "sensor unplugged"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := hardware.AddTombstone(&hardware.Tombstone{HardwareId: fixtures.HardwareId, From: fixtures.Minute(20), To: fixtures.Minute(21)}); err != nil {
+		t.Fatal(err)
+	}
+	expectHidden := func(when string) {
+		samples, err := hardware.SamplesBetween(fixtures.HardwareId, fixtures.Minute(14), fixtures.Minute(22))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(samples) != 7 {
+			t.Errorf(`%s: expected 7 samples left between minutes 14 and 22, got %d`, when, len(samples))
+		}
+		if count, err := hardware.CountRawSamples(fixtures.HardwareId, fixtures.Minute(14), fixtures.Minute(22)); err != nil || count != 6 {
+			t.Errorf(`%s: expected 6 samples counted from minute 14 until 22, got %d and %v`, when, count, err)
+		}
+		for _, sample := range samples {
+			minutes := sample.Time.Sub(fixtures.Start).Minutes()
+			temperature, _ := sample.ValueByMetric("temperature")
+			rmsVelocityX, _ := sample.ValueByMetric("rmsVelocityX")
+			if (temperature != nil) == (minutes >= 15 && minutes <= 17) || rmsVelocityX == nil {
+				t.Errorf(`%s: unexpected values at minute %g`, when, minutes)
+			}
+		}
+	}
+	expectHidden("tombstoned")
+
+	// Tombstones outlive a reload until they are compacted
+	if err := hardware.PopulateSamplesFrom(filepath.Join(fixtures.Directory, "samples")); err != nil {
+		t.Fatal(err)
+	}
+	if tombstones := hardware.Tombstones(); len(tombstones) != 2 || tombstones[0].Reason != "sensor unplugged" {
+		t.Fatalf(`expected both tombstones back, got %v`, tombstones)
+	}
+	expectHidden("reloaded")
+
+	compactedTombstones, err := hardware.CompactTombstones()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if compactedTombstones != 2 || len(hardware.Tombstones()) != 0 {
+		t.Errorf(`expected 2 tombstones compacted and none left, got %d and %v`, compactedTombstones, hardware.Tombstones())
+	}
+	expectHidden("compacted")
+
+	temperatureBytes, err := os.ReadFile(filepath.Join(fixtures.Directory, "samples", fixtures.HardwareId, "temperature.csv"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, minutes := range []float64{15, 17, 20, 21} {
+		if strings.Contains(string(temperatureBytes), strconv.FormatInt(fixtures.Minute(minutes).UnixMilli(), 10)) {
+			t.Errorf(`expected the temperature at minute %g removed from its file`, minutes)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package hardware
+
+import (
+	"strings"
+
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/config"
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/units"
+)
+
+// UnitOf names the unit a metric's values are held and served in.
+func UnitOf(metric string) (string, bool) {
+	columnIndex, hasColumn := columnsByMetric[metric]
+	if !hasColumn {
+		return "", false
+	}
+	return columns[columnIndex].unit, true
+}
+
+// sourceUnit works out which sample file a file in the tree stands for and
+// the unit its values are in. A file a metric registers is in the unit
+// configured in SourceUnits, or else already in the unit of its metric. One
+// named like temperature_f.csv, when only temperature.csv is registered, is
+// that file in °F. An empty unit needs no conversion.
+func sourceUnit(hardwareId string, sampleDataName string) (string, string) {
+	if columnIndex, isDataFile := columnsByDataFile[sampleDataName]; isDataFile {
+		return sampleDataName, config.Current.SourceUnits[hardwareId][columns[columnIndex].metric]
+	}
+
+	baseName := strings.TrimSuffix(sampleDataName, ".csv")
+	if separator := strings.LastIndex(baseName, "_"); separator > 0 {
+		suffixedDataName, suffix := baseName[:separator]+".csv", baseName[separator+1:]
+		if _, isUnit := units.Lookup(suffix); isUnit {
+			if _, isDataFile := columnsByDataFile[suffixedDataName]; isDataFile {
+				return suffixedDataName, suffix
+			}
+		}
+	}
+	return sampleDataName, ""
+}
+
+// convertToMetricUnit converts values read from a sample file in
+// fromUnit, in place, to the unit of the metric the file feeds.
+func convertToMetricUnit(sampleDataName string, fromUnit string, values []float64) error {
+	columnIndex, isDataFile := columnsByDataFile[sampleDataName]
+	if !isDataFile || fromUnit == "" {
+		return nil
+	}
+	toUnit := columns[columnIndex].unit
+	if fromUnit == toUnit {
+		return nil
+	}
+
+	convert, err := units.Converter(fromUnit, toUnit)
+	if err != nil {
+		return err
+	}
+	for valueIndex := range values {
+		values[valueIndex] = convert(values[valueIndex])
+	}
+	return nil
+}
+
+// persistedDataName names the file readings of a metric are appended to.
+// Readings are in the unit of the metric, so when the hardware's plain file
+// is configured to be in another unit they go to a file suffixed with the
+// metric's own unit instead.
+func persistedDataName(hardwareId string, columnIndex int) string {
+	column := columns[columnIndex]
+	if configuredUnit := config.Current.SourceUnits[hardwareId][column.metric]; configuredUnit != "" && configuredUnit != column.unit {
+		return strings.TrimSuffix(column.dataFile, ".csv") + "_" + column.unit + ".csv"
+	}
+	return column.dataFile
+}
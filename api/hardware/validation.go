@@ -0,0 +1,93 @@
+package hardware
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/timeseries"
+)
+
+type InterpolationError struct {
+	Metric              string  `json:"metric"`
+	Count               int     `json:"count"`
+	MeanAbsoluteError   float64 `json:"meanAbsoluteError"`
+	RootMeanSquareError float64 `json:"rootMeanSquareError"`
+}
+
+// ValidateInterpolation holds out a random fraction of the real samples of a
+// hardware, interpolates them back from the remainder with interpolator and
+// reports the error per metric.
+func ValidateInterpolation(hardwareId string, holdoutFraction float64, random *rand.Rand, interpolator timeseries.Interpolator) ([]*InterpolationError, error) {
+	// Held for writing throughout, as the working set is swapped out meanwhile
+	storeMutex.Lock()
+	defer storeMutex.Unlock()
+
+	if !hasSamples(hardwareId) {
+		return nil, unknownHardwareError(hardwareId)
+	}
+	if holdoutFraction <= 0 || holdoutFraction >= 1 {
+		return nil, fmt.Errorf(`holdout fraction %f is not between 0 and 1`, holdoutFraction)
+	}
+
+	allSamples := hardware[hardwareId]
+	remainingSamples := make(map[int64]*Sample, len(allSamples))
+	holdoutSamples := make([]*Sample, 0)
+	// Walked in time order, so a seed always holds out the same samples
+	timestamps := make([]int64, 0, len(allSamples))
+	for timestamp := range allSamples {
+		timestamps = append(timestamps, timestamp)
+	}
+	sort.Slice(timestamps, func(leftIndex, rightIndex int) bool { return timestamps[leftIndex] < timestamps[rightIndex] })
+	for _, timestamp := range timestamps {
+		sample := allSamples[timestamp]
+		if random.Float64() < holdoutFraction {
+			holdoutSamples = append(holdoutSamples, sample)
+		} else {
+			remainingSamples[timestamp] = sample
+		}
+	}
+
+	hardware[hardwareId] = remainingSamples
+	invalidateIndex(hardwareId)
+	defer func() {
+		hardware[hardwareId] = allSamples
+		invalidateIndex(hardwareId)
+	}()
+
+	interpolationErrors := make([]*InterpolationError, 0)
+	absoluteErrorSums := make(map[string]float64)
+	squareErrorSums := make(map[string]float64)
+	for _, metric := range Metrics() {
+		interpolationErrors = append(interpolationErrors, &InterpolationError{Metric: metric})
+	}
+
+	for _, holdoutSample := range holdoutSamples {
+		interpolatedSample, err := interpolateSample(hardwareId, holdoutSample.Time, interpolator, nil)
+		if err != nil {
+			continue
+		}
+
+		for _, interpolationError := range interpolationErrors {
+			actual, _ := holdoutSample.ValueByMetric(interpolationError.Metric)
+			predicted, _ := interpolatedSample.ValueByMetric(interpolationError.Metric)
+			if actual == nil || predicted == nil {
+				continue
+			}
+
+			difference := *predicted - *actual
+			absoluteErrorSums[interpolationError.Metric] += math.Abs(difference)
+			squareErrorSums[interpolationError.Metric] += difference * difference
+			interpolationError.Count++
+		}
+	}
+
+	for _, interpolationError := range interpolationErrors {
+		if interpolationError.Count > 0 {
+			interpolationError.MeanAbsoluteError = absoluteErrorSums[interpolationError.Metric] / float64(interpolationError.Count)
+			interpolationError.RootMeanSquareError = math.Sqrt(squareErrorSums[interpolationError.Metric] / float64(interpolationError.Count))
+		}
+	}
+	return interpolationErrors, nil
+}
@@ -0,0 +1,116 @@
+package hardware
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/csvparse"
+)
+
+// RowError reports a single unusable row; reading can carry on past it.
+type RowError struct {
+	Line int
+	Err  error
+}
+
+func (rowError *RowError) Error() string {
+	return fmt.Sprintf(`line %d: %v`, rowError.Line, rowError.Err)
+}
+
+func (rowError *RowError) Unwrap() error {
+	return rowError.Err
+}
+
+// WideCSVReader streams readings out of CSV whose header is "timestamp", an
+// optional "hardwareId" column, and then one column per channel, headed the
+// way MetricOfHeading resolves. Rows are read in the dialect options give.
+type WideCSVReader struct {
+	csvParser         *csvparse.Reader
+	defaultHardwareId string
+	// metricsByColumn are empty for columns to skip
+	metricsByColumn  []string
+	hardwareIdColumn int
+}
+
+func NewWideCSVReader(reader io.Reader, defaultHardwareId string, options csvparse.Options) (*WideCSVReader, error) {
+	csvParser, err := csvparse.NewReader(reader, options)
+	if err != nil {
+		return nil, err
+	}
+
+	header, err := csvParser.Read()
+	if err != nil {
+		return nil, fmt.Errorf(`unable to read CSV header: %w`, err)
+	}
+
+	wideReader := &WideCSVReader{csvParser: csvParser, defaultHardwareId: defaultHardwareId, metricsByColumn: make([]string, len(header)), hardwareIdColumn: -1}
+	for column := 1; column < len(header); column++ {
+		if header[column] == "hardwareId" {
+			wideReader.hardwareIdColumn = column
+			continue
+		}
+		metric, isKnown := MetricOfHeading(header[column])
+		if !isKnown {
+			return nil, fmt.Errorf(`%w "%s" in CSV header`, ErrUnknownMetric, header[column])
+		}
+		wideReader.metricsByColumn[column] = metric
+	}
+	if wideReader.hardwareIdColumn < 0 && defaultHardwareId == "" {
+		return nil, fmt.Errorf(`CSV has no hardwareId column and no hardware was given`)
+	}
+	return wideReader, nil
+}
+
+// Metrics lists the metrics the columns hold, in their order.
+func (wideReader *WideCSVReader) Metrics() []string {
+	metrics := make([]string, 0, len(wideReader.metricsByColumn))
+	for _, metric := range wideReader.metricsByColumn {
+		if metric != "" {
+			metrics = append(metrics, metric)
+		}
+	}
+	return metrics
+}
+
+// Next returns io.EOF when done, a *RowError for a row that should be
+// skipped, or any other error when the stream itself is broken.
+func (wideReader *WideCSVReader) Next() (*Reading, error) {
+	row, err := wideReader.csvParser.Read()
+	if err != nil {
+		var parseErr *csvparse.ParseError
+		if errors.As(err, &parseErr) {
+			return nil, &RowError{Line: parseErr.Line, Err: parseErr.Err}
+		}
+		return nil, err
+	}
+	line := wideReader.csvParser.Line()
+
+	timestamp, err := wideReader.csvParser.ParseTimestamp(row[0])
+	if err != nil {
+		return nil, &RowError{Line: line, Err: fmt.Errorf(`cannot convert timestamp "%s": %w`, row[0], err)}
+	}
+
+	reading := &Reading{HardwareId: wideReader.defaultHardwareId, Time: timestamp, Values: make(map[string]float64)}
+	for column := 1; column < len(row) && column < len(wideReader.metricsByColumn); column++ {
+		if column == wideReader.hardwareIdColumn {
+			if row[column] != "" {
+				reading.HardwareId = row[column]
+			}
+			continue
+		}
+		if row[column] == "" || wideReader.metricsByColumn[column] == "" {
+			continue
+		}
+
+		value, err := wideReader.csvParser.ParseNumber(row[column])
+		if err != nil {
+			return nil, &RowError{Line: line, Err: fmt.Errorf(`cannot convert value: %w`, err)}
+		}
+		reading.Values[wideReader.metricsByColumn[column]] = value
+	}
+	if reading.HardwareId == "" {
+		return nil, &RowError{Line: line, Err: fmt.Errorf(`row has no hardware`)}
+	}
+	return reading, nil
+}
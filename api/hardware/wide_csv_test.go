@@ -0,0 +1,59 @@
+package hardware_test
+
+import (
+	"errors"
+	"io"
+	"math"
+	"strings"
+	"testing"
+	"time"
+	_ "time/tzdata"
+
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/csvparse"
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/hardware"
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/internal/fixtures"
+)
+
+func TestWideCSVReader(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	german := "timestamp;temperature\n\"01.07.2022 02:00:00\";\"20,5\"\n01.07.2022 02:01:00; 21 \n"
+	wideReader, err := hardware.NewWideCSVReader(strings.NewReader(german), fixtures.HardwareId, csvparse.Options{Delimiter: ";", DecimalSeparator: ",", TimestampFormat: "02.01.2006 15:04:05", Location: berlin})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for minute, expected := range []float64{20.5, 21} {
+		reading, err := wideReader.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reading.Time.Equal(fixtures.Minute(float64(minute))) {
+			t.Errorf(`row %d read at %s`, minute+1, reading.Time.UTC())
+		}
+		if math.Abs(reading.Values["temperature"]-expected) > 1e-6 {
+			t.Errorf(`temperature of row %d read as %g, not %g`, minute+1, reading.Values["temperature"], expected)
+		}
+	}
+}
+
+func TestWideCSVReaderRefuses(t *testing.T) {
+	unquoted := "timestamp,temperature\n1656633600,\"20\n"
+	wideReader, err := hardware.NewWideCSVReader(strings.NewReader(unquoted), fixtures.HardwareId, csvparse.Options{Quoting: csvparse.QuotingNone, TimestampFormat: csvparse.TimestampUnixSeconds})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reading, err := wideReader.Next(); err == nil {
+		t.Errorf(`unquoted "20 was read as %v`, reading.Values)
+	}
+
+	endless := strings.NewReader("timestamp,temperature\n" + strings.Repeat("1", csvparse.MaxRecordBytes+1))
+	wideReader, err = hardware.NewWideCSVReader(endless, fixtures.HardwareId, csvparse.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := wideReader.Next(); err == nil || errors.Is(err, io.EOF) {
+		t.Errorf(`a record of %d bytes was read`, csvparse.MaxRecordBytes+1)
+	}
+}
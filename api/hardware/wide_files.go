@@ -0,0 +1,200 @@
+package hardware
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/config"
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/csvparse"
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/units"
+)
+
+// wideSampleFiles are keyed by hardware, listing the wide files of its
+// directory that were loaded, so compaction rewrites them too.
+var wideSampleFiles = make(map[string][]string)
+
+// isWideSampleFile tells a CSV file no metric registers apart from anything
+// else in a hardware directory by its header, which starts with "timestamp".
+func isWideSampleFile(sampleFilePath string) bool {
+	if !strings.EqualFold(filepath.Ext(sampleFilePath), ".csv") {
+		return false
+	}
+	sampleFile, err := os.Open(sampleFilePath)
+	if err != nil {
+		return false
+	}
+	defer sampleFile.Close()
+
+	csvParser, err := csvparse.NewReader(sampleFile, csvparse.Options{})
+	if err != nil {
+		return false
+	}
+	header, err := csvParser.Read()
+	return err == nil && len(header) > 1 && strings.EqualFold(header[0], "timestamp")
+}
+
+// loadWideSampleFile reads a wide file in the directory of a hardware, one
+// column per channel. Like a per-channel file, a corrupt one only takes the
+// channels it holds down.
+func loadWideSampleFile(hardwareId string, sampleFilePath string) {
+	sampleFile, err := os.Open(sampleFilePath)
+	if err != nil {
+		markUnavailable(hardwareId, filepath.Base(sampleFilePath), fmt.Errorf(`unable to open file %s: %w`, sampleFilePath, err))
+		return
+	}
+	defer sampleFile.Close()
+
+	wideReader, err := NewWideCSVReader(sampleFile, hardwareId, csvparse.Options{})
+	if err != nil {
+		markUnavailable(hardwareId, filepath.Base(sampleFilePath), fmt.Errorf(`hardware data file "%s": %w`, sampleFilePath, err))
+		return
+	}
+	fileMetrics := wideReader.Metrics()
+	markFileUnavailable := func(reason error) {
+		for _, metric := range fileMetrics {
+			markUnavailable(hardwareId, metric, fmt.Errorf(`hardware data file "%s": %w`, sampleFilePath, reason))
+		}
+	}
+
+	converters := make(map[string]func(float64) float64)
+	for _, metric := range fileMetrics {
+		fromUnit := config.Current.SourceUnits[hardwareId][metric]
+		if toUnit, _ := UnitOf(metric); fromUnit == "" || fromUnit == toUnit {
+			continue
+		} else if converters[metric], err = units.Converter(fromUnit, toUnit); err != nil {
+			markFileUnavailable(err)
+			return
+		}
+	}
+
+	// Nothing is stored until the whole file has been read
+	readings := make([]*Reading, 0)
+	for {
+		reading, err := wideReader.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			markFileUnavailable(err)
+			return
+		}
+		if reading.HardwareId != hardwareId {
+			markFileUnavailable(fmt.Errorf(`row of hardware "%s" among the files of hardware "%s"`, reading.HardwareId, hardwareId))
+			return
+		}
+		readings = append(readings, reading)
+	}
+
+	offsetMilliseconds := clockOffset(hardwareId).Milliseconds()
+	for _, reading := range readings {
+		sampleTimestamp := reading.Time.UnixMilli() + offsetMilliseconds
+		sample, sampleExists := hardware[hardwareId][sampleTimestamp]
+		if !sampleExists {
+			sample = &Sample{Time: time.UnixMilli(sampleTimestamp)}
+			hardware[hardwareId][sampleTimestamp] = sample
+		}
+		if sampleTimestamp > latestTimestamps[hardwareId] {
+			latestTimestamps[hardwareId] = sampleTimestamp
+		}
+
+		for metric, value := range reading.Values {
+			value := value
+			if convert, hasConverter := converters[metric]; hasConverter {
+				value = convert(value)
+			}
+			sample.SetValueByMetric(metric, &value)
+		}
+	}
+	wideSampleFiles[hardwareId] = append(wideSampleFiles[hardwareId], filepath.Base(sampleFilePath))
+}
+
+// readRows reads every record of a sample file.
+func readRows(reader io.Reader) ([][]string, error) {
+	csvParser, err := csvparse.NewReader(reader, csvparse.Options{})
+	if err != nil {
+		return nil, err
+	}
+	rows := make([][]string, 0)
+	for {
+		row, err := csvParser.Read()
+		if errors.Is(err, io.EOF) {
+			return rows, nil
+		} else if err != nil {
+			return nil, err
+		}
+		rows = append(rows, append([]string(nil), row...))
+	}
+}
+
+// compactWideSampleFile blanks the tombstoned cells of a wide file, dropping
+// rows left without any value.
+func compactWideSampleFile(hardwareId string, fileName string) error {
+	sampleFilePath := filepath.Join(loadedSamplesPath, hardwareId, fileName)
+	sampleFile, err := os.Open(sampleFilePath)
+	if err != nil {
+		return fmt.Errorf(`unable to open file %s: %w`, sampleFilePath, err)
+	}
+	rows, err := readRows(sampleFile)
+	sampleFile.Close()
+	if err != nil {
+		return fmt.Errorf(`unable to read hardware data file "%s": %w`, sampleFilePath, err)
+	}
+	if len(rows) == 0 {
+		return nil
+	}
+
+	metricsByColumn := make([]string, len(rows[0]))
+	for column := 1; column < len(rows[0]); column++ {
+		if rows[0][column] != "hardwareId" {
+			metricsByColumn[column], _ = MetricOfHeading(rows[0][column])
+		}
+	}
+
+	// Files hold times as reported, tombstones corrected ones
+	offsetMilliseconds := clockOffset(hardwareId).Milliseconds()
+	compactedRows := [][]string{rows[0]}
+	for _, row := range rows[1:] {
+		sampleTimestamp, err := strconv.ParseInt(row[0], 10, 64)
+		if err != nil {
+			return fmt.Errorf(`cannot convert timestamp "%s" in hardware data file "%s": %w`, row[0], sampleFilePath, err)
+		}
+		hasValues := false
+		for column := 1; column < len(row) && column < len(metricsByColumn); column++ {
+			metric := metricsByColumn[column]
+			if metric == "" || row[column] == "" {
+				continue
+			}
+			if isTombstoned(hardwareId, metric, sampleTimestamp+offsetMilliseconds) {
+				row[column] = ""
+			} else {
+				hasValues = true
+			}
+		}
+		if hasValues {
+			compactedRows = append(compactedRows, row)
+		}
+	}
+
+	compactedFilePath := sampleFilePath + ".compacting"
+	compactedFile, err := os.Create(compactedFilePath)
+	if err != nil {
+		return fmt.Errorf(`unable to create file "%s": %w`, compactedFilePath, err)
+	}
+	defer compactedFile.Close()
+
+	compactedWriter := csv.NewWriter(compactedFile)
+	compactedWriter.WriteAll(compactedRows)
+	if err := compactedWriter.Error(); err != nil {
+		return fmt.Errorf(`unable to write file "%s": %w`, compactedFilePath, err)
+	}
+	if err := compactedFile.Close(); err != nil {
+		return err
+	}
+	return os.Rename(compactedFilePath, sampleFilePath)
+}
@@ -0,0 +1,195 @@
+package hardware
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/config"
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/xlsx"
+)
+
+// unixMillisecondsFloor tells Unix milliseconds apart from date serial
+// numbers, which stay far below it for any date Excel can hold.
+const unixMillisecondsFloor = 1e11
+
+// sheetLayout is where the columns of a sheet are, below its header row.
+type sheetLayout struct {
+	sheet            *xlsx.Sheet
+	headerRow        int
+	timestampColumn  int
+	hardwareIdColumn int
+	metricsByColumn  map[int]string
+}
+
+// WorkbookReader streams readings out of the sheets of an XLSX workbook, as
+// config.Workbooks maps them, one sheet after the other.
+type WorkbookReader struct {
+	defaultHardwareId string
+	epoch             time.Time
+	layouts           []*sheetLayout
+
+	layoutIndex int
+	rowIndex    int
+}
+
+// layoutOf works out the columns of a sheet from its header row, the first
+// with any cell, returning nil for sheets to skip.
+func layoutOf(sheet *xlsx.Sheet, workbooks config.Workbooks) (*sheetLayout, error) {
+	sheetMetric, isChannelSheet := workbooks.Sheets[sheet.Name]
+	if isChannelSheet && sheetMetric == "" {
+		return nil, nil
+	}
+	headerRow := 0
+	for headerRow < len(sheet.Rows) && len(sheet.Rows[headerRow]) == 0 {
+		headerRow++
+	}
+	if headerRow == len(sheet.Rows) {
+		return nil, nil
+	}
+
+	layout := &sheetLayout{sheet: sheet, headerRow: headerRow, timestampColumn: -1, hardwareIdColumn: -1, metricsByColumn: make(map[int]string)}
+	for column, heading := range sheet.Rows[headerRow] {
+		heading = strings.TrimSpace(heading)
+		switch {
+		case heading == "":
+		case strings.EqualFold(heading, workbooks.TimestampColumn):
+			layout.timestampColumn = column
+		case heading == "hardwareId":
+			layout.hardwareIdColumn = column
+		case isChannelSheet:
+			if len(layout.metricsByColumn) == 0 {
+				layout.metricsByColumn[column] = sheetMetric
+			}
+		default:
+			metric, isKnown := MetricOfHeading(heading)
+			if !isKnown {
+				return nil, fmt.Errorf(`%w "%s" in the header of sheet "%s"`, ErrUnknownMetric, heading, sheet.Name)
+			}
+			if metric != "" {
+				layout.metricsByColumn[column] = metric
+			}
+		}
+	}
+
+	if layout.timestampColumn < 0 {
+		if !isChannelSheet {
+			return nil, fmt.Errorf(`sheet "%s" has no "%s" column`, sheet.Name, workbooks.TimestampColumn)
+		}
+		// Channel sheets may head their columns however they like
+		layout.timestampColumn = 0
+		delete(layout.metricsByColumn, 0)
+		if len(layout.metricsByColumn) == 0 && len(sheet.Rows[headerRow]) > 1 {
+			layout.metricsByColumn[1] = sheetMetric
+		}
+	}
+	if len(layout.metricsByColumn) == 0 {
+		return nil, fmt.Errorf(`sheet "%s" has no column of values`, sheet.Name)
+	}
+	return layout, nil
+}
+
+func NewWorkbookReader(workbook *xlsx.Workbook, defaultHardwareId string) (*WorkbookReader, error) {
+	workbooks := config.Current.Ingestion.Workbooks
+	location := config.Current.Location()
+	workbookReader := &WorkbookReader{defaultHardwareId: defaultHardwareId, epoch: time.Date(1899, 12, 30, 0, 0, 0, 0, location)}
+	if workbook.Date1904 {
+		workbookReader.epoch = time.Date(1904, 1, 1, 0, 0, 0, 0, location)
+	}
+
+	for _, sheet := range workbook.Sheets {
+		layout, err := layoutOf(sheet, workbooks)
+		if err != nil {
+			return nil, err
+		}
+		if layout == nil {
+			continue
+		}
+		if layout.hardwareIdColumn < 0 && defaultHardwareId == "" {
+			return nil, fmt.Errorf(`sheet "%s" has no hardwareId column and no hardware was given`, sheet.Name)
+		}
+		workbookReader.layouts = append(workbookReader.layouts, layout)
+	}
+	if len(workbookReader.layouts) == 0 {
+		return nil, fmt.Errorf(`workbook has no sheet of readings`)
+	}
+	return workbookReader, nil
+}
+
+// timeOf reads a timestamp cell: a date serial number, counted in days from
+// the workbook's epoch in the plant's time zone, Unix milliseconds, or RFC
+// 3339 text.
+func (workbookReader *WorkbookReader) timeOf(cell string) (time.Time, error) {
+	number, err := strconv.ParseFloat(cell, 64)
+	switch {
+	case err != nil:
+		return time.Parse(time.RFC3339, cell)
+	case number >= unixMillisecondsFloor:
+		return time.UnixMilli(int64(number)), nil
+	case number < 0 || math.IsNaN(number):
+		return time.Time{}, fmt.Errorf(`date serial number %s is out of range`, cell)
+	default:
+		days, fraction := math.Modf(number)
+		return workbookReader.epoch.AddDate(0, 0, int(days)).Add(time.Duration(fraction * float64(24*time.Hour)).Round(time.Millisecond)), nil
+	}
+}
+
+// Next returns io.EOF when done, or a *RowError for a row that should be
+// skipped. Lines of row errors are row numbers within their sheet.
+func (workbookReader *WorkbookReader) Next() (*Reading, error) {
+	for workbookReader.layoutIndex < len(workbookReader.layouts) {
+		layout := workbookReader.layouts[workbookReader.layoutIndex]
+		if workbookReader.rowIndex <= layout.headerRow {
+			workbookReader.rowIndex = layout.headerRow + 1
+		}
+		if workbookReader.rowIndex >= len(layout.sheet.Rows) {
+			workbookReader.layoutIndex++
+			workbookReader.rowIndex = 0
+			continue
+		}
+		rowIndex := workbookReader.rowIndex
+		workbookReader.rowIndex++
+		row := layout.sheet.Rows[rowIndex]
+		if len(row) == 0 {
+			continue
+		}
+
+		rowError := func(format string, arguments ...interface{}) error {
+			return &RowError{Line: rowIndex + 1, Err: fmt.Errorf(`sheet "%s": %s`, layout.sheet.Name, fmt.Sprintf(format, arguments...))}
+		}
+		cellOf := func(column int) string {
+			if column < 0 || column >= len(row) {
+				return ""
+			}
+			return strings.TrimSpace(row[column])
+		}
+
+		timestamp, err := workbookReader.timeOf(cellOf(layout.timestampColumn))
+		if err != nil {
+			return nil, rowError(`cannot convert timestamp "%s": %v`, cellOf(layout.timestampColumn), err)
+		}
+		reading := &Reading{HardwareId: workbookReader.defaultHardwareId, Time: timestamp, Values: make(map[string]float64)}
+		if hardwareId := cellOf(layout.hardwareIdColumn); hardwareId != "" {
+			reading.HardwareId = hardwareId
+		}
+		if reading.HardwareId == "" {
+			return nil, rowError(`row has no hardware`)
+		}
+		for column, metric := range layout.metricsByColumn {
+			cell := cellOf(column)
+			if cell == "" {
+				continue
+			}
+			value, err := strconv.ParseFloat(cell, 64)
+			if err != nil {
+				return nil, rowError(`cannot convert value "%s": %v`, cell, err)
+			}
+			reading.Values[metric] = value
+		}
+		return reading, nil
+	}
+	return nil, io.EOF
+}
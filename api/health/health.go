@@ -0,0 +1,59 @@
+// Package health classifies metric values against configured limits and
+// condenses them into a per-hardware health score.
+package health
+
+import (
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/hardware"
+)
+
+const (
+	StateUnknown  = "unknown"
+	StateOK       = "ok"
+	StateWarning  = "warning"
+	StateCritical = "critical"
+
+	warningPenalty  = 20
+	criticalPenalty = 50
+)
+
+// StateOf classifies one metric value against its configured limits.
+func StateOf(hardwareId string, metric string, value float64) string {
+	limits, hasLimits := hardware.LimitsFor(hardwareId, metric)
+	switch {
+	case !hasLimits:
+		return StateUnknown
+	case limits.Critical != nil && value >= *limits.Critical:
+		return StateCritical
+	case limits.Warning != nil && value >= *limits.Warning:
+		return StateWarning
+	default:
+		return StateOK
+	}
+}
+
+// Score starts every hardware at 100 and takes points off for each metric past
+// its warning or critical limit, giving a rough 0-100 health figure along with
+// the worst state found.
+func Score(hardwareId string, values map[string]float64) (int, string) {
+	score, worstState := 100, StateUnknown
+	for metric, value := range values {
+		switch state := StateOf(hardwareId, metric, value); state {
+		case StateCritical:
+			score -= criticalPenalty
+			worstState = StateCritical
+		case StateWarning:
+			score -= warningPenalty
+			if worstState != StateCritical {
+				worstState = StateWarning
+			}
+		case StateOK:
+			if worstState == StateUnknown {
+				worstState = StateOK
+			}
+		}
+	}
+	if score < 0 {
+		score = 0
+	}
+	return score, worstState
+}
@@ -0,0 +1,59 @@
+package health
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ZoneA is where a machine class is until its RMS velocity reaches zone B.
+const ZoneA = "A"
+
+// iso10816Zones holds, per machine class, the RMS velocity in mm/s at which
+// zones B, C and D of ISO 10816-1 begin.
+var iso10816Zones = map[string]map[string]float64{
+	"I":   {"B": 0.71, "C": 1.8, "D": 4.5},
+	"II":  {"B": 1.12, "C": 2.8, "D": 7.1},
+	"III": {"B": 1.8, "C": 4.5, "D": 11.2},
+	"IV":  {"B": 2.8, "C": 7.1, "D": 18},
+}
+
+func iso10816ZonesOf(machineClass string) (map[string]float64, error) {
+	zones, hasClass := iso10816Zones[machineClass]
+	if !hasClass {
+		return nil, fmt.Errorf(`unknown ISO 10816 machine class "%s"`, machineClass)
+	}
+	return zones, nil
+}
+
+// ISO10816Threshold is the RMS velocity in mm/s at which a zone of a machine
+// class, given like "II/C", begins.
+func ISO10816Threshold(classAndZone string) (float64, error) {
+	machineClass, zone, hasSeparator := strings.Cut(classAndZone, "/")
+	if !hasSeparator {
+		return 0, fmt.Errorf(`ISO 10816 zone "%s" is not of the form "class/zone"`, classAndZone)
+	}
+	zones, err := iso10816ZonesOf(machineClass)
+	if err != nil {
+		return 0, err
+	}
+	threshold, hasZone := zones[zone]
+	if !hasZone {
+		return 0, fmt.Errorf(`unknown ISO 10816 zone "%s"`, zone)
+	}
+	return threshold, nil
+}
+
+// ISO10816Zone places an RMS velocity in mm/s in the zones of a machine class.
+func ISO10816Zone(machineClass string, velocity float64) (string, error) {
+	zones, err := iso10816ZonesOf(machineClass)
+	if err != nil {
+		return "", err
+	}
+	zone, zoneThreshold := ZoneA, 0.0
+	for candidateZone, threshold := range zones {
+		if velocity >= threshold && threshold >= zoneThreshold {
+			zone, zoneThreshold = candidateZone, threshold
+		}
+	}
+	return zone, nil
+}
@@ -0,0 +1,433 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/config"
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/csvparse"
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/hardware"
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/metrics"
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/xlsx"
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/internal/auth"
+)
+
+const (
+	ingestBatchSize     = 1000
+	ingestReportedFails = 20
+
+	workbookMediaType = "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+)
+
+var (
+	ingestRejectedRowCounter = metrics.NewCounter("ingest_rows_rejected_total")
+	ingestFailureCounter     = metrics.NewCounter("ingest_failures_total")
+)
+
+// IngestResponseData summarizes an ingestion. Failure is why it stopped
+// early, once RowsAccepted rows were already stored; they stay stored.
+type IngestResponseData struct {
+	RowsAccepted int       `json:"rowsAccepted"`
+	RowsRejected int       `json:"rowsRejected"`
+	From         time.Time `json:"from,omitempty"`
+	To           time.Time `json:"to,omitempty"`
+	Errors       []string  `json:"errors,omitempty"`
+	Failure      string    `json:"failure,omitempty"`
+}
+
+// accept hands readings to the store, and to the sample files when persisting,
+// and widens the reported time range to cover them. Readings falling in a
+// lock are rejected.
+func (responseData *IngestResponseData) accept(readings []*hardware.Reading, persist bool) error {
+	readings, refusals := hardware.WithoutLocked(readings)
+	for _, refusal := range refusals {
+		responseData.reject(refusal)
+	}
+	addSamples := hardware.AddSamples
+	if persist {
+		addSamples = hardware.AddAndPersistSamples
+	}
+	if err := addSamples(readings); err != nil {
+		return err
+	}
+
+	for _, reading := range readings {
+		if responseData.From.IsZero() || reading.Time.Before(responseData.From) {
+			responseData.From = reading.Time
+		}
+		if reading.Time.After(responseData.To) {
+			responseData.To = reading.Time
+		}
+	}
+	responseData.RowsAccepted += len(readings)
+	return nil
+}
+
+// ingestionSkewPolicy is the clock skew policy for readings ingested live,
+// or backfilled when they are history being uploaded.
+func ingestionSkewPolicy(backfill bool) hardware.ClockSkewPolicy {
+	return hardware.ClockSkewPolicy{
+		MaxFutureSkew:    config.Current.Ingestion.MaxFutureSkew.Duration,
+		ServerTimestamps: config.Current.Ingestion.ServerTimestamps,
+		Backfill:         backfill,
+	}
+}
+
+// persistRequested lets a request's persist parameter override whether
+// ingested readings are also written to the sample files.
+func persistRequested(request *http.Request) (bool, error) {
+	persist := request.URL.Query().Get("persist")
+	if persist == "" {
+		return config.Current.Ingestion.Persist, nil
+	}
+	return strconv.ParseBool(persist)
+}
+
+// csvOptionsRequested is the configured CSV dialect, with whichever options
+// the query of a request overrides, e.g. "?delimiter=;&decimalSeparator=,"
+// for a German export.
+func csvOptionsRequested(request *http.Request) (csvparse.Options, error) {
+	options := config.Current.CSVOptions()
+	query := request.URL.Query()
+	for parameter, option := range map[string]*string{
+		"delimiter":          &options.Delimiter,
+		"decimalSeparator":   &options.DecimalSeparator,
+		"thousandsSeparator": &options.ThousandsSeparator,
+		"timestampFormat":    &options.TimestampFormat,
+		"quoting":            &options.Quoting,
+	} {
+		if values, hasParameter := query[parameter]; hasParameter {
+			*option = values[0]
+		}
+	}
+	return options, options.Validate()
+}
+
+func (responseData *IngestResponseData) reject(err error) {
+	ingestRejectedRowCounter.Inc()
+	responseData.RowsRejected++
+	if len(responseData.Errors) < ingestReportedFails {
+		responseData.Errors = append(responseData.Errors, err.Error())
+	}
+}
+
+// merge adds the summary of one part of a multipart upload to the whole.
+func (responseData *IngestResponseData) merge(partData *IngestResponseData) {
+	responseData.RowsAccepted += partData.RowsAccepted
+	responseData.RowsRejected += partData.RowsRejected
+	responseData.Errors = append(responseData.Errors, partData.Errors...)
+	if !partData.From.IsZero() && (responseData.From.IsZero() || partData.From.Before(responseData.From)) {
+		responseData.From = partData.From
+	}
+	if partData.To.After(responseData.To) {
+		responseData.To = partData.To
+	}
+}
+
+// writeIngestFailure answers an ingestion that failed. When rows were stored
+// before it did, which uploads too large to check whole before storing any
+// can do, the summary of those is answered with the failure, so clients know
+// where to resume; otherwise just the failure.
+func writeIngestFailure(response http.ResponseWriter, responseData *IngestResponseData, err error) {
+	ingestFailureCounter.Inc()
+	status := errorStatus(err, http.StatusBadRequest)
+	if responseData == nil || responseData.RowsAccepted == 0 {
+		response.WriteHeader(status)
+		response.Write([]byte(err.Error()))
+		return
+	}
+
+	responseData.Failure = err.Error()
+	responseBytes, marshalErr := json.Marshal(responseData)
+	if marshalErr != nil {
+		response.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	response.WriteHeader(status)
+	response.Write(responseBytes)
+}
+
+// readingReader is what readings are ingested from, such as a
+// hardware.WideCSVReader.
+type readingReader interface {
+	Next() (*hardware.Reading, error)
+}
+
+// ingestCSV parses rows as they arrive and hands them to the store in
+// batches, so arbitrarily large uploads are never held in memory at once.
+func ingestCSV(body io.Reader, hardwareId string, persist bool, skewPolicy hardware.ClockSkewPolicy, options csvparse.Options) (*IngestResponseData, error) {
+	wideReader, err := hardware.NewWideCSVReader(body, hardwareId, options)
+	if err != nil {
+		return nil, err
+	}
+	return ingestReadings(wideReader, persist, skewPolicy)
+}
+
+// ingestWorkbook reads an XLSX workbook whole, as its parts can only be found
+// from the end, then hands its rows to the store in batches.
+func ingestWorkbook(body io.Reader, hardwareId string, persist bool, skewPolicy hardware.ClockSkewPolicy) (*IngestResponseData, error) {
+	maxBytes := config.Current.Ingestion.Workbooks.MaxBytes
+	workbookBytes, err := io.ReadAll(io.LimitReader(body, maxBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(workbookBytes)) > maxBytes {
+		return nil, fmt.Errorf(`workbook exceeds the maximum of %d bytes`, maxBytes)
+	}
+
+	workbooks := config.Current.Ingestion.Workbooks
+	workbook, err := xlsx.Read(bytes.NewReader(workbookBytes), int64(len(workbookBytes)), xlsx.Limits{MaxPartBytes: workbooks.MaxPartBytes, MaxRows: workbooks.MaxRows})
+	if err != nil {
+		return nil, err
+	}
+	workbookReader, err := hardware.NewWorkbookReader(workbook, hardwareId)
+	if err != nil {
+		return nil, err
+	}
+	return ingestReadings(workbookReader, persist, skewPolicy)
+}
+
+// ingestReadings hands the readings of a reader to the store in batches,
+// rejecting rows it cannot use and carrying on past them. Every reading is
+// checked before it joins a batch, so a batch only fails for the store
+// failing; the batches stored before it stay, and are returned alongside the
+// error.
+func ingestReadings(reader readingReader, persist bool, skewPolicy hardware.ClockSkewPolicy) (*IngestResponseData, error) {
+	responseData := &IngestResponseData{}
+
+	batch := make([]*hardware.Reading, 0, ingestBatchSize)
+	flush := func() error {
+		if err := responseData.accept(batch, persist); err != nil {
+			return err
+		}
+		batch = batch[:0]
+		return nil
+	}
+
+	for {
+		reading, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		var rowErr *hardware.RowError
+		if errors.As(err, &rowErr) {
+			responseData.reject(rowErr)
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+
+		if reading.Time, err = skewPolicy.Apply(reading.HardwareId, reading.Time, time.Now()); err != nil {
+			responseData.reject(err)
+			continue
+		}
+		if err := hardware.ValidateReading(reading); err != nil {
+			responseData.reject(err)
+			continue
+		}
+
+		batch = append(batch, reading)
+		if len(batch) == ingestBatchSize {
+			if err := flush(); err != nil {
+				return responseData, err
+			}
+		}
+	}
+	if err := flush(); err != nil {
+		return responseData, err
+	}
+	return responseData, nil
+}
+
+func handleIngest(response http.ResponseWriter, request *http.Request) {
+	if request.Method != "POST" {
+		response.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Without one, rows name their hardware, which AddSamples checks
+	hardwareId := request.URL.Query().Get("hardwareId")
+	if hardwareId != "" {
+		if err := hardware.ValidateHardwareId(hardwareId); err != nil {
+			response.WriteHeader(http.StatusBadRequest)
+			response.Write([]byte(err.Error()))
+			return
+		}
+	}
+	persist, err := persistRequested(request)
+	if err != nil {
+		response.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	csvOptions, err := csvOptionsRequested(request)
+	if err != nil {
+		response.WriteHeader(http.StatusBadRequest)
+		response.Write([]byte(err.Error()))
+		return
+	}
+	// Uploads are history being backfilled, unless a gateway signed them
+	identity := auth.IdentityOf(request)
+	skewPolicy := ingestionSkewPolicy(identity == nil || identity.Provider != auth.ProviderGateway)
+	var responseData *IngestResponseData
+
+	mediaType, _, _ := mime.ParseMediaType(request.Header.Get("Content-Type"))
+	if mediaType == "multipart/form-data" {
+		multipartReader, multipartErr := request.MultipartReader()
+		if multipartErr != nil {
+			response.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		responseData = &IngestResponseData{}
+		for {
+			part, partErr := multipartReader.NextPart()
+			if partErr == io.EOF {
+				break
+			} else if partErr != nil {
+				err = partErr
+				break
+			}
+			if part.FileName() == "" {
+				continue
+			}
+
+			ingestPart := func(body io.Reader, hardwareId string, persist bool, skewPolicy hardware.ClockSkewPolicy) (*IngestResponseData, error) {
+				return ingestCSV(body, hardwareId, persist, skewPolicy, csvOptions)
+			}
+			if partType, _, _ := mime.ParseMediaType(part.Header.Get("Content-Type")); partType == workbookMediaType || strings.EqualFold(path.Ext(part.FileName()), ".xlsx") {
+				ingestPart = ingestWorkbook
+			}
+			partData, partErr := ingestPart(part, hardwareId, persist, skewPolicy)
+			if partData != nil {
+				responseData.merge(partData)
+			}
+			if partErr != nil {
+				err = partErr
+				break
+			}
+		}
+	} else if mediaType == workbookMediaType {
+		responseData, err = ingestWorkbook(request.Body, hardwareId, persist, skewPolicy)
+	} else {
+		responseData, err = ingestCSV(request.Body, hardwareId, persist, skewPolicy, csvOptions)
+	}
+	if err != nil {
+		writeIngestFailure(response, responseData, err)
+		return
+	}
+
+	responseBytes, err := json.Marshal(responseData)
+	if err != nil {
+		response.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	response.WriteHeader(http.StatusOK)
+	response.Write(responseBytes)
+}
+
+// ingestJSON accepts either one reading or an array of them. Readings may
+// leave out the hardware, which then comes from the path.
+func ingestJSON(body io.Reader, hardwareId string, persist bool, skewPolicy hardware.ClockSkewPolicy) (*IngestResponseData, error) {
+	maxBytes := config.Current.Ingestion.MaxJSONBytes
+	dataBytes, err := io.ReadAll(io.LimitReader(body, maxBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(dataBytes)) > maxBytes {
+		return nil, fmt.Errorf(`body exceeds the maximum of %d bytes`, maxBytes)
+	}
+
+	var readings []*hardware.Reading
+	if err := json.Unmarshal(dataBytes, &readings); err != nil {
+		var reading hardware.Reading
+		if err := json.Unmarshal(dataBytes, &reading); err != nil {
+			return nil, fmt.Errorf(`body is neither a reading nor an array of readings: %w`, err)
+		}
+		readings = []*hardware.Reading{&reading}
+	}
+
+	responseData := &IngestResponseData{}
+	acceptedReadings := make([]*hardware.Reading, 0, len(readings))
+	for readingIndex, reading := range readings {
+		if reading.HardwareId == "" {
+			reading.HardwareId = hardwareId
+		}
+		switch {
+		case reading.HardwareId != hardwareId:
+			responseData.reject(fmt.Errorf(`reading %d: belongs to hardware "%s", not "%s"`, readingIndex, reading.HardwareId, hardwareId))
+			continue
+		case reading.Time.IsZero():
+			responseData.reject(fmt.Errorf(`reading %d: has no time`, readingIndex))
+			continue
+		}
+		if reading.Time, err = skewPolicy.Apply(reading.HardwareId, reading.Time, time.Now()); err != nil {
+			responseData.reject(fmt.Errorf(`reading %d: %w`, readingIndex, err))
+			continue
+		}
+		acceptedReadings = append(acceptedReadings, reading)
+	}
+
+	if err := responseData.accept(acceptedReadings, persist); err != nil {
+		return nil, err
+	}
+	return responseData, nil
+}
+
+func handleHardwareSamples(response http.ResponseWriter, request *http.Request, hardwareId string) {
+	if request.Method != "POST" {
+		response.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if err := hardware.ValidateHardwareId(hardwareId); err != nil {
+		response.WriteHeader(http.StatusBadRequest)
+		response.Write([]byte(err.Error()))
+		return
+	}
+
+	persist, err := persistRequested(request)
+	if err != nil {
+		response.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	csvOptions, err := csvOptionsRequested(request)
+	if err != nil {
+		response.WriteHeader(http.StatusBadRequest)
+		response.Write([]byte(err.Error()))
+		return
+	}
+
+	skewPolicy := ingestionSkewPolicy(false)
+	var responseData *IngestResponseData
+	switch mediaType, _, _ := mime.ParseMediaType(request.Header.Get("Content-Type")); mediaType {
+	case "application/json":
+		responseData, err = ingestJSON(request.Body, hardwareId, persist, skewPolicy)
+	case "text/csv":
+		responseData, err = ingestCSV(request.Body, hardwareId, persist, skewPolicy, csvOptions)
+	default:
+		response.WriteHeader(http.StatusUnsupportedMediaType)
+		return
+	}
+	if err != nil {
+		writeIngestFailure(response, responseData, err)
+		return
+	}
+
+	responseBytes, err := json.Marshal(responseData)
+	if err != nil {
+		response.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	response.WriteHeader(http.StatusOK)
+	response.Write(responseBytes)
+}
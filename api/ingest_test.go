@@ -0,0 +1,65 @@
+package api_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api"
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/hardware"
+)
+
+// failingStore is a storage backend that takes the first batch of readings
+// put to it and fails on the next.
+type failingStore struct {
+	hardware.Store
+	puts int
+}
+
+func (store *failingStore) Put(readings []*hardware.Reading) error {
+	store.puts++
+	if store.puts > 1 {
+		return fmt.Errorf(`%w: disk full`, hardware.ErrStoreUnavailable)
+	}
+	return store.Store.Put(readings)
+}
+
+func TestIngestReportsStoredRowsOnFailure(t *testing.T) {
+	if err := loadContractFixtures(); err != nil {
+		t.Fatal(err)
+	}
+	if err := hardware.UseStore(&failingStore{Store: hardware.NewMemoryStore()}); err != nil {
+		t.Fatal(err)
+	}
+	defer hardware.UseStore(nil)
+
+	// A day after the fixtures, a row with an invalid hardware id among them,
+	// and more rows than one batch holds
+	var body strings.Builder
+	body.WriteString("timestamp,hardwareId,temperature\n")
+	for row := 0; row < 1500; row++ {
+		hardwareId := "contract_pump"
+		if row == 10 {
+			hardwareId = "../escape"
+		}
+		fmt.Fprintf(&body, "%d,%s,40\n", 1656720000000+int64(row)*1000, hardwareId)
+	}
+	request := httptest.NewRequest("POST", "/api/ingest?persist=false", strings.NewReader(body.String()))
+	request.Header.Set("Content-Type", "text/csv")
+	response := httptest.NewRecorder()
+	api.Handle(response, request)
+
+	if response.Code != http.StatusServiceUnavailable {
+		t.Fatalf(`expected 503 for the store failing, got %d: %s`, response.Code, response.Body)
+	}
+	var responseData api.IngestResponseData
+	if err := json.Unmarshal(response.Body.Bytes(), &responseData); err != nil {
+		t.Fatalf(`expected the rows stored before the failure reported, got %s`, response.Body)
+	}
+	if responseData.RowsAccepted != 1000 || responseData.RowsRejected != 1 || !strings.Contains(responseData.Failure, "disk full") {
+		t.Errorf(`expected one batch stored and the bad row rejected, got %+v`, responseData)
+	}
+}
@@ -0,0 +1,161 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/hardware"
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/timeseries"
+)
+
+type JoinedHardwareSide struct {
+	Id      string   `json:"id"`
+	Metrics []string `json:"metrics"`
+}
+
+type JoinedHardwareRequestData struct {
+	Left  JoinedHardwareSide `json:"left"`
+	Right JoinedHardwareSide `json:"right"`
+	From  time.Time          `json:"from"`
+	To    time.Time          `json:"to"`
+	Count int                `json:"count"`
+
+	// AsOf joins both sides as they were at that time, like the AsOf of a
+	// tabulation.
+	AsOf *time.Time `json:"asOf,omitempty"`
+}
+
+type JoinedHardwareResponseData struct {
+	Columns []string        `json:"columns"`
+	Rows    [][]interface{} `json:"rows"`
+
+	// RequestedCount and Count differ when the request asked for more rows
+	// than either side has raw samples in the window, or than the configured
+	// cap.
+	RequestedCount int      `json:"requestedCount,omitempty"`
+	Count          int      `json:"count,omitempty"`
+	Warnings       []string `json:"warnings,omitempty"`
+}
+
+func (side *JoinedHardwareSide) validate() error {
+	if !hardware.HasSamples(side.Id) {
+		return fmt.Errorf(`%w "%s"`, hardware.ErrUnknownHardware, side.Id)
+	}
+	if len(side.Metrics) == 0 {
+		side.Metrics = hardware.Metrics()
+	}
+	for _, metric := range side.Metrics {
+		if !hardware.IsMetric(metric) {
+			return fmt.Errorf(`%w "%s"`, hardware.ErrUnknownMetric, metric)
+		}
+	}
+	return nil
+}
+
+func (side *JoinedHardwareSide) appendCells(row []interface{}, source tabulationSource, timestamp time.Time, interpolator timeseries.Interpolator) []interface{} {
+	sample, err := source.InterpolateSampleWith(timestamp, interpolator)
+	for _, metric := range side.Metrics {
+		if err != nil {
+			row = append(row, nil)
+			continue
+		}
+		value, _ := sample.ValueByMetric(metric)
+		row = append(row, value)
+	}
+	return row
+}
+
+func handleJoinedHardware(response http.ResponseWriter, request *http.Request) {
+	if request.Method != "POST" {
+		response.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	revision := hardware.Revision()
+
+	dataBytes, err := io.ReadAll(request.Body)
+	if err != nil {
+		response.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	var requestData JoinedHardwareRequestData
+	if err := json.Unmarshal(dataBytes, &requestData); err != nil {
+		response.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	if err := requestData.Left.validate(); err != nil {
+		response.WriteHeader(errorStatus(err, http.StatusBadRequest))
+		return
+	}
+	if err := requestData.Right.validate(); err != nil {
+		response.WriteHeader(errorStatus(err, http.StatusBadRequest))
+		return
+	}
+
+	if _, validStep := gridStep(requestData.From, requestData.To, requestData.Count); !validStep {
+		response.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	// Each side is read like a tabulation of it, and the count clamped to
+	// whichever has fewer raw samples in the window
+	count, warnings := requestData.Count, make([]string, 0)
+	sources := make([]tabulationSource, 0, 2)
+	for _, side := range []*JoinedHardwareSide{&requestData.Left, &requestData.Right} {
+		tabulation := &TabulatedHardwareRequestData{Id: side.Id, From: requestData.From, To: requestData.To, Count: count, AsOf: requestData.AsOf}
+		source, err := tabulationSourceOf(tabulation)
+		if err != nil {
+			response.WriteHeader(errorStatus(err, http.StatusInternalServerError))
+			response.Write([]byte(err.Error()))
+			return
+		}
+		clampedCount, clampWarnings, err := clampCount(tabulation, source)
+		if err != nil {
+			response.WriteHeader(errorStatus(err, http.StatusInternalServerError))
+			return
+		}
+		for _, warning := range clampWarnings {
+			warnings = append(warnings, side.Id+": "+warning)
+		}
+		count = clampedCount
+		sources = append(sources, source)
+	}
+	step, _ := gridStep(requestData.From, requestData.To, count)
+	interpolator, _ := timeseries.InterpolatorFor(timeseries.MethodLinear)
+
+	responseData := JoinedHardwareResponseData{Columns: []string{"time"}, Rows: make([][]interface{}, 0)}
+	if count != requestData.Count {
+		responseData.RequestedCount, responseData.Count, responseData.Warnings = requestData.Count, count, warnings
+	}
+	for _, metric := range requestData.Left.Metrics {
+		responseData.Columns = append(responseData.Columns, requestData.Left.Id+"."+metric)
+	}
+	for _, metric := range requestData.Right.Metrics {
+		responseData.Columns = append(responseData.Columns, requestData.Right.Id+"."+metric)
+	}
+
+	// Both sides are interpolated onto the same grid, so rows line up exactly
+	for timestamp := requestData.From; timestamp.Before(requestData.To); timestamp = timestamp.Add(step) {
+		row := []interface{}{timestamp}
+		row = requestData.Left.appendCells(row, sources[0], timestamp, interpolator)
+		row = requestData.Right.appendCells(row, sources[1], timestamp, interpolator)
+		responseData.Rows = append(responseData.Rows, row)
+	}
+
+	responseBytes, err := json.Marshal(responseData)
+	if err != nil {
+		response.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if setCacheHeaders(response, request, dataBytes, revision, requestData.To) {
+		response.WriteHeader(http.StatusNotModified)
+		return
+	}
+	response.WriteHeader(http.StatusOK)
+	response.Write(responseBytes)
+}
@@ -0,0 +1,84 @@
+package metrics
+
+import (
+	"math"
+	"sync/atomic"
+)
+
+type Gauge struct {
+	name string
+	bits uint64
+}
+
+func (gauge *Gauge) Set(value float64) {
+	atomic.StoreUint64(&gauge.bits, math.Float64bits(value))
+}
+
+func (gauge *Gauge) Value() float64 {
+	return math.Float64frombits(atomic.LoadUint64(&gauge.bits))
+}
+
+var (
+	gauges     map[string]*Gauge         = make(map[string]*Gauge)
+	gaugeFuncs map[string]func() float64 = make(map[string]func() float64)
+)
+
+// NewGauge returns the gauge registered under name, creating it on first use.
+func NewGauge(name string) *Gauge {
+	countersMutex.Lock()
+	defer countersMutex.Unlock()
+
+	gauge, hasGauge := gauges[name]
+	if !hasGauge {
+		gauge = &Gauge{name: name}
+		gauges[name] = gauge
+	}
+	return gauge
+}
+
+// NewGaugeFunc registers a gauge whose value is read from valueOf whenever
+// the gauges are, for values the caller already keeps.
+func NewGaugeFunc(name string, valueOf func() float64) {
+	countersMutex.Lock()
+	defer countersMutex.Unlock()
+
+	gaugeFuncs[name] = valueOf
+}
+
+// RemoveGauges drops the gauges matching, functions included, so series of
+// hardware that is no longer loaded stop being reported.
+func RemoveGauges(matching func(name string) bool) {
+	countersMutex.Lock()
+	defer countersMutex.Unlock()
+
+	for name := range gauges {
+		if matching(name) {
+			delete(gauges, name)
+		}
+	}
+	for name := range gaugeFuncs {
+		if matching(name) {
+			delete(gaugeFuncs, name)
+		}
+	}
+}
+
+func Gauges() map[string]float64 {
+	countersMutex.Lock()
+	values := make(map[string]float64, len(gauges)+len(gaugeFuncs))
+	for name, gauge := range gauges {
+		values[name] = gauge.Value()
+	}
+	valueFuncs := make(map[string]func() float64, len(gaugeFuncs))
+	for name, valueOf := range gaugeFuncs {
+		valueFuncs[name] = valueOf
+	}
+	countersMutex.Unlock()
+
+	// Read unlocked, as they may take locks of their own that are held while
+	// gauges are set
+	for name, valueOf := range valueFuncs {
+		values[name] = valueOf()
+	}
+	return values
+}
@@ -0,0 +1,86 @@
+package metrics
+
+import (
+	"math"
+	"sort"
+	"sync/atomic"
+)
+
+// LatencyBuckets are the upper bounds, in seconds, of the buckets request
+// latencies are counted in.
+var LatencyBuckets = []float64{0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// Histogram counts observations in cumulative buckets, as Prometheus expects.
+type Histogram struct {
+	name        string
+	upperBounds []float64
+
+	// bucketCounts holds one count per upper bound, then one for +Inf
+	bucketCounts []int64
+	count        int64
+	sumBits      uint64
+}
+
+func (histogram *Histogram) Observe(value float64) {
+	bucketIndex := sort.SearchFloat64s(histogram.upperBounds, value)
+	atomic.AddInt64(&histogram.bucketCounts[bucketIndex], 1)
+	atomic.AddInt64(&histogram.count, 1)
+	for {
+		oldBits := atomic.LoadUint64(&histogram.sumBits)
+		newBits := math.Float64bits(math.Float64frombits(oldBits) + value)
+		if atomic.CompareAndSwapUint64(&histogram.sumBits, oldBits, newBits) {
+			return
+		}
+	}
+}
+
+// HistogramSnapshot is a histogram as of one moment, with the count of each
+// bucket including those of the buckets below it.
+type HistogramSnapshot struct {
+	UpperBounds      []float64
+	CumulativeCounts []int64
+	Count            int64
+	Sum              float64
+}
+
+func (histogram *Histogram) Snapshot() *HistogramSnapshot {
+	snapshot := &HistogramSnapshot{
+		UpperBounds:      histogram.upperBounds,
+		CumulativeCounts: make([]int64, len(histogram.bucketCounts)),
+		Count:            atomic.LoadInt64(&histogram.count),
+		Sum:              math.Float64frombits(atomic.LoadUint64(&histogram.sumBits)),
+	}
+	var cumulativeCount int64
+	for bucketIndex := range histogram.bucketCounts {
+		cumulativeCount += atomic.LoadInt64(&histogram.bucketCounts[bucketIndex])
+		snapshot.CumulativeCounts[bucketIndex] = cumulativeCount
+	}
+	return snapshot
+}
+
+var histograms map[string]*Histogram = make(map[string]*Histogram)
+
+// NewHistogram returns the histogram registered under name, creating it with
+// upperBounds, which must be sorted, on first use.
+func NewHistogram(name string, upperBounds []float64) *Histogram {
+	countersMutex.Lock()
+	defer countersMutex.Unlock()
+
+	histogram, hasHistogram := histograms[name]
+	if !hasHistogram {
+		histogram = &Histogram{name: name, upperBounds: upperBounds, bucketCounts: make([]int64, len(upperBounds)+1)}
+		histograms[name] = histogram
+	}
+	return histogram
+}
+
+func Histograms() map[string]*HistogramSnapshot {
+	countersMutex.Lock()
+	defer countersMutex.Unlock()
+
+	snapshots := make(map[string]*HistogramSnapshot, len(histograms))
+	for name, histogram := range histograms {
+		snapshots[name] = histogram.Snapshot()
+	}
+	return snapshots
+}
@@ -0,0 +1,68 @@
+// Package metrics is a registry of named counters, gauges and histograms,
+// exported in the Prometheus text format.
+package metrics
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+type Counter struct {
+	name  string
+	value int64
+}
+
+func (counter *Counter) Add(delta int64) {
+	atomic.AddInt64(&counter.value, delta)
+}
+
+func (counter *Counter) Inc() {
+	counter.Add(1)
+}
+
+func (counter *Counter) Value() int64 {
+	return atomic.LoadInt64(&counter.value)
+}
+
+var (
+	countersMutex sync.Mutex
+	counters      map[string]*Counter = make(map[string]*Counter)
+)
+
+// NewCounter returns the counter registered under name, creating it on first
+// use, so packages can declare their counters as package variables.
+func NewCounter(name string) *Counter {
+	countersMutex.Lock()
+	defer countersMutex.Unlock()
+
+	counter, hasCounter := counters[name]
+	if !hasCounter {
+		counter = &Counter{name: name}
+		counters[name] = counter
+	}
+	return counter
+}
+
+func Counters() map[string]int64 {
+	countersMutex.Lock()
+	defer countersMutex.Unlock()
+
+	values := make(map[string]int64, len(counters))
+	for name, counter := range counters {
+		values[name] = counter.Value()
+	}
+	return values
+}
+
+func CounterNames() []string {
+	countersMutex.Lock()
+	defer countersMutex.Unlock()
+
+	names := make([]string, 0, len(counters))
+	for name := range counters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
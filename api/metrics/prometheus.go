@@ -0,0 +1,117 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// Labels formats label pairs, given as name then value, the way a series name
+// carries them, such as {hardware="fan",axis="x"}.
+func Labels(nameValuePairs ...string) string {
+	var labels strings.Builder
+	labels.WriteString("{")
+	for pairIndex := 0; pairIndex+1 < len(nameValuePairs); pairIndex += 2 {
+		if pairIndex > 0 {
+			labels.WriteString(",")
+		}
+		fmt.Fprintf(&labels, `%s="%s"`, nameValuePairs[pairIndex], labelValueEscaper.Replace(nameValuePairs[pairIndex+1]))
+	}
+	labels.WriteString("}")
+	return labels.String()
+}
+
+// splitSeries separates the family of a series name from its labels, which
+// are returned without braces.
+func splitSeries(name string) (string, string) {
+	family, labels, hasLabels := strings.Cut(name, "{")
+	if !hasLabels {
+		return family, ""
+	}
+	return family, strings.TrimSuffix(labels, "}")
+}
+
+func formatValue(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	case math.IsNaN(value):
+		return "NaN"
+	default:
+		return strconv.FormatFloat(value, 'g', -1, 64)
+	}
+}
+
+type series struct {
+	family string
+	name   string
+	kind   string
+	write  func(writer *bufio.Writer)
+}
+
+// WritePrometheus writes every counter, gauge and histogram in the Prometheus
+// text exposition format, grouped by family.
+func WritePrometheus(writer io.Writer) error {
+	allSeries := make([]*series, 0)
+	for name, value := range Counters() {
+		name, value := name, value
+		family, _ := splitSeries(name)
+		allSeries = append(allSeries, &series{family: family, name: name, kind: "counter", write: func(writer *bufio.Writer) {
+			fmt.Fprintf(writer, "%s %d\n", name, value)
+		}})
+	}
+	for name, value := range Gauges() {
+		name, value := name, value
+		family, _ := splitSeries(name)
+		allSeries = append(allSeries, &series{family: family, name: name, kind: "gauge", write: func(writer *bufio.Writer) {
+			fmt.Fprintf(writer, "%s %s\n", name, formatValue(value))
+		}})
+	}
+	for name, snapshot := range Histograms() {
+		name, snapshot := name, snapshot
+		family, labels := splitSeries(name)
+		if labels != "" {
+			labels += ","
+		}
+		allSeries = append(allSeries, &series{family: family, name: name, kind: "histogram", write: func(writer *bufio.Writer) {
+			for bucketIndex, cumulativeCount := range snapshot.CumulativeCounts {
+				upperBound := math.Inf(1)
+				if bucketIndex < len(snapshot.UpperBounds) {
+					upperBound = snapshot.UpperBounds[bucketIndex]
+				}
+				fmt.Fprintf(writer, "%s_bucket{%sle=\"%s\"} %d\n", family, labels, formatValue(upperBound), cumulativeCount)
+			}
+			suffix := ""
+			if labels != "" {
+				suffix = "{" + strings.TrimSuffix(labels, ",") + "}"
+			}
+			fmt.Fprintf(writer, "%s_sum%s %s\n", family, suffix, formatValue(snapshot.Sum))
+			fmt.Fprintf(writer, "%s_count%s %d\n", family, suffix, snapshot.Count)
+		}})
+	}
+	sort.Slice(allSeries, func(leftIndex, rightIndex int) bool {
+		if allSeries[leftIndex].family != allSeries[rightIndex].family {
+			return allSeries[leftIndex].family < allSeries[rightIndex].family
+		}
+		return allSeries[leftIndex].name < allSeries[rightIndex].name
+	})
+
+	bufferedWriter := bufio.NewWriter(writer)
+	var previousFamily string
+	for _, oneSeries := range allSeries {
+		if oneSeries.family != previousFamily {
+			fmt.Fprintf(bufferedWriter, "# TYPE %s %s\n", oneSeries.family, oneSeries.kind)
+			previousFamily = oneSeries.family
+		}
+		oneSeries.write(bufferedWriter)
+	}
+	return bufferedWriter.Flush()
+}
@@ -0,0 +1,226 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/alerts"
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/config"
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/hardware"
+)
+
+// maxManifestBytes bounds the onboarding manifests read.
+const maxManifestBytes = 8 << 20
+
+// OnboardingDefaults apply to every hardware of a manifest: Tags are added
+// to its own, and Limits fill in the metrics it sets none for. Alert rules
+// created from the limits wait NotifyInterval between notifications.
+type OnboardingDefaults struct {
+	Tags           []string                 `json:"tags,omitempty"`
+	Limits         map[string]config.Limits `json:"limits,omitempty"`
+	NotifyInterval config.Duration          `json:"notifyInterval"`
+}
+
+// OnboardingEntry is one hardware to commission, under Id, with the profile
+// it is to have.
+type OnboardingEntry struct {
+	Id string `json:"id"`
+	hardware.Profile
+}
+
+// OnboardingManifest commissions many hardware at once, such as a new area
+// of a plant.
+type OnboardingManifest struct {
+	Defaults OnboardingDefaults `json:"defaults"`
+	Hardware []*OnboardingEntry `json:"hardware"`
+}
+
+// OnboardedHardware is what onboarding did, or would do, for one hardware:
+// whether it was new, and the alert rules created from its limits.
+type OnboardedHardware struct {
+	Id      string   `json:"id"`
+	Created bool     `json:"created"`
+	Rules   []string `json:"rules"`
+}
+
+// OnboardingResponseData reports on a manifest. RulesKept are the rules it
+// would have created that already existed, and were left as they were.
+type OnboardingResponseData struct {
+	DryRun    bool                 `json:"dryRun,omitempty"`
+	Hardware  []*OnboardedHardware `json:"hardware"`
+	RulesKept []string             `json:"rulesKept"`
+}
+
+// profileOf merges the defaults of a manifest into the profile of one of its
+// entries.
+func (manifest *OnboardingManifest) profileOf(entry *OnboardingEntry) *hardware.Profile {
+	profile := entry.Profile
+	profile.Tags = append([]string(nil), entry.Tags...)
+	for _, tag := range manifest.Defaults.Tags {
+		isTagged := false
+		for _, existingTag := range profile.Tags {
+			isTagged = isTagged || existingTag == tag
+		}
+		if !isTagged {
+			profile.Tags = append(profile.Tags, tag)
+		}
+	}
+
+	profile.Limits = make(map[string]config.Limits, len(entry.Limits)+len(manifest.Defaults.Limits))
+	for metric, limits := range manifest.Defaults.Limits {
+		profile.Limits[metric] = limits
+	}
+	for metric, limits := range entry.Limits {
+		profile.Limits[metric] = limits
+	}
+	if len(profile.Limits) == 0 {
+		profile.Limits = nil
+	}
+	return &profile
+}
+
+// rulesOf are the default alert rules of a hardware: one above each warning
+// and critical limit of its profile, named after the hardware, metric and
+// level.
+func (manifest *OnboardingManifest) rulesOf(hardwareId string, profile *hardware.Profile) []*alerts.Rule {
+	metrics := make([]string, 0, len(profile.Limits))
+	for metric := range profile.Limits {
+		metrics = append(metrics, metric)
+	}
+	sort.Strings(metrics)
+
+	rules := make([]*alerts.Rule, 0)
+	for _, metric := range metrics {
+		limits := profile.Limits[metric]
+		for _, level := range []struct {
+			name      string
+			threshold *float64
+		}{{"warning", limits.Warning}, {"critical", limits.Critical}} {
+			if level.threshold == nil {
+				continue
+			}
+			rules = append(rules, &alerts.Rule{
+				Id:             fmt.Sprintf("%s.%s.%s", hardwareId, metric, level.name),
+				HardwareId:     hardwareId,
+				Metric:         metric,
+				Comparison:     alerts.ComparisonAbove,
+				Threshold:      *level.threshold,
+				NotifyInterval: manifest.Defaults.NotifyInterval,
+			})
+		}
+	}
+	return rules
+}
+
+// validate lists everything wrong with a manifest, so that one round fixes
+// all of it.
+func (manifest *OnboardingManifest) validate() []string {
+	problems := make([]string, 0)
+	if len(manifest.Hardware) == 0 {
+		problems = append(problems, `the manifest lists no hardware`)
+	}
+	if manifest.Defaults.NotifyInterval.Duration < 0 {
+		problems = append(problems, fmt.Sprintf(`defaults.notifyInterval: must not be negative, got %s`, manifest.Defaults.NotifyInterval))
+	}
+
+	hardwareIds := make(map[string]bool, len(manifest.Hardware))
+	for entryIndex, entry := range manifest.Hardware {
+		if entry == nil {
+			problems = append(problems, fmt.Sprintf(`hardware[%d]: is empty`, entryIndex))
+			continue
+		}
+		if err := hardware.ValidateHardwareId(entry.Id); err != nil {
+			problems = append(problems, fmt.Sprintf(`hardware[%d]: %v`, entryIndex, err))
+		} else if hardwareIds[entry.Id] {
+			problems = append(problems, fmt.Sprintf(`hardware[%d]: "%s" is listed more than once`, entryIndex, entry.Id))
+		}
+		hardwareIds[entry.Id] = true
+		if err := hardware.ValidateProfile(manifest.profileOf(entry)); err != nil {
+			problems = append(problems, fmt.Sprintf(`hardware[%d] "%s": %v`, entryIndex, entry.Id, err))
+		}
+	}
+	return problems
+}
+
+// handleOnboarding commissions the hardware of a manifest: each is
+// registered, with its directory and store row, given its profile, and
+// watched by alert rules above its limits. The manifest is checked as a
+// whole before anything is done, and dryRun=true stops there, reporting
+// what would be done. Onboarding hardware again updates its profile.
+func handleOnboarding(response http.ResponseWriter, request *http.Request) {
+	if request.Method != "POST" {
+		response.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	var manifest OnboardingManifest
+	decoder := json.NewDecoder(http.MaxBytesReader(response, request.Body, maxManifestBytes))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&manifest); err != nil {
+		response.WriteHeader(http.StatusBadRequest)
+		response.Write([]byte(fmt.Sprintf(`unable to parse the manifest: %v`, err)))
+		return
+	}
+	if problems := manifest.validate(); len(problems) > 0 {
+		response.WriteHeader(http.StatusBadRequest)
+		response.Write([]byte(strings.Join(problems, "\n")))
+		return
+	}
+
+	responseData := OnboardingResponseData{DryRun: request.URL.Query().Get("dryRun") == "true", Hardware: make([]*OnboardedHardware, 0, len(manifest.Hardware)), RulesKept: make([]string, 0)}
+	existingRules := alerts.Rules()
+	existingRuleIds := make(map[string]bool, len(existingRules))
+	for _, rule := range existingRules {
+		existingRuleIds[rule.Id] = true
+	}
+
+	addedRules := make([]*alerts.Rule, 0)
+	for _, entry := range manifest.Hardware {
+		profile := manifest.profileOf(entry)
+		onboarded := &OnboardedHardware{Id: entry.Id, Created: !hardware.HasSamples(entry.Id), Rules: make([]string, 0)}
+		if !responseData.DryRun {
+			created, err := hardware.Register(entry.Id)
+			if err != nil {
+				response.WriteHeader(errorStatus(err, http.StatusInternalServerError))
+				response.Write([]byte(err.Error()))
+				return
+			}
+			onboarded.Created = created
+			if err := hardware.SetProfile(entry.Id, profile); err != nil {
+				response.WriteHeader(errorStatus(err, http.StatusInternalServerError))
+				response.Write([]byte(err.Error()))
+				return
+			}
+		}
+
+		for _, rule := range manifest.rulesOf(entry.Id, profile) {
+			if existingRuleIds[rule.Id] {
+				responseData.RulesKept = append(responseData.RulesKept, rule.Id)
+				continue
+			}
+			onboarded.Rules = append(onboarded.Rules, rule.Id)
+			addedRules = append(addedRules, rule)
+		}
+		responseData.Hardware = append(responseData.Hardware, onboarded)
+	}
+
+	if !responseData.DryRun && len(addedRules) > 0 {
+		if err := alerts.ReplaceRules(append(existingRules, addedRules...)); err != nil {
+			response.WriteHeader(http.StatusInternalServerError)
+			response.Write([]byte(err.Error()))
+			return
+		}
+	}
+
+	responseBytes, err := json.Marshal(responseData)
+	if err != nil {
+		response.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	response.WriteHeader(http.StatusOK)
+	response.Write(responseBytes)
+}
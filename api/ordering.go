@@ -0,0 +1,58 @@
+package api
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/hardware"
+)
+
+// handleOrdering reads, sets or resets where a hardware is placed in the
+// hardware list and overview of every client, so the most critical machines
+// come first.
+func handleOrdering(response http.ResponseWriter, request *http.Request, hardwareId string) {
+	if !hardware.HasSamples(hardwareId) {
+		response.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	ordering := hardware.OrderingOf(hardwareId)
+	switch request.Method {
+	case "GET":
+	case "PUT":
+		dataBytes, err := io.ReadAll(request.Body)
+		if err != nil {
+			response.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		ordering = hardware.Ordering{}
+		if err := json.Unmarshal(dataBytes, &ordering); err != nil {
+			response.WriteHeader(http.StatusBadRequest)
+			response.Write([]byte(err.Error()))
+			return
+		}
+		if err := hardware.SetOrdering(hardwareId, ordering); err != nil {
+			response.WriteHeader(errorStatus(err, http.StatusInternalServerError))
+			return
+		}
+	case "DELETE":
+		ordering = hardware.Ordering{}
+		if err := hardware.SetOrdering(hardwareId, ordering); err != nil {
+			response.WriteHeader(errorStatus(err, http.StatusInternalServerError))
+			return
+		}
+	default:
+		response.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	responseBytes, err := json.Marshal(ordering)
+	if err != nil {
+		response.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	response.WriteHeader(http.StatusOK)
+	response.Write(responseBytes)
+}
@@ -0,0 +1,123 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/alerts"
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/hardware"
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/health"
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/statistics"
+)
+
+const (
+	hardwareStatusOK     = "ok"
+	hardwareStatusNoData = "no_data"
+
+	sparklineWindow  = 24 * time.Hour
+	sparklineBuckets = 24
+)
+
+type HardwareOverview struct {
+	Id           string                           `json:"id"`
+	Status       string                           `json:"status"`
+	LatestValues map[string]*hardware.LatestValue `json:"latestValues"`
+	HealthScore  int                              `json:"healthScore"`
+	HealthState  string                           `json:"healthState"`
+	ActiveAlerts []*alerts.Rule                   `json:"activeAlerts"`
+
+	// Sparklines hold hourly means over the 24 hours up to the latest sample.
+	Sparklines map[string][]*float64 `json:"sparklines"`
+}
+
+func sparklines(hardwareId string, until time.Time) (map[string][]*float64, error) {
+	from := until.Add(-sparklineWindow)
+	samples, err := hardware.SamplesBetween(hardwareId, from, until)
+	if err != nil {
+		return nil, err
+	}
+
+	bucketWidth := sparklineWindow / sparklineBuckets
+	metricSparklines := make(map[string][]*float64)
+	for _, metric := range hardware.Metrics() {
+		sums := make([]float64, sparklineBuckets)
+		counts := make([]int, sparklineBuckets)
+		for _, sample := range samples {
+			value, _ := sample.ValueByMetric(metric)
+			if value == nil {
+				continue
+			}
+			bucket := int(sample.Time.Sub(from) / bucketWidth)
+			if bucket >= sparklineBuckets {
+				bucket = sparklineBuckets - 1
+			}
+			sums[bucket] += *value
+			counts[bucket]++
+		}
+
+		sparkline := make([]*float64, sparklineBuckets)
+		for bucket := range sparkline {
+			sparkline[bucket] = statistics.Divide(sums[bucket], float64(counts[bucket])).Value
+		}
+		metricSparklines[metric] = sparkline
+	}
+	return metricSparklines, nil
+}
+
+func overviewOf(hardwareId string) (*HardwareOverview, error) {
+	latestValues, err := hardware.LatestValues(hardwareId)
+	if err != nil {
+		return nil, err
+	}
+
+	var latestTime time.Time
+	values := make(map[string]float64)
+	for metric, latestValue := range latestValues {
+		values[metric] = latestValue.Value
+		if latestValue.Time.After(latestTime) {
+			latestTime = latestValue.Time
+		}
+	}
+
+	status := hardwareStatusOK
+	if !hardware.HasData(hardwareId) {
+		status = hardwareStatusNoData
+	}
+
+	overview := &HardwareOverview{Id: hardwareId, Status: status, LatestValues: latestValues, ActiveAlerts: alerts.ActiveRules(hardwareId, values)}
+	overview.HealthScore, overview.HealthState = health.Score(hardwareId, values)
+	if overview.Sparklines, err = sparklines(hardwareId, latestTime); err != nil {
+		return nil, err
+	}
+	return overview, nil
+}
+
+func handleOverview(response http.ResponseWriter, request *http.Request) {
+	if request.Method != "GET" {
+		response.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	hardwareIds := hardware.HardwareIds()
+	hardware.SortHardwareIds(hardwareIds)
+
+	overviews := make([]*HardwareOverview, 0, len(hardwareIds))
+	for _, hardwareId := range hardwareIds {
+		overview, err := overviewOf(hardwareId)
+		if err != nil {
+			response.WriteHeader(errorStatus(err, http.StatusInternalServerError))
+			return
+		}
+		overviews = append(overviews, overview)
+	}
+
+	responseBytes, err := json.Marshal(overviews)
+	if err != nil {
+		response.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	response.WriteHeader(http.StatusOK)
+	response.Write(responseBytes)
+}
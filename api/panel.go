@@ -0,0 +1,198 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/alerts"
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/hardware"
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/statistics"
+)
+
+const (
+	AnnotationTombstone = "tombstone"
+	AnnotationAlert     = "alert"
+)
+
+type WindowAggregate struct {
+	Count   int                  `json:"count"`
+	Minimum statistics.Statistic `json:"minimum"`
+	Maximum statistics.Statistic `json:"maximum"`
+	Mean    statistics.Statistic `json:"mean"`
+}
+
+type PanelAnnotation struct {
+	Kind  string    `json:"kind"`
+	From  time.Time `json:"from"`
+	To    time.Time `json:"to"`
+	Label string    `json:"label"`
+}
+
+// PanelResponseData is everything a dashboard panel of one hardware needs in
+// a single response.
+type PanelResponseData struct {
+	Id           string                      `json:"id"`
+	From         time.Time                   `json:"from"`
+	To           time.Time                   `json:"to"`
+	Samples      map[string]*hardware.Sample `json:"samples"`
+	Warnings     []string                    `json:"warnings,omitempty"`
+	Aggregates   map[string]*WindowAggregate `json:"aggregates"`
+	ActiveAlerts []*alerts.Rule              `json:"activeAlerts"`
+	Annotations  []*PanelAnnotation          `json:"annotations"`
+}
+
+func windowAggregates(hardwareId string, from time.Time, to time.Time) (map[string]*WindowAggregate, error) {
+	samples, err := hardware.SamplesBetween(hardwareId, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	aggregates := make(map[string]*WindowAggregate)
+	for _, metric := range hardware.Metrics() {
+		values := make([]float64, 0, len(samples))
+		for _, sample := range samples {
+			if value, _ := sample.ValueByMetric(metric); value != nil {
+				values = append(values, *value)
+			}
+		}
+		aggregates[metric] = aggregateOf(values)
+	}
+	return aggregates, nil
+}
+
+// aggregateOf sums up values, leaving out those that are not finite.
+func aggregateOf(values []float64) *WindowAggregate {
+	minimum, maximum, sum, count := math.Inf(1), math.Inf(-1), 0.0, 0
+	for _, value := range values {
+		if !statistics.IsFinite(value) {
+			continue
+		}
+		minimum, maximum, sum, count = math.Min(minimum, value), math.Max(maximum, value), sum+value, count+1
+	}
+
+	aggregate := &WindowAggregate{Count: count, Mean: statistics.Divide(sum, float64(count))}
+	if count == 0 {
+		aggregate.Minimum, aggregate.Maximum, aggregate.Mean = statistics.Undefined(statistics.ReasonNoData), statistics.Undefined(statistics.ReasonNoData), statistics.Undefined(statistics.ReasonNoData)
+	} else {
+		aggregate.Minimum, aggregate.Maximum = statistics.Of(minimum), statistics.Of(maximum)
+	}
+	return aggregate
+}
+
+// panelAnnotations marks excised ranges and alert firings within the window.
+func panelAnnotations(hardwareId string, from time.Time, to time.Time) ([]*PanelAnnotation, error) {
+	annotations := make([]*PanelAnnotation, 0)
+	for _, tombstone := range hardware.Tombstones() {
+		if tombstone.HardwareId == hardwareId && !tombstone.To.Before(from) && !tombstone.From.After(to) {
+			annotations = append(annotations, &PanelAnnotation{Kind: AnnotationTombstone, From: tombstone.From, To: tombstone.To, Label: tombstone.Reason})
+		}
+	}
+
+	for _, rule := range alerts.Rules() {
+		if rule.HardwareId != hardwareId {
+			continue
+		}
+		firings, err := rule.Preview(from, to)
+		if err != nil {
+			return nil, err
+		}
+		for _, firing := range firings {
+			annotations = append(annotations, &PanelAnnotation{Kind: AnnotationAlert, From: firing.From, To: firing.To, Label: fmt.Sprintf(`%s: %s %s %g`, rule.Id, rule.Metric, rule.Comparison, rule.Threshold)})
+		}
+	}
+
+	sort.SliceStable(annotations, func(leftIndex, rightIndex int) bool {
+		return annotations[leftIndex].From.Before(annotations[rightIndex].From)
+	})
+	return annotations, nil
+}
+
+func handlePanel(response http.ResponseWriter, request *http.Request, hardwareId string) {
+	if request.Method != "GET" {
+		response.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	revision := hardware.Revision()
+	if !hardware.HasSamples(hardwareId) {
+		response.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	query := request.URL.Query()
+	from, err := time.Parse(time.RFC3339, query.Get("from"))
+	if err != nil {
+		response.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	to, err := time.Parse(time.RFC3339, query.Get("to"))
+	if err != nil || !to.After(from) {
+		response.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	count, err := queryInt(query, "count", 200, 1, math.MaxInt32)
+	if err != nil {
+		response.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	tabulation := &TabulatedHardwareRequestData{Id: hardwareId, From: from, To: to, Count: count}
+	responseData := PanelResponseData{Id: hardwareId, From: from, To: to, Samples: make(map[string]*hardware.Sample)}
+	if tabulation.Count, responseData.Warnings, err = clampCount(tabulation, workingSet(hardwareId)); err != nil {
+		response.WriteHeader(errorStatus(err, http.StatusInternalServerError))
+		return
+	}
+	timestamps, err := tabulationTimestamps(tabulation, workingSet(hardwareId))
+	if err != nil {
+		response.WriteHeader(errorStatus(err, http.StatusBadRequest))
+		return
+	}
+	for _, timestamp := range timestamps {
+		sample, err := hardware.InterpolateSample(hardwareId, timestamp)
+		if errors.Is(err, hardware.ErrOutOfRange) || errors.Is(err, hardware.ErrNoData) {
+			continue
+		} else if err != nil {
+			response.WriteHeader(errorStatus(err, http.StatusInternalServerError))
+			return
+		}
+		responseData.Samples[timestamp.Format("January _2, 2006 _3:04:05.999PM")] = sample
+	}
+
+	if responseData.Aggregates, err = windowAggregates(hardwareId, from, to); err != nil {
+		response.WriteHeader(errorStatus(err, http.StatusInternalServerError))
+		return
+	}
+
+	latestValues, err := hardware.LatestValues(hardwareId)
+	if err != nil {
+		response.WriteHeader(errorStatus(err, http.StatusInternalServerError))
+		return
+	}
+	values := make(map[string]float64)
+	for metric, latestValue := range latestValues {
+		values[metric] = latestValue.Value
+	}
+	responseData.ActiveAlerts = alerts.ActiveRules(hardwareId, values)
+
+	if responseData.Annotations, err = panelAnnotations(hardwareId, from, to); err != nil {
+		response.WriteHeader(errorStatus(err, http.StatusInternalServerError))
+		return
+	}
+
+	responseBytes, err := json.Marshal(responseData)
+	if err != nil {
+		response.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if setCacheHeaders(response, request, nil, revision, to) {
+		response.WriteHeader(http.StatusNotModified)
+		return
+	}
+	response.WriteHeader(http.StatusOK)
+	response.Write(responseBytes)
+}
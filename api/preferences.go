@@ -0,0 +1,175 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/config"
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/internal/auth"
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/internal/preferences"
+)
+
+func preferencesStatus(err error) int {
+	switch {
+	case errors.Is(err, preferences.ErrInvalidName):
+		return http.StatusBadRequest
+	case errors.Is(err, preferences.ErrTooLarge):
+		return http.StatusRequestEntityTooLarge
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// readPreferencesBody reads a request body of at most the preferences a key
+// may keep, so an oversized one is refused before it is parsed.
+func readPreferencesBody(request *http.Request) ([]byte, error) {
+	maxBytes := config.Current.Preferences.MaxBytes
+	dataBytes, err := io.ReadAll(io.LimitReader(request.Body, int64(maxBytes)+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(dataBytes) > maxBytes {
+		return nil, fmt.Errorf(`%w: more than %d bytes`, preferences.ErrTooLarge, maxBytes)
+	}
+	return dataBytes, nil
+}
+
+// preferencesKey is what the preferences of a request's maker are kept under:
+// the API key it was made with, or else the identity a token proved, joined
+// by a newline no header value can hold so no API key can pose as one.
+func preferencesKey(request *http.Request) string {
+	identity := auth.IdentityOf(request)
+	switch {
+	case identity == nil:
+		return ""
+	case identity.Provider == auth.ProviderAPIKey:
+		return identity.Subject
+	default:
+		return identity.Provider + "\n" + identity.Subject
+	}
+}
+
+func writePreferences(response http.ResponseWriter, data interface{}) {
+	responseBytes, err := json.Marshal(data)
+	if err != nil {
+		response.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	response.WriteHeader(http.StatusOK)
+	response.Write(responseBytes)
+}
+
+// handlePreferences reads or replaces, as one JSON object, the preferences
+// kept for the client a request is made by.
+func handlePreferences(response http.ResponseWriter, request *http.Request) {
+	clientKey := preferencesKey(request)
+	if clientKey == "" {
+		response.WriteHeader(http.StatusUnauthorized)
+		response.Write([]byte(`preferences are kept per client; send an API key in X-API-Key or a bearer token`))
+		return
+	}
+
+	switch request.Method {
+	case "GET":
+		values, err := preferences.Get(clientKey)
+		if err != nil {
+			response.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		writePreferences(response, values)
+	case "PUT":
+		dataBytes, err := readPreferencesBody(request)
+		if err != nil {
+			response.WriteHeader(preferencesStatus(err))
+			response.Write([]byte(err.Error()))
+			return
+		}
+
+		var values preferences.Values
+		if err := json.Unmarshal(dataBytes, &values); err != nil || values == nil {
+			response.WriteHeader(http.StatusBadRequest)
+			response.Write([]byte(`preferences must be a JSON object`))
+			return
+		}
+		for name, value := range values {
+			var compactValue bytes.Buffer
+			if err := json.Compact(&compactValue, value); err == nil {
+				values[name] = compactValue.Bytes()
+			}
+		}
+
+		if err := preferences.Replace(clientKey, values); err != nil {
+			response.WriteHeader(preferencesStatus(err))
+			response.Write([]byte(err.Error()))
+			return
+		}
+		writePreferences(response, values)
+	default:
+		response.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// handlePreference reads, sets or deletes one preference of the client a
+// request is made by. Values are any JSON.
+func handlePreference(response http.ResponseWriter, request *http.Request, name string) {
+	clientKey := preferencesKey(request)
+	if clientKey == "" {
+		response.WriteHeader(http.StatusUnauthorized)
+		response.Write([]byte(`preferences are kept per client; send an API key in X-API-Key or a bearer token`))
+		return
+	}
+
+	switch request.Method {
+	case "GET":
+		values, err := preferences.Get(clientKey)
+		if err != nil {
+			response.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		value, hasValue := values[name]
+		if !hasValue {
+			response.WriteHeader(http.StatusNotFound)
+			return
+		}
+		writePreferences(response, value)
+	case "PUT":
+		dataBytes, err := readPreferencesBody(request)
+		if err != nil {
+			response.WriteHeader(preferencesStatus(err))
+			response.Write([]byte(err.Error()))
+			return
+		}
+
+		var value bytes.Buffer
+		if err := json.Compact(&value, dataBytes); err != nil {
+			response.WriteHeader(http.StatusBadRequest)
+			response.Write([]byte(fmt.Sprintf(`preference "%s" must be JSON: %v`, name, err)))
+			return
+		}
+
+		if err := preferences.Set(clientKey, name, value.Bytes()); err != nil {
+			response.WriteHeader(preferencesStatus(err))
+			response.Write([]byte(err.Error()))
+			return
+		}
+		writePreferences(response, json.RawMessage(value.Bytes()))
+	case "DELETE":
+		hadValue, err := preferences.Delete(clientKey, name)
+		if err != nil {
+			response.WriteHeader(preferencesStatus(err))
+			return
+		}
+		if !hadValue {
+			response.WriteHeader(http.StatusNotFound)
+			return
+		}
+		response.WriteHeader(http.StatusNoContent)
+	default:
+		response.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,22 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/metrics"
+)
+
+// HandleMetrics serves every counter, gauge and histogram for Prometheus to
+// scrape, including the latest reading of each metric per hardware. It is
+// mounted outside /api/, so scrapes neither count against a quota nor show up
+// in the request metrics.
+func HandleMetrics(response http.ResponseWriter, request *http.Request) {
+	if request.Method != "GET" {
+		response.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	response.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	response.WriteHeader(http.StatusOK)
+	metrics.WritePrometheus(response)
+}
@@ -0,0 +1,179 @@
+// Package puller periodically fetches sample exports from remote historians
+// and ingests them into the sample store.
+package puller
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/config"
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/hardware"
+)
+
+type Status struct {
+	Name          string    `json:"name"`
+	LastAttempt   time.Time `json:"lastAttempt"`
+	LastSuccess   time.Time `json:"lastSuccess"`
+	LastError     string    `json:"lastError,omitempty"`
+	ReadingsTotal int64     `json:"readingsTotal"`
+}
+
+var (
+	statusesMutex sync.Mutex
+	statuses      map[string]*Status = make(map[string]*Status)
+
+	client = &http.Client{Timeout: time.Minute}
+
+	running sync.WaitGroup
+)
+
+func Statuses() []Status {
+	statusesMutex.Lock()
+	defer statusesMutex.Unlock()
+
+	copiedStatuses := make([]Status, 0, len(statuses))
+	for _, status := range statuses {
+		copiedStatuses = append(copiedStatuses, *status)
+	}
+	return copiedStatuses
+}
+
+func parseCSV(reader io.Reader, hardwareId string) ([]*hardware.Reading, error) {
+	wideReader, err := hardware.NewWideCSVReader(reader, hardwareId, config.Current.CSVOptions())
+	if err != nil {
+		return nil, err
+	}
+
+	readings := make([]*hardware.Reading, 0)
+	for {
+		reading, err := wideReader.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		readings = append(readings, reading)
+	}
+	return readings, nil
+}
+
+func pull(ctx context.Context, source config.Puller) (int, error) {
+	request, err := http.NewRequestWithContext(ctx, "GET", source.URL, nil)
+	if err != nil {
+		return 0, err
+	}
+	for name, value := range source.Headers {
+		request.Header.Set(name, value)
+	}
+
+	response, err := client.Do(request)
+	if err != nil {
+		return 0, err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf(`remote source answered %s`, response.Status)
+	}
+
+	var readings []*hardware.Reading
+	switch source.Format {
+	case "csv":
+		if readings, err = parseCSV(response.Body, source.HardwareId); err != nil {
+			return 0, err
+		}
+	case "", "json":
+		if err := json.NewDecoder(response.Body).Decode(&readings); err != nil {
+			return 0, fmt.Errorf(`unable to parse JSON readings: %w`, err)
+		}
+		for _, reading := range readings {
+			if reading.HardwareId == "" {
+				reading.HardwareId = source.HardwareId
+			}
+		}
+	default:
+		return 0, fmt.Errorf(`unknown format "%s"`, source.Format)
+	}
+
+	// Pulled readings are live, so their skew and arrival lag are recorded,
+	// though none is refused for it
+	arrivalTime := time.Now()
+	for _, reading := range readings {
+		reading.Time, _ = hardware.ClockSkewPolicy{}.Apply(reading.HardwareId, reading.Time, arrivalTime)
+	}
+	return len(readings), hardware.AddSamples(readings)
+}
+
+func run(ctx context.Context, source config.Puller) {
+	statusesMutex.Lock()
+	status := &Status{Name: source.Name}
+	statuses[source.Name] = status
+	statusesMutex.Unlock()
+
+	ticker := time.NewTicker(source.Interval.Duration)
+	defer ticker.Stop()
+	for {
+		readingCount, err := pull(ctx, source)
+
+		statusesMutex.Lock()
+		status.LastAttempt = time.Now()
+		if err != nil {
+			status.LastError = err.Error()
+			log.Printf("puller %s: %v", source.Name, err)
+		} else {
+			status.LastSuccess = status.LastAttempt
+			status.LastError = ""
+			status.ReadingsTotal += int64(readingCount)
+		}
+		statusesMutex.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Start pulls every configured source on its own interval until ctx is done.
+func Start(ctx context.Context, sources []config.Puller) error {
+	for _, source := range sources {
+		if source.Name == "" || source.URL == "" {
+			return fmt.Errorf(`puller needs both a name and a URL`)
+		}
+		if source.Interval.Duration <= 0 {
+			return fmt.Errorf(`puller "%s" needs a positive interval`, source.Name)
+		}
+	}
+
+	for _, source := range sources {
+		running.Add(1)
+		go func(source config.Puller) {
+			defer running.Done()
+			run(ctx, source)
+		}(source)
+	}
+	return nil
+}
+
+// Wait blocks until every puller has stopped after the context given to Start
+// is done, so none is ingesting any more, or until ctx is done.
+func Wait(ctx context.Context) error {
+	stopped := make(chan struct{})
+	go func() {
+		running.Wait()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,74 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/hardware"
+)
+
+type QualityResponseData struct {
+	Id     string                       `json:"id"`
+	From   time.Time                    `json:"from"`
+	To     time.Time                    `json:"to"`
+	Checks []*hardware.ConsistencyCheck `json:"checks"`
+
+	// Inconsistencies lists at most limit of the inconsistent readings, the
+	// earliest first; the checks count all of them.
+	Inconsistencies []*hardware.Inconsistency `json:"inconsistencies"`
+}
+
+// handleQuality cross-checks related channels of a hardware over a window,
+// flagging readings such as an RMS velocity above the peak of its axis.
+func handleQuality(response http.ResponseWriter, request *http.Request, hardwareId string) {
+	if request.Method != "GET" {
+		response.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	revision := hardware.Revision()
+	if !hardware.HasSamples(hardwareId) {
+		response.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	query := request.URL.Query()
+	from, err := time.Parse(time.RFC3339, query.Get("from"))
+	if err != nil {
+		response.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	to, err := time.Parse(time.RFC3339, query.Get("to"))
+	if err != nil || !to.After(from) {
+		response.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	limit, err := queryInt(query, "limit", 100, 0, 10000)
+	if err != nil {
+		response.WriteHeader(http.StatusBadRequest)
+		response.Write([]byte(err.Error()))
+		return
+	}
+
+	checks, inconsistencies, err := hardware.CheckConsistency(hardwareId, from, to)
+	if err != nil {
+		response.WriteHeader(errorStatus(err, http.StatusInternalServerError))
+		return
+	}
+	if len(inconsistencies) > limit {
+		inconsistencies = inconsistencies[:limit]
+	}
+
+	responseBytes, err := json.Marshal(QualityResponseData{Id: hardwareId, From: from, To: to, Checks: checks, Inconsistencies: inconsistencies})
+	if err != nil {
+		response.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if setCacheHeaders(response, request, nil, revision, to) {
+		response.WriteHeader(http.StatusNotModified)
+		return
+	}
+	response.WriteHeader(http.StatusOK)
+	response.Write(responseBytes)
+}
@@ -0,0 +1,24 @@
+package api
+
+import (
+	_ "embed"
+	"net/http"
+)
+
+//go:embed query.html
+var queryPage []byte
+
+// HandleQueryPage serves a form that tabulates the samples of a hardware over
+// a window into a table, for people poking at the data without a client of
+// their own. The page calls the API like any other client, so authenticates
+// with the API key entered in it.
+func HandleQueryPage(response http.ResponseWriter, request *http.Request) {
+	if request.Method != "GET" && request.Method != "HEAD" {
+		response.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	response.Header().Set("Content-Type", "text/html; charset=utf-8")
+	response.WriteHeader(http.StatusOK)
+	response.Write(queryPage)
+}
@@ -0,0 +1,151 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"time"
+
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/config"
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/internal/auth"
+)
+
+// callbackPattern admits JSONP callbacks that are dotted identifiers, such
+// as "render" or "demo.onOverview", and nothing a script could be slipped
+// into.
+var callbackPattern = regexp.MustCompile(`^[A-Za-z_$][A-Za-z0-9_$]*(\.[A-Za-z_$][A-Za-z0-9_$]*)*$`)
+
+type ReadOnlyTokenRequestData struct {
+	Subject string `json:"subject"`
+
+	// Lifetime defaults to, and may not exceed, the configured maximum.
+	Lifetime config.Duration `json:"lifetime"`
+}
+
+type ReadOnlyTokenResponseData struct {
+	Token     string    `json:"token"`
+	Subject   string    `json:"subject"`
+	ExpiresAt time.Time `json:"expiresAt"`
+	Routes    []string  `json:"routes"`
+}
+
+// jsonpResponseWriter holds a response back, to wrap it in a call to
+// callback once the handler is done.
+type jsonpResponseWriter struct {
+	http.ResponseWriter
+	callback   string
+	statusCode int
+	body       bytes.Buffer
+}
+
+func (writer *jsonpResponseWriter) WriteHeader(statusCode int) {
+	if writer.statusCode == 0 {
+		writer.statusCode = statusCode
+	}
+}
+
+func (writer *jsonpResponseWriter) Write(data []byte) (int, error) {
+	if writer.statusCode == 0 {
+		writer.statusCode = http.StatusOK
+	}
+	return writer.body.Write(data)
+}
+
+// flush sends the response held back as a script. Bodies that are not JSON,
+// such as error messages, are passed as strings.
+func (writer *jsonpResponseWriter) flush() {
+	if writer.statusCode == 0 {
+		writer.statusCode = http.StatusOK
+	}
+	argument := writer.body.Bytes()
+	if !json.Valid(argument) {
+		argument, _ = json.Marshal(writer.body.String())
+	}
+
+	header := writer.ResponseWriter.Header()
+	header.Del("Content-Length")
+	header.Set("Content-Type", "application/javascript; charset=utf-8")
+	header.Set("X-Content-Type-Options", "nosniff")
+	writer.ResponseWriter.WriteHeader(writer.statusCode)
+	fmt.Fprintf(writer.ResponseWriter, "/**/%s(%s);", writer.callback, argument)
+}
+
+// allowReadOnlyClients lets static pages read the response to a request made
+// with a read-only token from any origin, file:// included, and wraps it for
+// a callback if one is named. It returns the writer to answer with, and
+// false for requests it already refused.
+func allowReadOnlyClients(response http.ResponseWriter, request *http.Request) (http.ResponseWriter, func(), bool) {
+	query := request.URL.Query()
+	if query.Get(auth.ReadOnlyTokenParameter) == "" {
+		return response, func() {}, true
+	}
+	response.Header().Set("Access-Control-Allow-Origin", "*")
+
+	callback := query.Get("callback")
+	if callback == "" {
+		return response, func() {}, true
+	}
+	if !callbackPattern.MatchString(callback) {
+		response.WriteHeader(http.StatusBadRequest)
+		response.Write([]byte(fmt.Sprintf(`callback "%s" is not a JavaScript name`, callback)))
+		return response, func() {}, false
+	}
+	jsonpResponse := &jsonpResponseWriter{ResponseWriter: response, callback: callback}
+	return jsonpResponse, jsonpResponse.flush, true
+}
+
+// handleReadOnlyTokens issues read-only tokens for static demos.
+func handleReadOnlyTokens(response http.ResponseWriter, request *http.Request) {
+	if request.Method != "POST" {
+		response.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	dataBytes, err := io.ReadAll(request.Body)
+	if err != nil {
+		response.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	var requestData ReadOnlyTokenRequestData
+	if err := json.Unmarshal(dataBytes, &requestData); err != nil {
+		response.WriteHeader(http.StatusBadRequest)
+		response.Write([]byte(err.Error()))
+		return
+	}
+
+	readOnlyTokens := config.Current.Authentication.ReadOnlyTokens
+	if requestData.Subject == "" {
+		response.WriteHeader(http.StatusBadRequest)
+		response.Write([]byte(`subject is required`))
+		return
+	}
+	lifetime := requestData.Lifetime.Duration
+	if lifetime == 0 {
+		lifetime = readOnlyTokens.MaxLifetime.Duration
+	}
+	if lifetime < 0 || lifetime > readOnlyTokens.MaxLifetime.Duration {
+		response.WriteHeader(http.StatusBadRequest)
+		response.Write([]byte(fmt.Sprintf(`lifetime must be positive and at most %v`, readOnlyTokens.MaxLifetime.Duration)))
+		return
+	}
+
+	expiresAt := time.Now().Add(lifetime).Truncate(time.Second)
+	token, err := auth.SignReadOnlyToken(requestData.Subject, expiresAt)
+	if err != nil {
+		response.WriteHeader(http.StatusConflict)
+		response.Write([]byte(err.Error()))
+		return
+	}
+
+	responseBytes, err := json.Marshal(ReadOnlyTokenResponseData{Token: token, Subject: requestData.Subject, ExpiresAt: expiresAt, Routes: readOnlyTokens.Routes})
+	if err != nil {
+		response.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	response.WriteHeader(http.StatusCreated)
+	response.Write(responseBytes)
+}
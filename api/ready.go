@@ -0,0 +1,55 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/config"
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/hardware"
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/internal/lifecycle"
+)
+
+type ReadinessResponseData struct {
+	Ready               bool     `json:"ready"`
+	Hardware            int      `json:"hardware"`
+	HardwareWithoutData []string `json:"hardwareWithoutData"`
+	Draining            bool     `json:"draining,omitempty"`
+
+	// Storage is reported with a storage backend. An open breaker leaves the
+	// server ready, as recent data is still served from memory.
+	Storage *hardware.BreakerStatus `json:"storage,omitempty"`
+}
+
+func handleReadiness(response http.ResponseWriter, request *http.Request) {
+	if request.Method != "GET" {
+		response.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	responseData := ReadinessResponseData{
+		Hardware:            len(hardware.HardwareIds()),
+		HardwareWithoutData: hardware.HardwareWithoutData(),
+		Draining:            lifecycle.Draining(),
+	}
+	if hardware.HasStore() {
+		storeStatus := hardware.StoreStatus()
+		responseData.Storage = &storeStatus
+	}
+	responseData.Ready = responseData.Hardware > 0 && !responseData.Draining
+	if config.Current.Loading.EmptyHardware == config.EmptyHardwareNotReady && len(responseData.HardwareWithoutData) > 0 {
+		responseData.Ready = false
+	}
+
+	responseBytes, err := json.Marshal(responseData)
+	if err != nil {
+		response.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if responseData.Ready {
+		response.WriteHeader(http.StatusOK)
+	} else {
+		response.WriteHeader(http.StatusServiceUnavailable)
+	}
+	response.Write(responseBytes)
+}
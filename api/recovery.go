@@ -0,0 +1,65 @@
+package api
+
+import (
+	"bufio"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"runtime/debug"
+
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/internal/accesslog"
+)
+
+type recoveringResponseWriter struct {
+	http.ResponseWriter
+	wroteHeader bool
+	statusCode  int
+}
+
+func (writer *recoveringResponseWriter) WriteHeader(statusCode int) {
+	if !writer.wroteHeader {
+		writer.statusCode = statusCode
+	}
+	writer.wroteHeader = true
+	writer.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (writer *recoveringResponseWriter) Write(data []byte) (int, error) {
+	writer.wroteHeader = true
+	return writer.ResponseWriter.Write(data)
+}
+
+// Flush lets streaming handlers push what they wrote through the wrapper.
+func (writer *recoveringResponseWriter) Flush() {
+	if flusher, isFlusher := writer.ResponseWriter.(http.Flusher); isFlusher {
+		writer.wroteHeader = true
+		flusher.Flush()
+	}
+}
+
+// Hijack lets WebSocket handlers take the connection over through the
+// wrapper. The request is observed as having switched protocols.
+func (writer *recoveringResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, isHijacker := writer.ResponseWriter.(http.Hijacker)
+	if !isHijacker {
+		return nil, nil, errors.New(`the connection cannot be taken over`)
+	}
+	connection, readWriter, err := hijacker.Hijack()
+	if err == nil {
+		writer.wroteHeader = true
+		writer.statusCode = http.StatusSwitchingProtocols
+	}
+	return connection, readWriter, err
+}
+
+// recoverPanic turns a panic in a handler into a logged 500, so one bad
+// request cannot take the whole process down.
+func recoverPanic(response *recoveringResponseWriter, request *http.Request, client string) {
+	if recovered := recover(); recovered != nil {
+		log.Printf("panic serving %s %s for %s: %v\n%s", request.Method, accesslog.RedactedURI(request), client, recovered, debug.Stack())
+		if !response.wroteHeader {
+			response.WriteHeader(http.StatusInternalServerError)
+		}
+	}
+}
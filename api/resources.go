@@ -0,0 +1,50 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+)
+
+// routeHardwareResource dispatches paths of the form /api/hardware/{id}/{resource},
+// and /api/hardware/{id} itself, returning the route name with the hardware
+// ID left out so that metrics are not split per hardware.
+func routeHardwareResource(response http.ResponseWriter, request *http.Request) (string, bool) {
+	hardwareId, resource, hasResource := strings.Cut(strings.TrimPrefix(request.URL.Path, "/api/hardware/"), "/")
+	if hardwareId == "" {
+		return "", false
+	}
+	if !hasResource {
+		handleHardwareDescription(response, request, hardwareId)
+		return "/api/hardware/{id}", true
+	}
+
+	switch resource {
+	case "aggregate":
+		handleAggregate(response, request, hardwareId)
+	case "anomaly":
+		handleAnomaly(response, request, hardwareId)
+	case "arrival_lag":
+		handleArrivalLag(response, request, hardwareId)
+	case "clock_offset":
+		handleClockOffset(response, request, hardwareId)
+	case "export":
+		handleExport(response, request, hardwareId)
+	case "ordering":
+		handleOrdering(response, request, hardwareId)
+	case "panel":
+		handlePanel(response, request, hardwareId)
+	case "quality":
+		handleQuality(response, request, hardwareId)
+	case "samples":
+		handleHardwareSamples(response, request, hardwareId)
+	case "severity-timeline":
+		handleSeverityTimeline(response, request, hardwareId)
+	case "sparkline":
+		handleSparkline(response, request, hardwareId)
+	case "stream":
+		handleHardwareStream(response, request, hardwareId)
+	default:
+		return "", false
+	}
+	return "/api/hardware/{id}/" + resource, true
+}
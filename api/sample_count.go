@@ -0,0 +1,55 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/hardware"
+)
+
+type SampleCountResponseData struct {
+	Id     string         `json:"id"`
+	From   time.Time      `json:"from"`
+	To     time.Time      `json:"to"`
+	Counts map[string]int `json:"counts"`
+}
+
+func handleSampleCount(response http.ResponseWriter, request *http.Request) {
+	if request.Method != "GET" {
+		response.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	revision := hardware.Revision()
+
+	query := request.URL.Query()
+	from, err := time.Parse(time.RFC3339, query.Get("from"))
+	if err != nil {
+		response.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	to, err := time.Parse(time.RFC3339, query.Get("to"))
+	if err != nil {
+		response.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	counts, err := hardware.CountSamples(query.Get("id"), from, to)
+	if err != nil {
+		response.WriteHeader(errorStatus(err, http.StatusBadRequest))
+		return
+	}
+
+	responseBytes, err := json.Marshal(SampleCountResponseData{Id: query.Get("id"), From: from, To: to, Counts: counts})
+	if err != nil {
+		response.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if setCacheHeaders(response, request, nil, revision, to) {
+		response.WriteHeader(http.StatusNotModified)
+		return
+	}
+	response.WriteHeader(http.StatusOK)
+	response.Write(responseBytes)
+}
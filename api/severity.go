@@ -0,0 +1,235 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/config"
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/hardware"
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/health"
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/units"
+)
+
+const (
+	SeverityScaleHealth   = "health"
+	SeverityScaleISO10816 = "iso10816"
+
+	// SeverityNoData labels stretches too far from any sample to judge.
+	SeverityNoData = "no_data"
+)
+
+type SeverityInterval struct {
+	From  time.Time `json:"from"`
+	To    time.Time `json:"to"`
+	State string    `json:"state"`
+}
+
+type SeverityTimelineResponseData struct {
+	Id        string              `json:"id"`
+	From      time.Time           `json:"from"`
+	To        time.Time           `json:"to"`
+	Scale     string              `json:"scale"`
+	Class     string              `json:"class,omitempty"`
+	MaxGap    config.Duration     `json:"maxGap"`
+	Intervals []*SeverityInterval `json:"intervals"`
+}
+
+// extend adds an interval, lengthening the last one instead when it ends
+// where the new one starts in the same state.
+func (timeline *SeverityTimelineResponseData) extend(from time.Time, to time.Time, state string) {
+	if !to.After(from) {
+		return
+	}
+	if lastIndex := len(timeline.Intervals) - 1; lastIndex >= 0 && timeline.Intervals[lastIndex].State == state && timeline.Intervals[lastIndex].To.Equal(from) {
+		timeline.Intervals[lastIndex].To = to
+		return
+	}
+	timeline.Intervals = append(timeline.Intervals, &SeverityInterval{From: from, To: to, State: state})
+}
+
+// severityJudge works out the state of a hardware from the latest value of
+// each metric it looks at.
+type severityJudge func(values map[string]float64) string
+
+func healthJudge(hardwareId string) severityJudge {
+	return func(values map[string]float64) string {
+		_, state := health.Score(hardwareId, values)
+		return state
+	}
+}
+
+// iso10816Judge places the largest RMS velocity, in mm/s, in the zones of a
+// machine class.
+func iso10816Judge(machineClass string, metrics []string) (severityJudge, error) {
+	toMillimetersPerSecond := make(map[string]func(float64) float64, len(metrics))
+	for _, metric := range metrics {
+		unit, _ := hardware.UnitOf(metric)
+		converter, err := units.Converter(unit, "mms")
+		if err != nil {
+			return nil, fmt.Errorf(`metric "%s" is not a velocity: %w`, metric, err)
+		}
+		toMillimetersPerSecond[metric] = converter
+	}
+
+	return func(values map[string]float64) string {
+		velocity, hasVelocity := 0.0, false
+		for metric, value := range values {
+			if convertedValue := toMillimetersPerSecond[metric](value); !hasVelocity || convertedValue > velocity {
+				velocity, hasVelocity = convertedValue, true
+			}
+		}
+		if !hasVelocity {
+			return health.StateUnknown
+		}
+		zone, _ := health.ISO10816Zone(machineClass, velocity)
+		return zone
+	}, nil
+}
+
+// handleSeverityTimeline labels a window of a hardware with contiguous
+// intervals of health state, or of ISO 10816 zone, so dashboards can draw a
+// status strip above charts. Each sample holds its state until the next one,
+// or for at most maxGap, which defaults to as far as interpolation reaches.
+func handleSeverityTimeline(response http.ResponseWriter, request *http.Request, hardwareId string) {
+	if request.Method != "GET" {
+		response.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	revision := hardware.Revision()
+	if !hardware.HasSamples(hardwareId) {
+		response.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	query := request.URL.Query()
+	from, err := time.Parse(time.RFC3339, query.Get("from"))
+	if err != nil {
+		response.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	to, err := time.Parse(time.RFC3339, query.Get("to"))
+	if err != nil || !to.After(from) {
+		response.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	var metrics []string
+	if query.Get("metrics") != "" {
+		metrics = strings.Split(query.Get("metrics"), ",")
+		for _, metric := range metrics {
+			if !hardware.IsMetric(metric) {
+				response.WriteHeader(http.StatusBadRequest)
+				response.Write([]byte(fmt.Sprintf(`%v "%s"`, hardware.ErrUnknownMetric, metric)))
+				return
+			}
+		}
+	}
+
+	timeline := &SeverityTimelineResponseData{Id: hardwareId, From: from, To: to, Scale: query.Get("scale"), Intervals: make([]*SeverityInterval, 0)}
+	var judge severityJudge
+	switch timeline.Scale {
+	case "", SeverityScaleHealth:
+		timeline.Scale = SeverityScaleHealth
+		if metrics == nil {
+			metrics = hardware.Metrics()
+		}
+		judge = healthJudge(hardwareId)
+	case SeverityScaleISO10816:
+		timeline.Class = query.Get("class")
+		if _, err := health.ISO10816Zone(timeline.Class, 0); err != nil {
+			response.WriteHeader(http.StatusBadRequest)
+			response.Write([]byte(err.Error()))
+			return
+		}
+		if metrics == nil {
+			for _, metric := range hardware.Metrics() {
+				if strings.HasPrefix(metric, "rmsVelocity") {
+					metrics = append(metrics, metric)
+				}
+			}
+		}
+		if judge, err = iso10816Judge(timeline.Class, metrics); err != nil {
+			response.WriteHeader(http.StatusBadRequest)
+			response.Write([]byte(err.Error()))
+			return
+		}
+	default:
+		response.WriteHeader(http.StatusBadRequest)
+		response.Write([]byte(fmt.Sprintf(`unknown scale "%s", must be %s or %s`, timeline.Scale, SeverityScaleHealth, SeverityScaleISO10816)))
+		return
+	}
+
+	maxGap := time.Duration(0)
+	if query.Get("maxGap") != "" {
+		if maxGap, err = time.ParseDuration(query.Get("maxGap")); err != nil || maxGap < 0 {
+			response.WriteHeader(http.StatusBadRequest)
+			return
+		}
+	} else {
+		averageInterval, err := hardware.AverageInterval(hardwareId)
+		if err != nil {
+			response.WriteHeader(errorStatus(err, http.StatusInternalServerError))
+			return
+		}
+		maxGap = time.Duration(config.Current.Interpolation.MaxLookbackIntervals * float64(averageInterval))
+	}
+	timeline.MaxGap = config.Duration{Duration: maxGap}
+	// holdUntil is when the state of a sample stops counting, a zero maxGap
+	// holding it until the next sample however far
+	holdUntil := func(at time.Time, next time.Time) time.Time {
+		if maxGap > 0 && next.Sub(at) > maxGap {
+			return at.Add(maxGap)
+		}
+		return next
+	}
+
+	samples, err := hardware.SamplesBetween(hardwareId, from, to)
+	if err != nil {
+		response.WriteHeader(errorStatus(err, http.StatusInternalServerError))
+		return
+	}
+
+	values := make(map[string]float64, len(metrics))
+	stateFrom := from
+	if len(samples) > 0 && maxGap > 0 && samples[0].Time.Sub(from) > maxGap {
+		stateFrom = samples[0].Time
+	}
+	timeline.extend(from, stateFrom, SeverityNoData)
+	for sampleIndex, sample := range samples {
+		for _, metric := range metrics {
+			if value, _ := sample.ValueByMetric(metric); value != nil {
+				values[metric] = *value
+			}
+		}
+
+		next := to
+		if sampleIndex+1 < len(samples) {
+			next = samples[sampleIndex+1].Time
+		}
+		stateTo := holdUntil(sample.Time, next)
+		timeline.extend(stateFrom, stateTo, judge(values))
+		if stateTo.Before(next) {
+			// Values that old say nothing about what comes after the gap
+			timeline.extend(stateTo, next, SeverityNoData)
+			values = make(map[string]float64, len(metrics))
+		}
+		stateFrom = next
+	}
+	timeline.extend(stateFrom, to, SeverityNoData)
+
+	responseBytes, err := json.Marshal(timeline)
+	if err != nil {
+		response.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if setCacheHeaders(response, request, nil, revision, to) {
+		response.WriteHeader(http.StatusNotModified)
+		return
+	}
+	response.WriteHeader(http.StatusOK)
+	response.Write(responseBytes)
+}
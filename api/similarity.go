@@ -0,0 +1,169 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/hardware"
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/statistics"
+)
+
+type SimilarHardware struct {
+	Id          string               `json:"id"`
+	Correlation statistics.Statistic `json:"correlation"`
+
+	// Lag is how much later the pattern shows up on this hardware.
+	Lag string `json:"lag"`
+}
+
+type SimilarityResponseData struct {
+	Id      string             `json:"id"`
+	Metric  string             `json:"metric"`
+	From    time.Time          `json:"from"`
+	To      time.Time          `json:"to"`
+	Matches []*SimilarHardware `json:"matches"`
+}
+
+// errBucketsTooNarrow is returned for buckets narrower than the millisecond
+// samples are timestamped to.
+var errBucketsTooNarrow = errors.New("buckets narrower than a millisecond")
+
+// bucketMeans averages a metric into equal buckets over a window, leaving NaN
+// where a bucket holds no sample.
+func bucketMeans(hardwareId string, metric string, from time.Time, to time.Time, buckets int) ([]float64, error) {
+	bucketWidth := to.Sub(from) / time.Duration(buckets)
+	if bucketWidth < time.Millisecond {
+		return nil, fmt.Errorf(`%w: %d buckets over %s`, errBucketsTooNarrow, buckets, to.Sub(from))
+	}
+	samples, err := hardware.SamplesBetween(hardwareId, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	sums, counts := make([]float64, buckets), make([]int, buckets)
+	for _, sample := range samples {
+		value, _ := sample.ValueByMetric(metric)
+		if value == nil {
+			continue
+		}
+		bucket := int(sample.Time.Sub(from) / bucketWidth)
+		if bucket >= buckets {
+			bucket = buckets - 1
+		}
+		sums[bucket] += *value
+		counts[bucket]++
+	}
+
+	means := make([]float64, buckets)
+	for bucket := range means {
+		means[bucket] = math.NaN()
+		if counts[bucket] > 0 {
+			means[bucket] = sums[bucket] / float64(counts[bucket])
+		}
+	}
+	return means, nil
+}
+
+func queryInt(query map[string][]string, key string, fallback int, minimum int, maximum int) (int, error) {
+	values, hasValue := query[key]
+	if !hasValue || values[0] == "" {
+		return fallback, nil
+	}
+	value, err := strconv.Atoi(values[0])
+	if err != nil || value < minimum || value > maximum {
+		return 0, fmt.Errorf(`%s "%s" is not between %d and %d`, key, values[0], minimum, maximum)
+	}
+	return value, nil
+}
+
+func handleSimilarity(response http.ResponseWriter, request *http.Request) {
+	if request.Method != "GET" {
+		response.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	revision := hardware.Revision()
+
+	query := request.URL.Query()
+	hardwareId, metric := query.Get("id"), query.Get("metric")
+	if !hardware.IsMetric(metric) {
+		response.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	from, err := time.Parse(time.RFC3339, query.Get("from"))
+	if err != nil {
+		response.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	to, err := time.Parse(time.RFC3339, query.Get("to"))
+	if err != nil || !to.After(from) {
+		response.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	buckets, err := queryInt(query, "buckets", 60, 4, 1000)
+	if err != nil {
+		response.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	maxLag, err := queryInt(query, "maxLag", 0, 0, buckets/2)
+	if err != nil {
+		response.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	limit, err := queryInt(query, "limit", 5, 1, 100)
+	if err != nil {
+		response.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	reference, err := bucketMeans(hardwareId, metric, from, to, buckets)
+	if err != nil {
+		response.WriteHeader(errorStatus(err, http.StatusInternalServerError))
+		return
+	}
+
+	// Other hardware are compared over the same window; a lag shifts one
+	// against the other, shrinking the overlap
+	bucketWidth := to.Sub(from) / time.Duration(buckets)
+	matches := make([]*SimilarHardware, 0)
+	for _, otherHardwareId := range hardware.HardwareIds() {
+		if otherHardwareId == hardwareId {
+			continue
+		}
+		other, err := bucketMeans(otherHardwareId, metric, from, to, buckets)
+		if err != nil {
+			response.WriteHeader(errorStatus(err, http.StatusInternalServerError))
+			return
+		}
+
+		correlation, lag := statistics.NormalizedCrossCorrelation(reference, other, maxLag, buckets/2)
+		if correlation.Value == nil {
+			continue
+		}
+		matches = append(matches, &SimilarHardware{Id: otherHardwareId, Correlation: correlation, Lag: (time.Duration(lag) * bucketWidth).String()})
+	}
+	sort.Slice(matches, func(leftIndex, rightIndex int) bool {
+		return *matches[leftIndex].Correlation.Value > *matches[rightIndex].Correlation.Value
+	})
+	if len(matches) > limit {
+		matches = matches[:limit]
+	}
+
+	responseBytes, err := json.Marshal(SimilarityResponseData{Id: hardwareId, Metric: metric, From: from, To: to, Matches: matches})
+	if err != nil {
+		response.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if setCacheHeaders(response, request, nil, revision, to) {
+		response.WriteHeader(http.StatusNotModified)
+		return
+	}
+	response.WriteHeader(http.StatusOK)
+	response.Write(responseBytes)
+}
@@ -0,0 +1,104 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"time"
+
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/config"
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/hardware"
+)
+
+const sparklineSignificantDigits = 4
+
+// roundForSparkline keeps values short on the wire: to the channel's display
+// precision, or else to a few significant digits, more than a sparkline
+// can show anyway.
+func roundForSparkline(metric string, value float64) float64 {
+	if decimals, hasPrecision := config.Current.PrecisionOf(metric); hasPrecision {
+		scale := math.Pow(10, float64(decimals))
+		return math.Round(value*scale) / scale
+	}
+	if value == 0 {
+		return 0
+	}
+	scale := math.Pow(10, sparklineSignificantDigits-math.Ceil(math.Log10(math.Abs(value))))
+	return math.Round(value*scale) / scale
+}
+
+// handleSparkline returns nothing but the means of one channel over equal
+// buckets of the window up to its latest value, for list views showing many
+// hardware at once. Buckets without a sample repeat the mean before them, or
+// after them at the start, so the array never holds nulls; a channel with no
+// samples in the window gives an empty array.
+func handleSparkline(response http.ResponseWriter, request *http.Request, hardwareId string) {
+	if request.Method != "GET" {
+		response.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if !hardware.HasSamples(hardwareId) {
+		response.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	query := request.URL.Query()
+	metric := query.Get("channel")
+	if !hardware.IsMetric(metric) {
+		response.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	points, err := queryInt(query, "points", 30, 2, 500)
+	if err != nil {
+		response.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	window := sparklineWindow
+	if query.Get("window") != "" {
+		if window, err = time.ParseDuration(query.Get("window")); err != nil || window < time.Duration(points)*time.Millisecond {
+			response.WriteHeader(http.StatusBadRequest)
+			response.Write([]byte(fmt.Sprintf(`window must be at least a millisecond per point, %s for %d points`, time.Duration(points)*time.Millisecond, points)))
+			return
+		}
+	}
+
+	latestValues, err := hardware.LatestValues(hardwareId)
+	if err != nil {
+		response.WriteHeader(errorStatus(err, http.StatusInternalServerError))
+		return
+	}
+	sparkline := make([]float64, 0, points)
+	if latestValue, hasLatestValue := latestValues[metric]; hasLatestValue {
+		means, err := bucketMeans(hardwareId, metric, latestValue.Time.Add(-window), latestValue.Time, points)
+		if err != nil {
+			response.WriteHeader(errorStatus(err, http.StatusInternalServerError))
+			return
+		}
+
+		firstMean := math.NaN()
+		for _, mean := range means {
+			if !math.IsNaN(mean) {
+				firstMean = mean
+				break
+			}
+		}
+		previousMean := firstMean
+		for _, mean := range means {
+			if math.IsNaN(mean) {
+				mean = previousMean
+			}
+			sparkline = append(sparkline, roundForSparkline(metric, mean))
+			previousMean = mean
+		}
+	}
+
+	responseBytes, err := json.Marshal(sparkline)
+	if err != nil {
+		response.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	response.WriteHeader(http.StatusOK)
+	response.Write(responseBytes)
+}
@@ -0,0 +1,76 @@
+package statistics
+
+import (
+	"fmt"
+	"time"
+)
+
+const day = 24 * time.Hour
+
+// ValidateBucketWidth accepts widths that tile a local day evenly, or whole
+// numbers of days, which are the only widths that stay aligned across DST.
+func ValidateBucketWidth(width time.Duration) error {
+	switch {
+	case width <= 0:
+		return fmt.Errorf(`bucket width %s is not positive`, width)
+	case width < day && day%width != 0:
+		return fmt.Errorf(`bucket width %s does not evenly divide a day`, width)
+	case width > day && width%day != 0:
+		return fmt.Errorf(`bucket width %s is not a whole number of days`, width)
+	default:
+		return nil
+	}
+}
+
+// sinceMidnight is how far at is past midnight on the wall clock.
+func sinceMidnight(local time.Time) time.Duration {
+	return time.Duration(local.Hour())*time.Hour + time.Duration(local.Minute())*time.Minute + time.Duration(local.Second())*time.Second + time.Duration(local.Nanosecond())
+}
+
+// atWallClock is the instant local's day reads wallClock past midnight, in
+// location.
+func atWallClock(local time.Time, wallClock time.Duration, location *time.Location) time.Time {
+	return time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, int(wallClock), location)
+}
+
+// BucketStart aligns at to the start of its bucket in location's wall clock
+// time, so hourly buckets start on local hours and daily buckets on local
+// midnight, even on days that are 23 or 25 hours long. An hour the clocks
+// repeat is a bucket of its own each time it is read.
+func BucketStart(at time.Time, width time.Duration, location *time.Location) time.Time {
+	local := at.In(location)
+	if width < day {
+		wallClock := sinceMidnight(local)
+		startWallClock := wallClock - wallClock%width
+
+		// Stepping back in absolute time keeps the offset at was read in,
+		// unless the clocks changed in between
+		start := local.Add(-(wallClock % width))
+		if start.Day() != local.Day() || sinceMidnight(start) != startWallClock {
+			start = atWallClock(local, startWallClock, location)
+		}
+		return start
+	}
+
+	days := int(width / day)
+	midnight := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, location)
+	civilDay := int(time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, time.UTC).Unix() / int64(day/time.Second))
+	return midnight.AddDate(0, 0, -(civilDay % days))
+}
+
+// NextBucketStart is where the bucket starting at start ends. Sub-day buckets
+// step in wall clock time, so the bucket the clocks spring forward through is
+// shorter and the one they fall back through ends on the next wall clock
+// boundary, which may be a repeat of one already passed.
+func NextBucketStart(start time.Time, width time.Duration, location *time.Location) time.Time {
+	local := start.In(location)
+	if width < day {
+		// The start of the bucket width later is the next boundary, unless
+		// the clocks fell back and brought it back to this one
+		if next := BucketStart(start.Add(width), width, location); next.After(start) {
+			return next
+		}
+		return atWallClock(local, sinceMidnight(local)+width, location)
+	}
+	return time.Date(local.Year(), local.Month(), local.Day()+int(width/day), 0, 0, 0, 0, location)
+}
@@ -0,0 +1,114 @@
+package statistics
+
+import (
+	"testing"
+	"time"
+	_ "time/tzdata"
+)
+
+func TestBucketsAcrossDaylightSaving(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Fall back: 01:30 happens twice on 2022-11-06, an hour apart
+	secondOneThirty := time.Date(2022, time.November, 6, 6, 30, 0, 0, time.UTC)
+	if start := BucketStart(secondOneThirty, time.Hour, newYork); !start.Equal(time.Date(2022, time.November, 6, 6, 0, 0, 0, time.UTC)) {
+		t.Errorf(`hourly bucket of the repeated 01:30 starts at %s`, start.UTC())
+	}
+	fallBackDay := BucketStart(secondOneThirty, 24*time.Hour, newYork)
+	if length := NextBucketStart(fallBackDay, 24*time.Hour, newYork).Sub(fallBackDay); length != 25*time.Hour {
+		t.Errorf(`fall-back day bucket lasts %s`, length)
+	}
+
+	// Spring forward: 02:00-03:00 does not exist on 2022-03-13
+	threeThirty := time.Date(2022, time.March, 13, 7, 30, 0, 0, time.UTC)
+	if start := BucketStart(threeThirty, time.Hour, newYork); start.In(newYork).Hour() != 3 || start.In(newYork).Minute() != 0 {
+		t.Errorf(`hourly bucket of 03:30 starts at local %s`, start.In(newYork))
+	}
+	springForwardDay := BucketStart(threeThirty, 24*time.Hour, newYork)
+	if length := NextBucketStart(springForwardDay, 24*time.Hour, newYork).Sub(springForwardDay); length != 23*time.Hour {
+		t.Errorf(`spring-forward day bucket lasts %s`, length)
+	}
+}
+
+// bucketsOf walks the buckets of width from local midnight of day to the next.
+func bucketsOf(t *testing.T, day time.Time, width time.Duration, location *time.Location) []time.Time {
+	end := time.Date(day.Year(), day.Month(), day.Day()+1, 0, 0, 0, 0, location)
+	starts := []time.Time{BucketStart(day, width, location)}
+	for start := starts[0]; ; {
+		next := NextBucketStart(start, width, location)
+		if !next.After(start) {
+			t.Fatalf(`%s bucket starting at %s ends at %s`, width, start, next)
+		}
+		if !next.Before(end) {
+			return starts
+		}
+		starts = append(starts, next)
+		start = next
+	}
+}
+
+func TestSubDayBucketsStepInWallClockTime(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, transition := range []struct {
+		name string
+		day  time.Time
+		// lengths are those of the first buckets of each width
+		lengths map[time.Duration][]time.Duration
+		count   map[time.Duration]int
+	}{
+		{"spring forward", time.Date(2022, time.March, 13, 0, 0, 0, 0, newYork),
+			map[time.Duration][]time.Duration{
+				time.Hour:        {time.Hour, time.Hour, time.Hour, time.Hour},
+				3 * time.Hour:    {2 * time.Hour, 3 * time.Hour},
+				6 * time.Hour:    {5 * time.Hour, 6 * time.Hour},
+				15 * time.Minute: {15 * time.Minute, 15 * time.Minute, 15 * time.Minute, 15 * time.Minute, 15 * time.Minute, 15 * time.Minute, 15 * time.Minute, 15 * time.Minute, 15 * time.Minute},
+			},
+			map[time.Duration]int{time.Hour: 23, 3 * time.Hour: 8, 6 * time.Hour: 4, 15 * time.Minute: 92},
+		},
+		{"fall back", time.Date(2022, time.November, 6, 0, 0, 0, 0, newYork),
+			map[time.Duration][]time.Duration{
+				time.Hour:     {time.Hour, time.Hour, time.Hour, time.Hour},
+				2 * time.Hour: {3 * time.Hour, 2 * time.Hour},
+				3 * time.Hour: {4 * time.Hour, 3 * time.Hour},
+				6 * time.Hour: {7 * time.Hour, 6 * time.Hour},
+			},
+			map[time.Duration]int{time.Hour: 25, 2 * time.Hour: 12, 3 * time.Hour: 8, 6 * time.Hour: 4},
+		},
+	} {
+		for width, lengths := range transition.lengths {
+			starts := bucketsOf(t, transition.day, width, newYork)
+			if len(starts) != transition.count[width] {
+				t.Errorf(`%s: %d buckets of %s, not %d`, transition.name, len(starts), width, transition.count[width])
+			}
+			for startIndex, start := range starts {
+				if wallClock := start.In(newYork); (time.Duration(wallClock.Hour())*time.Hour+time.Duration(wallClock.Minute())*time.Minute)%width != 0 {
+					t.Errorf(`%s: %s bucket starts at local %s`, transition.name, width, wallClock)
+				}
+				if startIndex < len(lengths) {
+					if length := NextBucketStart(start, width, newYork).Sub(start); length != lengths[startIndex] {
+						t.Errorf(`%s: %s bucket from local %s lasts %s, not %s`, transition.name, width, start.In(newYork), length, lengths[startIndex])
+					}
+				}
+			}
+
+			// Every minute of the day falls in the bucket walked to it
+			end := time.Date(transition.day.Year(), transition.day.Month(), transition.day.Day()+1, 0, 0, 0, 0, newYork)
+			startIndex := 0
+			for at := transition.day; at.Before(end); at = at.Add(time.Minute) {
+				if startIndex+1 < len(starts) && !at.Before(starts[startIndex+1]) {
+					startIndex++
+				}
+				if start := BucketStart(at, width, newYork); !start.Equal(starts[startIndex]) {
+					t.Fatalf(`%s: %s bucket of %s starts at %s, not %s`, transition.name, width, at, start, starts[startIndex])
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package statistics
+
+import "math"
+
+// NormalizedCrossCorrelation finds the lag, within maxLag positions either
+// way, at which right best matches the shape of left, regardless of offset
+// and scale. NaN values mark gaps and are left out of each comparison; lags
+// overlapping fewer than minimumOverlap values are not considered.
+func NormalizedCrossCorrelation(left []float64, right []float64, maxLag int, minimumOverlap int) (Statistic, int) {
+	best, bestLag := Undefined(ReasonNoData), 0
+	for lag := -maxLag; lag <= maxLag; lag++ {
+		var leftValues, rightValues []float64
+		for leftIndex := range left {
+			rightIndex := leftIndex + lag
+			if rightIndex < 0 || rightIndex >= len(right) || math.IsNaN(left[leftIndex]) || math.IsNaN(right[rightIndex]) {
+				continue
+			}
+			leftValues = append(leftValues, left[leftIndex])
+			rightValues = append(rightValues, right[rightIndex])
+		}
+		if len(leftValues) < minimumOverlap || len(leftValues) < 2 {
+			continue
+		}
+
+		correlation := pearson(leftValues, rightValues)
+		if correlation.Value != nil && (best.Value == nil || *correlation.Value > *best.Value) {
+			best, bestLag = correlation, lag
+		}
+	}
+	return best, bestLag
+}
+
+func pearson(left []float64, right []float64) Statistic {
+	var leftMean, rightMean float64
+	for index := range left {
+		leftMean += left[index]
+		rightMean += right[index]
+	}
+	leftMean /= float64(len(left))
+	rightMean /= float64(len(right))
+
+	var covariance, leftVariance, rightVariance float64
+	for index := range left {
+		leftDeviation, rightDeviation := left[index]-leftMean, right[index]-rightMean
+		covariance += leftDeviation * rightDeviation
+		leftVariance += leftDeviation * leftDeviation
+		rightVariance += rightDeviation * rightDeviation
+	}
+	return Divide(covariance, math.Sqrt(leftVariance*rightVariance))
+}
@@ -0,0 +1,35 @@
+package statistics
+
+import (
+	"math"
+	"time"
+)
+
+// Exposure integrates how far a series stays above threshold over time, e.g.
+// degree-hours above a temperature limit, measured in value·unit. Values are
+// treated as linear between samples, including where they cross threshold.
+func Exposure(times []time.Time, values []float64, threshold float64, unit time.Duration) (Statistic, time.Duration) {
+	if len(times) < 2 {
+		return Undefined(ReasonNoData), 0
+	}
+
+	var exposure float64
+	var durationAbove time.Duration
+	for index := 0; index < len(times)-1; index++ {
+		interval := times[index+1].Sub(times[index])
+		leftExcess := values[index] - threshold
+		rightExcess := values[index+1] - threshold
+
+		switch {
+		case leftExcess >= 0 && rightExcess >= 0:
+			exposure += 0.5 * (leftExcess + rightExcess) * float64(interval) / float64(unit)
+			durationAbove += interval
+		case leftExcess > 0 || rightExcess > 0:
+			excess := math.Max(leftExcess, rightExcess)
+			fractionAbove := excess / math.Abs(rightExcess-leftExcess)
+			exposure += 0.5 * excess * fractionAbove * float64(interval) / float64(unit)
+			durationAbove += time.Duration(fractionAbove * float64(interval))
+		}
+	}
+	return Of(exposure), durationAbove
+}
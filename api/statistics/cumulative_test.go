@@ -0,0 +1,28 @@
+package statistics
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestExposure(t *testing.T) {
+	// A temperature ramping by one degree a minute from 20 to 79
+	start := time.UnixMilli(1656633600000)
+	times, values := make([]time.Time, 0, 60), make([]float64, 0, 60)
+	for minute := 0; minute < 60; minute++ {
+		times = append(times, start.Add(time.Duration(minute)*time.Minute))
+		values = append(values, float64(20+minute))
+	}
+
+	exposure, durationAbove := Exposure(times, values, 69.5, time.Second)
+	if exposure.Value == nil {
+		t.Fatalf(`exposure is undefined: %s`, exposure.Reason)
+	}
+	if math.Abs(*exposure.Value-2707.5) > 1e-6 {
+		t.Errorf(`exposure: expected 2707.5, got %g`, *exposure.Value)
+	}
+	if durationAbove != 570*time.Second {
+		t.Errorf(`expected 570s above, got %s`, durationAbove)
+	}
+}
@@ -0,0 +1,50 @@
+// Package statistics holds the numeric building blocks shared by the
+// endpoints: null-safe statistics, exposure integrals, calendar bucketing
+// and correlation.
+package statistics
+
+import "math"
+
+const (
+	ReasonNoData         = "no_data"
+	ReasonDivisionByZero = "division_by_zero"
+	ReasonNotANumber     = "not_a_number"
+	ReasonInfinite       = "infinite"
+)
+
+// Statistic is a derived value that serializes as null, with a reason code,
+// whenever the computation that produced it was undefined.
+type Statistic struct {
+	Value  *float64 `json:"value"`
+	Reason string   `json:"reason,omitempty"`
+}
+
+func Of(value float64) Statistic {
+	switch {
+	case math.IsNaN(value):
+		return Statistic{Reason: ReasonNotANumber}
+	case math.IsInf(value, 0):
+		return Statistic{Reason: ReasonInfinite}
+	default:
+		return Statistic{Value: &value}
+	}
+}
+
+func Undefined(reason string) Statistic {
+	return Statistic{Reason: reason}
+}
+
+func Divide(numerator float64, denominator float64) Statistic {
+	if denominator == 0 {
+		return Statistic{Reason: ReasonDivisionByZero}
+	}
+	return Of(numerator / denominator)
+}
+
+func Finite(value float64) *float64 {
+	return Of(value).Value
+}
+
+func IsFinite(value float64) bool {
+	return !math.IsNaN(value) && !math.IsInf(value, 0)
+}
@@ -0,0 +1,312 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/config"
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/hardware"
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/stream"
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/internal/lifecycle"
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/internal/websocket"
+)
+
+type StreamedSample struct {
+	Time   time.Time           `json:"time"`
+	Values map[string]*float64 `json:"values"`
+}
+
+// StreamedEvent is an event as a WebSocket message carries it. Server-Sent
+// Events carry the same fields as their own.
+type StreamedEvent struct {
+	Event string      `json:"event"`
+	Id    string      `json:"id,omitempty"`
+	Data  interface{} `json:"data"`
+}
+
+// streamTransport carries the events of a stream to its subscriber.
+type streamTransport interface {
+	// event sends one event. The ID, when given, is what the subscriber
+	// resumes after when reconnecting.
+	event(name string, id string, data interface{}) error
+	// comment sends something that is not an event, to keep an idle
+	// connection open.
+	comment(text string) error
+}
+
+type serverSentEventTransport struct {
+	response http.ResponseWriter
+	flusher  http.Flusher
+}
+
+func (transport *serverSentEventTransport) event(name string, id string, data interface{}) error {
+	dataBytes, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	if id != "" {
+		if _, err := fmt.Fprintf(transport.response, "id: %s\n", id); err != nil {
+			return err
+		}
+	}
+	if _, err := fmt.Fprintf(transport.response, "event: %s\ndata: %s\n\n", name, dataBytes); err != nil {
+		return err
+	}
+	transport.flusher.Flush()
+	return nil
+}
+
+func (transport *serverSentEventTransport) comment(text string) error {
+	if _, err := fmt.Fprintf(transport.response, ": %s\n\n", text); err != nil {
+		return err
+	}
+	transport.flusher.Flush()
+	return nil
+}
+
+type webSocketTransport struct {
+	connection *websocket.Conn
+}
+
+func (transport *webSocketTransport) event(name string, id string, data interface{}) error {
+	eventBytes, err := json.Marshal(&StreamedEvent{Event: name, Id: id, Data: data})
+	if err != nil {
+		return err
+	}
+	return transport.connection.WriteText(eventBytes)
+}
+
+// comment pings, as WebSockets have no comments.
+func (transport *webSocketTransport) comment(text string) error {
+	return transport.connection.Ping()
+}
+
+type streamWriter struct {
+	transport streamTransport
+	filter    *stream.Filter
+	pending   []*StreamedSample
+
+	// sequence is the journal sequence of the latest sample added, whether
+	// the filter let it through or not.
+	sequence int64
+}
+
+func (writer *streamWriter) add(sample *hardware.Sample, sequence int64) {
+	if values := writer.filter.Apply(sample); values != nil {
+		writer.pending = append(writer.pending, &StreamedSample{Time: sample.Time, Values: values})
+	}
+	if sequence > writer.sequence {
+		writer.sequence = sequence
+	}
+}
+
+// emit sends the pending samples as one event, identified by the journal
+// sequence of the last of them, so that resuming after it also catches
+// samples backfilled before their time.
+func (writer *streamWriter) emit() error {
+	if len(writer.pending) == 0 {
+		return nil
+	}
+	if err := writer.transport.event("samples", strconv.FormatInt(writer.sequence, 10), writer.pending); err != nil {
+		return err
+	}
+	writer.pending = writer.pending[:0]
+	return nil
+}
+
+// handleHardwareStream pushes the samples ingested for a hardware as
+// Server-Sent Events, or as WebSocket messages to a request upgrading to
+// WebSockets, filtered like stream.ParseFilter describes and batched per emit
+// interval. A client reconnecting with Last-Event-ID, or with lastEventId in
+// the query, first receives the samples ingested since, whatever their time,
+// or a reset event when they can no longer be told.
+func handleHardwareStream(response http.ResponseWriter, request *http.Request, hardwareId string) {
+	if request.Method != "GET" {
+		response.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if !hardware.HasSamples(hardwareId) {
+		response.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	query := request.URL.Query()
+	filter, err := stream.ParseFilter(query)
+	if err != nil {
+		response.WriteHeader(http.StatusBadRequest)
+		response.Write([]byte(err.Error()))
+		return
+	}
+
+	emitInterval := config.Current.Streaming.EmitInterval.Duration
+	if interval := query.Get("interval"); interval != "" {
+		emitInterval, err = time.ParseDuration(interval)
+		if err != nil || emitInterval < 0 {
+			response.WriteHeader(http.StatusBadRequest)
+			response.Write([]byte(fmt.Sprintf(`invalid emit interval "%s"`, interval)))
+			return
+		}
+	}
+
+	var resumeSequence *int64
+	lastEventId := request.Header.Get("Last-Event-ID")
+	if lastEventId == "" {
+		lastEventId = query.Get("lastEventId")
+	}
+	if lastEventId != "" {
+		sequence, err := strconv.ParseInt(lastEventId, 10, 64)
+		if err != nil {
+			response.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		resumeSequence = &sequence
+	}
+
+	isWebSocket := websocket.IsUpgrade(request)
+	flusher, isFlusher := response.(http.Flusher)
+	if !isWebSocket && !isFlusher {
+		response.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	// Subscribed before catching up, so nothing ingested in between is missed
+	subscription := hardware.Subscribe(hardwareId, config.Current.Streaming.Buffer)
+	defer subscription.Close()
+
+	var transport streamTransport
+	var filters <-chan *stream.Filter
+	var disconnected <-chan struct{}
+	if isWebSocket {
+		connection, err := websocket.Upgrade(response, request)
+		if errors.Is(err, websocket.ErrHandshake) {
+			response.WriteHeader(http.StatusBadRequest)
+			response.Write([]byte(err.Error()))
+			return
+		} else if err != nil {
+			response.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		defer connection.Close()
+		stopped := make(chan struct{})
+		defer close(stopped)
+		transport = &webSocketTransport{connection: connection}
+		filters, disconnected = readStreamFilters(connection, stopped)
+	} else {
+		response.Header().Set("Content-Type", "text/event-stream")
+		response.Header().Set("Cache-Control", "no-cache")
+		response.Header().Set("X-Accel-Buffering", "no")
+		response.WriteHeader(http.StatusOK)
+		transport = &serverSentEventTransport{response: response, flusher: flusher}
+	}
+
+	writer := &streamWriter{transport: transport, filter: filter}
+	if err := transport.comment("subscribed"); err != nil {
+		return
+	}
+
+	// Samples caught up on may also be waiting in the subscription, and are
+	// told apart by their sequence rather than their time, as backfills are
+	// older than what was already sent
+	var skippedSequence int64
+	if resumeSequence != nil {
+		missedSamples, sequence, isResumable := hardware.ChangedSamplesSince(hardwareId, *resumeSequence)
+		skippedSequence = sequence
+		if !isResumable {
+			if err := transport.event("reset", strconv.FormatInt(sequence, 10), map[string]string{"reason": "the samples ingested since the last event are no longer known"}); err != nil {
+				return
+			}
+		}
+		for _, sample := range missedSamples {
+			writer.add(sample, sequence)
+		}
+		if err := writer.emit(); err != nil {
+			return
+		}
+	}
+
+	var emitTicks, keepAliveTicks <-chan time.Time
+	if emitInterval > 0 {
+		emitTicker := time.NewTicker(emitInterval)
+		defer emitTicker.Stop()
+		emitTicks = emitTicker.C
+	}
+	if keepAlive := config.Current.Streaming.KeepAlive.Duration; keepAlive > 0 {
+		keepAliveTicker := time.NewTicker(keepAlive)
+		defer keepAliveTicker.Stop()
+		keepAliveTicks = keepAliveTicker.C
+	}
+
+	var reportedDropped int64
+	for {
+		select {
+		case <-request.Context().Done():
+			return
+		case <-disconnected:
+			return
+		case <-lifecycle.Stopping():
+			writer.emit()
+			return
+		case filter := <-filters:
+			writer.filter = filter
+			continue
+		case sample := <-subscription.Samples:
+			if sample.Sequence <= skippedSequence {
+				continue
+			}
+			writer.add(sample.Sample, sample.Sequence)
+			if emitInterval > 0 {
+				continue
+			}
+		case <-emitTicks:
+		case <-keepAliveTicks:
+			if err := transport.comment("keepalive"); err != nil {
+				return
+			}
+			continue
+		}
+
+		if dropped := subscription.Dropped(); dropped > reportedDropped {
+			if err := transport.event("dropped", "", map[string]int64{"dropped": dropped}); err != nil {
+				return
+			}
+			reportedDropped = dropped
+		}
+		if err := writer.emit(); err != nil {
+			return
+		}
+	}
+}
+
+// readStreamFilters reads the filters a WebSocket subscriber sends to replace
+// its filter with. Messages that are not filters are answered with an error
+// event. The second channel is closed once the subscriber disconnects, and
+// reading stops once stopped is closed.
+func readStreamFilters(connection *websocket.Conn, stopped <-chan struct{}) (<-chan *stream.Filter, <-chan struct{}) {
+	filters := make(chan *stream.Filter)
+	disconnected := make(chan struct{})
+	go func() {
+		defer close(disconnected)
+		for {
+			message, err := connection.ReadMessage()
+			if err != nil {
+				return
+			}
+			filter, err := stream.DecodeFilter(message)
+			if err != nil {
+				eventBytes, _ := json.Marshal(&StreamedEvent{Event: "error", Data: map[string]string{"error": err.Error()}})
+				connection.WriteText(eventBytes)
+				continue
+			}
+			select {
+			case filters <- filter:
+			case <-stopped:
+				return
+			}
+		}
+	}()
+	return filters, disconnected
+}
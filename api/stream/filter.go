@@ -0,0 +1,116 @@
+// Package stream filters samples for streaming subscribers. Subscriptions are
+// Server-Sent Events, or WebSockets for clients that would rather: a filter
+// is given as the query of the stream request, and over a WebSocket may be
+// replaced by sending another as a message.
+package stream
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/hardware"
+)
+
+// Filter decides server-side which samples a subscriber receives, so clients
+// only pay for the channels and values they actually chart.
+type Filter struct {
+	Metrics []string `json:"metrics,omitempty"`
+	Above   *float64 `json:"above,omitempty"`
+	Below   *float64 `json:"below,omitempty"`
+	Every   int      `json:"every,omitempty"`
+
+	seen int
+}
+
+func ParseFilter(query url.Values) (*Filter, error) {
+	filter := &Filter{}
+
+	if metrics := query.Get("metrics"); metrics != "" {
+		for _, metric := range strings.Split(metrics, ",") {
+			if !hardware.IsMetric(metric) {
+				return nil, fmt.Errorf(`%w "%s"`, hardware.ErrUnknownMetric, metric)
+			}
+			filter.Metrics = append(filter.Metrics, metric)
+		}
+	}
+
+	if above := query.Get("above"); above != "" {
+		value, err := strconv.ParseFloat(above, 64)
+		if err != nil {
+			return nil, fmt.Errorf(`cannot convert threshold "%s": %w`, above, err)
+		}
+		filter.Above = &value
+	}
+
+	if below := query.Get("below"); below != "" {
+		value, err := strconv.ParseFloat(below, 64)
+		if err != nil {
+			return nil, fmt.Errorf(`cannot convert threshold "%s": %w`, below, err)
+		}
+		filter.Below = &value
+	}
+
+	if every := query.Get("every"); every != "" {
+		value, err := strconv.Atoi(every)
+		if err != nil || value < 1 {
+			return nil, fmt.Errorf(`invalid sample stride "%s"`, every)
+		}
+		filter.Every = value
+	}
+
+	return filter, nil
+}
+
+// DecodeFilter reads a filter sent as a JSON message, such as
+// {"metrics":["temperature"],"above":60}.
+func DecodeFilter(data []byte) (*Filter, error) {
+	filter := &Filter{}
+	if err := json.Unmarshal(data, filter); err != nil {
+		return nil, err
+	}
+	for _, metric := range filter.Metrics {
+		if !hardware.IsMetric(metric) {
+			return nil, fmt.Errorf(`%w "%s"`, hardware.ErrUnknownMetric, metric)
+		}
+	}
+	if filter.Every < 0 {
+		return nil, fmt.Errorf(`invalid sample stride %d`, filter.Every)
+	}
+	return filter, nil
+}
+
+// Apply returns the subset of the sample the subscriber asked for, or nil when
+// the sample should not be sent at all.
+func (filter *Filter) Apply(sample *hardware.Sample) map[string]*float64 {
+	filter.seen++
+	if filter.Every > 1 && (filter.seen-1)%filter.Every != 0 {
+		return nil
+	}
+
+	metrics := filter.Metrics
+	if len(metrics) == 0 {
+		metrics = hardware.Metrics()
+	}
+
+	filteredSample := make(map[string]*float64)
+	for _, metric := range metrics {
+		value, _ := sample.ValueByMetric(metric)
+		if value == nil {
+			continue
+		}
+		if filter.Above != nil && *value <= *filter.Above {
+			continue
+		}
+		if filter.Below != nil && *value >= *filter.Below {
+			continue
+		}
+		filteredSample[metric] = value
+	}
+	if len(filteredSample) == 0 {
+		return nil
+	}
+	return filteredSample
+}
@@ -0,0 +1,179 @@
+package api_test
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api"
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/hardware"
+)
+
+// readServerSentEvent reads events off a stream until one with a name,
+// skipping comments.
+func readServerSentEvent(t *testing.T, reader *bufio.Reader) *api.StreamedEvent {
+	event := &api.StreamedEvent{}
+	var data string
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+		switch {
+		case strings.HasPrefix(line, "id: "):
+			event.Id = strings.TrimSpace(strings.TrimPrefix(line, "id: "))
+		case strings.HasPrefix(line, "event: "):
+			event.Event = strings.TrimSpace(strings.TrimPrefix(line, "event: "))
+		case strings.HasPrefix(line, "data: "):
+			data = strings.TrimPrefix(line, "data: ")
+		case line == "\n" && event.Event != "":
+			var samples []*api.StreamedSample
+			json.Unmarshal([]byte(data), &samples)
+			event.Data = samples
+			return event
+		}
+	}
+}
+
+// readWebSocketEvent reads messages off a WebSocket until an event, skipping
+// pings.
+func readWebSocketEvent(t *testing.T, reader *bufio.Reader) (string, []*api.StreamedSample) {
+	for {
+		header := make([]byte, 2)
+		if _, err := io.ReadFull(reader, header); err != nil {
+			t.Fatal(err)
+		}
+		length := int(header[1])
+		if length == 126 {
+			extendedLength := make([]byte, 2)
+			if _, err := io.ReadFull(reader, extendedLength); err != nil {
+				t.Fatal(err)
+			}
+			length = int(binary.BigEndian.Uint16(extendedLength))
+		}
+		payload := make([]byte, length)
+		if _, err := io.ReadFull(reader, payload); err != nil {
+			t.Fatal(err)
+		}
+		if header[0]&0x0f != 0x1 {
+			continue
+		}
+
+		var event struct {
+			Event string          `json:"event"`
+			Id    string          `json:"id"`
+			Data  json.RawMessage `json:"data"`
+		}
+		if err := json.Unmarshal(payload, &event); err != nil {
+			t.Fatal(err)
+		}
+		var samples []*api.StreamedSample
+		json.Unmarshal(event.Data, &samples)
+		return event.Event, samples
+	}
+}
+
+// sendWebSocketText sends a text message the way clients do, masked.
+func sendWebSocketText(connection net.Conn, message string) {
+	mask := []byte{0x0f, 0x1e, 0x2d, 0x3c}
+	frame := append([]byte{0x81, 0x80 | byte(len(message))}, mask...)
+	for index := range message {
+		frame = append(frame, message[index]^mask[index%4])
+	}
+	connection.Write(frame)
+}
+
+func TestStreamResumesAfterBackfills(t *testing.T) {
+	if err := loadContractFixtures(); err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(http.HandlerFunc(api.Handle))
+	defer server.Close()
+	streamPath := "/api/hardware/contract_fan/stream?metrics=temperature&interval=0"
+	ingest := func(at time.Time, temperature float64) {
+		if err := hardware.AddSamples([]*hardware.Reading{{HardwareId: "contract_fan", Time: at, Values: map[string]float64{"temperature": temperature}}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expectSamples := func(how string, samples []*api.StreamedSample, times ...time.Time) {
+		if len(samples) != len(times) {
+			t.Fatalf(`%s: expected %d samples, got %d`, how, len(times), len(samples))
+		}
+		for sampleIndex, sample := range samples {
+			if !sample.Time.Equal(times[sampleIndex]) {
+				t.Errorf(`%s: expected sample %d at %s, got %s`, how, sampleIndex, times[sampleIndex], sample.Time)
+			}
+		}
+	}
+
+	response, err := http.Get(server.URL + streamPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reader := bufio.NewReader(response.Body)
+	if line, _ := reader.ReadString('\n'); line != ": subscribed\n" {
+		t.Fatalf(`expected the subscription confirmed, got %q`, line)
+	}
+	ingest(time.UnixMilli(1656637200000), 80)
+	event := readServerSentEvent(t, reader)
+	expectSamples("live", event.Data.([]*api.StreamedSample), time.UnixMilli(1656637200000))
+	response.Body.Close()
+
+	// Missed while disconnected: a sample backfilled before the last one sent,
+	// and a later one
+	ingest(time.UnixMilli(1656635430000), 50)
+	ingest(time.UnixMilli(1656637260000), 81)
+
+	request, _ := http.NewRequest("GET", server.URL+streamPath, nil)
+	request.Header.Set("Last-Event-ID", event.Id)
+	response, err = http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+	resumed := readServerSentEvent(t, bufio.NewReader(response.Body))
+	if resumed.Event != "samples" {
+		t.Fatalf(`expected the missed samples, got a %s event`, resumed.Event)
+	}
+	expectSamples("resumed", resumed.Data.([]*api.StreamedSample), time.UnixMilli(1656635430000), time.UnixMilli(1656637260000))
+
+	// The same over a WebSocket
+	connection, err := net.Dial("tcp", strings.TrimPrefix(server.URL, "http://"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer connection.Close()
+	connection.Write([]byte("GET " + streamPath + "&lastEventId=" + event.Id + " HTTP/1.1\r\nHost: example\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\nSec-WebSocket-Version: 13\r\n\r\n"))
+	webSocketReader := bufio.NewReader(connection)
+	handshake, err := http.ReadResponse(webSocketReader, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if handshake.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf(`expected the stream upgraded, got %d`, handshake.StatusCode)
+	}
+	name, samples := readWebSocketEvent(t, webSocketReader)
+	if name != "samples" {
+		t.Fatalf(`expected the missed samples, got a %s event`, name)
+	}
+	expectSamples("resumed over a WebSocket", samples, time.UnixMilli(1656635430000), time.UnixMilli(1656637260000))
+
+	// A filter sent replaces the one in the query. The error answering the
+	// message after it means it was taken.
+	sendWebSocketText(connection, `{"metrics":["temperature"],"above":90}`)
+	sendWebSocketText(connection, `{"metrics":["unknown"]}`)
+	if name, _ := readWebSocketEvent(t, webSocketReader); name != "error" {
+		t.Fatalf(`expected a filter of an unknown metric refused, got a %s event`, name)
+	}
+	ingest(time.UnixMilli(1656637320000), 82)
+	ingest(time.UnixMilli(1656637380000), 95)
+	_, samples = readWebSocketEvent(t, webSocketReader)
+	expectSamples("filtered over a WebSocket", samples, time.UnixMilli(1656637380000))
+}
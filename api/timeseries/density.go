@@ -0,0 +1,146 @@
+package timeseries
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+)
+
+var ErrUnknownDensity = errors.New("unknown tabulation density")
+
+const (
+	DensityUniform  = "uniform"
+	DensityAdaptive = "adaptive"
+)
+
+// uniformShare is the part of the points spread evenly whatever the series
+// do, so flat stretches still show up on charts.
+const uniformShare = 0.2
+
+// pointsPerCell is how many points a cell holds on average, enough for the
+// uniform share of a flat cell to round to a point.
+const pointsPerCell = 4
+
+// CheckDensity accepts the densities a tabulation can place its points by,
+// "" standing for uniform.
+func CheckDensity(density string) error {
+	switch density {
+	case "", DensityUniform, DensityAdaptive:
+		return nil
+	default:
+		return fmt.Errorf(`%w "%s"`, ErrUnknownDensity, density)
+	}
+}
+
+// AdaptiveTimes places count instants from from until to, more of them where
+// the series vary and fewer where they are flat. The window is cut into cells
+// of a few points each, weighed by how widely the points of every series
+// spread within them, as a standard deviation over that series' range in the
+// window, and the cells share the count by weight, evenly spaced within each.
+// The instants ascend, and are evenly spread when no series varies.
+func AdaptiveTimes(from int64, to int64, count int, series []Series) []int64 {
+	if count <= 0 || to <= from {
+		return nil
+	}
+	cellCount := (count + pointsPerCell - 1) / pointsPerCell
+	cellStart := func(cellIndex int) int64 {
+		return from + (to-from)*int64(cellIndex)/int64(cellCount)
+	}
+	cellOf := func(at int64) int {
+		cellIndex := int((at - from) * int64(cellCount) / (to - from))
+		if cellIndex >= cellCount {
+			cellIndex = cellCount - 1
+		}
+		return cellIndex
+	}
+
+	spreads := make([]float64, cellCount)
+	for _, channel := range series {
+		firstIndex := sort.Search(channel.Len(), func(index int) bool { return channel.Time(index) >= from })
+		lastIndex := sort.Search(channel.Len(), func(index int) bool { return channel.Time(index) >= to })
+		if lastIndex-firstIndex < 2 {
+			continue
+		}
+
+		minimum, maximum := math.Inf(1), math.Inf(-1)
+		for index := firstIndex; index < lastIndex; index++ {
+			value := channel.Value(index)
+			if math.IsNaN(value) || math.IsInf(value, 0) {
+				continue
+			}
+			minimum, maximum = math.Min(minimum, value), math.Max(maximum, value)
+		}
+		valueRange := maximum - minimum
+		if !(valueRange > 0) || math.IsInf(valueRange, 0) {
+			continue
+		}
+
+		counts, sums, squareSums := make([]float64, cellCount), make([]float64, cellCount), make([]float64, cellCount)
+		for index := firstIndex; index < lastIndex; index++ {
+			value := channel.Value(index)
+			if math.IsNaN(value) || math.IsInf(value, 0) {
+				continue
+			}
+			normalized := (value - minimum) / valueRange
+			cellIndex := cellOf(channel.Time(index))
+			counts[cellIndex]++
+			sums[cellIndex] += normalized
+			squareSums[cellIndex] += normalized * normalized
+		}
+		for cellIndex := range spreads {
+			if counts[cellIndex] < 2 {
+				continue
+			}
+			mean := sums[cellIndex] / counts[cellIndex]
+			spreads[cellIndex] += math.Sqrt(math.Max(0, squareSums[cellIndex]/counts[cellIndex]-mean*mean))
+		}
+	}
+
+	totalSpread := 0.0
+	for _, spread := range spreads {
+		totalSpread += spread
+	}
+
+	// Every cell gets the whole part of its share, then the cells with the
+	// largest remainders one more each until the count is placed
+	shares := make([]int, cellCount)
+	remainders := make([]float64, cellCount)
+	placed := 0
+	for cellIndex := range shares {
+		share := float64(count) / float64(cellCount)
+		if totalSpread > 0 {
+			share = float64(count) * (uniformShare/float64(cellCount) + (1-uniformShare)*spreads[cellIndex]/totalSpread)
+		}
+		shares[cellIndex] = int(share)
+		remainders[cellIndex] = share - float64(shares[cellIndex])
+		placed += shares[cellIndex]
+	}
+	order := make([]int, cellCount)
+	for cellIndex := range order {
+		order[cellIndex] = cellIndex
+	}
+	sort.SliceStable(order, func(left int, right int) bool {
+		return remainders[order[left]] > remainders[order[right]]
+	})
+	for _, cellIndex := range order {
+		if placed >= count {
+			break
+		}
+		shares[cellIndex]++
+		placed++
+	}
+
+	times := make([]int64, 0, count)
+	for cellIndex, share := range shares {
+		start, end := cellStart(cellIndex), cellStart(cellIndex+1)
+		for pointIndex := 0; pointIndex < share; pointIndex++ {
+			at := start + (end-start)*int64(pointIndex)/int64(share)
+			if len(times) > 0 && at <= times[len(times)-1] {
+				continue
+			}
+			times = append(times, at)
+		}
+	}
+	return times
+}
@@ -0,0 +1,47 @@
+package timeseries
+
+import "testing"
+
+func TestAdaptiveTimes(t *testing.T) {
+	// A channel flat for 50 s then bursting for 50 s, one point a second,
+	// alongside one flat throughout
+	bursty, flat := &Points{}, &Points{}
+	for second := int64(0); second < 100; second++ {
+		value := 1.0
+		if second >= 50 {
+			value = float64(second%2) * 4
+		}
+		bursty.Times, bursty.Values = append(bursty.Times, second*1000), append(bursty.Values, value)
+		flat.Times, flat.Values = append(flat.Times, second*1000), append(flat.Values, 1)
+	}
+
+	evenTimes := AdaptiveTimes(0, 100000, 20, []Series{flat})
+	if len(evenTimes) != 20 {
+		t.Fatalf(`flat series placed %d points, not 20`, len(evenTimes))
+	}
+	for index, at := range evenTimes {
+		if at != int64(index)*5000 {
+			t.Errorf(`flat series placed point %d at %d ms, not evenly`, index, at)
+		}
+	}
+
+	adaptiveTimes := AdaptiveTimes(0, 100000, 20, []Series{bursty, flat})
+	if len(adaptiveTimes) != 20 {
+		t.Fatalf(`bursty series placed %d points, not 20`, len(adaptiveTimes))
+	}
+	burstCount := 0
+	for index, at := range adaptiveTimes {
+		if at < 0 || at >= 100000 || (index > 0 && at <= adaptiveTimes[index-1]) {
+			t.Fatalf(`bursty series placed points out of order or outside the window: %v`, adaptiveTimes)
+		}
+		if at >= 50000 {
+			burstCount++
+		}
+	}
+	if burstCount < 15 {
+		t.Errorf(`only %d of 20 points fell in the burst`, burstCount)
+	}
+	if burstCount == 20 {
+		t.Errorf(`no points were left to the flat stretch`)
+	}
+}
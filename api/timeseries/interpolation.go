@@ -0,0 +1,119 @@
+package timeseries
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+)
+
+var ErrUnknownMethod = errors.New("unknown interpolation method")
+
+const (
+	MethodLinear  = "linear"
+	MethodNearest = "nearest"
+	MethodCubic   = "cubic"
+)
+
+// Interpolator estimates the value of a series between two of its points.
+type Interpolator interface {
+	// Neighbors is how many points past each side of the bracketing pair the
+	// interpolator looks at. Fewer are given near the ends of the series.
+	Neighbors() int
+
+	// Interpolate estimates the value at at. Times ascend, and at lies
+	// strictly between times[left] and times[left+1].
+	Interpolate(times []float64, values []float64, left int, at float64) float64
+}
+
+type linearInterpolator struct{}
+
+func (linearInterpolator) Neighbors() int {
+	return 0
+}
+
+func (linearInterpolator) Interpolate(times []float64, values []float64, left int, at float64) float64 {
+	weight := (at - times[left]) / (times[left+1] - times[left])
+	return values[left]*(1-weight) + values[left+1]*weight
+}
+
+type nearestInterpolator struct{}
+
+func (nearestInterpolator) Neighbors() int {
+	return 0
+}
+
+// Interpolate takes the closer point, the earlier one on a tie.
+func (nearestInterpolator) Interpolate(times []float64, values []float64, left int, at float64) float64 {
+	if at-times[left] <= times[left+1]-at {
+		return values[left]
+	}
+	return values[left+1]
+}
+
+// cubicInterpolator is a monotone cubic spline (Fritsch-Carlson): smooth
+// like a cubic spline, but never overshooting the bracketing points, so a
+// reading near a step does not ring past it.
+type cubicInterpolator struct{}
+
+func (cubicInterpolator) Neighbors() int {
+	return 1
+}
+
+func (cubicInterpolator) Interpolate(times []float64, values []float64, left int, at float64) float64 {
+	width := times[left+1] - times[left]
+	secant := (values[left+1] - values[left]) / width
+
+	leftTangent, rightTangent := secant, secant
+	if left > 0 {
+		leftTangent = monotoneTangent(times[left]-times[left-1], (values[left]-values[left-1])/(times[left]-times[left-1]), width, secant)
+	}
+	if left+2 < len(times) {
+		rightTangent = monotoneTangent(width, secant, times[left+2]-times[left+1], (values[left+2]-values[left+1])/(times[left+2]-times[left+1]))
+	}
+
+	position := (at - times[left]) / width
+	square, cube := position*position, position*position*position
+	return (2*cube-3*square+1)*values[left] +
+		(cube-2*square+position)*width*leftTangent +
+		(-2*cube+3*square)*values[left+1] +
+		(cube-square)*width*rightTangent
+}
+
+// monotoneTangent is the slope at a point between intervals of the given
+// widths and secant slopes: flat at a local extremum, otherwise their
+// weighted harmonic mean.
+func monotoneTangent(leftWidth float64, leftSecant float64, rightWidth float64, rightSecant float64) float64 {
+	if leftSecant*rightSecant <= 0 {
+		return 0
+	}
+	return 3 * (leftWidth + rightWidth) / ((2*rightWidth+leftWidth)/leftSecant + (rightWidth+2*leftWidth)/rightSecant)
+}
+
+var interpolators = map[string]Interpolator{
+	MethodLinear:  linearInterpolator{},
+	MethodNearest: nearestInterpolator{},
+	MethodCubic:   cubicInterpolator{},
+}
+
+// InterpolatorFor returns the interpolator of a method, linear when method is
+// empty.
+func InterpolatorFor(method string) (Interpolator, error) {
+	if method == "" {
+		method = MethodLinear
+	}
+	interpolator, hasInterpolator := interpolators[method]
+	if !hasInterpolator {
+		return nil, fmt.Errorf(`%w "%s"`, ErrUnknownMethod, method)
+	}
+	return interpolator, nil
+}
+
+// Methods lists the names InterpolatorFor accepts.
+func Methods() []string {
+	methods := make([]string, 0, len(interpolators))
+	for method := range interpolators {
+		methods = append(methods, method)
+	}
+	sort.Strings(methods)
+	return methods
+}
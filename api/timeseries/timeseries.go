@@ -0,0 +1,117 @@
+// Package timeseries estimates the values of a series of timed points
+// between them. It knows nothing of hardware or samples, so any channel that
+// can list its points in time order, stored or derived, interpolates alike.
+package timeseries
+
+import (
+	"math"
+	"sort"
+)
+
+// Series is a channel's points in ascending time order, times in Unix
+// milliseconds.
+type Series interface {
+	Len() int
+	Time(index int) int64
+	Value(index int) float64
+}
+
+// Points is a Series held in two slices of the same length.
+type Points struct {
+	Times  []int64
+	Values []float64
+}
+
+func (points *Points) Len() int {
+	return len(points.Times)
+}
+
+func (points *Points) Time(index int) int64 {
+	return points.Times[index]
+}
+
+func (points *Points) Value(index int) float64 {
+	return points.Values[index]
+}
+
+// Bracket is the pair of points either side of an instant, Left and Right
+// indexes that are equal when a point falls on the instant.
+type Bracket struct {
+	Left  int
+	Right int
+}
+
+func (bracket Bracket) IsExact() bool {
+	return bracket.Left == bracket.Right
+}
+
+// Locate brackets at among the points of series, returning false when at
+// lies before the first or after the last, and the steps the binary search
+// took.
+func Locate(series Series, at int64) (Bracket, int64, bool) {
+	var searchSteps int64
+	pointCount := series.Len()
+	right := sort.Search(pointCount, func(index int) bool {
+		searchSteps++
+		return series.Time(index) >= at
+	})
+	if right == pointCount {
+		return Bracket{}, searchSteps, false
+	}
+	left := right
+	if series.Time(right) > at {
+		if right == 0 {
+			return Bracket{}, searchSteps, false
+		}
+		left--
+	}
+	return Bracket{Left: left, Right: right}, searchSteps, true
+}
+
+// Interpolate estimates the value of series at at, which bracket locates,
+// with interpolator.
+func Interpolate(series Series, bracket Bracket, at int64, interpolator Interpolator) float64 {
+	if bracket.IsExact() {
+		return series.Value(bracket.Left)
+	}
+
+	neighbors := interpolator.Neighbors()
+	first := bracket.Left - neighbors
+	if first < 0 {
+		first = 0
+	}
+	last := bracket.Right + neighbors
+	if last >= series.Len() {
+		last = series.Len() - 1
+	}
+	// Times are relative to the left point, keeping float64 precise
+	leftTime := series.Time(bracket.Left)
+	times := make([]float64, 0, last-first+1)
+	values := make([]float64, 0, last-first+1)
+	for index := first; index <= last; index++ {
+		times = append(times, float64(series.Time(index)-leftTime))
+		values = append(values, series.Value(index))
+	}
+	return interpolator.Interpolate(times, values, bracket.Left-first, float64(at-leftTime))
+}
+
+// NominalInterval is the average time between the points of series, 0 with
+// fewer than two.
+func NominalInterval(series Series) float64 {
+	pointCount := series.Len()
+	if pointCount < 2 {
+		return 0
+	}
+	return float64(series.Time(pointCount-1)-series.Time(0)) / float64(pointCount-1)
+}
+
+// Confidence scores a value estimated within bracket as the ratio of the
+// nominal interval of series to the gap the bracket spans, capped at 1, so a
+// point on the instant or a gap of a usual width scores 1.
+func Confidence(series Series, bracket Bracket) float64 {
+	gap := series.Time(bracket.Right) - series.Time(bracket.Left)
+	if gap <= 0 || series.Len() < 2 {
+		return 1
+	}
+	return math.Min(1, NominalInterval(series)/float64(gap))
+}
@@ -0,0 +1,41 @@
+package timeseries
+
+import (
+	"math"
+	"testing"
+)
+
+func TestLocateAndInterpolate(t *testing.T) {
+	// Points 1 s apart but for a 4 s gap
+	series := &Points{Times: []int64{0, 1000, 2000, 6000, 7000}, Values: []float64{0, 1, 2, 6, 7}}
+	for _, outside := range []int64{-1, 7001} {
+		if bracket, _, isBracketed := Locate(series, outside); isBracketed {
+			t.Errorf(`%d ms was bracketed by %+v`, outside, bracket)
+		}
+	}
+	bracket, _, _ := Locate(series, 1000)
+	if !bracket.IsExact() || Confidence(series, bracket) != 1 {
+		t.Errorf(`1000 ms, on a point, was bracketed by %+v`, bracket)
+	}
+
+	bracket, _, _ = Locate(series, 4000)
+	if bracket.Left != 2 || bracket.Right != 3 {
+		t.Fatalf(`4000 ms was bracketed by %+v`, bracket)
+	}
+	for _, method := range Methods() {
+		interpolator, err := InterpolatorFor(method)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := 4.0
+		if method == MethodNearest {
+			expected = 2
+		}
+		if value := Interpolate(series, bracket, 4000, interpolator); math.Abs(value-expected) > 1e-6 {
+			t.Errorf(`%s value at 4000 ms: expected %g, got %g`, method, expected, value)
+		}
+	}
+	if confidence := Confidence(series, bracket); math.Abs(confidence-1750.0/4000) > 1e-6 {
+		t.Errorf(`confidence across the gap: expected %g, got %g`, 1750.0/4000, confidence)
+	}
+}
@@ -0,0 +1,70 @@
+// Package units converts metric values between the units sensors report in
+// and the units samples are held in.
+package units
+
+import (
+	"fmt"
+	"sort"
+)
+
+const (
+	QuantityTemperature  = "temperature"
+	QuantityVelocity     = "velocity"
+	QuantityAcceleration = "acceleration"
+)
+
+// Unit converts to the base unit of its quantity as value*scale + offset.
+type Unit struct {
+	Name     string `json:"name"`
+	Symbol   string `json:"symbol"`
+	Quantity string `json:"quantity"`
+	scale    float64
+	offset   float64
+}
+
+// Names double as the suffixes sample files may carry, as in
+// temperature_f.csv.
+var known = map[string]Unit{
+	"c":   {Name: "c", Symbol: "°C", Quantity: QuantityTemperature, scale: 1},
+	"f":   {Name: "f", Symbol: "°F", Quantity: QuantityTemperature, scale: 5.0 / 9.0, offset: -32 * 5.0 / 9.0},
+	"k":   {Name: "k", Symbol: "K", Quantity: QuantityTemperature, scale: 1, offset: -273.15},
+	"mms": {Name: "mms", Symbol: "mm/s", Quantity: QuantityVelocity, scale: 1},
+	"ms":  {Name: "ms", Symbol: "m/s", Quantity: QuantityVelocity, scale: 1000},
+	"ins": {Name: "ins", Symbol: "in/s", Quantity: QuantityVelocity, scale: 25.4},
+	"g":   {Name: "g", Symbol: "g", Quantity: QuantityAcceleration, scale: 1},
+	"mss": {Name: "mss", Symbol: "m/s²", Quantity: QuantityAcceleration, scale: 1 / 9.80665},
+}
+
+func Lookup(name string) (Unit, bool) {
+	unit, isKnown := known[name]
+	return unit, isKnown
+}
+
+// Names lists every known unit.
+func Names() []string {
+	names := make([]string, 0, len(known))
+	for name := range known {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Converter returns a function converting values from one unit to another
+// of the same quantity.
+func Converter(from string, to string) (func(float64) float64, error) {
+	fromUnit, fromKnown := known[from]
+	if !fromKnown {
+		return nil, fmt.Errorf(`unknown unit "%s"`, from)
+	}
+	toUnit, toKnown := known[to]
+	if !toKnown {
+		return nil, fmt.Errorf(`unknown unit "%s"`, to)
+	}
+	if fromUnit.Quantity != toUnit.Quantity {
+		return nil, fmt.Errorf(`cannot convert %s from %s to %s`, fromUnit.Quantity, fromUnit.Symbol, toUnit.Symbol)
+	}
+	return func(value float64) float64 {
+		return (value*fromUnit.scale + fromUnit.offset - toUnit.offset) / toUnit.scale
+	}, nil
+}
@@ -0,0 +1,34 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/internal/usage"
+)
+
+type UsageResponseData struct {
+	usage.Usage
+	DailyRequestQuota int64 `json:"dailyRequestQuota,omitempty"`
+	DailyByteQuota    int64 `json:"dailyByteQuota,omitempty"`
+}
+
+func handleUsage(response http.ResponseWriter, request *http.Request) {
+	if request.Method != "GET" {
+		response.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	responseBytes, err := json.Marshal(UsageResponseData{
+		Usage:             usage.Lookup(usage.ClientOf(request)),
+		DailyRequestQuota: usage.DailyRequestQuota,
+		DailyByteQuota:    usage.DailyByteQuota,
+	})
+	if err != nil {
+		response.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	response.WriteHeader(http.StatusOK)
+	response.Write(responseBytes)
+}
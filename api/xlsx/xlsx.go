@@ -0,0 +1,268 @@
+// Package xlsx reads the cell values of Office Open XML workbooks, the .xlsx
+// files Excel saves, as text: just enough to import the tables plant
+// engineers keep in them. Formulas are read as their cached results, and
+// numbers, dates included, as Excel stores them.
+package xlsx
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+)
+
+var ErrNotWorkbook = errors.New(`not an XLSX workbook`)
+
+// Worksheets hold at most this many columns, so references past them are
+// refused rather than allocated for.
+const maxColumns = 1 << 14
+
+// Limits bound what reading a workbook may take: no part may inflate past
+// MaxPartBytes, and no worksheet may hold more than MaxRows rows, counted as
+// they are decoded and by the row numbers they claim alike.
+type Limits struct {
+	MaxPartBytes int64
+	MaxRows      int
+}
+
+// Sheet holds the rows of one worksheet, each as long as its last cell with
+// a value. Rows without any are left empty, so a row's index is its number
+// less one.
+type Sheet struct {
+	Name string
+	Rows [][]string
+}
+
+type Workbook struct {
+	// Date1904 tells that date serial numbers count days from 1904-01-01
+	// rather than from 1899-12-30.
+	Date1904 bool
+	Sheets   []*Sheet
+}
+
+type workbookPart struct {
+	Properties struct {
+		Date1904 string `xml:"date1904,attr"`
+	} `xml:"workbookPr"`
+	Sheets []struct {
+		Name           string `xml:"name,attr"`
+		RelationshipId string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+	} `xml:"sheets>sheet"`
+}
+
+type relationshipsPart struct {
+	Relationships []struct {
+		Id     string `xml:"Id,attr"`
+		Target string `xml:"Target,attr"`
+	} `xml:"Relationship"`
+}
+
+// richText is a string item or inline string, either plain or in runs.
+type richText struct {
+	Text string `xml:"t"`
+	Runs []struct {
+		Text string `xml:"t"`
+	} `xml:"r"`
+}
+
+func (text *richText) String() string {
+	if len(text.Runs) == 0 {
+		return text.Text
+	}
+	var builder strings.Builder
+	for _, run := range text.Runs {
+		builder.WriteString(run.Text)
+	}
+	return builder.String()
+}
+
+type sharedStringsPart struct {
+	Items []richText `xml:"si"`
+}
+
+type worksheetRow struct {
+	Number int `xml:"r,attr"`
+	Cells  []struct {
+		Reference string   `xml:"r,attr"`
+		Type      string   `xml:"t,attr"`
+		Value     string   `xml:"v"`
+		Inline    richText `xml:"is"`
+	} `xml:"c"`
+}
+
+// openPart opens a part of the archive, refusing one whose declared size is
+// past maxBytes and reading no further than that should the declaration lie.
+func openPart(archive *zip.Reader, name string, maxBytes int64) (io.Reader, func() error, error) {
+	file, err := archive.Open(name)
+	if err != nil {
+		return nil, nil, fmt.Errorf(`%w: missing %s`, ErrNotWorkbook, name)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, nil, fmt.Errorf(`unable to read %s: %w`, name, err)
+	}
+	if info.Size() > maxBytes {
+		file.Close()
+		return nil, nil, fmt.Errorf(`%s inflates to %d bytes, over the maximum of %d`, name, info.Size(), maxBytes)
+	}
+	return io.LimitReader(file, maxBytes), file.Close, nil
+}
+
+func decodePart(archive *zip.Reader, name string, part interface{}, limits Limits) error {
+	reader, closePart, err := openPart(archive, name, limits.MaxPartBytes)
+	if err != nil {
+		return err
+	}
+	defer closePart()
+	if err := xml.NewDecoder(reader).Decode(part); err != nil {
+		return fmt.Errorf(`unable to parse %s: %w`, name, err)
+	}
+	return nil
+}
+
+// decodeRows decodes the rows of a worksheet one at a time, so a sheet with
+// too many is refused before they are all held.
+func decodeRows(archive *zip.Reader, name string, limits Limits) ([]*worksheetRow, error) {
+	reader, closePart, err := openPart(archive, name, limits.MaxPartBytes)
+	if err != nil {
+		return nil, err
+	}
+	defer closePart()
+
+	decoder := xml.NewDecoder(reader)
+	rows := make([]*worksheetRow, 0)
+	for {
+		token, err := decoder.Token()
+		if errors.Is(err, io.EOF) {
+			return rows, nil
+		} else if err != nil {
+			return nil, fmt.Errorf(`unable to parse %s: %w`, name, err)
+		}
+		start, isStart := token.(xml.StartElement)
+		if !isStart || start.Name.Local != "row" {
+			continue
+		}
+		if len(rows) >= limits.MaxRows {
+			return nil, fmt.Errorf(`%s holds more than the maximum of %d rows`, name, limits.MaxRows)
+		}
+		row := &worksheetRow{}
+		if err := decoder.DecodeElement(row, &start); err != nil {
+			return nil, fmt.Errorf(`unable to parse %s: %w`, name, err)
+		}
+		rows = append(rows, row)
+	}
+}
+
+// columnIndex turns the column letters of a cell reference such as "AB12"
+// into a zero-based index.
+func columnIndex(reference string) (int, bool) {
+	index, letters := 0, 0
+	for _, character := range reference {
+		if character < 'A' || character > 'Z' || letters == 3 {
+			break
+		}
+		index = index*26 + int(character-'A') + 1
+		letters++
+	}
+	return index - 1, letters > 0
+}
+
+// Read reads every worksheet of a workbook, in the order its tabs are in,
+// within limits.
+func Read(reader io.ReaderAt, size int64, limits Limits) (*Workbook, error) {
+	archive, err := zip.NewReader(reader, size)
+	if err != nil {
+		return nil, fmt.Errorf(`%w: %v`, ErrNotWorkbook, err)
+	}
+
+	var workbook workbookPart
+	if err := decodePart(archive, "xl/workbook.xml", &workbook, limits); err != nil {
+		return nil, err
+	}
+	var relationships relationshipsPart
+	if err := decodePart(archive, "xl/_rels/workbook.xml.rels", &relationships, limits); err != nil {
+		return nil, err
+	}
+	targets := make(map[string]string, len(relationships.Relationships))
+	for _, relationship := range relationships.Relationships {
+		if strings.HasPrefix(relationship.Target, "/") {
+			targets[relationship.Id] = strings.TrimPrefix(relationship.Target, "/")
+		} else {
+			targets[relationship.Id] = path.Join("xl", relationship.Target)
+		}
+	}
+
+	// Workbooks without any text cells have no shared strings
+	var sharedStrings sharedStringsPart
+	if file, err := archive.Open("xl/sharedStrings.xml"); err == nil {
+		file.Close()
+		if err := decodePart(archive, "xl/sharedStrings.xml", &sharedStrings, limits); err != nil {
+			return nil, err
+		}
+	}
+
+	date1904, _ := strconv.ParseBool(workbook.Properties.Date1904)
+	readWorkbook := &Workbook{Date1904: date1904, Sheets: make([]*Sheet, 0, len(workbook.Sheets))}
+	for _, sheetEntry := range workbook.Sheets {
+		target, hasTarget := targets[sheetEntry.RelationshipId]
+		if !hasTarget {
+			return nil, fmt.Errorf(`%w: sheet "%s" has no part`, ErrNotWorkbook, sheetEntry.Name)
+		}
+		rows, err := decodeRows(archive, target, limits)
+		if err != nil {
+			return nil, err
+		}
+
+		sheet := &Sheet{Name: sheetEntry.Name, Rows: make([][]string, 0, len(rows))}
+		for rowPosition, row := range rows {
+			rowIndex := rowPosition
+			if row.Number > 0 {
+				rowIndex = row.Number - 1
+			}
+			if rowIndex >= limits.MaxRows {
+				return nil, fmt.Errorf(`sheet "%s": row %d is past the maximum of %d rows`, sheet.Name, rowIndex+1, limits.MaxRows)
+			}
+			for len(sheet.Rows) <= rowIndex {
+				sheet.Rows = append(sheet.Rows, nil)
+			}
+
+			cells := make([]string, 0, len(row.Cells))
+			for cellPosition, cell := range row.Cells {
+				cellIndex, hasIndex := columnIndex(cell.Reference)
+				if !hasIndex {
+					cellIndex = cellPosition
+				}
+
+				value := cell.Value
+				switch cell.Type {
+				case "s":
+					itemIndex, err := strconv.Atoi(value)
+					if err != nil || itemIndex < 0 || itemIndex >= len(sharedStrings.Items) {
+						return nil, fmt.Errorf(`sheet "%s" cell %s: no shared string %s`, sheet.Name, cell.Reference, value)
+					}
+					value = sharedStrings.Items[itemIndex].String()
+				case "inlineStr":
+					value = cell.Inline.String()
+				}
+				if value == "" {
+					continue
+				}
+				if cellIndex >= maxColumns {
+					return nil, fmt.Errorf(`sheet "%s" cell %s: past the last column`, sheet.Name, cell.Reference)
+				}
+				for len(cells) <= cellIndex {
+					cells = append(cells, "")
+				}
+				cells[cellIndex] = value
+			}
+			sheet.Rows[rowIndex] = cells
+		}
+		readWorkbook.Sheets = append(readWorkbook.Sheets, sheet)
+	}
+	return readWorkbook, nil
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+func fail(err error) {
+	fmt.Fprintf(os.Stderr, "%v\n", err)
+	os.Exit(1)
+}
+
+func main() {
+	server := flag.String("server", "http://localhost:8080", "base URL of the server holding the rules")
+	key := flag.String("key", os.Getenv("KCF_API_KEY"), "API key of an admin client")
+	timeout := flag.Duration("timeout", 30*time.Second, "how long to wait for the server")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [flags] export [rules.yaml]\n       %s [flags] import <rules.yaml>\n", os.Args[0], os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	rulesURL := strings.TrimRight(*server, "/") + "/api/alerts/rules.yaml"
+	var request *http.Request
+	var err error
+	switch {
+	case flag.NArg() >= 1 && flag.NArg() <= 2 && flag.Arg(0) == "export":
+		request, err = http.NewRequest("GET", rulesURL, nil)
+	case flag.NArg() == 2 && flag.Arg(0) == "import":
+		rulesFile, openErr := os.Open(flag.Arg(1))
+		if openErr != nil {
+			fail(openErr)
+		}
+		defer rulesFile.Close()
+		request, err = http.NewRequest("PUT", rulesURL, rulesFile)
+		if err == nil {
+			request.Header.Set("Content-Type", "application/yaml")
+		}
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		fail(err)
+	}
+	if *key != "" {
+		request.Header.Set("X-API-Key", *key)
+	}
+
+	response, err := (&http.Client{Timeout: *timeout}).Do(request)
+	if err != nil {
+		fail(err)
+	}
+	defer response.Body.Close()
+	responseBytes, err := io.ReadAll(response.Body)
+	if err != nil {
+		fail(err)
+	}
+
+	if flag.Arg(0) == "import" {
+		if response.StatusCode != http.StatusNoContent {
+			fail(fmt.Errorf("%s:\n%s", response.Status, responseBytes))
+		}
+		fmt.Printf("imported the rules of %s\n", flag.Arg(1))
+		return
+	}
+	if response.StatusCode != http.StatusOK {
+		fail(fmt.Errorf("%s:\n%s", response.Status, responseBytes))
+	}
+	// Without a file the rules go to standard output, to pipe elsewhere
+	if flag.NArg() == 1 {
+		os.Stdout.Write(responseBytes)
+		return
+	}
+	if err := os.WriteFile(flag.Arg(1), responseBytes, 0644); err != nil {
+		fail(err)
+	}
+}
@@ -0,0 +1,20 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/hardware"
+)
+
+func main() {
+	destinationPath := flag.String("out", "anonymized_samples", "directory to write the anonymized sample tree into")
+	key := flag.String("key", os.Getenv("KCF_ANONYMIZATION_KEY"), "secret key the renaming, time shift and scaling are derived from")
+	flag.Parse()
+
+	if err := hardware.AnonymizeSamples(*destinationPath, *key); err != nil {
+		fmt.Fprintf(os.Stderr, "unable to anonymize samples: %v\n", err)
+		os.Exit(1)
+	}
+}
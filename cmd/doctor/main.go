@@ -0,0 +1,372 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/alerts"
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/config"
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/hardware"
+)
+
+const dialTimeout = 3 * time.Second
+
+const (
+	statusOK   = "ok"
+	statusWarn = "WARN"
+	statusFail = "FAIL"
+)
+
+// finding is what a check found, with how to put it right when it is not ok.
+type finding struct {
+	status string
+	detail string
+	fix    string
+}
+
+func ok(format string, arguments ...interface{}) finding {
+	return finding{status: statusOK, detail: fmt.Sprintf(format, arguments...)}
+}
+
+func warn(fix string, format string, arguments ...interface{}) finding {
+	return finding{status: statusWarn, detail: fmt.Sprintf(format, arguments...), fix: fix}
+}
+
+func fail(fix string, format string, arguments ...interface{}) finding {
+	return finding{status: statusFail, detail: fmt.Sprintf(format, arguments...), fix: fix}
+}
+
+type check struct {
+	name string
+	run  func() []finding
+}
+
+var (
+	configPath  = flag.String("config", "", "JSON config file the server is started with; defaults apply when empty")
+	samplesPath = flag.String("samples", "api/hardware/samples", "directory holding one sample directory per hardware")
+	staticPath  = flag.String("static", ".", "directory the dashboard pages are served from")
+	address     = flag.String("addr", ":8080", "address the server is to listen on")
+)
+
+// failedChecks are the checks that failed so far, by name.
+var failedChecks map[string]bool = make(map[string]bool)
+
+// checks run in order; those after the config inspect what it configures,
+// the defaults when it cannot be loaded.
+var checks = []check{
+	{"config", checkConfig},
+	{"sample tree", checkSampleTree},
+	{"sample log", checkSampleLog},
+	{"samples", checkSamples},
+	{"port", checkPort},
+	{"dashboard pages", checkStatic},
+	{"writable files", checkWritableFiles},
+	{"alert notifiers", checkAlertNotifiers},
+	{"remote services", checkRemoteServices},
+}
+
+func checkConfig() []finding {
+	if *configPath == "" {
+		return []finding{ok("no config file given, the defaults apply")}
+	}
+	err := config.Load(*configPath)
+	switch {
+	case err == nil:
+		return []finding{ok("%s is valid", *configPath)}
+	case errors.Is(err, os.ErrNotExist):
+		return []finding{fail("pass the config file the server is started with to -config, or leave it out for the defaults", "%v", err)}
+	case errors.Is(err, os.ErrPermission):
+		return []finding{fail(fmt.Sprintf("let this user read it, e.g. chmod a+r %s", *configPath), "%v", err)}
+	default:
+		return []finding{fail("correct the fields named above; unknown fields are refused, so check their spelling against api/config/config.go", "%v", err)}
+	}
+}
+
+func checkSampleTree() []finding {
+	if config.Current.Storage.IsPersistent() {
+		return []finding{ok("samples are stored at storage.path, the sample tree only holds side files")}
+	}
+	info, err := os.Stat(*samplesPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return []finding{fail("pass the directory holding one directory per hardware to -samples, e.g. api/hardware/samples", "%s does not exist", *samplesPath)}
+	} else if err != nil {
+		return []finding{fail(fmt.Sprintf("let this user read it, e.g. chmod -R a+rX %s", *samplesPath), "%v", err)}
+	} else if !info.IsDir() {
+		return []finding{fail("-samples takes the directory holding one directory per hardware, not a file", "%s is not a directory", *samplesPath)}
+	}
+
+	entries, err := os.ReadDir(*samplesPath)
+	if err != nil {
+		return []finding{fail(fmt.Sprintf("let this user read it, e.g. chmod -R a+rX %s", *samplesPath), "%v", err)}
+	}
+	findings := make([]finding, 0)
+	hardwareCount, unreadable := 0, make([]string, 0)
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		hardwareCount++
+		hardwarePath := filepath.Join(*samplesPath, entry.Name())
+		files, err := os.ReadDir(hardwarePath)
+		if err != nil {
+			unreadable = append(unreadable, hardwarePath)
+			continue
+		}
+		for _, file := range files {
+			if file.IsDir() {
+				continue
+			}
+			opened, err := os.Open(filepath.Join(hardwarePath, file.Name()))
+			if err != nil {
+				unreadable = append(unreadable, filepath.Join(hardwarePath, file.Name()))
+				continue
+			}
+			opened.Close()
+		}
+	}
+	switch {
+	case len(unreadable) > 0:
+		findings = append(findings, fail(fmt.Sprintf("let this user read them, e.g. chmod -R a+rX %s", *samplesPath), "%d unreadable, the first %s", len(unreadable), unreadable[0]))
+	case hardwareCount == 0:
+		findings = append(findings, warn("add a directory per hardware holding its sample files, or ingest readings once the server runs", "%s holds no hardware directories", *samplesPath))
+	default:
+		findings = append(findings, ok("%s holds %d hardware directories, all readable", *samplesPath, hardwareCount))
+	}
+
+	if config.Current.Ingestion.Persist {
+		if err := probeWritable(*samplesPath); err != nil {
+			findings = append(findings, fail(fmt.Sprintf("let this user write to it, e.g. chmod -R u+w %s, or turn off ingestion.persist", *samplesPath), "ingested readings are persisted, but %v", err))
+		}
+	}
+	return findings
+}
+
+func checkSampleLog() []finding {
+	storage := config.Current.Storage
+	if !storage.IsPersistent() {
+		return []finding{ok("no sample log or database configured, samples are held in memory")}
+	}
+	kind := "sample log"
+	if storage.Backend == config.StorageSQLite {
+		kind = "sample database"
+	}
+
+	info, err := os.Stat(storage.Path)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		if err := probeWritable(filepath.Dir(storage.Path)); err != nil {
+			return []finding{fail(fmt.Sprintf("create %s and let this user write to it, or correct storage.path", filepath.Dir(storage.Path)), "the %s does not exist yet, and %v", kind, err)}
+		}
+		return []finding{ok("%s does not exist yet, it is created and seeded from the sample tree on start", storage.Path)}
+	case err != nil:
+		return []finding{fail(fmt.Sprintf("let this user read and write it, e.g. chmod u+rw %s", storage.Path), "%v", err)}
+	case info.IsDir():
+		return []finding{fail(fmt.Sprintf("storage.path takes the %s file, not a directory", kind), "%s is a directory", storage.Path)}
+	}
+	opened, err := os.OpenFile(storage.Path, os.O_RDWR|os.O_APPEND, 0)
+	if err != nil {
+		return []finding{fail(fmt.Sprintf("let this user read and write it, e.g. chmod u+rw %s", storage.Path), "%v", err)}
+	}
+	opened.Close()
+	return []finding{ok("%s is readable and writable, %d bytes", storage.Path, info.Size())}
+}
+
+// checkSamples loads the samples as the server would, which reads every side
+// file kept with them and checks the registry version they were stored
+// under.
+func checkSamples() []finding {
+	if failedChecks["sample tree"] || failedChecks["sample log"] {
+		return []finding{warn("fix the failures above first", "not loaded")}
+	}
+	store, err := hardware.OpenStore()
+	if err != nil {
+		return []finding{fail("fix the sample log first", "%v", err)}
+	}
+	if err := hardware.UseStore(store); err != nil {
+		return []finding{fail("fix the sample log first", "%v", err)}
+	}
+	defer hardware.Close()
+	if err := hardware.PopulateSamplesFrom(*samplesPath); err != nil {
+		return []finding{fail("repair or move aside the file named above; the server refuses to start until it loads", "%v", err)}
+	}
+
+	findings := []finding{ok("%d hardware, %d samples loaded", len(hardware.ListHardware()), hardware.SampleCount())}
+	for _, description := range hardware.ListHardware() {
+		unavailableMetrics := hardware.UnavailableMetrics(description.Id)
+		metrics := make([]string, 0, len(unavailableMetrics))
+		for metric := range unavailableMetrics {
+			metrics = append(metrics, metric)
+		}
+		sort.Strings(metrics)
+		for _, metric := range metrics {
+			findings = append(findings, warn("fix or remove the sample file; the rest of the hardware is served", "%s of %s is unavailable: %s", metric, description.Id, unavailableMetrics[metric]))
+		}
+	}
+	return findings
+}
+
+func checkPort() []finding {
+	listener, err := net.Listen("tcp", *address)
+	switch {
+	case err == nil:
+		listener.Close()
+		return []finding{ok("%s is free", *address)}
+	case errors.Is(err, syscall.EADDRINUSE):
+		return []finding{fail("stop whatever listens there, e.g. an earlier server, or pass another -addr", "%s is already in use", *address)}
+	case errors.Is(err, syscall.EACCES):
+		return []finding{fail("listen on a port above 1023, e.g. -addr :8080, or grant the binary CAP_NET_BIND_SERVICE", "not allowed to listen on %s", *address)}
+	default:
+		return []finding{fail("pass -addr as host:port or :port", "unable to listen on %s: %v", *address, err)}
+	}
+}
+
+func checkStatic() []finding {
+	if _, err := os.Stat(filepath.Join(*staticPath, "index.html")); err != nil {
+		return []finding{fail("run from the repository root, or pass the directory holding index.html to -static", "%s holds no index.html", *staticPath)}
+	}
+	return []finding{ok("served from %s", *staticPath)}
+}
+
+// probeWritable creates and removes a file in a directory.
+func probeWritable(directory string) error {
+	probe, err := os.CreateTemp(directory, ".doctor-*")
+	if err != nil {
+		return fmt.Errorf(`unable to write to %s: %w`, directory, err)
+	}
+	probe.Close()
+	return os.Remove(probe.Name())
+}
+
+func checkWritableFiles() []finding {
+	paths := map[string]string{
+		"accessLog.path":   config.Current.AccessLog.Path,
+		"queryLog.path":    config.Current.QueryLog.Path,
+		"audit.path":       config.Current.Audit.Path,
+		"preferences.path": config.Current.Preferences.Path,
+	}
+	findings := make([]finding, 0)
+	for _, field := range []string{"accessLog.path", "queryLog.path", "audit.path", "preferences.path"} {
+		if paths[field] == "" {
+			continue
+		}
+		directory := filepath.Dir(paths[field])
+		if err := probeWritable(directory); err != nil {
+			findings = append(findings, fail(fmt.Sprintf("create %s and let this user write to it, or point %s elsewhere", directory, field), "%s: %v", field, err))
+		}
+	}
+	if len(findings) == 0 {
+		findings = append(findings, ok("the logs, audit and preferences can be written"))
+	}
+	return findings
+}
+
+// checkAlertNotifiers builds the configured notifiers as the server would,
+// which would otherwise only log those it leaves out once it runs.
+func checkAlertNotifiers() []finding {
+	settings := config.Current.Alerting
+	if len(settings.Webhooks)+len(settings.Notifiers) == 0 {
+		return []finding{ok("none configured")}
+	}
+	findings := make([]finding, 0)
+	for _, problem := range alerts.CheckNotifiers(settings) {
+		findings = append(findings, fail(fmt.Sprintf("use one of the kinds %s with the settings it needs", strings.Join(alerts.NotifierKinds(), ", ")), "%v", problem))
+	}
+	if len(findings) == 0 {
+		findings = append(findings, ok("%d webhooks and %d notifiers can be built", len(settings.Webhooks), len(settings.Notifiers)))
+	}
+	return findings
+}
+
+// remoteService is a service the server reaches out to, at Address.
+type remoteService struct {
+	field   string
+	address string
+}
+
+func remoteServiceOf(field string, rawURL string) remoteService {
+	parsedURL, err := url.Parse(rawURL)
+	if err != nil {
+		return remoteService{field: field}
+	}
+	port := parsedURL.Port()
+	if port == "" {
+		port = map[string]string{"https": "443", "smtp": "25", "smtps": "465", "mqtt": "1883", "mqtts": "8883"}[parsedURL.Scheme]
+		if port == "" {
+			port = "80"
+		}
+	}
+	return remoteService{field: field, address: net.JoinHostPort(parsedURL.Hostname(), port)}
+}
+
+// checkRemoteServices only dials the services configured, which may well be
+// reachable from where the server runs but not from here, so failures warn.
+func checkRemoteServices() []finding {
+	services := make([]remoteService, 0)
+	if address := config.Current.Invalidation.Address; address != "" {
+		services = append(services, remoteService{field: "invalidation.address", address: address})
+	}
+	for _, puller := range config.Current.Pullers {
+		services = append(services, remoteServiceOf(fmt.Sprintf(`pullers["%s"].url`, puller.Name), puller.URL))
+	}
+	for webhookIndex, webhook := range config.Current.Alerting.Webhooks {
+		services = append(services, remoteServiceOf(fmt.Sprintf(`alerting.webhooks[%d].url`, webhookIndex), webhook.URL))
+	}
+	for notifierIndex, notifier := range config.Current.Alerting.Notifiers {
+		if notifier.URL != "" {
+			services = append(services, remoteServiceOf(fmt.Sprintf(`alerting.notifiers[%d].url`, notifierIndex), notifier.URL))
+		}
+	}
+	if issuer := config.Current.Authentication.OIDC.Issuer; issuer != "" {
+		services = append(services, remoteServiceOf("authentication.oidc.issuer", issuer))
+	}
+	if cmmsURL := config.Current.CMMS.URL; cmmsURL != "" {
+		services = append(services, remoteServiceOf("cmms.url", strings.ReplaceAll(cmmsURL, "{hardwareId}", "")))
+	}
+	if len(services) == 0 {
+		return []finding{ok("none configured")}
+	}
+
+	findings := make([]finding, 0, len(services))
+	for _, service := range services {
+		if service.address == "" {
+			findings = append(findings, fail(fmt.Sprintf("correct %s", service.field), "%s is not a URL", service.field))
+			continue
+		}
+		connection, err := net.DialTimeout("tcp", service.address, dialTimeout)
+		if err != nil {
+			findings = append(findings, warn(fmt.Sprintf("check %s and that this host may reach it", service.field), "%s: unable to reach %s: %v", service.field, service.address, err))
+			continue
+		}
+		connection.Close()
+		findings = append(findings, ok("%s: %s answers", service.field, service.address))
+	}
+	return findings
+}
+
+func main() {
+	flag.Parse()
+
+	for _, doctorCheck := range checks {
+		for _, found := range doctorCheck.run() {
+			fmt.Printf("%-4s %s: %s\n", found.status, doctorCheck.name, found.detail)
+			if found.fix != "" {
+				fmt.Printf("     fix: %s\n", found.fix)
+			}
+			if found.status == statusFail {
+				failedChecks[doctorCheck.name] = true
+			}
+		}
+	}
+	if len(failedChecks) > 0 {
+		os.Exit(1)
+	}
+}
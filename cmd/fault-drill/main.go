@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"math/rand"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/config"
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/faults"
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/hardware"
+)
+
+func fail(err error) {
+	fmt.Fprintf(os.Stderr, "%v\n", err)
+	os.Exit(1)
+}
+
+func main() {
+	configPath := flag.String("config", "", "JSON config file; defaults apply when empty")
+	samplesPath := flag.String("samples", "api/hardware/samples", "directory holding one sample directory per hardware")
+	hardwareId := flag.String("hardware", "", "hardware to inject faults into (default: the first)")
+	metric := flag.String("metric", "temperature", "metric to inject faults into")
+	kinds := flag.String("faults", "step,ramp,spike,dropout", "comma separated faults to inject, in order")
+	magnitude := flag.Float64("magnitude", 10, "how far faults carry the metric above its latest value")
+	duration := flag.Int("duration", 10, "readings each fault other than a spike lasts")
+	interval := flag.Duration("interval", 0, "time between readings (default: the metric's average interval)")
+	quiet := flag.Int("quiet", 5, "readings at the latest value around each fault")
+	noise := flag.Float64("noise", 0.1, "amplitude of the noise added to every reading")
+	seed := flag.Int64("seed", 1, "random seed for the noise")
+	flag.Parse()
+
+	if *configPath != "" {
+		if err := config.Load(*configPath); err != nil {
+			fail(err)
+		}
+	}
+	if err := hardware.PopulateSamplesFrom(*samplesPath); err != nil {
+		fail(err)
+	}
+	if *hardwareId == "" {
+		hardwareIds := hardware.HardwareIds()
+		if len(hardwareIds) == 0 {
+			fail(fmt.Errorf(`no hardware in %s`, *samplesPath))
+		}
+		*hardwareId = hardwareIds[0]
+	}
+
+	drill := &faults.Drill{HardwareId: *hardwareId, Metric: *metric, Interval: *interval, Quiet: *quiet, Noise: *noise}
+	for _, kind := range strings.Split(*kinds, ",") {
+		fault := &faults.Fault{Kind: strings.TrimSpace(kind), Duration: *duration, Magnitude: *magnitude}
+		if fault.Kind == faults.KindSpike {
+			fault.Duration = 1
+		}
+		drill.Faults = append(drill.Faults, fault)
+	}
+
+	report, err := drill.Run(context.Background(), rand.New(rand.NewSource(*seed)))
+	if err != nil {
+		fail(err)
+	}
+
+	fmt.Printf("%s %s from %g every %s, starting %s\n", *hardwareId, *metric, report.Baseline, report.Interval, report.Start.UTC().Format(time.RFC3339))
+	table := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(table, "FAULT\tFROM\tTO\tCAUGHT\tDETAIL")
+	for _, detection := range report.Detections {
+		fmt.Fprintf(table, "%s\t%s\t%s\t%t\t%s\n", detection.Fault.Kind, detection.From.UTC().Format(time.RFC3339), detection.To.UTC().Format(time.RFC3339), detection.Caught, detection.Detail)
+	}
+	for _, alert := range report.FalseAlarms {
+		fmt.Fprintf(table, "false alarm\t%s\t%s\t\t%s alert, worst %g\n", alert.From.UTC().Format(time.RFC3339), alert.To.UTC().Format(time.RFC3339), alert.RuleId, alert.WorstValue)
+	}
+	table.Flush()
+	if !report.Passed() {
+		os.Exit(1)
+	}
+}
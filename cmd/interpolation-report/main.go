@@ -0,0 +1,61 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"math/rand"
+	"os"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/hardware"
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/timeseries"
+)
+
+func main() {
+	hardwareId := flag.String("hardware", "", "hardware to validate (default: all)")
+	holdoutFraction := flag.Float64("holdout", 0.01, "fraction of real samples to hold out")
+	seed := flag.Int64("seed", 1, "random seed for choosing holdout samples")
+	method := flag.String("method", "", "interpolation method to validate (default: all)")
+	flag.Parse()
+
+	if err := hardware.PopulateSamples(); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
+
+	hardwareIds := hardware.HardwareIds()
+	if *hardwareId != "" {
+		hardwareIds = []string{*hardwareId}
+	}
+	sort.Strings(hardwareIds)
+
+	methods := timeseries.Methods()
+	if *method != "" {
+		methods = []string{*method}
+	}
+
+	report := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(report, "METHOD\tHARDWARE\tMETRIC\tCOUNT\tMAE\tRMSE")
+	for _, method := range methods {
+		interpolator, err := timeseries.InterpolatorFor(method)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(1)
+		}
+
+		// Reseeded per method, so every method is scored on the same holdout
+		random := rand.New(rand.NewSource(*seed))
+		for _, hardwareId := range hardwareIds {
+			interpolationErrors, err := hardware.ValidateInterpolation(hardwareId, *holdoutFraction, random, interpolator)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "unable to validate interpolation: %v\n", err)
+				os.Exit(1)
+			}
+			for _, interpolationError := range interpolationErrors {
+				fmt.Fprintf(report, "%s\t%s\t%s\t%d\t%.6f\t%.6f\n", method, hardwareId, interpolationError.Metric, interpolationError.Count, interpolationError.MeanAbsoluteError, interpolationError.RootMeanSquareError)
+			}
+		}
+	}
+	report.Flush()
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api"
+)
+
+func fail(err error) {
+	fmt.Fprintf(os.Stderr, "%v\n", err)
+	os.Exit(1)
+}
+
+func main() {
+	server := flag.String("server", "http://localhost:8080", "base URL of the server to onboard the hardware on")
+	key := flag.String("key", os.Getenv("KCF_API_KEY"), "API key of an admin client")
+	dryRun := flag.Bool("dry-run", false, "check the manifest and report what would be done, without doing it")
+	timeout := flag.Duration("timeout", 30*time.Second, "how long to wait for the server")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [flags] <manifest.json>\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	manifestBytes, err := os.ReadFile(flag.Arg(0))
+	if err != nil {
+		fail(err)
+	}
+	onboardURL := strings.TrimRight(*server, "/") + "/api/admin/onboard"
+	if *dryRun {
+		onboardURL += "?" + url.Values{"dryRun": {"true"}}.Encode()
+	}
+	request, err := http.NewRequest("POST", onboardURL, bytes.NewReader(manifestBytes))
+	if err != nil {
+		fail(err)
+	}
+	request.Header.Set("Content-Type", "application/json")
+	if *key != "" {
+		request.Header.Set("X-API-Key", *key)
+	}
+
+	response, err := (&http.Client{Timeout: *timeout}).Do(request)
+	if err != nil {
+		fail(err)
+	}
+	defer response.Body.Close()
+	responseBytes, err := io.ReadAll(response.Body)
+	if err != nil {
+		fail(err)
+	}
+	if response.StatusCode != http.StatusOK {
+		fail(fmt.Errorf("%s:\n%s", response.Status, responseBytes))
+	}
+
+	var responseData api.OnboardingResponseData
+	if err := json.Unmarshal(responseBytes, &responseData); err != nil {
+		fail(err)
+	}
+
+	if responseData.DryRun {
+		fmt.Println("dry run, nothing was changed")
+	}
+	table := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(table, "HARDWARE\tCREATED\tRULES")
+	for _, onboarded := range responseData.Hardware {
+		fmt.Fprintf(table, "%s\t%t\t%s\n", onboarded.Id, onboarded.Created, strings.Join(onboarded.Rules, ", "))
+	}
+	table.Flush()
+	if len(responseData.RulesKept) > 0 {
+		fmt.Printf("kept existing rules: %s\n", strings.Join(responseData.RulesKept, ", "))
+	}
+}
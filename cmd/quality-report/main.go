@@ -0,0 +1,66 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/config"
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/hardware"
+)
+
+func main() {
+	configPath := flag.String("config", "", "JSON config file; defaults apply when empty")
+	hardwareId := flag.String("hardware", "", "hardware to check (default: all)")
+	list := flag.Bool("list", false, "list every inconsistent reading after the summary")
+	flag.Parse()
+
+	if *configPath != "" {
+		if err := config.Load(*configPath); err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(1)
+		}
+	}
+	if err := hardware.PopulateSamples(); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
+
+	descriptions := hardware.ListHardware()
+	sort.Slice(descriptions, func(leftIndex, rightIndex int) bool { return descriptions[leftIndex].Id < descriptions[rightIndex].Id })
+
+	report := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(report, "HARDWARE\tMETRIC\tAT MOST\tCHECKED\tINCONSISTENT")
+	allInconsistencies := make(map[string][]*hardware.Inconsistency)
+	for _, description := range descriptions {
+		if *hardwareId != "" && description.Id != *hardwareId || description.First == nil {
+			continue
+		}
+		checks, inconsistencies, err := hardware.CheckConsistency(description.Id, *description.First, *description.Last)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "unable to check consistency: %v\n", err)
+			os.Exit(1)
+		}
+		for _, check := range checks {
+			fmt.Fprintf(report, "%s\t%s\t%s\t%d\t%d\n", description.Id, check.Metric, check.AtMost, check.Checked, check.Inconsistent)
+		}
+		allInconsistencies[description.Id] = inconsistencies
+	}
+	report.Flush()
+
+	if !*list {
+		return
+	}
+	fmt.Println()
+	report = tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(report, "HARDWARE\tTIME\tMETRIC\tVALUE\tAT MOST\tBOUND")
+	for _, description := range descriptions {
+		for _, inconsistency := range allInconsistencies[description.Id] {
+			fmt.Fprintf(report, "%s\t%s\t%s\t%g\t%s\t%g\n", description.Id, inconsistency.Time.UTC().Format(time.RFC3339Nano), inconsistency.Metric, inconsistency.Value, inconsistency.AtMost, inconsistency.BoundValue)
+		}
+	}
+	report.Flush()
+}
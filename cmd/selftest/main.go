@@ -0,0 +1,156 @@
+// Command selftest is a smoke test for deployments: it loads a known sample
+// tree and runs a tabulation, an aggregation and an alert evaluation against
+// it through the API handler, as clients would, exiting non-zero on any
+// mismatch. The rest of the behaviour is covered by the package tests.
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api"
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/hardware"
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/internal/fixtures"
+)
+
+const fixtureHardwareId = fixtures.HardwareId
+
+var fixtureMinute = fixtures.Minute
+
+type check struct {
+	name string
+	run  func() error
+}
+
+func expectClose(what string, actual float64, expected float64) error {
+	if math.Abs(actual-expected) > 1e-6 {
+		return fmt.Errorf(`%s: expected %g, got %g`, what, expected, actual)
+	}
+	return nil
+}
+
+// request answers a request the way the server would, decoding a successful
+// JSON response into responseData.
+func request(method string, path string, body string, responseData interface{}) error {
+	recorder := httptest.NewRecorder()
+	api.Handle(recorder, httptest.NewRequest(method, path, strings.NewReader(body)))
+	if recorder.Code != http.StatusOK {
+		return fmt.Errorf(`%s %s answered %d: %s`, method, path, recorder.Code, strings.TrimSpace(recorder.Body.String()))
+	}
+	if err := json.Unmarshal(recorder.Body.Bytes(), responseData); err != nil {
+		return fmt.Errorf(`%s %s: %w`, method, path, err)
+	}
+	return nil
+}
+
+func formatMinute(minutes float64) string {
+	return fixtureMinute(minutes).UTC().Format(time.RFC3339)
+}
+
+var checks = []check{
+	{"load", func() error {
+		if !hardware.HasSamples(fixtureHardwareId) {
+			return fmt.Errorf(`fixture hardware "%s" was not loaded`, fixtureHardwareId)
+		}
+		if sampleCount := hardware.SampleCount(); sampleCount != fixtures.Minutes {
+			return fmt.Errorf(`expected %d samples, got %d`, fixtures.Minutes, sampleCount)
+		}
+		return nil
+	}},
+	{"tabulation", func() error {
+		// Four rows, 7.5 minutes apart, half of them between samples
+		var tabulated map[string]map[string]*float64
+		body := fmt.Sprintf(`{"id":"%s","from":"%s","to":"%s","count":4}`, fixtureHardwareId, formatMinute(30), formatMinute(60))
+		if err := request("POST", "/api/tabulated_hardware", body, &tabulated); err != nil {
+			return err
+		}
+		if len(tabulated) != 4 {
+			return fmt.Errorf(`expected 4 tabulated rows, got %d`, len(tabulated))
+		}
+		for row := 0; row < 4; row++ {
+			minutes := 30 + 7.5*float64(row)
+			values, hasRow := tabulated[fixtureMinute(minutes).UTC().Format("January _2, 2006 _3:04:05.999PM")]
+			if !hasRow || values["temperature"] == nil || values["rmsVelocityX"] == nil {
+				return fmt.Errorf(`missing tabulated values at minute %g`, minutes)
+			}
+			if err := expectClose(fmt.Sprintf("temperature at minute %g", minutes), *values["temperature"], 20+minutes); err != nil {
+				return err
+			}
+			if err := expectClose(fmt.Sprintf("RMS velocity at minute %g", minutes), *values["rmsVelocityX"], 1.5); err != nil {
+				return err
+			}
+		}
+		return nil
+	}},
+	{"aggregation", func() error {
+		var aggregated api.AggregateResponseData
+		path := fmt.Sprintf("/api/hardware/%s/aggregate?from=%s&to=%s&interval=15m", fixtureHardwareId, formatMinute(0), formatMinute(60))
+		if err := request("GET", path, "", &aggregated); err != nil {
+			return err
+		}
+		if len(aggregated.Buckets) != 4 {
+			return fmt.Errorf(`expected 4 buckets, got %d`, len(aggregated.Buckets))
+		}
+		for bucketIndex, bucket := range aggregated.Buckets {
+			temperature, rmsVelocityX := bucket.Metrics["temperature"], bucket.Metrics["rmsVelocityX"]
+			if temperature == nil || rmsVelocityX == nil || temperature.Count != 15 {
+				return fmt.Errorf(`bucket %d does not summarize 15 samples of each metric`, bucketIndex)
+			}
+			first := 20 + 15*float64(bucketIndex)
+			if err := expectClose(fmt.Sprintf("bucket %d minimum temperature", bucketIndex), temperature.Minimum, first); err != nil {
+				return err
+			}
+			if err := expectClose(fmt.Sprintf("bucket %d mean temperature", bucketIndex), temperature.Mean, first+7); err != nil {
+				return err
+			}
+			if err := expectClose(fmt.Sprintf("bucket %d RMS of RMS velocity", bucketIndex), rmsVelocityX.RootMeanSquare, 1.5); err != nil {
+				return err
+			}
+		}
+		return nil
+	}},
+	{"alerting", func() error {
+		var preview api.AlertRulePreviewResponseData
+		body := fmt.Sprintf(`{"rule":{"id":"selftest","hardwareId":"%s","metric":"temperature","comparison":"above","threshold":69.5},"from":"%s","to":"%s"}`, fixtureHardwareId, formatMinute(0), formatMinute(59))
+		if err := request("POST", "/api/alerts/preview", body, &preview); err != nil {
+			return err
+		}
+		firings := preview.Firings
+		if len(firings) != 1 {
+			return fmt.Errorf(`expected 1 firing, got %d`, len(firings))
+		}
+		if !firings[0].From.Equal(fixtureMinute(50)) || !firings[0].To.Equal(fixtureMinute(59)) || firings[0].SampleCount != 10 {
+			return fmt.Errorf(`unexpected firing from %s to %s over %d samples`, firings[0].From, firings[0].To, firings[0].SampleCount)
+		}
+		return expectClose("worst value", firings[0].WorstValue, 79)
+	}},
+}
+
+func main() {
+	removeFixtures, err := fixtures.Load()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "FAIL load: %v\n", err)
+		os.Exit(1)
+	}
+	defer removeFixtures()
+
+	failed := false
+	for _, selftestCheck := range checks {
+		if err := selftestCheck.run(); err != nil {
+			fmt.Printf("FAIL %s: %v\n", selftestCheck.name, err)
+			failed = true
+		} else {
+			fmt.Printf("ok   %s\n", selftestCheck.name)
+		}
+	}
+	if failed {
+		removeFixtures()
+		os.Exit(1)
+	}
+}
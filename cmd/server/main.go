@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/config"
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/engine"
+)
+
+func main() {
+	address := flag.String("addr", ":8080", "address to listen on")
+	configPath := flag.String("config", "", "JSON config file; defaults apply when empty")
+	samplesPath := flag.String("samples", "api/hardware/samples", "directory holding one sample directory per hardware")
+	staticPath := flag.String("static", ".", "directory the dashboard pages are served from")
+	shutdownTimeout := flag.Duration("shutdown-timeout", 30*time.Second, "how long shutdown hooks may take to flush before exiting anyway")
+	drainGrace := flag.Duration("drain-grace", 5*time.Second, "how long to keep serving while reporting not ready before shutting down; a second signal cuts it short")
+	flag.Parse()
+
+	if *configPath != "" {
+		if err := config.Load(*configPath); err != nil {
+			log.Fatal(err)
+		}
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	kcfEngine, err := engine.Start(ctx, *samplesPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if _, err := os.Stat(*staticPath); err != nil {
+		log.Fatalf("unable to serve dashboard pages: %v", err)
+	}
+	mux := http.NewServeMux()
+	kcfEngine.Register(mux)
+	mux.Handle("/", http.FileServer(http.Dir(*staticPath)))
+
+	server := &http.Server{Addr: *address, Handler: mux}
+	kcfEngine.OnShutdown("http server", server.Shutdown)
+
+	go func() {
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+		received := <-signals
+		log.Printf("received %s, draining for %s\n", received, *drainGrace)
+
+		// Readiness fails while requests are still served, so load balancers
+		// stop routing here before the listener closes
+		kcfEngine.Drain()
+		select {
+		case <-time.After(*drainGrace):
+		case received = <-signals:
+			log.Printf("received %s, cutting the drain short\n", received)
+		}
+		log.Printf("shutting down\n")
+
+		shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), *shutdownTimeout)
+		defer cancelShutdown()
+		if err := kcfEngine.Shutdown(shutdownCtx); err != nil {
+			log.Printf("shutdown: %v\n", err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}()
+
+	log.Printf("serving on %s\n", *address)
+	if err := server.ListenAndServe(); err != http.ErrServerClosed {
+		log.Fatal(err)
+	}
+	// Shutdown exits once every hook has run
+	select {}
+}
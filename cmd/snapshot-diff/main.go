@@ -0,0 +1,59 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/hardware"
+)
+
+func main() {
+	tolerance := flag.Float64("tolerance", 0, "largest difference between two values still considered unchanged")
+	all := flag.Bool("all", false, "also list channels without any difference")
+	asJSON := flag.Bool("json", false, "print the differences as JSON instead of a table")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [flags] <old sample tree> <new sample tree>\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 2 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	channelDiffs, err := hardware.DiffSampleTrees(flag.Arg(0), flag.Arg(1), *tolerance)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "unable to compare sample trees: %v\n", err)
+		os.Exit(2)
+	}
+
+	// Like diff, exit with 1 when the trees differ and 2 when they cannot be read
+	differ := false
+	reportedChannelDiffs := make([]*hardware.ChannelDiff, 0, len(channelDiffs))
+	for _, channelDiff := range channelDiffs {
+		differ = differ || !channelDiff.IsEmpty()
+		if *all || !channelDiff.IsEmpty() {
+			reportedChannelDiffs = append(reportedChannelDiffs, channelDiff)
+		}
+	}
+
+	if *asJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		encoder.Encode(reportedChannelDiffs)
+	} else {
+		writer := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(writer, "HARDWARE\tCHANNEL\tADDED\tREMOVED\tCHANGED\tUNCHANGED\tMAX DIFFERENCE")
+		for _, channelDiff := range reportedChannelDiffs {
+			fmt.Fprintf(writer, "%s\t%s\t%d\t%d\t%d\t%d\t%g\n", channelDiff.HardwareId, channelDiff.SampleDataName, channelDiff.Added, channelDiff.Removed, channelDiff.Changed, channelDiff.Unchanged, channelDiff.MaxDifference)
+		}
+		writer.Flush()
+	}
+
+	if differ {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api"
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/config"
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/hardware"
+)
+
+func fail(err error) {
+	fmt.Fprintf(os.Stderr, "%v\n", err)
+	os.Exit(1)
+}
+
+func percentile(sortedLatencies []time.Duration, fraction float64) time.Duration {
+	if len(sortedLatencies) == 0 {
+		return 0
+	}
+	return sortedLatencies[int(fraction*float64(len(sortedLatencies)-1))]
+}
+
+// ingestUntil keeps adding readings just past the newest sample of a
+// hardware until done is closed, so tabulations run against a store that is
+// being written to, and returns how many it added.
+func ingestUntil(done <-chan struct{}, description *hardware.Description) int {
+	metrics := make([]string, 0, len(description.Metrics))
+	for metric := range description.Metrics {
+		metrics = append(metrics, metric)
+	}
+	readingTime := *description.Last
+	var ingested int
+	for {
+		select {
+		case <-done:
+			return ingested
+		default:
+		}
+		readingTime = readingTime.Add(time.Second)
+		reading := &hardware.Reading{HardwareId: description.Id, Time: readingTime, Values: make(map[string]float64)}
+		for _, metric := range metrics {
+			reading.Values[metric] = description.Metrics[metric].Latest
+		}
+		if err := hardware.AddSample(reading); err != nil {
+			fail(err)
+		}
+		ingested++
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func main() {
+	configPath := flag.String("config", "", "JSON config file; defaults apply when empty")
+	samplesPath := flag.String("samples", "api/hardware/samples", "directory holding one sample directory per hardware")
+	concurrency := flag.Int("concurrency", 200, "requests in flight at once")
+	requests := flag.Int("requests", 2000, "requests to send in total")
+	count := flag.Int("count", 100, "points per tabulation")
+	method := flag.String("method", "", "interpolation method to request (default: linear)")
+	ingest := flag.Bool("ingest", false, "keep ingesting readings while the requests run")
+	flag.Parse()
+
+	if *configPath != "" {
+		if err := config.Load(*configPath); err != nil {
+			fail(err)
+		}
+	}
+	if err := hardware.PopulateSamplesFrom(*samplesPath); err != nil {
+		fail(err)
+	}
+
+	descriptions := make([]*hardware.Description, 0)
+	for _, description := range hardware.ListHardware() {
+		if description.First != nil {
+			descriptions = append(descriptions, description)
+		}
+	}
+	if len(descriptions) == 0 {
+		fail(fmt.Errorf(`no hardware in "%s" has samples to tabulate`, *samplesPath))
+	}
+
+	requestBodies := make([][]byte, len(descriptions))
+	for descriptionIndex, description := range descriptions {
+		// Inset, as there is nothing to interpolate from right at the edges
+		inset := description.Last.Sub(*description.First) / 10
+		requestBody, err := json.Marshal(&api.TabulatedHardwareRequestData{Id: description.Id, From: description.First.Add(inset), To: description.Last.Add(-inset), Count: *count, Method: *method})
+		if err != nil {
+			fail(err)
+		}
+		requestBodies[descriptionIndex] = requestBody
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(api.Handle))
+	defer server.Close()
+	client := &http.Client{Transport: &http.Transport{MaxIdleConnsPerHost: *concurrency}}
+
+	ingestDone, ingested := make(chan struct{}), make(chan int, 1)
+	if *ingest {
+		go func() { ingested <- ingestUntil(ingestDone, descriptions[0]) }()
+	}
+
+	var nextRequest, failures int64
+	latencies := make([]time.Duration, *requests)
+	var workers sync.WaitGroup
+	started := time.Now()
+	for worker := 0; worker < *concurrency; worker++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			for {
+				requestIndex := int(atomic.AddInt64(&nextRequest, 1) - 1)
+				if requestIndex >= *requests {
+					return
+				}
+
+				requestStarted := time.Now()
+				response, err := client.Post(server.URL+"/api/tabulated_hardware", "application/json", bytes.NewReader(requestBodies[requestIndex%len(requestBodies)]))
+				if err != nil {
+					atomic.AddInt64(&failures, 1)
+					continue
+				}
+				io.Copy(io.Discard, response.Body)
+				response.Body.Close()
+				latencies[requestIndex] = time.Since(requestStarted)
+				if response.StatusCode != http.StatusOK {
+					atomic.AddInt64(&failures, 1)
+				}
+			}
+		}()
+	}
+	workers.Wait()
+	elapsed := time.Since(started)
+	close(ingestDone)
+
+	sort.Slice(latencies, func(leftIndex, rightIndex int) bool { return latencies[leftIndex] < latencies[rightIndex] })
+	fmt.Printf("requests:    %d (%d failed) over %d hardware, %d in flight\n", *requests, failures, len(descriptions), *concurrency)
+	if *ingest {
+		fmt.Printf("ingested:    %d readings meanwhile\n", <-ingested)
+	}
+	fmt.Printf("elapsed:     %s\n", elapsed.Round(time.Millisecond))
+	fmt.Printf("throughput:  %.1f requests/s\n", float64(*requests)/elapsed.Seconds())
+	fmt.Printf("latency:     p50 %s  p90 %s  p99 %s  max %s\n",
+		percentile(latencies, 0.5).Round(time.Microsecond),
+		percentile(latencies, 0.9).Round(time.Microsecond),
+		percentile(latencies, 0.99).Round(time.Microsecond),
+		latencies[len(latencies)-1].Round(time.Microsecond))
+	if failures > 0 {
+		os.Exit(1)
+	}
+}
@@ -1,3 +1,5 @@
 module github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0
 
 go 1.19
+
+require github.com/mattn/go-sqlite3 v1.14.33
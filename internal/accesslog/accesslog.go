@@ -0,0 +1,231 @@
+package accesslog
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/config"
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/internal/auth"
+)
+
+const (
+	FormatCommon   = "common"
+	FormatCombined = "combined"
+
+	clfTimeLayout = "02/Jan/2006:15:04:05 -0700"
+)
+
+type Entry struct {
+	Host      string
+	Time      time.Time
+	Request   string
+	Status    int
+	Bytes     int64
+	Referer   string
+	UserAgent string
+}
+
+// RedactedURI is the URI of a request with any read-only token in its query
+// blanked, so logs do not hand out access.
+func RedactedURI(request *http.Request) string {
+	query := request.URL.Query()
+	if query.Get(auth.ReadOnlyTokenParameter) == "" {
+		return request.URL.RequestURI()
+	}
+	query.Set(auth.ReadOnlyTokenParameter, "-")
+	redactedURL := *request.URL
+	redactedURL.RawQuery = query.Encode()
+	return redactedURL.RequestURI()
+}
+
+func EntryOf(request *http.Request, started time.Time, status int, bytes int64) *Entry {
+	host, _, err := net.SplitHostPort(request.RemoteAddr)
+	if err != nil {
+		host = request.RemoteAddr
+	}
+	if status == 0 {
+		status = http.StatusOK
+	}
+	return &Entry{
+		Host:      host,
+		Time:      started,
+		Request:   fmt.Sprintf("%s %s %s", request.Method, RedactedURI(request), request.Proto),
+		Status:    status,
+		Bytes:     bytes,
+		Referer:   request.Referer(),
+		UserAgent: request.UserAgent(),
+	}
+}
+
+// quote escapes a field the way Apache does, so quotes and control characters
+// in client-supplied values cannot forge extra fields.
+func quote(field string) string {
+	if field == "" {
+		return `"-"`
+	}
+	escaped := strings.Builder{}
+	for _, character := range []byte(field) {
+		switch {
+		case character == '"' || character == '\\':
+			escaped.WriteByte('\\')
+			escaped.WriteByte(character)
+		case character < 0x20 || character >= 0x7f:
+			fmt.Fprintf(&escaped, `\x%02x`, character)
+		default:
+			escaped.WriteByte(character)
+		}
+	}
+	return `"` + escaped.String() + `"`
+}
+
+func (entry *Entry) Format(format string) string {
+	bytes := "-"
+	if entry.Bytes > 0 {
+		bytes = fmt.Sprint(entry.Bytes)
+	}
+
+	line := fmt.Sprintf("%s - - [%s] %s %d %s", entry.Host, entry.Time.Format(clfTimeLayout), quote(entry.Request), entry.Status, bytes)
+	if format == FormatCombined {
+		line += fmt.Sprintf(" %s %s", quote(entry.Referer), quote(entry.UserAgent))
+	}
+	return line + "\n"
+}
+
+// RotatingFile appends to a log file and, once it would grow past MaxSize,
+// shifts it to Path.1, Path.1 to Path.2 and so on, dropping the oldest.
+type RotatingFile struct {
+	Path       string
+	MaxSize    int64
+	MaxBackups int
+
+	mutex sync.Mutex
+	file  *os.File
+	size  int64
+}
+
+func (rotatingFile *RotatingFile) open() error {
+	file, err := os.OpenFile(rotatingFile.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf(`unable to open access log "%s": %w`, rotatingFile.Path, err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf(`unable to stat access log "%s": %w`, rotatingFile.Path, err)
+	}
+	rotatingFile.file, rotatingFile.size = file, info.Size()
+	return nil
+}
+
+func (rotatingFile *RotatingFile) rotate() error {
+	if err := rotatingFile.file.Close(); err != nil {
+		return err
+	}
+	rotatingFile.file = nil
+
+	if err := ShiftBackups(rotatingFile.Path, rotatingFile.MaxBackups); err != nil {
+		return err
+	}
+	return rotatingFile.open()
+}
+
+// ShiftBackups moves a closed log file at path to path.1, path.1 to path.2
+// and so on, dropping what would go past maxBackups, or removes the file when
+// no backups are kept.
+func ShiftBackups(path string, maxBackups int) error {
+	if maxBackups <= 0 {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	for backup := maxBackups - 1; backup >= 1; backup-- {
+		backupPath := fmt.Sprintf("%s.%d", path, backup)
+		if err := os.Rename(backupPath, fmt.Sprintf("%s.%d", path, backup+1)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	if err := os.Rename(path, path+".1"); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func (rotatingFile *RotatingFile) Write(data []byte) (int, error) {
+	rotatingFile.mutex.Lock()
+	defer rotatingFile.mutex.Unlock()
+
+	if rotatingFile.file == nil {
+		if err := rotatingFile.open(); err != nil {
+			return 0, err
+		}
+	}
+	if rotatingFile.MaxSize > 0 && rotatingFile.size > 0 && rotatingFile.size+int64(len(data)) > rotatingFile.MaxSize {
+		if err := rotatingFile.rotate(); err != nil {
+			return 0, fmt.Errorf(`unable to rotate access log "%s": %w`, rotatingFile.Path, err)
+		}
+	}
+
+	written, err := rotatingFile.file.Write(data)
+	rotatingFile.size += int64(written)
+	return written, err
+}
+
+func (rotatingFile *RotatingFile) Close() error {
+	rotatingFile.mutex.Lock()
+	defer rotatingFile.mutex.Unlock()
+
+	if rotatingFile.file == nil {
+		return nil
+	}
+	err := rotatingFile.file.Close()
+	rotatingFile.file = nil
+	return err
+}
+
+var (
+	outputMutex sync.Mutex
+	output      *RotatingFile
+)
+
+// Log appends an entry to the access log configured in config.Current, doing
+// nothing when no path is configured.
+func Log(entry *Entry) {
+	accessLogConfig := config.Current.AccessLog
+	if accessLogConfig.Path == "" {
+		return
+	}
+
+	outputMutex.Lock()
+	if output == nil || output.Path != accessLogConfig.Path {
+		if output != nil {
+			output.Close()
+		}
+		output = &RotatingFile{Path: accessLogConfig.Path, MaxSize: accessLogConfig.MaxSize, MaxBackups: accessLogConfig.MaxBackups}
+	}
+	currentOutput := output
+	outputMutex.Unlock()
+
+	if _, err := currentOutput.Write([]byte(entry.Format(accessLogConfig.Format))); err != nil {
+		log.Println(err)
+	}
+}
+
+// Close closes the access log file; a later entry opens it again.
+func Close() error {
+	outputMutex.Lock()
+	defer outputMutex.Unlock()
+
+	if output == nil {
+		return nil
+	}
+	err := output.Close()
+	output = nil
+	return err
+}
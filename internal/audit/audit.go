@@ -0,0 +1,366 @@
+// Package audit records, for regulated sites, which client accessed the
+// samples of which hardware over which window, in an append-only file whose
+// entries are chained by hash so that one edited or removed breaks the
+// chain, and reports on what it recorded.
+package audit
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/config"
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/internal/auth"
+)
+
+// AllHardware stands for every hardware in entries of fleet-wide routes.
+const AllHardware = "*"
+
+// fleetRoutes read the samples of every hardware at once.
+var fleetRoutes = map[string]bool{
+	"/api/hardware":        true,
+	"/api/overview":        true,
+	"/api/fleet/aggregate": true,
+}
+
+// Entry is one access. Previous is the Hash of the entry before it, empty
+// for the first, and Hash covers every other field.
+type Entry struct {
+	Time        time.Time  `json:"time"`
+	Client      string     `json:"client"`
+	Method      string     `json:"method"`
+	Route       string     `json:"route"`
+	HardwareIds []string   `json:"hardwareIds"`
+	From        *time.Time `json:"from,omitempty"`
+	To          *time.Time `json:"to,omitempty"`
+	Status      int        `json:"status"`
+	Previous    string     `json:"previous"`
+	Hash        string     `json:"hash"`
+}
+
+func (entry *Entry) hashOf() string {
+	unhashed := *entry
+	unhashed.Hash = ""
+	entryBytes, _ := json.Marshal(unhashed)
+	hash := sha256.Sum256(entryBytes)
+	return hex.EncodeToString(hash[:])
+}
+
+// Fingerprint names an API key in the audit without giving it away.
+func Fingerprint(apiKey string) string {
+	hash := sha256.Sum256([]byte(apiKey))
+	return hex.EncodeToString(hash[:6])
+}
+
+// ClientOf names who made a request: the identity it was authenticated as,
+// API keys by their fingerprint, or else its address.
+func ClientOf(request *http.Request) string {
+	identity := auth.IdentityOf(request)
+	switch {
+	case identity == nil:
+		host, _, err := net.SplitHostPort(request.RemoteAddr)
+		if err != nil {
+			host = request.RemoteAddr
+		}
+		return "address:" + host
+	case identity.Provider == auth.ProviderAPIKey:
+		return auth.ProviderAPIKey + ":" + Fingerprint(identity.Subject)
+	default:
+		return identity.Client()
+	}
+}
+
+// EntryOf describes a request to route, which answered with status, if it
+// reached samples: of the hardware named in its path, its query, as id,
+// hardwareId or reference, or its JSON body, as id, hardwareId, alignTo or the
+// id of left and right, or of every hardware on fleet-wide routes. It
+// returns nil for requests reaching no samples, and for admin routes, whose
+// parameters name hardware without reading it.
+func EntryOf(request *http.Request, body []byte, route string, status int, started time.Time) *Entry {
+	if strings.HasPrefix(route, "/api/admin/") {
+		return nil
+	}
+	if status == 0 {
+		status = http.StatusOK
+	}
+	entry := &Entry{Time: started.UTC(), Client: ClientOf(request), Method: request.Method, Route: route, HardwareIds: make([]string, 0), Status: status}
+
+	var bodyFields struct {
+		Id         string `json:"id"`
+		HardwareId string `json:"hardwareId"`
+		AlignTo    string `json:"alignTo"`
+		Left       struct {
+			Id string `json:"id"`
+		} `json:"left"`
+		Right struct {
+			Id string `json:"id"`
+		} `json:"right"`
+		From *time.Time `json:"from"`
+		To   *time.Time `json:"to"`
+	}
+	if len(body) > 0 {
+		json.Unmarshal(body, &bodyFields)
+	}
+
+	query := request.URL.Query()
+	candidates := []string{query.Get("id"), query.Get("hardwareId"), query.Get("reference"), bodyFields.Id, bodyFields.HardwareId, bodyFields.AlignTo, bodyFields.Left.Id, bodyFields.Right.Id}
+	if strings.HasPrefix(route, "/api/hardware/{id}") {
+		pathHardwareId, _, _ := strings.Cut(strings.TrimPrefix(request.URL.Path, "/api/hardware/"), "/")
+		candidates = append([]string{pathHardwareId}, candidates...)
+	}
+	for _, hardwareId := range candidates {
+		if hardwareId == "" {
+			continue
+		}
+		isListed := false
+		for _, listedId := range entry.HardwareIds {
+			isListed = isListed || listedId == hardwareId
+		}
+		if !isListed {
+			entry.HardwareIds = append(entry.HardwareIds, hardwareId)
+		}
+	}
+	if fleetRoutes[route] {
+		entry.HardwareIds = append(entry.HardwareIds, AllHardware)
+	}
+	if len(entry.HardwareIds) == 0 {
+		return nil
+	}
+
+	entry.From, entry.To = bodyFields.From, bodyFields.To
+	if from, err := time.Parse(time.RFC3339, query.Get("from")); err == nil {
+		entry.From = &from
+	}
+	if to, err := time.Parse(time.RFC3339, query.Get("to")); err == nil {
+		entry.To = &to
+	}
+	return entry
+}
+
+var (
+	recordMutex sync.Mutex
+	// lastHash is the Hash of the last entry of the file at lastHashPath
+	lastHash     string
+	lastHashPath string
+)
+
+// lastHashIn reads the Hash of the last entry of the file at path.
+func lastHashIn(path string) (string, error) {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return "", nil
+	} else if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	var last Entry
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64<<10), 1<<20)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) > 0 {
+			last = Entry{}
+			if err := json.Unmarshal(scanner.Bytes(), &last); err != nil {
+				return "", err
+			}
+		}
+	}
+	return last.Hash, scanner.Err()
+}
+
+// Record chains an entry onto the audit file, when one is configured and
+// the entry is not nil.
+func Record(entry *Entry) {
+	path := config.Current.Audit.Path
+	if path == "" || entry == nil {
+		return
+	}
+
+	recordMutex.Lock()
+	defer recordMutex.Unlock()
+
+	if lastHashPath != path {
+		hash, err := lastHashIn(path)
+		if err != nil {
+			log.Printf("unable to read audit log \"%s\": %v\n", path, err)
+			return
+		}
+		lastHash, lastHashPath = hash, path
+	}
+	entry.Previous = lastHash
+	entry.Hash = entry.hashOf()
+	entryBytes, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		log.Printf("unable to write audit log \"%s\": %v\n", path, err)
+		return
+	}
+	defer file.Close()
+	if _, err := file.Write(append(entryBytes, '\n')); err != nil {
+		log.Printf("unable to write audit log \"%s\": %v\n", path, err)
+		return
+	}
+	lastHash = entry.Hash
+}
+
+// Filter narrows a report to accesses made from From until To, by Client,
+// to HardwareId, each only when set. Accesses to every hardware match any
+// HardwareId.
+type Filter struct {
+	From       time.Time
+	To         time.Time
+	Client     string
+	HardwareId string
+}
+
+func (filter *Filter) matches(entry *Entry) bool {
+	if (!filter.From.IsZero() && entry.Time.Before(filter.From)) || (!filter.To.IsZero() && !entry.Time.Before(filter.To)) {
+		return false
+	}
+	if filter.Client != "" && entry.Client != filter.Client {
+		return false
+	}
+	if filter.HardwareId == "" {
+		return true
+	}
+	for _, hardwareId := range entry.HardwareIds {
+		if hardwareId == filter.HardwareId || hardwareId == AllHardware {
+			return true
+		}
+	}
+	return false
+}
+
+// Access sums up the accesses of one client to one hardware: how many
+// requests, how many of those were refused, when they were made, and the
+// earliest and latest sample time any of them asked for.
+type Access struct {
+	Client      string     `json:"client"`
+	HardwareId  string     `json:"hardwareId"`
+	Requests    int        `json:"requests"`
+	Refused     int        `json:"refused"`
+	FirstAccess time.Time  `json:"firstAccess"`
+	LastAccess  time.Time  `json:"lastAccess"`
+	From        *time.Time `json:"from,omitempty"`
+	To          *time.Time `json:"to,omitempty"`
+}
+
+// Report is what the audit file holds for a filter. Intact tells whether the
+// whole file's chain holds, Problems where it breaks if not.
+type Report struct {
+	Intact   bool      `json:"intact"`
+	Problems []string  `json:"problems,omitempty"`
+	Accesses []*Access `json:"accesses"`
+	Entries  []*Entry  `json:"entries"`
+}
+
+// BuildReport reads the audit file back, checking its chain throughout, and
+// sums up the entries matching filter, per client and hardware.
+func BuildReport(filter Filter) (*Report, error) {
+	path := config.Current.Audit.Path
+	if path == "" {
+		return nil, fmt.Errorf(`no audit log is configured`)
+	}
+
+	// Entries recorded while the file is read are left out, so its end is
+	// where the last entry recorded so far ends
+	recordMutex.Lock()
+	recordedHash, isRecorded := lastHash, lastHashPath == path
+	info, err := os.Stat(path)
+	recordMutex.Unlock()
+	if os.IsNotExist(err) {
+		return &Report{Intact: true, Accesses: make([]*Access, 0), Entries: make([]*Entry, 0)}, nil
+	} else if err != nil {
+		return nil, err
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	report := &Report{Intact: true, Accesses: make([]*Access, 0), Entries: make([]*Entry, 0)}
+	accesses := make(map[[2]string]*Access)
+	previousHash := ""
+	scanner := bufio.NewScanner(io.LimitReader(file, info.Size()))
+	scanner.Buffer(make([]byte, 64<<10), 1<<20)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		entry := &Entry{}
+		if err := json.Unmarshal(scanner.Bytes(), entry); err != nil {
+			report.Intact = false
+			report.Problems = append(report.Problems, fmt.Sprintf(`line %d: unparsable: %v`, lineNumber, err))
+			continue
+		}
+		switch {
+		case entry.Previous != previousHash:
+			report.Intact = false
+			report.Problems = append(report.Problems, fmt.Sprintf(`line %d: does not follow the entry before it; entries were removed or reordered`, lineNumber))
+		case entry.Hash != entry.hashOf():
+			report.Intact = false
+			report.Problems = append(report.Problems, fmt.Sprintf(`line %d: does not match its hash; the entry was edited`, lineNumber))
+		}
+		previousHash = entry.Hash
+
+		if !filter.matches(entry) {
+			continue
+		}
+		report.Entries = append(report.Entries, entry)
+		for _, hardwareId := range entry.HardwareIds {
+			if filter.HardwareId != "" && hardwareId != filter.HardwareId && hardwareId != AllHardware {
+				continue
+			}
+			key := [2]string{entry.Client, hardwareId}
+			access, hasAccess := accesses[key]
+			if !hasAccess {
+				access = &Access{Client: entry.Client, HardwareId: hardwareId, FirstAccess: entry.Time}
+				accesses[key] = access
+				report.Accesses = append(report.Accesses, access)
+			}
+			access.Requests++
+			if entry.Status == http.StatusUnauthorized || entry.Status == http.StatusForbidden {
+				access.Refused++
+			}
+			access.LastAccess = entry.Time
+			if entry.From != nil && (access.From == nil || entry.From.Before(*access.From)) {
+				access.From = entry.From
+			}
+			if entry.To != nil && (access.To == nil || entry.To.After(*access.To)) {
+				access.To = entry.To
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if isRecorded && previousHash != recordedHash {
+		report.Intact = false
+		report.Problems = append(report.Problems, `the file ends before the last entry recorded; entries were removed from its end`)
+	}
+
+	sort.SliceStable(report.Accesses, func(leftIndex, rightIndex int) bool {
+		left, right := report.Accesses[leftIndex], report.Accesses[rightIndex]
+		if left.Client != right.Client {
+			return left.Client < right.Client
+		}
+		return left.HardwareId < right.HardwareId
+	})
+	return report, nil
+}
@@ -0,0 +1,36 @@
+package auth
+
+import (
+	"crypto/subtle"
+	"net/http"
+
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/config"
+)
+
+// apiKeyProvider recognizes the X-API-Key header. Without configured keys
+// any key is accepted, identifying its client with the anonymous roles.
+type apiKeyProvider struct{}
+
+func (apiKeyProvider) Authenticate(request *http.Request) (*Identity, error) {
+	apiKey := request.Header.Get("X-API-Key")
+	if apiKey == "" {
+		return nil, nil
+	}
+
+	authentication := config.Current.Authentication
+	if len(authentication.APIKeys) == 0 {
+		return &Identity{Provider: ProviderAPIKey, Subject: apiKey, Roles: authentication.Anonymous()}, nil
+	}
+	// Every key is compared in full, so timing does not tell how near a guess was
+	var roles []string
+	matched := false
+	for configuredKey, configuredRoles := range authentication.APIKeys {
+		if subtle.ConstantTimeCompare([]byte(configuredKey), []byte(apiKey)) == 1 {
+			roles, matched = configuredRoles, true
+		}
+	}
+	if !matched {
+		return nil, ErrUnknownAPIKey
+	}
+	return &Identity{Provider: ProviderAPIKey, Subject: apiKey, Roles: roles}, nil
+}
@@ -0,0 +1,106 @@
+// Package auth identifies who makes a request, through the providers
+// config.Authentication enables, and decides what the roles it was granted
+// allow. Roles are ranked, each allowing what the ones below it do: viewer,
+// then operator, then admin.
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/config"
+)
+
+var (
+	ErrUnknownAPIKey     = errors.New(`unknown API key`)
+	ErrInvalidToken      = errors.New(`invalid bearer token`)
+	ErrIssuerUnavailable = errors.New(`token issuer unavailable`)
+)
+
+const (
+	ProviderAPIKey        = "key"
+	ProviderOIDC          = "oidc"
+	ProviderReadOnlyToken = "token"
+	ProviderGateway       = "gateway"
+)
+
+// Identity is who a request is made by, as the provider that recognized its
+// credentials knows them.
+type Identity struct {
+	Provider string
+	Subject  string
+	Roles    []string
+}
+
+// Client names an identity the way usage counts clients, e.g. "key:abc" or
+// "oidc:3f2a".
+func (identity *Identity) Client() string {
+	return identity.Provider + ":" + identity.Subject
+}
+
+// Provider recognizes one kind of credentials. Authenticate returns a nil
+// identity without an error for requests carrying none of its kind, and an
+// error for requests carrying credentials it refuses.
+type Provider interface {
+	Authenticate(request *http.Request) (*Identity, error)
+}
+
+// providers are asked in turn, the first to recognize a request's credentials
+// identifying it.
+var providers = []Provider{apiKeyProvider{}, oidcProvider{}, readOnlyTokenProvider{}, signedRequestProvider{}}
+
+// Authenticate identifies the maker of a request, returning nil for requests
+// without credentials.
+func Authenticate(request *http.Request) (*Identity, error) {
+	for _, provider := range providers {
+		identity, err := provider.Authenticate(request)
+		if err != nil {
+			return nil, err
+		}
+		if identity != nil {
+			return identity, nil
+		}
+	}
+	return nil, nil
+}
+
+type identityKey struct{}
+
+// WithIdentity returns a context carrying an identity, for IdentityOf to find
+// on requests made with it, sub-requests included.
+func WithIdentity(parent context.Context, identity *Identity) context.Context {
+	return context.WithValue(parent, identityKey{}, identity)
+}
+
+// IdentityOf returns who a request was authenticated as, or nil for
+// anonymous requests.
+func IdentityOf(request *http.Request) *Identity {
+	identity, _ := request.Context().Value(identityKey{}).(*Identity)
+	return identity
+}
+
+func rankOf(role string) int {
+	for rank, knownRole := range config.Roles {
+		if knownRole == role {
+			return rank
+		}
+	}
+	return -1
+}
+
+// Allows reports whether an identity, nil for anonymous requests, was granted
+// a role or one ranked above it.
+func Allows(identity *Identity, role string) bool {
+	roles := config.Current.Authentication.Anonymous()
+	if identity != nil {
+		roles = identity.Roles
+	}
+	requiredRank := rankOf(role)
+	for _, grantedRole := range roles {
+		if rankOf(grantedRole) >= requiredRank {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,229 @@
+package auth
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/config"
+)
+
+// jsonWebKey is one key of an issuer's key set, RSA or elliptic curve.
+type jsonWebKey struct {
+	KeyType  string `json:"kty"`
+	KeyId    string `json:"kid"`
+	Use      string `json:"use"`
+	Modulus  string `json:"n"`
+	Exponent string `json:"e"`
+	Curve    string `json:"crv"`
+	X        string `json:"x"`
+	Y        string `json:"y"`
+}
+
+func decodeInteger(encoded string) (*big.Int, error) {
+	decoded, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil || len(decoded) == 0 {
+		return nil, fmt.Errorf(`malformed integer "%s"`, encoded)
+	}
+	return new(big.Int).SetBytes(decoded), nil
+}
+
+func (webKey *jsonWebKey) publicKey() (crypto.PublicKey, error) {
+	switch webKey.KeyType {
+	case "RSA":
+		modulus, err := decodeInteger(webKey.Modulus)
+		if err != nil {
+			return nil, err
+		}
+		exponent, err := decodeInteger(webKey.Exponent)
+		if err != nil || !exponent.IsInt64() || exponent.Int64() > 1<<31-1 {
+			return nil, fmt.Errorf(`malformed exponent "%s"`, webKey.Exponent)
+		}
+		return &rsa.PublicKey{N: modulus, E: int(exponent.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch webKey.Curve {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf(`unsupported curve "%s"`, webKey.Curve)
+		}
+		x, err := decodeInteger(webKey.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeInteger(webKey.Y)
+		if err != nil {
+			return nil, err
+		}
+		if !curve.IsOnCurve(x, y) {
+			return nil, errors.New(`point is not on the curve`)
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	default:
+		return nil, fmt.Errorf(`unsupported key type "%s"`, webKey.KeyType)
+	}
+}
+
+type tokenHeader struct {
+	Algorithm string `json:"alg"`
+	KeyId     string `json:"kid"`
+}
+
+// verifySignature checks a JWS signature over signed. Only asymmetric
+// algorithms are accepted, so a token cannot pass off a public key as a
+// shared secret, nor go unsigned.
+func verifySignature(algorithm string, key crypto.PublicKey, signed []byte, signature []byte) error {
+	var hash crypto.Hash
+	switch algorithm {
+	case "RS256", "PS256", "ES256":
+		hash = crypto.SHA256
+	case "RS384", "PS384", "ES384":
+		hash = crypto.SHA384
+	case "RS512", "PS512", "ES512":
+		hash = crypto.SHA512
+	default:
+		return fmt.Errorf(`unsupported algorithm "%s"`, algorithm)
+	}
+	hasher := hash.New()
+	hasher.Write(signed)
+	digest := hasher.Sum(nil)
+
+	switch publicKey := key.(type) {
+	case *rsa.PublicKey:
+		switch algorithm[0] {
+		case 'R':
+			return rsa.VerifyPKCS1v15(publicKey, hash, digest, signature)
+		case 'P':
+			return rsa.VerifyPSS(publicKey, hash, digest, signature, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash})
+		}
+	case *ecdsa.PublicKey:
+		if algorithm[0] == 'E' {
+			size := (publicKey.Curve.Params().BitSize + 7) / 8
+			if len(signature) != 2*size {
+				return errors.New(`malformed signature`)
+			}
+			r, s := new(big.Int).SetBytes(signature[:size]), new(big.Int).SetBytes(signature[size:])
+			if !ecdsa.Verify(publicKey, digest, r, s) {
+				return errors.New(`signature does not match`)
+			}
+			return nil
+		}
+	}
+	return fmt.Errorf(`algorithm "%s" does not suit the signing key`, algorithm)
+}
+
+// hasAudience reports whether an aud claim, a string or an array of them,
+// names an audience.
+func hasAudience(claim interface{}, audience string) bool {
+	switch claim := claim.(type) {
+	case string:
+		return claim == audience
+	case []interface{}:
+		for _, element := range claim {
+			if element == audience {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// verifyToken checks the signature of a compact JWT against the issuer's
+// keys, then that it was issued by the issuer, for the audience, and is valid
+// at now give or take the leeway, returning its claims.
+func verifyToken(oidc config.OIDC, token string, now time.Time) (map[string]interface{}, error) {
+	invalid := func(format string, arguments ...interface{}) error {
+		return fmt.Errorf(`%w: %s`, ErrInvalidToken, fmt.Sprintf(format, arguments...))
+	}
+
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, invalid(`not a compact JWT`)
+	}
+	headerBytes, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, invalid(`malformed header`)
+	}
+	var header tokenHeader
+	if err := json.Unmarshal(headerBytes, &header); err != nil {
+		return nil, invalid(`malformed header`)
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, invalid(`malformed signature`)
+	}
+
+	key, err := signingKey(oidc, header.KeyId)
+	if err != nil {
+		return nil, err
+	}
+	if err := verifySignature(header.Algorithm, key, []byte(parts[0]+"."+parts[1]), signature); err != nil {
+		return nil, invalid(`%v`, err)
+	}
+
+	payloadBytes, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, invalid(`malformed claims`)
+	}
+	decoder := json.NewDecoder(bytes.NewReader(payloadBytes))
+	decoder.UseNumber()
+	var claims map[string]interface{}
+	if err := decoder.Decode(&claims); err != nil {
+		return nil, invalid(`malformed claims`)
+	}
+
+	if claims["iss"] != oidc.Issuer {
+		return nil, invalid(`issued by "%v", not "%s"`, claims["iss"], oidc.Issuer)
+	}
+	if !hasAudience(claims["aud"], oidc.Audience) {
+		return nil, invalid(`not issued for audience "%s"`, oidc.Audience)
+	}
+	leeway := int64(oidc.Leeway.Duration / time.Second)
+	expiresAt, err := numericDate(claims["exp"])
+	if err != nil {
+		return nil, invalid(`exp: %v`, err)
+	}
+	if now.Unix() > expiresAt+leeway {
+		return nil, invalid(`expired at %s`, time.Unix(expiresAt, 0).UTC().Format(time.RFC3339))
+	}
+	if _, hasNotBefore := claims["nbf"]; hasNotBefore {
+		notBefore, err := numericDate(claims["nbf"])
+		if err != nil {
+			return nil, invalid(`nbf: %v`, err)
+		}
+		if now.Unix()+leeway < notBefore {
+			return nil, invalid(`not valid before %s`, time.Unix(notBefore, 0).UTC().Format(time.RFC3339))
+		}
+	}
+	return claims, nil
+}
+
+// numericDate reads a claim of seconds since the epoch, which may carry a
+// fraction.
+func numericDate(claim interface{}) (int64, error) {
+	number, isNumber := claim.(json.Number)
+	if !isNumber {
+		return 0, errors.New(`must be a number of seconds`)
+	}
+	seconds, err := number.Float64()
+	if err != nil {
+		return 0, errors.New(`must be a number of seconds`)
+	}
+	return int64(seconds), nil
+}
@@ -0,0 +1,182 @@
+package auth
+
+import (
+	"crypto"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/config"
+)
+
+// keysRefetchInterval bounds how often tokens naming unknown keys make the
+// keys be fetched again, so forged tokens cannot flood the issuer.
+const keysRefetchInterval = time.Minute
+
+var issuerClient = &http.Client{Timeout: 10 * time.Second}
+
+// oidcProvider recognizes bearer tokens in the Authorization header, issued
+// by the configured OpenID Connect provider, such as Azure AD or Keycloak.
+type oidcProvider struct{}
+
+func (oidcProvider) Authenticate(request *http.Request) (*Identity, error) {
+	scheme, token, hasToken := strings.Cut(request.Header.Get("Authorization"), " ")
+	if !hasToken || !strings.EqualFold(scheme, "Bearer") {
+		return nil, nil
+	}
+
+	oidc := config.Current.Authentication.OIDC
+	if oidc.Issuer == "" {
+		return nil, fmt.Errorf(`%w: no issuer is configured`, ErrInvalidToken)
+	}
+	claims, err := verifyToken(oidc, strings.TrimSpace(token), time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	subject, _ := claims["sub"].(string)
+	if subject == "" {
+		return nil, fmt.Errorf(`%w: missing subject`, ErrInvalidToken)
+	}
+	roles := append([]string(nil), oidc.DefaultRoles...)
+	for _, group := range groupsOf(claims, oidc.GroupsClaim) {
+		roles = append(roles, oidc.GroupRoles[group]...)
+	}
+	return &Identity{Provider: ProviderOIDC, Subject: subject, Roles: roles}, nil
+}
+
+// groupsOf reads the groups a token lists under a claim, which may be dotted
+// to reach into nested claims, such as Keycloak's "realm_access.roles".
+func groupsOf(claims map[string]interface{}, groupsClaim string) []string {
+	var value interface{} = claims
+	for _, name := range strings.Split(groupsClaim, ".") {
+		object, isObject := value.(map[string]interface{})
+		if !isObject {
+			return nil
+		}
+		value = object[name]
+	}
+
+	switch value := value.(type) {
+	case string:
+		return []string{value}
+	case []interface{}:
+		groups := make([]string, 0, len(value))
+		for _, element := range value {
+			if group, isString := element.(string); isString {
+				groups = append(groups, group)
+			}
+		}
+		return groups
+	default:
+		return nil
+	}
+}
+
+var (
+	keysMutex sync.Mutex
+	// keys are those of keysIssuer, by key id
+	keys          map[string]crypto.PublicKey
+	keysIssuer    string
+	keysFetchedAt time.Time
+	keysAttemptAt time.Time
+)
+
+// signingKey returns the issuer's key a token names, fetching the issuer's
+// keys when they are missing, stale, or lack that key.
+func signingKey(oidc config.OIDC, keyId string) (crypto.PublicKey, error) {
+	keysMutex.Lock()
+	defer keysMutex.Unlock()
+
+	now := time.Now()
+	key, hasKey := lookupKey(oidc.Issuer, keyId)
+	stale := keysIssuer != oidc.Issuer || now.Sub(keysFetchedAt) > oidc.KeysRefresh.Duration
+	if (stale || !hasKey) && now.Sub(keysAttemptAt) > keysRefetchInterval {
+		keysAttemptAt = now
+		fetchedKeys, err := fetchKeys(oidc.Issuer)
+		if err != nil && keysIssuer != oidc.Issuer {
+			return nil, err
+		}
+		// Otherwise the keys already known serve on while the issuer is unreachable
+		if err == nil {
+			keys, keysIssuer, keysFetchedAt = fetchedKeys, oidc.Issuer, now
+			key, hasKey = lookupKey(oidc.Issuer, keyId)
+		}
+	}
+	if keysIssuer != oidc.Issuer {
+		return nil, fmt.Errorf(`%w: keys of "%s" not fetched yet`, ErrIssuerUnavailable, oidc.Issuer)
+	}
+	if !hasKey {
+		return nil, fmt.Errorf(`%w: unknown signing key "%s"`, ErrInvalidToken, keyId)
+	}
+	return key, nil
+}
+
+// lookupKey finds a key of an issuer by id, or its only key for tokens naming
+// none. The keys must be locked.
+func lookupKey(issuer string, keyId string) (crypto.PublicKey, bool) {
+	if keysIssuer != issuer {
+		return nil, false
+	}
+	if keyId == "" && len(keys) == 1 {
+		for _, key := range keys {
+			return key, true
+		}
+	}
+	key, hasKey := keys[keyId]
+	return key, hasKey
+}
+
+type discoveryDocument struct {
+	Issuer  string `json:"issuer"`
+	KeysURI string `json:"jwks_uri"`
+}
+
+type keySet struct {
+	Keys []*jsonWebKey `json:"keys"`
+}
+
+func getJSON(address string, data interface{}) error {
+	response, err := issuerClient.Get(address)
+	if err != nil {
+		return fmt.Errorf(`%w: %v`, ErrIssuerUnavailable, err)
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf(`%w: %s answered %s`, ErrIssuerUnavailable, address, response.Status)
+	}
+	if err := json.NewDecoder(response.Body).Decode(data); err != nil {
+		return fmt.Errorf(`%w: unable to parse %s: %v`, ErrIssuerUnavailable, address, err)
+	}
+	return nil
+}
+
+// fetchKeys reads the signing keys of an issuer, found through its discovery
+// document. Keys of types or curves not supported are skipped.
+func fetchKeys(issuer string) (map[string]crypto.PublicKey, error) {
+	var discovery discoveryDocument
+	if err := getJSON(strings.TrimSuffix(issuer, "/")+"/.well-known/openid-configuration", &discovery); err != nil {
+		return nil, err
+	}
+	if discovery.Issuer != issuer {
+		return nil, fmt.Errorf(`%w: discovery document is for issuer "%s"`, ErrIssuerUnavailable, discovery.Issuer)
+	}
+
+	var set keySet
+	if err := getJSON(discovery.KeysURI, &set); err != nil {
+		return nil, err
+	}
+	fetchedKeys := make(map[string]crypto.PublicKey, len(set.Keys))
+	for _, webKey := range set.Keys {
+		if webKey.Use != "" && webKey.Use != "sig" {
+			continue
+		}
+		if key, err := webKey.publicKey(); err == nil {
+			fetchedKeys[webKey.KeyId] = key
+		}
+	}
+	return fetchedKeys, nil
+}
@@ -0,0 +1,191 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/config"
+)
+
+func encodeSegment(value interface{}) string {
+	valueBytes, _ := json.Marshal(value)
+	return base64.RawURLEncoding.EncodeToString(valueBytes)
+}
+
+// signToken builds a compact JWT of claims whose header names algorithm and
+// keyId, signed by signer with RS256 or ES256 by the kind of key it is.
+func signToken(t *testing.T, algorithm string, keyId string, signer crypto.Signer, claims map[string]interface{}) string {
+	signed := encodeSegment(map[string]string{"alg": algorithm, "kid": keyId, "typ": "JWT"}) + "." + encodeSegment(claims)
+	digest := sha256.Sum256([]byte(signed))
+	var signature []byte
+	switch key := signer.(type) {
+	case *rsa.PrivateKey:
+		var err error
+		if signature, err = rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:]); err != nil {
+			t.Fatal(err)
+		}
+	case *ecdsa.PrivateKey:
+		r, s, err := ecdsa.Sign(rand.Reader, key, digest[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		signature = make([]byte, 64)
+		r.FillBytes(signature[:32])
+		s.FillBytes(signature[32:])
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func encodeInteger(integer *big.Int) string {
+	return base64.RawURLEncoding.EncodeToString(integer.Bytes())
+}
+
+// serveIssuer answers the discovery document and keys of an issuer holding
+// rsaKey as "rsa" and ecKey as "ec".
+func serveIssuer(t *testing.T, rsaKey *rsa.PrivateKey, ecKey *ecdsa.PrivateKey) *httptest.Server {
+	var issuer *httptest.Server
+	issuer = httptest.NewServer(http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+		switch request.URL.Path {
+		case "/.well-known/openid-configuration":
+			json.NewEncoder(response).Encode(discoveryDocument{Issuer: issuer.URL, KeysURI: issuer.URL + "/keys"})
+		case "/keys":
+			json.NewEncoder(response).Encode(keySet{Keys: []*jsonWebKey{
+				{KeyType: "RSA", KeyId: "rsa", Use: "sig", Modulus: encodeInteger(rsaKey.N), Exponent: encodeInteger(big.NewInt(int64(rsaKey.E)))},
+				{KeyType: "EC", KeyId: "ec", Curve: "P-256", X: encodeInteger(ecKey.X), Y: encodeInteger(ecKey.Y)},
+			}})
+		default:
+			response.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(issuer.Close)
+	return issuer
+}
+
+func TestBearerTokens(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	issuer := serveIssuer(t, rsaKey, ecKey)
+
+	previousOIDC := config.Current.Authentication.OIDC
+	defer func() { config.Current.Authentication.OIDC = previousOIDC }()
+	config.Current.Authentication.OIDC = config.OIDC{
+		Issuer:       issuer.URL,
+		Audience:     "kcf",
+		GroupsClaim:  "realm_access.roles",
+		GroupRoles:   map[string][]string{"maintenance": {config.RoleOperator}},
+		DefaultRoles: []string{config.RoleViewer},
+		KeysRefresh:  config.Duration{Duration: time.Hour},
+		Leeway:       config.Duration{Duration: time.Minute},
+	}
+	keysMutex.Lock()
+	keysAttemptAt = time.Time{}
+	keysMutex.Unlock()
+
+	now := time.Now()
+	claimsWith := func(changes map[string]interface{}) map[string]interface{} {
+		claims := map[string]interface{}{
+			"iss":          issuer.URL,
+			"aud":          []string{"account", "kcf"},
+			"sub":          "technician",
+			"exp":          now.Add(time.Hour).Unix(),
+			"realm_access": map[string]interface{}{"roles": []string{"maintenance"}},
+		}
+		for claim, value := range changes {
+			if value == nil {
+				delete(claims, claim)
+			} else {
+				claims[claim] = value
+			}
+		}
+		return claims
+	}
+	authenticate := func(token string) (*Identity, error) {
+		request := httptest.NewRequest("GET", "/api/hardware", nil)
+		request.Header.Set("Authorization", "Bearer "+token)
+		return Authenticate(request)
+	}
+
+	for what, token := range map[string]string{
+		"an RS256 token":                  signToken(t, "RS256", "rsa", rsaKey, claimsWith(nil)),
+		"an ES256 token":                  signToken(t, "ES256", "ec", ecKey, claimsWith(nil)),
+		"a token expired within leeway":   signToken(t, "RS256", "rsa", rsaKey, claimsWith(map[string]interface{}{"exp": now.Add(-30 * time.Second).Unix()})),
+		"a token not yet valid by leeway": signToken(t, "RS256", "rsa", rsaKey, claimsWith(map[string]interface{}{"nbf": now.Add(30 * time.Second).Unix()})),
+	} {
+		identity, err := authenticate(token)
+		if err != nil {
+			t.Errorf(`%s was refused: %v`, what, err)
+			continue
+		}
+		if identity.Provider != ProviderOIDC || identity.Subject != "technician" || !Allows(identity, config.RoleOperator) || Allows(identity, config.RoleAdmin) {
+			t.Errorf(`%s was identified as %+v`, what, identity)
+		}
+	}
+
+	unsigned := encodeSegment(map[string]string{"alg": "none", "kid": "rsa"}) + "." + encodeSegment(claimsWith(nil)) + "."
+	for what, token := range map[string]string{
+		"an unsigned token":            unsigned,
+		"a token of a symmetric alg":   signToken(t, "HS256", "rsa", rsaKey, claimsWith(nil)),
+		"an alg not suiting its key":   signToken(t, "ES256", "rsa", ecKey, claimsWith(nil)),
+		"a token of another key":       signToken(t, "RS256", "rsa", ecKey, claimsWith(nil)),
+		"a token of another issuer":    signToken(t, "RS256", "rsa", rsaKey, claimsWith(map[string]interface{}{"iss": "https://elsewhere.example"})),
+		"a token for another audience": signToken(t, "RS256", "rsa", rsaKey, claimsWith(map[string]interface{}{"aud": "account"})),
+		"a token without expiry":       signToken(t, "RS256", "rsa", rsaKey, claimsWith(map[string]interface{}{"exp": nil})),
+		"an expired token":             signToken(t, "RS256", "rsa", rsaKey, claimsWith(map[string]interface{}{"exp": now.Add(-2 * time.Minute).Unix()})),
+		"a token not yet valid":        signToken(t, "RS256", "rsa", rsaKey, claimsWith(map[string]interface{}{"nbf": now.Add(2 * time.Minute).Unix()})),
+		"a token without subject":      signToken(t, "RS256", "rsa", rsaKey, claimsWith(map[string]interface{}{"sub": nil})),
+		"a token of an unknown key":    signToken(t, "RS256", "unknown", rsaKey, claimsWith(nil)),
+		"a malformed token":            "not.a-token",
+	} {
+		if identity, err := authenticate(token); !errors.Is(err, ErrInvalidToken) {
+			t.Errorf(`%s gave %+v and %v`, what, identity, err)
+		}
+	}
+}
+
+func TestAnonymousRolesNarrowWithProviders(t *testing.T) {
+	previousAuthentication := config.Current.Authentication
+	defer func() { config.Current.Authentication = previousAuthentication }()
+
+	config.Current.Authentication = config.Authentication{}
+	if !Allows(nil, config.RoleAdmin) {
+		t.Errorf(`anonymous requests lost admin without any provider configured`)
+	}
+	config.Current.Authentication.OIDC.Issuer = "https://issuer.example"
+	if Allows(nil, config.RoleOperator) || !Allows(nil, config.RoleViewer) {
+		t.Errorf(`anonymous requests were granted %v with an issuer configured`, config.Current.Authentication.Anonymous())
+	}
+	config.Current.Authentication.AnonymousRoles = []string{}
+	if Allows(nil, config.RoleViewer) {
+		t.Errorf(`anonymous requests were granted viewer with no anonymous roles`)
+	}
+
+	configured := config.Default()
+	configured.Authentication.APIKeys = map[string][]string{"key": {config.RoleAdmin}}
+	configured.Authentication.AnonymousRoles = []string{config.RoleViewer}
+	if err := configured.Validate(); err != nil {
+		t.Errorf(`anonymous viewers alongside API keys were refused: %v`, err)
+	}
+	configured.Authentication.AnonymousRoles = []string{config.RoleViewer, config.RoleAdmin}
+	if err := configured.Validate(); err == nil || !strings.Contains(err.Error(), "authentication.anonymousRoles") {
+		t.Errorf(`anonymous admins alongside API keys gave %v`, err)
+	}
+}
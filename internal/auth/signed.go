@@ -0,0 +1,178 @@
+package auth
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/config"
+)
+
+var (
+	ErrInvalidSignature = errors.New(`invalid request signature`)
+	// ErrReplayedSignature refuses a signed request that was already
+	// accepted once.
+	ErrReplayedSignature = errors.New(`request signature was already used`)
+	// ErrSignedRoute refuses a signature on a route or method it does not
+	// reach.
+	ErrSignedRoute = errors.New(`signed requests only reach the ingestion routes, with POST`)
+	// ErrSignedBodyTooLarge refuses a signed request whose body is too large
+	// to be read whole and checked.
+	ErrSignedBodyTooLarge = errors.New(`signed request body too large`)
+)
+
+// The headers a signed request carries. SignatureNonceHeader is optional,
+// letting a gateway send the same body twice within a second.
+const (
+	GatewayIdHeader          = "X-Gateway-Id"
+	SignatureTimestampHeader = "X-Signature-Timestamp"
+	SignatureNonceHeader     = "X-Signature-Nonce"
+	SignatureHeader          = "X-Signature"
+)
+
+// signedRoutes are the routes signed requests reach.
+var signedRoutes = []string{"/api/ingest", "/api/hardware/*/samples"}
+
+// canonicalRequest is what a signature covers, a line each: the method, the
+// path, the raw query, the timestamp in Unix seconds, the nonce and the hex
+// SHA-256 of the body.
+func canonicalRequest(method string, requestPath string, rawQuery string, timestamp string, nonce string, body []byte) string {
+	bodyHash := sha256.Sum256(body)
+	return method + "\n" + requestPath + "\n" + rawQuery + "\n" + timestamp + "\n" + nonce + "\n" + hex.EncodeToString(bodyHash[:])
+}
+
+func requestSignatureOf(secret string, canonical string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(canonical))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// SignRequest signs a request, whose body it reads and replaces, as gateway
+// gatewayId holding secret at now, with an optional nonce.
+func SignRequest(request *http.Request, gatewayId string, secret string, nonce string, now time.Time) error {
+	var body []byte
+	if request.Body != nil {
+		var err error
+		if body, err = io.ReadAll(request.Body); err != nil {
+			return err
+		}
+		request.Body.Close()
+		request.Body = io.NopCloser(bytes.NewReader(body))
+	}
+
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+	request.Header.Set(GatewayIdHeader, gatewayId)
+	request.Header.Set(SignatureTimestampHeader, timestamp)
+	if nonce != "" {
+		request.Header.Set(SignatureNonceHeader, nonce)
+	}
+	request.Header.Set(SignatureHeader, requestSignatureOf(secret, canonicalRequest(request.Method, request.URL.Path, request.URL.RawQuery, timestamp, nonce, body)))
+	return nil
+}
+
+var (
+	signaturesMutex sync.Mutex
+	// signaturesSeen are the signatures accepted, until they would be too
+	// old to be accepted anyway.
+	signaturesSeen map[string]time.Time = make(map[string]time.Time)
+	// signaturesPruned is when signaturesSeen last dropped the expired ones
+	signaturesPruned time.Time
+)
+
+// acceptSignatureOnce records a signature as used until expiresAt, returning
+// false if it already was.
+func acceptSignatureOnce(signature string, expiresAt time.Time, now time.Time) bool {
+	signaturesMutex.Lock()
+	defer signaturesMutex.Unlock()
+
+	if now.Sub(signaturesPruned) >= time.Second {
+		for seenSignature, seenExpiresAt := range signaturesSeen {
+			if !now.Before(seenExpiresAt) {
+				delete(signaturesSeen, seenSignature)
+			}
+		}
+		signaturesPruned = now
+	}
+	if seenExpiresAt, isSeen := signaturesSeen[signature]; isSeen && now.Before(seenExpiresAt) {
+		return false
+	}
+	signaturesSeen[signature] = expiresAt
+	return true
+}
+
+// signedRequestProvider recognizes requests gateways signed with their shared
+// secret, for edge devices that cannot do TLS client authentication. The
+// body is read whole to be checked, then handed on as it was.
+type signedRequestProvider struct{}
+
+func (signedRequestProvider) Authenticate(request *http.Request) (*Identity, error) {
+	signature := request.Header.Get(SignatureHeader)
+	if signature == "" {
+		return nil, nil
+	}
+
+	signedRequests := config.Current.Authentication.SignedRequests
+	if len(signedRequests.Gateways) == 0 {
+		return nil, fmt.Errorf(`%w: signed requests are disabled`, ErrInvalidSignature)
+	}
+	gatewayId := request.Header.Get(GatewayIdHeader)
+	secret, isGateway := signedRequests.Gateways[gatewayId]
+	if !isGateway {
+		return nil, fmt.Errorf(`%w: unknown gateway "%s"`, ErrInvalidSignature, gatewayId)
+	}
+
+	timestamp := request.Header.Get(SignatureTimestampHeader)
+	timestampSeconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf(`%w: malformed timestamp "%s"`, ErrInvalidSignature, timestamp)
+	}
+	now := time.Now()
+	signedAt := time.Unix(timestampSeconds, 0)
+	if skew := now.Sub(signedAt); skew > signedRequests.MaxClockSkew.Duration || -skew > signedRequests.MaxClockSkew.Duration {
+		return nil, fmt.Errorf(`%w: signed at %s, more than %v from the server's clock`, ErrInvalidSignature, signedAt.UTC().Format(time.RFC3339), signedRequests.MaxClockSkew.Duration)
+	}
+
+	var body []byte
+	if request.Body != nil {
+		if body, err = io.ReadAll(io.LimitReader(request.Body, signedRequests.MaxBodyBytes+1)); err != nil {
+			return nil, err
+		}
+		request.Body.Close()
+		if int64(len(body)) > signedRequests.MaxBodyBytes {
+			return nil, fmt.Errorf(`%w: over %d bytes`, ErrSignedBodyTooLarge, signedRequests.MaxBodyBytes)
+		}
+		request.Body = io.NopCloser(bytes.NewReader(body))
+	}
+	nonce := request.Header.Get(SignatureNonceHeader)
+	expected := requestSignatureOf(secret, canonicalRequest(request.Method, request.URL.Path, request.URL.RawQuery, timestamp, nonce, body))
+	if !hmac.Equal([]byte(signature), []byte(expected)) {
+		return nil, fmt.Errorf(`%w: bad signature`, ErrInvalidSignature)
+	}
+
+	if request.Method != "POST" || !isSignedRoute(request.URL.Path) {
+		return nil, ErrSignedRoute
+	}
+	// A signature stays usable until its timestamp is too old, so is kept past that
+	if !acceptSignatureOnce(gatewayId+"\n"+signature, signedAt.Add(signedRequests.MaxClockSkew.Duration+time.Second), now) {
+		return nil, ErrReplayedSignature
+	}
+	return &Identity{Provider: ProviderGateway, Subject: gatewayId, Roles: []string{config.RoleOperator}}, nil
+}
+
+func isSignedRoute(requestPath string) bool {
+	for _, route := range signedRoutes {
+		if matched, _ := path.Match(route, requestPath); matched {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,54 @@
+package auth
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/config"
+)
+
+func TestSignedRequests(t *testing.T) {
+	signedRequests := &config.Current.Authentication.SignedRequests
+	signedRequests.Gateways = map[string]string{"test_gateway": "test-shared-secret"}
+	defer func() { signedRequests.Gateways = nil }()
+
+	signed := func(method string, target string, body string, secret string, signedAt time.Time) *http.Request {
+		request := httptest.NewRequest(method, target, strings.NewReader(body))
+		SignRequest(request, "test_gateway", secret, "", signedAt)
+		return request
+	}
+	request := signed("POST", "/api/ingest?hardwareId=test_fan", "timestamp,temperature\n", "test-shared-secret", time.Now())
+	identity, err := Authenticate(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if identity == nil || identity.Provider != ProviderGateway || !Allows(identity, config.RoleOperator) {
+		t.Errorf(`a signed ingestion was identified as %+v`, identity)
+	}
+	if body, _ := io.ReadAll(request.Body); string(body) != "timestamp,temperature\n" {
+		t.Errorf(`the body was handed on as "%s"`, body)
+	}
+	request.Body = io.NopCloser(strings.NewReader("timestamp,temperature\n"))
+	if _, err := Authenticate(request); !errors.Is(err, ErrReplayedSignature) {
+		t.Errorf(`a replayed signature gave %v`, err)
+	}
+
+	tampered := signed("POST", "/api/ingest", "timestamp,temperature\n", "test-shared-secret", time.Now())
+	tampered.Body = io.NopCloser(strings.NewReader("timestamp,temperature\n0,99\n"))
+	for what, refused := range map[string]*http.Request{
+		"a tampered body":      tampered,
+		"a wrong secret":       signed("POST", "/api/ingest", "", "another-shared-secret", time.Now()),
+		"a stale timestamp":    signed("POST", "/api/ingest", "", "test-shared-secret", time.Now().Add(-time.Hour)),
+		"a future timestamp":   signed("POST", "/api/ingest", "", "test-shared-secret", time.Now().Add(time.Hour)),
+		"a route not ingested": signed("GET", "/api/hardware", "", "test-shared-secret", time.Now()),
+	} {
+		if identity, err := Authenticate(refused); err == nil {
+			t.Errorf(`%s was identified as %+v`, what, identity)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+// Package fixtures writes the sample tree the self-test and the package tests
+// run against: one hardware reporting a temperature ramping by one degree per
+// minute from 20 to 79, and a constant RMS velocity of 1.5, starting at Start.
+package fixtures
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/hardware"
+)
+
+const (
+	HardwareId = "selftest_fan"
+
+	// Minutes is how many samples the hardware has, one a minute.
+	Minutes = 60
+)
+
+var Start = time.UnixMilli(1656633600000)
+
+// Minute is minutes into the fixtures.
+func Minute(minutes float64) time.Time {
+	return Start.Add(time.Duration(minutes * float64(time.Minute)))
+}
+
+// Write writes the sample tree into directory.
+func Write(directory string) error {
+	hardwarePath := filepath.Join(directory, HardwareId)
+	if err := os.MkdirAll(hardwarePath, 0755); err != nil {
+		return err
+	}
+
+	var temperature, rmsVelocityX strings.Builder
+	for minute := 0; minute < Minutes; minute++ {
+		timestamp := strconv.FormatInt(Minute(float64(minute)).UnixMilli(), 10)
+		fmt.Fprintf(&temperature, "%s,%d\n", timestamp, 20+minute)
+		fmt.Fprintf(&rmsVelocityX, "%s,1.5\n", timestamp)
+	}
+	if err := os.WriteFile(filepath.Join(hardwarePath, "temperature.csv"), []byte(temperature.String()), 0644); err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(hardwarePath, "rms_velocity_x.csv"), []byte(rmsVelocityX.String()), 0644)
+}
+
+// Directory is the temporary directory Load last wrote the sample tree into,
+// under "samples", beside which the stores keep their files.
+var Directory string
+
+// Load writes the sample tree into a new temporary directory and loads it,
+// returning a function that removes the directory again.
+func Load() (func(), error) {
+	directory, err := os.MkdirTemp("", "fixtures-*")
+	if err != nil {
+		return nil, err
+	}
+	remove := func() { os.RemoveAll(directory) }
+	Directory = directory
+
+	samplesPath := filepath.Join(directory, "samples")
+	if err := Write(samplesPath); err != nil {
+		remove()
+		return nil, err
+	}
+	if err := hardware.PopulateSamplesFrom(samplesPath); err != nil {
+		remove()
+		return nil, err
+	}
+	return remove, nil
+}
+
+// Main loads the sample tree around the tests of a package, for its TestMain
+// to hand its m.Run to, and exits with their result.
+func Main(run func() int) {
+	remove, err := Load()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	code := run()
+	remove()
+	os.Exit(code)
+}
@@ -0,0 +1,211 @@
+// Package invalidation keeps replicas that share a storage backend in step:
+// each publishes the spans of readings it ingests over Redis pub/sub, and
+// reloads the spans the others publish from the backend. The file backend is
+// the one replicas can share. Reloaded values are journaled like ingested
+// ones, so as-of queries reach back across a reload.
+package invalidation
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/config"
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/hardware"
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/metrics"
+)
+
+const (
+	pendingLimit   = 1024
+	reconnectDelay = 5 * time.Second
+)
+
+// message announces that a replica changed a span of a hardware's samples.
+type message struct {
+	Origin     string    `json:"origin"`
+	HardwareId string    `json:"hardwareId"`
+	From       time.Time `json:"from"`
+	To         time.Time `json:"to"`
+}
+
+var (
+	// origin tells this replica's own messages apart when they come back.
+	origin  string
+	pending chan *message
+
+	publishedCounter = metrics.NewCounter("invalidation_published_total")
+	droppedCounter   = metrics.NewCounter("invalidation_dropped_total")
+	receivedCounter  = metrics.NewCounter("invalidation_received_total")
+)
+
+func newOrigin() string {
+	originBytes := make([]byte, 8)
+	rand.Read(originBytes)
+	return hex.EncodeToString(originBytes)
+}
+
+// Start publishes every change to the working set and applies the changes of
+// other replicas until ctx is done. It does nothing without an address.
+func Start(ctx context.Context, settings config.Invalidation) error {
+	if settings.Address == "" {
+		return nil
+	}
+
+	origin = newOrigin()
+	pending = make(chan *message, pendingLimit)
+	hardware.OnChange(func(hardwareId string, from time.Time, to time.Time) {
+		select {
+		case pending <- &message{Origin: origin, HardwareId: hardwareId, From: from, To: to}:
+		default:
+			droppedCounter.Inc()
+		}
+	})
+
+	go publish(ctx, settings)
+	go subscribe(ctx, settings)
+	return nil
+}
+
+func publish(ctx context.Context, settings config.Invalidation) {
+	var redis *redisConnection
+	defer func() {
+		if redis != nil {
+			redis.Close()
+		}
+	}()
+
+	for {
+		var change *message
+		select {
+		case <-ctx.Done():
+			return
+		case change = <-pending:
+		}
+
+		messageBytes, err := json.Marshal(change)
+		if err != nil {
+			continue
+		}
+
+		// One reconnect per message, so a dead server costs messages, not memory
+		for attempt := 0; attempt < 2; attempt++ {
+			if redis == nil {
+				if redis, err = dialRedis(settings.Address, settings.Password); err != nil {
+					redis = nil
+					break
+				}
+			}
+			if _, err = redis.command("PUBLISH", settings.Channel, string(messageBytes)); err == nil {
+				break
+			}
+			redis.Close()
+			redis = nil
+		}
+		if err != nil {
+			droppedCounter.Inc()
+			log.Printf("invalidation: unable to publish change of hardware \"%s\": %v\n", change.HardwareId, err)
+			continue
+		}
+		publishedCounter.Inc()
+	}
+}
+
+func subscribe(ctx context.Context, settings config.Invalidation) {
+	// Changes published while disconnected are lost, so everything since the
+	// connection dropped is reloaded once it is back
+	var disconnectedAt time.Time
+	for {
+		if err := listen(ctx, settings, disconnectedAt); err != nil {
+			log.Printf("invalidation: %v\n", err)
+		}
+		disconnectedAt = time.Now()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(reconnectDelay):
+		}
+	}
+}
+
+func listen(ctx context.Context, settings config.Invalidation, disconnectedAt time.Time) error {
+	redis, err := dialRedis(settings.Address, settings.Password)
+	if err != nil {
+		return err
+	}
+	defer redis.Close()
+
+	listening := make(chan struct{})
+	defer close(listening)
+	go func() {
+		select {
+		case <-ctx.Done():
+			redis.Close()
+		case <-listening:
+		}
+	}()
+
+	if err := redis.send("SUBSCRIBE", settings.Channel); err != nil {
+		return err
+	}
+	if !disconnectedAt.IsZero() {
+		catchUp(disconnectedAt)
+	}
+
+	for {
+		reply, err := redis.receive()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+
+		elements, isArray := reply.([]interface{})
+		if !isArray || len(elements) != 3 || elements[0] != "message" {
+			continue
+		}
+		payload, _ := elements[2].(string)
+
+		var change message
+		if err := json.Unmarshal([]byte(payload), &change); err != nil || change.Origin == origin {
+			continue
+		}
+		receivedCounter.Inc()
+		refresh(change.HardwareId, change.From, change.To)
+	}
+}
+
+// catchUp reloads everything since the connection dropped, of every hardware
+// the backend holds, as well as those held here, so hardware another replica
+// added meanwhile is picked up too.
+func catchUp(disconnectedAt time.Time) {
+	hardwareIds := hardware.HardwareIds()
+	storedHardwareIds, err := hardware.StoredHardwareIds()
+	if err != nil {
+		log.Printf("invalidation: unable to list stored hardware: %v\n", err)
+	}
+	isKnown := make(map[string]bool, len(hardwareIds))
+	for _, hardwareId := range hardwareIds {
+		isKnown[hardwareId] = true
+	}
+	for _, hardwareId := range storedHardwareIds {
+		if !isKnown[hardwareId] {
+			hardwareIds = append(hardwareIds, hardwareId)
+		}
+	}
+
+	catchUpTo := time.Now().Add(config.Current.Ingestion.MaxFutureSkew.Duration)
+	for _, hardwareId := range hardwareIds {
+		refresh(hardwareId, disconnectedAt, catchUpTo)
+	}
+}
+
+func refresh(hardwareId string, from time.Time, to time.Time) {
+	if err := hardware.Refresh(hardwareId, from, to); err != nil {
+		log.Printf("invalidation: unable to reload hardware \"%s\": %v\n", hardwareId, err)
+	}
+}
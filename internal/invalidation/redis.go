@@ -0,0 +1,127 @@
+package invalidation
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"time"
+)
+
+const (
+	dialTimeout = 5 * time.Second
+
+	// Replies past these lengths are refused rather than allocated for: the
+	// messages on the channel are a few hundred bytes, and pub/sub replies
+	// are arrays of three.
+	maxBulkLength  = 4 << 10
+	maxArrayLength = 8
+)
+
+// redisConnection speaks just enough of the Redis protocol to publish and
+// subscribe.
+type redisConnection struct {
+	connection net.Conn
+	reader     *bufio.Reader
+}
+
+func dialRedis(address string, password string) (*redisConnection, error) {
+	connection, err := net.DialTimeout("tcp", address, dialTimeout)
+	if err != nil {
+		return nil, err
+	}
+
+	redis := &redisConnection{connection: connection, reader: bufio.NewReader(connection)}
+	if password != "" {
+		if _, err := redis.command("AUTH", password); err != nil {
+			connection.Close()
+			return nil, err
+		}
+	}
+	return redis, nil
+}
+
+func (redis *redisConnection) send(arguments ...string) error {
+	command := []byte(fmt.Sprintf("*%d\r\n", len(arguments)))
+	for _, argument := range arguments {
+		command = append(command, fmt.Sprintf("$%d\r\n%s\r\n", len(argument), argument)...)
+	}
+	_, err := redis.connection.Write(command)
+	return err
+}
+
+func (redis *redisConnection) command(arguments ...string) (interface{}, error) {
+	if err := redis.send(arguments...); err != nil {
+		return nil, err
+	}
+	return redis.receive()
+}
+
+// receive reads one reply: a string, an int64, a []interface{} or nil. Error
+// replies are returned as errors. Arrays are not nested.
+func (redis *redisConnection) receive() (interface{}, error) {
+	return redis.receiveNested(false)
+}
+
+func (redis *redisConnection) receiveNested(isNested bool) (interface{}, error) {
+	// Read within the buffer, so a line that never ends is refused too
+	lineBytes, err := redis.reader.ReadSlice('\n')
+	if err != nil {
+		return nil, err
+	}
+	line := string(lineBytes)
+	if len(line) < 3 || line[len(line)-2] != '\r' {
+		return nil, fmt.Errorf(`malformed redis reply "%s"`, line)
+	}
+	kind, content := line[0], line[1:len(line)-2]
+
+	switch kind {
+	case '+':
+		return content, nil
+	case '-':
+		return nil, fmt.Errorf(`redis: %s`, content)
+	case ':':
+		return strconv.ParseInt(content, 10, 64)
+	case '$':
+		length, err := strconv.Atoi(content)
+		if err != nil {
+			return nil, fmt.Errorf(`malformed redis bulk length "%s"`, content)
+		}
+		if length < 0 {
+			return nil, nil
+		}
+		if length > maxBulkLength {
+			return nil, fmt.Errorf(`redis bulk reply of %d bytes exceeds the %d expected`, length, maxBulkLength)
+		}
+		bulk := make([]byte, length+2)
+		if _, err := io.ReadFull(redis.reader, bulk); err != nil {
+			return nil, err
+		}
+		return string(bulk[:length]), nil
+	case '*':
+		length, err := strconv.Atoi(content)
+		if err != nil {
+			return nil, fmt.Errorf(`malformed redis array length "%s"`, content)
+		}
+		if length < 0 {
+			return nil, nil
+		}
+		if isNested || length > maxArrayLength {
+			return nil, fmt.Errorf(`unexpected redis array reply of %d elements`, length)
+		}
+		elements := make([]interface{}, length)
+		for elementIndex := range elements {
+			if elements[elementIndex], err = redis.receiveNested(true); err != nil {
+				return nil, err
+			}
+		}
+		return elements, nil
+	default:
+		return nil, fmt.Errorf(`unknown redis reply type '%c'`, kind)
+	}
+}
+
+func (redis *redisConnection) Close() error {
+	return redis.connection.Close()
+}
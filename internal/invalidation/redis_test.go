@@ -0,0 +1,43 @@
+package invalidation
+
+import (
+	"bufio"
+	"net"
+	"strings"
+	"testing"
+)
+
+// replying is a connection to a server that answers with replies.
+func replying(replies string) *redisConnection {
+	client, server := net.Pipe()
+	go func() {
+		server.Write([]byte(replies))
+		server.Close()
+	}()
+	return &redisConnection{connection: client, reader: bufio.NewReader(client)}
+}
+
+func TestReceive(t *testing.T) {
+	redis := replying("*3\r\n$7\r\nmessage\r\n$13\r\ninvalidations\r\n$2\r\n{}\r\n")
+	defer redis.Close()
+	reply, err := redis.receive()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if elements, isArray := reply.([]interface{}); !isArray || len(elements) != 3 || elements[0] != "message" || elements[2] != "{}" {
+		t.Errorf(`expected a message, got %v`, reply)
+	}
+
+	for what, replies := range map[string]string{
+		"a bulk reply too long to allocate": "$1073741824\r\n",
+		"an array too long to allocate":     "*1073741824\r\n",
+		"nested arrays":                     "*1\r\n*1\r\n:1\r\n",
+		"a line that never ends":            "+" + strings.Repeat("x", 8192),
+	} {
+		redis := replying(replies)
+		if _, err := redis.receive(); err == nil {
+			t.Errorf(`%s was received`, what)
+		}
+		redis.Close()
+	}
+}
@@ -0,0 +1,144 @@
+// Package lifecycle runs the hooks that flush buffered state when the server
+// shuts down, and reports their progress while it drains.
+package lifecycle
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/config"
+)
+
+const (
+	HookPending = "pending"
+	HookRunning = "running"
+	HookDone    = "done"
+	HookFailed  = "failed"
+)
+
+type HookStatus struct {
+	Name     string          `json:"name"`
+	State    string          `json:"state"`
+	Error    string          `json:"error,omitempty"`
+	Duration config.Duration `json:"duration"`
+}
+
+type DrainStatus struct {
+	Draining bool          `json:"draining"`
+	Started  *time.Time    `json:"started,omitempty"`
+	Hooks    []*HookStatus `json:"hooks"`
+}
+
+type hook struct {
+	name   string
+	run    func(ctx context.Context) error
+	status *HookStatus
+}
+
+var (
+	mutex    sync.Mutex
+	hooks    []*hook
+	started  *time.Time
+	shutDown bool
+	stopping = make(chan struct{})
+)
+
+// OnShutdown registers a hook to run on shutdown. Hooks run one at a time in
+// the reverse order of registration, so whatever was set up first is torn
+// down last.
+func OnShutdown(name string, run func(ctx context.Context) error) {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	hooks = append(hooks, &hook{name: name, run: run, status: &HookStatus{Name: name, State: HookPending}})
+}
+
+// Stopping is closed once shutdown begins, for long-lived work such as
+// streams to wind down on.
+func Stopping() <-chan struct{} {
+	return stopping
+}
+
+func Draining() bool {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	return started != nil
+}
+
+// BeginDrain marks the server as draining, so readiness fails and load
+// balancers stop sending it requests, while it still serves those that
+// arrive meanwhile. Only the first call does anything.
+func BeginDrain() {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	beginDrain()
+}
+
+// beginDrain is BeginDrain for a caller holding mutex.
+func beginDrain() {
+	if started != nil {
+		return
+	}
+	now := time.Now()
+	started = &now
+	close(stopping)
+}
+
+// Shutdown begins draining if that has not begun yet, then runs every hook,
+// even after one fails, and returns the first error. Hooks share ctx, so a
+// deadline bounds the whole of them. Only the first call does anything.
+func Shutdown(ctx context.Context) error {
+	mutex.Lock()
+	if shutDown {
+		mutex.Unlock()
+		return nil
+	}
+	shutDown = true
+	beginDrain()
+	shutdownHooks := append([]*hook(nil), hooks...)
+	mutex.Unlock()
+
+	var firstErr error
+	for hookIndex := len(shutdownHooks) - 1; hookIndex >= 0; hookIndex-- {
+		shutdownHook := shutdownHooks[hookIndex]
+		setState(shutdownHook, HookRunning, nil, 0)
+
+		hookStarted := time.Now()
+		err := shutdownHook.run(ctx)
+		if err != nil {
+			setState(shutdownHook, HookFailed, err, time.Since(hookStarted))
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		setState(shutdownHook, HookDone, nil, time.Since(hookStarted))
+	}
+	return firstErr
+}
+
+func setState(shutdownHook *hook, state string, err error, duration time.Duration) {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	shutdownHook.status.State = state
+	shutdownHook.status.Duration = config.Duration{Duration: duration}
+	if err != nil {
+		shutdownHook.status.Error = err.Error()
+	}
+}
+
+func Status() *DrainStatus {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	status := &DrainStatus{Draining: started != nil, Started: started, Hooks: make([]*HookStatus, 0, len(hooks))}
+	for hookIndex := len(hooks) - 1; hookIndex >= 0; hookIndex-- {
+		hookStatus := *hooks[hookIndex].status
+		status.Hooks = append(status.Hooks, &hookStatus)
+	}
+	return status
+}
@@ -0,0 +1,181 @@
+// Package preferences keeps a small JSON object of named preferences per API
+// key, such as the dashboard's favorite hardware, default window and units,
+// so clients can restore their context across sessions.
+package preferences
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/config"
+)
+
+var (
+	ErrInvalidName = errors.New(`invalid preference name`)
+	ErrTooLarge    = errors.New(`preferences too large`)
+)
+
+// Values are the preferences of one API key, by name. Values are any JSON.
+type Values map[string]json.RawMessage
+
+var namePattern = regexp.MustCompile(`^[A-Za-z0-9_.-]{1,64}$`)
+
+var (
+	mutex sync.Mutex
+	// stored is keyed by ownerOf the API key, so keys are never written out
+	stored     map[string]Values
+	loadedPath string
+	loaded     bool
+)
+
+func ownerOf(apiKey string) string {
+	digest := sha256.Sum256([]byte(apiKey))
+	return hex.EncodeToString(digest[:])
+}
+
+// ensureLoaded reads back the preferences persisted by a previous run, once
+// per configured path.
+func ensureLoaded() error {
+	path := config.Current.Preferences.Path
+	if loaded && loadedPath == path {
+		return nil
+	}
+
+	stored = make(map[string]Values)
+	loaded, loadedPath = true, path
+	if path == "" {
+		return nil
+	}
+	storedBytes, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf(`unable to read preferences "%s": %w`, path, err)
+	}
+	if err := json.Unmarshal(storedBytes, &stored); err != nil {
+		return fmt.Errorf(`unable to parse preferences "%s": %w`, path, err)
+	}
+	return nil
+}
+
+// save writes every API key's preferences to a temporary file first, so a
+// crash mid-write never leaves them truncated.
+func save() error {
+	path := config.Current.Preferences.Path
+	if path == "" {
+		return nil
+	}
+	storedBytes, err := json.Marshal(stored)
+	if err != nil {
+		return err
+	}
+	temporaryPath := filepath.Join(filepath.Dir(path), "."+filepath.Base(path)+".saving")
+	if err := os.WriteFile(temporaryPath, storedBytes, 0600); err != nil {
+		return fmt.Errorf(`unable to save preferences: %w`, err)
+	}
+	if err := os.Rename(temporaryPath, path); err != nil {
+		return fmt.Errorf(`unable to save preferences: %w`, err)
+	}
+	return nil
+}
+
+func copyOf(values Values) Values {
+	valuesCopy := make(Values, len(values))
+	for name, value := range values {
+		valuesCopy[name] = value
+	}
+	return valuesCopy
+}
+
+// store replaces an API key's preferences, forgetting the key altogether
+// when none are left.
+func store(owner string, values Values) error {
+	for name := range values {
+		if !namePattern.MatchString(name) {
+			return fmt.Errorf(`%w "%s": must be 1 to 64 letters, digits, dots, dashes or underscores`, ErrInvalidName, name)
+		}
+	}
+	valuesBytes, err := json.Marshal(values)
+	if err != nil {
+		return err
+	}
+	if maxBytes := config.Current.Preferences.MaxBytes; len(valuesBytes) > maxBytes {
+		return fmt.Errorf(`%w: %d bytes, at most %d are kept per API key`, ErrTooLarge, len(valuesBytes), maxBytes)
+	}
+
+	previousValues, hadValues := stored[owner]
+	if len(values) == 0 {
+		delete(stored, owner)
+	} else {
+		stored[owner] = values
+	}
+	if err := save(); err != nil {
+		if hadValues {
+			stored[owner] = previousValues
+		} else {
+			delete(stored, owner)
+		}
+		return err
+	}
+	return nil
+}
+
+// Get returns the preferences of an API key, empty when it has none.
+func Get(apiKey string) (Values, error) {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	if err := ensureLoaded(); err != nil {
+		return nil, err
+	}
+	return copyOf(stored[ownerOf(apiKey)]), nil
+}
+
+// Replace sets the preferences of an API key to values, dropping any others.
+func Replace(apiKey string, values Values) error {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	if err := ensureLoaded(); err != nil {
+		return err
+	}
+	return store(ownerOf(apiKey), copyOf(values))
+}
+
+// Set changes one preference of an API key, leaving the others as they are.
+func Set(apiKey string, name string, value json.RawMessage) error {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	if err := ensureLoaded(); err != nil {
+		return err
+	}
+	owner := ownerOf(apiKey)
+	values := copyOf(stored[owner])
+	values[name] = value
+	return store(owner, values)
+}
+
+// Delete removes one preference of an API key, reporting whether it had it.
+func Delete(apiKey string, name string) (bool, error) {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	if err := ensureLoaded(); err != nil {
+		return false, err
+	}
+	owner := ownerOf(apiKey)
+	if _, hasValue := stored[owner][name]; !hasValue {
+		return false, nil
+	}
+	values := copyOf(stored[owner])
+	delete(values, name)
+	return true, store(owner, values)
+}
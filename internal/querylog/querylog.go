@@ -0,0 +1,308 @@
+package querylog
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/config"
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/internal/accesslog"
+)
+
+// capturedBodyLimit bounds how much of a request body is kept to find the
+// hardware and window of a query in.
+const capturedBodyLimit = 64 << 10
+
+type Entry struct {
+	Time       time.Time       `json:"time"`
+	Route      string          `json:"route"`
+	HardwareId string          `json:"hardwareId,omitempty"`
+	From       *time.Time      `json:"from,omitempty"`
+	To         *time.Time      `json:"to,omitempty"`
+	Status     int             `json:"status"`
+	Duration   config.Duration `json:"duration"`
+}
+
+// CapturingReadCloser keeps the first part of a request body as it is read,
+// without the handler noticing.
+type CapturingReadCloser struct {
+	io.ReadCloser
+	Captured bytes.Buffer
+}
+
+func (reader *CapturingReadCloser) Read(data []byte) (int, error) {
+	read, err := reader.ReadCloser.Read(data)
+	if remaining := capturedBodyLimit - reader.Captured.Len(); remaining > 0 {
+		if read < remaining {
+			remaining = read
+		}
+		reader.Captured.Write(data[:remaining])
+	}
+	return read, err
+}
+
+// EntryOf describes a query from its query string or, for endpoints taking a
+// JSON body, from the id, from and to fields of that body.
+func EntryOf(request *http.Request, capturedBody []byte, route string, status int, started time.Time) *Entry {
+	entry := &Entry{Time: started, Route: route, Status: status, Duration: config.Duration{Duration: time.Since(started)}}
+	if entry.Status == 0 {
+		entry.Status = http.StatusOK
+	}
+
+	var bodyFields struct {
+		Id         string     `json:"id"`
+		HardwareId string     `json:"hardwareId"`
+		From       *time.Time `json:"from"`
+		To         *time.Time `json:"to"`
+	}
+	if len(capturedBody) > 0 {
+		json.Unmarshal(capturedBody, &bodyFields)
+	}
+
+	query := request.URL.Query()
+	for _, hardwareId := range []string{query.Get("id"), query.Get("hardwareId"), bodyFields.Id, bodyFields.HardwareId} {
+		if hardwareId != "" {
+			entry.HardwareId = hardwareId
+			break
+		}
+	}
+	entry.From, entry.To = bodyFields.From, bodyFields.To
+	if from, err := time.Parse(time.RFC3339, query.Get("from")); err == nil {
+		entry.From = &from
+	}
+	if to, err := time.Parse(time.RFC3339, query.Get("to")); err == nil {
+		entry.To = &to
+	}
+	return entry
+}
+
+var (
+	entriesMutex sync.Mutex
+	entries      []*Entry
+	loadedPath   string
+	loaded       bool
+	output       *logFile
+)
+
+// logFile appends entries to the query log through a buffer, keeping the file
+// open between them. It rotates between entries, never through one, so every
+// file reads back whole.
+type logFile struct {
+	path       string
+	maxSize    int64
+	maxBackups int
+
+	file   *os.File
+	writer *bufio.Writer
+
+	// size counts the buffered bytes along with those in the file.
+	size int64
+}
+
+func (output *logFile) open() error {
+	file, err := os.OpenFile(output.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf(`unable to open query log "%s": %w`, output.path, err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf(`unable to stat query log "%s": %w`, output.path, err)
+	}
+	output.file, output.writer, output.size = file, bufio.NewWriter(file), info.Size()
+	return nil
+}
+
+func (output *logFile) write(line []byte) error {
+	if output.file == nil {
+		if err := output.open(); err != nil {
+			return err
+		}
+	}
+	if output.maxSize > 0 && output.size > 0 && output.size+int64(len(line)) > output.maxSize {
+		if err := output.close(); err != nil {
+			return err
+		}
+		if err := accesslog.ShiftBackups(output.path, output.maxBackups); err != nil {
+			return fmt.Errorf(`unable to rotate query log "%s": %w`, output.path, err)
+		}
+		if err := output.open(); err != nil {
+			return err
+		}
+	}
+	written, err := output.writer.Write(line)
+	output.size += int64(written)
+	return err
+}
+
+func (output *logFile) close() error {
+	if output.file == nil {
+		return nil
+	}
+	err := output.writer.Flush()
+	if closeErr := output.file.Close(); err == nil {
+		err = closeErr
+	}
+	output.file, output.writer = nil, nil
+	return err
+}
+
+// load reads back the entries persisted by a previous run, from the oldest
+// backup to the current file.
+func load(path string, maxBackups int) {
+	for backup := maxBackups; backup >= 0; backup-- {
+		backupPath := path
+		if backup > 0 {
+			backupPath = fmt.Sprintf("%s.%d", path, backup)
+		}
+		loadFile(backupPath)
+	}
+}
+
+func loadFile(path string) {
+	file, err := os.Open(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("unable to read query log \"%s\": %v\n", path, err)
+		}
+		return
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var entry Entry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err == nil {
+			entries = append(entries, &entry)
+		}
+	}
+}
+
+// Record keeps an entry in memory, bounded by the configured maximum, and
+// appends it to the query log file when one is configured. Appended entries
+// reach the file once the buffer fills or on Close.
+func Record(entry *Entry) {
+	queryLogConfig := config.Current.QueryLog
+
+	entriesMutex.Lock()
+	defer entriesMutex.Unlock()
+
+	if !loaded || loadedPath != queryLogConfig.Path {
+		if output != nil {
+			output.close()
+			output = nil
+		}
+		entries, loaded, loadedPath = nil, true, queryLogConfig.Path
+		if queryLogConfig.Path != "" {
+			load(queryLogConfig.Path, queryLogConfig.MaxBackups)
+			output = &logFile{path: queryLogConfig.Path, maxSize: queryLogConfig.MaxSize, maxBackups: queryLogConfig.MaxBackups}
+		}
+	}
+
+	entries = append(entries, entry)
+	if maxEntries := queryLogConfig.MaxEntries; maxEntries > 0 && len(entries) > maxEntries {
+		entries = append([]*Entry(nil), entries[len(entries)-maxEntries:]...)
+	}
+
+	if output == nil {
+		return
+	}
+	entryBytes, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+	if err := output.write(append(entryBytes, '\n')); err != nil {
+		log.Println(err)
+	}
+}
+
+// Close flushes and closes the query log file; a later entry opens it again.
+func Close() error {
+	entriesMutex.Lock()
+	defer entriesMutex.Unlock()
+
+	if output == nil {
+		return nil
+	}
+	return output.close()
+}
+
+type Frequency struct {
+	Route        string          `json:"route"`
+	HardwareId   string          `json:"hardwareId,omitempty"`
+	Window       string          `json:"window,omitempty"`
+	Count        int             `json:"count"`
+	MeanDuration config.Duration `json:"meanDuration"`
+	MaxDuration  config.Duration `json:"maxDuration"`
+}
+
+type Summary struct {
+	Entries      int          `json:"entries"`
+	Slowest      []*Entry     `json:"slowest"`
+	MostFrequent []*Frequency `json:"mostFrequent"`
+}
+
+// Summarize ranks the recorded queries by duration and groups them by route,
+// hardware and window length to find the most frequent ones, which are the
+// candidates for pre-aggregation and caching.
+func Summarize(top int) *Summary {
+	entriesMutex.Lock()
+	recordedEntries := append([]*Entry(nil), entries...)
+	entriesMutex.Unlock()
+
+	summary := &Summary{Entries: len(recordedEntries)}
+
+	slowest := append([]*Entry(nil), recordedEntries...)
+	sort.SliceStable(slowest, func(leftIndex, rightIndex int) bool {
+		return slowest[leftIndex].Duration.Duration > slowest[rightIndex].Duration.Duration
+	})
+	if len(slowest) > top {
+		slowest = slowest[:top]
+	}
+	summary.Slowest = slowest
+
+	frequencies := make(map[[3]string]*Frequency)
+	totalDurations := make(map[[3]string]time.Duration)
+	for _, entry := range recordedEntries {
+		window := ""
+		if entry.From != nil && entry.To != nil {
+			window = entry.To.Sub(*entry.From).String()
+		}
+		key := [3]string{entry.Route, entry.HardwareId, window}
+		frequency, hasFrequency := frequencies[key]
+		if !hasFrequency {
+			frequency = &Frequency{Route: entry.Route, HardwareId: entry.HardwareId, Window: window}
+			frequencies[key] = frequency
+		}
+		frequency.Count++
+		totalDurations[key] += entry.Duration.Duration
+		if entry.Duration.Duration > frequency.MaxDuration.Duration {
+			frequency.MaxDuration = entry.Duration
+		}
+	}
+
+	summary.MostFrequent = make([]*Frequency, 0, len(frequencies))
+	for key, frequency := range frequencies {
+		frequency.MeanDuration.Duration = totalDurations[key] / time.Duration(frequency.Count)
+		summary.MostFrequent = append(summary.MostFrequent, frequency)
+	}
+	sort.Slice(summary.MostFrequent, func(leftIndex, rightIndex int) bool {
+		left, right := summary.MostFrequent[leftIndex], summary.MostFrequent[rightIndex]
+		if left.Count != right.Count {
+			return left.Count > right.Count
+		}
+		return left.MeanDuration.Duration > right.MeanDuration.Duration
+	})
+	if len(summary.MostFrequent) > top {
+		summary.MostFrequent = summary.MostFrequent[:top]
+	}
+	return summary
+}
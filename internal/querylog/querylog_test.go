@@ -0,0 +1,78 @@
+package querylog_test
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/config"
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/internal/querylog"
+)
+
+// linesOf parses every line of a query log file, failing on any that is not
+// a whole entry.
+func linesOf(t *testing.T, path string) int {
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	lines := 0
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var entry querylog.Entry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			t.Fatalf(`line %d of "%s" is not an entry: %v`, lines+1, path, err)
+		}
+		lines++
+	}
+	return lines
+}
+
+func TestRotation(t *testing.T) {
+	previousQueryLog := config.Current.QueryLog
+	defer func() { config.Current.QueryLog = previousQueryLog }()
+
+	path := filepath.Join(t.TempDir(), "queries.jsonl")
+	config.Current.QueryLog = config.QueryLog{Path: path, MaxEntries: 1000, MaxSize: 1 << 10, MaxBackups: 2}
+	for entryIndex := 0; entryIndex < 40; entryIndex++ {
+		querylog.Record(&querylog.Entry{Time: time.Unix(int64(entryIndex), 0).UTC(), Route: "/api/tabulated_hardware", HardwareId: "rotation_fan", Status: 200})
+	}
+	if err := querylog.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	persisted := 0
+	for _, filePath := range []string{path, path + ".1", path + ".2"} {
+		info, err := os.Stat(filePath)
+		if err != nil {
+			t.Fatalf(`expected "%s" to exist: %v`, filePath, err)
+		}
+		if info.Size() > config.Current.QueryLog.MaxSize {
+			t.Errorf(`expected "%s" to stay within %d bytes, got %d`, filePath, config.Current.QueryLog.MaxSize, info.Size())
+		}
+		persisted += linesOf(t, filePath)
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Errorf(`expected no more than 2 backups`)
+	}
+	if persisted == 0 || persisted >= 40 {
+		t.Fatalf(`expected rotation to drop the oldest of 40 entries, %d are left`, persisted)
+	}
+
+	// Switching paths and back reads the files again, backups included
+	config.Current.QueryLog.Path = ""
+	querylog.Record(&querylog.Entry{Route: "/api/hardware"})
+	config.Current.QueryLog.Path = path
+	querylog.Record(&querylog.Entry{Route: "/api/hardware"})
+	if entries := querylog.Summarize(1).Entries; entries != persisted+1 {
+		t.Errorf(`expected %d entries after reloading, got %d`, persisted+1, entries)
+	}
+	if err := querylog.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,173 @@
+// Package slo tracks the latency objectives config.SLOs sets for routes, and
+// how fast each spends its error budget, in per-minute buckets covering the
+// longest window of each objective.
+package slo
+
+import (
+	"math"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/config"
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/metrics"
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/api/statistics"
+)
+
+// gaugePrefix starts the name of every gauge of an objective.
+const gaugePrefix = "slo_"
+
+type bucket struct {
+	minute int64
+	good   int64
+	total  int64
+}
+
+type tracker struct {
+	slo config.SLO
+	// buckets are a ring indexed by minute modulo their number
+	buckets []bucket
+}
+
+type WindowStatus struct {
+	Window     config.Duration      `json:"window"`
+	Requests   int64                `json:"requests"`
+	Good       int64                `json:"good"`
+	Compliance statistics.Statistic `json:"compliance"`
+
+	// BurnRate is how many times faster than the objective allows the error
+	// budget is spent; above 1 it runs out before the window ends.
+	BurnRate float64 `json:"burnRate"`
+}
+
+type Status struct {
+	Name      string          `json:"name"`
+	Route     string          `json:"route"`
+	Threshold config.Duration `json:"threshold"`
+	Objective float64         `json:"objective"`
+	Windows   []*WindowStatus `json:"windows"`
+}
+
+var (
+	trackersMutex sync.Mutex
+	// trackers follow the order of trackedSLOs, which are those of trackedConfig
+	trackers      []*tracker
+	trackedSLOs   []config.SLO
+	trackedConfig *config.Config
+)
+
+// ensureTrackers starts tracking anew whenever the configured objectives
+// change, keeping what was tracked across reloads that leave them be. The
+// trackers must be locked.
+func ensureTrackers() {
+	if trackedConfig == config.Current {
+		return
+	}
+	trackedConfig = config.Current
+	if trackers != nil && reflect.DeepEqual(trackedSLOs, config.Current.SLOs) {
+		return
+	}
+
+	metrics.RemoveGauges(func(name string) bool { return strings.HasPrefix(name, gaugePrefix) })
+	trackedSLOs = append([]config.SLO(nil), config.Current.SLOs...)
+	trackers = make([]*tracker, 0, len(trackedSLOs))
+	for _, slo := range trackedSLOs {
+		longestWindow := time.Minute
+		for _, window := range slo.Windows {
+			if window.Duration > longestWindow {
+				longestWindow = window.Duration
+			}
+		}
+		trackers = append(trackers, &tracker{slo: slo, buckets: make([]bucket, longestWindow/time.Minute)})
+
+		for _, window := range slo.Windows {
+			name, window := slo.Name, window.Duration
+			labels := metrics.Labels("slo", name, "window", window.String())
+			metrics.NewGaugeFunc(gaugePrefix+"burn_rate"+labels, func() float64 {
+				return windowStatusOf(name, window).BurnRate
+			})
+			metrics.NewGaugeFunc(gaugePrefix+"compliance"+labels, func() float64 {
+				if compliance := windowStatusOf(name, window).Compliance.Value; compliance != nil {
+					return *compliance
+				}
+				return math.NaN()
+			})
+		}
+	}
+}
+
+// Observe counts a request against the objectives of its route: good when
+// answered within their threshold without a server error.
+func Observe(route string, status int, duration time.Duration, at time.Time) {
+	trackersMutex.Lock()
+	defer trackersMutex.Unlock()
+
+	ensureTrackers()
+	minute := at.Unix() / 60
+	for _, tracker := range trackers {
+		if tracker.slo.Route != route {
+			continue
+		}
+		slot := &tracker.buckets[minute%int64(len(tracker.buckets))]
+		if slot.minute != minute {
+			*slot = bucket{minute: minute}
+		}
+		slot.total++
+		if status < 500 && duration <= tracker.slo.Threshold.Duration {
+			slot.good++
+		}
+	}
+}
+
+// windowStatus sums up the buckets of the window ending at now. The trackers
+// must be locked.
+func (tracker *tracker) windowStatus(window time.Duration, now time.Time) *WindowStatus {
+	status := &WindowStatus{Window: config.Duration{Duration: window}}
+	nowMinute, windowMinutes := now.Unix()/60, int64(window/time.Minute)
+	for _, slot := range tracker.buckets {
+		if slot.minute > nowMinute-windowMinutes && slot.minute <= nowMinute {
+			status.Requests += slot.total
+			status.Good += slot.good
+		}
+	}
+
+	if status.Requests == 0 {
+		status.Compliance = statistics.Undefined(statistics.ReasonNoData)
+		return status
+	}
+	status.Compliance = statistics.Divide(float64(status.Good), float64(status.Requests))
+	status.BurnRate = float64(status.Requests-status.Good) / float64(status.Requests) / (1 - tracker.slo.Objective)
+	return status
+}
+
+func windowStatusOf(name string, window time.Duration) *WindowStatus {
+	trackersMutex.Lock()
+	defer trackersMutex.Unlock()
+
+	for _, tracker := range trackers {
+		if tracker.slo.Name == name {
+			return tracker.windowStatus(window, time.Now())
+		}
+	}
+	return &WindowStatus{Window: config.Duration{Duration: window}, Compliance: statistics.Undefined(statistics.ReasonNoData)}
+}
+
+// Statuses sums up every objective over each of its windows, in the order
+// they are configured.
+func Statuses() []*Status {
+	trackersMutex.Lock()
+	defer trackersMutex.Unlock()
+
+	ensureTrackers()
+	now := time.Now()
+	statuses := make([]*Status, 0, len(trackers))
+	for _, tracker := range trackers {
+		status := &Status{Name: tracker.slo.Name, Route: tracker.slo.Route, Threshold: tracker.slo.Threshold, Objective: tracker.slo.Objective, Windows: make([]*WindowStatus, 0, len(tracker.slo.Windows))}
+		for _, window := range tracker.slo.Windows {
+			status.Windows = append(status.Windows, tracker.windowStatus(window.Duration, now))
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses
+}
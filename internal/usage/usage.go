@@ -0,0 +1,127 @@
+package usage
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/internal/auth"
+)
+
+type Usage struct {
+	Client   string `json:"client"`
+	Day      string `json:"day"`
+	Requests int64  `json:"requests"`
+	BytesIn  int64  `json:"bytesIn"`
+	BytesOut int64  `json:"bytesOut"`
+}
+
+var (
+	DailyRequestQuota int64
+	DailyByteQuota    int64
+
+	usageMutex sync.Mutex
+	usages     map[string]*Usage = make(map[string]*Usage)
+)
+
+// ClientOf names who a request is counted against: the identity it was
+// authenticated as, its API key, or else its address.
+func ClientOf(request *http.Request) string {
+	if identity := auth.IdentityOf(request); identity != nil {
+		return identity.Client()
+	}
+	if apiKey := request.Header.Get("X-API-Key"); apiKey != "" {
+		return "key:" + apiKey
+	}
+	if host, _, err := net.SplitHostPort(request.RemoteAddr); err == nil {
+		return "address:" + host
+	}
+	return "address:" + request.RemoteAddr
+}
+
+func today() string {
+	return time.Now().UTC().Format("2006-01-02")
+}
+
+func usageOf(client string) *Usage {
+	day := today()
+	clientUsage, hasUsage := usages[client]
+	if !hasUsage || clientUsage.Day != day {
+		clientUsage = &Usage{Client: client, Day: day}
+		usages[client] = clientUsage
+	}
+	return clientUsage
+}
+
+func Lookup(client string) Usage {
+	usageMutex.Lock()
+	defer usageMutex.Unlock()
+
+	return *usageOf(client)
+}
+
+func ExceedsQuota(client string) bool {
+	usageMutex.Lock()
+	defer usageMutex.Unlock()
+
+	clientUsage := usageOf(client)
+	if DailyRequestQuota > 0 && clientUsage.Requests >= DailyRequestQuota {
+		return true
+	}
+	if DailyByteQuota > 0 && clientUsage.BytesIn+clientUsage.BytesOut >= DailyByteQuota {
+		return true
+	}
+	return false
+}
+
+func Record(client string, bytesIn int64, bytesOut int64) {
+	usageMutex.Lock()
+	defer usageMutex.Unlock()
+
+	clientUsage := usageOf(client)
+	clientUsage.Requests++
+	clientUsage.BytesIn += bytesIn
+	clientUsage.BytesOut += bytesOut
+}
+
+type MeteredResponseWriter struct {
+	http.ResponseWriter
+	BytesWritten int64
+}
+
+func (writer *MeteredResponseWriter) Write(data []byte) (int, error) {
+	written, err := writer.ResponseWriter.Write(data)
+	writer.BytesWritten += int64(written)
+	return written, err
+}
+
+func (writer *MeteredResponseWriter) Flush() {
+	if flusher, isFlusher := writer.ResponseWriter.(http.Flusher); isFlusher {
+		flusher.Flush()
+	}
+}
+
+// Hijack hands the connection over to WebSocket handlers. What they write
+// to it is not metered.
+func (writer *MeteredResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, isHijacker := writer.ResponseWriter.(http.Hijacker)
+	if !isHijacker {
+		return nil, nil, errors.New(`the connection cannot be taken over`)
+	}
+	return hijacker.Hijack()
+}
+
+type MeteredReadCloser struct {
+	io.ReadCloser
+	BytesRead int64
+}
+
+func (reader *MeteredReadCloser) Read(data []byte) (int, error) {
+	read, err := reader.ReadCloser.Read(data)
+	reader.BytesRead += int64(read)
+	return read, err
+}
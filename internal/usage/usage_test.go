@@ -0,0 +1,75 @@
+package usage_test
+
+import (
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/internal/usage"
+)
+
+func TestClientOf(t *testing.T) {
+	request := httptest.NewRequest("GET", "/api/usage", nil)
+	request.RemoteAddr = "192.0.2.7:51234"
+	if client := usage.ClientOf(request); client != "address:192.0.2.7" {
+		t.Errorf(`expected the request counted against its address, got "%s"`, client)
+	}
+	request.Header.Set("X-API-Key", "dashboard")
+	if client := usage.ClientOf(request); client != "key:dashboard" {
+		t.Errorf(`expected the request counted against its API key, got "%s"`, client)
+	}
+}
+
+func TestQuotas(t *testing.T) {
+	previousRequestQuota, previousByteQuota := usage.DailyRequestQuota, usage.DailyByteQuota
+	defer func() { usage.DailyRequestQuota, usage.DailyByteQuota = previousRequestQuota, previousByteQuota }()
+
+	usage.DailyRequestQuota, usage.DailyByteQuota = 0, 0
+	usage.Record("key:unmetered", 1<<20, 1<<20)
+	if usage.ExceedsQuota("key:unmetered") {
+		t.Errorf(`a client exceeded quotas that are off`)
+	}
+
+	usage.DailyRequestQuota = 2
+	for request := 0; request < 2; request++ {
+		if usage.ExceedsQuota("key:requests") {
+			t.Fatalf(`request %d was refused below the request quota`, request+1)
+		}
+		usage.Record("key:requests", 10, 100)
+	}
+	if !usage.ExceedsQuota("key:requests") {
+		t.Errorf(`a third request was let through a quota of 2`)
+	}
+	if clientUsage := usage.Lookup("key:requests"); clientUsage.Requests != 2 || clientUsage.BytesIn != 20 || clientUsage.BytesOut != 200 {
+		t.Errorf(`unexpected usage %+v`, clientUsage)
+	}
+	if usage.ExceedsQuota("key:other") {
+		t.Errorf(`another client was refused for the first one's requests`)
+	}
+
+	usage.DailyRequestQuota, usage.DailyByteQuota = 0, 1000
+	usage.Record("key:bytes", 400, 599)
+	if usage.ExceedsQuota("key:bytes") {
+		t.Errorf(`a client below the byte quota was refused`)
+	}
+	usage.Record("key:bytes", 0, 1)
+	if !usage.ExceedsQuota("key:bytes") {
+		t.Errorf(`a client that used up the byte quota was let through`)
+	}
+}
+
+func TestMetering(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	response := &usage.MeteredResponseWriter{ResponseWriter: recorder}
+	io.WriteString(response, "first,")
+	io.WriteString(response, "second")
+	if response.BytesWritten != 12 || recorder.Body.String() != "first,second" {
+		t.Errorf(`expected 12 bytes written through, got %d and "%s"`, response.BytesWritten, recorder.Body)
+	}
+
+	request := &usage.MeteredReadCloser{ReadCloser: io.NopCloser(strings.NewReader("timestamp,temperature\n"))}
+	if requestBytes, err := io.ReadAll(request); err != nil || len(requestBytes) != 22 || request.BytesRead != 22 {
+		t.Errorf(`expected 22 bytes read through, got %d and %v`, request.BytesRead, err)
+	}
+}
@@ -0,0 +1,244 @@
+// Package websocket speaks just enough of the WebSocket protocol (RFC 6455)
+// to stream to browsers: the opening handshake, text messages either way,
+// pings and closes. Extensions and subprotocols are not offered.
+package websocket
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+const (
+	opContinuation = 0x0
+	opText         = 0x1
+	opBinary       = 0x2
+	opClose        = 0x8
+	opPing         = 0x9
+	opPong         = 0xa
+
+	// Messages from clients are past this length refused rather than
+	// allocated for: subscribers only ever send filters.
+	maxMessageLength = 4 << 10
+
+	// acceptGUID is appended to the key of a handshake to accept it with.
+	acceptGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+)
+
+var (
+	ErrHandshake = errors.New("invalid WebSocket handshake")
+	ErrClosed    = errors.New("WebSocket closed")
+)
+
+// Conn is a WebSocket connection to a client. Messages may be written while
+// another goroutine reads.
+type Conn struct {
+	connection net.Conn
+	reader     *bufio.Reader
+
+	writeMutex sync.Mutex
+	isClosed   bool
+}
+
+// IsUpgrade reports whether a request asks to switch to WebSockets.
+func IsUpgrade(request *http.Request) bool {
+	if !strings.EqualFold(request.Header.Get("Upgrade"), "websocket") {
+		return false
+	}
+	for _, connection := range request.Header.Values("Connection") {
+		for _, option := range strings.Split(connection, ",") {
+			if strings.EqualFold(strings.TrimSpace(option), "upgrade") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Upgrade completes the opening handshake of a request and takes its
+// connection over from the server. Requests that are not a valid handshake
+// are refused with ErrHandshake, before anything is written.
+func Upgrade(response http.ResponseWriter, request *http.Request) (*Conn, error) {
+	if request.Method != "GET" || !IsUpgrade(request) {
+		return nil, fmt.Errorf(`%w: not an upgrade to WebSockets`, ErrHandshake)
+	}
+	if version := request.Header.Get("Sec-WebSocket-Version"); version != "13" {
+		return nil, fmt.Errorf(`%w: unsupported version "%s"`, ErrHandshake, version)
+	}
+	key := request.Header.Get("Sec-WebSocket-Key")
+	if keyBytes, err := base64.StdEncoding.DecodeString(key); err != nil || len(keyBytes) != 16 {
+		return nil, fmt.Errorf(`%w: malformed key "%s"`, ErrHandshake, key)
+	}
+	hijacker, isHijacker := response.(http.Hijacker)
+	if !isHijacker {
+		return nil, errors.New(`the connection cannot be taken over`)
+	}
+
+	connection, readWriter, err := hijacker.Hijack()
+	if err != nil {
+		return nil, err
+	}
+	accept := sha1.Sum([]byte(key + acceptGUID))
+	if _, err := fmt.Fprintf(connection, "HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Accept: %s\r\n\r\n", base64.StdEncoding.EncodeToString(accept[:])); err != nil {
+		connection.Close()
+		return nil, err
+	}
+	return &Conn{connection: connection, reader: readWriter.Reader}, nil
+}
+
+// writeFrame writes one unfragmented frame. Frames from servers are not
+// masked.
+func (conn *Conn) writeFrame(opcode byte, payload []byte) error {
+	conn.writeMutex.Lock()
+	defer conn.writeMutex.Unlock()
+
+	if conn.isClosed {
+		return ErrClosed
+	}
+	header := []byte{0x80 | opcode}
+	switch {
+	case len(payload) < 126:
+		header = append(header, byte(len(payload)))
+	case len(payload) <= 0xffff:
+		header = append(header, 126)
+		header = binary.BigEndian.AppendUint16(header, uint16(len(payload)))
+	default:
+		header = append(header, 127)
+		header = binary.BigEndian.AppendUint64(header, uint64(len(payload)))
+	}
+	if opcode == opClose {
+		conn.isClosed = true
+	}
+	if _, err := conn.connection.Write(append(header, payload...)); err != nil {
+		return err
+	}
+	return nil
+}
+
+// WriteText sends a text message.
+func (conn *Conn) WriteText(message []byte) error {
+	return conn.writeFrame(opText, message)
+}
+
+// Ping asks the client for a pong, keeping an idle connection open through
+// proxies. Pongs are read and dropped by ReadMessage.
+func (conn *Conn) Ping() error {
+	return conn.writeFrame(opPing, nil)
+}
+
+// ReadMessage reads the next text or binary message, answering pings and
+// closes on the way. It returns ErrClosed once the client closed the
+// connection.
+func (conn *Conn) ReadMessage() ([]byte, error) {
+	var message []byte
+	var isFragmented bool
+	for {
+		isFinal, opcode, payload, err := conn.readFrame()
+		if err != nil {
+			return nil, err
+		}
+
+		switch opcode {
+		case opPing:
+			if err := conn.writeFrame(opPong, payload); err != nil {
+				return nil, err
+			}
+			continue
+		case opPong:
+			continue
+		case opClose:
+			// Echoed with the status the client closed with, if any
+			if len(payload) > 2 {
+				payload = payload[:2]
+			}
+			conn.writeFrame(opClose, payload)
+			return nil, ErrClosed
+		case opText, opBinary:
+			if isFragmented {
+				return nil, fmt.Errorf(`message started within another`)
+			}
+		case opContinuation:
+			if !isFragmented {
+				return nil, fmt.Errorf(`continuation without a message`)
+			}
+		default:
+			return nil, fmt.Errorf(`unknown opcode %#x`, opcode)
+		}
+
+		if len(message)+len(payload) > maxMessageLength {
+			return nil, fmt.Errorf(`message longer than %d bytes`, maxMessageLength)
+		}
+		message = append(message, payload...)
+		if isFinal {
+			return message, nil
+		}
+		isFragmented = true
+	}
+}
+
+// readFrame reads one frame, unmasking its payload. Frames from clients are
+// always masked, and control frames are never fragmented nor longer than 125
+// bytes.
+func (conn *Conn) readFrame() (bool, byte, []byte, error) {
+	var header [2]byte
+	if _, err := io.ReadFull(conn.reader, header[:]); err != nil {
+		return false, 0, nil, err
+	}
+	isFinal, opcode := header[0]&0x80 != 0, header[0]&0x0f
+	if header[0]&0x70 != 0 {
+		return false, 0, nil, fmt.Errorf(`unnegotiated extension bits %#x`, header[0]&0x70)
+	}
+	if header[1]&0x80 == 0 {
+		return false, 0, nil, fmt.Errorf(`unmasked frame from the client`)
+	}
+
+	length := uint64(header[1] & 0x7f)
+	switch length {
+	case 126:
+		var extendedLength [2]byte
+		if _, err := io.ReadFull(conn.reader, extendedLength[:]); err != nil {
+			return false, 0, nil, err
+		}
+		length = uint64(binary.BigEndian.Uint16(extendedLength[:]))
+	case 127:
+		var extendedLength [8]byte
+		if _, err := io.ReadFull(conn.reader, extendedLength[:]); err != nil {
+			return false, 0, nil, err
+		}
+		length = binary.BigEndian.Uint64(extendedLength[:])
+	}
+	if opcode&0x8 != 0 && (!isFinal || length > 125) {
+		return false, 0, nil, fmt.Errorf(`malformed control frame`)
+	}
+	if length > maxMessageLength {
+		return false, 0, nil, fmt.Errorf(`frame longer than %d bytes`, maxMessageLength)
+	}
+
+	var mask [4]byte
+	if _, err := io.ReadFull(conn.reader, mask[:]); err != nil {
+		return false, 0, nil, err
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(conn.reader, payload); err != nil {
+		return false, 0, nil, err
+	}
+	for index := range payload {
+		payload[index] ^= mask[index%4]
+	}
+	return isFinal, opcode, payload, nil
+}
+
+// Close sends a normal closure, unless a close was already sent, and closes
+// the connection.
+func (conn *Conn) Close() error {
+	conn.writeFrame(opClose, []byte{0x03, 0xe8})
+	return conn.connection.Close()
+}
@@ -0,0 +1,100 @@
+package websocket_test
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/sorucoder/hackpsu-2022-kcf-industry-challenge-4.0/internal/websocket"
+)
+
+// maskedFrame is a final frame as a client sends it.
+func maskedFrame(opcode byte, payload string) []byte {
+	mask := []byte{0x12, 0x34, 0x56, 0x78}
+	frame := append([]byte{0x80 | opcode, 0x80 | byte(len(payload))}, mask...)
+	for index := range payload {
+		frame = append(frame, payload[index]^mask[index%4])
+	}
+	return frame
+}
+
+// readFrame reads an unfragmented frame of fewer than 126 bytes as a server
+// sends it.
+func readFrame(t *testing.T, reader *bufio.Reader) (byte, string) {
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(reader, header); err != nil {
+		t.Fatal(err)
+	}
+	payload := make([]byte, header[1])
+	if _, err := io.ReadFull(reader, payload); err != nil {
+		t.Fatal(err)
+	}
+	return header[0] & 0x0f, string(payload)
+}
+
+func TestConn(t *testing.T) {
+	// Echoes every message back until the client closes
+	server := httptest.NewServer(http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+		connection, err := websocket.Upgrade(response, request)
+		if err != nil {
+			response.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		defer connection.Close()
+		for {
+			message, err := connection.ReadMessage()
+			if err != nil {
+				return
+			}
+			connection.WriteText(message)
+		}
+	}))
+	defer server.Close()
+
+	response, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	if response.StatusCode != http.StatusBadRequest {
+		t.Errorf(`expected a plain request refused, got %d`, response.StatusCode)
+	}
+
+	connection, err := net.Dial("tcp", strings.TrimPrefix(server.URL, "http://"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer connection.Close()
+	// The handshake of RFC 6455, section 1.3
+	connection.Write([]byte("GET / HTTP/1.1\r\nHost: example\r\nUpgrade: websocket\r\nConnection: keep-alive, Upgrade\r\nSec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\nSec-WebSocket-Version: 13\r\n\r\n"))
+	reader := bufio.NewReader(connection)
+	handshake, err := http.ReadResponse(reader, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if handshake.StatusCode != http.StatusSwitchingProtocols || handshake.Header.Get("Sec-WebSocket-Accept") != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Fatalf(`expected the handshake accepted, got %d and %q`, handshake.StatusCode, handshake.Header.Get("Sec-WebSocket-Accept"))
+	}
+
+	// A message split in two comes back whole
+	firstFragment := maskedFrame(0x1, `{"metrics":`)
+	firstFragment[0] &^= 0x80
+	connection.Write(append(firstFragment, maskedFrame(0x0, `["temperature"]}`)...))
+	if opcode, message := readFrame(t, reader); opcode != 0x1 || message != `{"metrics":["temperature"]}` {
+		t.Errorf(`expected the message echoed as text, got %#x %q`, opcode, message)
+	}
+
+	connection.Write(maskedFrame(0x9, "are you there"))
+	if opcode, message := readFrame(t, reader); opcode != 0xa || message != "are you there" {
+		t.Errorf(`expected a ping answered with a pong, got %#x %q`, opcode, message)
+	}
+
+	connection.Write(maskedFrame(0x8, "\x03\xe8"))
+	if opcode, message := readFrame(t, reader); opcode != 0x8 || message != "\x03\xe8" {
+		t.Errorf(`expected a close echoed, got %#x %q`, opcode, message)
+	}
+}